@@ -19,6 +19,16 @@ CLOUDSWEEPER_POLICY='{
                 "ec2:DescribeVolumeAttribute",
                 "ec2:DescribeImages",
                 "ec2:DescribeSnapshotAttribute",
+                "ec2:DescribeLaunchTemplates",
+                "ec2:DescribeLaunchTemplateVersions",
+                "ec2:DescribeNatGateways",
+                "ec2:DescribeVpcEndpoints",
+                "ec2:DescribeHosts",
+                "ec2:DescribeCapacityReservations",
+                "ssm:GetParameter",
+                "ssm:GetParametersByPath",
+                "cloudtrail:LookupEvents",
+                "iam:ListAccountAliases",
                 "ec2:DeregisterImage",
                 "ec2:DeleteSnapshot",
                 "ec2:DeleteTags",
@@ -27,6 +37,10 @@ CLOUDSWEEPER_POLICY='{
                 "ec2:TerminateInstances",
                 "ec2:CreateTags",
                 "ec2:StopInstances",
+                "ec2:DeleteNatGateway",
+                "ec2:DeleteVpcEndpoints",
+                "ec2:ReleaseHosts",
+                "ec2:CancelCapacityReservation",
                 "s3:GetBucketTagging",
                 "s3:ListBucket",
                 "s3:GetObject",
@@ -35,6 +49,17 @@ CLOUDSWEEPER_POLICY='{
                 "s3:PutBucketTagging",
                 "s3:DeleteObject",
                 "s3:DeleteBucket",
+                "dynamodb:ListTables",
+                "dynamodb:DescribeTable",
+                "dynamodb:ListTagsOfResource",
+                "dynamodb:DeleteTable",
+                "dynamodb:TagResource",
+                "dynamodb:UntagResource",
+                "elasticache:DescribeCacheClusters",
+                "elasticache:ListTagsForResource",
+                "elasticache:DeleteCacheCluster",
+                "elasticache:AddTagsToResource",
+                "elasticache:RemoveTagsFromResource",
                 "cloudwatch:GetMetricStatistics"
             ],
             "Resource": [
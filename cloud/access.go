@@ -0,0 +1,35 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import "fmt"
+
+// CheckAccess checks that Cloudsweeper can access an account, by assuming
+// all roles in RoleChain in AWS, or by getting the project with the GCP
+// credentials in GCP
+func CheckAccess(csp CSP, account string) error {
+	switch csp {
+	case AWS:
+		return checkAWSAccess(account)
+	case GCP:
+		return checkGCPAccess(account)
+	default:
+		return fmt.Errorf("Unknown CSP %s", csp)
+	}
+}
+
+// CallerIdentity returns the principal of the credentials Cloudsweeper is
+// run with, before any role in RoleChain is assumed. In AWS it's the ARN
+// of the user or assumed role session, such as an SSO session named after
+// the user, and in GCP it's the email of the user or service account.
+func CallerIdentity(csp CSP) (string, error) {
+	switch csp {
+	case AWS:
+		return awsCallerIdentity()
+	case GCP:
+		return gcpCallerIdentity()
+	default:
+		return "", fmt.Errorf("Unknown CSP %s", csp)
+	}
+}
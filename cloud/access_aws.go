@@ -0,0 +1,42 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// checkAWSAccess assumes the role in an account, and makes sure that the
+// role really is in that account
+func checkAWSAccess(account string) error {
+	sess := NewAWSSession()
+	client := sts.New(sess, &aws.Config{
+		Credentials: AWSCredentials(sess, account),
+		Region:      aws.String(defaultAWSRegion),
+	})
+	output, err := client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("Could not assume role: %s", err)
+	}
+	if aws.StringValue(output.Account) != account {
+		return fmt.Errorf("Assumed role %s is in account %s", aws.StringValue(output.Arn), aws.StringValue(output.Account))
+	}
+	return nil
+}
+
+// awsCallerIdentity returns the ARN of the default credentials
+func awsCallerIdentity() (string, error) {
+	client := sts.New(NewAWSSession(), &aws.Config{Region: aws.String(defaultAWSRegion)})
+	output, err := client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("Could not get caller identity: %s", err)
+	}
+	return aws.StringValue(output.Arn), nil
+}
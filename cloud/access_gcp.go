@@ -0,0 +1,49 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"fmt"
+
+	compute "google.golang.org/api/compute/v1"
+	oauth2api "google.golang.org/api/oauth2/v2"
+)
+
+// checkGCPAccess gets a project with the GCP credentials, which fails if
+// they are invalid or have no access to the project
+func checkGCPAccess(project string) error {
+	client, err := getGCPHttpClient(scopeGCPCompute)
+	if err != nil {
+		return err
+	}
+	computeService, err := compute.New(client)
+	if err != nil {
+		return fmt.Errorf("Could not initialize compute service: %s", err)
+	}
+	if _, err := computeService.Projects.Get(project).Do(); err != nil {
+		return fmt.Errorf("Could not get project: %s", err)
+	}
+	return nil
+}
+
+// gcpCallerIdentity returns the email of the user or service account of
+// the GCP credentials
+func gcpCallerIdentity() (string, error) {
+	client, err := getGCPHttpClient(scopeGCPUserEmail)
+	if err != nil {
+		return "", err
+	}
+	oauth2Service, err := oauth2api.New(client)
+	if err != nil {
+		return "", fmt.Errorf("Could not initialize oauth2 service: %s", err)
+	}
+	info, err := oauth2Service.Userinfo.Get().Do()
+	if err != nil {
+		return "", fmt.Errorf("Could not get caller identity: %s", err)
+	}
+	return info.Email, nil
+}
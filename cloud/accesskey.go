@@ -0,0 +1,37 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AccessKey is a long-lived key of a service account or user, which can
+// be used to authenticate as that principal
+type AccessKey struct {
+	Account      string
+	Principal    string
+	ID           string
+	CreationTime time.Time
+	// LastUsed is the last time the key was used to authenticate. It is
+	// only valid if LastUsedKnown is true, and zero if the key was never
+	// used.
+	LastUsed      time.Time
+	LastUsedKnown bool
+}
+
+// AccessKeysPerAccount returns the enabled, user managed access keys of
+// all principals in the accounts. Only service account keys in GCP are
+// supported for now. If only some accounts fail, the keys of the others
+// are returned along with AccountErrors for the failed ones.
+func AccessKeysPerAccount(ctx context.Context, csp CSP, accounts []string) (map[string][]*AccessKey, error) {
+	switch csp {
+	case GCP:
+		return gcpAccessKeysPerAccount(ctx, accounts)
+	default:
+		return nil, fmt.Errorf("Listing access keys is not supported in %s", csp)
+	}
+}
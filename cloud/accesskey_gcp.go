@@ -0,0 +1,127 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	iam "google.golang.org/api/iam/v1"
+	policyanalyzer "google.golang.org/api/policyanalyzer/v1"
+)
+
+const (
+	gcpUserManagedKeyType = "USER_MANAGED"
+	gcpKeyActivityType    = "serviceAccountKeyLastAuthentication"
+)
+
+// gcpAccessKeysPerAccount lists the user managed keys of all service
+// accounts in the projects. The last use of the keys is looked up with the
+// activities of the policy analyzer, if that fails the last use of the keys
+// is unknown. Projects whose keys can't be listed are left out, and
+// returned as AccountErrors.
+func gcpAccessKeysPerAccount(ctx context.Context, projects []string) (map[string][]*AccessKey, error) {
+	client, err := getGCPHttpClient(scopeGCPCloud)
+	if err != nil {
+		return nil, err
+	}
+	iamService, err := iam.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize IAM service: %s", err)
+	}
+	analyzerService, err := policyanalyzer.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize policy analyzer service: %s", err)
+	}
+	result := make(map[string][]*AccessKey)
+	status := NewScanStatus()
+	for _, project := range projects {
+		log.Println("Getting service account keys in", project)
+		keys, err := gcpServiceAccountKeys(ctx, iamService, project)
+		if err != nil {
+			status.fail(project, GlobalScan, fmt.Errorf("Could not list service account keys: %s", err))
+			continue
+		}
+		lastUsed, err := gcpKeyLastAuthentications(ctx, analyzerService, project)
+		if err != nil {
+			log.Printf("Could not get last use of service account keys in %s: %s", project, err)
+		} else {
+			for _, key := range keys {
+				key.LastUsed = lastUsed[key.ID]
+				key.LastUsedKnown = true
+			}
+		}
+		result[project] = keys
+	}
+	return result, status.Err()
+}
+
+func gcpServiceAccountKeys(ctx context.Context, iamService *iam.Service, project string) ([]*AccessKey, error) {
+	keys := []*AccessKey{}
+	err := iamService.Projects.ServiceAccounts.List("projects/"+project).Pages(ctx, func(resp *iam.ListServiceAccountsResponse) error {
+		for _, account := range resp.Accounts {
+			if account.Disabled {
+				continue
+			}
+			list, err := iamService.Projects.ServiceAccounts.Keys.List(account.Name).KeyTypes(gcpUserManagedKeyType).Context(ctx).Do()
+			if err != nil {
+				return err
+			}
+			for _, key := range list.Keys {
+				if key.Disabled {
+					continue
+				}
+				created, err := time.Parse(time.RFC3339, key.ValidAfterTime)
+				if err != nil {
+					log.Printf("Could not parse creation time of key %s: %s", key.Name, err)
+				}
+				keys = append(keys, &AccessKey{
+					Account:      project,
+					Principal:    account.Email,
+					ID:           gcpKeyID(key.Name),
+					CreationTime: created,
+				})
+			}
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// gcpKeyLastAuthentications returns the last time each key in the project
+// was used to authenticate, keys that were never used are not included
+func gcpKeyLastAuthentications(ctx context.Context, analyzerService *policyanalyzer.Service, project string) (map[string]time.Time, error) {
+	result := make(map[string]time.Time)
+	parent := fmt.Sprintf("projects/%s/locations/global/activityTypes/%s", project, gcpKeyActivityType)
+	err := analyzerService.Projects.Locations.ActivityTypes.Activities.Query(parent).Pages(ctx, func(resp *policyanalyzer.GoogleCloudPolicyanalyzerV1QueryActivityResponse) error {
+		for _, activity := range resp.Activities {
+			var fields struct {
+				LastAuthenticatedTime string `json:"lastAuthenticatedTime"`
+			}
+			if err := json.Unmarshal(activity.Activity, &fields); err != nil {
+				return fmt.Errorf("Could not parse activity of %s: %s", activity.FullResourceName, err)
+			}
+			lastUsed, err := time.Parse(time.RFC3339, fields.LastAuthenticatedTime)
+			if err != nil {
+				continue
+			}
+			result[gcpKeyID(activity.FullResourceName)] = lastUsed
+		}
+		return nil
+	})
+	return result, err
+}
+
+// gcpKeyID returns the ID of a key from its resource name, which ends with
+// keys/<id>
+func gcpKeyID(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"errors"
+)
+
+// AWSAddressFirstSeen, if set, keeps the time every AWS Elastic IP address
+// was first seen between runs. AWS doesn't tell when an address was
+// allocated, so its age is counted from when it was first seen. Without
+// it, addresses are always as old as the current run.
+var AWSAddressFirstSeen StateStore
+
+type baseAddress struct {
+	baseResource
+	ip    string
+	inUse bool
+}
+
+func (a *baseAddress) IP() string {
+	return a.ip
+}
+
+func (a *baseAddress) InUse() bool {
+	return a.inUse
+}
+
+func cleanupAddresses(ctx context.Context, addresses []Address) error {
+	resList := []Resource{}
+	for i := range addresses {
+		v, ok := addresses[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert Address to Resource")
+		}
+		resList = append(resList, v)
+	}
+	return cleanupResources(ctx, resList)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+// awsAddressFirstSeenNamespace is where the first time every address was
+// seen is kept in AWSAddressFirstSeen, as a mapping from allocation ID to
+// time per account and region
+const awsAddressFirstSeenNamespace = "aws-address-first-seen"
+
+type awsAddress struct {
+	baseAddress
+}
+
+// Cleanup will release this Elastic IP address
+func (a *awsAddress) Cleanup() error {
+	log.Printf("Cleaning up address %s in %s", a.ID(), AccountName(a.Owner()))
+	return awsTryWithBackoff(a.cleanup)
+}
+
+func (a *awsAddress) cleanup() error {
+	_, err := clientForAWSResource(a).ReleaseAddress(&ec2.ReleaseAddressInput{
+		AllocationId: aws.String(a.ID()),
+	})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func (a *awsAddress) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(a, key, value, overwrite)
+}
+
+func (a *awsAddress) RemoveTag(key string) error {
+	return removeAWSTag(a, key)
+}
+
+// awsAddressesFirstSeen returns when each of the specified addresses in an
+// account and region was first seen, and remembers the new ones. Addresses
+// that no longer exist are forgotten.
+func awsAddressesFirstSeen(account, region string, allocationIDs []string) map[string]time.Time {
+	now := clock.Now()
+	result := make(map[string]time.Time)
+	if AWSAddressFirstSeen == nil {
+		for _, id := range allocationIDs {
+			result[id] = now
+		}
+		return result
+	}
+	key := account + "/" + region
+	seen := make(map[string]time.Time)
+	if _, err := AWSAddressFirstSeen.Get(awsAddressFirstSeenNamespace, key, &seen); err != nil {
+		log.Printf("Could not read when addresses in %s (%s) were first seen: %s", AccountName(account), region, err)
+	}
+	changed := false
+	for _, id := range allocationIDs {
+		if firstSeen, ok := seen[id]; ok {
+			result[id] = firstSeen
+		} else {
+			result[id] = now
+			changed = true
+		}
+	}
+	for id := range seen {
+		if _, ok := result[id]; !ok {
+			changed = true
+		}
+	}
+	if changed {
+		if err := AWSAddressFirstSeen.Put(awsAddressFirstSeenNamespace, key, result); err != nil {
+			log.Printf("Could not save when addresses in %s (%s) were first seen: %s", AccountName(account), region, err)
+		}
+	}
+	return result
+}
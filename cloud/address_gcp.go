@@ -0,0 +1,102 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// gcpGlobalLocation is the location of global GCP addresses, which
+// belong to no region
+const gcpGlobalLocation = "global"
+
+type gcpAddress struct {
+	baseAddress
+	compute *compute.Service
+}
+
+func (a *gcpAddress) global() bool {
+	return a.Location() == gcpGlobalLocation
+}
+
+// Cleanup will release this address
+func (a *gcpAddress) Cleanup() error {
+	log.Printf("Cleaning up address %s in %s", a.ID(), AccountName(a.Owner()))
+	if a.global() {
+		_, err := a.compute.GlobalAddresses.Delete(a.Owner(), a.ID()).Do()
+		return err
+	}
+	_, err := a.compute.Addresses.Delete(a.Owner(), a.Location(), a.ID()).Do()
+	return err
+}
+
+func (a *gcpAddress) getAddress() (*compute.Address, error) {
+	if a.global() {
+		return a.compute.GlobalAddresses.Get(a.Owner(), a.ID()).Do()
+	}
+	return a.compute.Addresses.Get(a.Owner(), a.Location(), a.ID()).Do()
+}
+
+func (a *gcpAddress) setLabels(labels map[string]string, fingerprint string) error {
+	if a.global() {
+		req := &compute.GlobalSetLabelsRequest{
+			LabelFingerprint: fingerprint,
+			Labels:           labels,
+		}
+		_, err := a.compute.GlobalAddresses.SetLabels(a.Owner(), a.ID(), req).Do()
+		return err
+	}
+	req := &compute.RegionSetLabelsRequest{
+		LabelFingerprint: fingerprint,
+		Labels:           labels,
+	}
+	_, err := a.compute.Addresses.SetLabels(a.Owner(), a.Location(), a.ID(), req).Do()
+	return err
+}
+
+func (a *gcpAddress) SetTag(key, value string, overwrite bool) error {
+	addr, err := a.getAddress()
+	if err != nil {
+		return err
+	}
+	newLabels := addr.Labels
+	if newLabels == nil {
+		newLabels = make(map[string]string)
+	}
+	if _, exist := newLabels[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, a.ID())
+	}
+	newLabels[key] = value
+	err = a.setLabels(newLabels, addr.LabelFingerprint)
+	if err != nil {
+		return err
+	}
+	a.tags = newLabels
+	return nil
+}
+
+func (a *gcpAddress) RemoveTag(key string) error {
+	newLabels := make(map[string]string)
+	for k, val := range a.tags {
+		if k != key {
+			newLabels[k] = val
+		}
+	}
+	addr, err := a.getAddress()
+	if err != nil {
+		return err
+	}
+	err = a.setLabels(newLabels, addr.LabelFingerprint)
+	if err != nil {
+		return err
+	}
+	a.tags = newLabels
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// accountAliases are the friendly names of accounts/projects by ID, which
+// are looked up once per run. Accounts without an alias, or whose alias
+// couldn't be looked up, have an empty alias.
+var accountAliases = struct {
+	sync.RWMutex
+	aliases map[string]string
+}{aliases: make(map[string]string)}
+
+// SetAccountAlias sets the friendly name of an account/project, such as
+// an alias from the organization file. Empty aliases are ignored.
+func SetAccountAlias(account, alias string) {
+	if alias == "" {
+		return
+	}
+	accountAliases.Lock()
+	defer accountAliases.Unlock()
+	accountAliases.aliases[account] = alias
+}
+
+// AccountAlias returns the friendly name of an account/project, and
+// whether it has one
+func AccountAlias(account string) (string, bool) {
+	accountAliases.RLock()
+	defer accountAliases.RUnlock()
+	alias := accountAliases.aliases[account]
+	return alias, alias != ""
+}
+
+// AccountName returns an account/project ID on the form "alias (ID)", or
+// just the ID if it has no alias, for showing it in mails and logs
+func AccountName(account string) string {
+	if alias, exist := AccountAlias(account); exist && alias != account {
+		return fmt.Sprintf("%s (%s)", alias, account)
+	}
+	return account
+}
+
+// FetchAccountAliases looks up the aliases of the accounts that don't have
+// one yet, with iam:ListAccountAliases in AWS. Accounts whose alias can't
+// be looked up are logged, and only shown with their ID. GCP projects
+// have no aliases, so there's nothing to look up in GCP.
+func FetchAccountAliases(csp CSP, accounts []string) {
+	if csp != AWS {
+		return
+	}
+	var wg sync.WaitGroup
+	results := make(chan [2]string)
+	accountAliases.Lock()
+	defer accountAliases.Unlock()
+	for _, account := range accounts {
+		if _, exist := accountAliases.aliases[account]; exist {
+			continue
+		}
+		// Reserve the account, so that it's only looked up once
+		accountAliases.aliases[account] = ""
+		wg.Add(1)
+		go func(account string) {
+			defer wg.Done()
+			alias, err := fetchAWSAccountAlias(account)
+			if err != nil {
+				log.Printf("Could not look up the alias of %s: %s\n", account, err)
+				return
+			}
+			results <- [2]string{account, alias}
+		}(account)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	for result := range results {
+		accountAliases.aliases[result[0]] = result[1]
+	}
+}
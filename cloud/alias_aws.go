@@ -0,0 +1,32 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// fetchAWSAccountAlias returns the alias of an account, using the role in
+// it, or an empty string if it has none. An account has at most one alias.
+func fetchAWSAccountAlias(account string) (string, error) {
+	sess := NewAWSSession()
+	client := iam.New(sess, &aws.Config{
+		Credentials: AWSCredentials(sess, account),
+		Region:      aws.String(defaultAWSRegion),
+	})
+	output, err := client.ListAccountAliases(&iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", fmt.Errorf("Could not list account aliases: %s", err)
+	}
+	if len(output.AccountAliases) == 0 {
+		return "", nil
+	}
+	return aws.StringValue(output.AccountAliases[0]), nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import "sync"
+
+// APICallStats counts the requests made to a service of the cloud
+// provider during a run
+type APICallStats struct {
+	// Calls is the number of requests
+	Calls int
+	// Retries is the number of attempts made after the first one of a
+	// request, such as after it was throttled
+	Retries int
+}
+
+var (
+	apiCallMutex sync.Mutex
+	apiCalls     = make(map[string]APICallStats)
+)
+
+// APICalls returns the requests made so far, by service, such as "ec2"
+// or "compute"
+func APICalls() map[string]APICallStats {
+	apiCallMutex.Lock()
+	defer apiCallMutex.Unlock()
+	calls := make(map[string]APICallStats, len(apiCalls))
+	for service, stats := range apiCalls {
+		calls[service] = stats
+	}
+	return calls
+}
+
+// recordAPICall counts a request to a service that was retried the
+// specified number of times
+func recordAPICall(service string, retries int) {
+	apiCallMutex.Lock()
+	defer apiCallMutex.Unlock()
+	stats := apiCalls[service]
+	stats.Calls++
+	stats.Retries += retries
+	apiCalls[service] = stats
+}
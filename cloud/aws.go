@@ -1,6 +1,9 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+//go:build !noaws
+// +build !noaws
+
 package cloud
 
 import (
@@ -9,6 +12,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,18 +22,21 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 )
 
 const (
 	defaultAWSRegion = "us-west-2"
-	gbDivider        = 1024.0 * 1024.0 * 1024.0
 	awsStateInUse    = "in-use"
 )
 
@@ -37,23 +44,49 @@ const (
 // https://docs.aws.amazon.com/sdk-for-go/api/service/ec2/
 type awsResourceManager struct {
 	accounts []string
+	status   *ScanStatus
+}
+
+func init() {
+	registerManager(AWS, newAWSResourceManager)
+}
+
+func newAWSResourceManager(accounts []string) (ResourceManager, error) {
+	log.Println("Initializing AWS Resource Manager")
+	manager := &awsResourceManager{
+		accounts: accounts,
+		status:   NewScanStatus(),
+	}
+	return manager, nil
 }
 
 func (m *awsResourceManager) Owners() []string {
 	return m.accounts
 }
 
-const (
-	assumeRoleARNTemplate = "arn:aws:iam::%s:role/Cloudsweeper"
+func (m *awsResourceManager) ScanStatus() *ScanStatus {
+	return m.status
+}
 
+const (
 	accessDeniedErrorCode = "AccessDenied"
 	unauthorizedErrorCode = "UnauthorizedOperation"
 	notFoundErrorOcde     = "NotFound"
 	requestLimitErrorCode = "RequestLimitExceeded"
+	// Some services, such as DynamoDB, use this instead of AccessDenied
+	accessDeniedExceptionErrorCode = "AccessDeniedException"
+
+	awsImageIDPrefix    = "ami-"
+	awsSnapshotIDPrefix = "snap-"
 
 	snapshotIDFilterName = "block-device-mapping.snapshot-id"
 
 	awsMaxRequestRetries = 6
+
+	// awsActivityLookbackDays is how many days back CloudWatch is
+	// searched for activity on tables, cache clusters, gateways and
+	// public instances
+	awsActivityLookbackDays = 90
 )
 
 var (
@@ -75,14 +108,33 @@ var awsS3StorageTypes = []string{
 	"GlacierStorage",
 }
 
-func (m *awsResourceManager) InstancesPerAccount() map[string][]Instance {
+// awsProvisionedIOPSVolumeTypes are the EBS volume types where the
+// IOPS are provisioned, rather than given by the size of the volume
+var awsProvisionedIOPSVolumeTypes = map[string]bool{
+	"io1": true,
+	"io2": true,
+	"gp3": true,
+}
+
+// awsS3StorageClassTypes maps the storage class of S3 objects to
+// the storage type of their size in CloudWatch
+var awsS3StorageClassTypes = map[string]string{
+	"STANDARD":            "StandardStorage",
+	"INTELLIGENT_TIERING": "IntelligentTieringFAStorage",
+	"STANDARD_IA":         "StandardIAStorage",
+	"ONEZONE_IA":          "OneZoneIAStorage",
+	"REDUCED_REDUNDANCY":  "ReducedRedundancyStorage",
+	"GLACIER":             "GlacierStorage",
+}
+
+func (m *awsResourceManager) InstancesPerAccount(ctx context.Context) map[string][]Instance {
 	log.Println("Getting instances in all accounts")
 	resultMap := make(map[string][]Instance)
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
-		instances, err := getAWSInstances(account, client)
+	m.getAllEC2Resources(ctx, func(client *ec2.EC2, account string) {
+		instances, err := getAWSInstances(ctx, account, client, cloudWatchForAWSClient(client))
 		if err != nil {
-			handleAWSAccessDenied(account, err)
+			m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 		} else if len(instances) > 0 {
 			resultMutext.Lock()
 			resultMap[account] = append(resultMap[account], instances...)
@@ -92,14 +144,14 @@ func (m *awsResourceManager) InstancesPerAccount() map[string][]Instance {
 	return resultMap
 }
 
-func (m *awsResourceManager) ImagesPerAccount() map[string][]Image {
+func (m *awsResourceManager) ImagesPerAccount(ctx context.Context) map[string][]Image {
 	log.Println("Getting images in all accounts")
 	resultMap := make(map[string][]Image)
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
-		images, err := getAWSImages(account, client)
+	m.getAllEC2Resources(ctx, func(client *ec2.EC2, account string) {
+		images, err := getAWSImages(ctx, account, client)
 		if err != nil {
-			handleAWSAccessDenied(account, err)
+			m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 		} else if len(images) > 0 {
 			resultMutext.Lock()
 			resultMap[account] = append(resultMap[account], images...)
@@ -109,14 +161,14 @@ func (m *awsResourceManager) ImagesPerAccount() map[string][]Image {
 	return resultMap
 }
 
-func (m *awsResourceManager) VolumesPerAccount() map[string][]Volume {
+func (m *awsResourceManager) VolumesPerAccount(ctx context.Context) map[string][]Volume {
 	log.Println("Getting volumes in all accounts")
 	resultMap := make(map[string][]Volume)
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
-		volumes, err := getAWSVolumes(account, client)
+	m.getAllEC2Resources(ctx, func(client *ec2.EC2, account string) {
+		volumes, err := getAWSVolumes(ctx, account, client)
 		if err != nil {
-			handleAWSAccessDenied(account, err)
+			m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 		} else if len(volumes) > 0 {
 			resultMutext.Lock()
 			resultMap[account] = append(resultMap[account], volumes...)
@@ -126,14 +178,14 @@ func (m *awsResourceManager) VolumesPerAccount() map[string][]Volume {
 	return resultMap
 }
 
-func (m *awsResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
+func (m *awsResourceManager) SnapshotsPerAccount(ctx context.Context) map[string][]Snapshot {
 	log.Println("Getting snapshots in all accounts")
 	resultMap := make(map[string][]Snapshot)
 	var resultMutext sync.Mutex
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
-		snapshots, err := getAWSSnapshots(account, client)
+	m.getAllEC2Resources(ctx, func(client *ec2.EC2, account string) {
+		snapshots, err := getAWSSnapshots(ctx, account, client)
 		if err != nil {
-			handleAWSAccessDenied(account, err)
+			m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 		} else if len(snapshots) > 0 {
 			resultMutext.Lock()
 			resultMap[account] = append(resultMap[account], snapshots...)
@@ -143,7 +195,7 @@ func (m *awsResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
 	return resultMap
 }
 
-func (m *awsResourceManager) AllResourcesPerAccount() map[string]*ResourceCollection {
+func (m *awsResourceManager) AllResourcesPerAccount(ctx context.Context) map[string]*ResourceCollection {
 	log.Println("Getting all resources in all accounts")
 	resultMap := make(map[string]*ResourceCollection)
 	var resultMutext sync.Mutex
@@ -152,43 +204,43 @@ func (m *awsResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 	}
 	// TODO: Smarter error handling. If one request get access denied, then might as
 	// well abort. The rest are going to fail too.
-	getAllEC2Resources(m.accounts, func(client *ec2.EC2, account string) {
+	m.getAllEC2Resources(ctx, func(client *ec2.EC2, account string) {
 		result := resultMap[account]
 		result.Owner = account
 		var wg sync.WaitGroup
 		wg.Add(4)
 		go func() {
-			snapshots, err := getAWSSnapshots(account, client)
+			snapshots, err := getAWSSnapshots(ctx, account, client)
 			if err != nil {
-				log.Printf("Snapshot error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
+				log.Printf("Snapshot error when getting all resources in %s", AccountName(account))
+				m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 			}
 			result.Snapshots = append(result.Snapshots, snapshots...)
 			wg.Done()
 		}()
 		go func() {
-			instances, err := getAWSInstances(account, client)
+			instances, err := getAWSInstances(ctx, account, client, cloudWatchForAWSClient(client))
 			if err != nil {
-				log.Printf("Instance error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
+				log.Printf("Instance error when getting all resources in %s", AccountName(account))
+				m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 			}
 			result.Instances = append(result.Instances, instances...)
 			wg.Done()
 		}()
 		go func() {
-			images, err := getAWSImages(account, client)
+			images, err := getAWSImages(ctx, account, client)
 			if err != nil {
-				log.Printf("Image error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
+				log.Printf("Image error when getting all resources in %s", AccountName(account))
+				m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 			}
 			result.Images = append(result.Images, images...)
 			wg.Done()
 		}()
 		go func() {
-			volumes, err := getAWSVolumes(account, client)
+			volumes, err := getAWSVolumes(ctx, account, client)
 			if err != nil {
-				log.Printf("Volume error when getting all resources in %s", account)
-				handleAWSAccessDenied(account, err)
+				log.Printf("Volume error when getting all resources in %s", AccountName(account))
+				m.handleAWSError(account, aws.StringValue(client.Config.Region), err)
 			}
 			result.Volumes = append(result.Volumes, volumes...)
 			wg.Done()
@@ -201,9 +253,9 @@ func (m *awsResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 	return resultMap
 }
 
-func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
+func (m *awsResourceManager) BucketsPerAccount(ctx context.Context) map[string][]Bucket {
 	log.Println("Getting all buckets in all accounts")
-	sess := session.Must(session.NewSession())
+	sess := NewAWSSession()
 	resultMap := make(map[string][]Bucket)
 	var resultMutext sync.Mutex
 	forEachAccount(m.accounts, sess, func(account string, cred *credentials.Credentials) {
@@ -211,20 +263,21 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 			Credentials: cred,
 			Region:      aws.String(defaultAWSRegion),
 		})
-		awsBuckets, err := s3Client.ListBuckets(&s3.ListBucketsInput{})
+		awsBuckets, err := s3Client.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
 		if err != nil {
-			log.Printf("Bucket error when getting buckets in %s", account)
-			handleAWSAccessDenied(account, err)
+			log.Printf("Bucket error when getting buckets in %s", AccountName(account))
+			m.handleAWSError(account, GlobalScan, err)
 		} else if len(awsBuckets.Buckets) > 0 {
 			bucketCount := len(awsBuckets.Buckets)
 			buckChan := make(chan *awsBucket)
+			regions := loadAWSBucketRegions(account, sess, awsBuckets.Buckets)
 			for _, bu := range awsBuckets.Buckets {
 				go func(bu *s3.Bucket, resChan chan *awsBucket) {
-					region, err := s3manager.GetBucketRegion(context.Background(), sess, *bu.Name, defaultAWSRegion)
+					region, err := regions.region(ctx, *bu.Name)
 					if err != nil {
 						bucketCount--
-						log.Printf("Couldn't determine bucket region in %s for bucket %s", account, *bu.Name)
-						handleAWSAccessDenied(account, err)
+						log.Printf("Couldn't determine bucket region in %s for bucket %s", AccountName(account), *bu.Name)
+						m.handleAWSError(account, GlobalScan, err)
 						buckChan <- nil
 						return
 					}
@@ -232,9 +285,23 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 						Credentials: cred,
 						Region:      aws.String(region),
 					})
-					buTags, err := bucketClient.GetBucketTagging(&s3.GetBucketTaggingInput{
+					buTags, err := bucketClient.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{
 						Bucket: bu.Name,
 					})
+					if isAWSBucketNotFound(err) {
+						// The cached region is stale, look it up again
+						regions.invalidate(*bu.Name)
+						if newRegion, regionErr := regions.region(ctx, *bu.Name); regionErr == nil {
+							region = newRegion
+							bucketClient = s3.New(sess, &aws.Config{
+								Credentials: cred,
+								Region:      aws.String(region),
+							})
+							buTags, err = bucketClient.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{
+								Bucket: bu.Name,
+							})
+						}
+					}
 					tags := make(map[string]string)
 					if err == nil {
 						tags = convertAWSS3Tags(buTags.TagSet)
@@ -269,7 +336,7 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 						input.Dimensions = []*cloudwatch.Dimension{
 							&dimensionNameFilter, &dimensionBucketSizeFilter,
 						}
-						bucketSizeMetrics, err := cw.GetMetricStatistics(&input)
+						bucketSizeMetrics, err := cw.GetMetricStatisticsWithContext(ctx, &input)
 						if err != nil {
 							fmt.Println("Error", err)
 						}
@@ -305,14 +372,13 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 						&dimensionNameFilter, &dimensionNumberOfObjectsFilter,
 					}
 					input.Unit = aws.String("Count")
-					numberOfObjectsMetrics, err := cw.GetMetricStatistics(&input)
+					numberOfObjectsMetrics, err := cw.GetMetricStatisticsWithContext(ctx, &input)
 					if err != nil {
 						fmt.Println("Error", err)
 					}
-					if numBucketSizeDatapoints == 0 && len(numberOfObjectsMetrics.Datapoints) != 0 {
-						fmt.Println("Warning: Got 0 datapoints from: ", *bu.Name)
-					}
+					numObjectsDatapoints := 0
 					if numberOfObjectsMetrics != nil {
+						numObjectsDatapoints = len(numberOfObjectsMetrics.Datapoints)
 						var minimumTimeDifference float64
 						var timeDifference float64
 						var averageValue *float64
@@ -332,29 +398,55 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 						}
 					}
 
-					// TODO: this should be configurable instead of hardcoded to 6 + 1 months
-					lastMod := time.Now().AddDate(0, -7, 0)
-					err = bucketClient.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+					// S3 lists objects by key, so all objects must be
+					// listed to find the newest one. Their sizes are
+					// used if CloudWatch has no metrics for the bucket.
+					var newestObject time.Time
+					listedObjects := 0
+					listedAll := true
+					listedSizesGB := make(map[string]float64)
+					err = bucketClient.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
 						Bucket: bu.Name, EncodingType: aws.String("url"),
 					}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
 						for _, object := range output.Contents {
-							// if object has been modified in the last 6 months
-							if time.Now().Before(object.LastModified.AddDate(0, 6, 0)) {
-								lastMod = time.Now().AddDate(0, -5, 0)
-								// exit early
-								return false
+							if object.LastModified.After(newestObject) {
+								newestObject = *object.LastModified
+							}
+							storageType, ok := awsS3StorageClassTypes[aws.StringValue(object.StorageClass)]
+							if !ok {
+								storageType = "StandardStorage"
 							}
+							listedSizesGB[storageType] += float64(aws.Int64Value(object.Size)) / gbDivider
+						}
+						listedObjects += len(output.Contents)
+						if !lastPage && listedObjects >= maxBucketObjectsListed {
+							listedAll = false
+							return false
 						}
 						return !lastPage
 					})
 					if err != nil {
 						bucketCount--
-						log.Printf("Failed to list contents in bucket %s, account %s", *bu.Name, account)
-						handleAWSAccessDenied(account, err)
+						log.Printf("Failed to list contents in bucket %s, account %s", *bu.Name, AccountName(account))
+						m.handleAWSError(account, region, err)
 						buckChan <- nil
 						return
 					}
 
+					// New buckets, and buckets without storage metrics,
+					// have no datapoints in CloudWatch. The size of small
+					// buckets is then known from listing their objects.
+					sizeKnown := numBucketSizeDatapoints > 0
+					if !sizeKnown && listedAll {
+						sizeKnown = true
+						storageTypeSizesGB = listedSizesGB
+					} else if !sizeKnown {
+						log.Printf("Size of bucket %s in %s is unknown, it has no metrics in CloudWatch and too many objects to list", *bu.Name, AccountName(account))
+					}
+					if numObjectsDatapoints == 0 && listedAll {
+						numberOfObjects = int64(listedObjects)
+					}
+
 					totalSizeGB := 0.0
 					for _, size := range storageTypeSizesGB {
 						totalSizeGB += size
@@ -369,10 +461,11 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 							creationTime: *bu.CreationDate,
 							tags:         tags,
 						},
-						lastModified:       lastMod,
+						lastModified:       bucketLastModified(*bu.CreationDate, newestObject, listedAll),
 						objectCount:        numberOfObjects,
 						totalSizeGB:        totalSizeGB,
 						storageTypeSizesGB: storageTypeSizesGB,
+						sizeKnown:          sizeKnown,
 					}}
 					buckChan <- &buck
 				}(bu, buckChan)
@@ -385,47 +478,303 @@ func (m *awsResourceManager) BucketsPerAccount() map[string][]Bucket {
 					resultMutext.Unlock()
 				}
 			}
+			regions.save()
+		}
+	})
+	return resultMap
+}
+
+func (m *awsResourceManager) TablesPerAccount(ctx context.Context) map[string][]Table {
+	log.Println("Getting tables in all accounts")
+	resultMap := make(map[string][]Table)
+	var resultMutext sync.Mutex
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		config := &aws.Config{Credentials: cred, Region: aws.String(region)}
+		tables, err := getAWSTables(ctx, account, dynamodb.New(sess, config), cloudwatch.New(sess, config))
+		if err != nil {
+			m.handleAWSError(account, region, err)
+		} else if len(tables) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = append(resultMap[account], tables...)
+			resultMutext.Unlock()
 		}
 	})
 	return resultMap
 }
 
-func (m *awsResourceManager) CleanupInstances(instances []Instance) error {
-	return cleanupInstances(instances)
+func (m *awsResourceManager) CacheClustersPerAccount(ctx context.Context) map[string][]CacheCluster {
+	log.Println("Getting cache clusters in all accounts")
+	resultMap := make(map[string][]CacheCluster)
+	var resultMutext sync.Mutex
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		config := &aws.Config{Credentials: cred, Region: aws.String(region)}
+		clusters, err := getAWSCacheClusters(ctx, account, elasticache.New(sess, config), cloudwatch.New(sess, config))
+		if err != nil {
+			m.handleAWSError(account, region, err)
+		} else if len(clusters) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = append(resultMap[account], clusters...)
+			resultMutext.Unlock()
+		}
+	})
+	return resultMap
+}
+
+func (m *awsResourceManager) AddressesPerAccount(ctx context.Context) map[string][]Address {
+	log.Println("Getting addresses in all accounts")
+	resultMap := make(map[string][]Address)
+	var resultMutext sync.Mutex
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		addresses, err := getAWSAddresses(ctx, account, ec2.New(sess, &aws.Config{Credentials: cred, Region: aws.String(region)}))
+		if err != nil {
+			m.handleAWSError(account, region, err)
+		} else if len(addresses) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = append(resultMap[account], addresses...)
+			resultMutext.Unlock()
+		}
+	})
+	return resultMap
 }
 
-func (m *awsResourceManager) CleanupImages(images []Image) error {
-	return cleanupImages(images)
+func (m *awsResourceManager) NetworkGatewaysPerAccount(ctx context.Context) map[string][]NetworkGateway {
+	log.Println("Getting network gateways in all accounts")
+	resultMap := make(map[string][]NetworkGateway)
+	var resultMutext sync.Mutex
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		config := &aws.Config{Credentials: cred, Region: aws.String(region)}
+		gateways, err := getAWSNetworkGateways(ctx, account, ec2.New(sess, config), cloudwatch.New(sess, config))
+		if err != nil {
+			m.handleAWSError(account, region, err)
+		} else if len(gateways) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = append(resultMap[account], gateways...)
+			resultMutext.Unlock()
+		}
+	})
+	return resultMap
 }
 
-func (m *awsResourceManager) CleanupVolumes(volumes []Volume) error {
-	return cleanupVolumes(volumes)
+func (m *awsResourceManager) CapacitiesPerAccount(ctx context.Context) map[string][]Capacity {
+	log.Println("Getting capacities in all accounts")
+	resultMap := make(map[string][]Capacity)
+	var resultMutext sync.Mutex
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		config := &aws.Config{Credentials: cred, Region: aws.String(region)}
+		capacities, err := getAWSCapacities(ctx, account, ec2.New(sess, config))
+		if err != nil {
+			m.handleAWSError(account, region, err)
+		} else if len(capacities) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = append(resultMap[account], capacities...)
+			resultMutext.Unlock()
+		}
+	})
+	return resultMap
 }
 
-func (m *awsResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
-	return cleanupSnapshots(snapshots)
+func (m *awsResourceManager) DBInstancesPerAccount(ctx context.Context) map[string][]DBInstance {
+	log.Println("Getting database instances in all accounts")
+	resultMap := make(map[string][]DBInstance)
+	var resultMutext sync.Mutex
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		config := &aws.Config{Credentials: cred, Region: aws.String(region)}
+		instances, err := getAWSDBInstances(ctx, account, rds.New(sess, config), cloudwatch.New(sess, config))
+		if err != nil {
+			m.handleAWSError(account, region, err)
+		} else if len(instances) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = append(resultMap[account], instances...)
+			resultMutext.Unlock()
+		}
+	})
+	return resultMap
 }
 
-func (m *awsResourceManager) CleanupBuckets(buckets []Bucket) error {
-	return cleanupBuckets(buckets)
+func (m *awsResourceManager) DBSnapshotsPerAccount(ctx context.Context) map[string][]DBSnapshot {
+	log.Println("Getting database snapshots in all accounts")
+	resultMap := make(map[string][]DBSnapshot)
+	var resultMutext sync.Mutex
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		config := &aws.Config{Credentials: cred, Region: aws.String(region)}
+		snapshots, err := getAWSDBSnapshots(ctx, account, rds.New(sess, config))
+		if err != nil {
+			m.handleAWSError(account, region, err)
+		} else if len(snapshots) > 0 {
+			resultMutext.Lock()
+			resultMap[account] = append(resultMap[account], snapshots...)
+			resultMutext.Unlock()
+		}
+	})
+	return resultMap
+}
+
+// ReferencedImages looks up the AMI IDs stored in the specified SSM
+// parameters in every account and region. A path is either the name of
+// a single parameter or a hierarchy, which is searched recursively. If
+// launchTemplates is set, the AMIs used by the default and latest version
+// of every launch template are included as well.
+func (m *awsResourceManager) ReferencedImages(ctx context.Context, parameterPaths []string, launchTemplates bool) (map[string]bool, error) {
+	log.Println("Getting referenced images in all accounts")
+	result := make(map[string]bool)
+	var firstErr error
+	var resultMutext sync.Mutex
+	inaccessible := m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		config := &aws.Config{Credentials: cred, Region: aws.String(region)}
+		imageIDs, err := getAWSParameterImages(ctx, ssm.New(sess, config), parameterPaths)
+		if err == nil && launchTemplates {
+			var templateImageIDs []string
+			templateImageIDs, err = getAWSLaunchTemplateImages(ctx, ec2.New(sess, config))
+			imageIDs = append(imageIDs, templateImageIDs...)
+		}
+		resultMutext.Lock()
+		defer resultMutext.Unlock()
+		if err != nil {
+			log.Printf("Could not get referenced images in %s (%s): %s\n", AccountName(account), region, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("account %s (%s): %s", account, region, err)
+			}
+			return
+		}
+		for _, id := range imageIDs {
+			result[id] = true
+		}
+	})
+	if firstErr == nil && len(inaccessible) > 0 {
+		firstErr = fmt.Errorf("could not access account %s", inaccessible[0])
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return result, nil
+}
+
+// SnapshotDependencies builds the dependency graph of the snapshots in
+// every account and region, from the images whose block devices are backed
+// by a snapshot and the volumes created from one. Snapshots can be shared,
+// so the images and volumes of every account are included, not only those
+// of the account owning the snapshot.
+func (m *awsResourceManager) SnapshotDependencies(ctx context.Context) (*DependencyGraph, error) {
+	log.Println("Getting snapshot dependencies in all accounts")
+	graph := NewDependencyGraph()
+	var firstErr error
+	var resultMutext sync.Mutex
+	inaccessible := m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		client := ec2.New(sess, &aws.Config{Credentials: cred, Region: aws.String(region)})
+		images, err := getAWSImages(ctx, account, client)
+		var volumes []Volume
+		if err == nil {
+			volumes, err = getAWSVolumes(ctx, account, client)
+		}
+		resultMutext.Lock()
+		defer resultMutext.Unlock()
+		if err != nil {
+			log.Printf("Could not get snapshot dependencies in %s (%s): %s\n", AccountName(account), region, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("account %s (%s): %s", account, region, err)
+			}
+			return
+		}
+		dependents := []Resource{}
+		for _, image := range images {
+			dependents = append(dependents, image)
+		}
+		for _, volume := range volumes {
+			dependents = append(dependents, volume)
+		}
+		// The lineage of images and volumes holds the snapshots they were
+		// created from, next to e.g. the instances volumes are attached to
+		for _, dependent := range dependents {
+			for _, id := range dependent.Lineage() {
+				if strings.HasPrefix(id, awsSnapshotIDPrefix) {
+					graph.AddDependency(id, dependent)
+				}
+			}
+		}
+	})
+	if firstErr == nil && len(inaccessible) > 0 {
+		firstErr = fmt.Errorf("could not access account %s", inaccessible[0])
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return graph, nil
+}
+
+func (m *awsResourceManager) CleanupInstances(ctx context.Context, instances []Instance) error {
+	return cleanupInstances(ctx, instances)
+}
+
+func (m *awsResourceManager) CleanupImages(ctx context.Context, images []Image) error {
+	return cleanupImages(ctx, images)
+}
+
+func (m *awsResourceManager) CleanupVolumes(ctx context.Context, volumes []Volume) error {
+	return cleanupVolumes(ctx, volumes)
+}
+
+func (m *awsResourceManager) CleanupSnapshots(ctx context.Context, snapshots []Snapshot) error {
+	return cleanupSnapshots(ctx, snapshots)
+}
+
+func (m *awsResourceManager) CleanupBuckets(ctx context.Context, buckets []Bucket) error {
+	return cleanupBuckets(ctx, buckets)
+}
+
+func (m *awsResourceManager) CleanupTables(ctx context.Context, tables []Table) error {
+	return cleanupTables(ctx, tables)
+}
+
+func (m *awsResourceManager) CleanupCacheClusters(ctx context.Context, clusters []CacheCluster) error {
+	return cleanupCacheClusters(ctx, clusters)
+}
+
+func (m *awsResourceManager) CleanupNetworkGateways(ctx context.Context, gateways []NetworkGateway) error {
+	return cleanupNetworkGateways(ctx, gateways)
+}
+
+func (m *awsResourceManager) CleanupAddresses(ctx context.Context, addresses []Address) error {
+	return cleanupAddresses(ctx, addresses)
+}
+
+func (m *awsResourceManager) CleanupCapacities(ctx context.Context, capacities []Capacity) error {
+	return cleanupCapacities(ctx, capacities)
+}
+
+func (m *awsResourceManager) CleanupDBInstances(ctx context.Context, instances []DBInstance) error {
+	return cleanupDBInstances(ctx, instances)
+}
+
+func (m *awsResourceManager) CleanupDBSnapshots(ctx context.Context, snapshots []DBSnapshot) error {
+	return cleanupDBSnapshots(ctx, snapshots)
 }
 
 // getAWSInstances will get all running instances using an already
-// set-up client for a specific credential and region.
-func getAWSInstances(account string, client *ec2.EC2) ([]Instance, error) {
+// set-up client for a specific credential and region. The inbound traffic
+// of public instances is looked up in CloudWatch.
+func getAWSInstances(ctx context.Context, account string, client *ec2.EC2, cw *cloudwatch.CloudWatch) ([]Instance, error) {
 	// We're only interested in running instances
 	input := &ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{&ec2.Filter{
 			Name:   aws.String(instanceStateFilterName),
 			Values: aws.StringSlice([]string{instanceStateRunning})}},
 	}
-	awsReservations, err := client.DescribeInstances(input)
+	awsReservations, err := client.DescribeInstancesWithContext(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 	result := []Instance{}
 	for _, reservation := range awsReservations.Reservations {
 		for _, instance := range reservation.Instances {
+			securityGroups := []string{}
+			for _, group := range instance.SecurityGroups {
+				securityGroups = append(securityGroups, aws.StringValue(group.GroupName))
+			}
+			var lastInboundTraffic time.Time
+			if instance.PublicIpAddress != nil {
+				dimensions := []*cloudwatch.Dimension{&cloudwatch.Dimension{Name: aws.String("InstanceId"), Value: instance.InstanceId}}
+				lastInboundTraffic = lastAWSMetricActivity(ctx, cw, "AWS/EC2", dimensions, *instance.LaunchTime, "NetworkIn")
+			}
 			inst := awsInstance{baseInstance{
 				baseResource: baseResource{
 					csp:          AWS,
@@ -434,8 +783,13 @@ func getAWSInstances(account string, client *ec2.EC2) ([]Instance, error) {
 					location:     *client.Config.Region,
 					creationTime: *instance.LaunchTime,
 					public:       instance.PublicIpAddress != nil,
-					tags:         convertAWSTags(instance.Tags)},
-				instanceType: *instance.InstanceType,
+					tags:         convertAWSTags(instance.Tags),
+					lineage:      []string{aws.StringValue(instance.ImageId)}},
+				instanceType:       *instance.InstanceType,
+				running:            instance.State != nil && *instance.State.Name == instanceStateRunning,
+				keyName:            aws.StringValue(instance.KeyName),
+				securityGroups:     securityGroups,
+				lastInboundTraffic: lastInboundTraffic,
 			}}
 			result = append(result, &inst)
 		}
@@ -444,11 +798,11 @@ func getAWSInstances(account string, client *ec2.EC2) ([]Instance, error) {
 }
 
 // getAWSImages will get all AMIs owned by the current account
-func getAWSImages(account string, client *ec2.EC2) ([]Image, error) {
+func getAWSImages(ctx context.Context, account string, client *ec2.EC2) ([]Image, error) {
 	input := &ec2.DescribeImagesInput{
 		Owners: aws.StringSlice([]string{awsOwnerIDSelfValue}),
 	}
-	awsImages, err := client.DescribeImages(input)
+	awsImages, err := client.DescribeImagesWithContext(ctx, input)
 	if err != nil {
 		return nil, err
 	}
@@ -470,10 +824,16 @@ func getAWSImages(account string, client *ec2.EC2) ([]Image, error) {
 			},
 			name: *ami.Name,
 		}}
+		if ami.Description != nil {
+			img.baseImage.sourceImageID, img.baseImage.sourceRegion = parseAWSImageCopySource(*ami.Description)
+		}
 		for _, mapping := range ami.BlockDeviceMappings {
 			if mapping != nil && (*mapping).Ebs != nil && (*(*mapping).Ebs).VolumeSize != nil {
 				img.baseImage.sizeGB += *mapping.Ebs.VolumeSize
 			}
+			if mapping != nil && mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+				img.baseImage.lineage = append(img.baseImage.lineage, *mapping.Ebs.SnapshotId)
+			}
 		}
 		result = append(result, &img)
 	}
@@ -482,15 +842,21 @@ func getAWSImages(account string, client *ec2.EC2) ([]Image, error) {
 
 // getAWSVolumes will get all volumes (both attached and un-attached)
 // in the current account
-func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
+func getAWSVolumes(ctx context.Context, account string, client *ec2.EC2) ([]Volume, error) {
 	input := new(ec2.DescribeVolumesInput)
-	awsVolumes, err := client.DescribeVolumes(input)
+	awsVolumes, err := client.DescribeVolumesWithContext(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 	result := []Volume{}
 	for _, volume := range awsVolumes.Volumes {
 		inUse := len(volume.Attachments) > 0 || *volume.State == awsStateInUse
+		// Other volume types report their baseline IOPS, which is
+		// included in the price of their size
+		iops := int64(0)
+		if awsProvisionedIOPSVolumeTypes[*volume.VolumeType] {
+			iops = aws.Int64Value(volume.Iops)
+		}
 		vol := awsVolume{baseVolume{
 			baseResource: baseResource{
 				csp:          AWS,
@@ -500,11 +866,14 @@ func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
 				creationTime: *volume.CreateTime,
 				public:       false,
 				tags:         convertAWSTags(volume.Tags),
+				lineage:      awsVolumeLineage(volume),
 			},
-			sizeGB:     *volume.Size,
-			attached:   inUse,
-			encrypted:  *volume.Encrypted,
-			volumeType: *volume.VolumeType,
+			sizeGB:         *volume.Size,
+			attached:       inUse,
+			encrypted:      *volume.Encrypted,
+			volumeType:     *volume.VolumeType,
+			iops:           iops,
+			throughputMBps: aws.Int64Value(volume.Throughput),
 		}}
 		result = append(result, &vol)
 	}
@@ -513,16 +882,31 @@ func getAWSVolumes(account string, client *ec2.EC2) ([]Volume, error) {
 
 // getAWSSnapshots will get all snapshots in AWS owned
 // by the current account
-func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
+// awsVolumeLineage returns the instances a volume is attached to, and the
+// snapshot it was created from
+func awsVolumeLineage(volume *ec2.Volume) []string {
+	lineage := []string{}
+	for _, attachment := range volume.Attachments {
+		if attachment.InstanceId != nil {
+			lineage = append(lineage, *attachment.InstanceId)
+		}
+	}
+	if aws.StringValue(volume.SnapshotId) != "" {
+		lineage = append(lineage, *volume.SnapshotId)
+	}
+	return lineage
+}
+
+func getAWSSnapshots(ctx context.Context, account string, client *ec2.EC2) ([]Snapshot, error) {
 	input := &ec2.DescribeSnapshotsInput{
 		OwnerIds: aws.StringSlice([]string{awsOwnerIDSelfValue}),
 	}
-	awsSnapshots, err := client.DescribeSnapshots(input)
+	awsSnapshots, err := client.DescribeSnapshotsWithContext(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 	result := []Snapshot{}
-	snapshotsInUse := getSnapshotsInUse(client)
+	snapshotsInUse := getSnapshotsInUse(ctx, client)
 	for _, snapshot := range awsSnapshots.Snapshots {
 		_, inUse := snapshotsInUse[*snapshot.SnapshotId]
 		snap := awsSnapshot{baseSnapshot{
@@ -534,6 +918,7 @@ func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
 				creationTime: *snapshot.StartTime,
 				public:       false,
 				tags:         convertAWSTags(snapshot.Tags),
+				lineage:      []string{aws.StringValue(snapshot.VolumeId)},
 			},
 			sizeGB:    *snapshot.VolumeSize,
 			encrypted: *snapshot.Encrypted,
@@ -544,12 +929,12 @@ func getAWSSnapshots(account string, client *ec2.EC2) ([]Snapshot, error) {
 	return result, nil
 }
 
-func getSnapshotsInUse(client *ec2.EC2) map[string]struct{} {
+func getSnapshotsInUse(ctx context.Context, client *ec2.EC2) map[string]struct{} {
 	result := make(map[string]struct{})
 	input := &ec2.DescribeImagesInput{
 		Owners: aws.StringSlice([]string{awsOwnerIDSelfValue}),
 	}
-	images, err := client.DescribeImages(input)
+	images, err := client.DescribeImagesWithContext(ctx, input)
 	if err != nil {
 		log.Printf("Could not determine snapshots in use:\n%s\n", err)
 		return result
@@ -564,37 +949,557 @@ func getSnapshotsInUse(client *ec2.EC2) map[string]struct{} {
 	return result
 }
 
-func getAllEC2Resources(accounts []string, funcToRun func(client *ec2.EC2, account string)) {
-	sess := session.Must(session.NewSession())
-	forEachAccount(accounts, sess, func(account string, cred *credentials.Credentials) {
-		log.Println("Accessing account", account)
+// getAWSTables will get all DynamoDB tables using already set-up clients
+// for a specific credential and region. The last activity of a table is
+// found using its consumed capacity in CloudWatch.
+func getAWSTables(ctx context.Context, account string, client *dynamodb.DynamoDB, cw *cloudwatch.CloudWatch) ([]Table, error) {
+	tableNames := []*string{}
+	err := client.ListTablesPagesWithContext(ctx, &dynamodb.ListTablesInput{}, func(output *dynamodb.ListTablesOutput, lastPage bool) bool {
+		tableNames = append(tableNames, output.TableNames...)
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := []Table{}
+	for _, name := range tableNames {
+		desc, err := client.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{TableName: name})
+		if err != nil {
+			return nil, err
+		}
+		table := desc.Table
+		tags := make(map[string]string)
+		tagOutput, err := client.ListTagsOfResourceWithContext(ctx, &dynamodb.ListTagsOfResourceInput{ResourceArn: table.TableArn})
+		if err == nil {
+			for _, tag := range tagOutput.Tags {
+				tags[*tag.Key] = *tag.Value
+			}
+		}
+		dimensions := []*cloudwatch.Dimension{&cloudwatch.Dimension{Name: aws.String("TableName"), Value: name}}
+		lastActivity := lastAWSMetricActivity(ctx, cw, "AWS/DynamoDB", dimensions, *table.CreationDateTime,
+			"ConsumedReadCapacityUnits", "ConsumedWriteCapacityUnits")
+		result = append(result, &awsTable{
+			baseTable: baseTable{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           *name,
+					location:     *client.Config.Region,
+					creationTime: *table.CreationDateTime,
+					tags:         tags,
+				},
+				sizeGB:       float64(aws.Int64Value(table.TableSizeBytes)) / gbDivider,
+				itemCount:    aws.Int64Value(table.ItemCount),
+				lastActivity: lastActivity,
+			},
+			arn: *table.TableArn,
+		})
+	}
+	return result, nil
+}
+
+// getAWSParameterImages returns the AMI IDs stored in the specified SSM
+// parameters, using an already set-up client for a specific credential
+// and region. Parameters that are lists can hold several AMI IDs.
+func getAWSParameterImages(ctx context.Context, client *ssm.SSM, parameterPaths []string) ([]string, error) {
+	values := []string{}
+	for _, path := range parameterPaths {
+		if !strings.HasSuffix(path, "/") {
+			output, err := client.GetParameterWithContext(ctx, &ssm.GetParameterInput{Name: aws.String(path)})
+			if err == nil {
+				values = append(values, aws.StringValue(output.Parameter.Value))
+			} else if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ssm.ErrCodeParameterNotFound {
+				return nil, err
+			}
+		}
+		// Only hierarchies (starting with /) can be searched by path
+		if !strings.HasPrefix(path, "/") {
+			continue
+		}
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+		input := &ssm.GetParametersByPathInput{
+			Path:      aws.String(path),
+			Recursive: aws.Bool(true),
+		}
+		err := client.GetParametersByPathPagesWithContext(ctx, input, func(output *ssm.GetParametersByPathOutput, lastPage bool) bool {
+			for _, param := range output.Parameters {
+				values = append(values, aws.StringValue(param.Value))
+			}
+			return !lastPage
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	imageIDs := []string{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); strings.HasPrefix(part, awsImageIDPrefix) {
+				imageIDs = append(imageIDs, part)
+			}
+		}
+	}
+	return imageIDs, nil
+}
+
+// getAWSLaunchTemplateImages returns the AMI IDs used by the default and
+// latest version of all launch templates, using an already set-up client
+// for a specific credential and region.
+func getAWSLaunchTemplateImages(ctx context.Context, client *ec2.EC2) ([]string, error) {
+	templateIDs := []*string{}
+	err := client.DescribeLaunchTemplatesPagesWithContext(ctx, &ec2.DescribeLaunchTemplatesInput{}, func(output *ec2.DescribeLaunchTemplatesOutput, lastPage bool) bool {
+		for _, template := range output.LaunchTemplates {
+			templateIDs = append(templateIDs, template.LaunchTemplateId)
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	imageIDs := []string{}
+	for _, templateID := range templateIDs {
+		input := &ec2.DescribeLaunchTemplateVersionsInput{
+			LaunchTemplateId: templateID,
+			Versions:         aws.StringSlice([]string{"$Default", "$Latest"}),
+		}
+		output, err := client.DescribeLaunchTemplateVersionsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range output.LaunchTemplateVersions {
+			if version.LaunchTemplateData != nil && version.LaunchTemplateData.ImageId != nil {
+				imageIDs = append(imageIDs, *version.LaunchTemplateData.ImageId)
+			}
+		}
+	}
+	return imageIDs, nil
+}
+
+// getAWSCacheClusters will get all ElastiCache clusters using already
+// set-up clients for a specific credential and region. Clusters that are
+// members of a replication group are managed through the group, and are
+// not included. The last activity of a cluster is the last time a client
+// connected to it, according to CloudWatch.
+func getAWSCacheClusters(ctx context.Context, account string, client *elasticache.ElastiCache, cw *cloudwatch.CloudWatch) ([]CacheCluster, error) {
+	result := []CacheCluster{}
+	var tagErr error
+	err := client.DescribeCacheClustersPagesWithContext(ctx, &elasticache.DescribeCacheClustersInput{}, func(output *elasticache.DescribeCacheClustersOutput, lastPage bool) bool {
+		for _, cluster := range output.CacheClusters {
+			if cluster.ReplicationGroupId != nil || cluster.CacheClusterCreateTime == nil {
+				continue
+			}
+			tags := make(map[string]string)
+			tagOutput, err := client.ListTagsForResourceWithContext(ctx, &elasticache.ListTagsForResourceInput{ResourceName: cluster.ARN})
+			if err != nil {
+				tagErr = err
+				return false
+			}
+			for _, tag := range tagOutput.TagList {
+				tags[*tag.Key] = *tag.Value
+			}
+			dimensions := []*cloudwatch.Dimension{&cloudwatch.Dimension{Name: aws.String("CacheClusterId"), Value: cluster.CacheClusterId}}
+			lastActivity := lastAWSMetricActivity(ctx, cw, "AWS/ElastiCache", dimensions, *cluster.CacheClusterCreateTime, "NewConnections")
+			result = append(result, &awsCacheCluster{
+				baseCacheCluster: baseCacheCluster{
+					baseResource: baseResource{
+						csp:          AWS,
+						owner:        account,
+						id:           *cluster.CacheClusterId,
+						location:     *client.Config.Region,
+						creationTime: *cluster.CacheClusterCreateTime,
+						tags:         tags,
+					},
+					engine:       aws.StringValue(cluster.Engine),
+					nodeType:     aws.StringValue(cluster.CacheNodeType),
+					nodeCount:    aws.Int64Value(cluster.NumCacheNodes),
+					lastActivity: lastActivity,
+				},
+				arn: *cluster.ARN,
+			})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, tagErr
+}
+
+// getAWSNetworkGateways will get all NAT gateways and interface VPC
+// endpoints using already set-up clients for a specific credential and
+// region. Gateway VPC endpoints are free, and are not included. The last
+// activity of a gateway is the last time it sent any traffic, according
+// to CloudWatch.
+func getAWSNetworkGateways(ctx context.Context, account string, client *ec2.EC2, cw *cloudwatch.CloudWatch) ([]NetworkGateway, error) {
+	result := []NetworkGateway{}
+	err := client.DescribeNatGatewaysPagesWithContext(ctx, &ec2.DescribeNatGatewaysInput{}, func(output *ec2.DescribeNatGatewaysOutput, lastPage bool) bool {
+		for _, gateway := range output.NatGateways {
+			state := aws.StringValue(gateway.State)
+			if state == ec2.NatGatewayStateDeleting || state == ec2.NatGatewayStateDeleted || state == ec2.NatGatewayStateFailed || gateway.CreateTime == nil {
+				continue
+			}
+			dimensions := []*cloudwatch.Dimension{&cloudwatch.Dimension{Name: aws.String("NatGatewayId"), Value: gateway.NatGatewayId}}
+			lastActivity := lastAWSMetricActivity(ctx, cw, "AWS/NATGateway", dimensions, *gateway.CreateTime, "BytesOutToDestination", "BytesOutToSource")
+			result = append(result, &awsNetworkGateway{baseNetworkGateway{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           *gateway.NatGatewayId,
+					location:     *client.Config.Region,
+					creationTime: *gateway.CreateTime,
+					tags:         convertAWSTags(gateway.Tags),
+				},
+				gatewayType:  NATGatewayType,
+				network:      aws.StringValue(gateway.VpcId),
+				zones:        1,
+				lastActivity: lastActivity,
+			}})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	input := &ec2.DescribeVpcEndpointsInput{
+		Filters: []*ec2.Filter{&ec2.Filter{
+			Name:   aws.String("vpc-endpoint-type"),
+			Values: aws.StringSlice([]string{ec2.VpcEndpointTypeInterface}),
+		}},
+	}
+	err = client.DescribeVpcEndpointsPagesWithContext(ctx, input, func(output *ec2.DescribeVpcEndpointsOutput, lastPage bool) bool {
+		for _, endpoint := range output.VpcEndpoints {
+			state := strings.ToLower(aws.StringValue(endpoint.State))
+			if state == "deleting" || state == "deleted" || state == "failed" || endpoint.CreationTimestamp == nil {
+				continue
+			}
+			dimensions := []*cloudwatch.Dimension{
+				&cloudwatch.Dimension{Name: aws.String("Endpoint Type"), Value: aws.String(ec2.VpcEndpointTypeInterface)},
+				&cloudwatch.Dimension{Name: aws.String("Service Name"), Value: endpoint.ServiceName},
+				&cloudwatch.Dimension{Name: aws.String("VPC Endpoint Id"), Value: endpoint.VpcEndpointId},
+				&cloudwatch.Dimension{Name: aws.String("VPC Id"), Value: endpoint.VpcId},
+			}
+			lastActivity := lastAWSMetricActivity(ctx, cw, "AWS/PrivateLinkEndpoints", dimensions, *endpoint.CreationTimestamp, "BytesProcessed")
+			result = append(result, &awsNetworkGateway{baseNetworkGateway{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           *endpoint.VpcEndpointId,
+					location:     *client.Config.Region,
+					creationTime: *endpoint.CreationTimestamp,
+					tags:         convertAWSTags(endpoint.Tags),
+				},
+				gatewayType:  VPCEndpointType,
+				network:      aws.StringValue(endpoint.VpcId),
+				zones:        len(endpoint.SubnetIds),
+				lastActivity: lastActivity,
+			}})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getAWSAddresses gets all Elastic IP addresses in a VPC. An address is in
+// use if it's associated with an instance or a network interface.
+func getAWSAddresses(ctx context.Context, account string, client *ec2.EC2) ([]Address, error) {
+	output, err := client.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{})
+	if err != nil {
+		return nil, err
+	}
+	allocationIDs := []string{}
+	for _, addr := range output.Addresses {
+		if addr.AllocationId != nil {
+			allocationIDs = append(allocationIDs, *addr.AllocationId)
+		}
+	}
+	region := aws.StringValue(client.Config.Region)
+	firstSeen := awsAddressesFirstSeen(account, region, allocationIDs)
+	result := []Address{}
+	for _, addr := range output.Addresses {
+		if addr.AllocationId == nil {
+			continue
+		}
+		result = append(result, &awsAddress{baseAddress{
+			baseResource: baseResource{
+				csp:          AWS,
+				owner:        account,
+				id:           *addr.AllocationId,
+				location:     region,
+				creationTime: firstSeen[*addr.AllocationId],
+				public:       true,
+				tags:         convertAWSTags(addr.Tags),
+			},
+			ip:    aws.StringValue(addr.PublicIp),
+			inUse: addr.AssociationId != nil,
+		}})
+	}
+	return result, nil
+}
+
+// getAWSCapacities will get all dedicated hosts and active capacity
+// reservations using an already set-up client for a specific credential
+// and region. Dedicated hosts support a single instance type, or any
+// type in an instance family, in which case the number of instances they
+// can hold is unknown and reported as 0.
+func getAWSCapacities(ctx context.Context, account string, client *ec2.EC2) ([]Capacity, error) {
+	result := []Capacity{}
+	err := client.DescribeHostsPagesWithContext(ctx, &ec2.DescribeHostsInput{}, func(output *ec2.DescribeHostsOutput, lastPage bool) bool {
+		for _, host := range output.Hosts {
+			state := aws.StringValue(host.State)
+			if state == ec2.AllocationStateReleased || state == ec2.AllocationStateReleasedPermanentFailure || host.AllocationTime == nil {
+				continue
+			}
+			instanceType := ""
+			if host.HostProperties != nil {
+				instanceType = aws.StringValue(host.HostProperties.InstanceType)
+			}
+			total := 0
+			if host.AvailableCapacity != nil && instanceType != "" {
+				for _, capacity := range host.AvailableCapacity.AvailableInstanceCapacity {
+					if aws.StringValue(capacity.InstanceType) == instanceType {
+						total = int(aws.Int64Value(capacity.TotalCapacity))
+					}
+				}
+			}
+			result = append(result, &awsCapacity{baseCapacity{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           *host.HostId,
+					location:     *client.Config.Region,
+					creationTime: *host.AllocationTime,
+					tags:         convertAWSTags(host.Tags),
+				},
+				capacityType:   DedicatedHostType,
+				instanceType:   instanceType,
+				totalInstances: total,
+				usedInstances:  len(host.Instances),
+			}})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	input := &ec2.DescribeCapacityReservationsInput{
+		Filters: []*ec2.Filter{&ec2.Filter{
+			Name:   aws.String("state"),
+			Values: aws.StringSlice([]string{ec2.CapacityReservationStateActive}),
+		}},
+	}
+	err = client.DescribeCapacityReservationsPagesWithContext(ctx, input, func(output *ec2.DescribeCapacityReservationsOutput, lastPage bool) bool {
+		for _, reservation := range output.CapacityReservations {
+			if reservation.CreateDate == nil {
+				continue
+			}
+			total := int(aws.Int64Value(reservation.TotalInstanceCount))
+			result = append(result, &awsCapacity{baseCapacity{
+				baseResource: baseResource{
+					csp:          AWS,
+					owner:        account,
+					id:           *reservation.CapacityReservationId,
+					location:     *client.Config.Region,
+					creationTime: *reservation.CreateDate,
+					tags:         convertAWSTags(reservation.Tags),
+				},
+				capacityType:   CapacityReservationType,
+				instanceType:   aws.StringValue(reservation.InstanceType),
+				totalInstances: total,
+				usedInstances:  total - int(aws.Int64Value(reservation.AvailableInstanceCount)),
+			}})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getAWSDBInstances will get all RDS instances using already set-up
+// clients for a specific credential and region. Instances that are
+// members of an Aurora cluster are managed through the cluster, and are
+// not included. The last activity of an instance is the last time a
+// client was connected to it, according to CloudWatch.
+func getAWSDBInstances(ctx context.Context, account string, client *rds.RDS, cw *cloudwatch.CloudWatch) ([]DBInstance, error) {
+	result := []DBInstance{}
+	err := client.DescribeDBInstancesPagesWithContext(ctx, &rds.DescribeDBInstancesInput{}, func(output *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+		for _, instance := range output.DBInstances {
+			status := aws.StringValue(instance.DBInstanceStatus)
+			if instance.DBClusterIdentifier != nil || instance.InstanceCreateTime == nil || status == "deleting" {
+				continue
+			}
+			dimensions := []*cloudwatch.Dimension{&cloudwatch.Dimension{Name: aws.String("DBInstanceIdentifier"), Value: instance.DBInstanceIdentifier}}
+			lastActivity := lastAWSMetricActivity(ctx, cw, "AWS/RDS", dimensions, *instance.InstanceCreateTime, "DatabaseConnections")
+			result = append(result, &awsDBInstance{
+				baseDBInstance: baseDBInstance{
+					baseResource: baseResource{
+						csp:          AWS,
+						owner:        account,
+						id:           *instance.DBInstanceIdentifier,
+						location:     *client.Config.Region,
+						public:       aws.BoolValue(instance.PubliclyAccessible),
+						creationTime: *instance.InstanceCreateTime,
+						tags:         convertAWSRDSTags(instance.TagList),
+					},
+					engine:        aws.StringValue(instance.Engine),
+					instanceClass: aws.StringValue(instance.DBInstanceClass),
+					storageGB:     aws.Int64Value(instance.AllocatedStorage),
+					multiAZ:       aws.BoolValue(instance.MultiAZ),
+					stopped:       status == "stopped" || status == "stopping",
+					lastActivity:  lastActivity,
+				},
+				arn: aws.StringValue(instance.DBInstanceArn),
+			})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// getAWSDBSnapshots will get all manual RDS snapshots using an already
+// set-up client for a specific credential and region. Automated snapshots
+// are deleted by RDS along with their instance, and are not included.
+func getAWSDBSnapshots(ctx context.Context, account string, client *rds.RDS) ([]DBSnapshot, error) {
+	result := []DBSnapshot{}
+	input := &rds.DescribeDBSnapshotsInput{
+		SnapshotType: aws.String("manual"),
+	}
+	err := client.DescribeDBSnapshotsPagesWithContext(ctx, input, func(output *rds.DescribeDBSnapshotsOutput, lastPage bool) bool {
+		for _, snapshot := range output.DBSnapshots {
+			if snapshot.SnapshotCreateTime == nil {
+				continue
+			}
+			result = append(result, &awsDBSnapshot{
+				baseDBSnapshot: baseDBSnapshot{
+					baseResource: baseResource{
+						csp:          AWS,
+						owner:        account,
+						id:           *snapshot.DBSnapshotIdentifier,
+						location:     *client.Config.Region,
+						creationTime: *snapshot.SnapshotCreateTime,
+						tags:         convertAWSRDSTags(snapshot.TagList),
+						lineage:      []string{aws.StringValue(snapshot.DBInstanceIdentifier)},
+					},
+					engine:       aws.StringValue(snapshot.Engine),
+					dbInstanceID: aws.StringValue(snapshot.DBInstanceIdentifier),
+					storageGB:    aws.Int64Value(snapshot.AllocatedStorage),
+				},
+				arn: aws.StringValue(snapshot.DBSnapshotArn),
+			})
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// lastAWSMetricActivity returns the last day any of the specified metrics
+// had a non-zero sum in CloudWatch. Only the last awsActivityLookbackDays
+// are looked at, so if no activity is found the resource is considered
+// idle since it was created. If any metric could not be read, the last
+// activity is unknown and the resource is assumed to be in use, like a
+// bucket whose objects could not all be listed.
+func lastAWSMetricActivity(ctx context.Context, cw *cloudwatch.CloudWatch, namespace string, dimensions []*cloudwatch.Dimension, created time.Time, metricNames ...string) time.Time {
+	lookbackStart := time.Now().AddDate(0, 0, -awsActivityLookbackDays)
+	var lastActivity time.Time
+	for _, metricName := range metricNames {
+		metrics, err := cw.GetMetricStatisticsWithContext(ctx, &cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String(namespace),
+			MetricName: aws.String(metricName),
+			Dimensions: dimensions,
+			StartTime:  aws.Time(lookbackStart),
+			EndTime:    aws.Time(time.Now()),
+			Period:     aws.Int64(24 * 60 * 60),
+			Statistics: []*string{aws.String(cloudwatch.StatisticSum)},
+		})
+		if err != nil {
+			log.Printf("Could not get %s metrics for %s: %s\n", metricName, aws.StringValue(dimensions[0].Value), err)
+			return clock.Now()
+		}
+		for _, datapoint := range metrics.Datapoints {
+			if aws.Float64Value(datapoint.Sum) > 0 && datapoint.Timestamp.After(lastActivity) {
+				lastActivity = *datapoint.Timestamp
+			}
+		}
+	}
+	if lastActivity.IsZero() {
+		return created
+	}
+	return lastActivity
+}
+
+func (m *awsResourceManager) getAllEC2Resources(ctx context.Context, funcToRun func(client *ec2.EC2, account string)) {
+	m.forEachAWSAccountRegion(ctx, func(sess *session.Session, cred *credentials.Credentials, account, region string) {
+		client := ec2.New(sess, &aws.Config{
+			Credentials: cred,
+			Region:      aws.String(region),
+		})
+		funcToRun(client, account)
+	})
+}
+
+// forEachAWSAccountRegion is a higher order function that will, for
+// every account and every region enabled in that account, call the
+// specified function with credentials for the account. The accounts
+// that couldn't be accessed at all are returned, and recorded in the
+// ScanStatus. Once ctx is done, the remaining regions are skipped and
+// recorded as failed in the ScanStatus.
+func (m *awsResourceManager) forEachAWSAccountRegion(ctx context.Context, funcToRun func(sess *session.Session, cred *credentials.Credentials, account, region string)) (inaccessible []string) {
+	sess := NewAWSSession()
+	var inaccessibleMutex sync.Mutex
+	forEachAccount(m.accounts, sess, func(account string, cred *credentials.Credentials) {
+		log.Println("Accessing account", AccountName(account))
+		var accessErr error
+		var accessMutex sync.Mutex
 		forEachAWSRegion(func(region string) {
+			if ctx.Err() != nil {
+				m.status.fail(account, region, ctx.Err())
+				return
+			}
 			// Check if region is enabled by making a call that we should always have permissions for
 			stsClient := sts.New(sess, &aws.Config{
 				Credentials: cred,
 				Region:      aws.String(region),
 			})
-			_, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+			_, err := stsClient.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
 			if err != nil {
 				// Ensure that we can make the default call, otherwise we have other problems
 				stsClient = sts.New(sess, &aws.Config{
 					Credentials: cred,
 				})
-				_, err = stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+				_, err = stsClient.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
 				if err == nil {
 					log.Printf("Region %s is disabled, skipping it!", region)
-					return
 				} else {
-					log.Fatalf("Unknown AWS error %s", err)
+					accessMutex.Lock()
+					accessErr = err
+					accessMutex.Unlock()
 				}
+				return
 			}
-			client := ec2.New(sess, &aws.Config{
-				Credentials: cred,
-				Region:      aws.String(region),
-			})
-			funcToRun(client, account)
+			funcToRun(sess, cred, account, region)
 		})
+		if accessErr != nil {
+			m.status.fail(account, GlobalScan, accessErr)
+			inaccessibleMutex.Lock()
+			inaccessible = append(inaccessible, account)
+			inaccessibleMutex.Unlock()
+		}
 	})
+	return inaccessible
 }
 
 // forEachAccount is a higher order function that will, for
@@ -605,7 +1510,7 @@ func forEachAccount(accounts []string, sess *session.Session, funcToRun func(acc
 	for i := range accounts {
 		wg.Add(1)
 		go func(x int) {
-			creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, accounts[x]))
+			creds := AWSCredentials(sess, accounts[x])
 			funcToRun(accounts[x], creds)
 			wg.Done()
 		}(i)
@@ -614,7 +1519,9 @@ func forEachAccount(accounts []string, sess *session.Session, funcToRun func(acc
 }
 
 // forEachAWSRegion is a higher order function that will, for
-// every available AWS region, run the specified function
+// every available AWS region, run the specified function. At most
+// AWSMaxConcurrentRequests regions are run at the same time, shared
+// with all other accounts.
 func forEachAWSRegion(funcToRun func(region string)) {
 	regions, exists := endpoints.RegionsForService(endpoints.DefaultPartitions(), endpoints.AwsPartitionID, endpoints.Ec2ServiceID)
 	if !exists {
@@ -624,30 +1531,31 @@ func forEachAWSRegion(funcToRun func(region string)) {
 	for regionID := range regions {
 		wg.Add(1)
 		go func(x string) {
+			acquireAWSWorker()
 			funcToRun(x)
+			releaseAWSWorker()
 			wg.Done()
 		}(regionID)
 	}
 	wg.Wait()
 }
 
-func handleAWSAccessDenied(account string, err error) {
+// handleAWSError logs an error listing resources in a region of an
+// account, and records the region as failed unless the resource was
+// simply not found
+func (m *awsResourceManager) handleAWSError(account, region string, err error) {
 	// Cast err to awserr.Error to handle specific AWS errors
 	aerr, ok := err.(awserr.Error)
-	if ok && aerr.Code() == accessDeniedErrorCode {
+	if ok && (aerr.Code() == accessDeniedErrorCode || aerr.Code() == accessDeniedExceptionErrorCode) {
 		// The account does not have the role setup correctly
-		log.Printf("The account '%s' denied access\n", account)
+		log.Printf("The account '%s' denied access\n", AccountName(account))
 	} else if ok && aerr.Code() == unauthorizedErrorCode {
-		log.Printf("Unauthorized to assume '%s'\n", account)
+		log.Printf("Unauthorized to assume '%s'\n", AccountName(account))
 	} else if ok && aerr.Code() == notFoundErrorOcde {
-		log.Printf("Resource was not found in account %s", account)
-	} else if ok {
-		// Some other AWS error occured
-		log.Fatalf("Got AWS error in account %s: %s", account, aerr)
-	} else {
-		//Some other non-AWS error occured
-		log.Fatalf("Got error in account %s: %s", account, err)
+		log.Printf("Resource was not found in account %s", AccountName(account))
+		return
 	}
+	m.status.fail(account, region, err)
 }
 
 func convertAWSTags(tags []*ec2.Tag) map[string]string {
@@ -666,9 +1574,26 @@ func convertAWSS3Tags(tags []*s3.Tag) map[string]string {
 	return result
 }
 
+func convertAWSRDSTags(tags []*rds.Tag) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range tags {
+		result[*tag.Key] = *tag.Value
+	}
+	return result
+}
+
+// cloudWatchForAWSClient returns a CloudWatch client with the same
+// credentials and region as an EC2 client
+func cloudWatchForAWSClient(client *ec2.EC2) *cloudwatch.CloudWatch {
+	return cloudwatch.New(NewAWSSession(), &aws.Config{
+		Credentials: client.Config.Credentials,
+		Region:      client.Config.Region,
+	})
+}
+
 func clientForAWSResource(res Resource) *ec2.EC2 {
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, res.Owner()))
+	sess := NewAWSSession()
+	creds := AWSCredentials(sess, res.Owner())
 	return ec2.New(sess, &aws.Config{
 		Credentials: creds,
 		Region:      aws.String(res.Location()),
@@ -709,14 +1634,28 @@ func removeAWSTag(r Resource, key string) error {
 	return err
 }
 
+// isAWSThrottleError checks if a request failed because it was throttled,
+// such as with RequestLimitExceeded in EC2 or ThrottlingException
+func isAWSThrottleError(err error) bool {
+	return err == errAWSRequestLimit || request.IsErrorThrottle(err)
+}
+
+// awsTryWithBackoff calls f until it succeeds or fails with an error other
+// than throttling, at most awsMaxRequestRetries times. Throttled attempts
+// are counted, see Throttling.
 func awsTryWithBackoff(f func() error) error {
 	try := 1
 	var err error
 	for {
 		err = f()
-		if err == nil || err != errAWSRequestLimit || try > awsMaxRequestRetries {
+		if err == nil || !isAWSThrottleError(err) {
+			break
+		}
+		if try > awsMaxRequestRetries {
+			recordThrottle(true)
 			break
 		}
+		recordThrottle(false)
 		// Stupid but simple backoff (2^try seconds): 2, 4, 8, 16, 32 etc... seconds
 		time.Sleep(time.Duration(math.Exp2(float64(try))) * time.Second)
 		try++
@@ -0,0 +1,50 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build noaws
+// +build noaws
+
+package cloud
+
+import (
+	"context"
+	"errors"
+)
+
+// errAWSDisabled is returned by functions that need AWS, when Cloudsweeper
+// is built without AWS support
+var errAWSDisabled = errors.New("Cloudsweeper is built without support for AWS")
+
+// LookupAWSCreator is not supported without AWS
+func LookupAWSCreator(res Resource) (string, error) {
+	return "", errAWSDisabled
+}
+
+func resolveAWSSecret(id string) (string, error) {
+	return "", errAWSDisabled
+}
+
+func checkAWSAccess(account string) error {
+	return errAWSDisabled
+}
+
+func awsCallerIdentity() (string, error) {
+	return "", errAWSDisabled
+}
+
+func fetchAWSAccountAlias(account string) (string, error) {
+	return "", errAWSDisabled
+}
+
+func discoverAWSAccounts(ctx context.Context, managementAccount, ownerKey string) ([]*DiscoveredAccount, error) {
+	return nil, errAWSDisabled
+}
+
+// NewSSMAutomationDelegate is not supported without AWS
+func NewSSMAutomationDelegate(document, region string) (CleanupDelegate, error) {
+	return nil, errAWSDisabled
+}
+
+func putAWSObject(bucket, region, key, contentType string, data []byte) error {
+	return errAWSDisabled
+}
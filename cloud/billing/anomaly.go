@@ -0,0 +1,105 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package billing
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+// CostAnomaly is an account/project whose cost on a day jumped compared
+// to the day before
+type CostAnomaly struct {
+	Owner string
+	// Day is the day of the jump, on the form YYYY-MM-DD
+	Day          string
+	PreviousCost float64
+	Cost         float64
+}
+
+// Increase returns how much the cost increased
+func (a CostAnomaly) Increase() float64 {
+	return a.Cost - a.PreviousCost
+}
+
+// IncreasePercent returns how much the cost increased in percent of the
+// cost of the day before, which is infinite if there was no cost
+func (a CostAnomaly) IncreasePercent() float64 {
+	if a.PreviousCost <= 0 {
+		return math.Inf(1)
+	}
+	return 100.0 * a.Increase() / a.PreviousCost
+}
+
+// DailyCostPerOwner returns the total cost of every day, by the
+// account/project and then the day on the form YYYY-MM-DD. Items without
+// a day are left out.
+func (r *Report) DailyCostPerOwner() map[string]map[string]float64 {
+	result := make(map[string]map[string]float64)
+	for _, item := range r.Items {
+		if item.Day == "" {
+			continue
+		}
+		if _, ok := result[item.Owner]; !ok {
+			result[item.Owner] = make(map[string]float64)
+		}
+		result[item.Owner][item.Day] += item.Cost
+	}
+	return result
+}
+
+// DetectCostAnomalies compares the cost of every account/project
+// yesterday with the day before, and returns those whose cost increased
+// by at least minIncrease dollars and at least minIncreasePercent
+// percent, the largest increase first. A threshold of 0 is disabled.
+// Yesterday is used since the billing data of today is incomplete.
+func DetectCostAnomalies(reporter Reporter, minIncreasePercent, minIncrease float64) []CostAnomaly {
+	now := clock.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+	previous := day.AddDate(0, 0, -1)
+	costs := make(map[string]map[string]float64)
+	months := []time.Time{time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.Local)}
+	if previous.Month() != day.Month() {
+		months = append(months, time.Date(previous.Year(), previous.Month(), 1, 0, 0, 0, 0, time.Local))
+	}
+	for _, start := range months {
+		report := reporter.GenerateReport(start)
+		for owner, days := range report.DailyCostPerOwner() {
+			if _, ok := costs[owner]; !ok {
+				costs[owner] = make(map[string]float64)
+			}
+			for d, cost := range days {
+				costs[owner][d] += cost
+			}
+		}
+	}
+	return detectCostAnomalies(costs, day.Format(dateFormatLayout), previous.Format(dateFormatLayout), minIncreasePercent, minIncrease)
+}
+
+func detectCostAnomalies(costs map[string]map[string]float64, day, previous string, minIncreasePercent, minIncrease float64) []CostAnomaly {
+	anomalies := []CostAnomaly{}
+	for owner, days := range costs {
+		anomaly := CostAnomaly{Owner: owner, Day: day, PreviousCost: days[previous], Cost: days[day]}
+		if anomaly.Increase() <= 0 {
+			continue
+		}
+		if minIncrease > 0 && anomaly.Increase() < minIncrease {
+			continue
+		}
+		if minIncreasePercent > 0 && anomaly.IncreasePercent() < minIncreasePercent {
+			continue
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].Increase() != anomalies[j].Increase() {
+			return anomalies[i].Increase() > anomalies[j].Increase()
+		}
+		return anomalies[i].Owner < anomalies[j].Owner
+	})
+	return anomalies
+}
@@ -1,6 +1,9 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+//go:build !noaws
+// +build !noaws
+
 package billing
 
 import (
@@ -19,7 +22,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/cloudtools/cloudsweeper/cloud"
 
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
@@ -38,6 +40,23 @@ type awsReporter struct {
 	sortByTag           string
 }
 
+// NewReporterAWS will initialize a new Reporter for the AWS cloud. This
+// requires specifying the account which holds the billing information,
+// the bucket where the billing CSVs can be found as well as which region
+// this bucket is in. None of these arguments must be empty.
+func NewReporterAWS(billingAccount, bucket, bucketRegion, sortTag string) Reporter {
+	if billingAccount == "" || bucket == "" || bucketRegion == "" {
+		panic("Invalid arguments, must not be empty (\"\")")
+	}
+	return &awsReporter{
+		csp:                 cloud.AWS,
+		billingAccount:      billingAccount,
+		billingBucket:       bucket,
+		billingBucketRegion: bucketRegion,
+		sortByTag:           sortTag,
+	}
+}
+
 func (r *awsReporter) GenerateReport(start time.Time) Report {
 	report := Report{}
 	report.CSP = r.csp
@@ -61,6 +80,20 @@ func (r *awsReporter) GenerateReport(start time.Time) Report {
 	return report
 }
 
+// CheckAccess checks that the objects in the billing bucket can be listed
+func (r *awsReporter) CheckAccess() error {
+	sess := cloud.NewAWSSession()
+	client := s3.New(sess, &aws.Config{Region: aws.String(r.billingBucketRegion)})
+	_, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:  aws.String(r.billingBucket),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not list billing bucket %s: %s", r.billingBucket, err)
+	}
+	return nil
+}
+
 func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, allowFailed bool) error {
 	csvHeaders := make(map[string]int)
 	line := 0
@@ -101,6 +134,9 @@ func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, allowFa
 			}
 		}
 		reportItem.Cost = costNumber
+		if idx, exist := csvHeaders["UsageStartDate"]; exist && len(record[idx]) >= len(awsCSVDateFormat) {
+			reportItem.Day = record[idx][:len(awsCSVDateFormat)]
+		}
 		if r.sortByTag != "" {
 			if idx, exist := csvHeaders[fmt.Sprintf("user:%s", r.sortByTag)]; exist {
 				reportItem.sortTagValue = record[idx]
@@ -115,6 +151,52 @@ func (r *awsReporter) processAwsCsv(report *Report, csvFile *csv.Reader, allowFa
 	}
 }
 
+// ResourceTags reads the detailed billing report with resources and tags
+// of the month of start, and returns the latest non-empty values of the
+// specified tags of each resource in it, by resource ID. IDs in the form
+// of ARNs, such as for snapshots, are shortened to the ID itself.
+func (r *awsReporter) ResourceTags(start time.Time, keys ...string) (map[string]map[string]string, error) {
+	name := fmt.Sprintf(awsCSVNameFormatWithTags, r.billingAccount, start.Year(), start.Month())
+	csvFile, err := r.getCSVFromS3(name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get %s: %s", name, err)
+	}
+	result := make(map[string]map[string]string)
+	csvHeaders := make(map[string]int)
+	for line := 0; ; line++ {
+		record, err := csvFile.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			log.Printf("Failed reading line %d, continuing...\n%s", line, err)
+			continue
+		}
+		if line == 0 {
+			csvHeaders = updateCsvHeaders(record)
+			if _, exist := csvHeaders["ResourceId"]; !exist {
+				return nil, fmt.Errorf("%s has no resource IDs", name)
+			}
+			continue
+		}
+		id := record[csvHeaders["ResourceId"]]
+		if id == "" {
+			continue
+		}
+		id = id[strings.LastIndex(id, "/")+1:]
+		for _, key := range keys {
+			idx, exist := csvHeaders[fmt.Sprintf("user:%s", key)]
+			if !exist || record[idx] == "" {
+				continue
+			}
+			if _, ok := result[id]; !ok {
+				result[id] = make(map[string]string)
+			}
+			result[id][key] = record[idx]
+		}
+	}
+}
+
 func (r *awsReporter) getCSVFromS3(name string) (*csv.Reader, error) {
 	tmpZip := filepath.Join(os.TempDir(), name)
 	f, err := os.Create(tmpZip)
@@ -122,7 +204,7 @@ func (r *awsReporter) getCSVFromS3(name string) (*csv.Reader, error) {
 		log.Println("Could not create file in temp directory")
 		return nil, err
 	}
-	sess := session.Must(session.NewSession())
+	sess := cloud.NewAWSSession()
 	sess.Config.Region = aws.String(r.billingBucketRegion)
 	downloader := s3manager.NewDownloader(sess)
 	input := &s3.GetObjectInput{
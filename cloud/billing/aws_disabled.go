@@ -0,0 +1,38 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build noaws
+// +build noaws
+
+package billing
+
+import (
+	"errors"
+	"log"
+)
+
+// NewReporterAWS is not available when Cloudsweeper is built without
+// AWS support
+func NewReporterAWS(billingAccount, bucket, bucketRegion, sortTag string) Reporter {
+	log.Fatalln("Cloudsweeper is built without support for AWS")
+	return nil
+}
+
+// NewReporterCostExplorer is not available when Cloudsweeper is built
+// without AWS support
+func NewReporterCostExplorer(billingAccount, sortTag string) Reporter {
+	log.Fatalln("Cloudsweeper is built without support for AWS")
+	return nil
+}
+
+// CheckPricingAPI is not available when Cloudsweeper is built without
+// AWS support
+func CheckPricingAPI(owner string) error {
+	return errors.New("Cloudsweeper is built without support for AWS")
+}
+
+// fetchAWSInstancePrice is never called without AWS support, since there
+// are no AWS instances
+func fetchAWSInstancePrice(owner string, key instanceKeyPair) float64 {
+	return 0.0
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package billing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// bigQueryCostQuery sums the cost of every project, SKU and day in the
+// standard billing export table between @start and @end. Credits, such as
+// sustained use discounts, are negative and included in the cost. Costs
+// that don't belong to a project, such as support, have an empty project.
+const bigQueryCostQuery = "SELECT IFNULL(project.id, '') AS project, sku.description AS description, " +
+	"FORMAT_TIMESTAMP('%%Y-%%m-%%d', usage_start_time) AS day, " +
+	"SUM(cost) + SUM(IFNULL((SELECT SUM(credit.amount) FROM UNNEST(credits) AS credit), 0)) AS cost " +
+	"FROM `%s.%s.%s` " +
+	"WHERE usage_start_time >= @start AND usage_start_time < @end " +
+	"GROUP BY project, description, day"
+
+type bigQueryReporter struct {
+	csp     cloud.CSP
+	project string
+	dataset string
+	table   string
+}
+
+// bigQueryCostRow is a row of the result of bigQueryCostQuery
+type bigQueryCostRow struct {
+	Project     string  `bigquery:"project"`
+	Description string  `bigquery:"description"`
+	Day         string  `bigquery:"day"`
+	Cost        float64 `bigquery:"cost"`
+}
+
+// NewReporterBigQuery initializes and returns a new Reporter for the GCP
+// cloud, reading the standard billing export to BigQuery. This requires
+// specifying the project, dataset and table of the export, e.g. the table
+// gcp_billing_export_v1_<BILLING ACCOUNT ID>. The query is run in the
+// project of the export. None of these arguments must be empty.
+func NewReporterBigQuery(project, dataset, table string) Reporter {
+	if project == "" || dataset == "" || table == "" {
+		panic("Invalid arguments, must not be empty (\"\")")
+	}
+	return &bigQueryReporter{
+		csp:     cloud.GCP,
+		project: project,
+		dataset: dataset,
+		table:   table,
+	}
+}
+
+func (r *bigQueryReporter) GenerateReport(start time.Time) Report {
+	report := Report{}
+	report.CSP = r.csp
+
+	ctx := context.Background()
+	client, err := r.client(ctx)
+	if err != nil {
+		log.Println(err)
+		return report
+	}
+	defer client.Close()
+
+	query := client.Query(fmt.Sprintf(bigQueryCostQuery, r.project, r.dataset, r.table))
+	query.Parameters = []bigquery.QueryParameter{
+		{Name: "start", Value: start},
+		{Name: "end", Value: start.AddDate(0, 1, 0)},
+	}
+	log.Printf("Querying %s.%s.%s\n", r.project, r.dataset, r.table)
+	rows, err := query.Read(ctx)
+	if err != nil {
+		log.Printf("Could not query billing export %s.%s.%s:\n%s\n", r.project, r.dataset, r.table, err)
+		return report
+	}
+	for {
+		var row bigQueryCostRow
+		err := rows.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Println("Failed reading billing export, skipping the rest:", err)
+			break
+		}
+		report.Items = append(report.Items, ReportItem{
+			Owner:       row.Project,
+			Description: row.Description,
+			Cost:        row.Cost,
+			Day:         row.Day,
+		})
+	}
+	return report
+}
+
+// CheckAccess checks that the metadata of the billing export table can be
+// read
+func (r *bigQueryReporter) CheckAccess() error {
+	ctx := context.Background()
+	client, err := r.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if _, err := client.Dataset(r.dataset).Table(r.table).Metadata(ctx); err != nil {
+		return fmt.Errorf("Could not read billing export %s.%s.%s: %s", r.project, r.dataset, r.table, err)
+	}
+	return nil
+}
+
+func (r *bigQueryReporter) client(ctx context.Context) (*bigquery.Client, error) {
+	opts := []option.ClientOption{}
+	if credsFilePath, exist := os.LookupEnv(cloud.GcpCredentialsFileKey); exist {
+		opts = append(opts, option.WithServiceAccountFile(credsFilePath))
+	}
+	client, err := bigquery.NewClient(ctx, r.project, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize BigQuery service: %s", err)
+	}
+	return client, nil
+}
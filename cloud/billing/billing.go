@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 )
 
 const (
@@ -24,9 +25,12 @@ const (
 // the cost for a specific service for a certain user in a certain
 // account/project.
 type ReportItem struct {
-	Owner        string
-	Description  string
-	Cost         float64
+	Owner       string
+	Description string
+	Cost        float64
+	// Day is the date the cost was incurred on, on the form YYYY-MM-DD,
+	// or empty if the billing data has no dates
+	Day          string
 	sortTagValue string
 }
 
@@ -64,37 +68,17 @@ type Reporter interface {
 	GenerateReport(start time.Time) Report
 }
 
-// NewReporterAWS will initialize a new Reporter for the AWS cloud. This
-// requires specifying the account which holds the billing information,
-// the bucket where the billing CSVs can be found as well as which region
-// this bucket is in. None of these arguments must be empty.
-func NewReporterAWS(billingAccount, bucket, bucketRegion, sortTag string) Reporter {
-	if billingAccount == "" || bucket == "" || bucketRegion == "" {
-		panic("Invalid arguments, must not be empty (\"\")")
-	}
-	return &awsReporter{
-		csp:                 cloud.AWS,
-		billingAccount:      billingAccount,
-		billingBucket:       bucket,
-		billingBucketRegion: bucketRegion,
-		sortByTag:           sortTag,
-	}
+// TagSource is implemented by reporters that can find the tags resources
+// had in the billing data, such as the AWS detailed billing report with
+// resources and tags. The GCP billing export has no resource IDs.
+type TagSource interface {
+	ResourceTags(start time.Time, keys ...string) (map[string]map[string]string, error)
 }
 
-// NewReporterGCP initializes and returns a new Reporter for the GCP cloud.
-// This requires specifying a bucket where the billing CSVs can be found, as
-// well as the prefix of these CSV files. The prefix will be prepended to
-// the date and .csv suffix (e.g. <YOUR PREFIX>-2018-10-09.csv). None of
-// these argument must be empty.
-func NewReporterGCP(bucket, csvPrefix string) Reporter {
-	if bucket == "" || csvPrefix == "" {
-		panic("Invalid argument, must not be empty")
-	}
-	return &gcpReporter{
-		csp:           cloud.GCP,
-		bucket:        bucket,
-		csvNamePrefix: csvPrefix,
-	}
+// AccessChecker is implemented by reporters that can check that their
+// billing data can be read, without reading it
+type AccessChecker interface {
+	CheckAccess() error
 }
 
 // Report contains a collection of items, and some metadata
@@ -201,6 +185,42 @@ func (r *Report) SortedTagsByTotalCost() UserList {
 	return tagList
 }
 
+// SortedGroupsByTotalCost returns a list of groups, such as departments,
+// sorted by their total cost. A cost is attributed to the group of its
+// account in accountToGroup. Costs in accounts without a group are instead
+// attributed to the group of their sort tag value in tagToGroup, and costs
+// that can't be attributed at all are grouped under the name "".
+func (r *Report) SortedGroupsByTotalCost(accountToGroup, tagToGroup map[string]string) UserList {
+	type tempGroup struct {
+		name          string
+		totalCost     float64
+		detailedCosts map[string]float64
+	}
+	groupMap := make(map[string]*tempGroup)
+	for _, item := range r.Items {
+		groupName, exist := accountToGroup[item.Owner]
+		if !exist && item.sortTagValue != "" {
+			groupName = tagToGroup[item.sortTagValue]
+		}
+		group, ok := groupMap[groupName]
+		if !ok {
+			group = &tempGroup{groupName, 0.0, make(map[string]float64)}
+			groupMap[groupName] = group
+		}
+		group.totalCost += item.Cost
+		group.detailedCosts[item.Description] += item.Cost
+	}
+
+	groupList := make(UserList, 0, len(groupMap))
+	for _, group := range groupMap {
+		detailedCostList := convertCostMapToSortedList(group.detailedCosts)
+		groupList = append(groupList, User{group.name, group.totalCost, detailedCostList})
+	}
+
+	sort.Sort(sort.Reverse(groupList))
+	return groupList
+}
+
 // FormatReport returns a simple version of the Month-to-date billing report. It
 // takes a mapping form account/project ID to employee username in order to
 // more easily distinguish the owner of a cost.
@@ -260,7 +280,7 @@ func (r *Report) FormatReport(accountToUserMapping map[string]string, sortedByTa
 
 // GenerateReport generates a Month-to-date billing report for the current month
 func GenerateReport(reporter Reporter) Report {
-	today := time.Now()
+	today := clock.Now()
 	start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.Local)
 	return reporter.GenerateReport(start)
 }
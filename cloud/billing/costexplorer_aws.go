@@ -0,0 +1,145 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package billing
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+
+	"github.com/aws/aws-sdk-go/service/costexplorer"
+)
+
+const costExplorerMetric = "UnblendedCost"
+
+type costExplorerReporter struct {
+	csp            cloud.CSP
+	billingAccount string
+	sortByTag      string
+}
+
+// NewReporterCostExplorer initializes a new Reporter for the AWS cloud,
+// reading costs from the Cost Explorer API instead of the detailed billing
+// report. This requires specifying the account which holds the billing
+// information, usually the management account of the organization, whose
+// role is used to call the API. Costs are grouped by linked account and
+// service, or by linked account and the value of sortTag if it's not
+// empty, in which case their description is the linked account.
+func NewReporterCostExplorer(billingAccount, sortTag string) Reporter {
+	if billingAccount == "" {
+		panic("Invalid arguments, must not be empty (\"\")")
+	}
+	return &costExplorerReporter{
+		csp:            cloud.AWS,
+		billingAccount: billingAccount,
+		sortByTag:      sortTag,
+	}
+}
+
+func (r *costExplorerReporter) GenerateReport(start time.Time) Report {
+	report := Report{}
+	report.CSP = r.csp
+
+	// The end is exclusive, and there are no costs after today
+	now := clock.Now()
+	end := start.AddDate(0, 1, 0)
+	if tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local); end.After(tomorrow) {
+		end = tomorrow
+	}
+	second := &costexplorer.GroupDefinition{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String(costexplorer.DimensionService)}
+	if r.sortByTag != "" {
+		second = &costexplorer.GroupDefinition{Type: aws.String(costexplorer.GroupDefinitionTypeTag), Key: aws.String(r.sortByTag)}
+	}
+	input := &costexplorer.GetCostAndUsageInput{
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(start.Format(dateFormatLayout)),
+			End:   aws.String(end.Format(dateFormatLayout)),
+		},
+		Granularity: aws.String(costexplorer.GranularityDaily),
+		Metrics:     aws.StringSlice([]string{costExplorerMetric}),
+		GroupBy: []*costexplorer.GroupDefinition{
+			{Type: aws.String(costexplorer.GroupDefinitionTypeDimension), Key: aws.String(costexplorer.DimensionLinkedAccount)},
+			second,
+		},
+	}
+
+	client := r.client()
+	for {
+		output, err := client.GetCostAndUsage(input)
+		if err != nil {
+			log.Println("Failed to get costs from Cost Explorer:", err)
+			return report
+		}
+		for _, result := range output.ResultsByTime {
+			day := aws.StringValue(result.TimePeriod.Start)
+			for _, group := range result.Groups {
+				if item, ok := r.reportItem(group, day); ok {
+					report.Items = append(report.Items, item)
+				}
+			}
+		}
+		if aws.StringValue(output.NextPageToken) == "" {
+			return report
+		}
+		input.NextPageToken = output.NextPageToken
+	}
+}
+
+// reportItem converts a group of costs on a day to a report item
+func (r *costExplorerReporter) reportItem(group *costexplorer.Group, day string) (ReportItem, bool) {
+	keys := aws.StringValueSlice(group.Keys)
+	metric, exist := group.Metrics[costExplorerMetric]
+	if len(keys) != 2 || !exist {
+		log.Println("Unexpected cost group from Cost Explorer:", group)
+		return ReportItem{}, false
+	}
+	cost, err := strconv.ParseFloat(aws.StringValue(metric.Amount), 64)
+	if err != nil {
+		log.Println("Could not convert cost to float:", aws.StringValue(metric.Amount))
+		return ReportItem{}, false
+	}
+	item := ReportItem{Owner: keys[0], Description: keys[1], Cost: cost, Day: day}
+	if r.sortByTag != "" {
+		// Tag groups are on the form <key>$<value>, with an empty
+		// value for costs without the tag
+		item.Description = keys[0]
+		item.sortTagValue = keys[1][strings.Index(keys[1], "$")+1:]
+	}
+	return item, true
+}
+
+// CheckAccess checks that the costs of today can be read
+func (r *costExplorerReporter) CheckAccess() error {
+	now := clock.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	_, err := r.client().GetCostAndUsage(&costexplorer.GetCostAndUsageInput{
+		TimePeriod: &costexplorer.DateInterval{
+			Start: aws.String(today.Format(dateFormatLayout)),
+			End:   aws.String(today.AddDate(0, 0, 1).Format(dateFormatLayout)),
+		},
+		Granularity: aws.String(costexplorer.GranularityDaily),
+		Metrics:     aws.StringSlice([]string{costExplorerMetric}),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not get costs from Cost Explorer in %s: %s", r.billingAccount, err)
+	}
+	return nil
+}
+
+func (r *costExplorerReporter) client() *costexplorer.CostExplorer {
+	sess := cloud.NewAWSSession()
+	return costexplorer.New(sess, &aws.Config{
+		Credentials: cloud.AWSCredentials(sess, r.billingAccount),
+		Region:      aws.String("us-east-1"), // Cost Explorer is only available here
+	})
+}
@@ -1,6 +1,9 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+//go:build !nogcp
+// +build !nogcp
+
 package billing
 
 import (
@@ -29,6 +32,22 @@ type gcpReporter struct {
 	csvNamePrefix string
 }
 
+// NewReporterGCP initializes and returns a new Reporter for the GCP cloud.
+// This requires specifying a bucket where the billing CSVs can be found, as
+// well as the prefix of these CSV files. The prefix will be prepended to
+// the date and .csv suffix (e.g. <YOUR PREFIX>-2018-10-09.csv). None of
+// these argument must be empty.
+func NewReporterGCP(bucket, csvPrefix string) Reporter {
+	if bucket == "" || csvPrefix == "" {
+		panic("Invalid argument, must not be empty")
+	}
+	return &gcpReporter{
+		csp:           cloud.GCP,
+		bucket:        bucket,
+		csvNamePrefix: csvPrefix,
+	}
+}
+
 func (r *gcpReporter) GenerateReport(start time.Time) Report {
 	report := Report{}
 	report.CSP = r.csp
@@ -52,7 +71,7 @@ func (r *gcpReporter) GenerateReport(start time.Time) Report {
 		name := fmt.Sprintf(gcpCSVNameFormat, r.csvNamePrefix, start.Year(), start.Month(), d.Day())
 		log.Println("Getting", name)
 		obj := client.Bucket(r.bucket).Object(name)
-		if err := processObjectHandle(ctx, obj, &report, true); err != nil {
+		if err := processObjectHandle(ctx, obj, d.Format(dateFormatLayout), &report, true); err != nil {
 			log.Println(err, "- skipping...")
 			break
 		}
@@ -60,7 +79,25 @@ func (r *gcpReporter) GenerateReport(start time.Time) Report {
 	return report
 }
 
-func processObjectHandle(ctx context.Context, obj *storage.ObjectHandle, report *Report, allowFailed bool) error {
+// CheckAccess checks that the billing bucket can be read
+func (r *gcpReporter) CheckAccess() error {
+	ctx := context.Background()
+	opts := []option.ClientOption{}
+	if credsFilePath, exist := os.LookupEnv(cloud.GcpCredentialsFileKey); exist {
+		opts = append(opts, option.WithServiceAccountFile(credsFilePath))
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("Could not initialize storage service: %s", err)
+	}
+	defer client.Close()
+	if _, err := client.Bucket(r.bucket).Attrs(ctx); err != nil {
+		return fmt.Errorf("Could not read billing bucket %s: %s", r.bucket, err)
+	}
+	return nil
+}
+
+func processObjectHandle(ctx context.Context, obj *storage.ObjectHandle, day string, report *Report, allowFailed bool) error {
 	reader, err := obj.NewReader(ctx)
 	if err != nil {
 		return err
@@ -90,6 +127,7 @@ func processObjectHandle(ctx context.Context, obj *storage.ObjectHandle, report
 		reportItem := ReportItem{}
 		reportItem.Owner = record[csvHeaders["Project ID"]]
 		reportItem.Description = record[csvHeaders["Description"]]
+		reportItem.Day = day
 		cost := record[csvHeaders["Cost"]]
 		costNumber, err := strconv.ParseFloat(cost, 64)
 		if err != nil {
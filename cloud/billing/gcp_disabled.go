@@ -0,0 +1,23 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build nogcp
+// +build nogcp
+
+package billing
+
+import "log"
+
+// NewReporterGCP is not available when Cloudsweeper is built without
+// GCP support
+func NewReporterGCP(bucket, csvPrefix string) Reporter {
+	log.Fatalln("Cloudsweeper is built without support for GCP")
+	return nil
+}
+
+// NewReporterBigQuery is not available when Cloudsweeper is built without
+// GCP support
+func NewReporterBigQuery(project, dataset, table string) Reporter {
+	log.Fatalln("Cloudsweeper is built without support for GCP")
+	return nil
+}
@@ -4,24 +4,38 @@
 package billing
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
-	"strconv"
+	"sort"
+	"strings"
+	"sync"
 
-	"github.com/aws/aws-sdk-go/private/protocol"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/pricing"
 	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 )
 
 const (
-	gcpBucketPerGBMonth = 0.026
-
-	assumeRoleARNTemplate = "arn:aws:iam::%s:role/Cloudsweeper"
+	gcpBucketPerGBMonth   = 0.026
+	awsDynamoDBPerGBMonth = 0.25
+	// gcpUnusedAddressPerHour is the price of a static external IP
+	// address that is reserved, but not in use
+	gcpUnusedAddressPerHour = 0.01
+	// awsNATGatewayPerHour is the price of a NAT gateway, and
+	// awsVPCEndpointPerZoneHour the price of an interface VPC endpoint
+	// in each availability zone. Processed data is not included.
+	awsNATGatewayPerHour      = 0.045
+	awsVPCEndpointPerZoneHour = 0.01
+	// awsPublicIPv4PerHour is the price of every public IPv4 address,
+	// whether it's attached to an instance or an unused Elastic IP
+	awsPublicIPv4PerHour = 0.005
+	// awsRDSStoragePerGBMonth is the price of the general purpose storage
+	// of an RDS instance, and awsRDSSnapshotPerGBMonth the price of a
+	// manual RDS snapshot
+	awsRDSStoragePerGBMonth  = 0.115
+	awsRDSSnapshotPerGBMonth = 0.095
+
+	// maxConcurrentPriceLookups is the maximum number of concurrent
+	// requests made to the AWS pricing API
+	maxConcurrentPriceLookups = 8
 )
 
 type instanceKeyPair struct {
@@ -31,32 +45,10 @@ type instanceKeyPair struct {
 type priceMap map[instanceKeyPair]float64
 
 var (
-	awsPrices priceMap
+	awsPrices   priceMap
+	awsPricesMu sync.Mutex
 )
 
-var generalInstanceFilters = []*pricing.Filter{
-	{
-		Field: aws.String("operatingSystem"),
-		Type:  aws.String("TERM_MATCH"),
-		Value: aws.String("Linux"),
-	},
-	{
-		Field: aws.String("operation"),
-		Type:  aws.String("TERM_MATCH"),
-		Value: aws.String("RunInstances"),
-	},
-	{
-		Field: aws.String("capacitystatus"),
-		Type:  aws.String("TERM_MATCH"),
-		Value: aws.String("Used"),
-	},
-	{
-		Field: aws.String("tenancy"),
-		Type:  aws.String("TERM_MATCH"),
-		Value: aws.String("Shared"),
-	},
-}
-
 var awsRegionIDToNameMap = map[string]string{
 	"us-east-2":      "US East (Ohio)",
 	"us-east-1":      "US East (N. Virginia)",
@@ -95,12 +87,85 @@ var awsS3StorageCostMap = map[string]float64{
 var awsStorageCostMap = map[string]float64{
 	"standard": 0.05 / 30.0,
 	"gp2":      0.1 / 30.0,
+	"gp3":      0.08 / 30.0,
 	"io1":      0.125 / 30.0,
+	"io2":      0.125 / 30.0,
 	"st1":      0.045 / 30.0,
 	"sc1":      0.025 / 30.0,
 	"snapshot": 0.05 / 30.0,
 }
 
+// Price per day of provisioned IOPS and throughput (MB/s) of volumes, and
+// how much of it is included in the price of the size, as listed for
+// us-east-1
+var (
+	awsVolumeIOPSCostMap = map[string]float64{
+		"io1": 0.065 / 30.0,
+		"io2": 0.065 / 30.0,
+		"gp3": 0.005 / 30.0,
+	}
+	awsVolumeIncludedIOPSMap = map[string]int64{
+		"gp3": 3000,
+	}
+	awsVolumeThroughputCostMap = map[string]float64{
+		"gp3": 0.04 / 30.0,
+	}
+	awsVolumeIncludedThroughputMap = map[string]int64{
+		"gp3": 125,
+	}
+)
+
+// On-demand price per node per hour, as listed for us-east-1
+var awsCacheNodeCostPerHourMap = map[string]float64{
+	"cache.t2.micro":   0.017,
+	"cache.t2.small":   0.034,
+	"cache.t2.medium":  0.068,
+	"cache.t3.micro":   0.017,
+	"cache.t3.small":   0.034,
+	"cache.t3.medium":  0.068,
+	"cache.m4.large":   0.156,
+	"cache.m4.xlarge":  0.311,
+	"cache.m4.2xlarge": 0.623,
+	"cache.m5.large":   0.156,
+	"cache.m5.xlarge":  0.311,
+	"cache.m5.2xlarge": 0.623,
+	"cache.m5.4xlarge": 1.245,
+	"cache.r4.large":   0.228,
+	"cache.r4.xlarge":  0.455,
+	"cache.r4.2xlarge": 0.910,
+	"cache.r5.large":   0.216,
+	"cache.r5.xlarge":  0.431,
+	"cache.r5.2xlarge": 0.862,
+	"cache.r5.4xlarge": 1.724,
+}
+
+// On-demand price per single-AZ RDS instance per hour, as listed for
+// MySQL and PostgreSQL in us-east-1. Commercial engines cost more, so
+// their price is underestimated.
+var awsDBInstanceCostPerHourMap = map[string]float64{
+	"db.t2.micro":   0.017,
+	"db.t2.small":   0.034,
+	"db.t2.medium":  0.068,
+	"db.t3.micro":   0.017,
+	"db.t3.small":   0.034,
+	"db.t3.medium":  0.068,
+	"db.t3.large":   0.136,
+	"db.m4.large":   0.175,
+	"db.m4.xlarge":  0.350,
+	"db.m4.2xlarge": 0.700,
+	"db.m5.large":   0.171,
+	"db.m5.xlarge":  0.342,
+	"db.m5.2xlarge": 0.684,
+	"db.m5.4xlarge": 1.368,
+	"db.r4.large":   0.240,
+	"db.r4.xlarge":  0.480,
+	"db.r4.2xlarge": 0.960,
+	"db.r5.large":   0.240,
+	"db.r5.xlarge":  0.480,
+	"db.r5.2xlarge": 0.960,
+	"db.r5.4xlarge": 1.920,
+}
+
 // Storage cost per GB per day
 var gcpStorageCostGBDayMap = map[string]float64{
 	"pd-ssd":      0.170 / 30.0,
@@ -108,6 +173,33 @@ var gcpStorageCostGBDayMap = map[string]float64{
 	"snapshot":    0.026 / 30.0,
 }
 
+// Snapshot storage cost per GB per day, by storage location. Snapshots
+// are stored in a multi-region, such as "us", by default, or in a single
+// region, which is priced differently.
+var gcpSnapshotCostGBDayMap = map[string]float64{
+	"us":   0.026 / 30.0,
+	"eu":   0.026 / 30.0,
+	"asia": 0.026 / 30.0,
+
+	"us-central1":          0.020 / 30.0,
+	"us-east1":             0.020 / 30.0,
+	"us-west1":             0.020 / 30.0,
+	"europe-west1":         0.020 / 30.0,
+	"europe-west2":         0.023 / 30.0,
+	"asia-east1":           0.020 / 30.0,
+	"asia-northeast1":      0.023 / 30.0,
+	"australia-southeast1": 0.025 / 30.0,
+	"southamerica-east1":   0.030 / 30.0,
+}
+
+// gcpRegionalSnapshotCostGBDay is the snapshot storage cost per GB per day
+// in regions that aren't in gcpSnapshotCostGBDayMap
+const gcpRegionalSnapshotCostGBDay = 0.020 / 30.0
+
+// Regional persistent disks are replicated across two zones, and are
+// priced at twice the zonal price
+const gcpRegionalDiskMultiplier = 2.0
+
 var gcpInstanceCostPerHourMap = map[string]float64{
 	"n1-standard-1":  0.0475,
 	"n1-standard-2":  0.0950,
@@ -143,21 +235,78 @@ var gcpInstanceCostPerHourMap = map[string]float64{
 // ResourceCostPerDay returns the daily cost of a resource in USD
 func ResourceCostPerDay(resource cloud.Resource) float64 {
 	if inst, ok := resource.(cloud.Instance); ok {
-		return InstancePricePerHour(inst) * 24.0
+		return (InstancePricePerHour(inst) + PublicIPv4PricePerHour(inst)) * 24.0
 	} else if vol, ok := resource.(cloud.Volume); ok {
 		return VolumeCostPerDay(vol)
 	} else if img, ok := resource.(cloud.Image); ok {
 		return ImageCostPerDay(img)
 	} else if snap, ok := resource.(cloud.Snapshot); ok {
 		return SnapshotCostPerDay(snap)
+	} else if table, ok := resource.(cloud.Table); ok {
+		return TableCostPerDay(table)
+	} else if cluster, ok := resource.(cloud.CacheCluster); ok {
+		return CacheClusterPricePerHour(cluster) * 24.0
+	} else if address, ok := resource.(cloud.Address); ok {
+		return AddressPricePerHour(address) * 24.0
+	} else if gateway, ok := resource.(cloud.NetworkGateway); ok {
+		return NetworkGatewayPricePerHour(gateway) * 24.0
+	} else if capacity, ok := resource.(cloud.Capacity); ok {
+		return CapacityPricePerHour(capacity) * 24.0
+	} else if dbInstance, ok := resource.(cloud.DBInstance); ok {
+		return DBInstanceCostPerDay(dbInstance)
+	} else if dbSnapshot, ok := resource.(cloud.DBSnapshot); ok {
+		return DBSnapshotCostPerDay(dbSnapshot)
 	} else {
-		log.Println("Resource was neither instance, volume, image or snapshot")
+		log.Println("Resource was neither instance, volume, image, snapshot, table, cache cluster, address, network gateway, capacity or database")
 		return 0.0
 	}
 }
 
+// AmortizationWindowDays is the maximum number of days of a resource's
+// life counted in its accumulated cost. Since the cost is estimated with
+// today's price, counting the whole life overstates the cost of resized
+// resources. 0 means that the whole life of a resource is counted.
+var AmortizationWindowDays = 0
+
+// AccumulatedDays returns the number of days of a resource's life that
+// are counted in its accumulated cost, bounded by AmortizationWindowDays
+func AccumulatedDays(resource cloud.Resource) float64 {
+	days := clock.Now().Sub(resource.CreationTime()).Hours() / 24.0
+	if AmortizationWindowDays > 0 && days > float64(AmortizationWindowDays) {
+		return float64(AmortizationWindowDays)
+	}
+	return days
+}
+
+// AccumulatedCost returns the estimated total cost in USD of a resource
+// since it was created, or within AmortizationWindowDays. For buckets,
+// the monthly price is used instead.
+func AccumulatedCost(resource cloud.Resource) float64 {
+	if bucket, ok := resource.(cloud.Bucket); ok {
+		return BucketPricePerMonth(bucket)
+	}
+	return AccumulatedDays(resource) * ResourceCostPerDay(resource)
+}
+
+// SortByAccumulatedCost sorts a list of resources by their accumulated
+// cost, with the most expensive resource first. Resources with equal cost
+// are ordered by account and ID if cloud.Ordered is set.
+func SortByAccumulatedCost(resources []cloud.Resource) {
+	costs := make(map[cloud.Resource]float64, len(resources))
+	for _, res := range resources {
+		costs[res] = AccumulatedCost(res)
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		costI, costJ := costs[resources[i]], costs[resources[j]]
+		if costI != costJ || !cloud.Ordered {
+			return costI > costJ
+		}
+		return cloud.ResourceLess(resources[i], resources[j])
+	})
+}
+
 // VolumeCostPerDay returns the daily cost in USD for a
-// certain volume
+// certain volume, including its provisioned IOPS and throughput
 func VolumeCostPerDay(volume cloud.Volume) float64 {
 	if volume.CSP() == cloud.AWS {
 		price, ok := awsStorageCostMap[volume.VolumeType()]
@@ -165,32 +314,89 @@ func VolumeCostPerDay(volume cloud.Volume) float64 {
 			log.Fatalf("Could not find price for %s in AWS", volume.VolumeType())
 			return 0.0
 		}
-		return price * float64(volume.SizeGB())
+		return price*float64(volume.SizeGB()) + VolumeIOPSCostPerDay(volume) + VolumeThroughputCostPerDay(volume)
 	} else if volume.CSP() == cloud.GCP {
 		price, ok := gcpStorageCostGBDayMap[volume.VolumeType()]
 		if !ok {
 			log.Fatalf("Could not find price for %s in GCP", volume.VolumeType())
 			return 0.0
 		}
+		if volume.Regional() {
+			price *= gcpRegionalDiskMultiplier
+		}
 		return price * float64(volume.SizeGB())
 	}
 	log.Panicln("Unsupported CSP:", volume.CSP())
 	return 0.0
 }
 
+// VolumeIOPSCostPerDay returns the daily cost in USD for the
+// provisioned IOPS of a volume, beyond those included in its size
+func VolumeIOPSCostPerDay(volume cloud.Volume) float64 {
+	if volume.CSP() != cloud.AWS {
+		return 0.0
+	}
+	billed := volume.Iops() - awsVolumeIncludedIOPSMap[volume.VolumeType()]
+	if billed <= 0 {
+		return 0.0
+	}
+	return awsVolumeIOPSCostMap[volume.VolumeType()] * float64(billed)
+}
+
+// VolumeThroughputCostPerDay returns the daily cost in USD for the
+// provisioned throughput of a volume, beyond that included in its size
+func VolumeThroughputCostPerDay(volume cloud.Volume) float64 {
+	if volume.CSP() != cloud.AWS {
+		return 0.0
+	}
+	billed := volume.ThroughputMBps() - awsVolumeIncludedThroughputMap[volume.VolumeType()]
+	if billed <= 0 {
+		return 0.0
+	}
+	return awsVolumeThroughputCostMap[volume.VolumeType()] * float64(billed)
+}
+
 // SnapshotCostPerDay returns the daily cost in USD for a
 // certain snapshot
 func SnapshotCostPerDay(snapshot cloud.Snapshot) float64 {
 	if snapshot.CSP() == cloud.AWS {
 		return awsStorageCostMap["snapshot"] * float64(snapshot.SizeGB())
 	} else if snapshot.CSP() == cloud.GCP {
-		price := gcpStorageCostGBDayMap["snapshot"]
-		return price * float64(snapshot.SizeGB())
+		return gcpSnapshotCostPerGBDay(snapshot.Location()) * float64(snapshot.SizeGB())
 	}
 	log.Panicln("Unsupported CSP:", snapshot.CSP())
 	return 0.0
 }
 
+// VolumeArchiveCostPerDay returns the daily cost in USD for a snapshot
+// archiving a volume before it's cleaned up. Snapshots are only billed
+// for the data in them, so this is an upper bound. GCP snapshots are
+// stored in the default multi-region.
+func VolumeArchiveCostPerDay(volume cloud.Volume) float64 {
+	if volume.CSP() == cloud.AWS {
+		return awsStorageCostMap["snapshot"] * float64(volume.SizeGB())
+	} else if volume.CSP() == cloud.GCP {
+		return gcpSnapshotCostPerGBDay("") * float64(volume.SizeGB())
+	}
+	log.Panicln("Unsupported CSP:", volume.CSP())
+	return 0.0
+}
+
+// gcpSnapshotCostPerGBDay returns the daily cost per GB of snapshots in
+// the specified storage location. Unknown multi-regions, and snapshots
+// whose location isn't known, are priced as multi-regional. Snapshots in
+// several locations are priced by the first one.
+func gcpSnapshotCostPerGBDay(location string) float64 {
+	location = strings.Split(location, ",")[0]
+	if price, ok := gcpSnapshotCostGBDayMap[location]; ok {
+		return price
+	}
+	if strings.Contains(location, "-") {
+		return gcpRegionalSnapshotCostGBDay
+	}
+	return gcpStorageCostGBDayMap["snapshot"]
+}
+
 // ImageCostPerDay returns the daily cost in USD for a
 // certain image
 func ImageCostPerDay(image cloud.Image) float64 {
@@ -224,7 +430,8 @@ func InstancePricePerHour(instance cloud.Instance) float64 {
 // BucketPricePerMonth will return the monthly price in USD for a
 // specified bucket. It will not take any account wide discounts
 // that might have been collected for using a certain amount of
-// storage every month.
+// storage every month. Buckets whose size is unknown are priced
+// as free, check Bucket.SizeKnown before presenting the price.
 func BucketPricePerMonth(bucket cloud.Bucket) float64 {
 	if bucket.CSP() == cloud.AWS {
 		price := 0.0
@@ -239,92 +446,202 @@ func BucketPricePerMonth(bucket cloud.Bucket) float64 {
 	return 0.0
 }
 
+// TableCostPerDay returns the daily cost in USD for storing a
+// certain table. Read and write capacity is not included.
+func TableCostPerDay(table cloud.Table) float64 {
+	if table.CSP() == cloud.AWS {
+		return awsDynamoDBPerGBMonth / 30.0 * table.SizeGB()
+	}
+	log.Panicln("Unsupported CSP:", table.CSP())
+	return 0.0
+}
+
+// CacheClusterPricePerHour returns the hourly price in USD for a
+// certain cache cluster, based on its node type and number of nodes.
+func CacheClusterPricePerHour(cluster cloud.CacheCluster) float64 {
+	if cluster.CSP() == cloud.AWS {
+		price, ok := awsCacheNodeCostPerHourMap[cluster.NodeType()]
+		if !ok {
+			log.Printf("Could not find price for cache node type %s in AWS", cluster.NodeType())
+			return 0.0
+		}
+		return price * float64(cluster.NodeCount())
+	}
+	log.Panicln("Unsupported CSP:", cluster.CSP())
+	return 0.0
+}
+
+// AddressPricePerHour returns the hourly price in USD for a certain
+// address. Only addresses that are not in use are charged for, since the
+// public IPv4 addresses in use in AWS are charged for on the instance,
+// see PublicIPv4PricePerHour.
+func AddressPricePerHour(address cloud.Address) float64 {
+	if address.InUse() {
+		return 0.0
+	}
+	if address.CSP() == cloud.GCP {
+		return gcpUnusedAddressPerHour
+	} else if address.CSP() == cloud.AWS {
+		return awsPublicIPv4PerHour
+	}
+	log.Panicln("Unsupported CSP:", address.CSP())
+	return 0.0
+}
+
+// PublicIPv4PricePerHour returns the hourly price in USD for the public
+// IPv4 address of an instance, which AWS charges for separately from the
+// instance. It's included in the cost of the instance.
+func PublicIPv4PricePerHour(instance cloud.Instance) float64 {
+	if instance.CSP() != cloud.AWS || !instance.Public() {
+		return 0.0
+	}
+	return awsPublicIPv4PerHour
+}
+
+// NetworkGatewayPricePerHour returns the hourly price in USD for a
+// certain network gateway. The cost of the data it processes is not
+// included, since idle gateways don't process any.
+func NetworkGatewayPricePerHour(gateway cloud.NetworkGateway) float64 {
+	if gateway.CSP() == cloud.AWS {
+		if gateway.GatewayType() == cloud.NATGatewayType {
+			return awsNATGatewayPerHour
+		}
+		return awsVPCEndpointPerZoneHour * float64(gateway.Zones())
+	}
+	log.Panicln("Unsupported CSP:", gateway.CSP())
+	return 0.0
+}
+
+// CapacityPricePerHour returns the estimated hourly price in USD for the
+// part of a capacity that is not used. Instances running in a capacity
+// reservation are charged for as usual, so only its unused instances cost
+// extra. A dedicated host is charged for as a whole, and its instances
+// aren't, so it's estimated as the price of all instances it can hold.
+func CapacityPricePerHour(capacity cloud.Capacity) float64 {
+	if capacity.CSP() == cloud.AWS {
+		if capacity.InstanceType() == "" {
+			return 0.0
+		}
+		price := awsPricePerHour(capacity.Owner(), instanceKeyPair{capacity.Location(), capacity.InstanceType()})
+		if capacity.CapacityType() == cloud.DedicatedHostType {
+			return price * float64(capacity.TotalInstances())
+		}
+		return price * float64(capacity.TotalInstances()-capacity.UsedInstances())
+	}
+	log.Panicln("Unsupported CSP:", capacity.CSP())
+	return 0.0
+}
+
+// DBInstanceCostPerDay returns the estimated daily cost in USD of a
+// database instance, based on its class and allocated storage. Stopped
+// instances are only charged for their storage, and a multi-AZ instance
+// costs twice as much, since it has a standby instance.
+func DBInstanceCostPerDay(instance cloud.DBInstance) float64 {
+	if instance.CSP() == cloud.AWS {
+		cost := awsRDSStoragePerGBMonth / 30.0 * float64(instance.StorageGB())
+		if !instance.Stopped() {
+			price, ok := awsDBInstanceCostPerHourMap[instance.InstanceClass()]
+			if !ok {
+				log.Printf("Could not find price for database instance class %s in AWS", instance.InstanceClass())
+			}
+			cost += price * 24.0
+		}
+		if instance.MultiAZ() {
+			cost *= 2
+		}
+		return cost
+	}
+	log.Panicln("Unsupported CSP:", instance.CSP())
+	return 0.0
+}
+
+// DBSnapshotCostPerDay returns the daily cost in USD of a database
+// snapshot, based on the allocated storage of the instance it was taken
+// of. Snapshots are incremental, so this overstates the cost of all but
+// the first snapshot of an instance.
+func DBSnapshotCostPerDay(snapshot cloud.DBSnapshot) float64 {
+	if snapshot.CSP() == cloud.AWS {
+		return awsRDSSnapshotPerGBMonth / 30.0 * float64(snapshot.StorageGB())
+	}
+	log.Panicln("Unsupported CSP:", snapshot.CSP())
+	return 0.0
+}
+
 // awsInstancePricePerHour will return the hourly price in USD for a
 // specified instance type in a specified AWS region.
 func awsInstancePricePerHour(instance cloud.Instance) float64 {
+	return awsPricePerHour(instance.Owner(), instanceKeyPair{instance.Location(), instance.InstanceType()})
+}
+
+// awsPricePerHour returns the hourly price in USD of an instance type in
+// a region, which is looked up in the account of owner the first time
+func awsPricePerHour(owner string, key instanceKeyPair) float64 {
+	awsPricesMu.Lock()
 	if awsPrices == nil {
 		awsPrices = make(priceMap)
 	}
 	// The price for this instance type/region has already been fetched before
-	price, exist := awsPrices[instanceKeyPair{instance.Location(), instance.InstanceType()}]
+	price, exist := awsPrices[key]
+	awsPricesMu.Unlock()
 	if exist {
 		return price
 	}
+	price = fetchAWSInstancePrice(owner, key)
+	awsPricesMu.Lock()
+	awsPrices[key] = price
+	awsPricesMu.Unlock()
+	return price
+}
 
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, instance.Owner()))
-	svc := pricing.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String("us-east-1"), // pricing API is only available here
-	})
-
-	specificFilters := []*pricing.Filter{
-		{
-			Field: aws.String("instanceType"),
-			Type:  aws.String("TERM_MATCH"),
-			Value: aws.String(instance.InstanceType()),
-		},
-		{
-			Field: aws.String("location"),
-			Type:  aws.String("TERM_MATCH"),
-			Value: aws.String(awsRegionIDToNameMap[instance.Location()]),
-		},
-	}
-	filters := append(generalInstanceFilters, specificFilters...)
-	input := &pricing.GetProductsInput{
-		ServiceCode:   aws.String("AmazonEC2"),
-		Filters:       filters,
-		FormatVersion: aws.String("aws_v1"),
-	}
-	result, err := svc.GetProducts(input)
-	if err != nil {
-		log.Fatalln(err.Error())
-	}
-
-	var listPrice rawAWSPrice
-	rawListPriceJSON, err := protocol.EncodeJSONValue(result.PriceList[0], protocol.NoEscape)
-	if err != nil {
-		log.Fatalln(err.Error())
-	}
-	err = json.Unmarshal([]byte(rawListPriceJSON), &listPrice)
-	if err != nil {
-		log.Fatalln(err.Error())
-	}
-
-	for _, term := range listPrice.Terms.OnDemand {
-		for _, price := range term.PriceDimensions {
-			key := instanceKeyPair{
-				Region:       instance.Location(),
-				InstanceType: instance.InstanceType(),
-			}
-			usd, err := strconv.ParseFloat(price.PricePerUnit.USD, 64)
-			if err != nil {
-				log.Fatalln("Could not convert price from AWS JSON", err)
-			}
-			if usd == 0.00 {
-				log.Println("Price for", instance.InstanceType(), "in", instance.Location(), "is $0.00. Needs investigation!")
-			}
-			awsPrices[key] = usd
+// PrefetchInstancePrices looks up the prices of all distinct instance
+// types and regions among the specified instances concurrently, so that
+// later calls to e.g. InstancePricePerHour are answered from the cache.
+// Looking up prices one at a time dominates the runtime of reports on
+// large accounts.
+func PrefetchInstancePrices(instances []cloud.Instance) {
+	awsPricesMu.Lock()
+	if awsPrices == nil {
+		awsPrices = make(priceMap)
+	}
+	owners := make(map[instanceKeyPair]string)
+	for _, instance := range instances {
+		if instance.CSP() != cloud.AWS {
 			continue
 		}
+		key := instanceKeyPair{instance.Location(), instance.InstanceType()}
+		if _, exist := awsPrices[key]; !exist {
+			owners[key] = instance.Owner()
+		}
 	}
-
-	price, exist = awsPrices[instanceKeyPair{instance.Location(), instance.InstanceType()}]
-	if !exist {
-		log.Fatalln("Could not fetch price for", instance.InstanceType(), "in", instance.Location())
+	awsPricesMu.Unlock()
+	if len(owners) == 0 {
+		return
 	}
-	return price
+	log.Printf("Fetching prices of %d instance types\n", len(owners))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentPriceLookups)
+	for key, owner := range owners {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key instanceKeyPair, owner string) {
+			defer wg.Done()
+			price := fetchAWSInstancePrice(owner, key)
+			awsPricesMu.Lock()
+			awsPrices[key] = price
+			awsPricesMu.Unlock()
+			<-sem
+		}(key, owner)
+	}
+	wg.Wait()
 }
 
-// Helper structs for parsing the JSON from AWS
-type rawAWSPrice struct {
-	Terms struct {
-		OnDemand map[string]struct {
-			PriceDimensions map[string]struct {
-				PricePerUnit struct {
-					USD string `json:"USD"`
-				} `json:"pricePerUnit"`
-			} `json:"priceDimensions"`
-		} `json:"OnDemand"`
-	} `json:"terms"`
+// PrefetchCollectionPrices prefetches the prices of all instances in the
+// specified resource collections, see PrefetchInstancePrices.
+func PrefetchCollectionPrices(collections map[string]*cloud.ResourceCollection) {
+	instances := []cloud.Instance{}
+	for _, collection := range collections {
+		instances = append(instances, collection.Instances...)
+	}
+	PrefetchInstancePrices(instances)
 }
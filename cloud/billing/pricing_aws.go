@@ -0,0 +1,134 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package billing
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/private/protocol"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+var generalInstanceFilters = []*pricing.Filter{
+	{
+		Field: aws.String("operatingSystem"),
+		Type:  aws.String("TERM_MATCH"),
+		Value: aws.String("Linux"),
+	},
+	{
+		Field: aws.String("operation"),
+		Type:  aws.String("TERM_MATCH"),
+		Value: aws.String("RunInstances"),
+	},
+	{
+		Field: aws.String("capacitystatus"),
+		Type:  aws.String("TERM_MATCH"),
+		Value: aws.String("Used"),
+	},
+	{
+		Field: aws.String("tenancy"),
+		Type:  aws.String("TERM_MATCH"),
+		Value: aws.String("Shared"),
+	},
+}
+
+// fetchAWSInstancePrice gets the hourly on-demand price in USD of an
+// instance type in a region from the AWS pricing API, using the role
+// in the specified account.
+func fetchAWSInstancePrice(owner string, key instanceKeyPair) float64 {
+	sess := cloud.NewAWSSession()
+	creds := cloud.AWSCredentials(sess, owner)
+	svc := pricing.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String("us-east-1"), // pricing API is only available here
+	})
+
+	specificFilters := []*pricing.Filter{
+		{
+			Field: aws.String("instanceType"),
+			Type:  aws.String("TERM_MATCH"),
+			Value: aws.String(key.InstanceType),
+		},
+		{
+			Field: aws.String("location"),
+			Type:  aws.String("TERM_MATCH"),
+			Value: aws.String(awsRegionIDToNameMap[key.Region]),
+		},
+	}
+	filters := append(specificFilters, generalInstanceFilters...)
+	input := &pricing.GetProductsInput{
+		ServiceCode:   aws.String("AmazonEC2"),
+		Filters:       filters,
+		FormatVersion: aws.String("aws_v1"),
+	}
+	result, err := svc.GetProducts(input)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	var listPrice rawAWSPrice
+	rawListPriceJSON, err := protocol.EncodeJSONValue(result.PriceList[0], protocol.NoEscape)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	err = json.Unmarshal([]byte(rawListPriceJSON), &listPrice)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	for _, term := range listPrice.Terms.OnDemand {
+		for _, price := range term.PriceDimensions {
+			usd, err := strconv.ParseFloat(price.PricePerUnit.USD, 64)
+			if err != nil {
+				log.Fatalln("Could not convert price from AWS JSON", err)
+			}
+			if usd == 0.00 {
+				log.Println("Price for", key.InstanceType, "in", key.Region, "is $0.00. Needs investigation!")
+			}
+			return usd
+		}
+	}
+
+	log.Fatalln("Could not fetch price for", key.InstanceType, "in", key.Region)
+	return 0.0
+}
+
+// CheckPricingAPI checks that the AWS pricing API can be reached, using
+// the role in the specified account
+func CheckPricingAPI(owner string) error {
+	sess := cloud.NewAWSSession()
+	svc := pricing.New(sess, &aws.Config{
+		Credentials: cloud.AWSCredentials(sess, owner),
+		Region:      aws.String("us-east-1"), // pricing API is only available here
+	})
+	_, err := svc.DescribeServices(&pricing.DescribeServicesInput{
+		ServiceCode: aws.String("AmazonEC2"),
+		MaxResults:  aws.Int64(1),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not reach the AWS pricing API: %s", err)
+	}
+	return nil
+}
+
+// Helper structs for parsing the JSON from AWS
+type rawAWSPrice struct {
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				PricePerUnit struct {
+					USD string `json:"USD"`
+				} `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
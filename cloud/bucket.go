@@ -4,24 +4,51 @@
 package cloud
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"log"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	storage "google.golang.org/api/storage/v1"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 )
 
+// maxBucketObjectsListed is the maximum amount of objects listed when
+// looking for the last modified object of a bucket, in CSPs where the
+// objects aren't listed anyway
+const maxBucketObjectsListed = 100000
+
+// StateStore persists values between runs, grouped into namespaces, such
+// as the state file of Cloudsweeper
+type StateStore interface {
+	Get(namespace, key string, v interface{}) (bool, error)
+	Put(namespace, key string, v interface{}) error
+}
+
+// AWSBucketRegionCache, if set, caches the region of every bucket between
+// runs, so the region is only looked up for new buckets. A cached region
+// is looked up again if the bucket isn't found in it.
+var AWSBucketRegionCache StateStore
+
+// bucketLastModified returns when a bucket was last modified, given the
+// newest object found when listing its objects. If not all objects could
+// be listed, the newest object is unknown and the bucket is assumed to be
+// in use, so that it's never cleaned up by mistake.
+func bucketLastModified(creationTime, newestObject time.Time, listedAll bool) time.Time {
+	if !listedAll {
+		return clock.Now()
+	}
+	if newestObject.IsZero() {
+		return creationTime
+	}
+	return newestObject
+}
+
 type baseBucket struct {
 	baseResource
 	lastModified       time.Time
 	objectCount        int64
 	totalSizeGB        float64
 	storageTypeSizesGB map[string]float64
+	sizeKnown          bool
 }
 
 func (b *baseBucket) LastModified() time.Time {
@@ -40,7 +67,11 @@ func (b *baseBucket) StorageTypeSizesGB() map[string]float64 {
 	return b.storageTypeSizesGB
 }
 
-func cleanupBuckets(buckets []Bucket) error {
+func (b *baseBucket) SizeKnown() bool {
+	return b.sizeKnown
+}
+
+func cleanupBuckets(ctx context.Context, buckets []Bucket) error {
 	resList := []Resource{}
 	for i := range buckets {
 		v, ok := buckets[i].(Resource)
@@ -49,152 +80,5 @@ func cleanupBuckets(buckets []Bucket) error {
 		}
 		resList = append(resList, v)
 	}
-	return cleanupResources(resList)
-}
-
-// AWS
-
-type awsBucket struct {
-	baseBucket
-}
-
-func (b *awsBucket) Cleanup() error {
-	log.Printf("Cleaning up bucket %s in %s", b.ID(), b.Owner())
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
-	s3Client := s3.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(b.Location()),
-	})
-
-	var internalErr error
-	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
-		Bucket: aws.String(b.ID()),
-	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
-		input := &s3.DeleteObjectsInput{
-			Bucket: aws.String(b.ID()),
-		}
-		delete := &s3.Delete{
-			Objects: []*s3.ObjectIdentifier{},
-		}
-		for i := range output.Contents {
-			delete.Objects = append(delete.Objects, &s3.ObjectIdentifier{Key: output.Contents[i].Key})
-		}
-		input.Delete = delete
-		if len(delete.Objects) == 0 {
-			// A request with an empty list of objects is not allowed
-			return true
-		}
-		out, e := s3Client.DeleteObjects(input)
-		if e != nil {
-			internalErr = e
-			return false
-		}
-		if len(out.Errors) > 0 {
-			for i := range out.Errors {
-				log.Printf("ERROR: Could not delete '%s': %s\n", *out.Errors[i].Key, *out.Errors[i].Message)
-			}
-			internalErr = errors.New("Failed to delete one or more objects")
-			return false
-		}
-		return !lastPage
-	})
-	if err != nil {
-		return err
-	}
-	if internalErr != nil {
-		return internalErr
-	}
-
-	input := &s3.DeleteBucketInput{
-		Bucket: aws.String(b.ID()),
-	}
-	_, err = s3Client.DeleteBucket(input)
-	return err
-}
-
-func (b *awsBucket) SetTag(key, value string, overwrite bool) error {
-	_, exist := b.Tags()[key]
-	if exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, b.ID())
-	}
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
-	s3Client := s3.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(b.Location()),
-	})
-	tagging := &s3.Tagging{
-		TagSet: []*s3.Tag{&s3.Tag{
-			Key:   aws.String(key),
-			Value: aws.String(value),
-		}},
-	}
-	input := &s3.PutBucketTaggingInput{
-		Bucket:  aws.String(b.ID()),
-		Tagging: tagging,
-	}
-	_, err := s3Client.PutBucketTagging(input)
-	return err
-}
-
-// RemoveTag removes the specified tag from the bucket by first deleting all tags
-// and then adding back all the other tags. Note that this is potentially unsafe if
-// the program crashes in the middle of the function. Unfortunately there doesn't seem
-// to be an API call for removing a specific tag from a bucket...
-func (b *awsBucket) RemoveTag(tagToRemove string) error {
-	sess := session.Must(session.NewSession())
-	creds := stscreds.NewCredentials(sess, fmt.Sprintf(assumeRoleARNTemplate, b.Owner()))
-	s3Client := s3.New(sess, &aws.Config{
-		Credentials: creds,
-		Region:      aws.String(b.Location()),
-	})
-	_, err := s3Client.DeleteBucketTagging(&s3.DeleteBucketTaggingInput{
-		Bucket: aws.String(b.ID()),
-	})
-	if err != nil {
-		return err
-	}
-	tagging := &s3.Tagging{
-		TagSet: []*s3.Tag{},
-	}
-	for k, v := range b.Tags() {
-		if k == tagToRemove {
-			continue
-		}
-		tagging.TagSet = append(tagging.TagSet, &s3.Tag{
-			Key:   aws.String(k),
-			Value: aws.String(v),
-		})
-	}
-	input := &s3.PutBucketTaggingInput{
-		Bucket:  aws.String(b.ID()),
-		Tagging: tagging,
-	}
-	_, err = s3Client.PutBucketTagging(input)
-	return err
-}
-
-// GCP
-
-type gcpBucket struct {
-	baseBucket
-	storage *storage.Service
-}
-
-func (b *gcpBucket) Cleanup() error {
-	log.Printf("Cleaning up bucket %s in %s", b.ID(), b.Owner())
-	// TODO: Currently only works if bucket is empty, cleanup
-	// the objects in the bucket too
-	return b.storage.Buckets.Delete(b.ID()).Do()
-}
-
-func (b *gcpBucket) SetTag(key, value string, overwrite bool) error {
-	log.Println("Bucket tagging not supported on GCP")
-	return nil
-}
-
-func (b *gcpBucket) RemoveTag(key string) error {
-	log.Println("Bucket tagging not supported on GCP")
-	return nil
+	return cleanupResources(ctx, resList)
 }
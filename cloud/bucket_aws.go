@@ -0,0 +1,137 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type awsBucket struct {
+	baseBucket
+}
+
+func (b *awsBucket) Cleanup() error {
+	log.Printf("Cleaning up bucket %s in %s", b.ID(), AccountName(b.Owner()))
+	sess := NewAWSSession()
+	creds := AWSCredentials(sess, b.Owner())
+	s3Client := s3.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(b.Location()),
+	})
+
+	var internalErr error
+	err := s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(b.ID()),
+	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		input := &s3.DeleteObjectsInput{
+			Bucket: aws.String(b.ID()),
+		}
+		delete := &s3.Delete{
+			Objects: []*s3.ObjectIdentifier{},
+		}
+		for i := range output.Contents {
+			delete.Objects = append(delete.Objects, &s3.ObjectIdentifier{Key: output.Contents[i].Key})
+		}
+		input.Delete = delete
+		if len(delete.Objects) == 0 {
+			// A request with an empty list of objects is not allowed
+			return true
+		}
+		out, e := s3Client.DeleteObjects(input)
+		if e != nil {
+			internalErr = e
+			return false
+		}
+		if len(out.Errors) > 0 {
+			for i := range out.Errors {
+				log.Printf("ERROR: Could not delete '%s': %s\n", *out.Errors[i].Key, *out.Errors[i].Message)
+			}
+			internalErr = errors.New("Failed to delete one or more objects")
+			return false
+		}
+		return !lastPage
+	})
+	if err != nil {
+		return err
+	}
+	if internalErr != nil {
+		return internalErr
+	}
+
+	input := &s3.DeleteBucketInput{
+		Bucket: aws.String(b.ID()),
+	}
+	_, err = s3Client.DeleteBucket(input)
+	return err
+}
+
+func (b *awsBucket) SetTag(key, value string, overwrite bool) error {
+	_, exist := b.Tags()[key]
+	if exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, b.ID())
+	}
+	sess := NewAWSSession()
+	creds := AWSCredentials(sess, b.Owner())
+	s3Client := s3.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(b.Location()),
+	})
+	tagging := &s3.Tagging{
+		TagSet: []*s3.Tag{&s3.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		}},
+	}
+	input := &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(b.ID()),
+		Tagging: tagging,
+	}
+	_, err := s3Client.PutBucketTagging(input)
+	return err
+}
+
+// RemoveTag removes the specified tag from the bucket by first deleting all tags
+// and then adding back all the other tags. Note that this is potentially unsafe if
+// the program crashes in the middle of the function. Unfortunately there doesn't seem
+// to be an API call for removing a specific tag from a bucket...
+func (b *awsBucket) RemoveTag(tagToRemove string) error {
+	sess := NewAWSSession()
+	creds := AWSCredentials(sess, b.Owner())
+	s3Client := s3.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(b.Location()),
+	})
+	_, err := s3Client.DeleteBucketTagging(&s3.DeleteBucketTaggingInput{
+		Bucket: aws.String(b.ID()),
+	})
+	if err != nil {
+		return err
+	}
+	tagging := &s3.Tagging{
+		TagSet: []*s3.Tag{},
+	}
+	for k, v := range b.Tags() {
+		if k == tagToRemove {
+			continue
+		}
+		tagging.TagSet = append(tagging.TagSet, &s3.Tag{
+			Key:   aws.String(k),
+			Value: aws.String(v),
+		})
+	}
+	input := &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(b.ID()),
+		Tagging: tagging,
+	}
+	_, err = s3Client.PutBucketTagging(input)
+	return err
+}
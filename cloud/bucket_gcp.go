@@ -0,0 +1,35 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"log"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+type gcpBucket struct {
+	baseBucket
+	storage *storage.Service
+}
+
+func (b *gcpBucket) Cleanup() error {
+	log.Printf("Cleaning up bucket %s in %s", b.ID(), AccountName(b.Owner()))
+	// TODO: Currently only works if bucket is empty, cleanup
+	// the objects in the bucket too
+	return b.storage.Buckets.Delete(b.ID()).Do()
+}
+
+func (b *gcpBucket) SetTag(key, value string, overwrite bool) error {
+	log.Println("Bucket tagging not supported on GCP")
+	return nil
+}
+
+func (b *gcpBucket) RemoveTag(key string) error {
+	log.Println("Bucket tagging not supported on GCP")
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// awsBucketRegionNamespace is where the regions of buckets are cached in
+// AWSBucketRegionCache, as a mapping from bucket to region per account
+const awsBucketRegionNamespace = "aws-bucket-region"
+
+// awsBucketRegions resolves the regions of the buckets in an account. The
+// regions are read from the cache once and written back once per account,
+// so only the regions of new buckets are looked up.
+type awsBucketRegions struct {
+	account string
+	sess    *session.Session
+
+	mu      sync.Mutex
+	regions map[string]string
+	changed bool
+}
+
+// loadAWSBucketRegions reads the cached regions of the specified buckets
+// in an account. Buckets that no longer exist are dropped from the cache.
+func loadAWSBucketRegions(account string, sess *session.Session, buckets []*s3.Bucket) *awsBucketRegions {
+	r := &awsBucketRegions{
+		account: account,
+		sess:    sess,
+		regions: make(map[string]string),
+	}
+	if AWSBucketRegionCache == nil {
+		return r
+	}
+	cached := make(map[string]string)
+	if _, err := AWSBucketRegionCache.Get(awsBucketRegionNamespace, account, &cached); err != nil {
+		log.Printf("Could not read cached bucket regions of %s: %s", AccountName(account), err)
+	}
+	for _, bu := range buckets {
+		if region, ok := cached[aws.StringValue(bu.Name)]; ok {
+			r.regions[aws.StringValue(bu.Name)] = region
+		}
+	}
+	r.changed = len(r.regions) != len(cached)
+	return r
+}
+
+// region returns the region of a bucket, which is only looked up if it
+// isn't cached
+func (r *awsBucketRegions) region(ctx context.Context, bucket string) (string, error) {
+	r.mu.Lock()
+	region, ok := r.regions[bucket]
+	r.mu.Unlock()
+	if ok {
+		return region, nil
+	}
+	region, err := s3manager.GetBucketRegion(ctx, r.sess, bucket, defaultAWSRegion)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.regions[bucket] = region
+	r.changed = true
+	r.mu.Unlock()
+	return region, nil
+}
+
+// invalidate forgets the cached region of a bucket, so it's looked up
+// again the next time
+func (r *awsBucketRegions) invalidate(bucket string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.regions[bucket]; ok {
+		delete(r.regions, bucket)
+		r.changed = true
+	}
+}
+
+// save writes the regions of all buckets in the account to the cache
+func (r *awsBucketRegions) save() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if AWSBucketRegionCache == nil || !r.changed {
+		return
+	}
+	if err := AWSBucketRegionCache.Put(awsBucketRegionNamespace, r.account, r.regions); err != nil {
+		log.Printf("Could not cache bucket regions of %s: %s", AccountName(r.account), err)
+	}
+}
+
+// isAWSBucketNotFound is true if a bucket wasn't found in the region it
+// was accessed in, e.g. since it was recreated in another region after its
+// region was cached
+func isAWSBucketNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && (aerr.Code() == s3.ErrCodeNoSuchBucket || aerr.Code() == "PermanentRedirect" || aerr.Code() == "BucketRegionError")
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"sync"
+)
+
+// cachedResourceManager wraps another ResourceManager, and only gets the
+// resources from it the first time they are requested. All other calls
+// are passed on to the wrapped manager.
+type cachedResourceManager struct {
+	ResourceManager
+
+	mu            sync.Mutex
+	buckets       map[string][]Bucket
+	instances     map[string][]Instance
+	images        map[string][]Image
+	volumes       map[string][]Volume
+	snapshots     map[string][]Snapshot
+	tables        map[string][]Table
+	cacheClusters map[string][]CacheCluster
+	addresses     map[string][]Address
+	gateways      map[string][]NetworkGateway
+	capacities    map[string][]Capacity
+	dbInstances   map[string][]DBInstance
+	dbSnapshots   map[string][]DBSnapshot
+	allResources  map[string]*ResourceCollection
+}
+
+// NewCachedManager returns a ResourceManager that caches the resources
+// of the specified manager. This is useful when the same inventory is
+// evaluated several times, since listing resources is slow. Note that the
+// cache is never invalidated, not even after cleaning up resources.
+func NewCachedManager(mngr ResourceManager) ResourceManager {
+	return &cachedResourceManager{ResourceManager: mngr}
+}
+
+func (m *cachedResourceManager) BucketsPerAccount(ctx context.Context) map[string][]Bucket {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets == nil {
+		m.buckets = m.ResourceManager.BucketsPerAccount(ctx)
+	}
+	return m.buckets
+}
+
+func (m *cachedResourceManager) InstancesPerAccount(ctx context.Context) map[string][]Instance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.instances == nil {
+		m.instances = m.ResourceManager.InstancesPerAccount(ctx)
+	}
+	return m.instances
+}
+
+func (m *cachedResourceManager) ImagesPerAccount(ctx context.Context) map[string][]Image {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.images == nil {
+		m.images = m.ResourceManager.ImagesPerAccount(ctx)
+	}
+	return m.images
+}
+
+func (m *cachedResourceManager) VolumesPerAccount(ctx context.Context) map[string][]Volume {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.volumes == nil {
+		m.volumes = m.ResourceManager.VolumesPerAccount(ctx)
+	}
+	return m.volumes
+}
+
+func (m *cachedResourceManager) SnapshotsPerAccount(ctx context.Context) map[string][]Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snapshots == nil {
+		m.snapshots = m.ResourceManager.SnapshotsPerAccount(ctx)
+	}
+	return m.snapshots
+}
+
+func (m *cachedResourceManager) TablesPerAccount(ctx context.Context) map[string][]Table {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tables == nil {
+		m.tables = m.ResourceManager.TablesPerAccount(ctx)
+	}
+	return m.tables
+}
+
+func (m *cachedResourceManager) CacheClustersPerAccount(ctx context.Context) map[string][]CacheCluster {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cacheClusters == nil {
+		m.cacheClusters = m.ResourceManager.CacheClustersPerAccount(ctx)
+	}
+	return m.cacheClusters
+}
+
+func (m *cachedResourceManager) AddressesPerAccount(ctx context.Context) map[string][]Address {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.addresses == nil {
+		m.addresses = m.ResourceManager.AddressesPerAccount(ctx)
+	}
+	return m.addresses
+}
+
+func (m *cachedResourceManager) NetworkGatewaysPerAccount(ctx context.Context) map[string][]NetworkGateway {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.gateways == nil {
+		m.gateways = m.ResourceManager.NetworkGatewaysPerAccount(ctx)
+	}
+	return m.gateways
+}
+
+func (m *cachedResourceManager) CapacitiesPerAccount(ctx context.Context) map[string][]Capacity {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.capacities == nil {
+		m.capacities = m.ResourceManager.CapacitiesPerAccount(ctx)
+	}
+	return m.capacities
+}
+
+func (m *cachedResourceManager) DBInstancesPerAccount(ctx context.Context) map[string][]DBInstance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dbInstances == nil {
+		m.dbInstances = m.ResourceManager.DBInstancesPerAccount(ctx)
+	}
+	return m.dbInstances
+}
+
+func (m *cachedResourceManager) DBSnapshotsPerAccount(ctx context.Context) map[string][]DBSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.dbSnapshots == nil {
+		m.dbSnapshots = m.ResourceManager.DBSnapshotsPerAccount(ctx)
+	}
+	return m.dbSnapshots
+}
+
+// AllResourcesPerAccount returns a copy of the cached collections, so
+// that callers changing a collection don't affect later callers
+func (m *cachedResourceManager) AllResourcesPerAccount(ctx context.Context) map[string]*ResourceCollection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.allResources == nil {
+		m.allResources = m.ResourceManager.AllResourcesPerAccount(ctx)
+	}
+	result := make(map[string]*ResourceCollection, len(m.allResources))
+	for owner, collection := range m.allResources {
+		collectionCopy := *collection
+		result[owner] = &collectionCopy
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type baseCacheCluster struct {
+	baseResource
+	engine       string
+	nodeType     string
+	nodeCount    int64
+	lastActivity time.Time
+}
+
+func (c *baseCacheCluster) Engine() string {
+	return c.engine
+}
+
+func (c *baseCacheCluster) NodeType() string {
+	return c.nodeType
+}
+
+func (c *baseCacheCluster) NodeCount() int64 {
+	return c.nodeCount
+}
+
+func (c *baseCacheCluster) LastActivity() time.Time {
+	return c.lastActivity
+}
+
+func cleanupCacheClusters(ctx context.Context, clusters []CacheCluster) error {
+	resList := []Resource{}
+	for i := range clusters {
+		v, ok := clusters[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert CacheCluster to Resource")
+		}
+		resList = append(resList, v)
+	}
+	return cleanupResources(ctx, resList)
+}
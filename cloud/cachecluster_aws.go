@@ -0,0 +1,80 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elasticache"
+)
+
+type awsCacheCluster struct {
+	baseCacheCluster
+	arn string
+}
+
+// Cleanup will delete this ElastiCache cluster
+func (c *awsCacheCluster) Cleanup() error {
+	log.Printf("Cleaning up cache cluster %s in %s", c.ID(), AccountName(c.Owner()))
+	return awsTryWithBackoff(c.cleanup)
+}
+
+func (c *awsCacheCluster) cleanup() error {
+	client := elastiCacheClientForAWSResource(c)
+	input := &elasticache.DeleteCacheClusterInput{
+		CacheClusterId: aws.String(c.ID()),
+	}
+	_, err := client.DeleteCacheCluster(input)
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func (c *awsCacheCluster) SetTag(key, value string, overwrite bool) error {
+	if _, exist := c.Tags()[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, c.ID())
+	}
+	client := elastiCacheClientForAWSResource(c)
+	input := &elasticache.AddTagsToResourceInput{
+		ResourceName: aws.String(c.arn),
+		Tags: []*elasticache.Tag{&elasticache.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		}},
+	}
+	_, err := client.AddTagsToResource(input)
+	return err
+}
+
+func (c *awsCacheCluster) RemoveTag(key string) error {
+	if _, exist := c.Tags()[key]; !exist {
+		return nil
+	}
+	client := elastiCacheClientForAWSResource(c)
+	input := &elasticache.RemoveTagsFromResourceInput{
+		ResourceName: aws.String(c.arn),
+		TagKeys:      aws.StringSlice([]string{key}),
+	}
+	_, err := client.RemoveTagsFromResource(input)
+	return err
+}
+
+func elastiCacheClientForAWSResource(res Resource) *elasticache.ElastiCache {
+	sess := NewAWSSession()
+	creds := AWSCredentials(sess, res.Owner())
+	return elasticache.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(res.Location()),
+	})
+}
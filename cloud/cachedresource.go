@@ -0,0 +1,458 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"time"
+)
+
+// Kinds of resources in the resource cache, used to look up the live
+// resource a cached resource was listed from
+const (
+	cachedInstanceKind       = "instance"
+	cachedImageKind          = "image"
+	cachedVolumeKind         = "volume"
+	cachedSnapshotKind       = "snapshot"
+	cachedBucketKind         = "bucket"
+	cachedTableKind          = "table"
+	cachedCacheClusterKind   = "cache-cluster"
+	cachedAddressKind        = "address"
+	cachedNetworkGatewayKind = "network-gateway"
+	cachedCapacityKind       = "capacity"
+	cachedDBInstanceKind     = "db-instance"
+	cachedDBSnapshotKind     = "db-snapshot"
+)
+
+// cachedBase holds the data common to all resources in the resource
+// cache. The cached data is only read, all changes are made to the live
+// resource it was listed from, and then recorded in the cache.
+type cachedBase struct {
+	Provider CSP               `json:"csp"`
+	Account  string            `json:"owner"`
+	Ident    string            `json:"id"`
+	TagMap   map[string]string `json:"tags,omitempty"`
+	Region   string            `json:"location"`
+	Exposed  bool              `json:"public,omitempty"`
+	Created  time.Time         `json:"creation_time"`
+	Parents  []string          `json:"lineage,omitempty"`
+
+	cache *ResourceCache
+	kind  string
+}
+
+func newCachedBase(res Resource) cachedBase {
+	tags := make(map[string]string, len(res.Tags()))
+	for key, value := range res.Tags() {
+		tags[key] = value
+	}
+	return cachedBase{
+		Provider: res.CSP(),
+		Account:  res.Owner(),
+		Ident:    res.ID(),
+		TagMap:   tags,
+		Region:   res.Location(),
+		Exposed:  res.Public(),
+		Created:  res.CreationTime(),
+		Parents:  res.Lineage(),
+	}
+}
+
+func (r *cachedBase) CSP() CSP {
+	return r.Provider
+}
+
+func (r *cachedBase) Owner() string {
+	return r.Account
+}
+
+func (r *cachedBase) ID() string {
+	return r.Ident
+}
+
+func (r *cachedBase) Tags() map[string]string {
+	return r.cache.tags(r)
+}
+
+func (r *cachedBase) Location() string {
+	return r.Region
+}
+
+func (r *cachedBase) Public() bool {
+	return r.Exposed
+}
+
+func (r *cachedBase) CreationTime() time.Time {
+	return r.Created
+}
+
+func (r *cachedBase) Lineage() []string {
+	return r.Parents
+}
+
+func (r *cachedBase) SetTag(key, value string, overwrite bool) error {
+	live, err := r.cache.liveResource(r.cache.ctx, r)
+	if err != nil {
+		return err
+	}
+	if err := live.SetTag(key, value, overwrite); err != nil {
+		return err
+	}
+	r.cache.setTag(r, key, value)
+	return nil
+}
+
+func (r *cachedBase) RemoveTag(key string) error {
+	live, err := r.cache.liveResource(r.cache.ctx, r)
+	if err != nil {
+		return err
+	}
+	if err := live.RemoveTag(key); err != nil {
+		return err
+	}
+	r.cache.removeTag(r, key)
+	return nil
+}
+
+func (r *cachedBase) Cleanup() error {
+	live, err := r.cache.liveResource(r.cache.ctx, r)
+	if err != nil {
+		return err
+	}
+	return live.Cleanup()
+}
+
+type cachedInstance struct {
+	cachedBase
+	Type      string    `json:"instance_type"`
+	IsRunning bool      `json:"running,omitempty"`
+	Key       string    `json:"key_name,omitempty"`
+	Groups    []string  `json:"security_groups,omitempty"`
+	InboundAt time.Time `json:"last_inbound_traffic,omitempty"`
+}
+
+func (i *cachedInstance) InstanceType() string {
+	return i.Type
+}
+
+func (i *cachedInstance) Running() bool {
+	return i.IsRunning
+}
+
+func (i *cachedInstance) Stop() error {
+	live, err := i.cache.liveResource(i.cache.ctx, &i.cachedBase)
+	if err != nil {
+		return err
+	}
+	if err := live.(Instance).Stop(); err != nil {
+		return err
+	}
+	i.cache.update(func() { i.IsRunning = false })
+	return nil
+}
+
+func (i *cachedInstance) KeyName() string {
+	return i.Key
+}
+
+func (i *cachedInstance) SecurityGroups() []string {
+	return i.Groups
+}
+
+func (i *cachedInstance) LastInboundTraffic() time.Time {
+	return i.InboundAt
+}
+
+type cachedImage struct {
+	cachedBase
+	ImageName   string `json:"name,omitempty"`
+	Size        int64  `json:"size_gb"`
+	ImageFamily string `json:"family,omitempty"`
+	SourceImage string `json:"source_image_id,omitempty"`
+	SourceLoc   string `json:"source_region,omitempty"`
+}
+
+func (i *cachedImage) Name() string {
+	return i.ImageName
+}
+
+func (i *cachedImage) SizeGB() int64 {
+	return i.Size
+}
+
+func (i *cachedImage) Family() string {
+	return i.ImageFamily
+}
+
+func (i *cachedImage) SourceImageID() string {
+	return i.SourceImage
+}
+
+func (i *cachedImage) SourceRegion() string {
+	return i.SourceLoc
+}
+
+func (i *cachedImage) MakePrivate() error {
+	live, err := i.cache.liveResource(i.cache.ctx, &i.cachedBase)
+	if err != nil {
+		return err
+	}
+	if err := live.(Image).MakePrivate(); err != nil {
+		return err
+	}
+	i.cache.update(func() { i.Exposed = false })
+	return nil
+}
+
+type cachedVolume struct {
+	cachedBase
+	Size        int64  `json:"size_gb"`
+	IsAttached  bool   `json:"attached,omitempty"`
+	IsEncrypted bool   `json:"encrypted,omitempty"`
+	Type        string `json:"volume_type,omitempty"`
+	IsRegional  bool   `json:"regional,omitempty"`
+	IOPS        int64  `json:"iops,omitempty"`
+	Throughput  int64  `json:"throughput_mbps,omitempty"`
+}
+
+func (v *cachedVolume) SizeGB() int64 {
+	return v.Size
+}
+
+func (v *cachedVolume) Attached() bool {
+	return v.IsAttached
+}
+
+func (v *cachedVolume) Encrypted() bool {
+	return v.IsEncrypted
+}
+
+func (v *cachedVolume) VolumeType() string {
+	return v.Type
+}
+
+func (v *cachedVolume) Regional() bool {
+	return v.IsRegional
+}
+
+func (v *cachedVolume) Iops() int64 {
+	return v.IOPS
+}
+
+func (v *cachedVolume) ThroughputMBps() int64 {
+	return v.Throughput
+}
+
+func (v *cachedVolume) snapshot(tags map[string]string) (string, error) {
+	live, err := v.cache.liveResource(v.cache.ctx, &v.cachedBase)
+	if err != nil {
+		return "", err
+	}
+	return SnapshotVolume(live.(Volume), tags)
+}
+
+type cachedSnapshot struct {
+	cachedBase
+	IsEncrypted bool  `json:"encrypted,omitempty"`
+	IsInUse     bool  `json:"in_use,omitempty"`
+	Size        int64 `json:"size_gb"`
+}
+
+func (s *cachedSnapshot) Encrypted() bool {
+	return s.IsEncrypted
+}
+
+func (s *cachedSnapshot) InUse() bool {
+	return s.IsInUse
+}
+
+func (s *cachedSnapshot) SizeGB() int64 {
+	return s.Size
+}
+
+type cachedBucket struct {
+	cachedBase
+	ModifiedAt   time.Time          `json:"last_modified"`
+	Objects      int64              `json:"object_count"`
+	Size         float64            `json:"total_size_gb"`
+	StorageSizes map[string]float64 `json:"storage_type_sizes_gb,omitempty"`
+	IsSizeKnown  bool               `json:"size_known,omitempty"`
+}
+
+func (b *cachedBucket) LastModified() time.Time {
+	return b.ModifiedAt
+}
+
+func (b *cachedBucket) ObjectCount() int64 {
+	return b.Objects
+}
+
+func (b *cachedBucket) TotalSizeGB() float64 {
+	return b.Size
+}
+
+func (b *cachedBucket) StorageTypeSizesGB() map[string]float64 {
+	return b.StorageSizes
+}
+
+func (b *cachedBucket) SizeKnown() bool {
+	return b.IsSizeKnown
+}
+
+type cachedTable struct {
+	cachedBase
+	Size     float64   `json:"size_gb"`
+	Items    int64     `json:"item_count"`
+	ActiveAt time.Time `json:"last_activity"`
+}
+
+func (t *cachedTable) SizeGB() float64 {
+	return t.Size
+}
+
+func (t *cachedTable) ItemCount() int64 {
+	return t.Items
+}
+
+func (t *cachedTable) LastActivity() time.Time {
+	return t.ActiveAt
+}
+
+type cachedCacheCluster struct {
+	cachedBase
+	ClusterEngine string    `json:"engine"`
+	Type          string    `json:"node_type"`
+	Nodes         int64     `json:"node_count"`
+	ActiveAt      time.Time `json:"last_activity"`
+}
+
+func (c *cachedCacheCluster) Engine() string {
+	return c.ClusterEngine
+}
+
+func (c *cachedCacheCluster) NodeType() string {
+	return c.Type
+}
+
+func (c *cachedCacheCluster) NodeCount() int64 {
+	return c.Nodes
+}
+
+func (c *cachedCacheCluster) LastActivity() time.Time {
+	return c.ActiveAt
+}
+
+type cachedAddress struct {
+	cachedBase
+	Address string `json:"ip"`
+	IsInUse bool   `json:"in_use,omitempty"`
+}
+
+func (a *cachedAddress) IP() string {
+	return a.Address
+}
+
+func (a *cachedAddress) InUse() bool {
+	return a.IsInUse
+}
+
+type cachedNetworkGateway struct {
+	cachedBase
+	Type      string    `json:"gateway_type"`
+	NetworkID string    `json:"network"`
+	ZoneCount int       `json:"zones"`
+	ActiveAt  time.Time `json:"last_activity"`
+}
+
+func (g *cachedNetworkGateway) GatewayType() string {
+	return g.Type
+}
+
+func (g *cachedNetworkGateway) Network() string {
+	return g.NetworkID
+}
+
+func (g *cachedNetworkGateway) Zones() int {
+	return g.ZoneCount
+}
+
+func (g *cachedNetworkGateway) LastActivity() time.Time {
+	return g.ActiveAt
+}
+
+type cachedCapacity struct {
+	cachedBase
+	Type         string `json:"capacity_type"`
+	InstanceKind string `json:"instance_type,omitempty"`
+	Total        int    `json:"total_instances"`
+	Used         int    `json:"used_instances"`
+}
+
+func (c *cachedCapacity) CapacityType() string {
+	return c.Type
+}
+
+func (c *cachedCapacity) InstanceType() string {
+	return c.InstanceKind
+}
+
+func (c *cachedCapacity) TotalInstances() int {
+	return c.Total
+}
+
+func (c *cachedCapacity) UsedInstances() int {
+	return c.Used
+}
+
+type cachedDBInstance struct {
+	cachedBase
+	DBEngine  string    `json:"engine"`
+	Class     string    `json:"instance_class"`
+	Storage   int64     `json:"storage_gb"`
+	IsMultiAZ bool      `json:"multi_az,omitempty"`
+	IsStopped bool      `json:"stopped,omitempty"`
+	ActiveAt  time.Time `json:"last_activity"`
+}
+
+func (d *cachedDBInstance) Engine() string {
+	return d.DBEngine
+}
+
+func (d *cachedDBInstance) InstanceClass() string {
+	return d.Class
+}
+
+func (d *cachedDBInstance) StorageGB() int64 {
+	return d.Storage
+}
+
+func (d *cachedDBInstance) MultiAZ() bool {
+	return d.IsMultiAZ
+}
+
+func (d *cachedDBInstance) Stopped() bool {
+	return d.IsStopped
+}
+
+func (d *cachedDBInstance) LastActivity() time.Time {
+	return d.ActiveAt
+}
+
+type cachedDBSnapshot struct {
+	cachedBase
+	DBEngine   string `json:"engine"`
+	InstanceID string `json:"db_instance_id"`
+	Storage    int64  `json:"storage_gb"`
+}
+
+func (d *cachedDBSnapshot) Engine() string {
+	return d.DBEngine
+}
+
+func (d *cachedDBSnapshot) DBInstanceID() string {
+	return d.InstanceID
+}
+
+func (d *cachedDBSnapshot) StorageGB() int64 {
+	return d.Storage
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// DedicatedHostType is the type of dedicated hosts
+	DedicatedHostType = "dedicated-host"
+	// CapacityReservationType is the type of capacity reservations
+	CapacityReservationType = "capacity-reservation"
+)
+
+type baseCapacity struct {
+	baseResource
+	capacityType   string
+	instanceType   string
+	totalInstances int
+	usedInstances  int
+}
+
+func (c *baseCapacity) CapacityType() string {
+	return c.capacityType
+}
+
+func (c *baseCapacity) InstanceType() string {
+	return c.instanceType
+}
+
+func (c *baseCapacity) TotalInstances() int {
+	return c.totalInstances
+}
+
+func (c *baseCapacity) UsedInstances() int {
+	return c.usedInstances
+}
+
+func cleanupCapacities(ctx context.Context, capacities []Capacity) error {
+	resList := []Resource{}
+	for i := range capacities {
+		v, ok := capacities[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert Capacity to Resource")
+		}
+		resList = append(resList, v)
+	}
+	return cleanupResources(ctx, resList)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type awsCapacity struct {
+	baseCapacity
+}
+
+// Cleanup will cancel this capacity reservation, or release this
+// dedicated host
+func (c *awsCapacity) Cleanup() error {
+	log.Printf("Cleaning up %s %s in %s", c.CapacityType(), c.ID(), AccountName(c.Owner()))
+	return awsTryWithBackoff(c.cleanup)
+}
+
+func (c *awsCapacity) cleanup() error {
+	client := clientForAWSResource(c)
+	var err error
+	if c.CapacityType() == CapacityReservationType {
+		_, err = client.CancelCapacityReservation(&ec2.CancelCapacityReservationInput{
+			CapacityReservationId: aws.String(c.ID()),
+		})
+	} else {
+		var output *ec2.ReleaseHostsOutput
+		output, err = client.ReleaseHosts(&ec2.ReleaseHostsInput{
+			HostIds: aws.StringSlice([]string{c.ID()}),
+		})
+		if err == nil && len(output.Unsuccessful) > 0 && output.Unsuccessful[0].Error != nil {
+			err = fmt.Errorf("Could not release %s: %s", c.ID(), aws.StringValue(output.Unsuccessful[0].Error.Message))
+		}
+	}
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func (c *awsCapacity) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(c, key, value, overwrite)
+}
+
+func (c *awsCapacity) RemoveTag(key string) error {
+	return removeAWSTag(c, key)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package clock provides the current time to the age and expiry logic
+// of Cloudsweeper. By default the system clock is used, but it can be
+// replaced with a frozen clock to verify how thresholds behave at an
+// arbitrary point in time.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+type frozenClock struct {
+	now time.Time
+}
+
+func (c frozenClock) Now() time.Time {
+	return c.now
+}
+
+// System returns a clock that uses the system time
+func System() Clock {
+	return systemClock{}
+}
+
+// Frozen returns a clock that always returns the specified time
+func Frozen(now time.Time) Clock {
+	return frozenClock{now: now}
+}
+
+var (
+	mu      sync.RWMutex
+	current Clock = systemClock{}
+)
+
+// Set replaces the clock used by Now. A nil clock restores the system clock.
+func Set(c Clock) {
+	mu.Lock()
+	defer mu.Unlock()
+	if c == nil {
+		c = systemClock{}
+	}
+	current = c
+}
+
+// Current returns the clock in use
+func Current() Clock {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Now returns the current time according to the clock in use
+func Now() time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.Now()
+}
+
+// Since returns the time elapsed since t according to the clock in use
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
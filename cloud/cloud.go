@@ -5,16 +5,9 @@ package cloud
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"os"
 	"time"
-
-	oauth2 "golang.org/x/oauth2/google"
-	compute "google.golang.org/api/compute/v1"
-	storage "google.golang.org/api/storage/v1"
 )
 
 const (
@@ -22,45 +15,118 @@ const (
 	// to service accounts credentials JSON file
 	GcpCredentialsFileKey = "GOOGLE_APPLICATION_CREDENTIALS"
 
-	scopeGCPCompute = "https://www.googleapis.com/auth/compute"
-	scopeGCPStorage = "https://www.googleapis.com/auth/devstorage.read_write"
+	scopeGCPCompute   = "https://www.googleapis.com/auth/compute"
+	scopeGCPStorage   = "https://www.googleapis.com/auth/devstorage.read_write"
+	scopeGCPCloud     = "https://www.googleapis.com/auth/cloud-platform"
+	scopeGCPUserEmail = "https://www.googleapis.com/auth/userinfo.email"
+)
+
+var (
+	// ErrPermissionDenied is returned if not enough permissions to perform action
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// GCPBucketListTimeout is the maximum time spent listing the objects
+	// of a single bucket. 0 means there is no limit.
+	GCPBucketListTimeout = 5 * time.Minute
+	// GCPObjectListRequestsPerSecond limits the rate of requests listing
+	// objects in a bucket. 0 means there is no limit.
+	GCPObjectListRequestsPerSecond = 10
+	// GCPBucketListPrefixes, if set, are the only prefixes listed in
+	// buckets, to sample very large buckets. Objects outside them may have
+	// been modified, so the buckets are assumed to be in use, and their
+	// size is unknown.
+	GCPBucketListPrefixes []string
 )
 
 // ResourceManager is used to manage the different resources on
 // a CSP. It can be used to get e.g. all instances for all accounts
-// in AWS.
+// in AWS. If any resource fails to be cleaned up by one of the Cleanup
+// methods, a *CleanupError listing the failed resources is returned.
+// Once the context passed to a method is done, its in-flight requests
+// are aborted and no more are made: the listing methods return what was
+// listed so far, with the remaining regions recorded in the ScanStatus,
+// and the Cleanup methods return the resources not cleaned up as failed.
 type ResourceManager interface {
 	// Owners return a list of all owners the manager handle
 	Owners() []string
 	// BucketsPerAccount returns a mapping from account/project to
 	// its associated buckets
-	BucketsPerAccount() map[string][]Bucket
+	BucketsPerAccount(ctx context.Context) map[string][]Bucket
 	// InstancesPerAccount returns a mapping from account/project
 	// to its associated instances
-	InstancesPerAccount() map[string][]Instance
+	InstancesPerAccount(ctx context.Context) map[string][]Instance
 	// ImagesPerAccount returns a mapping from account/project
 	// to its associated images
-	ImagesPerAccount() map[string][]Image
+	ImagesPerAccount(ctx context.Context) map[string][]Image
 	// VolumesPerAccount returns a mapping from account/project
 	// to its associated volumes
-	VolumesPerAccount() map[string][]Volume
+	VolumesPerAccount(ctx context.Context) map[string][]Volume
 	// SnapshotsPerAccount returns a mapping from account/project
 	// to its associated snaphots
-	SnapshotsPerAccount() map[string][]Snapshot
+	SnapshotsPerAccount(ctx context.Context) map[string][]Snapshot
+	// TablesPerAccount returns a mapping from account/project to
+	// its associated managed database tables
+	TablesPerAccount(ctx context.Context) map[string][]Table
+	// CacheClustersPerAccount returns a mapping from account/project
+	// to its associated managed cache clusters
+	CacheClustersPerAccount(ctx context.Context) map[string][]CacheCluster
+	// AddressesPerAccount returns a mapping from account/project to
+	// its reserved external IP addresses
+	AddressesPerAccount(ctx context.Context) map[string][]Address
+	// NetworkGatewaysPerAccount returns a mapping from account/project
+	// to its network gateways, such as NAT gateways
+	NetworkGatewaysPerAccount(ctx context.Context) map[string][]NetworkGateway
+	// CapacitiesPerAccount returns a mapping from account/project to
+	// its reserved compute capacity, such as dedicated hosts
+	CapacitiesPerAccount(ctx context.Context) map[string][]Capacity
+	// DBInstancesPerAccount returns a mapping from account/project to
+	// its managed database instances, such as RDS instances
+	DBInstancesPerAccount(ctx context.Context) map[string][]DBInstance
+	// DBSnapshotsPerAccount returns a mapping from account/project to
+	// its manual snapshots of managed database instances
+	DBSnapshotsPerAccount(ctx context.Context) map[string][]DBSnapshot
 	// AllResourcesPerAccount will return a mapping from account/project
 	// to all of the resources associated with that account/project
-	AllResourcesPerAccount() map[string]*ResourceCollection
+	AllResourcesPerAccount(ctx context.Context) map[string]*ResourceCollection
+	// ReferencedImages returns the IDs of all images referenced by the
+	// specified SSM parameter paths, and optionally by launch templates,
+	// in any account/project. An error is returned if any reference
+	// could not be resolved, so the result is never incomplete.
+	ReferencedImages(ctx context.Context, parameterPaths []string, launchTemplates bool) (map[string]bool, error)
+	// SnapshotDependencies returns which images and volumes, in any
+	// account/project, depend on each snapshot. An error is returned if
+	// any account/project could not be scanned, so the graph is never
+	// incomplete.
+	SnapshotDependencies(ctx context.Context) (*DependencyGraph, error)
+	// ScanStatus returns the regions of every account/project that could
+	// not be scanned when listing resources, so far
+	ScanStatus() *ScanStatus
 	// CleanupInstances termiantes a list of instances, which is faster
 	// than calling Cleanup() on every individual instance
-	CleanupInstances([]Instance) error
+	CleanupInstances(ctx context.Context, instances []Instance) error
 	// CleanupImages de-registers a list of images
-	CleanupImages([]Image) error
+	CleanupImages(ctx context.Context, images []Image) error
 	// CleanupVolumes deletes a list of volumes
-	CleanupVolumes([]Volume) error
+	CleanupVolumes(ctx context.Context, volumes []Volume) error
 	// CleanupSnapshots delete a list of snapshots
-	CleanupSnapshots([]Snapshot) error
+	CleanupSnapshots(ctx context.Context, snapshots []Snapshot) error
 	// CleanupBuckets deletes the specified buckets
-	CleanupBuckets([]Bucket) error
+	CleanupBuckets(ctx context.Context, buckets []Bucket) error
+	// CleanupTables deletes the specified tables
+	CleanupTables(ctx context.Context, tables []Table) error
+	// CleanupCacheClusters deletes the specified cache clusters
+	CleanupCacheClusters(ctx context.Context, clusters []CacheCluster) error
+	// CleanupAddresses releases the specified addresses
+	CleanupAddresses(ctx context.Context, addresses []Address) error
+	// CleanupNetworkGateways deletes the specified network gateways
+	CleanupNetworkGateways(ctx context.Context, gateways []NetworkGateway) error
+	// CleanupCapacities releases the specified capacities
+	CleanupCapacities(ctx context.Context, capacities []Capacity) error
+	// CleanupDBInstances deletes the specified database instances, after
+	// taking a final snapshot of each
+	CleanupDBInstances(ctx context.Context, instances []DBInstance) error
+	// CleanupDBSnapshots deletes the specified database snapshots
+	CleanupDBSnapshots(ctx context.Context, snapshots []DBSnapshot) error
 }
 
 // Resource represents a generic resource in any CSP. It should be
@@ -73,6 +139,9 @@ type Resource interface {
 	Location() string
 	Public() bool
 	CreationTime() time.Time
+	// Lineage are the IDs of the resources this resource was created
+	// from or is attached to, such as the volume a snapshot was taken of
+	Lineage() []string
 
 	SetTag(key, value string, overwrite bool) error
 	RemoveTag(key string) error
@@ -84,6 +153,20 @@ type Resource interface {
 type Instance interface {
 	Resource
 	InstanceType() string
+	// Running is true if the instance is running, and not stopped
+	Running() bool
+	// Stop will stop the instance, without deleting it
+	Stop() error
+	// KeyName is the name of the key pair used to launch the
+	// instance, it's empty if there is none or in GCP
+	KeyName() string
+	// SecurityGroups are the names of the security groups of the
+	// instance, or its network tags in GCP
+	SecurityGroups() []string
+	// LastInboundTraffic is the last day the instance received any
+	// network traffic. It's only looked up for public instances in AWS,
+	// and is the zero time otherwise.
+	LastInboundTraffic() time.Time
 }
 
 // Image composes the Resource interface, and descibe an image in
@@ -92,6 +175,14 @@ type Image interface {
 	Resource
 	Name() string
 	SizeGB() int64
+	// Family is the image family the image belongs to, such as in
+	// GCP. It's empty if the image is not part of a family.
+	Family() string
+	// SourceImageID and SourceRegion are the image and region the image
+	// was copied from, e.g. by copying an AMI to another region. They're
+	// empty if the image is not a copy, and always in GCP.
+	SourceImageID() string
+	SourceRegion() string
 
 	MakePrivate() error
 }
@@ -104,6 +195,14 @@ type Volume interface {
 	Attached() bool
 	Encrypted() bool
 	VolumeType() string
+	// Regional is true for volumes replicated across zones, such as
+	// GCP regional persistent disks
+	Regional() bool
+	// Iops and ThroughputMBps are the provisioned performance of the
+	// volume, such as for io1 and gp3 volumes in AWS. They are 0 if
+	// the performance isn't provisioned separately from the size.
+	Iops() int64
+	ThroughputMBps() int64
 }
 
 // Snapshot composes the Resource interface, and describe a snapshot
@@ -118,10 +217,111 @@ type Snapshot interface {
 // Bucket represents a bucket in a CSP, such as an S3 bucket in AWS
 type Bucket interface {
 	Resource
+	// LastModified is the last time an object in the bucket was
+	// written, or the creation time of the bucket if it's empty.
+	// It's the same in all CSPs, and is not affected by changes to
+	// the metadata of the bucket or its objects.
 	LastModified() time.Time
 	ObjectCount() int64
 	TotalSizeGB() float64
 	StorageTypeSizesGB() map[string]float64
+	// SizeKnown is false if the size of the bucket couldn't be
+	// determined, in which case it's reported as 0 GB
+	SizeKnown() bool
+}
+
+// Table represents a managed database table in a CSP, such as a
+// DynamoDB table in AWS
+type Table interface {
+	Resource
+	SizeGB() float64
+	ItemCount() int64
+	// LastActivity is the last time the table was read or written
+	LastActivity() time.Time
+}
+
+// CacheCluster represents a managed cache cluster in a CSP, such as an
+// ElastiCache cluster in AWS
+type CacheCluster interface {
+	Resource
+	Engine() string
+	NodeType() string
+	NodeCount() int64
+	// LastActivity is the last time a client connected to the cluster
+	LastActivity() time.Time
+}
+
+// Address represents a reserved external IP address in a CSP, such as
+// a static external IP address in GCP or an Elastic IP address in AWS
+type Address interface {
+	Resource
+	IP() string
+	// InUse is true if the address is attached to a resource, such as
+	// an instance or a load balancer
+	InUse() bool
+}
+
+// NetworkGateway represents a managed network gateway in a CSP that is
+// charged for by the hour, such as a NAT gateway or an interface VPC
+// endpoint in AWS
+type NetworkGateway interface {
+	Resource
+	// GatewayType is the type of the gateway, NATGatewayType or
+	// VPCEndpointType
+	GatewayType() string
+	// Network is the ID of the network the gateway is in, e.g. a VPC
+	Network() string
+	// Zones is the number of zones the gateway is in, each of which
+	// is charged for
+	Zones() int
+	// LastActivity is the last time traffic went through the gateway
+	LastActivity() time.Time
+}
+
+// Capacity represents compute capacity in a CSP that is charged for
+// whether instances use it or not, such as a dedicated host or a capacity
+// reservation in AWS
+type Capacity interface {
+	Resource
+	// CapacityType is the type of the capacity, DedicatedHostType or
+	// CapacityReservationType
+	CapacityType() string
+	// InstanceType is the type of the instances the capacity is for, it
+	// may be empty for dedicated hosts supporting several instance types
+	InstanceType() string
+	// TotalInstances is the number of instances the capacity can hold
+	TotalInstances() int
+	// UsedInstances is the number of instances using the capacity
+	UsedInstances() int
+}
+
+// DBInstance represents a managed database instance in a CSP, such as an
+// RDS instance in AWS
+type DBInstance interface {
+	Resource
+	Engine() string
+	// InstanceClass is the class of the instance, e.g. db.t3.medium
+	InstanceClass() string
+	// StorageGB is the allocated storage of the instance
+	StorageGB() int64
+	// MultiAZ is true if the instance has a standby in another zone,
+	// which doubles the price of the instance
+	MultiAZ() bool
+	// Stopped is true if the instance is stopped, in which case only
+	// its storage is charged for
+	Stopped() bool
+	// LastActivity is the last time a client connected to the instance
+	LastActivity() time.Time
+}
+
+// DBSnapshot represents a manual snapshot of a managed database instance
+// in a CSP, such as an RDS snapshot in AWS
+type DBSnapshot interface {
+	Resource
+	Engine() string
+	// DBInstanceID is the ID of the instance the snapshot was taken of
+	DBInstanceID() string
+	StorageGB() int64
 }
 
 // ResourceCollection encapsulates collections of multiple resources. Does not
@@ -135,14 +335,22 @@ type ResourceCollection struct {
 }
 
 // AllResourceCollection encapsulates collections of all resources,
-// including buckets
+// including buckets, tables, cache clusters, addresses, network gateways,
+// capacities and databases
 type AllResourceCollection struct {
-	Owner     string
-	Instances []Instance
-	Images    []Image
-	Volumes   []Volume
-	Snapshots []Snapshot
-	Buckets   []Bucket
+	Owner           string
+	Instances       []Instance
+	Images          []Image
+	Volumes         []Volume
+	Snapshots       []Snapshot
+	Buckets         []Bucket
+	Tables          []Table
+	CacheClusters   []CacheCluster
+	Addresses       []Address
+	NetworkGateways []NetworkGateway
+	Capacities      []Capacity
+	DBInstances     []DBInstance
+	DBSnapshots     []DBSnapshot
 }
 
 // CSP represent a cloud service provider, such as AWS
@@ -155,53 +363,25 @@ const (
 	GCP CSP = "GCP"
 )
 
+// managerFactories create the resource managers of the CSPs that
+// Cloudsweeper is built with. Support for a CSP is left out of the build
+// with the noaws or nogcp build tag, to avoid depending on its SDK.
+var managerFactories = make(map[CSP]func(accounts []string) (ResourceManager, error))
+
+// registerManager makes a CSP available to NewManager, it's called when
+// the package is initialized
+func registerManager(c CSP, factory func(accounts []string) (ResourceManager, error)) {
+	managerFactories[c] = factory
+}
+
 // NewManager will build a new resource manager for the specified CSP
 func NewManager(c CSP, accounts ...string) (ResourceManager, error) {
-	switch c {
-	case AWS:
-		log.Println("Initializing AWS Resource Manager")
-		manager := &awsResourceManager{
-			accounts: accounts,
-		}
-		return manager, nil
-	case GCP:
-		log.Println("Initializing GCP Resource Manager")
-		client, err := getGCPHttpClient()
-		if err != nil {
-			return nil, err
-		}
-		computeService, err := compute.New(client)
-		if err != nil {
-			return nil, fmt.Errorf("Could not initialize compute service: %s", err)
-		}
-		storageService, err := storage.New(client)
-		if err != nil {
-			return nil, fmt.Errorf("Coult not initialize storage service: %s", err)
-		}
-		manager := &gcpResourceManager{
-			projects: accounts,
-			compute:  computeService,
-			storage:  storageService,
+	factory, ok := managerFactories[c]
+	if !ok {
+		if c == AWS || c == GCP {
+			return nil, fmt.Errorf("Cloudsweeper is built without support for %s", c)
 		}
-		return manager, nil
-	default:
 		return nil, fmt.Errorf("Invalid CSP specified: %s", c)
 	}
-}
-
-func getGCPHttpClient() (*http.Client, error) {
-	credsFile, exist := os.LookupEnv(GcpCredentialsFileKey)
-	if !exist {
-		log.Println("No GCP credentials specified, using default")
-		return oauth2.DefaultClient(context.Background(), scopeGCPCompute, scopeGCPStorage)
-	}
-	creds, err := ioutil.ReadFile(credsFile)
-	if err != nil {
-		return nil, fmt.Errorf("Could not read GCP credentials JSON: %s", err)
-	}
-	conf, err := oauth2.JWTConfigFromJSON(creds, scopeGCPCompute, scopeGCPStorage)
-	if err != nil {
-		return nil, fmt.Errorf("Could not get GCP credentials: %s", err)
-	}
-	return conf.Client(context.Background()), nil
+	return factory(accounts)
 }
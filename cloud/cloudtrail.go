@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudtrail"
+)
+
+// awsCreationEvents are the names of CloudTrail events that create
+// resources handled by Cloudsweeper
+var awsCreationEvents = map[string]bool{
+	"RunInstances":              true,
+	"CreateImage":               true,
+	"RegisterImage":             true,
+	"CopyImage":                 true,
+	"CreateVolume":              true,
+	"CreateSnapshot":            true,
+	"CopySnapshot":              true,
+	"CreateBucket":              true,
+	"CreateTable":               true,
+	"CreateCacheCluster":        true,
+	"CreateReplicationGroup":    true,
+	"AllocateAddress":           true,
+	"CreateNatGateway":          true,
+	"CreateVpcEndpoint":         true,
+	"AllocateHosts":             true,
+	"CreateCapacityReservation": true,
+	"CreateDBInstance":          true,
+	"CreateDBSnapshot":          true,
+	"CopyDBSnapshot":            true,
+}
+
+// LookupAWSCreator looks up the principal that created a resource, such as
+// the ARN of an IAM user or assumed role, in CloudTrail. CloudTrail only
+// keeps the last 90 days of events, so the creator of older resources is
+// not found. An empty principal is returned if it isn't found.
+func LookupAWSCreator(res Resource) (string, error) {
+	if res.CSP() != AWS {
+		return "", nil
+	}
+	sess := NewAWSSession()
+	client := cloudtrail.New(sess, &aws.Config{
+		Credentials: AWSCredentials(sess, res.Owner()),
+		Region:      aws.String(res.Location()),
+	})
+	input := &cloudtrail.LookupEventsInput{
+		LookupAttributes: []*cloudtrail.LookupAttribute{&cloudtrail.LookupAttribute{
+			AttributeKey:   aws.String(cloudtrail.LookupAttributeKeyResourceName),
+			AttributeValue: aws.String(res.ID()),
+		}},
+	}
+	creator := ""
+	err := client.LookupEventsPages(input, func(output *cloudtrail.LookupEventsOutput, lastPage bool) bool {
+		for _, event := range output.Events {
+			if event.EventName == nil || !awsCreationEvents[*event.EventName] {
+				continue
+			}
+			creator = awsEventPrincipal(event)
+			if creator != "" {
+				return false
+			}
+		}
+		return true
+	})
+	return creator, err
+}
+
+// awsEventPrincipal returns the ARN of the principal behind a CloudTrail
+// event, or the username of the event if the ARN is missing
+func awsEventPrincipal(event *cloudtrail.Event) string {
+	if event.CloudTrailEvent != nil {
+		record := struct {
+			UserIdentity struct {
+				ARN string `json:"arn"`
+			} `json:"userIdentity"`
+		}{}
+		err := json.Unmarshal([]byte(*event.CloudTrailEvent), &record)
+		if err == nil && record.UserIdentity.ARN != "" {
+			return record.UserIdentity.ARN
+		}
+	}
+	if event.Username != nil {
+		return *event.Username
+	}
+	return ""
+}
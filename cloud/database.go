@@ -0,0 +1,87 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type baseDBInstance struct {
+	baseResource
+	engine        string
+	instanceClass string
+	storageGB     int64
+	multiAZ       bool
+	stopped       bool
+	lastActivity  time.Time
+}
+
+func (d *baseDBInstance) Engine() string {
+	return d.engine
+}
+
+func (d *baseDBInstance) InstanceClass() string {
+	return d.instanceClass
+}
+
+func (d *baseDBInstance) StorageGB() int64 {
+	return d.storageGB
+}
+
+func (d *baseDBInstance) MultiAZ() bool {
+	return d.multiAZ
+}
+
+func (d *baseDBInstance) Stopped() bool {
+	return d.stopped
+}
+
+func (d *baseDBInstance) LastActivity() time.Time {
+	return d.lastActivity
+}
+
+type baseDBSnapshot struct {
+	baseResource
+	engine       string
+	dbInstanceID string
+	storageGB    int64
+}
+
+func (s *baseDBSnapshot) Engine() string {
+	return s.engine
+}
+
+func (s *baseDBSnapshot) DBInstanceID() string {
+	return s.dbInstanceID
+}
+
+func (s *baseDBSnapshot) StorageGB() int64 {
+	return s.storageGB
+}
+
+func cleanupDBInstances(ctx context.Context, instances []DBInstance) error {
+	resList := []Resource{}
+	for i := range instances {
+		v, ok := instances[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert DBInstance to Resource")
+		}
+		resList = append(resList, v)
+	}
+	return cleanupResources(ctx, resList)
+}
+
+func cleanupDBSnapshots(ctx context.Context, snapshots []DBSnapshot) error {
+	resList := []Resource{}
+	for i := range snapshots {
+		v, ok := snapshots[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert DBSnapshot to Resource")
+		}
+		resList = append(resList, v)
+	}
+	return cleanupResources(ctx, resList)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+// awsFinalDBSnapshotFormat is the ID of the final snapshot taken when an
+// RDS instance is cleaned up, from the ID of the instance and the date
+const awsFinalDBSnapshotFormat = "%s-cloudsweeper-final-%s"
+
+type awsDBInstance struct {
+	baseDBInstance
+	arn string
+}
+
+// Cleanup will delete this RDS instance. A final snapshot is always taken,
+// so that the data can be restored.
+func (d *awsDBInstance) Cleanup() error {
+	log.Printf("Cleaning up database %s in %s", d.ID(), AccountName(d.Owner()))
+	return awsTryWithBackoff(d.cleanup)
+}
+
+func (d *awsDBInstance) cleanup() error {
+	client := rdsClientForAWSResource(d)
+	input := &rds.DeleteDBInstanceInput{
+		DBInstanceIdentifier:      aws.String(d.ID()),
+		FinalDBSnapshotIdentifier: aws.String(fmt.Sprintf(awsFinalDBSnapshotFormat, d.ID(), clock.Now().Format("20060102"))),
+		SkipFinalSnapshot:         aws.Bool(false),
+	}
+	_, err := client.DeleteDBInstance(input)
+	return handleAWSRDSError(err)
+}
+
+func (d *awsDBInstance) SetTag(key, value string, overwrite bool) error {
+	return setAWSRDSTag(d, d.arn, key, value, overwrite)
+}
+
+func (d *awsDBInstance) RemoveTag(key string) error {
+	return removeAWSRDSTag(d, d.arn, key)
+}
+
+type awsDBSnapshot struct {
+	baseDBSnapshot
+	arn string
+}
+
+// Cleanup will delete this RDS snapshot
+func (s *awsDBSnapshot) Cleanup() error {
+	log.Printf("Cleaning up database snapshot %s in %s", s.ID(), AccountName(s.Owner()))
+	return awsTryWithBackoff(s.cleanup)
+}
+
+func (s *awsDBSnapshot) cleanup() error {
+	client := rdsClientForAWSResource(s)
+	input := &rds.DeleteDBSnapshotInput{
+		DBSnapshotIdentifier: aws.String(s.ID()),
+	}
+	_, err := client.DeleteDBSnapshot(input)
+	return handleAWSRDSError(err)
+}
+
+func (s *awsDBSnapshot) SetTag(key, value string, overwrite bool) error {
+	return setAWSRDSTag(s, s.arn, key, value, overwrite)
+}
+
+func (s *awsDBSnapshot) RemoveTag(key string) error {
+	return removeAWSRDSTag(s, s.arn, key)
+}
+
+func handleAWSRDSError(err error) error {
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func setAWSRDSTag(res Resource, arn, key, value string, overwrite bool) error {
+	if _, exist := res.Tags()[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, res.ID())
+	}
+	client := rdsClientForAWSResource(res)
+	input := &rds.AddTagsToResourceInput{
+		ResourceName: aws.String(arn),
+		Tags: []*rds.Tag{&rds.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		}},
+	}
+	_, err := client.AddTagsToResource(input)
+	return err
+}
+
+func removeAWSRDSTag(res Resource, arn, key string) error {
+	if _, exist := res.Tags()[key]; !exist {
+		return nil
+	}
+	client := rdsClientForAWSResource(res)
+	input := &rds.RemoveTagsFromResourceInput{
+		ResourceName: aws.String(arn),
+		TagKeys:      aws.StringSlice([]string{key}),
+	}
+	_, err := client.RemoveTagsFromResource(input)
+	return err
+}
+
+func rdsClientForAWSResource(res Resource) *rds.RDS {
+	sess := NewAWSSession()
+	creds := AWSCredentials(sess, res.Owner())
+	return rds.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(res.Location()),
+	})
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+// gbDivider converts sizes in bytes to GB
+const gbDivider = 1024.0 * 1024.0 * 1024.0
+
+// DataSizeGB returns the size of the data stored in a resource, which is
+// destroyed when it's cleaned up. Only volumes, snapshots, buckets,
+// tables and database snapshots hold data. Images are not counted, since
+// their data is held by snapshots, and instances only hold data in their
+// volumes. Database instances are not counted either, since a final
+// snapshot is taken when they're cleaned up.
+func DataSizeGB(res Resource) float64 {
+	switch res := res.(type) {
+	case Volume:
+		return float64(res.SizeGB())
+	case Snapshot:
+		return float64(res.SizeGB())
+	case Bucket:
+		return res.TotalSizeGB()
+	case Table:
+		return res.SizeGB()
+	case DBSnapshot:
+		return float64(res.StorageGB())
+	default:
+		return 0
+	}
+}
+
+// CollectionDataSizeGB returns the total size of the data stored in the
+// resources of a collection, see DataSizeGB
+func CollectionDataSizeGB(collection *AllResourceCollection) float64 {
+	total := 0.0
+	for _, vol := range collection.Volumes {
+		total += DataSizeGB(vol)
+	}
+	for _, snap := range collection.Snapshots {
+		total += DataSizeGB(snap)
+	}
+	for _, buck := range collection.Buckets {
+		total += DataSizeGB(buck)
+	}
+	for _, table := range collection.Tables {
+		total += DataSizeGB(table)
+	}
+	for _, snap := range collection.DBSnapshots {
+		total += DataSizeGB(snap)
+	}
+	return total
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// DelegatePollInterval is how often a delegated cleanup is polled
+	// for completion
+	DelegatePollInterval = 15 * time.Second
+	// DelegateTimeout is the maximum time spent waiting for a delegated
+	// cleanup to finish
+	DelegateTimeout = time.Hour
+)
+
+// CleanupDelegate cleans up resources on behalf of Cloudsweeper, such as
+// an SSM Automation runbook in AWS or a workflow in GCP. It's used where
+// Cloudsweeper isn't allowed to delete resources itself.
+type CleanupDelegate interface {
+	// Start starts cleaning up the resources in the manifest, which all
+	// belong to the specified account/project, and returns the ID of the
+	// execution
+	Start(ctx context.Context, account string, manifest []ManifestEntry) (string, error)
+	// Wait waits until an execution has finished, and returns an error
+	// if it didn't succeed. It stops waiting once ctx is done, but the
+	// execution isn't stopped.
+	Wait(ctx context.Context, account, execution string) error
+}
+
+// ManifestEntry describes a resource to clean up. The manifest is passed
+// to the delegate as a JSON list of entries.
+type ManifestEntry struct {
+	// Kind is e.g. instance, volume or nat-gateway
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Location string `json:"location"`
+}
+
+// manifestKind returns the kind of a resource in a manifest
+func manifestKind(res Resource) string {
+	switch r := res.(type) {
+	case Instance:
+		return "instance"
+	case Image:
+		return "image"
+	case Volume:
+		return "volume"
+	case Snapshot:
+		return "snapshot"
+	case Bucket:
+		return "bucket"
+	case Table:
+		return "table"
+	case CacheCluster:
+		return "cache-cluster"
+	case Address:
+		return "address"
+	case NetworkGateway:
+		return r.GatewayType()
+	case Capacity:
+		return r.CapacityType()
+	case DBInstance:
+		return "db-instance"
+	case DBSnapshot:
+		return "db-snapshot"
+	default:
+		return "unknown"
+	}
+}
+
+// delegatingResourceManager wraps another ResourceManager, and hands
+// all cleanups to a CleanupDelegate instead of deleting the resources.
+// All other calls are passed on to the wrapped manager.
+type delegatingResourceManager struct {
+	ResourceManager
+	delegate CleanupDelegate
+}
+
+// NewDelegatingManager returns a ResourceManager whose Cleanup methods
+// start the delegate with a manifest of the resources, and wait for it to
+// finish, so resources are still cleaned up in the order of their
+// dependencies. If the delegate fails, all resources in the manifest are
+// considered failed, and they are not retried.
+func NewDelegatingManager(mngr ResourceManager, delegate CleanupDelegate) ResourceManager {
+	return &delegatingResourceManager{ResourceManager: mngr, delegate: delegate}
+}
+
+func (m *delegatingResourceManager) CleanupInstances(ctx context.Context, instances []Instance) error {
+	resources := []Resource{}
+	for _, res := range instances {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupImages(ctx context.Context, images []Image) error {
+	resources := []Resource{}
+	for _, res := range images {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupVolumes(ctx context.Context, volumes []Volume) error {
+	resources := []Resource{}
+	for _, res := range volumes {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupSnapshots(ctx context.Context, snapshots []Snapshot) error {
+	resources := []Resource{}
+	for _, res := range snapshots {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupBuckets(ctx context.Context, buckets []Bucket) error {
+	resources := []Resource{}
+	for _, res := range buckets {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupTables(ctx context.Context, tables []Table) error {
+	resources := []Resource{}
+	for _, res := range tables {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupCacheClusters(ctx context.Context, clusters []CacheCluster) error {
+	resources := []Resource{}
+	for _, res := range clusters {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupAddresses(ctx context.Context, addresses []Address) error {
+	resources := []Resource{}
+	for _, res := range addresses {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupNetworkGateways(ctx context.Context, gateways []NetworkGateway) error {
+	resources := []Resource{}
+	for _, res := range gateways {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupCapacities(ctx context.Context, capacities []Capacity) error {
+	resources := []Resource{}
+	for _, res := range capacities {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupDBInstances(ctx context.Context, instances []DBInstance) error {
+	resources := []Resource{}
+	for _, res := range instances {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+func (m *delegatingResourceManager) CleanupDBSnapshots(ctx context.Context, snapshots []DBSnapshot) error {
+	resources := []Resource{}
+	for _, res := range snapshots {
+		resources = append(resources, res)
+	}
+	return m.cleanup(ctx, resources)
+}
+
+// cleanup starts one execution of the delegate per account, and waits
+// for all of them to finish
+func (m *delegatingResourceManager) cleanup(ctx context.Context, resources []Resource) error {
+	manifests := make(map[string][]ManifestEntry)
+	for _, res := range resources {
+		manifests[res.Owner()] = append(manifests[res.Owner()], ManifestEntry{
+			Kind:     manifestKind(res),
+			ID:       res.ID(),
+			Location: res.Location(),
+		})
+	}
+	accounts := []string{}
+	for account := range manifests {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	executions := make(map[string]string)
+	failures := []string{}
+	for _, account := range accounts {
+		execution, err := m.delegate.Start(ctx, account, manifests[account])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: could not start cleanup: %s", account, err))
+			continue
+		}
+		log.Printf("Started cleanup of %d resources in %s as %s\n", len(manifests[account]), AccountName(account), execution)
+		executions[account] = execution
+	}
+	for _, account := range accounts {
+		execution, started := executions[account]
+		if !started {
+			continue
+		}
+		if err := m.delegate.Wait(ctx, account, execution); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: cleanup %s failed: %s", account, execution, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("Delegated cleanup failed:\n%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
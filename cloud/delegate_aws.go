@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// ssmManifestParameter is the parameter of the automation document that
+// the manifest is passed in
+const ssmManifestParameter = "Manifest"
+
+// ssmAutomationDelegate cleans up resources by starting an SSM Automation
+// document in the account of the resources
+type ssmAutomationDelegate struct {
+	sess     *session.Session
+	document string
+	region   string
+}
+
+// NewSSMAutomationDelegate returns a CleanupDelegate that starts the
+// specified SSM Automation document in the specified region of each
+// account, with the manifest as JSON in its Manifest parameter
+func NewSSMAutomationDelegate(document, region string) (CleanupDelegate, error) {
+	return &ssmAutomationDelegate{
+		sess:     NewAWSSession(),
+		document: document,
+		region:   region,
+	}, nil
+}
+
+func (d *ssmAutomationDelegate) client(account string) *ssm.SSM {
+	return ssm.New(d.sess, &aws.Config{
+		Credentials: AWSCredentials(d.sess, account),
+		Region:      aws.String(d.region),
+	})
+}
+
+func (d *ssmAutomationDelegate) Start(ctx context.Context, account string, manifest []ManifestEntry) (string, error) {
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	output, err := d.client(account).StartAutomationExecutionWithContext(ctx, &ssm.StartAutomationExecutionInput{
+		DocumentName: aws.String(d.document),
+		Parameters: map[string][]*string{
+			ssmManifestParameter: aws.StringSlice([]string{string(raw)}),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.AutomationExecutionId), nil
+}
+
+func (d *ssmAutomationDelegate) Wait(ctx context.Context, account, execution string) error {
+	client := d.client(account)
+	deadline := time.Now().Add(DelegateTimeout)
+	for {
+		output, err := client.GetAutomationExecutionWithContext(ctx, &ssm.GetAutomationExecutionInput{
+			AutomationExecutionId: aws.String(execution),
+		})
+		if err != nil {
+			return err
+		}
+		status := aws.StringValue(output.AutomationExecution.AutomationExecutionStatus)
+		switch status {
+		case ssm.AutomationExecutionStatusSuccess:
+			return nil
+		case ssm.AutomationExecutionStatusFailed, ssm.AutomationExecutionStatusTimedOut, ssm.AutomationExecutionStatusCancelled:
+			return fmt.Errorf("automation ended with status %s: %s", status, aws.StringValue(output.AutomationExecution.FailureMessage))
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("automation still has status %s after %s", status, DelegateTimeout)
+		}
+		select {
+		case <-time.After(DelegatePollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
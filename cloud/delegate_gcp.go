@@ -0,0 +1,98 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	workflowexecutions "google.golang.org/api/workflowexecutions/v1"
+)
+
+const (
+	gcpExecutionSucceeded = "SUCCEEDED"
+	gcpExecutionFailed    = "FAILED"
+	gcpExecutionCancelled = "CANCELLED"
+)
+
+// gcpWorkflowArgument is the argument a workflow is executed with
+type gcpWorkflowArgument struct {
+	Project  string          `json:"project"`
+	Manifest []ManifestEntry `json:"manifest"`
+}
+
+// gcpWorkflowsDelegate cleans up resources by executing a workflow in the
+// project of the resources
+type gcpWorkflowsDelegate struct {
+	executions *workflowexecutions.Service
+	workflow   string
+	location   string
+}
+
+// NewWorkflowsDelegate returns a CleanupDelegate that executes the
+// specified workflow in the specified location of each project, with an
+// argument holding the project and the manifest
+func NewWorkflowsDelegate(workflow, location string) (CleanupDelegate, error) {
+	client, err := getGCPHttpClient(scopeGCPCloud)
+	if err != nil {
+		return nil, err
+	}
+	executions, err := workflowexecutions.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize workflow executions service: %s", err)
+	}
+	return &gcpWorkflowsDelegate{
+		executions: executions,
+		workflow:   workflow,
+		location:   location,
+	}, nil
+}
+
+func (d *gcpWorkflowsDelegate) Start(ctx context.Context, project string, manifest []ManifestEntry) (string, error) {
+	raw, err := json.Marshal(gcpWorkflowArgument{Project: project, Manifest: manifest})
+	if err != nil {
+		return "", err
+	}
+	parent := fmt.Sprintf("projects/%s/locations/%s/workflows/%s", project, d.location, d.workflow)
+	execution, err := d.executions.Projects.Locations.Workflows.Executions.Create(parent, &workflowexecutions.Execution{
+		Argument: string(raw),
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return execution.Name, nil
+}
+
+func (d *gcpWorkflowsDelegate) Wait(ctx context.Context, project, execution string) error {
+	deadline := time.Now().Add(DelegateTimeout)
+	for {
+		result, err := d.executions.Projects.Locations.Workflows.Executions.Get(execution).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		switch result.State {
+		case gcpExecutionSucceeded:
+			return nil
+		case gcpExecutionFailed, gcpExecutionCancelled:
+			message := ""
+			if result.Error != nil {
+				message = result.Error.Payload
+			}
+			return fmt.Errorf("workflow ended with state %s: %s", result.State, message)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("workflow still has state %s after %s", result.State, DelegateTimeout)
+		}
+		select {
+		case <-time.After(DelegatePollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
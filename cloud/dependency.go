@@ -0,0 +1,32 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+// DependencyGraph records which resources depend on other resources across
+// all accounts/projects, such as the images registered from a snapshot and
+// the volumes created from it. Cleaning up a resource that others depend
+// on either fails or breaks their restore chain.
+type DependencyGraph struct {
+	dependents map[string][]Resource
+}
+
+// NewDependencyGraph returns an empty dependency graph
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{dependents: make(map[string][]Resource)}
+}
+
+// AddDependency records that dependent depends on the resource with the
+// specified ID, which may be in another account/project
+func (g *DependencyGraph) AddDependency(id string, dependent Resource) {
+	g.dependents[id] = append(g.dependents[id], dependent)
+}
+
+// Dependents returns the resources that depend on the resource with the
+// specified ID. A nil graph has no dependencies.
+func (g *DependencyGraph) Dependents(id string) []Resource {
+	if g == nil {
+		return nil
+	}
+	return g.dependents[id]
+}
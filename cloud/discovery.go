@@ -0,0 +1,47 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+)
+
+// activeAccountStatus is the status of accounts and projects that are in
+// use, in both AWS Organizations and the GCP Resource Manager
+const activeAccountStatus = "ACTIVE"
+
+// DiscoveredAccount is an account in AWS Organizations, or a project in
+// the GCP Resource Manager
+type DiscoveredAccount struct {
+	ID   string
+	Name string
+	// Status is e.g. ACTIVE, SUSPENDED or PENDING_CLOSURE in AWS, and
+	// ACTIVE or DELETE_REQUESTED in GCP
+	Status string
+	// Owner is the value of the owner tag or label of the account, if any
+	Owner string
+}
+
+// Active checks if an account is in use, rather than being closed or
+// deleted
+func (a *DiscoveredAccount) Active() bool {
+	return a.Status == activeAccountStatus
+}
+
+// DiscoverAccounts lists all accounts in AWS Organizations, or all projects
+// the GCP credentials can see. In AWS, the role in managementAccount is
+// assumed if it's set, since only the management account of the
+// organization can list its accounts. The owner of each account is read
+// from its tag or label ownerKey, if it's set.
+func DiscoverAccounts(ctx context.Context, csp CSP, managementAccount, ownerKey string) ([]*DiscoveredAccount, error) {
+	switch csp {
+	case AWS:
+		return discoverAWSAccounts(ctx, managementAccount, ownerKey)
+	case GCP:
+		return discoverGCPProjects(ctx, ownerKey)
+	default:
+		return nil, fmt.Errorf("Unknown CSP %s", csp)
+	}
+}
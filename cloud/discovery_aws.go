@@ -0,0 +1,56 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/organizations"
+)
+
+func discoverAWSAccounts(ctx context.Context, managementAccount, ownerKey string) ([]*DiscoveredAccount, error) {
+	sess := NewAWSSession()
+	config := &aws.Config{Region: aws.String(defaultAWSRegion)}
+	if managementAccount != "" {
+		config.Credentials = AWSCredentials(sess, managementAccount)
+	}
+	client := organizations.New(sess, config)
+	accounts := []*DiscoveredAccount{}
+	err := client.ListAccountsPagesWithContext(ctx, &organizations.ListAccountsInput{}, func(page *organizations.ListAccountsOutput, lastPage bool) bool {
+		for _, account := range page.Accounts {
+			accounts = append(accounts, &DiscoveredAccount{
+				ID:     aws.StringValue(account.Id),
+				Name:   aws.StringValue(account.Name),
+				Status: aws.StringValue(account.Status),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not list accounts in AWS Organizations: %s", err)
+	}
+	if ownerKey == "" {
+		return accounts, nil
+	}
+	for _, account := range accounts {
+		input := &organizations.ListTagsForResourceInput{ResourceId: aws.String(account.ID)}
+		err := client.ListTagsForResourcePagesWithContext(ctx, input, func(page *organizations.ListTagsForResourceOutput, lastPage bool) bool {
+			for _, tag := range page.Tags {
+				if aws.StringValue(tag.Key) == ownerKey {
+					account.Owner = aws.StringValue(tag.Value)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Could not list tags of account %s: %s", account.ID, err)
+		}
+	}
+	return accounts, nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+
+	cloudresourcemanager "google.golang.org/api/cloudresourcemanager/v1"
+)
+
+func discoverGCPProjects(ctx context.Context, ownerKey string) ([]*DiscoveredAccount, error) {
+	client, err := getGCPHttpClient(scopeGCPCloud)
+	if err != nil {
+		return nil, err
+	}
+	service, err := cloudresourcemanager.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize resource manager service: %s", err)
+	}
+	projects := []*DiscoveredAccount{}
+	err = service.Projects.List().Pages(ctx, func(page *cloudresourcemanager.ListProjectsResponse) error {
+		for _, project := range page.Projects {
+			discovered := &DiscoveredAccount{
+				ID:     project.ProjectId,
+				Name:   project.Name,
+				Status: project.LifecycleState,
+			}
+			if ownerKey != "" {
+				discovered.Owner = project.Labels[ownerKey]
+			}
+			projects = append(projects, discovered)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not list projects: %s", err)
+	}
+	return projects, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// regionPlaceholder is replaced by the region of a call in the URL of a
+// custom AWS endpoint
+const regionPlaceholder = "{region}"
+
+// AWSSTSRegion is the region whose STS endpoint is used for calls that
+// aren't made in a specific region, such as assuming roles. Regional STS
+// endpoints are used in all regions when it's set, otherwise the global
+// STS endpoint is used.
+var AWSSTSRegion = ""
+
+// AWSEndpoints are custom endpoint URLs, such as VPC endpoints, by the ID
+// of the AWS service, e.g. "sts", "ec2" or "s3". If the URL contains
+// {region}, it's replaced by the region of the call.
+var AWSEndpoints = map[string]string{}
+
+// ParseAWSEndpoints parses a list of custom endpoints on the form
+// <service>=<URL>
+func ParseAWSEndpoints(list []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range list {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid endpoint %q, must be <service>=<URL>", item)
+		}
+		endpoint, err := url.Parse(parts[1])
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("Invalid URL of %s endpoint: %q", parts[0], parts[1])
+		}
+		result[strings.ToLower(parts[0])] = parts[1]
+	}
+	return result, nil
+}
+
+// SetProxy sends all HTTP requests, to AWS, GCP and any other service,
+// through the proxy with the specified URL. It must be called before any
+// client is created. Without it, the proxy is taken from the HTTPS_PROXY
+// and NO_PROXY environment variables as usual.
+func SetProxy(proxyURL string) error {
+	proxy, err := url.Parse(proxyURL)
+	if err != nil || proxy.Host == "" {
+		return fmt.Errorf("Invalid proxy URL %q", proxyURL)
+	}
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return errors.New("Default HTTP transport has been replaced, can't set proxy")
+	}
+	transport.Proxy = http.ProxyURL(proxy)
+	return nil
+}
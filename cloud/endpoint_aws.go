@@ -0,0 +1,64 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// NewAWSSession returns a session using the configured STS region and
+// custom endpoints, whose requests are rate limited by AWSRequestsPerSecond
+// and counted, see APICalls. All AWS clients should be created from such
+// a session.
+func NewAWSSession() *session.Session {
+	config := aws.Config{}
+	if AWSSTSRegion != "" {
+		config.Region = aws.String(AWSSTSRegion)
+		config.STSRegionalEndpoint = endpoints.RegionalSTSEndpoint
+	}
+	if len(AWSEndpoints) > 0 {
+		config.EndpointResolver = endpoints.ResolverFunc(resolveAWSEndpoint)
+	}
+	sess := session.Must(session.NewSessionWithOptions(session.Options{Config: config}))
+	sess.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: "cloudsweeper.RateLimit",
+		Fn: func(r *request.Request) {
+			// Once the context is done, the request fails with it anyway
+			waitForAWSRequest(r.Context())
+		},
+	})
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "cloudsweeper.CountCalls",
+		Fn: func(r *request.Request) {
+			recordAPICall(r.ClientInfo.ServiceName, r.RetryCount)
+		},
+	})
+	return sess
+}
+
+// resolveAWSEndpoint resolves custom endpoints, and falls back to the
+// default endpoints of services without one
+func resolveAWSEndpoint(service, region string, opts ...func(*endpoints.Options)) (endpoints.ResolvedEndpoint, error) {
+	endpoint, ok := AWSEndpoints[service]
+	if !ok {
+		return endpoints.DefaultResolver().EndpointFor(service, region, opts...)
+	}
+	// Global endpoints, such as those of IAM and STS, are signed for us-east-1
+	signingRegion := region
+	if signingRegion == "" || signingRegion == "aws-global" {
+		signingRegion = "us-east-1"
+	}
+	return endpoints.ResolvedEndpoint{
+		URL:           strings.Replace(endpoint, regionPlaceholder, region, -1),
+		SigningRegion: signingRegion,
+	}, nil
+}
@@ -17,7 +17,16 @@ func New() *ResourceFilter {
 		snapshotRules: []func(cloud.Snapshot) bool{},
 		bucketRules:   []func(cloud.Bucket) bool{},
 
+		tableRules:        []func(cloud.Table) bool{},
+		cacheClusterRules: []func(cloud.CacheCluster) bool{},
+		addressRules:      []func(cloud.Address) bool{},
+		gatewayRules:      []func(cloud.NetworkGateway) bool{},
+		capacityRules:     []func(cloud.Capacity) bool{},
+		dbInstanceRules:   []func(cloud.DBInstance) bool{},
+		dbSnapshotRules:   []func(cloud.DBSnapshot) bool{},
+
 		OverrideWhitelist: false,
+		OverrideSnooze:    false,
 	}
 }
 
@@ -32,7 +41,17 @@ type ResourceFilter struct {
 	snapshotRules []func(cloud.Snapshot) bool
 	bucketRules   []func(cloud.Bucket) bool
 
+	tableRules        []func(cloud.Table) bool
+	cacheClusterRules []func(cloud.CacheCluster) bool
+	addressRules      []func(cloud.Address) bool
+	gatewayRules      []func(cloud.NetworkGateway) bool
+	capacityRules     []func(cloud.Capacity) bool
+	dbInstanceRules   []func(cloud.DBInstance) bool
+	dbSnapshotRules   []func(cloud.DBSnapshot) bool
+
 	OverrideWhitelist bool
+	// OverrideSnooze includes snoozed resources, see SnoozeTagKey
+	OverrideSnooze bool
 }
 
 // AddGeneralRule adds a generic resource rule, which is not specific to
@@ -66,6 +85,43 @@ func (f *ResourceFilter) AddBucketRule(rule func(cloud.Bucket) bool) {
 	f.bucketRules = append(f.bucketRules, rule)
 }
 
+// AddTableRule adds a table specific rule to the filter chain
+func (f *ResourceFilter) AddTableRule(rule func(cloud.Table) bool) {
+	f.tableRules = append(f.tableRules, rule)
+}
+
+// AddCacheClusterRule adds a cache cluster specific rule to the filter chain
+func (f *ResourceFilter) AddCacheClusterRule(rule func(cloud.CacheCluster) bool) {
+	f.cacheClusterRules = append(f.cacheClusterRules, rule)
+}
+
+// AddAddressRule adds an address specific rule to the filter chain
+func (f *ResourceFilter) AddAddressRule(rule func(cloud.Address) bool) {
+	f.addressRules = append(f.addressRules, rule)
+}
+
+// AddNetworkGatewayRule adds a network gateway specific rule to the filter chain
+func (f *ResourceFilter) AddNetworkGatewayRule(rule func(cloud.NetworkGateway) bool) {
+	f.gatewayRules = append(f.gatewayRules, rule)
+}
+
+// AddCapacityRule adds a capacity specific rule to the filter chain
+func (f *ResourceFilter) AddCapacityRule(rule func(cloud.Capacity) bool) {
+	f.capacityRules = append(f.capacityRules, rule)
+}
+
+// AddDBInstanceRule adds a database instance specific rule to the filter
+// chain
+func (f *ResourceFilter) AddDBInstanceRule(rule func(cloud.DBInstance) bool) {
+	f.dbInstanceRules = append(f.dbInstanceRules, rule)
+}
+
+// AddDBSnapshotRule adds a database snapshot specific rule to the filter
+// chain
+func (f *ResourceFilter) AddDBSnapshotRule(rule func(cloud.DBSnapshot) bool) {
+	f.dbSnapshotRules = append(f.dbSnapshotRules, rule)
+}
+
 // Instances will filter the specified instances using the specified filters and
 // return the instances which match. A boolean OR is performed between every specified
 // filter.
@@ -130,3 +186,94 @@ func Buckets(buckets []cloud.Bucket, filters ...*ResourceFilter) []cloud.Bucket
 	}
 	return resultList
 }
+
+// Tables will filter the specified tables using the specified filters and
+// return the tables which match. A boolean OR is performed between every specified
+// filter.
+func Tables(tables []cloud.Table, filters ...*ResourceFilter) []cloud.Table {
+	resultList := []cloud.Table{}
+	for i := range tables {
+		if or(tables[i], filters) {
+			resultList = append(resultList, tables[i])
+		}
+	}
+	return resultList
+}
+
+// CacheClusters will filter the specified cache clusters using the specified
+// filters and return the cache clusters which match. A boolean OR is performed
+// between every specified filter.
+func CacheClusters(clusters []cloud.CacheCluster, filters ...*ResourceFilter) []cloud.CacheCluster {
+	resultList := []cloud.CacheCluster{}
+	for i := range clusters {
+		if or(clusters[i], filters) {
+			resultList = append(resultList, clusters[i])
+		}
+	}
+	return resultList
+}
+
+// Addresses will filter the specified addresses using the specified filters
+// and return the addresses which match. A boolean OR is performed between
+// every specified filter.
+func Addresses(addresses []cloud.Address, filters ...*ResourceFilter) []cloud.Address {
+	resultList := []cloud.Address{}
+	for i := range addresses {
+		if or(addresses[i], filters) {
+			resultList = append(resultList, addresses[i])
+		}
+	}
+	return resultList
+}
+
+// NetworkGateways will filter the specified network gateways using the
+// specified filters and return the gateways which match. A boolean OR is
+// performed between every specified filter.
+func NetworkGateways(gateways []cloud.NetworkGateway, filters ...*ResourceFilter) []cloud.NetworkGateway {
+	resultList := []cloud.NetworkGateway{}
+	for i := range gateways {
+		if or(gateways[i], filters) {
+			resultList = append(resultList, gateways[i])
+		}
+	}
+	return resultList
+}
+
+// Capacities will filter the specified capacities using the specified
+// filters and return the capacities which match. A boolean OR is performed
+// between every specified filter.
+func Capacities(capacities []cloud.Capacity, filters ...*ResourceFilter) []cloud.Capacity {
+	resultList := []cloud.Capacity{}
+	for i := range capacities {
+		if or(capacities[i], filters) {
+			resultList = append(resultList, capacities[i])
+		}
+	}
+	return resultList
+}
+
+// DBInstances will filter the specified database instances using the
+// specified filters and return the instances which match. A boolean OR is
+// performed between every specified filter.
+func DBInstances(instances []cloud.DBInstance, filters ...*ResourceFilter) []cloud.DBInstance {
+	resultList := []cloud.DBInstance{}
+	for i := range instances {
+		if or(instances[i], filters) {
+			resultList = append(resultList, instances[i])
+		}
+	}
+	return resultList
+}
+
+// DBSnapshots will filter the specified database snapshots using the
+// specified filters and return the snapshots which match. A boolean OR is
+// performed between every specified filter.
+func DBSnapshots(snapshots []cloud.DBSnapshot, filters ...*ResourceFilter) []cloud.DBSnapshot {
+	resultList := []cloud.DBSnapshot{}
+	for i := range snapshots {
+		if or(snapshots[i], filters) {
+			resultList = append(resultList, snapshots[i])
+		}
+	}
+	return resultList
+}
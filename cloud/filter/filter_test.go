@@ -41,13 +41,41 @@ func TestAddingFilters(t *testing.T) {
 
 type testInstance struct {
 	testResource
-	instType string
+	instType    string
+	running     bool
+	groups      []string
+	public      bool
+	lastInbound time.Time
 }
 
 func (i *testInstance) InstanceType() string {
 	return i.instType
 }
 
+func (i *testInstance) Running() bool {
+	return i.running
+}
+
+func (i *testInstance) Stop() error {
+	return nil
+}
+
+func (i *testInstance) KeyName() string {
+	return ""
+}
+
+func (i *testInstance) SecurityGroups() []string {
+	return i.groups
+}
+
+func (i *testInstance) Public() bool {
+	return i.public
+}
+
+func (i *testInstance) LastInboundTraffic() time.Time {
+	return i.lastInbound
+}
+
 // Testing using a single filter and multiple filters for the same
 // resource type is identical for all instance types, so the tests
 // here only do cloud.Instance, but should cover all resource types.
@@ -92,13 +120,43 @@ func TestMultipleInstanceFilter(t *testing.T) {
 	}
 }
 
+func TestSnoozedInstanceFilter(t *testing.T) {
+	inst1 := &testInstance{}
+	inst1.creationTime = time.Now().AddDate(0, 0, -5)
+	inst1.tags = map[string]string{SnoozeTagKey: time.Now().AddDate(0, 0, 2).Format(ExpiryTagValueFormat)}
+	inst2 := &testInstance{}
+	inst2.creationTime = time.Now().AddDate(0, 0, -5)
+	inst2.tags = map[string]string{SnoozeTagKey: time.Now().AddDate(0, 0, -1).Format(ExpiryTagValueFormat)}
+	inst3 := &testInstance{}
+	inst3.creationTime = time.Now().AddDate(0, 0, -5)
+	inst3.tags = map[string]string{SnoozeTagKey: "next week"}
+
+	fil := New()
+	fil.AddGeneralRule(OlderThanXDays(2))
+
+	filtered := Instances([]cloud.Instance{inst1, inst2, inst3}, fil)
+	if len(filtered) != 2 || filtered[0] != inst2 || filtered[1] != inst3 {
+		t.Error("Snoozed instance not excluded, or expired snooze not included")
+	}
+
+	fil.OverrideSnooze = true
+	filtered = Instances([]cloud.Instance{inst1, inst2, inst3}, fil)
+	if len(filtered) != 3 {
+		t.Error("Snoozed instance not included when overriding snooze")
+	}
+}
+
 type testImg struct {
 	testResource
+	sourceRegion string
 }
 
-func (i *testImg) Name() string       { return "test-img" }
-func (i *testImg) SizeGB() int64      { return 10 }
-func (i *testImg) MakePrivate() error { return nil }
+func (i *testImg) Name() string          { return "test-img" }
+func (i *testImg) SizeGB() int64         { return 10 }
+func (i *testImg) Family() string        { return "" }
+func (i *testImg) SourceImageID() string { return "" }
+func (i *testImg) SourceRegion() string  { return i.sourceRegion }
+func (i *testImg) MakePrivate() error    { return nil }
 
 // This will test the filters being used when marking resources for
 // cleanup. These are:
@@ -4,22 +4,199 @@
 package filter
 
 import (
+	"fmt"
+	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 )
 
-// IsWhitelisted checks if the given resource has a whitelisting tag
+// IsWhitelisted checks if the given resource has a whitelisting tag,
+// which hasn't expired, and has been approved if the resource is
+// expensive enough for that, see WhitelistApprovers
 func IsWhitelisted(resource cloud.Resource) bool {
-	for key := range resource.Tags() {
-		if strings.Replace(strings.ToLower(key), "_", "-", -1) == WhitelistTagKey {
+	_, exist := whitelistTag(resource)
+	return exist && !WhitelistExpired(resource) && !needsWhitelistApproval(resource)
+}
+
+// WhitelistPendingApproval checks if the given resource has a whitelisting
+// tag, which is ignored until it's approved by one of the WhitelistApprovers
+func WhitelistPendingApproval(resource cloud.Resource) bool {
+	_, exist := whitelistTag(resource)
+	return exist && !WhitelistExpired(resource) && needsWhitelistApproval(resource)
+}
+
+// WhitelistExpiry returns the date the whitelisting of a resource expires,
+// and whether it expires at all. A whitelisting expires if the value of
+// its tag is a date (YYYY-MM-DD), other values never expire.
+func WhitelistExpiry(resource cloud.Resource) (time.Time, bool) {
+	value, exist := whitelistTag(resource)
+	if !exist {
+		return time.Time{}, false
+	}
+	expiry, err := time.Parse(ExpiryTagValueFormat, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiry, true
+}
+
+// WhitelistExpired checks if the whitelisting of a resource has expired,
+// after which it's handled as if it wasn't whitelisted
+func WhitelistExpired(resource cloud.Resource) bool {
+	expiry, expires := WhitelistExpiry(resource)
+	return expires && !clock.Now().Before(expiry)
+}
+
+// WhitelistedSince returns when a resource was last whitelisted, see
+// WhitelistedAtTagKey, or when it was created if that isn't known
+func WhitelistedSince(resource cloud.Resource) time.Time {
+	value, exist := resource.Tags()[WhitelistedAtTagKey]
+	if !exist {
+		return resource.CreationTime()
+	}
+	whitelistedAt, err := time.Parse(ExpiryTagValueFormat, value)
+	if err != nil {
+		log.Printf("%s has malformed whitelisted-at tag: %s\n", resource.ID(), value)
+		return resource.CreationTime()
+	}
+	return whitelistedAt
+}
+
+// WhitelistApprover returns the username of the approver of the
+// whitelisting of a resource, or an empty string if it has none
+func WhitelistApprover(resource cloud.Resource) string {
+	value, _ := normalizedTag(resource, WhitelistApproverTagKey)
+	return strings.TrimSpace(value)
+}
+
+// whitelistTag returns the value of the whitelisting tag of a resource,
+// and whether it has one
+func whitelistTag(resource cloud.Resource) (string, bool) {
+	return normalizedTag(resource, WhitelistTagKey)
+}
+
+// normalizedTag returns the value of the tag of a resource with the
+// specified canonical key, whose key may not be canonical itself, such as
+// Cloudsweeper_Whitelisted, and whether it has one
+func normalizedTag(resource cloud.Resource, canonicalKey string) (string, bool) {
+	for key, value := range resource.Tags() {
+		if normalizeTagKey(key) == canonicalKey {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// needsWhitelistApproval checks if whitelisting a resource must be
+// approved, and its approver isn't one of the WhitelistApprovers. Whitelist
+// tags whose value is the username of an approver, from before approvers
+// had a tag of their own, are still approved.
+func needsWhitelistApproval(resource cloud.Resource) bool {
+	if len(WhitelistApprovers) == 0 || ResourceCostPerMonth == nil || ResourceCostPerMonth(resource) <= WhitelistApprovalCostPerMonth {
+		return false
+	}
+	value, _ := whitelistTag(resource)
+	for _, approver := range WhitelistApprovers {
+		if strings.EqualFold(WhitelistApprover(resource), approver) || strings.EqualFold(strings.TrimSpace(value), approver) {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxLifetimeEnd returns when the maximum lifetime of a resource ends, and
+// whether there is one in its account, see MaxLifetimeDays. The lifetime
+// starts when the resource was created, or when it was last whitelisted.
+func MaxLifetimeEnd(resource cloud.Resource) (time.Time, bool) {
+	if MaxLifetimeDays <= 0 || !maxLifetimeApplies(resource.Owner()) {
+		return time.Time{}, false
+	}
+	start := resource.CreationTime()
+	if value, exist := resource.Tags()[WhitelistedAtTagKey]; exist {
+		whitelistedAt, err := time.Parse(ExpiryTagValueFormat, value)
+		if err != nil {
+			log.Printf("%s has malformed whitelisted-at tag: %s\n", resource.ID(), value)
+		} else if whitelistedAt.After(start) {
+			start = whitelistedAt
+		}
+	}
+	return start.AddDate(0, 0, MaxLifetimeDays), true
+}
+
+// maxLifetimeApplies checks if the maximum lifetime applies to an account
+func maxLifetimeApplies(account string) bool {
+	if len(MaxLifetimeAccounts) == 0 {
+		return true
+	}
+	for _, maxLifetimeAccount := range MaxLifetimeAccounts {
+		if maxLifetimeAccount == account {
 			return true
 		}
 	}
 	return false
 }
 
+// IsSnoozed checks if the given resource has a snooze tag with a date
+// that hasn't passed yet
+func IsSnoozed(resource cloud.Resource) bool {
+	value, exist := resource.Tags()[SnoozeTagKey]
+	if !exist {
+		return false
+	}
+	return snoozeActive(resource, value)
+}
+
+// snoozeActive checks if the date of a snooze tag hasn't passed yet
+func snoozeActive(resource cloud.Resource, value string) bool {
+	until, err := time.Parse(ExpiryTagValueFormat, value)
+	if err != nil {
+		log.Printf("%s has malformed snooze tag: %s\n", resource.ID(), value)
+		return false
+	}
+	return clock.Now().Before(until)
+}
+
+// retentionValuePrefix is the prefix of the value of retention tags
+const retentionValuePrefix = "retain-"
+
+// RetainedUntil returns the time until which a resource must be retained,
+// and whether it has a retention tag at all. The value of the retention tag
+// is on the form "retain-<N><unit>", where the unit is d (days), m (months)
+// or y (years), e.g. "retain-90d" or "retain-1y". The retention period
+// starts when the resource was created.
+func RetainedUntil(resource cloud.Resource) (time.Time, bool, error) {
+	if RetentionTagKey == "" {
+		return time.Time{}, false, nil
+	}
+	value, exist := resource.Tags()[RetentionTagKey]
+	if !exist {
+		return time.Time{}, false, nil
+	}
+	period := strings.TrimPrefix(strings.ToLower(value), retentionValuePrefix)
+	if period == strings.ToLower(value) || len(period) < 2 {
+		return time.Time{}, true, fmt.Errorf("Invalid retention %q", value)
+	}
+	amount, err := strconv.Atoi(period[:len(period)-1])
+	if err != nil || amount < 0 {
+		return time.Time{}, true, fmt.Errorf("Invalid retention %q", value)
+	}
+	created := resource.CreationTime()
+	switch period[len(period)-1] {
+	case 'd':
+		return created.AddDate(0, 0, amount), true, nil
+	case 'm':
+		return created.AddDate(0, amount, 0), true, nil
+	case 'y':
+		return created.AddDate(amount, 0, 0), true, nil
+	default:
+		return time.Time{}, true, fmt.Errorf("Invalid retention %q", value)
+	}
+}
+
 func ParseFormat(image cloud.Image) (name string, creationTime time.Time) {
 	nameParts := strings.Split(image.Name(), "-")
 	if len(nameParts) < 2 {
@@ -34,6 +211,12 @@ func ParseFormat(image cloud.Image) (name string, creationTime time.Time) {
 	return "", time.Time{}
 }
 
+// notExcluded checks that a resource isn't whitelisted or snoozed, unless
+// the filter overrides it
+func (f *ResourceFilter) notExcluded(resource cloud.Resource) bool {
+	return (!IsWhitelisted(resource) || f.OverrideWhitelist) && (!IsSnoozed(resource) || f.OverrideSnooze)
+}
+
 func (f *ResourceFilter) includeResource(resource cloud.Resource) bool {
 	for i := range f.generalRules {
 		if !f.generalRules[i](resource) {
@@ -52,7 +235,7 @@ func (f *ResourceFilter) includeInstance(instance cloud.Instance) bool {
 			return false
 		}
 	}
-	return !IsWhitelisted(instance) || f.OverrideWhitelist
+	return f.notExcluded(instance)
 }
 
 func (f *ResourceFilter) includeVolume(volume cloud.Volume) bool {
@@ -64,7 +247,7 @@ func (f *ResourceFilter) includeVolume(volume cloud.Volume) bool {
 			return false
 		}
 	}
-	return !IsWhitelisted(volume) || f.OverrideWhitelist
+	return f.notExcluded(volume)
 }
 
 func (f *ResourceFilter) includeImage(image cloud.Image) bool {
@@ -76,7 +259,7 @@ func (f *ResourceFilter) includeImage(image cloud.Image) bool {
 			return false
 		}
 	}
-	return !IsWhitelisted(image) || f.OverrideWhitelist
+	return f.notExcluded(image)
 }
 
 func (f *ResourceFilter) includeSnapshot(snapshot cloud.Snapshot) bool {
@@ -88,7 +271,7 @@ func (f *ResourceFilter) includeSnapshot(snapshot cloud.Snapshot) bool {
 			return false
 		}
 	}
-	return !IsWhitelisted(snapshot) || f.OverrideWhitelist
+	return f.notExcluded(snapshot)
 }
 
 func (f *ResourceFilter) includeBucket(bucket cloud.Bucket) bool {
@@ -100,7 +283,91 @@ func (f *ResourceFilter) includeBucket(bucket cloud.Bucket) bool {
 			return false
 		}
 	}
-	return !IsWhitelisted(bucket) || f.OverrideWhitelist
+	return f.notExcluded(bucket)
+}
+
+func (f *ResourceFilter) includeTable(table cloud.Table) bool {
+	if !f.includeResource(table) {
+		return false
+	}
+	for i := range f.tableRules {
+		if !f.tableRules[i](table) {
+			return false
+		}
+	}
+	return f.notExcluded(table)
+}
+
+func (f *ResourceFilter) includeCacheCluster(cluster cloud.CacheCluster) bool {
+	if !f.includeResource(cluster) {
+		return false
+	}
+	for i := range f.cacheClusterRules {
+		if !f.cacheClusterRules[i](cluster) {
+			return false
+		}
+	}
+	return f.notExcluded(cluster)
+}
+
+func (f *ResourceFilter) includeAddress(address cloud.Address) bool {
+	if !f.includeResource(address) {
+		return false
+	}
+	for i := range f.addressRules {
+		if !f.addressRules[i](address) {
+			return false
+		}
+	}
+	return f.notExcluded(address)
+}
+
+func (f *ResourceFilter) includeNetworkGateway(gateway cloud.NetworkGateway) bool {
+	if !f.includeResource(gateway) {
+		return false
+	}
+	for i := range f.gatewayRules {
+		if !f.gatewayRules[i](gateway) {
+			return false
+		}
+	}
+	return f.notExcluded(gateway)
+}
+
+func (f *ResourceFilter) includeCapacity(capacity cloud.Capacity) bool {
+	if !f.includeResource(capacity) {
+		return false
+	}
+	for i := range f.capacityRules {
+		if !f.capacityRules[i](capacity) {
+			return false
+		}
+	}
+	return f.notExcluded(capacity)
+}
+
+func (f *ResourceFilter) includeDBInstance(instance cloud.DBInstance) bool {
+	if !f.includeResource(instance) {
+		return false
+	}
+	for i := range f.dbInstanceRules {
+		if !f.dbInstanceRules[i](instance) {
+			return false
+		}
+	}
+	return f.notExcluded(instance)
+}
+
+func (f *ResourceFilter) includeDBSnapshot(snapshot cloud.DBSnapshot) bool {
+	if !f.includeResource(snapshot) {
+		return false
+	}
+	for i := range f.dbSnapshotRules {
+		if !f.dbSnapshotRules[i](snapshot) {
+			return false
+		}
+	}
+	return f.notExcluded(snapshot)
 }
 
 func or(resource cloud.Resource, filters []*ResourceFilter) bool {
@@ -149,5 +416,68 @@ func or(resource cloud.Resource, filters []*ResourceFilter) bool {
 		return false
 	}
 
+	if table, ok := resource.(cloud.Table); ok {
+		for _, filter := range filters {
+			if filter.includeTable(table) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if cluster, ok := resource.(cloud.CacheCluster); ok {
+		for _, filter := range filters {
+			if filter.includeCacheCluster(cluster) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if address, ok := resource.(cloud.Address); ok {
+		for _, filter := range filters {
+			if filter.includeAddress(address) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if gateway, ok := resource.(cloud.NetworkGateway); ok {
+		for _, filter := range filters {
+			if filter.includeNetworkGateway(gateway) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if capacity, ok := resource.(cloud.Capacity); ok {
+		for _, filter := range filters {
+			if filter.includeCapacity(capacity) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if instance, ok := resource.(cloud.DBInstance); ok {
+		for _, filter := range filters {
+			if filter.includeDBInstance(instance) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if snapshot, ok := resource.(cloud.DBSnapshot); ok {
+		for _, filter := range filters {
+			if filter.includeDBSnapshot(snapshot) {
+				return true
+			}
+		}
+		return false
+	}
+
 	return false
 }
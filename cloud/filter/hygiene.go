@@ -0,0 +1,131 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+// cloudsweeperTagKeys are the canonical keys of all tags set or read by
+// Cloudsweeper
+var cloudsweeperTagKeys = []string{
+	WhitelistTagKey,
+	WhitelistApproverTagKey,
+	LifetimeTagKey,
+	ExpiryTagKey,
+	DeleteTagKey,
+	StopTagKey,
+	SnoozeTagKey,
+	NoteTagKey,
+	SuggestedTagKey,
+}
+
+// TagConflict is an inconsistency in the Cloudsweeper tags of a resource,
+// together with the tag changes that repair it
+type TagConflict struct {
+	Resource cloud.Resource
+	Problem  string
+	// Set are tags to set, and Remove are keys of tags to remove, to
+	// repair the conflict
+	Set    map[string]string
+	Remove []string
+}
+
+// TagConflicts returns the conflicting or duplicate Cloudsweeper tags of a
+// resource. Conflicts are resolved with the following precedence:
+//		1. A key with different case or underscores, such as
+//		   Cloudsweeper_Whitelisted, is replaced by its canonical key. If
+//		   the canonical key is also set, its value is kept.
+//		2. A whitelisted resource is never cleaned up, so it loses its
+//		   cloudsweeper-delete-at and cloudsweeper-stop-at tags, unless
+//		   its whitelisting is pending approval.
+//		3. A snoozed resource isn't marked until its snooze expires, so it
+//		   also loses its cloudsweeper-delete-at and cloudsweeper-stop-at tags.
+//		4. A resource marked for both deletion and stop is deleted, so it
+//		   loses its cloudsweeper-stop-at tag.
+func TagConflicts(resource cloud.Resource) []*TagConflict {
+	tags := resource.Tags()
+	variants := make(map[string][]string)
+	for key := range tags {
+		canonical := normalizeTagKey(key)
+		if isCloudsweeperTagKey(canonical) {
+			variants[canonical] = append(variants[canonical], key)
+		}
+	}
+	value := func(canonical string) string {
+		if val, exist := tags[canonical]; exist {
+			return val
+		}
+		keys := variants[canonical]
+		sort.Strings(keys)
+		return tags[keys[0]]
+	}
+	has := func(canonical string) bool {
+		_, exist := variants[canonical]
+		return exist
+	}
+
+	// Marker tags that lose to a tag with higher precedence
+	removed := make(map[string]string)
+	for _, marker := range []string{DeleteTagKey, StopTagKey} {
+		if !has(marker) {
+			continue
+		}
+		if IsWhitelisted(resource) {
+			removed[marker] = fmt.Sprintf("whitelisted, but also tagged with %s", marker)
+		} else if has(SnoozeTagKey) && snoozeActive(resource, value(SnoozeTagKey)) {
+			removed[marker] = fmt.Sprintf("snoozed, but also tagged with %s", marker)
+		}
+	}
+	if _, stopRemoved := removed[StopTagKey]; has(DeleteTagKey) && has(StopTagKey) && !stopRemoved {
+		removed[StopTagKey] = fmt.Sprintf("tagged with both %s and %s", DeleteTagKey, StopTagKey)
+	}
+
+	conflicts := []*TagConflict{}
+	for _, canonical := range cloudsweeperTagKeys {
+		keys := variants[canonical]
+		sort.Strings(keys)
+		if problem, ok := removed[canonical]; ok {
+			conflicts = append(conflicts, &TagConflict{Resource: resource, Problem: problem, Remove: keys})
+			continue
+		}
+		if len(keys) == 0 || (len(keys) == 1 && keys[0] == canonical) {
+			continue
+		}
+		conflict := &TagConflict{
+			Resource: resource,
+			Problem:  fmt.Sprintf("%s is tagged as %s", canonical, strings.Join(keys, ", ")),
+			Remove:   []string{},
+		}
+		if _, exist := tags[canonical]; !exist {
+			conflict.Set = map[string]string{canonical: value(canonical)}
+		}
+		for _, key := range keys {
+			if key != canonical {
+				conflict.Remove = append(conflict.Remove, key)
+			}
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// normalizeTagKey returns the canonical form of a tag key, tag keys of
+// Cloudsweeper are matched regardless of case and underscores
+func normalizeTagKey(key string) string {
+	return strings.Replace(strings.ToLower(key), "_", "-", -1)
+}
+
+func isCloudsweeperTagKey(key string) bool {
+	for _, canonical := range cloudsweeperTagKeys {
+		if key == canonical {
+			return true
+		}
+	}
+	return false
+}
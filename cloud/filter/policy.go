@@ -0,0 +1,229 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Policy declares the rule chains that mark each type of resource for
+// cleanup, so that the rules can be changed without recompiling, e.g.
+//
+//	instances:
+//	- name: old instance
+//	  older_than_days: 182
+//	volumes:
+//	- name: unattached volume
+//	  attached: false
+//	  older_than_days: 30
+//
+// A resource is matched if all rules of any of the chains of its type
+// match. Whitelisted and snoozed resources are never matched.
+type Policy struct {
+	Instances []*RuleChain `yaml:"instances,omitempty"`
+	Images    []*RuleChain `yaml:"images,omitempty"`
+	Volumes   []*RuleChain `yaml:"volumes,omitempty"`
+	Snapshots []*RuleChain `yaml:"snapshots,omitempty"`
+	Buckets   []*RuleChain `yaml:"buckets,omitempty"`
+}
+
+// RuleChain is a named chain of rules, which all have to match. Rules
+// that are left out always match.
+type RuleChain struct {
+	// Name is why the resources matched by the chain are marked, e.g.
+	// "old instance"
+	Name          string `yaml:"name"`
+	OlderThanDays int    `yaml:"older_than_days,omitempty"`
+	// Untagged matches resources without any tags but Name, see
+	// IsUntaggedWithException
+	Untagged    bool     `yaml:"untagged,omitempty"`
+	HasTags     []string `yaml:"has_tags,omitempty"`
+	MissingTags []string `yaml:"missing_tags,omitempty"`
+	// NamePatterns are regular expressions, see NameMatches
+	NamePatterns []string `yaml:"name_patterns,omitempty"`
+	MinSizeGB    int      `yaml:"min_size_gb,omitempty"`
+	// Running only applies to instances, RegionalCopy to images (see
+	// IsRegionalCopy), Attached to volumes, InUse to snapshots and
+	// NotModifiedDays to buckets
+	Running         *bool `yaml:"running,omitempty"`
+	RegionalCopy    *bool `yaml:"regional_copy,omitempty"`
+	Attached        *bool `yaml:"attached,omitempty"`
+	InUse           *bool `yaml:"in_use,omitempty"`
+	NotModifiedDays int   `yaml:"not_modified_days,omitempty"`
+
+	filter *ResourceFilter
+}
+
+// LoadPolicy reads and compiles a policy file
+func LoadPolicy(fileName string) (*Policy, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(raw, policy); err != nil {
+		return nil, fmt.Errorf("Invalid policy file %s: %s", fileName, err)
+	}
+	for kind, chains := range policy.kinds() {
+		for i, chain := range chains {
+			if err := chain.compile(kind); err != nil {
+				return nil, fmt.Errorf("Invalid rule chain %d of %s in %s: %s", i+1, kind, fileName, err)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// compile builds the filter of a rule chain of the specified kind of
+// resources
+func (c *RuleChain) compile(kind string) error {
+	if c.Name == "" {
+		return fmt.Errorf("The chain has no name")
+	}
+	if c.Running != nil && kind != "instances" {
+		return fmt.Errorf("running only applies to instances")
+	}
+	if c.RegionalCopy != nil && kind != "images" {
+		return fmt.Errorf("regional_copy only applies to images")
+	}
+	if c.Attached != nil && kind != "volumes" {
+		return fmt.Errorf("attached only applies to volumes")
+	}
+	if c.InUse != nil && kind != "snapshots" {
+		return fmt.Errorf("in_use only applies to snapshots")
+	}
+	if c.NotModifiedDays > 0 && kind != "buckets" {
+		return fmt.Errorf("not_modified_days only applies to buckets")
+	}
+	fil := New()
+	if c.OlderThanDays > 0 {
+		fil.AddGeneralRule(OlderThanXDays(c.OlderThanDays))
+	}
+	if c.Untagged {
+		fil.AddGeneralRule(IsUntaggedWithException("Name"))
+	}
+	for _, key := range c.HasTags {
+		fil.AddGeneralRule(HasTag(key))
+	}
+	for _, key := range c.MissingTags {
+		fil.AddGeneralRule(Negate(HasTag(key)))
+	}
+	if len(c.NamePatterns) > 0 {
+		patterns := []*regexp.Regexp{}
+		for _, expr := range c.NamePatterns {
+			pattern, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("Invalid name pattern '%s': %s", expr, err)
+			}
+			patterns = append(patterns, pattern)
+		}
+		fil.AddGeneralRule(NameMatches(patterns...))
+	}
+	if c.MinSizeGB > 0 {
+		fil.AddGeneralRule(SizeGreaterThanGB(c.MinSizeGB))
+	}
+	if c.Running != nil {
+		running := *c.Running
+		fil.AddInstanceRule(func(i cloud.Instance) bool { return i.Running() == running })
+	}
+	if c.RegionalCopy != nil {
+		regionalCopy := *c.RegionalCopy
+		fil.AddImageRule(func(i cloud.Image) bool { return IsRegionalCopy()(i) == regionalCopy })
+	}
+	if c.Attached != nil {
+		attached := *c.Attached
+		fil.AddVolumeRule(func(v cloud.Volume) bool { return v.Attached() == attached })
+	}
+	if c.InUse != nil {
+		inUse := *c.InUse
+		fil.AddSnapshotRule(func(s cloud.Snapshot) bool { return s.InUse() == inUse })
+	}
+	if c.NotModifiedDays > 0 {
+		fil.AddBucketRule(NotModifiedInXDays(c.NotModifiedDays))
+	}
+	c.filter = fil
+	return nil
+}
+
+// matches checks if all rules of the chain match a resource
+func (c *RuleChain) matches(res cloud.Resource) bool {
+	switch r := res.(type) {
+	case cloud.Instance:
+		return len(Instances([]cloud.Instance{r}, c.filter)) == 1
+	case cloud.Image:
+		return len(Images([]cloud.Image{r}, c.filter)) == 1
+	case cloud.Volume:
+		return len(Volumes([]cloud.Volume{r}, c.filter)) == 1
+	case cloud.Snapshot:
+		return len(Snapshots([]cloud.Snapshot{r}, c.filter)) == 1
+	case cloud.Bucket:
+		return len(Buckets([]cloud.Bucket{r}, c.filter)) == 1
+	default:
+		return false
+	}
+}
+
+// kinds returns the rule chains of each kind of resource, by the key of
+// the kind in the policy file
+func (p *Policy) kinds() map[string][]*RuleChain {
+	if p == nil {
+		return nil
+	}
+	return map[string][]*RuleChain{
+		"instances": p.Instances,
+		"images":    p.Images,
+		"volumes":   p.Volumes,
+		"snapshots": p.Snapshots,
+		"buckets":   p.Buckets,
+	}
+}
+
+// chains returns the rule chains of the type of a resource
+func (p *Policy) chains(res cloud.Resource) []*RuleChain {
+	switch res.(type) {
+	case cloud.Instance:
+		return p.kinds()["instances"]
+	case cloud.Image:
+		return p.kinds()["images"]
+	case cloud.Volume:
+		return p.kinds()["volumes"]
+	case cloud.Snapshot:
+		return p.kinds()["snapshots"]
+	case cloud.Bucket:
+		return p.kinds()["buckets"]
+	default:
+		return nil
+	}
+}
+
+// Covers checks if the policy has any rule chains for a kind of resource,
+// e.g. "volumes", which then replace the built-in rules of that kind
+func (p *Policy) Covers(kind string) bool {
+	return len(p.kinds()[kind]) > 0
+}
+
+// Match returns the name of the first rule chain matching a resource, and
+// whether any of them matched
+func (p *Policy) Match(res cloud.Resource) (string, bool) {
+	for _, chain := range p.chains(res) {
+		if chain.matches(res) {
+			return chain.Name, true
+		}
+	}
+	return "", false
+}
+
+// Matches returns a rule matching resources that any of the rule chains
+// of the policy match
+func (p *Policy) Matches() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		_, matched := p.Match(r)
+		return matched
+	}
+}
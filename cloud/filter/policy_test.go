@@ -0,0 +1,82 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestPolicy(t *testing.T) {
+	fileName := writePolicy(t, `
+instances:
+- name: old instance
+  older_than_days: 10
+  running: true
+volumes:
+- name: unattached volume
+  attached: false
+`)
+	defer os.Remove(fileName)
+	policy, err := LoadPolicy(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !policy.Covers("instances") || policy.Covers("images") {
+		t.Error("Policy covers the wrong kinds of resources")
+	}
+
+	inst := &testInstance{testResource: testResource{creationTime: time.Now().AddDate(0, 0, -20)}, running: true}
+	if name, ok := policy.Match(inst); !ok || name != "old instance" {
+		t.Error("Old running instance was not matched")
+	}
+
+	inst.running = false
+	if _, ok := policy.Match(inst); ok {
+		t.Error("Stopped instance was matched")
+	}
+
+	vol := &testVolume{attached: true}
+	if len(Volumes([]cloud.Volume{vol}, policyFilter(policy))) != 0 {
+		t.Error("Attached volume was matched")
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	for _, content := range []string{
+		"instances:\n- older_than_days: 10\n",
+		"instances:\n- name: old\n  attached: false\n",
+		"images:\n- name: old\n  name_patterns: ['(']\n",
+		"disks:\n- name: old\n",
+	} {
+		fileName := writePolicy(t, content)
+		if _, err := LoadPolicy(fileName); err == nil {
+			t.Errorf("Invalid policy was loaded: %q", content)
+		}
+		os.Remove(fileName)
+	}
+}
+
+func policyFilter(policy *Policy) *ResourceFilter {
+	fil := New()
+	fil.AddGeneralRule(policy.Matches())
+	return fil
+}
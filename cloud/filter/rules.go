@@ -5,16 +5,26 @@ package filter
 
 import (
 	"log"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 )
 
 const (
-	// WhitelistTagKey marks a resource to not matched by filter
+	// WhitelistTagKey marks a resource to not matched by filter. If its
+	// value is a date (YYYY-MM-DD), the whitelisting expires at that date.
 	WhitelistTagKey = "cloudsweeper-whitelisted"
+	// WhitelistedAtTagKey holds the date (YYYY-MM-DD) a resource was last
+	// whitelisted. Its maximum lifetime starts over at that date, see
+	// MaxLifetimeDays.
+	WhitelistedAtTagKey = "cloudsweeper-whitelisted-at"
+	// WhitelistApproverTagKey holds the username of the approver of the
+	// whitelisting of an expensive resource, see WhitelistApprovers
+	WhitelistApproverTagKey = "cloudsweeper-whitelist-approver"
 	// LifetimeTagKey marks a resource to be cleaned up after X days
 	LifetimeTagKey = "cloudsweeper-lifetime"
 	// ExpiryTagKey marks a resource to be cleaned up at the specified date (YYYY-MM-DD)
@@ -23,10 +33,113 @@ const (
 	// to keep track of resources that should be cleaned up, but was not explicitly tagged
 	// by the resource owner.
 	DeleteTagKey = "cloudsweeper-delete-at"
+	// StopTagKey marks an instance to be stopped, rather than deleted. It's used
+	// like DeleteTagKey, for policies where instances should be kept but stopped.
+	StopTagKey = "cloudsweeper-stop-at"
+	// SnoozeTagKey excludes a resource from all filters until the specified
+	// date (YYYY-MM-DD), after which it's handled as usual again
+	SnoozeTagKey = "cloudsweeper-snooze-until"
+	// NoteTagKey holds a note from the owner, such as why an old resource
+	// should be kept. The note is shown next to the resource in all reports.
+	NoteTagKey = "cloudsweeper-note"
+	// SuggestedTagKey marks resources with tags that were suggested by
+	// Cloudsweeper from billing data and related resources, rather than
+	// set by the owner
+	SuggestedTagKey = "cloudsweeper-suggested"
+	// OrphanTagKey holds the ID of the terminated instance a volume or
+	// snapshot was left behind by, as found when the instance was cleaned up
+	OrphanTagKey = "cloudsweeper-orphan-of"
+	// OrphanIncludeTagKey includes an orphaned volume or snapshot in the
+	// next marking run, regardless of its age
+	OrphanIncludeTagKey = "cloudsweeper-orphan-include"
+	// ArchiveTagKey holds the ID of the volume a snapshot archives, taken
+	// before the volume was cleaned up. The snapshot also has an
+	// ExpiryTagKey, at the end of its retention.
+	ArchiveTagKey = "cloudsweeper-archive"
+	// ManagedByTagKey holds the ID of the infrastructure as code stack,
+	// such as a Terraform stack, that manages a resource. It's set by the
+	// pipeline deploying the stack, and such resources are only marked
+	// together with the rest of their stack.
+	ManagedByTagKey = "cloudsweeper-managed-by"
+	// StackOwnerTagKey holds the username of the owner of the stack in
+	// ManagedByTagKey, who gets the reports of the stack instead of the
+	// owner of its account
+	StackOwnerTagKey = "cloudsweeper-stack-owner"
 	// ExpiryTagValueFormat is the format to use when setting expiry date
 	ExpiryTagValueFormat = "2006-01-02" // Used to parse string
 )
 
+// SystemTagPrefixes are prefixes of tag keys which are set by the CSP or
+// by other systems (such as Kubernetes) rather than by the resource owner.
+// Tags with any of these prefixes are not counted as user tags when
+// determining if a resource is untagged.
+var SystemTagPrefixes = []string{"aws:", "kubernetes.io/", "k8s.io/"}
+
+// IsSystemTag checks if a tag key starts with any of the SystemTagPrefixes
+func IsSystemTag(key string) bool {
+	lowerKey := strings.ToLower(key)
+	for _, prefix := range SystemTagPrefixes {
+		if prefix != "" && strings.HasPrefix(lowerKey, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetentionTagKey is the key of tags declaring how long a resource, such
+// as a backup, must be retained for compliance, e.g. "backup: retain-1y".
+// See RetainedUntil for the format. An empty key disables retention.
+var RetentionTagKey = ""
+
+// WhitelistApprovers are the usernames allowed to approve whitelisting a
+// resource whose monthly cost is above WhitelistApprovalCostPerMonth, by
+// setting its WhitelistApproverTagKey tag to their username. Until then the
+// resource is handled as if it wasn't whitelisted. Whitelisting never has
+// to be approved if there are no approvers.
+var WhitelistApprovers = []string{}
+
+// WhitelistApprovalCostPerMonth is the estimated monthly cost, according
+// to ResourceCostPerMonth, above which whitelisting must be approved
+var WhitelistApprovalCostPerMonth = 0.0
+
+// MaxLifetimeDays is the maximum lifetime of resources in the
+// MaxLifetimeAccounts, e.g. 365 for nothing living longer than a year.
+// Resources past it are marked even if they're whitelisted, unless they
+// were whitelisted again within it. 0 disables the maximum lifetime.
+var MaxLifetimeDays = 0
+
+// MaxLifetimeGraceDays are the days resources past their maximum lifetime
+// are only reported, before they're marked
+var MaxLifetimeGraceDays = 0
+
+// MaxLifetimeAccounts are the accounts MaxLifetimeDays applies to, such as
+// development accounts. It applies to all accounts if there are none.
+var MaxLifetimeAccounts = []string{}
+
+// ResourceCostPerMonth estimates the monthly cost of a resource. It's set
+// by users of the billing package, since it depends on prices.
+var ResourceCostPerMonth func(cloud.Resource) float64
+
+// Dependencies are the resources depending on others, such as images and
+// volumes created from snapshots, see IsSafeToDelete. It's set by users of
+// cloud.ResourceManager.SnapshotDependencies.
+var Dependencies *cloud.DependencyGraph
+
+// CreatorTagKeys are keys of tags which hold the principal that created
+// a resource, such as the "aws:createdBy" tag set by AWS.
+var CreatorTagKeys = []string{"aws:createdBy", "created-by", "creator"}
+
+// UserTags returns the tags of a resource, excluding any system tags
+func UserTags(r cloud.Resource) map[string]string {
+	result := make(map[string]string)
+	for key, val := range r.Tags() {
+		if !IsSystemTag(key) {
+			result[key] = val
+		}
+	}
+	return result
+}
+
 // Below are general rules
 
 // Negate will simply negate another rule
@@ -43,11 +156,18 @@ func TaggedForCleanup() func(cloud.Resource) bool {
 	}
 }
 
+// TaggedForStop checks if a resource has been marked to be stopped
+func TaggedForStop() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		return HasTag(StopTagKey)(r)
+	}
+}
+
 // OlderThanXHours returns a resource that is older than the
 // specified amount of hours.
 func OlderThanXHours(hours int) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		return time.Now().After(r.CreationTime().Add(time.Duration(hours) * time.Hour))
+		return clock.Now().After(r.CreationTime().Add(time.Duration(hours) * time.Hour))
 	}
 }
 
@@ -55,7 +175,7 @@ func OlderThanXHours(hours int) func(cloud.Resource) bool {
 // specified amount of days
 func OlderThanXDays(days int) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		return time.Now().After(r.CreationTime().AddDate(0, 0, days))
+		return clock.Now().After(r.CreationTime().AddDate(0, 0, days))
 	}
 }
 
@@ -63,7 +183,7 @@ func OlderThanXDays(days int) func(cloud.Resource) bool {
 // specified amount of months
 func OlderThanXMonths(months int) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		return time.Now().After(r.CreationTime().AddDate(0, months, 0))
+		return clock.Now().After(r.CreationTime().AddDate(0, months, 0))
 	}
 }
 
@@ -71,7 +191,7 @@ func OlderThanXMonths(months int) func(cloud.Resource) bool {
 // specified amount of years
 func OlderThanXYears(years int) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		return time.Now().After(r.CreationTime().AddDate(years, 0, 0))
+		return clock.Now().After(r.CreationTime().AddDate(years, 0, 0))
 	}
 }
 
@@ -87,6 +207,25 @@ func NameContains(contains string) func(cloud.Resource) bool {
 	}
 }
 
+// NameMatches checks if the Name tag of a resource, or the name of an
+// image, matches any of the specified regular expressions
+func NameMatches(patterns ...*regexp.Regexp) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		names := []string{r.Tags()["Name"]}
+		if image, ok := r.(cloud.Image); ok {
+			names = append(names, image.Name())
+		}
+		for _, pattern := range patterns {
+			for _, name := range names {
+				if name != "" && pattern.MatchString(name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
 // IDMatches checks if a resource's ID matches any of the
 // specified IDs.
 func IDMatches(ids ...string) func(cloud.Resource) bool {
@@ -112,13 +251,45 @@ func HasTag(tagKey string) func(cloud.Resource) bool {
 	}
 }
 
-// IsUntaggedWithException checks if a resource is untagged with the exception of a specific tag
+// IsUntaggedWithException checks if a resource is untagged with the exception of a specific tag.
+// System tags (see SystemTagPrefixes) are not counted as tags.
 func IsUntaggedWithException(exceptionTag string) func(cloud.Resource) bool {
 	return func(r cloud.Resource) bool {
-		if len(r.Tags()) == 0 {
+		userTags := UserTags(r)
+		if len(userTags) == 0 {
 			return true
-		} else if len(r.Tags()) == 1 {
-			return HasTag(exceptionTag)(r)
+		} else if len(userTags) == 1 {
+			for key := range userTags {
+				return strings.ToLower(key) == strings.ToLower(exceptionTag)
+			}
+		}
+		return false
+	}
+}
+
+// CreatedByPrincipal checks if a resource was created by any of the
+// specified principals, such as a CI role. A principal on the format
+// "key=value" matches resources with that tag. Any other principal
+// matches resources where a creator tag (see CreatorTagKeys) contains it.
+func CreatedByPrincipal(principals ...string) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		tags := make(map[string]string)
+		for key, val := range r.Tags() {
+			tags[strings.ToLower(key)] = strings.ToLower(val)
+		}
+		for _, principal := range principals {
+			principal = strings.ToLower(principal)
+			if parts := strings.SplitN(principal, "=", 2); len(parts) == 2 {
+				if val, exist := tags[parts[0]]; exist && val == parts[1] {
+					return true
+				}
+				continue
+			}
+			for _, key := range CreatorTagKeys {
+				if creator, exist := tags[strings.ToLower(key)]; exist && principal != "" && strings.Contains(creator, principal) {
+					return true
+				}
+			}
 		}
 		return false
 	}
@@ -131,6 +302,30 @@ func IsPublic() func(cloud.Resource) bool {
 	}
 }
 
+// SizeGreaterThanGB returns volumes, snapshots, images and buckets larger
+// than X GB. Buckets whose size couldn't be determined are never
+// included, and neither are other kinds of resources.
+func SizeGreaterThanGB(gb int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		switch r := r.(type) {
+		case cloud.Volume:
+			return r.SizeGB() > int64(gb)
+		case cloud.Snapshot:
+			return r.SizeGB() > int64(gb)
+		case cloud.Image:
+			return r.SizeGB() > int64(gb)
+		case cloud.Bucket:
+			return r.SizeKnown() && r.TotalSizeGB() > float64(gb)
+		case cloud.DBInstance:
+			return r.StorageGB() > int64(gb)
+		case cloud.DBSnapshot:
+			return r.StorageGB() > int64(gb)
+		default:
+			return false
+		}
+	}
+}
+
 // LifetimeExceeded check if a resource have the lifetime tag,
 // with the format "cloudsweeper-lifetime: days-X" (where X is the amount of
 // days to keep the resource). If the lifetime is passed, then
@@ -155,7 +350,35 @@ func LifetimeExceeded() func(cloud.Resource) bool {
 			return false
 		}
 		expiery := r.CreationTime().Add(time.Hour * 24 * time.Duration(numberOfDays))
-		return time.Now().After(expiery)
+		return clock.Now().After(expiery)
+	}
+}
+
+// MaxLifetimeExceeded checks if a resource is more than graceDays past the
+// end of its maximum lifetime, see MaxLifetimeEnd. The maximum lifetime
+// applies to whitelisted resources too, so filters using this rule should
+// set OverrideWhitelist.
+func MaxLifetimeExceeded(graceDays int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		end, applies := MaxLifetimeEnd(r)
+		return applies && clock.Now().After(end.AddDate(0, 0, graceDays))
+	}
+}
+
+// WhitelistExpiresWithinXDays checks if the whitelisting of a resource
+// expires within the specified amount of days, and hasn't expired yet
+func WhitelistExpiresWithinXDays(days int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		expiry, expires := WhitelistExpiry(r)
+		return expires && clock.Now().Before(expiry) && !clock.Now().AddDate(0, 0, days).Before(expiry)
+	}
+}
+
+// WhitelistedMoreThanXDays checks if a resource is whitelisted, and was
+// last whitelisted more than the specified amount of days ago
+func WhitelistedMoreThanXDays(days int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		return IsWhitelisted(r) && clock.Now().After(WhitelistedSince(r).AddDate(0, 0, days))
 	}
 }
 
@@ -173,7 +396,7 @@ func ExpiryDatePassed() func(cloud.Resource) bool {
 			log.Printf("%s has incorrect expiry tag:%s", r.ID(), expiryVal)
 			return false
 		}
-		return time.Now().After(expiryDate)
+		return clock.Now().After(expiryDate)
 	}
 }
 
@@ -192,7 +415,7 @@ func DeleteWithinXHours(hours int) func(cloud.Resource) bool {
 			return false
 		}
 		within := deleteTime.Add(-(time.Duration(hours) * time.Hour))
-		return time.Now().After(within)
+		return clock.Now().After(within)
 	}
 }
 
@@ -209,7 +432,130 @@ func DeleteAtPassed() func(cloud.Resource) bool {
 			log.Printf("%s has malformed deletion tag: %s\n", r.ID(), deleteAt)
 			return false
 		}
-		return time.Now().After(deleteAtTime)
+		return clock.Now().After(deleteAtTime)
+	}
+}
+
+// StopWithinXHours checks if a resource is marked to be stopped within
+// the specified amount of hours
+func StopWithinXHours(hours int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		stopTimeString, hasStop := r.Tags()[StopTagKey]
+		if !hasStop {
+			return false
+		}
+		stopTime, err := time.Parse(time.RFC3339, stopTimeString)
+		if err != nil {
+			log.Printf("%s has malformed stop tag: %s\n", r.ID(), stopTimeString)
+			return false
+		}
+		within := stopTime.Add(-(time.Duration(hours) * time.Hour))
+		return clock.Now().After(within)
+	}
+}
+
+// StopAtPassed checks if the stop-at time for a resource has passed. The
+// stop tag has the same format as the delete tag.
+func StopAtPassed() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		stopAt, exist := r.Tags()[StopTagKey]
+		if !exist {
+			return false
+		}
+		stopAtTime, err := time.Parse(time.RFC3339, stopAt)
+		if err != nil {
+			log.Printf("%s has malformed stop tag: %s\n", r.ID(), stopAt)
+			return false
+		}
+		return clock.Now().After(stopAtTime)
+	}
+}
+
+// UnderRetention checks if a resource must still be retained, according
+// to its retention tag (see RetentionTagKey). Resources with a malformed
+// retention tag are always retained, since they can't be safely removed.
+func UnderRetention() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		retainedUntil, hasRetention, err := RetainedUntil(r)
+		if err != nil {
+			log.Printf("%s has malformed retention tag: %s\n", r.ID(), err)
+			return true
+		}
+		return hasRetention && clock.Now().Before(retainedUntil)
+	}
+}
+
+// IsSafeToDelete checks that no other resource, in any account, depends on
+// a resource according to Dependencies, unless the dependent resources are
+// tagged for cleanup themselves. Those have to be cleaned up first.
+func IsSafeToDelete() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		for _, dependent := range Dependencies.Dependents(r.ID()) {
+			if !TaggedForCleanup()(dependent) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// RetentionLapsed checks if a resource has a retention tag, and if the
+// retention period has passed, so the resource can be removed.
+func RetentionLapsed() func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		retainedUntil, hasRetention, err := RetainedUntil(r)
+		if err != nil {
+			log.Printf("%s has malformed retention tag: %s\n", r.ID(), err)
+			return false
+		}
+		return hasRetention && !clock.Now().Before(retainedUntil)
+	}
+}
+
+// Below are instance rules
+
+// IsRunning checks if an instance is running
+func IsRunning() func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		return i.Running()
+	}
+}
+
+// PublicWithoutInboundTrafficInXDays returns public instances which have
+// not received any traffic within X days, so their public IPv4 address
+// is paid for without being used. Instances whose traffic wasn't looked
+// up never match.
+func PublicWithoutInboundTrafficInXDays(days int) func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		if !i.Public() || i.LastInboundTraffic().IsZero() {
+			return false
+		}
+		return clock.Now().After(i.LastInboundTraffic().AddDate(0, 0, days))
+	}
+}
+
+// DatabasePatterns are regular expressions that detect instances running
+// databases, see IsDatabase
+var DatabasePatterns []*regexp.Regexp
+
+// IsDatabase checks if the Name tag, another tag value or a security group
+// of an instance matches any of the DatabasePatterns. Security groups, or
+// network tags in GCP, are usually named after the ports they open, such
+// as 5432, which is how databases are detected by their ports.
+func IsDatabase() func(cloud.Instance) bool {
+	return func(i cloud.Instance) bool {
+		names := i.SecurityGroups()
+		for _, value := range i.Tags() {
+			names = append(names, value)
+		}
+		for _, pattern := range DatabasePatterns {
+			for _, name := range names {
+				if pattern.MatchString(name) {
+					return true
+				}
+			}
+		}
+		return false
 	}
 }
 
@@ -222,6 +568,13 @@ func IsUnattached() func(cloud.Volume) bool {
 	}
 }
 
+// IsAttached is the opposite of IsUnattached
+func IsAttached() func(cloud.Volume) bool {
+	return func(v cloud.Volume) bool {
+		return v.Attached()
+	}
+}
+
 // Below are snapshot rules
 
 // IsInUse checks if the snapshot is currently being used by an AMI
@@ -258,12 +611,103 @@ func DoesNotFollowFormat() func(cloud.Image) bool {
 	}
 }
 
+// IsRegionalCopy checks if an image was copied from another region, so
+// that the primary image is still in its source region
+func IsRegionalCopy() func(cloud.Image) bool {
+	return func(i cloud.Image) bool {
+		return i.SourceRegion() != "" && i.SourceRegion() != i.Location()
+	}
+}
+
 // Below are bucket rules
 
 // NotModifiedInXDays returns bucket which have not had any modification
 // to them within X days.
 func NotModifiedInXDays(days int) func(cloud.Bucket) bool {
 	return func(b cloud.Bucket) bool {
-		return time.Now().After(b.LastModified().AddDate(0, 0, days))
+		return clock.Now().After(b.LastModified().AddDate(0, 0, days))
+	}
+}
+
+// SizeUnknown returns buckets whose size couldn't be determined, and
+// therefore can't be priced
+func SizeUnknown() func(cloud.Bucket) bool {
+	return func(b cloud.Bucket) bool {
+		return !b.SizeKnown()
+	}
+}
+
+// Below are table rules
+
+// TableNotUsedInXDays returns tables which have not been read
+// or written within X days.
+func TableNotUsedInXDays(days int) func(cloud.Table) bool {
+	return func(t cloud.Table) bool {
+		return clock.Now().After(t.LastActivity().AddDate(0, 0, days))
+	}
+}
+
+// Below are cache cluster rules
+
+// CacheClusterNotUsedInXDays returns cache clusters which no client
+// has connected to within X days.
+func CacheClusterNotUsedInXDays(days int) func(cloud.CacheCluster) bool {
+	return func(c cloud.CacheCluster) bool {
+		return clock.Now().After(c.LastActivity().AddDate(0, 0, days))
+	}
+}
+
+// Below are address rules
+
+// AddressNotInUse returns addresses which are reserved, but not
+// attached to any resource.
+func AddressNotInUse() func(cloud.Address) bool {
+	return func(a cloud.Address) bool {
+		return !a.InUse()
+	}
+}
+
+// Below are network gateway rules
+
+// NetworkGatewayNotUsedInXDays returns network gateways which no traffic
+// has gone through within X days.
+func NetworkGatewayNotUsedInXDays(days int) func(cloud.NetworkGateway) bool {
+	return func(g cloud.NetworkGateway) bool {
+		return clock.Now().After(g.LastActivity().AddDate(0, 0, days))
+	}
+}
+
+// Below are capacity rules
+
+// CapacityUnused returns capacities that no instance is using.
+func CapacityUnused() func(cloud.Capacity) bool {
+	return func(c cloud.Capacity) bool {
+		return c.UsedInstances() == 0
+	}
+}
+
+// CapacityOfType returns capacities of the specified type, such as
+// cloud.CapacityReservationType.
+func CapacityOfType(capacityType string) func(cloud.Capacity) bool {
+	return func(c cloud.Capacity) bool {
+		return c.CapacityType() == capacityType
+	}
+}
+
+// Below are database rules
+
+// DBInstanceStopped returns database instances which are stopped. Note
+// that AWS starts stopped RDS instances again after 7 days.
+func DBInstanceStopped() func(cloud.DBInstance) bool {
+	return func(d cloud.DBInstance) bool {
+		return d.Stopped()
+	}
+}
+
+// DBInstanceNotUsedInXDays returns database instances which no client has
+// connected to within X days.
+func DBInstanceNotUsedInXDays(days int) func(cloud.DBInstance) bool {
+	return func(d cloud.DBInstance) bool {
+		return clock.Now().After(d.LastActivity().AddDate(0, 0, days))
 	}
 }
@@ -4,10 +4,12 @@
 package filter
 
 import (
+	"regexp"
 	"testing"
 	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 )
 
 const (
@@ -34,6 +36,7 @@ func (r *testResource) Tags() map[string]string                        { return
 func (r *testResource) Location() string                               { return testLocation }
 func (r *testResource) Public() bool                                   { return testPublic }
 func (r *testResource) CreationTime() time.Time                        { return r.creationTime }
+func (r *testResource) Lineage() []string                              { return nil }
 func (r *testResource) SetTag(key, value string, overwrite bool) error { return nil }
 func (r *testResource) RemoveTag(key string) error                     { return nil }
 func (r *testResource) Cleanup() error                                 { return nil }
@@ -59,6 +62,83 @@ func TestAlreadyTaggedForDelete(t *testing.T) {
 	}
 }
 
+func TestFrozenClock(t *testing.T) {
+	creation := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	foo := &testResource{creation, map[string]string{ExpiryTagKey: "2018-02-01"}}
+	defer clock.Set(nil)
+
+	clock.Set(clock.Frozen(creation.AddDate(0, 0, 20)))
+	if OlderThanXDays(30)(foo) {
+		t.Error("Resource is not older than 30 days at the frozen time")
+	}
+	if ExpiryDatePassed()(foo) {
+		t.Error("Resource has not passed expiry at the frozen time")
+	}
+
+	clock.Set(clock.Frozen(creation.AddDate(0, 0, 40)))
+	if !OlderThanXDays(30)(foo) {
+		t.Error("Resource is older than 30 days at the frozen time")
+	}
+	if !ExpiryDatePassed()(foo) {
+		t.Error("Resource has passed expiry at the frozen time")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	creation := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	foo := &testResource{creation, map[string]string{"backup": "retain-1y"}}
+	RetentionTagKey = "backup"
+	defer func() { RetentionTagKey = "" }()
+	defer clock.Set(nil)
+
+	clock.Set(clock.Frozen(creation.AddDate(0, 6, 0)))
+	if !UnderRetention()(foo) {
+		t.Error("Resource is under retention for a year")
+	}
+	if RetentionLapsed()(foo) {
+		t.Error("Retention has not lapsed after 6 months")
+	}
+
+	clock.Set(clock.Frozen(creation.AddDate(1, 0, 1)))
+	if UnderRetention()(foo) {
+		t.Error("Resource is no longer under retention")
+	}
+	if !RetentionLapsed()(foo) {
+		t.Error("Retention has lapsed after a year")
+	}
+
+	foo.tags["backup"] = "retain-forever"
+	if !UnderRetention()(foo) {
+		t.Error("Resource with malformed retention should be retained")
+	}
+	if RetentionLapsed()(foo) {
+		t.Error("Malformed retention should never lapse")
+	}
+
+	delete(foo.tags, "backup")
+	if UnderRetention()(foo) || RetentionLapsed()(foo) {
+		t.Error("Resource has no retention")
+	}
+}
+
+func TestSafeToDelete(t *testing.T) {
+	foo := &testResource{time.Now(), map[string]string{}}
+	image := &testResource{time.Now(), map[string]string{}}
+	if !IsSafeToDelete()(foo) {
+		t.Error("Resource without dependency graph should be safe to delete")
+	}
+	Dependencies = cloud.NewDependencyGraph()
+	defer func() { Dependencies = nil }()
+	Dependencies.AddDependency(testID, image)
+	if IsSafeToDelete()(foo) {
+		t.Error("Resource with a dependent should not be safe to delete")
+	}
+	image.tags[DeleteTagKey] = time.Now().Format(time.RFC3339)
+	if !IsSafeToDelete()(foo) {
+		t.Error("Resource whose dependents are tagged for cleanup should be safe to delete")
+	}
+}
+
 func TestOlderHours(t *testing.T) {
 	oldTime := time.Now().Add(-(10 * time.Hour))
 	foo := &testResource{oldTime, map[string]string{}}
@@ -165,6 +245,55 @@ func TestHasTag(t *testing.T) {
 	}
 }
 
+func TestUntaggedWithException(t *testing.T) {
+	foo := &testResource{time.Now(), map[string]string{}}
+	if !IsUntaggedWithException("Name")(foo) {
+		t.Error("Resource without tags should be untagged")
+	}
+
+	foo.tags = map[string]string{"Name": "some-name"}
+	if !IsUntaggedWithException("Name")(foo) {
+		t.Error("Resource with only the exception tag should be untagged")
+	}
+
+	foo.tags = map[string]string{"Name": "some-name", "product": "foo"}
+	if IsUntaggedWithException("Name")(foo) {
+		t.Error("Resource with user tags should not be untagged")
+	}
+
+	foo.tags = map[string]string{
+		"aws:cloudformation:stack-name":    "some-stack",
+		"kubernetes.io/cluster/my-cluster": "owned",
+		"Name":                             "some-name",
+	}
+	if !IsUntaggedWithException("Name")(foo) {
+		t.Error("Resource with only system tags should be untagged")
+	}
+}
+
+func TestCreatedByPrincipal(t *testing.T) {
+	foo := &testResource{time.Now(), map[string]string{}}
+	if CreatedByPrincipal("ci-runner", "team=platform")(foo) {
+		t.Error("Resource without tags should not be created by automation")
+	}
+
+	foo.tags = map[string]string{"aws:createdBy": "AssumedRole:AROAEXAMPLE:CI-Runner-1234"}
+	if !CreatedByPrincipal("ci-runner")(foo) {
+		t.Error("Resource created by the CI role should match")
+	}
+	if CreatedByPrincipal("deploy-bot")(foo) {
+		t.Error("Resource created by the CI role should not match another principal")
+	}
+
+	foo.tags = map[string]string{"Team": "Platform"}
+	if !CreatedByPrincipal("ci-runner", "team=platform")(foo) {
+		t.Error("Resource with the automation tag should match")
+	}
+	if CreatedByPrincipal("team=infra")(foo) {
+		t.Error("Resource with another tag value should not match")
+	}
+}
+
 func TestPublic(t *testing.T) {
 	foo := &testResource{time.Now(), map[string]string{}}
 
@@ -298,10 +427,13 @@ type testVolume struct {
 	attached bool
 }
 
-func (v *testVolume) SizeGB() int64      { return testSize }
-func (v *testVolume) Attached() bool     { return v.attached }
-func (v *testVolume) Encrypted() bool    { return testEncrypted }
-func (v *testVolume) VolumeType() string { return testVolumeType }
+func (v *testVolume) SizeGB() int64         { return testSize }
+func (v *testVolume) Attached() bool        { return v.attached }
+func (v *testVolume) Encrypted() bool       { return testEncrypted }
+func (v *testVolume) VolumeType() string    { return testVolumeType }
+func (v *testVolume) Regional() bool        { return false }
+func (v *testVolume) Iops() int64           { return 0 }
+func (v *testVolume) ThroughputMBps() int64 { return 0 }
 
 func TestAttached(t *testing.T) {
 	foo := &testVolume{
@@ -311,13 +443,13 @@ func TestAttached(t *testing.T) {
 
 	foo.attached = true
 
-	if IsUnattached()(foo) {
+	if IsUnattached()(foo) || !IsAttached()(foo) {
 		t.Error("Should be attached")
 	}
 
 	foo.attached = false
 
-	if !IsUnattached()(foo) {
+	if !IsUnattached()(foo) || IsAttached()(foo) {
 		t.Error("Should not be attached")
 	}
 }
@@ -325,17 +457,19 @@ func TestAttached(t *testing.T) {
 type testBucket struct {
 	testResource
 	lastModified time.Time
+	sizeUnknown  bool
 }
 
 func (b *testBucket) LastModified() time.Time                { return b.lastModified }
 func (b *testBucket) ObjectCount() int64                     { return 10 }
 func (b *testBucket) TotalSizeGB() float64                   { return 5.13 }
 func (b *testBucket) StorageTypeSizesGB() map[string]float64 { return make(map[string]float64) }
+func (b *testBucket) SizeKnown() bool                        { return !b.sizeUnknown }
 
 func TestNotModified(t *testing.T) {
 	foo := &testBucket{
-		testResource{time.Now(), map[string]string{}},
-		time.Now(),
+		testResource: testResource{time.Now(), map[string]string{}},
+		lastModified: time.Now(),
 	}
 
 	if NotModifiedInXDays(5)(foo) {
@@ -349,6 +483,212 @@ func TestNotModified(t *testing.T) {
 	}
 }
 
+func TestSizeUnknown(t *testing.T) {
+	foo := &testBucket{}
+	foo.creationTime = time.Now()
+
+	if SizeUnknown()(foo) {
+		t.Error("Size should be known")
+	}
+
+	foo.sizeUnknown = true
+
+	if !SizeUnknown()(foo) {
+		t.Error("Size should be unknown")
+	}
+}
+
+type testTable struct {
+	testResource
+	lastActivity time.Time
+}
+
+func (t *testTable) SizeGB() float64         { return 1.5 }
+func (t *testTable) ItemCount() int64        { return 100 }
+func (t *testTable) LastActivity() time.Time { return t.lastActivity }
+
+func TestTableNotUsed(t *testing.T) {
+	foo := &testTable{
+		testResource{time.Now(), map[string]string{}},
+		time.Now(),
+	}
+
+	if TableNotUsedInXDays(5)(foo) {
+		t.Error("Has been used within 5 days")
+	}
+
+	foo.lastActivity = time.Now().AddDate(0, 0, -10)
+
+	if !TableNotUsedInXDays(5)(foo) {
+		t.Error("Not used within 5 days")
+	}
+}
+
+type testAddress struct {
+	testResource
+	inUse bool
+}
+
+func (a *testAddress) IP() string  { return "203.0.113.10" }
+func (a *testAddress) InUse() bool { return a.inUse }
+
+func TestAddressNotInUse(t *testing.T) {
+	foo := &testAddress{
+		testResource{time.Now(), map[string]string{}},
+		true,
+	}
+
+	if AddressNotInUse()(foo) {
+		t.Error("Address is in use")
+	}
+
+	foo.inUse = false
+
+	if !AddressNotInUse()(foo) {
+		t.Error("Address is not in use")
+	}
+}
+
+type testGateway struct {
+	testResource
+	lastActivity time.Time
+}
+
+func (g *testGateway) GatewayType() string     { return cloud.NATGatewayType }
+func (g *testGateway) Network() string         { return "vpc-123" }
+func (g *testGateway) Zones() int              { return 1 }
+func (g *testGateway) LastActivity() time.Time { return g.lastActivity }
+
+func TestNetworkGatewayNotUsed(t *testing.T) {
+	foo := &testGateway{
+		testResource{time.Now(), map[string]string{}},
+		time.Now(),
+	}
+
+	if NetworkGatewayNotUsedInXDays(5)(foo) {
+		t.Error("Has been used within 5 days")
+	}
+
+	foo.lastActivity = time.Now().AddDate(0, 0, -10)
+
+	if !NetworkGatewayNotUsedInXDays(5)(foo) {
+		t.Error("Not used within 5 days")
+	}
+
+	fil := New()
+	fil.AddNetworkGatewayRule(NetworkGatewayNotUsedInXDays(5))
+	if len(NetworkGateways([]cloud.NetworkGateway{foo}, fil)) != 1 {
+		t.Error("Failed filtering network gateways")
+	}
+}
+
+type testCapacity struct {
+	testResource
+	capacityType string
+	used         int
+}
+
+func (c *testCapacity) CapacityType() string { return c.capacityType }
+func (c *testCapacity) InstanceType() string { return "m5.large" }
+func (c *testCapacity) TotalInstances() int  { return 2 }
+func (c *testCapacity) UsedInstances() int   { return c.used }
+
+func TestCapacityUnused(t *testing.T) {
+	foo := &testCapacity{
+		testResource{time.Now(), map[string]string{}},
+		cloud.CapacityReservationType,
+		1,
+	}
+
+	if CapacityUnused()(foo) {
+		t.Error("Capacity is used")
+	}
+
+	foo.used = 0
+
+	if !CapacityUnused()(foo) {
+		t.Error("Capacity is not used")
+	}
+
+	fil := New()
+	fil.AddCapacityRule(CapacityUnused())
+	fil.AddCapacityRule(CapacityOfType(cloud.DedicatedHostType))
+	if len(Capacities([]cloud.Capacity{foo}, fil)) != 0 {
+		t.Error("Capacity reservation matched dedicated host filter")
+	}
+
+	foo.capacityType = cloud.DedicatedHostType
+	if len(Capacities([]cloud.Capacity{foo}, fil)) != 1 {
+		t.Error("Failed filtering capacities")
+	}
+}
+
+type testDBInstance struct {
+	testResource
+	stopped      bool
+	lastActivity time.Time
+}
+
+func (d *testDBInstance) Engine() string          { return "postgres" }
+func (d *testDBInstance) InstanceClass() string   { return "db.t3.medium" }
+func (d *testDBInstance) StorageGB() int64        { return 20 }
+func (d *testDBInstance) MultiAZ() bool           { return false }
+func (d *testDBInstance) Stopped() bool           { return d.stopped }
+func (d *testDBInstance) LastActivity() time.Time { return d.lastActivity }
+
+func TestDBInstanceNotUsed(t *testing.T) {
+	foo := &testDBInstance{
+		testResource{time.Now(), map[string]string{}},
+		false,
+		time.Now(),
+	}
+
+	if DBInstanceNotUsedInXDays(5)(foo) || DBInstanceStopped()(foo) {
+		t.Error("Database is running and has been used within 5 days")
+	}
+
+	foo.stopped = true
+	foo.lastActivity = time.Now().AddDate(0, 0, -10)
+
+	if !DBInstanceNotUsedInXDays(5)(foo) {
+		t.Error("Not used within 5 days")
+	}
+
+	fil := New()
+	fil.AddDBInstanceRule(DBInstanceStopped())
+	fil.AddDBInstanceRule(DBInstanceNotUsedInXDays(5))
+	if len(DBInstances([]cloud.DBInstance{foo}, fil)) != 1 {
+		t.Error("Failed filtering database instances")
+	}
+}
+
+func TestPublicWithoutInboundTraffic(t *testing.T) {
+	foo := &testInstance{public: true, lastInbound: time.Now()}
+
+	if PublicWithoutInboundTrafficInXDays(5)(foo) {
+		t.Error("Has received traffic within 5 days")
+	}
+
+	foo.lastInbound = time.Now().AddDate(0, 0, -10)
+
+	if !PublicWithoutInboundTrafficInXDays(5)(foo) {
+		t.Error("Has not received traffic within 5 days")
+	}
+
+	foo.public = false
+
+	if PublicWithoutInboundTrafficInXDays(5)(foo) {
+		t.Error("Instance is not public")
+	}
+
+	foo.public = true
+	foo.lastInbound = time.Time{}
+
+	if PublicWithoutInboundTrafficInXDays(5)(foo) {
+		t.Error("Traffic of instance was not looked up")
+	}
+}
+
 type testSnap struct {
 	testResource
 	inUse bool
@@ -374,3 +714,313 @@ func TestInUse(t *testing.T) {
 		t.Error("Snapshot is in use")
 	}
 }
+
+func TestSizeGreaterThan(t *testing.T) {
+	vol := &testVolume{testResource{time.Now(), map[string]string{}}, false}
+	snap := &testSnap{testResource{time.Now(), map[string]string{}}, false}
+	buck := &testBucket{}
+
+	if !SizeGreaterThanGB(testSize-1)(vol) || SizeGreaterThanGB(testSize)(vol) {
+		t.Error("Failed to compare volume size")
+	}
+	if !SizeGreaterThanGB(4)(snap) || SizeGreaterThanGB(5)(snap) {
+		t.Error("Failed to compare snapshot size")
+	}
+	if !SizeGreaterThanGB(5)(buck) || SizeGreaterThanGB(6)(buck) {
+		t.Error("Failed to compare bucket size")
+	}
+
+	buck.sizeUnknown = true
+	if SizeGreaterThanGB(0)(buck) {
+		t.Error("Bucket of unknown size should not be included")
+	}
+
+	foo := &testResource{time.Now(), map[string]string{}}
+	if SizeGreaterThanGB(0)(foo) {
+		t.Error("Resource without size should not be included")
+	}
+}
+
+func TestStopRules(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock.Set(clock.Frozen(now))
+	defer clock.Set(nil)
+
+	inst := &testInstance{running: true}
+	inst.tags = map[string]string{StopTagKey: now.Add(24 * time.Hour).Format(time.RFC3339)}
+	if !TaggedForStop()(inst) {
+		t.Error("Instance is tagged for stop")
+	}
+	if TaggedForCleanup()(inst) {
+		t.Error("Instance is not tagged for cleanup")
+	}
+	if !StopWithinXHours(48)(inst) {
+		t.Error("Instance is stopped within 48 hours")
+	}
+	if StopWithinXHours(12)(inst) {
+		t.Error("Instance is not stopped within 12 hours")
+	}
+	if StopAtPassed()(inst) {
+		t.Error("Stop time has not passed")
+	}
+	if !IsRunning()(inst) {
+		t.Error("Instance is running")
+	}
+
+	clock.Set(clock.Frozen(now.Add(25 * time.Hour)))
+	if !StopAtPassed()(inst) {
+		t.Error("Stop time has passed")
+	}
+
+	inst.tags[StopTagKey] = "tomorrow"
+	if StopAtPassed()(inst) || StopWithinXHours(48)(inst) {
+		t.Error("Malformed stop tag should never match")
+	}
+}
+
+func TestTagConflicts(t *testing.T) {
+	foo := &testResource{time.Now(), map[string]string{"Name": "foo", WhitelistTagKey: "true"}}
+	if conflicts := TagConflicts(foo); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %d", len(conflicts))
+	}
+
+	foo.tags = map[string]string{WhitelistTagKey: "true", "Cloudsweeper_Whitelisted": "yes", DeleteTagKey: "2018-01-01T00:00:00Z"}
+	conflicts := TagConflicts(foo)
+	if len(conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %d", len(conflicts))
+	}
+	if c := conflicts[0]; len(c.Set) != 0 || len(c.Remove) != 1 || c.Remove[0] != "Cloudsweeper_Whitelisted" {
+		t.Errorf("Duplicate whitelist key should be removed, got %v %v", c.Set, c.Remove)
+	}
+	if c := conflicts[1]; len(c.Remove) != 1 || c.Remove[0] != DeleteTagKey {
+		t.Errorf("Delete tag of whitelisted resource should be removed, got %v", c.Remove)
+	}
+
+	foo.tags = map[string]string{"CLOUDSWEEPER-LIFETIME": "7", DeleteTagKey: "2018-01-01T00:00:00Z", StopTagKey: "2018-01-01T00:00:00Z"}
+	conflicts = TagConflicts(foo)
+	if len(conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %d", len(conflicts))
+	}
+	if c := conflicts[0]; c.Set[LifetimeTagKey] != "7" || len(c.Remove) != 1 || c.Remove[0] != "CLOUDSWEEPER-LIFETIME" {
+		t.Errorf("Lifetime tag should be renamed, got %v %v", c.Set, c.Remove)
+	}
+	if c := conflicts[1]; len(c.Remove) != 1 || c.Remove[0] != StopTagKey {
+		t.Errorf("Stop tag should lose to delete tag, got %v", c.Remove)
+	}
+
+	now := time.Now()
+	defer clock.Set(nil)
+	clock.Set(clock.Frozen(now))
+	foo.tags = map[string]string{SnoozeTagKey: now.AddDate(0, 0, 7).Format(ExpiryTagValueFormat), StopTagKey: "2018-01-01T00:00:00Z"}
+	if conflicts := TagConflicts(foo); len(conflicts) != 1 || conflicts[0].Remove[0] != StopTagKey {
+		t.Error("Stop tag of snoozed resource should be removed")
+	}
+	foo.tags[SnoozeTagKey] = now.AddDate(0, 0, -7).Format(ExpiryTagValueFormat)
+	if conflicts := TagConflicts(foo); len(conflicts) != 0 {
+		t.Error("Expired snooze should not conflict with stop tag")
+	}
+}
+
+func TestWhitelistApproval(t *testing.T) {
+	defer func() {
+		WhitelistApprovers = []string{}
+		WhitelistApprovalCostPerMonth = 0.0
+		ResourceCostPerMonth = nil
+	}()
+	WhitelistApprovers = []string{"alice"}
+	WhitelistApprovalCostPerMonth = 100.0
+	ResourceCostPerMonth = func(res cloud.Resource) float64 { return 500.0 }
+
+	foo := &testResource{time.Now(), map[string]string{WhitelistTagKey: "true"}}
+	if IsWhitelisted(foo) || !WhitelistPendingApproval(foo) {
+		t.Error("Expensive resource should be pending approval")
+	}
+	foo.tags[WhitelistApproverTagKey] = "bob"
+	if IsWhitelisted(foo) || !WhitelistPendingApproval(foo) {
+		t.Error("Resource approved by someone else should be pending approval")
+	}
+	foo.tags[WhitelistApproverTagKey] = " Alice "
+	if !IsWhitelisted(foo) || WhitelistPendingApproval(foo) {
+		t.Error("Approved resource should be whitelisted")
+	}
+	delete(foo.tags, WhitelistApproverTagKey)
+	foo.tags[WhitelistTagKey] = "alice"
+	if !IsWhitelisted(foo) || WhitelistPendingApproval(foo) {
+		t.Error("Resource approved in its whitelist tag should be whitelisted")
+	}
+
+	foo.tags[WhitelistTagKey] = "true"
+	ResourceCostPerMonth = func(res cloud.Resource) float64 { return 50.0 }
+	if !IsWhitelisted(foo) || WhitelistPendingApproval(foo) {
+		t.Error("Cheap resource doesn't need approval")
+	}
+	delete(foo.tags, WhitelistTagKey)
+	if IsWhitelisted(foo) || WhitelistPendingApproval(foo) {
+		t.Error("Resource without whitelist tag is neither whitelisted nor pending")
+	}
+}
+
+func TestWhitelistExpiryWithApproval(t *testing.T) {
+	defer func() {
+		WhitelistApprovers = []string{}
+		WhitelistApprovalCostPerMonth = 0.0
+		ResourceCostPerMonth = nil
+	}()
+	WhitelistApprovers = []string{"alice"}
+	WhitelistApprovalCostPerMonth = 100.0
+	ResourceCostPerMonth = func(res cloud.Resource) float64 { return 500.0 }
+
+	now := time.Now()
+	foo := &testResource{now, map[string]string{WhitelistTagKey: now.AddDate(0, 0, 10).Format(ExpiryTagValueFormat)}}
+	if IsWhitelisted(foo) || !WhitelistPendingApproval(foo) {
+		t.Error("Expensive resource whitelisted with a date should be pending approval")
+	}
+	if expiry, expires := WhitelistExpiry(foo); !expires || expiry.Format(ExpiryTagValueFormat) != foo.tags[WhitelistTagKey] {
+		t.Error("Whitelisting pending approval should still expire")
+	}
+
+	foo.tags[WhitelistApproverTagKey] = "alice"
+	if !IsWhitelisted(foo) || WhitelistPendingApproval(foo) || WhitelistExpired(foo) {
+		t.Error("Approved whitelisting with a date should be whitelisted until it expires")
+	}
+	if !WhitelistExpiresWithinXDays(14)(foo) || WhitelistApprover(foo) != "alice" {
+		t.Error("Approved whitelisting should keep both its expiry and its approver")
+	}
+
+	foo.tags[WhitelistTagKey] = now.AddDate(0, 0, -1).Format(ExpiryTagValueFormat)
+	if IsWhitelisted(foo) || !WhitelistExpired(foo) || WhitelistPendingApproval(foo) {
+		t.Error("Approved whitelisting should expire at its date")
+	}
+}
+
+func TestWhitelistExpiry(t *testing.T) {
+	now := time.Now()
+	foo := &testResource{now, map[string]string{WhitelistTagKey: now.AddDate(0, 0, 10).Format(ExpiryTagValueFormat)}}
+
+	if !IsWhitelisted(foo) || WhitelistExpired(foo) {
+		t.Error("Whitelisting has not expired yet")
+	}
+	if !WhitelistExpiresWithinXDays(14)(foo) || WhitelistExpiresWithinXDays(7)(foo) {
+		t.Error("Whitelisting expires in 10 days")
+	}
+
+	foo.tags[WhitelistTagKey] = now.AddDate(0, 0, -1).Format(ExpiryTagValueFormat)
+
+	if IsWhitelisted(foo) || !WhitelistExpired(foo) || WhitelistPendingApproval(foo) {
+		t.Error("Whitelisting has expired")
+	}
+	if WhitelistExpiresWithinXDays(14)(foo) {
+		t.Error("Expired whitelisting is not about to expire")
+	}
+
+	foo.tags[WhitelistTagKey] = "true"
+
+	if !IsWhitelisted(foo) || WhitelistExpired(foo) || WhitelistExpiresWithinXDays(14)(foo) {
+		t.Error("Whitelisting without a date never expires")
+	}
+}
+
+func TestWhitelistedMoreThanXDays(t *testing.T) {
+	now := time.Now()
+	foo := &testResource{now.AddDate(-2, 0, 0), map[string]string{WhitelistTagKey: "true"}}
+
+	if !WhitelistedMoreThanXDays(365)(foo) {
+		t.Error("Resource without a whitelisted-at tag was whitelisted when created")
+	}
+
+	foo.tags[WhitelistedAtTagKey] = now.AddDate(0, -1, 0).Format(ExpiryTagValueFormat)
+
+	if WhitelistedMoreThanXDays(365)(foo) {
+		t.Error("Resource was whitelisted again a month ago")
+	}
+
+	delete(foo.tags, WhitelistTagKey)
+
+	if WhitelistedMoreThanXDays(0)(foo) {
+		t.Error("Resource is not whitelisted")
+	}
+}
+
+func TestMaxLifetimeExceeded(t *testing.T) {
+	defer func() {
+		MaxLifetimeDays = 0
+		MaxLifetimeAccounts = []string{}
+	}()
+	now := time.Now()
+	foo := &testResource{now.AddDate(-1, 0, -10), map[string]string{WhitelistTagKey: "true"}}
+
+	if MaxLifetimeExceeded(0)(foo) {
+		t.Error("There is no maximum lifetime")
+	}
+
+	MaxLifetimeDays = 365
+
+	if !MaxLifetimeExceeded(0)(foo) {
+		t.Error("Resource is past its maximum lifetime, even if whitelisted")
+	}
+	if MaxLifetimeExceeded(14)(foo) {
+		t.Error("Resource is still within the grace days")
+	}
+
+	foo.tags[WhitelistedAtTagKey] = now.AddDate(0, -1, 0).Format(ExpiryTagValueFormat)
+
+	if MaxLifetimeExceeded(0)(foo) {
+		t.Error("Resource was whitelisted again a month ago")
+	}
+
+	delete(foo.tags, WhitelistedAtTagKey)
+	MaxLifetimeAccounts = []string{"dev-account"}
+
+	if MaxLifetimeExceeded(0)(foo) {
+		t.Error("Maximum lifetime doesn't apply to the account of the resource")
+	}
+
+	MaxLifetimeAccounts = []string{testOwner}
+
+	if !MaxLifetimeExceeded(0)(foo) {
+		t.Error("Maximum lifetime applies to the account of the resource")
+	}
+}
+
+func TestIsDatabase(t *testing.T) {
+	DatabasePatterns = []*regexp.Regexp{regexp.MustCompile(`(?i)-db$`), regexp.MustCompile(`\b5432\b`)}
+	defer func() { DatabasePatterns = nil }()
+	foo := &testInstance{testResource: testResource{tags: map[string]string{"Name": "web-server"}}}
+
+	if IsDatabase()(foo) {
+		t.Error("Instance is not a database")
+	}
+
+	foo.tags["Name"] = "orders-DB"
+
+	if !IsDatabase()(foo) {
+		t.Error("Name of instance matches a database pattern")
+	}
+
+	foo.tags["Name"] = "orders"
+	foo.groups = []string{"allow-postgres-5432"}
+
+	if !IsDatabase()(foo) {
+		t.Error("Security group of instance matches a database pattern")
+	}
+}
+
+func TestIsRegionalCopy(t *testing.T) {
+	img := &testImg{}
+
+	if IsRegionalCopy()(img) {
+		t.Error("Image is not a copy")
+	}
+
+	img.sourceRegion = testLocation
+
+	if IsRegionalCopy()(img) {
+		t.Error("Image was copied within its own region")
+	}
+
+	img.sourceRegion = "us-east-1"
+
+	if !IsRegionalCopy()(img) {
+		t.Error("Image was copied from another region")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// NATGatewayType is the type of NAT gateways
+	NATGatewayType = "nat-gateway"
+	// VPCEndpointType is the type of interface VPC endpoints
+	VPCEndpointType = "vpc-endpoint"
+)
+
+type baseNetworkGateway struct {
+	baseResource
+	gatewayType  string
+	network      string
+	zones        int
+	lastActivity time.Time
+}
+
+func (g *baseNetworkGateway) GatewayType() string {
+	return g.gatewayType
+}
+
+func (g *baseNetworkGateway) Network() string {
+	return g.network
+}
+
+func (g *baseNetworkGateway) Zones() int {
+	return g.zones
+}
+
+func (g *baseNetworkGateway) LastActivity() time.Time {
+	return g.lastActivity
+}
+
+func cleanupNetworkGateways(ctx context.Context, gateways []NetworkGateway) error {
+	resList := []Resource{}
+	for i := range gateways {
+		v, ok := gateways[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert NetworkGateway to Resource")
+		}
+		resList = append(resList, v)
+	}
+	return cleanupResources(ctx, resList)
+}
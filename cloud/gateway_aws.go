@@ -0,0 +1,59 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type awsNetworkGateway struct {
+	baseNetworkGateway
+}
+
+// Cleanup will delete this NAT gateway or VPC endpoint
+func (g *awsNetworkGateway) Cleanup() error {
+	log.Printf("Cleaning up %s %s in %s", g.GatewayType(), g.ID(), AccountName(g.Owner()))
+	return awsTryWithBackoff(g.cleanup)
+}
+
+func (g *awsNetworkGateway) cleanup() error {
+	client := clientForAWSResource(g)
+	var err error
+	if g.GatewayType() == NATGatewayType {
+		_, err = client.DeleteNatGateway(&ec2.DeleteNatGatewayInput{
+			NatGatewayId: aws.String(g.ID()),
+		})
+	} else {
+		var output *ec2.DeleteVpcEndpointsOutput
+		output, err = client.DeleteVpcEndpoints(&ec2.DeleteVpcEndpointsInput{
+			VpcEndpointIds: aws.StringSlice([]string{g.ID()}),
+		})
+		if err == nil && len(output.Unsuccessful) > 0 && output.Unsuccessful[0].Error != nil {
+			err = fmt.Errorf("Could not delete %s: %s", g.ID(), aws.StringValue(output.Unsuccessful[0].Error.Message))
+		}
+	}
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func (g *awsNetworkGateway) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(g, key, value, overwrite)
+}
+
+func (g *awsNetworkGateway) RemoveTag(key string) error {
+	return removeAWSTag(g, key)
+}
@@ -1,26 +1,38 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+//go:build !nogcp
+// +build !nogcp
+
 package cloud
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
+	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+
+	oauth2 "golang.org/x/oauth2/google"
 	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	storage "google.golang.org/api/storage/v1"
 )
 
 // Google Cloud API error codes can be found here:
 // https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
 
-var (
-	// ErrPermissionDenied is returned if not enough permissions to perform action
-	ErrPermissionDenied = errors.New("permission denied")
-)
+// gcpMaxRequestRetries is the maximum amount of times a request that
+// failed with a temporary error is tried
+const gcpMaxRequestRetries = 5
 
 // gcpResourceManager uses the Go API client for Google Cloud
 // https://github.com/google/google-api-go-client
@@ -28,29 +40,55 @@ type gcpResourceManager struct {
 	projects []string
 	compute  *compute.Service
 	storage  *storage.Service
+	status   *ScanStatus
+}
+
+func init() {
+	registerManager(GCP, newGCPResourceManager)
+}
+
+func newGCPResourceManager(projects []string) (ResourceManager, error) {
+	log.Println("Initializing GCP Resource Manager")
+	client, err := getGCPHttpClient(scopeGCPCompute, scopeGCPStorage)
+	if err != nil {
+		return nil, err
+	}
+	computeService, err := compute.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Could not initialize compute service: %s", err)
+	}
+	storageService, err := storage.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Coult not initialize storage service: %s", err)
+	}
+	manager := &gcpResourceManager{
+		projects: projects,
+		compute:  computeService,
+		storage:  storageService,
+		status:   NewScanStatus(),
+	}
+	return manager, nil
 }
 
 func (m *gcpResourceManager) Owners() []string {
 	return m.projects
 }
 
-func (m *gcpResourceManager) InstancesPerAccount() map[string][]Instance {
+func (m *gcpResourceManager) ScanStatus() *ScanStatus {
+	return m.status
+}
+
+func (m *gcpResourceManager) InstancesPerAccount(ctx context.Context) map[string][]Instance {
 	log.Println("Getting instances in all projects")
 	result := make(map[string][]Instance)
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
 		instList := []Instance{}
 		var listMutex sync.Mutex // Zones are proccessed in parallel
-		m.forEachZone(project, func(zone string) {
-			inst, err := m.getInstances(project, zone)
+		m.forEachZone(ctx, project, func(zone string) {
+			inst, err := m.getInstances(ctx, project, zone)
 			if err != nil {
-				log.Printf("Could not list instances in (%s, %s): %s", project, zone, err)
-				if err == ErrPermissionDenied {
-					log.Println(err)
-				} else {
-					// If it was an unknown error, abort
-					log.Fatalln(err)
-				}
+				m.status.fail(project, zone, fmt.Errorf("Could not list instances: %s", err))
 			} else if len(inst) > 0 {
 				listMutex.Lock()
 				instList = append(instList, inst...)
@@ -64,20 +102,14 @@ func (m *gcpResourceManager) InstancesPerAccount() map[string][]Instance {
 	return result
 }
 
-func (m *gcpResourceManager) ImagesPerAccount() map[string][]Image {
+func (m *gcpResourceManager) ImagesPerAccount(ctx context.Context) map[string][]Image {
 	log.Println("Getting images in all projects")
 	result := make(map[string][]Image)
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
-		images, err := m.getImages(project)
+		images, err := m.getImages(ctx, project)
 		if err != nil {
-			log.Printf("Could not list images in %s: %s", project, err)
-			if err == ErrPermissionDenied {
-				log.Println(err)
-			} else {
-				// If it was an unknown error, abort
-				log.Fatalln(err)
-			}
+			m.status.fail(project, GlobalScan, fmt.Errorf("Could not list images: %s", err))
 		} else if len(images) > 0 {
 			resultMutex.Lock()
 			result[project] = images
@@ -87,23 +119,27 @@ func (m *gcpResourceManager) ImagesPerAccount() map[string][]Image {
 	return result
 }
 
-func (m *gcpResourceManager) VolumesPerAccount() map[string][]Volume {
+func (m *gcpResourceManager) VolumesPerAccount(ctx context.Context) map[string][]Volume {
 	log.Println("Getting volumes in all projects")
 	result := make(map[string][]Volume)
 	var resultMutex sync.Mutex // Projects are processed in parallel
 	m.forEachProject(func(project string) {
 		diskList := []Volume{}
 		var listMutex sync.Mutex // Zones are proccessed in parallel
-		m.forEachZone(project, func(zone string) {
-			volumes, err := m.getVolumes(project, zone)
+		m.forEachZone(ctx, project, func(zone string) {
+			volumes, err := m.getVolumes(ctx, project, zone)
 			if err != nil {
-				log.Printf("Could not list disks in (%s, %s): %s", project, zone, err)
-				if err == ErrPermissionDenied {
-					log.Println(err)
-				} else {
-					// If it was an unknown error, abort
-					log.Fatalln(err)
-				}
+				m.status.fail(project, zone, fmt.Errorf("Could not list disks: %s", err))
+			} else if len(volumes) > 0 {
+				listMutex.Lock()
+				diskList = append(diskList, volumes...)
+				listMutex.Unlock()
+			}
+		})
+		m.forEachRegion(ctx, project, func(region string) {
+			volumes, err := m.getRegionalVolumes(ctx, project, region)
+			if err != nil {
+				m.status.fail(project, region, fmt.Errorf("Could not list regional disks: %s", err))
 			} else if len(volumes) > 0 {
 				listMutex.Lock()
 				diskList = append(diskList, volumes...)
@@ -117,20 +153,14 @@ func (m *gcpResourceManager) VolumesPerAccount() map[string][]Volume {
 	return result
 }
 
-func (m *gcpResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
+func (m *gcpResourceManager) SnapshotsPerAccount(ctx context.Context) map[string][]Snapshot {
 	log.Println("Getting snapshots in all projects")
 	result := make(map[string][]Snapshot)
 	var resultMutex sync.Mutex
 	m.forEachProject(func(project string) {
-		snapshots, err := m.getSnapshots(project)
+		snapshots, err := m.getSnapshots(ctx, project)
 		if err != nil {
-			log.Printf("Could not list snapshots in %s: %s", project, err)
-			if err == ErrPermissionDenied {
-				log.Println(err)
-			} else {
-				// If it was an unknown error, abort
-				log.Fatalln(err)
-			}
+			m.status.fail(project, GlobalScan, fmt.Errorf("Could not list snapshots: %s", err))
 		} else if len(snapshots) > 0 {
 			resultMutex.Lock()
 			result[project] = snapshots
@@ -140,20 +170,14 @@ func (m *gcpResourceManager) SnapshotsPerAccount() map[string][]Snapshot {
 	return result
 }
 
-func (m *gcpResourceManager) BucketsPerAccount() map[string][]Bucket {
+func (m *gcpResourceManager) BucketsPerAccount(ctx context.Context) map[string][]Bucket {
 	log.Println("Getting buckets in all projects")
 	result := make(map[string][]Bucket)
 	var resultMutex sync.Mutex
 	m.forEachProject(func(project string) {
-		buckets, err := m.getBuckets(project)
+		buckets, err := m.getBuckets(ctx, project)
 		if err != nil {
-			log.Printf("Could not list buckets in %s: %s", project, err)
-			if err == ErrPermissionDenied {
-				log.Println(err)
-			} else {
-				// If it was an unknown error, abort
-				log.Fatalln(err)
-			}
+			m.status.fail(project, GlobalScan, fmt.Errorf("Could not list buckets: %s", err))
 		} else if len(buckets) > 0 {
 			resultMutex.Lock()
 			result[project] = buckets
@@ -163,7 +187,7 @@ func (m *gcpResourceManager) BucketsPerAccount() map[string][]Bucket {
 	return result
 }
 
-func (m *gcpResourceManager) AllResourcesPerAccount() map[string]*ResourceCollection {
+func (m *gcpResourceManager) AllResourcesPerAccount(ctx context.Context) map[string]*ResourceCollection {
 	log.Println("Getting all compute resources in all accounts")
 	result := make(map[string]*ResourceCollection)
 	var resultMutex sync.Mutex
@@ -174,19 +198,19 @@ func (m *gcpResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 	var snapMap map[string][]Snapshot
 	wg.Add(4)
 	go func() {
-		instanceMap = m.InstancesPerAccount()
+		instanceMap = m.InstancesPerAccount(ctx)
 		wg.Done()
 	}()
 	go func() {
-		imageMap = m.ImagesPerAccount()
+		imageMap = m.ImagesPerAccount(ctx)
 		wg.Done()
 	}()
 	go func() {
-		volumeMap = m.VolumesPerAccount()
+		volumeMap = m.VolumesPerAccount(ctx)
 		wg.Done()
 	}()
 	go func() {
-		snapMap = m.SnapshotsPerAccount()
+		snapMap = m.SnapshotsPerAccount(ctx)
 		wg.Done()
 	}()
 	wg.Wait()
@@ -205,24 +229,150 @@ func (m *gcpResourceManager) AllResourcesPerAccount() map[string]*ResourceCollec
 	return result
 }
 
-func (m *gcpResourceManager) CleanupInstances(instances []Instance) error {
-	return cleanupInstances(instances)
+// TablesPerAccount is not supported in GCP, so no tables are returned
+func (m *gcpResourceManager) TablesPerAccount(ctx context.Context) map[string][]Table {
+	return make(map[string][]Table)
 }
 
-func (m *gcpResourceManager) CleanupImages(images []Image) error {
-	return cleanupImages(images)
+// CacheClustersPerAccount is not supported in GCP, so no cache clusters
+// are returned
+func (m *gcpResourceManager) CacheClustersPerAccount(ctx context.Context) map[string][]CacheCluster {
+	return make(map[string][]CacheCluster)
 }
 
-func (m *gcpResourceManager) CleanupVolumes(volumes []Volume) error {
-	return cleanupVolumes(volumes)
+// NetworkGatewaysPerAccount is not supported in GCP yet, so no network
+// gateways are returned
+func (m *gcpResourceManager) NetworkGatewaysPerAccount(ctx context.Context) map[string][]NetworkGateway {
+	return make(map[string][]NetworkGateway)
 }
 
-func (m *gcpResourceManager) CleanupSnapshots(snapshots []Snapshot) error {
-	return cleanupSnapshots(snapshots)
+// CapacitiesPerAccount is not supported in GCP yet, so no capacities are
+// returned
+func (m *gcpResourceManager) CapacitiesPerAccount(ctx context.Context) map[string][]Capacity {
+	return make(map[string][]Capacity)
 }
 
-func (m *gcpResourceManager) CleanupBuckets(buckets []Bucket) error {
-	return cleanupBuckets(buckets)
+// DBInstancesPerAccount is not supported in GCP yet, so no database
+// instances are returned
+func (m *gcpResourceManager) DBInstancesPerAccount(ctx context.Context) map[string][]DBInstance {
+	return make(map[string][]DBInstance)
+}
+
+// DBSnapshotsPerAccount is not supported in GCP yet, so no database
+// snapshots are returned
+func (m *gcpResourceManager) DBSnapshotsPerAccount(ctx context.Context) map[string][]DBSnapshot {
+	return make(map[string][]DBSnapshot)
+}
+
+func (m *gcpResourceManager) AddressesPerAccount(ctx context.Context) map[string][]Address {
+	log.Println("Getting addresses in all projects")
+	result := make(map[string][]Address)
+	var resultMutex sync.Mutex // Projects are processed in parallel
+	m.forEachProject(func(project string) {
+		addressList := []Address{}
+		var listMutex sync.Mutex // Regions are proccessed in parallel
+		m.forEachRegion(ctx, project, func(region string) {
+			addresses, err := m.getAddresses(ctx, project, region)
+			if err != nil {
+				m.status.fail(project, region, fmt.Errorf("Could not list addresses: %s", err))
+			} else if len(addresses) > 0 {
+				listMutex.Lock()
+				addressList = append(addressList, addresses...)
+				listMutex.Unlock()
+			}
+		})
+		addresses, err := m.getGlobalAddresses(ctx, project)
+		if err != nil {
+			m.status.fail(project, GlobalScan, fmt.Errorf("Could not list global addresses: %s", err))
+		} else {
+			addressList = append(addressList, addresses...)
+		}
+		resultMutex.Lock()
+		result[project] = addressList
+		resultMutex.Unlock()
+	})
+	return result
+}
+
+// ReferencedImages is not supported in GCP, since it has neither SSM
+// parameters nor launch templates
+func (m *gcpResourceManager) ReferencedImages(ctx context.Context, parameterPaths []string, launchTemplates bool) (map[string]bool, error) {
+	if len(parameterPaths) > 0 || launchTemplates {
+		return nil, errors.New("Image references are not supported in GCP")
+	}
+	return make(map[string]bool), nil
+}
+
+// SnapshotDependencies returns an empty graph, since disks and images
+// created from a GCP snapshot don't depend on it once they're created
+func (m *gcpResourceManager) SnapshotDependencies(ctx context.Context) (*DependencyGraph, error) {
+	return NewDependencyGraph(), nil
+}
+
+func (m *gcpResourceManager) CleanupInstances(ctx context.Context, instances []Instance) error {
+	return cleanupInstances(ctx, instances)
+}
+
+func (m *gcpResourceManager) CleanupImages(ctx context.Context, images []Image) error {
+	return cleanupImages(ctx, images)
+}
+
+func (m *gcpResourceManager) CleanupVolumes(ctx context.Context, volumes []Volume) error {
+	return cleanupVolumes(ctx, volumes)
+}
+
+func (m *gcpResourceManager) CleanupSnapshots(ctx context.Context, snapshots []Snapshot) error {
+	return cleanupSnapshots(ctx, snapshots)
+}
+
+func (m *gcpResourceManager) CleanupBuckets(ctx context.Context, buckets []Bucket) error {
+	return cleanupBuckets(ctx, buckets)
+}
+
+func (m *gcpResourceManager) CleanupTables(ctx context.Context, tables []Table) error {
+	if len(tables) > 0 {
+		return errors.New("Tables are not supported in GCP")
+	}
+	return nil
+}
+
+func (m *gcpResourceManager) CleanupCacheClusters(ctx context.Context, clusters []CacheCluster) error {
+	if len(clusters) > 0 {
+		return errors.New("Cache clusters are not supported in GCP")
+	}
+	return nil
+}
+
+func (m *gcpResourceManager) CleanupAddresses(ctx context.Context, addresses []Address) error {
+	return cleanupAddresses(ctx, addresses)
+}
+
+func (m *gcpResourceManager) CleanupNetworkGateways(ctx context.Context, gateways []NetworkGateway) error {
+	if len(gateways) > 0 {
+		return errors.New("Network gateways are not supported in GCP")
+	}
+	return nil
+}
+
+func (m *gcpResourceManager) CleanupCapacities(ctx context.Context, capacities []Capacity) error {
+	if len(capacities) > 0 {
+		return errors.New("Capacities are not supported in GCP")
+	}
+	return nil
+}
+
+func (m *gcpResourceManager) CleanupDBInstances(ctx context.Context, instances []DBInstance) error {
+	if len(instances) > 0 {
+		return errors.New("Database instances are not supported in GCP")
+	}
+	return nil
+}
+
+func (m *gcpResourceManager) CleanupDBSnapshots(ctx context.Context, snapshots []DBSnapshot) error {
+	if len(snapshots) > 0 {
+		return errors.New("Database snapshots are not supported in GCP")
+	}
+	return nil
 }
 
 func (m *gcpResourceManager) forEachProject(f func(project string)) {
@@ -238,10 +388,10 @@ func (m *gcpResourceManager) forEachProject(f func(project string)) {
 	wg.Wait()
 }
 
-func (m *gcpResourceManager) forEachZone(project string, f func(zone string)) {
-	zones, err := m.compute.Zones.List(project).Do()
+func (m *gcpResourceManager) forEachZone(ctx context.Context, project string, f func(zone string)) {
+	zones, err := m.compute.Zones.List(project).Context(ctx).Do()
 	if err != nil {
-		log.Printf("Could not list zones in %s. Err: %v", project, err)
+		m.status.fail(project, GlobalScan, fmt.Errorf("Could not list zones: %s", err))
 		return
 	}
 	var wg sync.WaitGroup
@@ -255,8 +405,28 @@ func (m *gcpResourceManager) forEachZone(project string, f func(zone string)) {
 	wg.Wait()
 }
 
-func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, error) {
-	instances, err := m.compute.Instances.List(project, zone).Do()
+func (m *gcpResourceManager) forEachRegion(ctx context.Context, project string, f func(region string)) {
+	regions, err := m.compute.Regions.List(project).Context(ctx).Do()
+	if err != nil {
+		m.status.fail(project, GlobalScan, fmt.Errorf("Could not list regions: %s", err))
+		return
+	}
+	var wg sync.WaitGroup
+	for _, r := range regions.Items {
+		wg.Add(1)
+		go func(r string) {
+			f(r)
+			wg.Done()
+		}(r.Name)
+	}
+	wg.Wait()
+}
+
+// gcpInstanceStatusRunning is the status of running GCP instances
+const gcpInstanceStatusRunning = "RUNNING"
+
+func (m *gcpResourceManager) getInstances(ctx context.Context, project, zone string) ([]Instance, error) {
+	instances, err := m.compute.Instances.List(project, zone).Context(ctx).Do()
 	if err != nil {
 		if instances != nil && isGCPAccessDeniedError(instances.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -269,12 +439,16 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 		if err != nil {
 			log.Printf("Could not parse timestamp of %s (in %s): %s", i.Name, project, err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
-			creationTime = time.Now()
+			creationTime = clock.Now()
 		}
 		labels := i.Labels
 		if labels == nil {
 			labels = make(map[string]string)
 		}
+		networkTags := []string{}
+		if i.Tags != nil {
+			networkTags = i.Tags.Items
+		}
 		res = append(res, &gcpInstance{baseInstance{
 			baseResource: baseResource{
 				csp:          GCP,
@@ -284,8 +458,11 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 				public:       true,
 				tags:         i.Labels,
 				creationTime: creationTime,
+				lineage:      gcpResourceNames(gcpInstanceDiskURLs(i)...),
 			},
-			instanceType: parseGCPResourceURL(i.MachineType),
+			instanceType:   parseGCPResourceURL(i.MachineType),
+			running:        i.Status == gcpInstanceStatusRunning,
+			securityGroups: networkTags,
 		},
 			m.compute,
 		})
@@ -293,8 +470,8 @@ func (m *gcpResourceManager) getInstances(project, zone string) ([]Instance, err
 	return res, nil
 }
 
-func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
-	images, err := m.compute.Images.List(project).Do()
+func (m *gcpResourceManager) getImages(ctx context.Context, project string) ([]Image, error) {
+	images, err := m.compute.Images.List(project).Context(ctx).Do()
 	if err != nil {
 		if images != nil && isGCPAccessDeniedError(images.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -307,7 +484,7 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 		if err != nil {
 			log.Printf("Could not parse timestamp of %s (in %s): %s", img.Name, project, err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
-			creationTime = time.Now()
+			creationTime = clock.Now()
 		}
 		labels := img.Labels
 		if labels == nil {
@@ -323,9 +500,11 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 					creationTime: creationTime,
 					tags:         labels,
 					public:       true,
+					lineage:      gcpResourceNames(img.SourceDisk, img.SourceSnapshot),
 				},
 				name:   img.Name,
 				sizeGB: img.DiskSizeGb,
+				family: img.Family,
 			},
 			compute: m.compute,
 		})
@@ -333,21 +512,38 @@ func (m *gcpResourceManager) getImages(project string) ([]Image, error) {
 	return imgList, nil
 }
 
-func (m *gcpResourceManager) getVolumes(project, zone string) ([]Volume, error) {
-	volumes, err := m.compute.Disks.List(project, zone).Do()
+func (m *gcpResourceManager) getVolumes(ctx context.Context, project, zone string) ([]Volume, error) {
+	volumes, err := m.compute.Disks.List(project, zone).Context(ctx).Do()
+	if err != nil {
+		if volumes != nil && isGCPAccessDeniedError(volumes.HTTPStatusCode) {
+			return nil, ErrPermissionDenied
+		}
+		return nil, err
+	}
+	return m.convertDisks(project, zone, volumes.Items), nil
+}
+
+// getRegionalVolumes lists the regional persistent disks in a region,
+// which are replicated across two zones.
+func (m *gcpResourceManager) getRegionalVolumes(ctx context.Context, project, region string) ([]Volume, error) {
+	volumes, err := m.compute.RegionDisks.List(project, region).Context(ctx).Do()
 	if err != nil {
 		if volumes != nil && isGCPAccessDeniedError(volumes.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
 		}
 		return nil, err
 	}
+	return m.convertDisks(project, region, volumes.Items), nil
+}
+
+func (m *gcpResourceManager) convertDisks(project, location string, disks []*compute.Disk) []Volume {
 	diskList := []Volume{}
-	for _, disk := range volumes.Items {
+	for _, disk := range disks {
 		creationTime, err := time.Parse(time.RFC3339, disk.CreationTimestamp)
 		if err != nil {
 			log.Printf("Could not parse timestamp of %s (in %s): %s", disk.Name, project, err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
-			creationTime = time.Now()
+			creationTime = clock.Now()
 		}
 		labels := disk.Labels
 		if labels == nil {
@@ -359,24 +555,26 @@ func (m *gcpResourceManager) getVolumes(project, zone string) ([]Volume, error)
 					csp:          GCP,
 					owner:        project,
 					id:           disk.Name,
-					location:     zone,
+					location:     location,
 					creationTime: creationTime,
 					public:       true,
 					tags:         labels,
+					lineage:      append(gcpResourceNames(disk.Users...), gcpResourceNames(disk.SourceImage, disk.SourceSnapshot)...),
 				},
 				sizeGB:     disk.SizeGb,
 				encrypted:  false,
 				attached:   disk.Users != nil && len(disk.Users) > 0,
 				volumeType: parseGCPResourceURL(disk.Type),
+				regional:   len(disk.ReplicaZones) > 0,
 			},
 			compute: m.compute,
 		})
 	}
-	return diskList, nil
+	return diskList
 }
 
-func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
-	snapshots, err := m.compute.Snapshots.List(project).Do()
+func (m *gcpResourceManager) getSnapshots(ctx context.Context, project string) ([]Snapshot, error) {
+	snapshots, err := m.compute.Snapshots.List(project).Context(ctx).Do()
 	if err != nil {
 		if snapshots != nil && isGCPAccessDeniedError(snapshots.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -389,7 +587,7 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 		if err != nil {
 			log.Printf("Could not parse timestamp of %s (in %s): %s", snap.Name, project, err)
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
-			creationTime = time.Now()
+			creationTime = clock.Now()
 		}
 		labels := snap.Labels
 		if labels == nil {
@@ -401,10 +599,11 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 					csp:          GCP,
 					id:           snap.Name,
 					owner:        project,
-					location:     "",
+					location:     strings.Join(snap.StorageLocations, ","),
 					public:       true,
 					creationTime: creationTime,
 					tags:         labels,
+					lineage:      gcpResourceNames(snap.SourceDisk),
 				},
 				encrypted: false,
 				inUse:     false,
@@ -416,8 +615,72 @@ func (m *gcpResourceManager) getSnapshots(project string) ([]Snapshot, error) {
 	return snapList, nil
 }
 
-func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
-	buckets, err := m.storage.Buckets.List(project).Do()
+func (m *gcpResourceManager) getAddresses(ctx context.Context, project, region string) ([]Address, error) {
+	addresses, err := m.compute.Addresses.List(project, region).Context(ctx).Do()
+	if err != nil {
+		if addresses != nil && isGCPAccessDeniedError(addresses.HTTPStatusCode) {
+			return nil, ErrPermissionDenied
+		}
+		return nil, err
+	}
+	return m.convertAddresses(project, region, addresses.Items), nil
+}
+
+// getGlobalAddresses lists the global addresses of a project, which are
+// used by global load balancers.
+func (m *gcpResourceManager) getGlobalAddresses(ctx context.Context, project string) ([]Address, error) {
+	addresses, err := m.compute.GlobalAddresses.List(project).Context(ctx).Do()
+	if err != nil {
+		if addresses != nil && isGCPAccessDeniedError(addresses.HTTPStatusCode) {
+			return nil, ErrPermissionDenied
+		}
+		return nil, err
+	}
+	return m.convertAddresses(project, gcpGlobalLocation, addresses.Items), nil
+}
+
+// convertAddresses converts external addresses. Internal addresses are
+// free, so they are not included.
+func (m *gcpResourceManager) convertAddresses(project, location string, addresses []*compute.Address) []Address {
+	addressList := []Address{}
+	for _, addr := range addresses {
+		if addr.AddressType == "INTERNAL" {
+			continue
+		}
+		creationTime, err := time.Parse(time.RFC3339, addr.CreationTimestamp)
+		if err != nil {
+			log.Printf("Could not parse timestamp of %s (in %s): %s", addr.Name, project, err)
+			// Set to Now so it doesn't incorrecntly get tagged for deletion
+			creationTime = clock.Now()
+		}
+		labels := addr.Labels
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		addressList = append(addressList, &gcpAddress{
+			baseAddress: baseAddress{
+				baseResource: baseResource{
+					csp:          GCP,
+					owner:        project,
+					id:           addr.Name,
+					location:     location,
+					creationTime: creationTime,
+					public:       true,
+					tags:         labels,
+				},
+				ip: addr.Address,
+				// Addresses that are being reserved are not in use yet,
+				// but should not be cleaned up either
+				inUse: addr.Status != "RESERVED",
+			},
+			compute: m.compute,
+		})
+	}
+	return addressList
+}
+
+func (m *gcpResourceManager) getBuckets(ctx context.Context, project string) ([]Bucket, error) {
+	buckets, err := m.storage.Buckets.List(project).Context(ctx).Do()
 	if err != nil {
 		if buckets != nil && isGCPAccessDeniedError(buckets.HTTPStatusCode) {
 			return nil, ErrPermissionDenied
@@ -429,20 +692,21 @@ func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
 		creationTime, err := time.Parse(time.RFC3339, buck.TimeCreated)
 		if err != nil {
 			// Set to Now so it doesn't incorrecntly get tagged for deletion
-			creationTime = time.Now()
-		}
-		lastModified, err := time.Parse(time.RFC3339, buck.Updated)
-		if err != nil {
-			lastModified = time.Time{}
+			creationTime = clock.Now()
 		}
 		labels := buck.Labels
 		if labels == nil {
 			labels = make(map[string]string)
 		}
-		count, size, err := m.bucketDetails(buck.Name)
+		count, size, newestObject, complete, err := m.bucketDetails(ctx, buck.Name)
 		if err != nil {
 			log.Printf("Could not get object details for %s: %s", buck.Name, err)
 		}
+		// Objects outside the listed prefixes may be newer than those
+		// found, so a sampled bucket is assumed to be in use, like one
+		// that couldn't be listed completely
+		listedAll := err == nil && complete && len(GCPBucketListPrefixes) == 0
+		lastModified := bucketLastModified(creationTime, newestObject, listedAll)
 		buckList = append(buckList, &gcpBucket{
 			baseBucket: baseBucket{
 				baseResource: baseResource{
@@ -458,6 +722,7 @@ func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
 				objectCount:        count,
 				totalSizeGB:        size,
 				storageTypeSizesGB: make(map[string]float64),
+				sizeKnown:          listedAll,
 			},
 			storage: m.storage,
 		})
@@ -465,27 +730,93 @@ func (m *gcpResourceManager) getBuckets(project string) ([]Bucket, error) {
 	return buckList, nil
 }
 
-// bucketDetails will determine how many objects there are in a bucket and what
-// the total bucket size is.
-func (m *gcpResourceManager) bucketDetails(bucketID string) (int64, float64, error) {
-	var count int64
-	var sizeGB float64
-	var nextPageToken string
-	for ok := true; ok; ok = nextPageToken != "" {
-		objs, err := m.storage.Objects.List(bucketID).Do()
-		if err != nil {
-			if objs != nil && isGCPAccessDeniedError(objs.HTTPStatusCode) {
-				return 0, 0.0, ErrPermissionDenied
+// bucketDetails will determine how many objects there are in a bucket, what
+// the total bucket size is and when the newest object was written. Objects
+// in GCP are immutable, so the creation time of an object is when it was
+// last written. Its updated time also changes with its metadata.
+// bucketDetails lists the objects in a bucket to find their amount, total
+// size and the newest object. The listing is rate limited, and a page that
+// fails with a temporary error is retried, continuing where the listing
+// stopped. The listing is incomplete if the bucket (or GCPBucketListPrefixes
+// in it, if set) has too many objects to list within GCPBucketListTimeout.
+func (m *gcpResourceManager) bucketDetails(ctx context.Context, bucketID string) (count int64, sizeGB float64, newestObject time.Time, complete bool, err error) {
+	if GCPBucketListTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, GCPBucketListTimeout)
+		defer cancel()
+	}
+	var throttle <-chan time.Time
+	if GCPObjectListRequestsPerSecond > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(GCPObjectListRequestsPerSecond))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	prefixes := GCPBucketListPrefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	for _, prefix := range prefixes {
+		nextPageToken := ""
+		for ok := true; ok; ok = nextPageToken != "" {
+			if count >= maxBucketObjectsListed {
+				log.Printf("Only listed the first %d objects in %s", count, bucketID)
+				return count, sizeGB, newestObject, false, nil
+			}
+			if throttle != nil {
+				<-throttle
+			}
+			objs, err := m.listObjectsPage(ctx, bucketID, prefix, nextPageToken)
+			if err == context.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded {
+				log.Printf("Listing objects in %s timed out after %s, listed %d objects", bucketID, GCPBucketListTimeout, count)
+				return count, sizeGB, newestObject, false, nil
+			} else if err != nil {
+				return 0, 0.0, time.Time{}, false, err
+			}
+			nextPageToken = objs.NextPageToken
+			for _, obj := range objs.Items {
+				sizeGB += (float64(obj.Size) / gbDivider)
+				count++
+				if created, err := time.Parse(time.RFC3339, obj.TimeCreated); err == nil && created.After(newestObject) {
+					newestObject = created
+				}
 			}
-			return 0, 0.0, err
 		}
-		nextPageToken = objs.NextPageToken
-		for _, obj := range objs.Items {
-			sizeGB += (float64(obj.Size) / gbDivider)
-			count++
+	}
+	return count, sizeGB, newestObject, true, nil
+}
+
+// listObjectsPage lists a page of objects in a bucket, retrying the same
+// page with backoff if it fails with a temporary error
+func (m *gcpResourceManager) listObjectsPage(ctx context.Context, bucketID, prefix, pageToken string) (*storage.Objects, error) {
+	for try := 1; ; try++ {
+		call := m.storage.Objects.List(bucketID).Context(ctx).PageToken(pageToken)
+		if prefix != "" {
+			call = call.Prefix(prefix)
+		}
+		objs, err := call.Do()
+		if err == nil {
+			return objs, nil
+		}
+		if objs != nil && isGCPAccessDeniedError(objs.HTTPStatusCode) {
+			return nil, ErrPermissionDenied
+		}
+		if !isGCPTemporaryError(err) || try >= gcpMaxRequestRetries {
+			return nil, err
+		}
+		select {
+		case <-time.After(time.Duration(math.Exp2(float64(try))) * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
 	}
-	return count, sizeGB, nil
+}
+
+// isGCPTemporaryError checks if a request failed due to rate limiting or
+// an error in Google Cloud, so that it can be retried
+func isGCPTemporaryError(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && (apiErr.Code == 429 || apiErr.Code >= 500)
 }
 
 // Figure out if http response code is permission denied
@@ -500,6 +831,27 @@ func isGCPAccessDeniedError(code int) bool {
 	}
 }
 
+// gcpResourceNames returns the names of the resources with the specified
+// URLs, empty URLs are left out
+func gcpResourceNames(urls ...string) []string {
+	names := []string{}
+	for _, url := range urls {
+		if url != "" {
+			names = append(names, parseGCPResourceURL(url))
+		}
+	}
+	return names
+}
+
+// gcpInstanceDiskURLs returns the URLs of the disks attached to an instance
+func gcpInstanceDiskURLs(instance *compute.Instance) []string {
+	urls := []string{}
+	for _, disk := range instance.Disks {
+		urls = append(urls, disk.Source)
+	}
+	return urls
+}
+
 func parseGCPResourceURL(in string) string {
 	parts := strings.Split(in, "/")
 	n := len(parts)
@@ -508,3 +860,45 @@ func parseGCPResourceURL(in string) string {
 	}
 	return in
 }
+
+func getGCPHttpClient(scopes ...string) (*http.Client, error) {
+	credsFile, exist := os.LookupEnv(GcpCredentialsFileKey)
+	if !exist {
+		log.Println("No GCP credentials specified, using default")
+		client, err := oauth2.DefaultClient(context.Background(), scopes...)
+		if err != nil {
+			return nil, err
+		}
+		return countCalls(client), nil
+	}
+	creds, err := ioutil.ReadFile(credsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read GCP credentials JSON: %s", err)
+	}
+	conf, err := oauth2.JWTConfigFromJSON(creds, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get GCP credentials: %s", err)
+	}
+	return countCalls(conf.Client(context.Background())), nil
+}
+
+// countCalls makes a client count its requests by API, see APICalls
+func countCalls(client *http.Client) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &countingTransport{base: base}
+	return client
+}
+
+// countingTransport counts the requests made to each GCP API, named by
+// their host, such as compute for compute.googleapis.com
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordAPICall(strings.TrimSuffix(req.URL.Hostname(), ".googleapis.com"), 0)
+	return t.base.RoundTrip(req)
+}
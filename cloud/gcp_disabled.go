@@ -0,0 +1,45 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build nogcp
+// +build nogcp
+
+package cloud
+
+import (
+	"context"
+	"errors"
+)
+
+// errGCPDisabled is returned by functions that need GCP, when Cloudsweeper
+// is built without GCP support
+var errGCPDisabled = errors.New("Cloudsweeper is built without support for GCP")
+
+func resolveGCPSecret(name string) (string, error) {
+	return "", errGCPDisabled
+}
+
+func checkGCPAccess(project string) error {
+	return errGCPDisabled
+}
+
+func gcpCallerIdentity() (string, error) {
+	return "", errGCPDisabled
+}
+
+func discoverGCPProjects(ctx context.Context, ownerKey string) ([]*DiscoveredAccount, error) {
+	return nil, errGCPDisabled
+}
+
+// NewWorkflowsDelegate is not supported without GCP
+func NewWorkflowsDelegate(workflow, location string) (CleanupDelegate, error) {
+	return nil, errGCPDisabled
+}
+
+func gcpAccessKeysPerAccount(ctx context.Context, projects []string) (map[string][]*AccessKey, error) {
+	return nil, errGCPDisabled
+}
+
+func putGCPObject(bucket, key, contentType string, data []byte) error {
+	return errGCPDisabled
+}
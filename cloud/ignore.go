@@ -0,0 +1,291 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// ignoringResourceManager wraps another ResourceManager, and leaves out
+// all resources whose ID, ARN or name matches any of the patterns, as if
+// they didn't exist. All other calls are passed on to the wrapped manager.
+type ignoringResourceManager struct {
+	ResourceManager
+	patterns []*regexp.Regexp
+}
+
+// NewIgnoringManager returns a ResourceManager that never lists resources
+// matching any of the patterns, so that they are left out of marking,
+// cleanup and all reports, e.g. snapshots created by AWS Backup. It
+// returns the specified manager if there are no patterns.
+func NewIgnoringManager(mngr ResourceManager, patterns []*regexp.Regexp) ResourceManager {
+	if len(patterns) == 0 {
+		return mngr
+	}
+	return &ignoringResourceManager{ResourceManager: mngr, patterns: patterns}
+}
+
+// ParseIgnorePatterns parses regular expressions of resources to ignore
+func ParseIgnorePatterns(list []string) ([]*regexp.Regexp, error) {
+	patterns := []*regexp.Regexp{}
+	for _, expr := range list {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ignore pattern '%s': %s", expr, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// ignored checks if the ID, ARN or Name tag of a resource matches any of
+// the patterns
+func (m *ignoringResourceManager) ignored(res Resource) bool {
+	names := []string{res.ID(), res.Tags()["Name"]}
+	if arn := resourceARN(res); arn != "" {
+		names = append(names, arn)
+	}
+	for _, pattern := range m.patterns {
+		for _, name := range names {
+			if name != "" && pattern.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resourceARN returns the ARN of an AWS resource, or an empty string for
+// other resources
+func resourceARN(res Resource) string {
+	if res.CSP() != AWS {
+		return ""
+	}
+	switch res := res.(type) {
+	case Instance:
+		return fmt.Sprintf("arn:aws:ec2:%s:%s:instance/%s", res.Location(), res.Owner(), res.ID())
+	case Image:
+		return fmt.Sprintf("arn:aws:ec2:%s::image/%s", res.Location(), res.ID())
+	case Volume:
+		return fmt.Sprintf("arn:aws:ec2:%s:%s:volume/%s", res.Location(), res.Owner(), res.ID())
+	case Snapshot:
+		return fmt.Sprintf("arn:aws:ec2:%s::snapshot/%s", res.Location(), res.ID())
+	case Bucket:
+		return fmt.Sprintf("arn:aws:s3:::%s", res.ID())
+	case Table:
+		return fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/%s", res.Location(), res.Owner(), res.ID())
+	case CacheCluster:
+		return fmt.Sprintf("arn:aws:elasticache:%s:%s:cluster:%s", res.Location(), res.Owner(), res.ID())
+	case Address:
+		return fmt.Sprintf("arn:aws:ec2:%s:%s:elastic-ip/%s", res.Location(), res.Owner(), res.ID())
+	case NetworkGateway:
+		if res.GatewayType() == NATGatewayType {
+			return fmt.Sprintf("arn:aws:ec2:%s:%s:natgateway/%s", res.Location(), res.Owner(), res.ID())
+		}
+		return fmt.Sprintf("arn:aws:ec2:%s:%s:vpc-endpoint/%s", res.Location(), res.Owner(), res.ID())
+	case Capacity:
+		if res.CapacityType() == DedicatedHostType {
+			return fmt.Sprintf("arn:aws:ec2:%s:%s:dedicated-host/%s", res.Location(), res.Owner(), res.ID())
+		}
+		return fmt.Sprintf("arn:aws:ec2:%s:%s:capacity-reservation/%s", res.Location(), res.Owner(), res.ID())
+	case DBInstance:
+		return fmt.Sprintf("arn:aws:rds:%s:%s:db:%s", res.Location(), res.Owner(), res.ID())
+	case DBSnapshot:
+		return fmt.Sprintf("arn:aws:rds:%s:%s:snapshot:%s", res.Location(), res.Owner(), res.ID())
+	default:
+		return ""
+	}
+}
+
+func (m *ignoringResourceManager) BucketsPerAccount(ctx context.Context) map[string][]Bucket {
+	result := make(map[string][]Bucket)
+	for owner, buckets := range m.ResourceManager.BucketsPerAccount(ctx) {
+		result[owner] = []Bucket{}
+		for _, res := range buckets {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) InstancesPerAccount(ctx context.Context) map[string][]Instance {
+	result := make(map[string][]Instance)
+	for owner, instances := range m.ResourceManager.InstancesPerAccount(ctx) {
+		result[owner] = m.instances(instances)
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) ImagesPerAccount(ctx context.Context) map[string][]Image {
+	result := make(map[string][]Image)
+	for owner, images := range m.ResourceManager.ImagesPerAccount(ctx) {
+		result[owner] = m.images(images)
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) VolumesPerAccount(ctx context.Context) map[string][]Volume {
+	result := make(map[string][]Volume)
+	for owner, volumes := range m.ResourceManager.VolumesPerAccount(ctx) {
+		result[owner] = m.volumes(volumes)
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) SnapshotsPerAccount(ctx context.Context) map[string][]Snapshot {
+	result := make(map[string][]Snapshot)
+	for owner, snapshots := range m.ResourceManager.SnapshotsPerAccount(ctx) {
+		result[owner] = m.snapshots(snapshots)
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) TablesPerAccount(ctx context.Context) map[string][]Table {
+	result := make(map[string][]Table)
+	for owner, tables := range m.ResourceManager.TablesPerAccount(ctx) {
+		result[owner] = []Table{}
+		for _, res := range tables {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) CacheClustersPerAccount(ctx context.Context) map[string][]CacheCluster {
+	result := make(map[string][]CacheCluster)
+	for owner, clusters := range m.ResourceManager.CacheClustersPerAccount(ctx) {
+		result[owner] = []CacheCluster{}
+		for _, res := range clusters {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) AddressesPerAccount(ctx context.Context) map[string][]Address {
+	result := make(map[string][]Address)
+	for owner, addresses := range m.ResourceManager.AddressesPerAccount(ctx) {
+		result[owner] = []Address{}
+		for _, res := range addresses {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) NetworkGatewaysPerAccount(ctx context.Context) map[string][]NetworkGateway {
+	result := make(map[string][]NetworkGateway)
+	for owner, gateways := range m.ResourceManager.NetworkGatewaysPerAccount(ctx) {
+		result[owner] = []NetworkGateway{}
+		for _, res := range gateways {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) CapacitiesPerAccount(ctx context.Context) map[string][]Capacity {
+	result := make(map[string][]Capacity)
+	for owner, capacities := range m.ResourceManager.CapacitiesPerAccount(ctx) {
+		result[owner] = []Capacity{}
+		for _, res := range capacities {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) DBInstancesPerAccount(ctx context.Context) map[string][]DBInstance {
+	result := make(map[string][]DBInstance)
+	for owner, instances := range m.ResourceManager.DBInstancesPerAccount(ctx) {
+		result[owner] = []DBInstance{}
+		for _, res := range instances {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) DBSnapshotsPerAccount(ctx context.Context) map[string][]DBSnapshot {
+	result := make(map[string][]DBSnapshot)
+	for owner, snapshots := range m.ResourceManager.DBSnapshotsPerAccount(ctx) {
+		result[owner] = []DBSnapshot{}
+		for _, res := range snapshots {
+			if !m.ignored(res) {
+				result[owner] = append(result[owner], res)
+			}
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) AllResourcesPerAccount(ctx context.Context) map[string]*ResourceCollection {
+	result := make(map[string]*ResourceCollection)
+	for owner, collection := range m.ResourceManager.AllResourcesPerAccount(ctx) {
+		result[owner] = &ResourceCollection{
+			Owner:     collection.Owner,
+			Instances: m.instances(collection.Instances),
+			Images:    m.images(collection.Images),
+			Volumes:   m.volumes(collection.Volumes),
+			Snapshots: m.snapshots(collection.Snapshots),
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) instances(instances []Instance) []Instance {
+	result := []Instance{}
+	for _, res := range instances {
+		if !m.ignored(res) {
+			result = append(result, res)
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) images(images []Image) []Image {
+	result := []Image{}
+	for _, res := range images {
+		if !m.ignored(res) {
+			result = append(result, res)
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) volumes(volumes []Volume) []Volume {
+	result := []Volume{}
+	for _, res := range volumes {
+		if !m.ignored(res) {
+			result = append(result, res)
+		}
+	}
+	return result
+}
+
+func (m *ignoringResourceManager) snapshots(snapshots []Snapshot) []Snapshot {
+	result := []Snapshot{}
+	for _, res := range snapshots {
+		if !m.ignored(res) {
+			result = append(result, res)
+		}
+	}
+	return result
+}
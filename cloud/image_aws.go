@@ -0,0 +1,85 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"log"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type awsImage struct {
+	baseImage
+}
+
+// awsImageCopyPattern matches the description AWS gives copied AMIs,
+// e.g. "[Copied ami-0123456789abcdef0 from us-east-1] Base image"
+var awsImageCopyPattern = regexp.MustCompile(`\[Copied (ami-[0-9a-f]+) from ([a-z0-9-]+)\]`)
+
+// parseAWSImageCopySource returns the image and region an AMI was copied
+// from, according to its description, or empty strings if it's no copy
+func parseAWSImageCopySource(description string) (imageID, region string) {
+	match := awsImageCopyPattern.FindStringSubmatch(description)
+	if match == nil {
+		return "", ""
+	}
+	return match[1], match[2]
+}
+
+func (i *awsImage) Cleanup() error {
+	log.Printf("Cleaning up image %s in %s", i.ID(), AccountName(i.Owner()))
+	return awsTryWithBackoff(i.cleanup)
+}
+
+func (i *awsImage) cleanup() error {
+	client := clientForAWSResource(i)
+	input := &ec2.DeregisterImageInput{
+		ImageId: aws.String(i.ID()),
+	}
+	_, err := client.DeregisterImage(input)
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func (i *awsImage) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(i, key, value, overwrite)
+}
+
+func (i *awsImage) RemoveTag(key string) error {
+	return removeAWSTag(i, key)
+}
+
+func (i *awsImage) MakePrivate() error {
+	log.Printf("Making image %s private in %s", i.ID(), AccountName(i.Owner()))
+	if !i.Public() {
+		// Image is already private
+		return nil
+	}
+	client := clientForAWSResource(i)
+	input := &ec2.ModifyImageAttributeInput{
+		ImageId: aws.String(i.ID()),
+		LaunchPermission: &ec2.LaunchPermissionModifications{
+			Remove: []*ec2.LaunchPermission{&ec2.LaunchPermission{
+				Group: aws.String("all"),
+			}},
+		},
+	}
+	_, err := client.ModifyImageAttribute(input)
+	if err != nil {
+		return err
+	}
+	i.public = false
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+type gcpImage struct {
+	baseImage
+	compute *compute.Service
+}
+
+func (i *gcpImage) Cleanup() error {
+	log.Printf("Cleaning up image %s in %s", i.ID(), AccountName(i.Owner()))
+	_, err := i.compute.Images.Delete(i.Owner(), i.ID()).Do()
+	return err
+}
+
+func (i *gcpImage) SetTag(key, value string, overwrite bool) error {
+	img, err := i.compute.Images.Get(i.Owner(), i.ID()).Do()
+	if err != nil {
+		return nil
+	}
+	newLabels := img.Labels
+	if newLabels == nil {
+		newLabels = make(map[string]string)
+	}
+	if _, exist := newLabels[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, i.ID())
+	}
+	newLabels[key] = value
+	req := &compute.GlobalSetLabelsRequest{
+		Labels:           newLabels,
+		LabelFingerprint: img.LabelFingerprint,
+	}
+	_, err = i.compute.Images.SetLabels(i.Owner(), i.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	i.tags = newLabels
+	return nil
+}
+
+func (i *gcpImage) RemoveTag(key string) error {
+	newLabels := make(map[string]string)
+	for k, val := range i.tags {
+		if k != key {
+			newLabels[k] = val
+		}
+	}
+	img, err := i.compute.Images.Get(i.Owner(), i.ID()).Do()
+	if err != nil {
+		return err
+	}
+	req := &compute.GlobalSetLabelsRequest{
+		Labels:           newLabels,
+		LabelFingerprint: img.LabelFingerprint,
+	}
+	_, err = i.compute.Images.SetLabels(i.Owner(), i.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	i.tags = newLabels
+	return nil
+}
+
+func (i *gcpImage) MakePrivate() error {
+	log.Println("Attempted to make GCP image private, NO-OP")
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type awsInstance struct {
+	baseInstance
+}
+
+// Cleanup will termiante this instance
+func (i *awsInstance) Cleanup() error {
+	log.Printf("Cleaning up instance %s in %s", i.ID(), AccountName(i.Owner()))
+	return awsTryWithBackoff(i.cleanup)
+}
+
+func (i *awsInstance) cleanup() error {
+	client := clientForAWSResource(i)
+	input := &ec2.TerminateInstancesInput{
+		InstanceIds: aws.StringSlice([]string{i.id}),
+	}
+	_, err := client.TerminateInstances(input)
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+// Stop will stop this instance
+func (i *awsInstance) Stop() error {
+	log.Printf("Stopping instance %s in %s", i.ID(), AccountName(i.Owner()))
+	return awsTryWithBackoff(i.stop)
+}
+
+func (i *awsInstance) stop() error {
+	client := clientForAWSResource(i)
+	input := &ec2.StopInstancesInput{
+		InstanceIds: aws.StringSlice([]string{i.id}),
+	}
+	_, err := client.StopInstances(input)
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+		return err
+	}
+	i.running = false
+	return nil
+}
+
+func (i *awsInstance) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(i, key, value, overwrite)
+}
+
+func (i *awsInstance) RemoveTag(key string) error {
+	return removeAWSTag(i, key)
+}
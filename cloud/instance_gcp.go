@@ -0,0 +1,84 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+type gcpInstance struct {
+	baseInstance
+	compute *compute.Service
+}
+
+func (i *gcpInstance) Cleanup() error {
+	log.Printf("Cleaning up instance %s in %s", i.ID(), AccountName(i.Owner()))
+	_, err := i.compute.Instances.Delete(i.Owner(), i.Location(), i.ID()).Do()
+	return err
+}
+
+// Stop will stop this instance
+func (i *gcpInstance) Stop() error {
+	log.Printf("Stopping instance %s in %s", i.ID(), AccountName(i.Owner()))
+	_, err := i.compute.Instances.Stop(i.Owner(), i.Location(), i.ID()).Do()
+	if err != nil {
+		return err
+	}
+	i.running = false
+	return nil
+}
+
+func (i *gcpInstance) SetTag(key, value string, overwrite bool) error {
+	inst, err := i.compute.Instances.Get(i.Owner(), i.Location(), i.ID()).Do()
+	if err != nil {
+		return err
+	}
+	newLabels := inst.Labels
+	if newLabels == nil {
+		newLabels = make(map[string]string)
+	}
+	if _, exist := newLabels[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, i.ID())
+	}
+	newLabels[key] = value
+	req := &compute.InstancesSetLabelsRequest{
+		Labels:           newLabels,
+		LabelFingerprint: inst.LabelFingerprint,
+	}
+	_, err = i.compute.Instances.SetLabels(i.Owner(), i.Location(), i.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	i.tags = newLabels
+	return nil
+}
+
+func (i *gcpInstance) RemoveTag(key string) error {
+	newLabels := make(map[string]string)
+	for k, val := range i.tags {
+		if k != key {
+			newLabels[k] = val
+		}
+	}
+	inst, err := i.compute.Instances.Get(i.Owner(), i.Location(), i.ID()).Do()
+	if err != nil {
+		return err
+	}
+	req := &compute.InstancesSetLabelsRequest{
+		Labels:           newLabels,
+		LabelFingerprint: inst.LabelFingerprint,
+	}
+	_, err = i.compute.Instances.SetLabels(i.Owner(), i.Location(), i.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	i.tags = newLabels
+	return nil
+}
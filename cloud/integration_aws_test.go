@@ -0,0 +1,175 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build integration && !noaws
+// +build integration,!noaws
+
+package cloud
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// localStackURLEnv is the environment variable with the URL of
+	// LocalStack. The default is a name that LocalStack resolves to
+	// localhost, including its subdomains used for bucket addressing.
+	localStackURLEnv     = "CS_LOCALSTACK_URL"
+	localStackDefaultURL = "http://localhost.localstack.cloud:4566"
+	// localStackAccount is the ID of the account that LocalStack
+	// emulates by default
+	localStackAccount = "000000000000"
+	localStackRegion  = "us-east-1"
+)
+
+// useLocalStack points all AWS clients at LocalStack. The returned
+// function restores the endpoints.
+func useLocalStack(t *testing.T) (restore func()) {
+	localStackURL := emulatorURL(t, localStackURLEnv, localStackDefaultURL)
+	// LocalStack accepts any credentials, but the SDK needs some to sign
+	// the requests with
+	for _, envVar := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		if os.Getenv(envVar) == "" {
+			os.Setenv(envVar, "test")
+		}
+	}
+	// Buckets are addressed as subdomains of the S3 endpoint
+	s3URL, err := url.Parse(localStackURL)
+	if err != nil {
+		t.Fatalf("Invalid LocalStack URL %q: %s", localStackURL, err)
+	}
+	s3URL.Host = "s3." + s3URL.Host
+
+	oldEndpoints, oldSTSRegion := AWSEndpoints, AWSSTSRegion
+	AWSEndpoints = map[string]string{
+		"ec2":        localStackURL,
+		"s3":         s3URL.String(),
+		"sts":        localStackURL,
+		"iam":        localStackURL,
+		"monitoring": localStackURL,
+	}
+	AWSSTSRegion = localStackRegion
+	return func() {
+		AWSEndpoints, AWSSTSRegion = oldEndpoints, oldSTSRegion
+	}
+}
+
+func newLocalStackManager(t *testing.T) ResourceManager {
+	mngr, err := NewManager(AWS, localStackAccount)
+	if err != nil {
+		t.Fatalf("Could not create AWS manager: %s", err)
+	}
+	return mngr
+}
+
+func findAWSVolume(mngr ResourceManager, id string) Volume {
+	for _, vol := range mngr.VolumesPerAccount(context.Background())[localStackAccount] {
+		if vol.ID() == id {
+			return vol
+		}
+	}
+	return nil
+}
+
+func findAWSBucket(mngr ResourceManager, id string) Bucket {
+	for _, bucket := range mngr.BucketsPerAccount(context.Background())[localStackAccount] {
+		if bucket.ID() == id {
+			return bucket
+		}
+	}
+	return nil
+}
+
+func TestIntegrationAWSVolume(t *testing.T) {
+	defer useLocalStack(t)()
+	mngr := newLocalStackManager(t)
+	client := ec2.New(NewAWSSession(), &aws.Config{Region: aws.String(localStackRegion)})
+	created, err := client.CreateVolume(&ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String(localStackRegion + "a"),
+		Size:             aws.Int64(1),
+		VolumeType:       aws.String("gp2"),
+	})
+	if err != nil {
+		t.Fatalf("Could not create volume: %s", err)
+	}
+	id := aws.StringValue(created.VolumeId)
+
+	vol := findAWSVolume(mngr, id)
+	if vol == nil {
+		t.Fatalf("Volume %s was not listed", id)
+	}
+	if vol.SizeGB() != 1 || vol.Location() != localStackRegion {
+		t.Errorf("Volume %s is listed with size %d GB in %s", id, vol.SizeGB(), vol.Location())
+	}
+
+	if err := vol.SetTag(integrationTestTag, "true", false); err != nil {
+		t.Fatalf("Could not tag volume %s: %s", id, err)
+	}
+	vol = findAWSVolume(mngr, id)
+	if vol == nil || vol.Tags()[integrationTestTag] != "true" {
+		t.Fatalf("Volume %s is not listed with the tag it was given", id)
+	}
+	if err := vol.RemoveTag(integrationTestTag); err != nil {
+		t.Fatalf("Could not remove tag of volume %s: %s", id, err)
+	}
+	vol = findAWSVolume(mngr, id)
+	if vol == nil {
+		t.Fatalf("Volume %s was not listed after removing its tag", id)
+	}
+	if _, exists := vol.Tags()[integrationTestTag]; exists {
+		t.Fatalf("Volume %s is still tagged after removing the tag", id)
+	}
+
+	if err := mngr.CleanupVolumes(context.Background(), []Volume{vol}); err != nil {
+		t.Fatalf("Could not clean up volume %s: %s", id, err)
+	}
+	if findAWSVolume(mngr, id) != nil {
+		t.Errorf("Volume %s is still listed after cleanup", id)
+	}
+}
+
+func TestIntegrationAWSBucket(t *testing.T) {
+	defer useLocalStack(t)()
+	mngr := newLocalStackManager(t)
+	name := integrationTestName("bucket")
+	client := s3.New(NewAWSSession(), &aws.Config{Region: aws.String(localStackRegion)})
+	if _, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(name)}); err != nil {
+		t.Fatalf("Could not create bucket: %s", err)
+	}
+	// Cleanup deletes the objects in the bucket before the bucket itself
+	_, err := client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(name),
+		Key:    aws.String("object"),
+		Body:   strings.NewReader(integrationTestTag),
+	})
+	if err != nil {
+		t.Fatalf("Could not put object in bucket %s: %s", name, err)
+	}
+
+	bucket := findAWSBucket(mngr, name)
+	if bucket == nil {
+		t.Fatalf("Bucket %s was not listed", name)
+	}
+	if err := bucket.SetTag(integrationTestTag, "true", false); err != nil {
+		t.Fatalf("Could not tag bucket %s: %s", name, err)
+	}
+	bucket = findAWSBucket(mngr, name)
+	if bucket == nil || bucket.Tags()[integrationTestTag] != "true" {
+		t.Fatalf("Bucket %s is not listed with the tag it was given", name)
+	}
+
+	if err := mngr.CleanupBuckets(context.Background(), []Bucket{bucket}); err != nil {
+		t.Fatalf("Could not clean up bucket %s: %s", name, err)
+	}
+	if findAWSBucket(mngr, name) != nil {
+		t.Errorf("Bucket %s is still listed after cleanup", name)
+	}
+}
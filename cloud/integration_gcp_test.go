@@ -0,0 +1,85 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build integration && !nogcp
+// +build integration,!nogcp
+
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+const (
+	// fakeGCSURLEnv is the environment variable with the URL of
+	// fake-gcs-server, which must be started with "-scheme http"
+	fakeGCSURLEnv     = "CS_FAKE_GCS_URL"
+	fakeGCSDefaultURL = "http://localhost:4443"
+	fakeGCSProject    = "cloudsweeper-integration"
+)
+
+// newFakeGCSManager returns a GCP manager using fake-gcs-server for
+// storage. There's no emulator of the compute API, so only buckets are
+// tested against GCP.
+func newFakeGCSManager(t *testing.T) (*gcpResourceManager, *storage.Service) {
+	fakeGCSURL := emulatorURL(t, fakeGCSURLEnv, fakeGCSDefaultURL)
+	storageService, err := storage.New(http.DefaultClient)
+	if err != nil {
+		t.Fatalf("Could not initialize storage service: %s", err)
+	}
+	storageService.BasePath = strings.TrimSuffix(fakeGCSURL, "/") + "/storage/v1/"
+	mngr := &gcpResourceManager{
+		projects: []string{fakeGCSProject},
+		storage:  storageService,
+		status:   NewScanStatus(),
+	}
+	return mngr, storageService
+}
+
+func findGCPBucket(mngr ResourceManager, id string) Bucket {
+	for _, bucket := range mngr.BucketsPerAccount(context.Background())[fakeGCSProject] {
+		if bucket.ID() == id {
+			return bucket
+		}
+	}
+	return nil
+}
+
+func TestIntegrationGCPBucket(t *testing.T) {
+	mngr, storageService := newFakeGCSManager(t)
+	name := integrationTestName("bucket")
+	_, err := storageService.Buckets.Insert(fakeGCSProject, &storage.Bucket{
+		Name:   name,
+		Labels: map[string]string{integrationTestTag: "true"},
+	}).Do()
+	if err != nil {
+		t.Fatalf("Could not create bucket: %s", err)
+	}
+
+	bucket := findGCPBucket(mngr, name)
+	if bucket == nil {
+		t.Fatalf("Bucket %s was not listed", name)
+	}
+	if bucket.Tags()[integrationTestTag] != "true" {
+		t.Errorf("Bucket %s is not listed with its labels as tags", name)
+	}
+	if bucket.ObjectCount() != 0 || !bucket.SizeKnown() {
+		t.Errorf("Bucket %s is listed with %d objects, size known: %t", name, bucket.ObjectCount(), bucket.SizeKnown())
+	}
+	// Tagging of buckets isn't supported on GCP, and must be a no-op
+	if err := bucket.SetTag(integrationTestTag, "false", true); err != nil {
+		t.Errorf("Tagging bucket %s failed: %s", name, err)
+	}
+
+	if err := mngr.CleanupBuckets(context.Background(), []Bucket{bucket}); err != nil {
+		t.Fatalf("Could not clean up bucket %s: %s", name, err)
+	}
+	if findGCPBucket(mngr, name) != nil {
+		t.Errorf("Bucket %s is still listed after cleanup", name)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build integration
+// +build integration
+
+package cloud
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// The integration tests run the resource managers against emulators of
+// the cloud providers, instead of real accounts. They're only built with
+// the integration build tag, run them with "make integration-test".
+
+// integrationTestTag is set on the resources created by the integration
+// tests, and used as prefix of their names
+const integrationTestTag = "cloudsweeper-integration"
+
+// emulatorStartTimeout is how long to wait for an emulator to accept
+// requests, as it may still be starting when the tests are run
+const emulatorStartTimeout = 2 * time.Minute
+
+// emulatorURL returns the URL of an emulator, taken from the environment
+// variable or the default, once the emulator accepts requests
+func emulatorURL(t *testing.T, envVar, defaultURL string) string {
+	url := os.Getenv(envVar)
+	if url == "" {
+		url = defaultURL
+	}
+	deadline := time.Now().Add(emulatorStartTimeout)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			return url
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Emulator at %s (%s) is not reachable: %s", url, envVar, err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// integrationTestName returns a unique name of a resource created by a test
+func integrationTestName(kind string) string {
+	return fmt.Sprintf("%s-%s-%d", integrationTestTag, kind, time.Now().UnixNano())
+}
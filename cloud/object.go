@@ -0,0 +1,20 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import "fmt"
+
+// PutObject writes data to an object in a bucket, in S3 in the specified
+// region in AWS, or in Cloud Storage in GCP where the region isn't used.
+// The object is replaced if it already exists.
+func PutObject(csp CSP, bucket, region, key, contentType string, data []byte) error {
+	switch csp {
+	case AWS:
+		return putAWSObject(bucket, region, key, contentType, data)
+	case GCP:
+		return putGCPObject(bucket, key, contentType, data)
+	default:
+		return fmt.Errorf("Unknown CSP %s", csp)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"bytes"
+	"fmt"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+func putGCPObject(bucket, key, contentType string, data []byte) error {
+	client, err := getGCPHttpClient(scopeGCPStorage)
+	if err != nil {
+		return err
+	}
+	storageService, err := storage.New(client)
+	if err != nil {
+		return fmt.Errorf("Could not initialize storage service: %s", err)
+	}
+	object := &storage.Object{Name: key, ContentType: contentType}
+	_, err = storageService.Objects.Insert(bucket, object).Media(bytes.NewReader(data)).Do()
+	return err
+}
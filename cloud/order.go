@@ -0,0 +1,49 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import "sort"
+
+// Ordered makes accounts be processed, and resources with equal cost be
+// listed, in a deterministic order: by account ID, then by resource ID.
+// Otherwise the order depends on map iteration, and differs between runs.
+var Ordered = true
+
+// Accounts returns the accounts of the specified resource collections,
+// sorted if Ordered is set
+func Accounts(collections map[string]*ResourceCollection) []string {
+	accounts := []string{}
+	for account := range collections {
+		accounts = append(accounts, account)
+	}
+	SortIDs(accounts)
+	return accounts
+}
+
+// AllAccounts returns the accounts of the specified collections of all
+// resources, sorted if Ordered is set
+func AllAccounts(collections map[string]*AllResourceCollection) []string {
+	accounts := []string{}
+	for account := range collections {
+		accounts = append(accounts, account)
+	}
+	SortIDs(accounts)
+	return accounts
+}
+
+// SortIDs sorts a list of IDs, such as accounts, if Ordered is set
+func SortIDs(ids []string) {
+	if Ordered {
+		sort.Strings(ids)
+	}
+}
+
+// ResourceLess reports whether a resource is ordered before another one,
+// comparing their account first and then their ID
+func ResourceLess(a, b Resource) bool {
+	if a.Owner() != b.Owner() {
+		return a.Owner() < b.Owner()
+	}
+	return a.ID() < b.ID()
+}
@@ -4,7 +4,8 @@
 package cloud
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -18,6 +19,7 @@ type baseResource struct {
 	location     string
 	public       bool
 	creationTime time.Time
+	lineage      []string
 }
 
 func (r *baseResource) CSP() CSP {
@@ -48,23 +50,96 @@ func (r *baseResource) CreationTime() time.Time {
 	return r.creationTime
 }
 
-func cleanupResources(resources []Resource) error {
-	failed := false
+func (r *baseResource) Lineage() []string {
+	return r.lineage
+}
+
+// CleanupError is returned when one or more resources could not be
+// cleaned up. Failed holds the resources that failed.
+type CleanupError struct {
+	Failed []Resource
+}
+
+func (e *CleanupError) Error() string {
+	return fmt.Sprintf("%d resource cleanups failed", len(e.Failed))
+}
+
+// SnapshotCleanupConcurrency is the maximum number of snapshots cleaned up
+// at the same time in each location, to stay below the request rate limit
+// of the cloud provider
+var SnapshotCleanupConcurrency = 10
+
+// cleanupResources cleans up all resources in parallel. Once ctx is done,
+// the resources that haven't been cleaned up yet are skipped and returned
+// as failed.
+func cleanupResources(ctx context.Context, resources []Resource) error {
+	var mu sync.Mutex
+	failed := []Resource{}
 	var wg sync.WaitGroup
 	wg.Add(len(resources))
 	for i := range resources {
 		go func(index int) {
-			err := resources[index].Cleanup()
+			err := cleanupResource(ctx, resources[index])
 			if err != nil {
-				log.Printf("Cleaning up %s for owner %s failed\n%s\n", resources[index].ID(), resources[index].Owner(), err)
-				failed = true
+				log.Printf("Cleaning up %s for owner %s failed\n%s\n", resources[index].ID(), AccountName(resources[index].Owner()), err)
+				mu.Lock()
+				failed = append(failed, resources[index])
+				mu.Unlock()
 			}
 			wg.Done()
 		}(i)
 	}
 	wg.Wait()
-	if failed {
-		return errors.New("One or more resource cleanups failed")
+	if len(failed) > 0 {
+		return &CleanupError{Failed: failed}
 	}
 	return nil
 }
+
+// cleanupResourcesPerLocation cleans up resources like cleanupResources,
+// but in batches per location, with at most concurrency resources cleaned
+// up at the same time in each location. Locations are handled in parallel.
+func cleanupResourcesPerLocation(ctx context.Context, resources []Resource, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	perLocation := make(map[string][]Resource)
+	for _, res := range resources {
+		perLocation[res.Location()] = append(perLocation[res.Location()], res)
+	}
+	var mu sync.Mutex
+	failed := []Resource{}
+	var wg sync.WaitGroup
+	for location, batch := range perLocation {
+		log.Printf("Cleaning up %d resources in %s, %d at a time\n", len(batch), location, concurrency)
+		slots := make(chan struct{}, concurrency)
+		for i := range batch {
+			wg.Add(1)
+			go func(res Resource) {
+				defer wg.Done()
+				slots <- struct{}{}
+				err := cleanupResource(ctx, res)
+				<-slots
+				if err != nil {
+					log.Printf("Cleaning up %s for owner %s failed\n%s\n", res.ID(), AccountName(res.Owner()), err)
+					mu.Lock()
+					failed = append(failed, res)
+					mu.Unlock()
+				}
+			}(batch[i])
+		}
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return &CleanupError{Failed: failed}
+	}
+	return nil
+}
+
+// cleanupResource cleans up a resource, unless ctx is done
+func cleanupResource(ctx context.Context, res Resource) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Not cleaning up %s: %s", res.ID(), err)
+	}
+	return res.Cleanup()
+}
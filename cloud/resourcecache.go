@@ -0,0 +1,775 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ResourceCache is an on-disk cache of the resources of every
+// account/project, kept in a single JSON file. Listing all resources
+// is slow, so they can be listed once, e.g. by the scan command, and
+// then read by several commands. Accounts whose data is older than a
+// TTL are listed again by Refresh, the others are read from the cache.
+type ResourceCache struct {
+	path string
+	// ctx is the context of the command using the cache, which live
+	// resources are listed with when cached resources are changed. The
+	// Resource methods making the changes don't take a context.
+	ctx context.Context
+
+	mu       sync.Mutex
+	accounts map[CSP]map[string]*cachedAccount
+	dirty    bool
+
+	liveMu sync.Mutex
+	live   map[string]map[string]Resource
+}
+
+// cachedAccount are the resources of an account/project in the cache,
+// and when they were listed. FailedRegions are the regions that could
+// not be scanned, with their errors, as in ScanStatus.
+type cachedAccount struct {
+	ScannedAt       time.Time               `json:"scanned_at"`
+	FailedRegions   map[string]string       `json:"failed_regions,omitempty"`
+	Instances       []*cachedInstance       `json:"instances,omitempty"`
+	Images          []*cachedImage          `json:"images,omitempty"`
+	Volumes         []*cachedVolume         `json:"volumes,omitempty"`
+	Snapshots       []*cachedSnapshot       `json:"snapshots,omitempty"`
+	Buckets         []*cachedBucket         `json:"buckets,omitempty"`
+	Tables          []*cachedTable          `json:"tables,omitempty"`
+	CacheClusters   []*cachedCacheCluster   `json:"cache_clusters,omitempty"`
+	Addresses       []*cachedAddress        `json:"addresses,omitempty"`
+	NetworkGateways []*cachedNetworkGateway `json:"network_gateways,omitempty"`
+	Capacities      []*cachedCapacity       `json:"capacities,omitempty"`
+	DBInstances     []*cachedDBInstance     `json:"db_instances,omitempty"`
+	DBSnapshots     []*cachedDBSnapshot     `json:"db_snapshots,omitempty"`
+}
+
+// OpenResourceCache opens the resource cache at the specified path. If
+// no file exists at the path, an empty cache is returned and the file is
+// created when it's saved. Changes to cached resources are made until
+// ctx is done.
+func OpenResourceCache(ctx context.Context, path string) (*ResourceCache, error) {
+	c := &ResourceCache{
+		path:     path,
+		ctx:      ctx,
+		accounts: make(map[CSP]map[string]*cachedAccount),
+		live:     make(map[string]map[string]Resource),
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read resource cache: %s", err)
+	}
+	if len(raw) == 0 {
+		return c, nil
+	}
+	if err = json.Unmarshal(raw, &c.accounts); err != nil {
+		return nil, fmt.Errorf("Could not parse resource cache %s: %s", path, err)
+	}
+	for _, accounts := range c.accounts {
+		for _, entry := range accounts {
+			c.attach(entry)
+		}
+	}
+	return c, nil
+}
+
+// attach links the resources of an account to the cache, so that
+// changes to them can be made to the live resources
+func (c *ResourceCache) attach(entry *cachedAccount) {
+	for _, res := range entry.Instances {
+		res.cache, res.kind = c, cachedInstanceKind
+	}
+	for _, res := range entry.Images {
+		res.cache, res.kind = c, cachedImageKind
+	}
+	for _, res := range entry.Volumes {
+		res.cache, res.kind = c, cachedVolumeKind
+	}
+	for _, res := range entry.Snapshots {
+		res.cache, res.kind = c, cachedSnapshotKind
+	}
+	for _, res := range entry.Buckets {
+		res.cache, res.kind = c, cachedBucketKind
+	}
+	for _, res := range entry.Tables {
+		res.cache, res.kind = c, cachedTableKind
+	}
+	for _, res := range entry.CacheClusters {
+		res.cache, res.kind = c, cachedCacheClusterKind
+	}
+	for _, res := range entry.Addresses {
+		res.cache, res.kind = c, cachedAddressKind
+	}
+	for _, res := range entry.NetworkGateways {
+		res.cache, res.kind = c, cachedNetworkGatewayKind
+	}
+	for _, res := range entry.Capacities {
+		res.cache, res.kind = c, cachedCapacityKind
+	}
+	for _, res := range entry.DBInstances {
+		res.cache, res.kind = c, cachedDBInstanceKind
+	}
+	for _, res := range entry.DBSnapshots {
+		res.cache, res.kind = c, cachedDBSnapshotKind
+	}
+}
+
+// StaleAccounts returns the accounts/projects, out of the specified ones,
+// that are missing in the cache, whose data is older than ttl, or whose
+// data is partial. All accounts are stale if ttl is 0.
+func (c *ResourceCache) StaleAccounts(csp CSP, accounts []string, ttl time.Duration) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stale := []string{}
+	for _, account := range accounts {
+		entry := c.accounts[csp][account]
+		if ttl <= 0 || entry == nil || time.Since(entry.ScannedAt) > ttl || len(entry.FailedRegions) > 0 {
+			stale = append(stale, account)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// Refresh lists all resources of the stale accounts/projects again (see
+// StaleAccounts), replaces their data in the cache and saves it. It
+// returns the accounts that were refreshed.
+func (c *ResourceCache) Refresh(ctx context.Context, csp CSP, accounts []string, ttl time.Duration) ([]string, error) {
+	stale := c.StaleAccounts(csp, accounts, ttl)
+	if len(stale) == 0 {
+		log.Printf("All %d accounts are up to date in the resource cache\n", len(accounts))
+		return stale, nil
+	}
+	log.Printf("Refreshing %d of %d accounts in the resource cache\n", len(stale), len(accounts))
+	mngr, err := NewManager(csp, stale...)
+	if err != nil {
+		return nil, err
+	}
+	scannedAt := time.Now()
+	fresh := make(map[string]*cachedAccount)
+	for _, account := range stale {
+		fresh[account] = &cachedAccount{ScannedAt: scannedAt, FailedRegions: make(map[string]string)}
+	}
+	for account, collection := range mngr.AllResourcesPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range collection.Instances {
+				entry.Instances = append(entry.Instances, newCachedInstance(res))
+			}
+			for _, res := range collection.Images {
+				entry.Images = append(entry.Images, newCachedImage(res))
+			}
+			for _, res := range collection.Volumes {
+				entry.Volumes = append(entry.Volumes, newCachedVolume(res))
+			}
+			for _, res := range collection.Snapshots {
+				entry.Snapshots = append(entry.Snapshots, newCachedSnapshot(res))
+			}
+		}
+	}
+	for account, resources := range mngr.BucketsPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.Buckets = append(entry.Buckets, newCachedBucket(res))
+			}
+		}
+	}
+	for account, resources := range mngr.TablesPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.Tables = append(entry.Tables, newCachedTable(res))
+			}
+		}
+	}
+	for account, resources := range mngr.CacheClustersPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.CacheClusters = append(entry.CacheClusters, newCachedCacheCluster(res))
+			}
+		}
+	}
+	for account, resources := range mngr.AddressesPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.Addresses = append(entry.Addresses, newCachedAddress(res))
+			}
+		}
+	}
+	for account, resources := range mngr.NetworkGatewaysPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.NetworkGateways = append(entry.NetworkGateways, newCachedNetworkGateway(res))
+			}
+		}
+	}
+	for account, resources := range mngr.CapacitiesPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.Capacities = append(entry.Capacities, newCachedCapacity(res))
+			}
+		}
+	}
+	for account, resources := range mngr.DBInstancesPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.DBInstances = append(entry.DBInstances, newCachedDBInstance(res))
+			}
+		}
+	}
+	for account, resources := range mngr.DBSnapshotsPerAccount(ctx) {
+		if entry := fresh[account]; entry != nil {
+			for _, res := range resources {
+				entry.DBSnapshots = append(entry.DBSnapshots, newCachedDBSnapshot(res))
+			}
+		}
+	}
+	if err := mngr.ScanStatus().Err(); err != nil {
+		for _, accountErr := range err.(AccountErrors) {
+			if entry := fresh[accountErr.Account]; entry != nil {
+				entry.FailedRegions[accountErr.Region] = accountErr.Err
+			}
+		}
+	}
+	c.mu.Lock()
+	if c.accounts[csp] == nil {
+		c.accounts[csp] = make(map[string]*cachedAccount)
+	}
+	for account, entry := range fresh {
+		c.attach(entry)
+		c.accounts[csp][account] = entry
+	}
+	c.dirty = true
+	c.mu.Unlock()
+	return stale, c.Save()
+}
+
+// Save writes the cache to a temporary file which is then moved in
+// place, so the cache is never left half written. Nothing is written if
+// the cache hasn't changed since it was opened or last saved.
+func (c *ResourceCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	raw, err := json.Marshal(c.accounts)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return fmt.Errorf("Could not write resource cache: %s", err)
+	}
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Could not write resource cache: %s", err)
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// tags returns the tags of a cached resource. Changing a tag replaces
+// the map, so the returned map is never modified.
+func (c *ResourceCache) tags(r *cachedBase) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return r.TagMap
+}
+
+func (c *ResourceCache) setTag(r *cachedBase, key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tags := make(map[string]string, len(r.TagMap)+1)
+	for k, v := range r.TagMap {
+		tags[k] = v
+	}
+	tags[key] = value
+	r.TagMap = tags
+	c.dirty = true
+}
+
+func (c *ResourceCache) removeTag(r *cachedBase, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tags := make(map[string]string, len(r.TagMap))
+	for k, v := range r.TagMap {
+		if k != key {
+			tags[k] = v
+		}
+	}
+	r.TagMap = tags
+	c.dirty = true
+}
+
+// update records a change made to a live resource in its cached resource
+func (c *ResourceCache) update(change func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	change()
+	c.dirty = true
+}
+
+// liveResource returns the live resource a cached resource was listed
+// from. The first time a resource of a kind is changed in an account,
+// the resources of that kind are listed again in the account. A listing
+// cut short by ctx is not kept, since resources would be missing from it.
+func (c *ResourceCache) liveResource(ctx context.Context, r *cachedBase) (Resource, error) {
+	c.liveMu.Lock()
+	defer c.liveMu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("Not changing %s: %s", r.Ident, err)
+	}
+	key := fmt.Sprintf("%s/%s/%s", r.Provider, r.Account, r.kind)
+	resources, listed := c.live[key]
+	if !listed {
+		mngr, err := NewManager(r.Provider, r.Account)
+		if err != nil {
+			return nil, err
+		}
+		resources = make(map[string]Resource)
+		for _, res := range listKind(ctx, mngr, r.kind, r.Account) {
+			resources[res.ID()] = res
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("Could not list %s resources in %s: %s", r.kind, r.Account, err)
+		}
+		c.live[key] = resources
+	}
+	res, exist := resources[r.Ident]
+	if !exist {
+		return nil, fmt.Errorf("%s no longer exists in %s", r.Ident, r.Account)
+	}
+	return res, nil
+}
+
+// listKind lists the live resources of a kind in an account/project
+func listKind(ctx context.Context, mngr ResourceManager, kind, account string) []Resource {
+	resources := []Resource{}
+	switch kind {
+	case cachedInstanceKind:
+		for _, res := range mngr.InstancesPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedImageKind:
+		for _, res := range mngr.ImagesPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedVolumeKind:
+		for _, res := range mngr.VolumesPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedSnapshotKind:
+		for _, res := range mngr.SnapshotsPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedBucketKind:
+		for _, res := range mngr.BucketsPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedTableKind:
+		for _, res := range mngr.TablesPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedCacheClusterKind:
+		for _, res := range mngr.CacheClustersPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedAddressKind:
+		for _, res := range mngr.AddressesPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedNetworkGatewayKind:
+		for _, res := range mngr.NetworkGatewaysPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedCapacityKind:
+		for _, res := range mngr.CapacitiesPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedDBInstanceKind:
+		for _, res := range mngr.DBInstancesPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	case cachedDBSnapshotKind:
+		for _, res := range mngr.DBSnapshotsPerAccount(ctx)[account] {
+			resources = append(resources, res)
+		}
+	}
+	return resources
+}
+
+// resourceCacheManager lists resources from a ResourceCache instead of
+// the CSP. All other calls, such as cleanups and looking up image
+// references, are passed on to the wrapped manager.
+type resourceCacheManager struct {
+	ResourceManager
+
+	csp    CSP
+	cache  *ResourceCache
+	status *ScanStatus
+}
+
+// NewResourceCacheManager returns a ResourceManager that lists the
+// resources of the accounts/projects of the specified manager from the
+// cache, use Refresh first to list the stale ones. The regions that could
+// not be scanned when the data was listed are reported by its ScanStatus,
+// and accounts missing in the cache as not accessible.
+func NewResourceCacheManager(mngr ResourceManager, csp CSP, cache *ResourceCache) ResourceManager {
+	m := &resourceCacheManager{ResourceManager: mngr, csp: csp, cache: cache, status: NewScanStatus()}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for _, account := range mngr.Owners() {
+		entry := cache.accounts[csp][account]
+		if entry == nil {
+			m.status.fail(account, GlobalScan, errors.New("missing in the resource cache"))
+			continue
+		}
+		for region, err := range entry.FailedRegions {
+			m.status.fail(account, region, errors.New(err))
+		}
+	}
+	return m
+}
+
+func (m *resourceCacheManager) ScanStatus() *ScanStatus {
+	return m.status
+}
+
+// forEachAccount calls f with the cached data of every account of the
+// manager that is in the cache
+func (m *resourceCacheManager) forEachAccount(f func(account string, entry *cachedAccount)) {
+	m.cache.mu.Lock()
+	entries := make(map[string]*cachedAccount)
+	for _, account := range m.Owners() {
+		if entry := m.cache.accounts[m.csp][account]; entry != nil {
+			entries[account] = entry
+		}
+	}
+	m.cache.mu.Unlock()
+	for account, entry := range entries {
+		f(account, entry)
+	}
+}
+
+func (m *resourceCacheManager) BucketsPerAccount(ctx context.Context) map[string][]Bucket {
+	result := make(map[string][]Bucket)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Buckets {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) InstancesPerAccount(ctx context.Context) map[string][]Instance {
+	result := make(map[string][]Instance)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Instances {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) ImagesPerAccount(ctx context.Context) map[string][]Image {
+	result := make(map[string][]Image)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Images {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) VolumesPerAccount(ctx context.Context) map[string][]Volume {
+	result := make(map[string][]Volume)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Volumes {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) SnapshotsPerAccount(ctx context.Context) map[string][]Snapshot {
+	result := make(map[string][]Snapshot)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Snapshots {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) TablesPerAccount(ctx context.Context) map[string][]Table {
+	result := make(map[string][]Table)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Tables {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) CacheClustersPerAccount(ctx context.Context) map[string][]CacheCluster {
+	result := make(map[string][]CacheCluster)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.CacheClusters {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) AddressesPerAccount(ctx context.Context) map[string][]Address {
+	result := make(map[string][]Address)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Addresses {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) NetworkGatewaysPerAccount(ctx context.Context) map[string][]NetworkGateway {
+	result := make(map[string][]NetworkGateway)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.NetworkGateways {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) CapacitiesPerAccount(ctx context.Context) map[string][]Capacity {
+	result := make(map[string][]Capacity)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Capacities {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) DBInstancesPerAccount(ctx context.Context) map[string][]DBInstance {
+	result := make(map[string][]DBInstance)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.DBInstances {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) DBSnapshotsPerAccount(ctx context.Context) map[string][]DBSnapshot {
+	result := make(map[string][]DBSnapshot)
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.DBSnapshots {
+			result[account] = append(result[account], res)
+		}
+	})
+	return result
+}
+
+func (m *resourceCacheManager) AllResourcesPerAccount(ctx context.Context) map[string]*ResourceCollection {
+	result := make(map[string]*ResourceCollection)
+	for _, account := range m.Owners() {
+		result[account] = &ResourceCollection{Owner: account}
+	}
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		collection := result[account]
+		for _, res := range entry.Instances {
+			collection.Instances = append(collection.Instances, res)
+		}
+		for _, res := range entry.Images {
+			collection.Images = append(collection.Images, res)
+		}
+		for _, res := range entry.Volumes {
+			collection.Volumes = append(collection.Volumes, res)
+		}
+		for _, res := range entry.Snapshots {
+			collection.Snapshots = append(collection.Snapshots, res)
+		}
+	})
+	return result
+}
+
+// SnapshotDependencies builds the dependency graph of the snapshots from
+// the cached images and volumes in AWS, like the AWS manager does. The
+// graph is never incomplete, so an error is returned if the data of any
+// account is partial.
+func (m *resourceCacheManager) SnapshotDependencies(ctx context.Context) (*DependencyGraph, error) {
+	if m.csp != AWS {
+		return m.ResourceManager.SnapshotDependencies(ctx)
+	}
+	if err := m.status.Err(); err != nil {
+		return nil, err
+	}
+	snapshots := make(map[string]bool)
+	dependents := []Resource{}
+	m.forEachAccount(func(account string, entry *cachedAccount) {
+		for _, res := range entry.Snapshots {
+			snapshots[res.ID()] = true
+		}
+		for _, res := range entry.Images {
+			dependents = append(dependents, res)
+		}
+		for _, res := range entry.Volumes {
+			dependents = append(dependents, res)
+		}
+	})
+	graph := NewDependencyGraph()
+	for _, dependent := range dependents {
+		for _, id := range dependent.Lineage() {
+			if snapshots[id] {
+				graph.AddDependency(id, dependent)
+			}
+		}
+	}
+	return graph, nil
+}
+
+func newCachedInstance(res Instance) *cachedInstance {
+	return &cachedInstance{
+		cachedBase: newCachedBase(res),
+		Type:       res.InstanceType(),
+		IsRunning:  res.Running(),
+		Key:        res.KeyName(),
+		Groups:     res.SecurityGroups(),
+		InboundAt:  res.LastInboundTraffic(),
+	}
+}
+
+func newCachedImage(res Image) *cachedImage {
+	return &cachedImage{
+		cachedBase:  newCachedBase(res),
+		ImageName:   res.Name(),
+		Size:        res.SizeGB(),
+		ImageFamily: res.Family(),
+		SourceImage: res.SourceImageID(),
+		SourceLoc:   res.SourceRegion(),
+	}
+}
+
+func newCachedVolume(res Volume) *cachedVolume {
+	return &cachedVolume{
+		cachedBase:  newCachedBase(res),
+		Size:        res.SizeGB(),
+		IsAttached:  res.Attached(),
+		IsEncrypted: res.Encrypted(),
+		Type:        res.VolumeType(),
+		IsRegional:  res.Regional(),
+		IOPS:        res.Iops(),
+		Throughput:  res.ThroughputMBps(),
+	}
+}
+
+func newCachedSnapshot(res Snapshot) *cachedSnapshot {
+	return &cachedSnapshot{
+		cachedBase:  newCachedBase(res),
+		IsEncrypted: res.Encrypted(),
+		IsInUse:     res.InUse(),
+		Size:        res.SizeGB(),
+	}
+}
+
+func newCachedBucket(res Bucket) *cachedBucket {
+	return &cachedBucket{
+		cachedBase:   newCachedBase(res),
+		ModifiedAt:   res.LastModified(),
+		Objects:      res.ObjectCount(),
+		Size:         res.TotalSizeGB(),
+		StorageSizes: res.StorageTypeSizesGB(),
+		IsSizeKnown:  res.SizeKnown(),
+	}
+}
+
+func newCachedTable(res Table) *cachedTable {
+	return &cachedTable{
+		cachedBase: newCachedBase(res),
+		Size:       res.SizeGB(),
+		Items:      res.ItemCount(),
+		ActiveAt:   res.LastActivity(),
+	}
+}
+
+func newCachedCacheCluster(res CacheCluster) *cachedCacheCluster {
+	return &cachedCacheCluster{
+		cachedBase:    newCachedBase(res),
+		ClusterEngine: res.Engine(),
+		Type:          res.NodeType(),
+		Nodes:         res.NodeCount(),
+		ActiveAt:      res.LastActivity(),
+	}
+}
+
+func newCachedAddress(res Address) *cachedAddress {
+	return &cachedAddress{
+		cachedBase: newCachedBase(res),
+		Address:    res.IP(),
+		IsInUse:    res.InUse(),
+	}
+}
+
+func newCachedNetworkGateway(res NetworkGateway) *cachedNetworkGateway {
+	return &cachedNetworkGateway{
+		cachedBase: newCachedBase(res),
+		Type:       res.GatewayType(),
+		NetworkID:  res.Network(),
+		ZoneCount:  res.Zones(),
+		ActiveAt:   res.LastActivity(),
+	}
+}
+
+func newCachedCapacity(res Capacity) *cachedCapacity {
+	return &cachedCapacity{
+		cachedBase:   newCachedBase(res),
+		Type:         res.CapacityType(),
+		InstanceKind: res.InstanceType(),
+		Total:        res.TotalInstances(),
+		Used:         res.UsedInstances(),
+	}
+}
+
+func newCachedDBInstance(res DBInstance) *cachedDBInstance {
+	return &cachedDBInstance{
+		cachedBase: newCachedBase(res),
+		DBEngine:   res.Engine(),
+		Class:      res.InstanceClass(),
+		Storage:    res.StorageGB(),
+		IsMultiAZ:  res.MultiAZ(),
+		IsStopped:  res.Stopped(),
+		ActiveAt:   res.LastActivity(),
+	}
+}
+
+func newCachedDBSnapshot(res DBSnapshot) *cachedDBSnapshot {
+	return &cachedDBSnapshot{
+		cachedBase: newCachedBase(res),
+		DBEngine:   res.Engine(),
+		InstanceID: res.DBInstanceID(),
+		Storage:    res.StorageGB(),
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	assumeRoleARNTemplate = "arn:aws:iam::%s:role/Cloudsweeper"
+
+	// accountPlaceholder is replaced by the ID of the accessed
+	// account in the ARN of a role
+	accountPlaceholder = "%s"
+	// externalIDSeparator separates the ARN of a role from its
+	// external ID when parsing a role chain
+	externalIDSeparator = "|"
+)
+
+// RoleHop is a role assumed on the way to an AWS account
+type RoleHop struct {
+	// ARN of the role. If it contains %s, it's replaced by the ID of
+	// the account being accessed.
+	ARN string
+	// ExternalID is the external ID required by the role, if any
+	ExternalID string
+}
+
+// RoleChain is the roles assumed, in order, to access an AWS account. The
+// credentials of every role are used to assume the next one. By default
+// the Cloudsweeper role in the account is assumed directly.
+var RoleChain = []RoleHop{RoleHop{ARN: assumeRoleARNTemplate}}
+
+// ParseRoleChain parses a role chain, where every hop is on the form
+// "<ARN>" or "<ARN>|<external ID>". The last role must be the one in the
+// accessed account, so its ARN must contain %s.
+func ParseRoleChain(hops []string) ([]RoleHop, error) {
+	if len(hops) == 0 {
+		return nil, errors.New("Role chain is empty")
+	}
+	chain := []RoleHop{}
+	for _, hop := range hops {
+		parts := strings.SplitN(hop, externalIDSeparator, 2)
+		roleHop := RoleHop{ARN: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			roleHop.ExternalID = strings.TrimSpace(parts[1])
+		}
+		if roleHop.ARN == "" {
+			return nil, fmt.Errorf("Role chain has a hop without ARN: %q", hop)
+		}
+		if strings.Count(roleHop.ARN, accountPlaceholder) > 1 {
+			return nil, fmt.Errorf("ARN of role %s can only contain %s once", roleHop.ARN, accountPlaceholder)
+		}
+		chain = append(chain, roleHop)
+	}
+	last := chain[len(chain)-1]
+	if !strings.Contains(last.ARN, accountPlaceholder) {
+		return nil, fmt.Errorf("ARN of the last role %s must contain %s, to be replaced by the account ID", last.ARN, accountPlaceholder)
+	}
+	return chain, nil
+}
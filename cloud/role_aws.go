@@ -0,0 +1,40 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// AWSCredentials returns credentials for the specified account, assuming
+// all roles in RoleChain
+func AWSCredentials(sess *session.Session, account string) *credentials.Credentials {
+	var creds *credentials.Credentials
+	for _, hop := range RoleChain {
+		arn := hop.ARN
+		if strings.Contains(arn, accountPlaceholder) {
+			arn = fmt.Sprintf(arn, account)
+		}
+		hopSess := sess
+		if creds != nil {
+			hopSess = sess.Copy(&aws.Config{Credentials: creds})
+		}
+		externalID := hop.ExternalID
+		creds = stscreds.NewCredentials(hopSess, arn, func(p *stscreds.AssumeRoleProvider) {
+			if externalID != "" {
+				p.ExternalID = aws.String(externalID)
+			}
+		})
+	}
+	return creds
+}
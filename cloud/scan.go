@@ -0,0 +1,145 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ScanStatus tracks the regions of every account/project that could not
+// be scanned, e.g. a new region where the Cloudsweeper role is missing.
+// The resources in those regions are missing from the results, so the
+// data of their accounts is partial. The methods of a nil ScanStatus
+// report that all scans succeeded.
+type ScanStatus struct {
+	mu sync.Mutex
+	// failures are the errors of the failed scans, by account and region
+	failures map[string]map[string]string
+}
+
+// GlobalScan is the region of scans that aren't regional, such as listing
+// buckets, and of accounts that couldn't be accessed at all
+const GlobalScan = "global"
+
+// NewScanStatus returns a ScanStatus without any failed scans
+func NewScanStatus() *ScanStatus {
+	return &ScanStatus{failures: make(map[string]map[string]string)}
+}
+
+// fail records that a region of an account could not be scanned
+func (s *ScanStatus) fail(account, region string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures[account] == nil {
+		s.failures[account] = make(map[string]string)
+	}
+	s.failures[account][region] = err.Error()
+	log.Printf("Could not scan %s of %s, its data is partial: %s\n", region, AccountName(account), err)
+}
+
+// Partial returns true if any region of the account could not be scanned
+func (s *ScanStatus) Partial(account string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.failures[account]) > 0
+}
+
+// FailedRegions returns the regions of the account that could not be
+// scanned, sorted, including GlobalScan if a global scan failed
+func (s *ScanStatus) FailedRegions(account string) []string {
+	regions := []string{}
+	if s == nil {
+		return regions
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for region := range s.failures[account] {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// PartialAccounts returns the accounts with partial data, sorted
+func (s *ScanStatus) PartialAccounts() []string {
+	accounts := []string{}
+	if s == nil {
+		return accounts
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for account := range s.failures {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// Err returns the failed scans as AccountErrors, sorted by account and
+// region, or nil if all scans succeeded
+func (s *ScanStatus) Err() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := AccountErrors{}
+	for account, regions := range s.failures {
+		for region, err := range regions {
+			errs = append(errs, AccountError{Account: account, Region: region, Err: err})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Account != errs[j].Account {
+			return errs[i].Account < errs[j].Account
+		}
+		return errs[i].Region < errs[j].Region
+	})
+	return errs
+}
+
+// AccountError is why a region of an account, or the whole account if
+// the region is GlobalScan, could not be processed
+type AccountError struct {
+	Account string
+	Region  string
+	Err     string
+}
+
+// AccountErrors are the errors of the accounts that failed. They are
+// returned instead of stopping at the first failing account, so that one
+// misbehaving account doesn't fail a sweep of all the others.
+type AccountErrors []AccountError
+
+func (e AccountErrors) Error() string {
+	msgs := []string{}
+	for _, err := range e {
+		msgs = append(msgs, fmt.Sprintf("%s (%s): %s", err.Account, err.Region, err.Err))
+	}
+	return fmt.Sprintf("%d accounts failed: %s", len(e.Accounts()), strings.Join(msgs, "; "))
+}
+
+// Accounts returns the accounts that failed, sorted
+func (e AccountErrors) Accounts() []string {
+	seen := make(map[string]bool)
+	accounts := []string{}
+	for _, err := range e {
+		if !seen[err.Account] {
+			seen[err.Account] = true
+			accounts = append(accounts, err.Account)
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
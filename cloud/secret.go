@@ -0,0 +1,37 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// AWSSecretPrefix is the prefix of references to secrets in AWS Secrets
+	// Manager, on the form aws-secretsmanager://<name or ARN>[#<JSON key>]
+	AWSSecretPrefix = "aws-secretsmanager://"
+	// GCPSecretPrefix is the prefix of references to secrets in GCP Secret
+	// Manager, on the form gcp-secretmanager://projects/<project>/secrets/<name>[/versions/<version>]
+	GCPSecretPrefix = "gcp-secretmanager://"
+)
+
+// IsSecretReference returns true if the value refers to a secret in a
+// secret manager, rather than being a value itself
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, AWSSecretPrefix) || strings.HasPrefix(value, GCPSecretPrefix)
+}
+
+// ResolveSecret returns the value of the secret that a reference refers
+// to. Errors never include the value of the secret.
+func ResolveSecret(reference string) (string, error) {
+	switch {
+	case strings.HasPrefix(reference, AWSSecretPrefix):
+		return resolveAWSSecret(strings.TrimPrefix(reference, AWSSecretPrefix))
+	case strings.HasPrefix(reference, GCPSecretPrefix):
+		return resolveGCPSecret(strings.TrimPrefix(reference, GCPSecretPrefix))
+	default:
+		return "", fmt.Errorf("%q is not a secret reference", reference)
+	}
+}
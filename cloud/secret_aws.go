@@ -0,0 +1,54 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// resolveAWSSecret gets a secret from AWS Secrets Manager, in the account
+// Cloudsweeper runs in. Secrets stored as JSON can be referred to by a key
+// after a #, since that's how the AWS console stores key/value secrets.
+func resolveAWSSecret(id string) (string, error) {
+	key := ""
+	if i := strings.LastIndex(id, "#"); i >= 0 {
+		id, key = id[:i], id[i+1:]
+	}
+	sess := NewAWSSession()
+	region := aws.StringValue(sess.Config.Region)
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	} else if region == "" {
+		region = defaultAWSRegion
+	}
+	client := secretsmanager.New(sess, &aws.Config{Region: aws.String(region)})
+	output, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("Could not get AWS secret %s: %s", id, err)
+	}
+	value := aws.StringValue(output.SecretString)
+	if output.SecretString == nil {
+		value = string(output.SecretBinary)
+	}
+	if key == "" {
+		return value, nil
+	}
+	values := make(map[string]string)
+	if err := json.Unmarshal([]byte(value), &values); err != nil {
+		return "", fmt.Errorf("AWS secret %s is not a JSON object of strings", id)
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("AWS secret %s has no key %s", id, key)
+	}
+	return value, nil
+}
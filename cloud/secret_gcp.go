@@ -0,0 +1,55 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const gcpSecretManagerURL = "https://secretmanager.googleapis.com/v1/"
+
+// resolveGCPSecret accesses a secret version in GCP Secret Manager, the
+// latest version is used if none is specified
+func resolveGCPSecret(name string) (string, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	client, err := getGCPHttpClient(scopeGCPCloud)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(gcpSecretManagerURL + name + ":access")
+	if err != nil {
+		return "", fmt.Errorf("Could not get GCP secret %s: %s", name, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("Could not read GCP secret %s: %s", name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Could not get GCP secret %s: %s", name, resp.Status)
+	}
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &version); err != nil {
+		return "", fmt.Errorf("Could not parse GCP secret %s: %s", name, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("Could not decode GCP secret %s: %s", name, err)
+	}
+	return string(data), nil
+}
@@ -4,15 +4,8 @@
 package cloud
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"log"
-
-	"github.com/aws/aws-sdk-go/aws/awserr"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	compute "google.golang.org/api/compute/v1"
 )
 
 type baseSnapshot struct {
@@ -34,7 +27,7 @@ func (s *baseSnapshot) SizeGB() int64 {
 	return s.sizeGB
 }
 
-func cleanupSnapshots(snapshots []Snapshot) error {
+func cleanupSnapshots(ctx context.Context, snapshots []Snapshot) error {
 	resList := []Resource{}
 	for i := range snapshots {
 		v, ok := snapshots[i].(Resource)
@@ -43,100 +36,5 @@ func cleanupSnapshots(snapshots []Snapshot) error {
 		}
 		resList = append(resList, v)
 	}
-	return cleanupResources(resList)
-}
-
-// AWS
-
-type awsSnapshot struct {
-	baseSnapshot
-}
-
-func (s *awsSnapshot) Cleanup() error {
-	log.Printf("Cleaning up snapshot %s in %s", s.ID(), s.Owner())
-	return awsTryWithBackoff(s.cleanup)
-}
-
-func (s *awsSnapshot) cleanup() error {
-	client := clientForAWSResource(s)
-	input := &ec2.DeleteSnapshotInput{
-		SnapshotId: aws.String(s.ID()),
-	}
-	_, err := client.DeleteSnapshot(input)
-	if err != nil {
-		aerr, ok := err.(awserr.Error)
-		if ok && aerr.Code() == requestLimitErrorCode {
-			return errAWSRequestLimit
-		}
-	}
-	return err
-}
-
-func (s *awsSnapshot) SetTag(key, value string, overwrite bool) error {
-	return addAWSTag(s, key, value, overwrite)
-}
-
-func (s *awsSnapshot) RemoveTag(key string) error {
-	return removeAWSTag(s, key)
-}
-
-// GCP
-
-type gcpSnapshot struct {
-	baseSnapshot
-	compute *compute.Service
-}
-
-func (s *gcpSnapshot) Cleanup() error {
-	log.Printf("Cleaning up snapshot %s in %s", s.ID(), s.Owner())
-	_, err := s.compute.Snapshots.Delete(s.Owner(), s.ID()).Do()
-	return err
-}
-
-func (s *gcpSnapshot) SetTag(key, value string, overwrite bool) error {
-	snap, err := s.compute.Snapshots.Get(s.Owner(), s.ID()).Do()
-	if err != nil {
-		return err
-	}
-	newLabels := snap.Labels
-	if newLabels == nil {
-		newLabels = make(map[string]string)
-	}
-	if _, exist := newLabels[key]; exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, s.ID())
-	}
-	newLabels[key] = value
-	req := &compute.GlobalSetLabelsRequest{
-		Labels:           newLabels,
-		LabelFingerprint: snap.LabelFingerprint,
-	}
-	_, err = s.compute.Snapshots.SetLabels(s.Owner(), s.ID(), req).Do()
-	if err != nil {
-		return err
-	}
-	s.tags = newLabels
-	return nil
-}
-
-func (s *gcpSnapshot) RemoveTag(key string) error {
-	newLabels := make(map[string]string)
-	for k, val := range s.tags {
-		if k != key {
-			newLabels[k] = val
-		}
-	}
-	snap, err := s.compute.Snapshots.Get(s.Owner(), s.ID()).Do()
-	if err != nil {
-		return err
-	}
-	req := &compute.GlobalSetLabelsRequest{
-		Labels:           newLabels,
-		LabelFingerprint: snap.LabelFingerprint,
-	}
-	_, err = s.compute.Snapshots.SetLabels(s.Owner(), s.ID(), req).Do()
-	if err != nil {
-		return err
-	}
-	s.tags = newLabels
-	return nil
+	return cleanupResourcesPerLocation(ctx, resList, SnapshotCleanupConcurrency)
 }
@@ -0,0 +1,47 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type awsSnapshot struct {
+	baseSnapshot
+}
+
+func (s *awsSnapshot) Cleanup() error {
+	log.Printf("Cleaning up snapshot %s in %s", s.ID(), AccountName(s.Owner()))
+	return awsTryWithBackoff(s.cleanup)
+}
+
+func (s *awsSnapshot) cleanup() error {
+	client := clientForAWSResource(s)
+	input := &ec2.DeleteSnapshotInput{
+		SnapshotId: aws.String(s.ID()),
+	}
+	_, err := client.DeleteSnapshot(input)
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func (s *awsSnapshot) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(s, key, value, overwrite)
+}
+
+func (s *awsSnapshot) RemoveTag(key string) error {
+	return removeAWSTag(s, key)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+type gcpSnapshot struct {
+	baseSnapshot
+	compute *compute.Service
+}
+
+func (s *gcpSnapshot) Cleanup() error {
+	log.Printf("Cleaning up snapshot %s in %s", s.ID(), AccountName(s.Owner()))
+	_, err := s.compute.Snapshots.Delete(s.Owner(), s.ID()).Do()
+	return err
+}
+
+func (s *gcpSnapshot) SetTag(key, value string, overwrite bool) error {
+	snap, err := s.compute.Snapshots.Get(s.Owner(), s.ID()).Do()
+	if err != nil {
+		return err
+	}
+	newLabels := snap.Labels
+	if newLabels == nil {
+		newLabels = make(map[string]string)
+	}
+	if _, exist := newLabels[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, s.ID())
+	}
+	newLabels[key] = value
+	req := &compute.GlobalSetLabelsRequest{
+		Labels:           newLabels,
+		LabelFingerprint: snap.LabelFingerprint,
+	}
+	_, err = s.compute.Snapshots.SetLabels(s.Owner(), s.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	s.tags = newLabels
+	return nil
+}
+
+func (s *gcpSnapshot) RemoveTag(key string) error {
+	newLabels := make(map[string]string)
+	for k, val := range s.tags {
+		if k != key {
+			newLabels[k] = val
+		}
+	}
+	snap, err := s.compute.Snapshots.Get(s.Owner(), s.ID()).Do()
+	if err != nil {
+		return err
+	}
+	req := &compute.GlobalSetLabelsRequest{
+		Labels:           newLabels,
+		LabelFingerprint: snap.LabelFingerprint,
+	}
+	_, err = s.compute.Snapshots.SetLabels(s.Owner(), s.ID(), req).Do()
+	if err != nil {
+		return err
+	}
+	s.tags = newLabels
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type baseTable struct {
+	baseResource
+	sizeGB       float64
+	itemCount    int64
+	lastActivity time.Time
+}
+
+func (t *baseTable) SizeGB() float64 {
+	return t.sizeGB
+}
+
+func (t *baseTable) ItemCount() int64 {
+	return t.itemCount
+}
+
+func (t *baseTable) LastActivity() time.Time {
+	return t.lastActivity
+}
+
+func cleanupTables(ctx context.Context, tables []Table) error {
+	resList := []Resource{}
+	for i := range tables {
+		v, ok := tables[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert Table to Resource")
+		}
+		resList = append(resList, v)
+	}
+	return cleanupResources(ctx, resList)
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type awsTable struct {
+	baseTable
+	arn string
+}
+
+// Cleanup will delete this DynamoDB table
+func (t *awsTable) Cleanup() error {
+	log.Printf("Cleaning up table %s in %s", t.ID(), AccountName(t.Owner()))
+	return awsTryWithBackoff(t.cleanup)
+}
+
+func (t *awsTable) cleanup() error {
+	client := dynamoDBClientForAWSResource(t)
+	input := &dynamodb.DeleteTableInput{
+		TableName: aws.String(t.ID()),
+	}
+	_, err := client.DeleteTable(input)
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == dynamodb.ErrCodeLimitExceededException {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+func (t *awsTable) SetTag(key, value string, overwrite bool) error {
+	if _, exist := t.Tags()[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, t.ID())
+	}
+	client := dynamoDBClientForAWSResource(t)
+	input := &dynamodb.TagResourceInput{
+		ResourceArn: aws.String(t.arn),
+		Tags: []*dynamodb.Tag{&dynamodb.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		}},
+	}
+	_, err := client.TagResource(input)
+	return err
+}
+
+func (t *awsTable) RemoveTag(key string) error {
+	if _, exist := t.Tags()[key]; !exist {
+		return nil
+	}
+	client := dynamoDBClientForAWSResource(t)
+	input := &dynamodb.UntagResourceInput{
+		ResourceArn: aws.String(t.arn),
+		TagKeys:     aws.StringSlice([]string{key}),
+	}
+	_, err := client.UntagResource(input)
+	return err
+}
+
+func dynamoDBClientForAWSResource(res Resource) *dynamodb.DynamoDB {
+	sess := NewAWSSession()
+	creds := AWSCredentials(sess, res.Owner())
+	return dynamodb.New(sess, &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(res.Location()),
+	})
+}
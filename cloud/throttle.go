@@ -0,0 +1,130 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloud
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// ThrottleStats counts the requests to the cloud provider that were
+// throttled during a run
+type ThrottleStats struct {
+	// Throttled is the number of attempts that were throttled
+	Throttled int
+	// Exhausted is the number of requests that were still throttled
+	// after all retries, and failed
+	Exhausted int
+}
+
+var (
+	// AWSMaxConcurrentRequests limits the number of regions, of all
+	// accounts, that are listed at the same time, which bounds the number
+	// of concurrent requests to AWS. 0 means there is no limit.
+	AWSMaxConcurrentRequests = 0
+	// AWSRequestsPerSecond limits the rate of all requests to AWS, shared
+	// by all accounts, regions and services. 0 means there is no limit.
+	AWSRequestsPerSecond = 0
+
+	throttleMutex sync.Mutex
+	throttleStats ThrottleStats
+
+	awsLimitsOnce  sync.Once
+	awsWorkers     chan struct{}
+	awsRateLimiter *tokenBucket
+)
+
+// Throttling returns the number of requests throttled so far
+func Throttling() ThrottleStats {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	return throttleStats
+}
+
+// recordThrottle counts a throttled attempt, exhausted is true if no more
+// retries are made
+func recordThrottle(exhausted bool) {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	throttleStats.Throttled++
+	if exhausted {
+		throttleStats.Exhausted++
+	}
+}
+
+// initAWSLimits creates the worker pool and rate limiter shared by all
+// AWS requests, the first time they're used
+func initAWSLimits() {
+	awsLimitsOnce.Do(func() {
+		if AWSMaxConcurrentRequests > 0 {
+			awsWorkers = make(chan struct{}, AWSMaxConcurrentRequests)
+		}
+		if AWSRequestsPerSecond > 0 {
+			awsRateLimiter = newTokenBucket(float64(AWSRequestsPerSecond))
+		}
+	})
+}
+
+// acquireAWSWorker waits for a free worker in the pool limited by
+// AWSMaxConcurrentRequests. It must be followed by releaseAWSWorker.
+func acquireAWSWorker() {
+	initAWSLimits()
+	if awsWorkers != nil {
+		awsWorkers <- struct{}{}
+	}
+}
+
+func releaseAWSWorker() {
+	if awsWorkers != nil {
+		<-awsWorkers
+	}
+}
+
+// waitForAWSRequest waits until another request to AWS is allowed by
+// AWSRequestsPerSecond, or ctx is done
+func waitForAWSRequest(ctx context.Context) error {
+	initAWSLimits()
+	if awsRateLimiter == nil {
+		return nil
+	}
+	return awsRateLimiter.wait(ctx)
+}
+
+// tokenBucket is a rate limiter allowing a number of requests per second
+// on average, and bursts of up to one second of requests
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// wait takes a token from the bucket, waiting for one to be added if
+// it's empty. ctx being done stops the wait.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
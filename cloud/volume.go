@@ -4,22 +4,20 @@
 package cloud
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	compute "google.golang.org/api/compute/v1"
 )
 
 type baseVolume struct {
 	baseResource
-	sizeGB     int64
-	attached   bool
-	encrypted  bool
-	volumeType string
+	sizeGB         int64
+	attached       bool
+	encrypted      bool
+	volumeType     string
+	regional       bool
+	iops           int64
+	throughputMBps int64
 }
 
 func (v *baseVolume) SizeGB() int64 {
@@ -38,109 +36,43 @@ func (v *baseVolume) VolumeType() string {
 	return v.volumeType
 }
 
-func cleanupVolumes(volumes []Volume) error {
-	resList := []Resource{}
-	for i := range volumes {
-		v, ok := volumes[i].(Resource)
-		if !ok {
-			return errors.New("Could not convert Volume to Resource")
-		}
-		resList = append(resList, v)
-	}
-	return cleanupResources(resList)
+func (v *baseVolume) Regional() bool {
+	return v.regional
 }
 
-// AWS
-
-type awsVolume struct {
-	baseVolume
+func (v *baseVolume) Iops() int64 {
+	return v.iops
 }
 
-func (v *awsVolume) Cleanup() error {
-	log.Printf("Cleaning up volume %s in %s", v.ID(), v.Owner())
-	return awsTryWithBackoff(v.cleanup)
+func (v *baseVolume) ThroughputMBps() int64 {
+	return v.throughputMBps
 }
 
-func (v *awsVolume) cleanup() error {
-	client := clientForAWSResource(v)
-	input := &ec2.DeleteVolumeInput{
-		VolumeId: aws.String(v.ID()),
-	}
-	_, err := client.DeleteVolume(input)
-	if err != nil {
-		aerr, ok := err.(awserr.Error)
-		if ok && aerr.Code() == requestLimitErrorCode {
-			return errAWSRequestLimit
+func cleanupVolumes(ctx context.Context, volumes []Volume) error {
+	resList := []Resource{}
+	for i := range volumes {
+		v, ok := volumes[i].(Resource)
+		if !ok {
+			return errors.New("Could not convert Volume to Resource")
 		}
+		resList = append(resList, v)
 	}
-	return err
+	return cleanupResources(ctx, resList)
 }
 
-func (v *awsVolume) SetTag(key, value string, overwrite bool) error {
-	return addAWSTag(v, key, value, overwrite)
+// volumeSnapshotter is implemented by volumes that can be snapshotted,
+// see SnapshotVolume
+type volumeSnapshotter interface {
+	snapshot(tags map[string]string) (string, error)
 }
 
-func (v *awsVolume) RemoveTag(key string) error {
-	return removeAWSTag(v, key)
-}
-
-// GCP
-
-type gcpVolume struct {
-	baseVolume
-	compute *compute.Service
-}
-
-func (v *gcpVolume) Cleanup() error {
-	log.Printf("Cleaning up volume %s in %s", v.ID(), v.Owner())
-	_, err := v.compute.Disks.Delete(v.Owner(), v.Location(), v.ID()).Do()
-	return err
-}
-
-func (v *gcpVolume) SetTag(key, value string, overwrite bool) error {
-	disk, err := v.compute.Disks.Get(v.Owner(), v.Location(), v.ID()).Do()
-	if err != nil {
-		return err
-	}
-	newLabels := disk.Labels
-	if newLabels == nil {
-		newLabels = make(map[string]string)
-	}
-	if _, exist := newLabels[key]; exist && !overwrite {
-		return fmt.Errorf("Key %s already exist on %s", key, v.ID())
-	}
-	newLabels[key] = value
-	req := &compute.ZoneSetLabelsRequest{
-		LabelFingerprint: disk.LabelFingerprint,
-		Labels:           newLabels,
-	}
-	_, err = v.compute.Disks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
-	if err != nil {
-		return err
-	}
-	v.tags = newLabels
-	return nil
-}
-
-func (v *gcpVolume) RemoveTag(key string) error {
-	newLabels := make(map[string]string)
-	for k, val := range v.tags {
-		if k != key {
-			newLabels[k] = val
-		}
-	}
-	disk, err := v.compute.Disks.Get(v.Owner(), v.Location(), v.ID()).Do()
-	if err != nil {
-		return err
-	}
-	req := &compute.ZoneSetLabelsRequest{
-		Labels:           newLabels,
-		LabelFingerprint: disk.LabelFingerprint,
-	}
-	_, err = v.compute.Disks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
-	if err != nil {
-		return err
+// SnapshotVolume takes a snapshot of a volume with the specified tags,
+// and waits for it to complete, so that the volume can be deleted
+// afterwards. It returns the ID of the snapshot.
+func SnapshotVolume(volume Volume, tags map[string]string) (string, error) {
+	snapshotter, ok := volume.(volumeSnapshotter)
+	if !ok {
+		return "", fmt.Errorf("Volume %s can't be snapshotted", volume.ID())
 	}
-	v.tags = newLabels
-	return nil
+	return snapshotter.snapshot(tags)
 }
@@ -0,0 +1,80 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+type awsVolume struct {
+	baseVolume
+}
+
+func (v *awsVolume) Cleanup() error {
+	log.Printf("Cleaning up volume %s in %s", v.ID(), AccountName(v.Owner()))
+	return awsTryWithBackoff(v.cleanup)
+}
+
+func (v *awsVolume) cleanup() error {
+	client := clientForAWSResource(v)
+	input := &ec2.DeleteVolumeInput{
+		VolumeId: aws.String(v.ID()),
+	}
+	_, err := client.DeleteVolume(input)
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == requestLimitErrorCode {
+			return errAWSRequestLimit
+		}
+	}
+	return err
+}
+
+// snapshot takes a snapshot of the volume with the specified tags, and
+// waits for it to complete
+func (v *awsVolume) snapshot(tags map[string]string) (string, error) {
+	log.Printf("Taking a snapshot of volume %s in %s", v.ID(), AccountName(v.Owner()))
+	client := clientForAWSResource(v)
+	ec2Tags := []*ec2.Tag{}
+	for key, value := range tags {
+		ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	input := &ec2.CreateSnapshotInput{
+		VolumeId:    aws.String(v.ID()),
+		Description: aws.String(fmt.Sprintf("Archive of %s taken by Cloudsweeper", v.ID())),
+		TagSpecifications: []*ec2.TagSpecification{&ec2.TagSpecification{
+			ResourceType: aws.String(ec2.ResourceTypeSnapshot),
+			Tags:         ec2Tags,
+		}},
+	}
+	var snapshot *ec2.Snapshot
+	err := awsTryWithBackoff(func() error {
+		var err error
+		snapshot, err = client.CreateSnapshot(input)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	err = client.WaitUntilSnapshotCompleted(&ec2.DescribeSnapshotsInput{
+		SnapshotIds: []*string{snapshot.SnapshotId},
+	})
+	return aws.StringValue(snapshot.SnapshotId), err
+}
+
+func (v *awsVolume) SetTag(key, value string, overwrite bool) error {
+	return addAWSTag(v, key, value, overwrite)
+}
+
+func (v *awsVolume) RemoveTag(key string) error {
+	return removeAWSTag(v, key)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !nogcp
+// +build !nogcp
+
+package cloud
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	compute "google.golang.org/api/compute/v1"
+)
+
+type gcpVolume struct {
+	baseVolume
+	compute *compute.Service
+}
+
+func (v *gcpVolume) Cleanup() error {
+	log.Printf("Cleaning up volume %s in %s", v.ID(), AccountName(v.Owner()))
+	if v.Regional() {
+		_, err := v.compute.RegionDisks.Delete(v.Owner(), v.Location(), v.ID()).Do()
+		return err
+	}
+	_, err := v.compute.Disks.Delete(v.Owner(), v.Location(), v.ID()).Do()
+	return err
+}
+
+// gcpOperationPollInterval is how often an operation is checked while
+// waiting for it to finish
+const gcpOperationPollInterval = 10 * time.Second
+
+// snapshot takes a snapshot of the disk with the specified labels, and
+// waits for it to complete
+func (v *gcpVolume) snapshot(labels map[string]string) (string, error) {
+	log.Printf("Taking a snapshot of volume %s in %s", v.ID(), AccountName(v.Owner()))
+	suffix := "-archive-" + clock.Now().Format("20060102")
+	name := v.ID()
+	if len(name)+len(suffix) > 63 {
+		name = name[:63-len(suffix)]
+	}
+	name += suffix
+	snapshot := &compute.Snapshot{
+		Name:        name,
+		Description: fmt.Sprintf("Archive of %s taken by Cloudsweeper", v.ID()),
+		Labels:      labels,
+	}
+	var op *compute.Operation
+	var err error
+	if v.Regional() {
+		op, err = v.compute.RegionDisks.CreateSnapshot(v.Owner(), v.Location(), v.ID(), snapshot).Do()
+	} else {
+		op, err = v.compute.Disks.CreateSnapshot(v.Owner(), v.Location(), v.ID(), snapshot).Do()
+	}
+	for err == nil && op.Status != "DONE" {
+		time.Sleep(gcpOperationPollInterval)
+		if v.Regional() {
+			op, err = v.compute.RegionOperations.Get(v.Owner(), v.Location(), op.Name).Do()
+		} else {
+			op, err = v.compute.ZoneOperations.Get(v.Owner(), v.Location(), op.Name).Do()
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return "", fmt.Errorf("Could not snapshot %s: %s", v.ID(), op.Error.Errors[0].Message)
+	}
+	return name, nil
+}
+
+func (v *gcpVolume) getDisk() (*compute.Disk, error) {
+	if v.Regional() {
+		return v.compute.RegionDisks.Get(v.Owner(), v.Location(), v.ID()).Do()
+	}
+	return v.compute.Disks.Get(v.Owner(), v.Location(), v.ID()).Do()
+}
+
+func (v *gcpVolume) setLabels(labels map[string]string, fingerprint string) error {
+	if v.Regional() {
+		req := &compute.RegionSetLabelsRequest{
+			LabelFingerprint: fingerprint,
+			Labels:           labels,
+		}
+		_, err := v.compute.RegionDisks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
+		return err
+	}
+	req := &compute.ZoneSetLabelsRequest{
+		LabelFingerprint: fingerprint,
+		Labels:           labels,
+	}
+	_, err := v.compute.Disks.SetLabels(v.Owner(), v.Location(), v.ID(), req).Do()
+	return err
+}
+
+func (v *gcpVolume) SetTag(key, value string, overwrite bool) error {
+	disk, err := v.getDisk()
+	if err != nil {
+		return err
+	}
+	newLabels := disk.Labels
+	if newLabels == nil {
+		newLabels = make(map[string]string)
+	}
+	if _, exist := newLabels[key]; exist && !overwrite {
+		return fmt.Errorf("Key %s already exist on %s", key, v.ID())
+	}
+	newLabels[key] = value
+	err = v.setLabels(newLabels, disk.LabelFingerprint)
+	if err != nil {
+		return err
+	}
+	v.tags = newLabels
+	return nil
+}
+
+func (v *gcpVolume) RemoveTag(key string) error {
+	newLabels := make(map[string]string)
+	for k, val := range v.tags {
+		if k != key {
+			newLabels[k] = val
+		}
+	}
+	disk, err := v.getDisk()
+	if err != nil {
+		return err
+	}
+	err = v.setLabels(newLabels, disk.LabelFingerprint)
+	if err != nil {
+		return err
+	}
+	v.tags = newLabels
+	return nil
+}
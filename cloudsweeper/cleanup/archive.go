@@ -0,0 +1,105 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+	"sync"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// ArchiveVolumeDays is the number of days volumes are kept as a snapshot
+// after they're cleaned up. 0 means volumes are deleted without being
+// archived.
+var ArchiveVolumeDays = 0
+
+// ArchiveConcurrency is the maximum number of volumes of an account that
+// are snapshotted at the same time, to stay clear of the snapshot limits
+// of the cloud provider
+var ArchiveConcurrency = 5
+
+// archiveVolumes snapshots the volumes to clean up, if ArchiveVolumeDays
+// is set, and returns those that were archived and can be deleted. The
+// snapshots are tagged with filter.ArchiveTagKey and an expiry date
+// ArchiveVolumeDays from now, after which they're cleaned up like other
+// expired resources. Volumes that could not be archived are not deleted,
+// and counted as failed.
+func archiveVolumes(owner string, volumes []cloud.Volume) (archived []cloud.Volume, failed int) {
+	if ArchiveVolumeDays <= 0 || len(volumes) == 0 {
+		return volumes, 0
+	}
+	expiry := clock.Now().AddDate(0, 0, ArchiveVolumeDays).Format(filter.ExpiryTagValueFormat)
+	// Snapshots can take a while to complete, so they're taken in parallel,
+	// ArchiveConcurrency at a time
+	concurrency := ArchiveConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	done := make([]bool, len(volumes))
+	var wg sync.WaitGroup
+	wg.Add(len(volumes))
+	slots := make(chan struct{}, concurrency)
+	for i := range volumes {
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			vol := volumes[i]
+			tags := map[string]string{
+				filter.ArchiveTagKey: vol.ID(),
+				filter.ExpiryTagKey:  expiry,
+			}
+			snapshot, err := cloud.SnapshotVolume(vol, tags)
+			if err != nil {
+				log.Printf("%s: Not cleaning up %s, since it could not be archived: %s\n", cloud.AccountName(owner), vol.ID(), err)
+				return
+			}
+			log.Printf("%s: Archived %s as %s until %s\n", cloud.AccountName(owner), vol.ID(), snapshot, expiry)
+			done[i] = true
+		}(i)
+	}
+	wg.Wait()
+	archived = []cloud.Volume{}
+	for i, vol := range volumes {
+		if done[i] {
+			archived = append(archived, vol)
+		} else {
+			failed++
+		}
+	}
+	return archived, failed
+}
+
+// cleanedUpVolumes returns the volumes that were cleaned up, i.e. those
+// that were attempted and didn't keep failing
+func cleanedUpVolumes(volumes []cloud.Volume, cleanedUp, stillFailing []cloud.Resource) []cloud.Volume {
+	gone := make(map[string]bool)
+	for _, res := range cleanedUp {
+		gone[res.ID()] = true
+	}
+	for _, res := range stillFailing {
+		gone[res.ID()] = false
+	}
+	result := []cloud.Volume{}
+	for _, vol := range volumes {
+		if gone[vol.ID()] {
+			result = append(result, vol)
+		}
+	}
+	return result
+}
+
+// archiveCostPerMonth returns the estimated monthly cost of the snapshots
+// archiving the volumes
+func archiveCostPerMonth(volumes []cloud.Volume) float64 {
+	total := 0.0
+	for _, vol := range volumes {
+		total += billing.VolumeArchiveCostPerDay(vol) * 30
+	}
+	return total
+}
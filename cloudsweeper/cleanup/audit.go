@@ -0,0 +1,220 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/metrics"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditTagSet     = "tag-set"
+	AuditTagRemoved = "tag-removed"
+	AuditStopped    = "stopped"
+	AuditDeleted    = "deleted"
+)
+
+var (
+	// Audit, if set, records every change Cloudsweeper makes to a
+	// resource, for compliance
+	Audit AuditLog
+	// Actor is who ran Cloudsweeper, as recorded in the audit log
+	Actor string
+)
+
+// AuditEvent is a single change made to a resource
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	Actor      string    `json:"actor"`
+	RunID      string    `json:"run_id"`
+	Account    string    `json:"account"`
+	Kind       string    `json:"kind"`
+	ResourceID string    `json:"resource_id"`
+	Key        string    `json:"key,omitempty"`
+	Value      string    `json:"value,omitempty"`
+	// Reason is why the change was made, e.g. the rule that matched the
+	// resource or the command that was run
+	Reason string `json:"reason"`
+}
+
+// AuditLog is where audit events are written
+type AuditLog interface {
+	Record(event *AuditEvent) error
+	// Close writes any buffered events
+	Close() error
+}
+
+type fileAuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditLog returns an audit log appending events, one JSON object
+// per line, to the file at the specified path
+func NewFileAuditLog(path string) (AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditLog{file: file}, nil
+}
+
+func (l *fileAuditLog) Record(event *AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+func (l *fileAuditLog) Close() error {
+	return l.file.Close()
+}
+
+type bucketAuditLog struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	csp    cloud.CSP
+	bucket string
+	region string
+	prefix string
+}
+
+// NewBucketAuditLog returns an audit log writing the events of a run, one
+// JSON object per line, to an object named after the run ID in the
+// specified bucket once it's closed
+func NewBucketAuditLog(csp cloud.CSP, bucket, region, prefix string) AuditLog {
+	return &bucketAuditLog{csp: csp, bucket: bucket, region: region, prefix: prefix}
+}
+
+func (l *bucketAuditLog) Record(event *AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf.Write(append(line, '\n'))
+	return nil
+}
+
+func (l *bucketAuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buf.Len() == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s%s.jsonl", l.prefix, RunID)
+	return cloud.PutObject(l.csp, l.bucket, l.region, key, "application/x-ndjson", l.buf.Bytes())
+}
+
+// audit records a change made to a resource, if there is an audit log,
+// and counts it in the metrics
+func audit(res cloud.Resource, action, key, value, reason string) {
+	countAction(res, action, key)
+	if Audit == nil {
+		return
+	}
+	event := &AuditEvent{
+		Time:       clock.Now(),
+		Action:     action,
+		Actor:      Actor,
+		RunID:      RunID,
+		Account:    res.Owner(),
+		Kind:       ResourceKind(res),
+		ResourceID: res.ID(),
+		Key:        key,
+		Value:      value,
+		Reason:     reason,
+	}
+	if err := Audit.Record(event); err != nil {
+		log.Printf("%s: Could not record %s of %s in the audit log: %s\n", cloud.AccountName(res.Owner()), action, res.ID(), err)
+	}
+}
+
+// countAction records resources being marked or deleted in the metrics
+func countAction(res cloud.Resource, action, key string) {
+	switch {
+	case action == AuditTagSet && (key == filter.DeleteTagKey || key == filter.StopTagKey):
+		metrics.ResourcesMarked.Add(1, res.Owner(), ResourceKind(res))
+	case action == AuditDeleted:
+		metrics.ResourcesDeleted.Add(1, res.Owner(), ResourceKind(res))
+		metrics.CostReclaimed.Add(billing.ResourceCostPerDay(res)*30, res.Owner())
+	}
+}
+
+// setTag sets a tag of a resource, and records it in the audit log
+func setTag(res cloud.Resource, key, value string, overwrite bool, reason string) error {
+	if err := res.SetTag(key, value, overwrite); err != nil {
+		return err
+	}
+	audit(res, AuditTagSet, key, value, reason)
+	return nil
+}
+
+// removeTag removes a tag of a resource, and records it in the audit log
+func removeTag(res cloud.Resource, key, reason string) error {
+	if err := res.RemoveTag(key); err != nil {
+		return err
+	}
+	audit(res, AuditTagRemoved, key, "", reason)
+	return nil
+}
+
+// auditDeletions records every cleaned up resource in the audit log,
+// except those that still failed after being retried
+func auditDeletions(cleanedUp, stillFailing []cloud.Resource) {
+	failed := map[string]bool{}
+	for _, res := range stillFailing {
+		failed[res.ID()] = true
+	}
+	for _, res := range cleanedUp {
+		if !failed[res.ID()] {
+			audit(res, AuditDeleted, "", "", cleanupReason(res))
+		}
+	}
+}
+
+type multiAuditLog []AuditLog
+
+// MultiAuditLog returns an audit log recording events in all the
+// specified audit logs
+func MultiAuditLog(logs ...AuditLog) AuditLog {
+	return multiAuditLog(logs)
+}
+
+func (m multiAuditLog) Record(event *AuditEvent) error {
+	for _, l := range m {
+		if err := l.Record(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiAuditLog) Close() error {
+	var firstErr error
+	for _, l := range m {
+		if err := l.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
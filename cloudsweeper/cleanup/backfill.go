@@ -0,0 +1,184 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// maxLineageDepth is how many steps of lineage are followed when looking
+// for a tagged resource, e.g. from a snapshot to its volume to the
+// instance the volume is attached to
+const maxLineageDepth = 3
+
+// TagSuggestion is a set of tags suggested for an untagged resource
+type TagSuggestion struct {
+	Owner    string
+	Resource cloud.Resource
+	Tags     map[string]string
+	// Source is where the tags were found, "billing" or the ID of a
+	// related resource
+	Source string
+}
+
+// SuggestTags proposes the specified tags, e.g. product and role, for
+// untagged resources. The tags of a resource are first looked for in the
+// billing data, which has the tags the resource had when it was billed, by
+// resource ID, and then in the resources it was created from or is
+// attached to (see cloud.Resource.Lineage). Tags that were themselves
+// suggested are never used as a source.
+func SuggestTags(ctx context.Context, mngr cloud.ResourceManager, billingTags map[string]map[string]string, keys []string) []*TagSuggestion {
+	collections := accountCollections(ctx, mngr)
+	untaggedFilter := filter.New()
+	untaggedFilter.AddGeneralRule(filter.IsUntaggedWithException("Name"))
+
+	suggestions := []*TagSuggestion{}
+	for _, owner := range cloud.AllAccounts(collections) {
+		resources := collectionResources(collections[owner])
+		candidates := sortedResources(filterCollection(collections[owner], untaggedFilter))
+		suggested := len(suggestions)
+		for _, res := range candidates {
+			if tags := missingTags(res, billingTags[res.ID()], keys); len(tags) > 0 {
+				suggestions = append(suggestions, &TagSuggestion{Owner: owner, Resource: res, Tags: tags, Source: "billing"})
+				continue
+			}
+			if source, tags := lineageTags(res, resources, keys); len(tags) > 0 {
+				suggestions = append(suggestions, &TagSuggestion{Owner: owner, Resource: res, Tags: tags, Source: source})
+			}
+		}
+		log.Printf("%s: Suggested tags for %d of %d untagged resources\n", cloud.AccountName(owner), len(suggestions)-suggested, len(candidates))
+	}
+	return suggestions
+}
+
+// ApplyTagSuggestions sets the suggested tags, together with a tag marking
+// them as suggested. It returns the number of resources that failed.
+func ApplyTagSuggestions(suggestions []*TagSuggestion) int {
+	failed := 0
+	for _, suggestion := range suggestions {
+		res := suggestion.Resource
+		if err := applyTagSuggestion(suggestion); err != nil {
+			log.Printf("%s: Could not tag %s: %s\n", suggestion.Owner, res.ID(), err)
+			failed++
+			continue
+		}
+		log.Printf("%s: Tagged %s with %s\n", suggestion.Owner, res.ID(), formatTags(suggestion.Tags))
+	}
+	return failed
+}
+
+// applyTagSuggestion sets the tags of a suggestion, and marks them as
+// suggested once all of them are set
+func applyTagSuggestion(suggestion *TagSuggestion) error {
+	for _, key := range sortedKeys(suggestion.Tags) {
+		if err := setTag(suggestion.Resource, key, suggestion.Tags[key], false, "suggested by "+suggestion.Source); err != nil {
+			return err
+		}
+	}
+	return setTag(suggestion.Resource, filter.SuggestedTagKey, "true", true, "suggested by "+suggestion.Source)
+}
+
+// FormatTagSuggestions returns a report of the suggested tags, one
+// resource per line
+func FormatTagSuggestions(suggestions []*TagSuggestion) string {
+	b := new(bytes.Buffer)
+	owner := ""
+	for _, suggestion := range suggestions {
+		if suggestion.Owner != owner {
+			owner = suggestion.Owner
+			fmt.Fprintf(b, "\n%s:\n", owner)
+		}
+		res := suggestion.Resource
+		fmt.Fprintf(b, "  %-14s %-24s %s (from %s)\n", ResourceKind(res), res.ID(), formatTags(suggestion.Tags), suggestion.Source)
+	}
+	fmt.Fprintf(b, "\nSuggested tags for %d resources\n", len(suggestions))
+	return b.String()
+}
+
+// filterCollection returns the resources of a collection that match any
+// of the filters
+func filterCollection(collection *cloud.AllResourceCollection, filters ...*filter.ResourceFilter) *cloud.AllResourceCollection {
+	return &cloud.AllResourceCollection{
+		Owner:           collection.Owner,
+		Instances:       filter.Instances(collection.Instances, filters...),
+		Images:          filter.Images(collection.Images, filters...),
+		Volumes:         filter.Volumes(collection.Volumes, filters...),
+		Snapshots:       filter.Snapshots(collection.Snapshots, filters...),
+		Buckets:         filter.Buckets(collection.Buckets, filters...),
+		Tables:          filter.Tables(collection.Tables, filters...),
+		CacheClusters:   filter.CacheClusters(collection.CacheClusters, filters...),
+		Addresses:       filter.Addresses(collection.Addresses, filters...),
+		NetworkGateways: filter.NetworkGateways(collection.NetworkGateways, filters...),
+		Capacities:      filter.Capacities(collection.Capacities, filters...),
+		DBInstances:     filter.DBInstances(collection.DBInstances, filters...),
+		DBSnapshots:     filter.DBSnapshots(collection.DBSnapshots, filters...),
+	}
+}
+
+// lineageTags looks for the tags in the lineage of a resource, nearest
+// first, and returns the ID of the resource they were found on
+func lineageTags(res cloud.Resource, resources map[string]cloud.Resource, keys []string) (string, map[string]string) {
+	visited := map[string]bool{res.ID(): true}
+	current := []cloud.Resource{res}
+	for depth := 0; depth < maxLineageDepth; depth++ {
+		next := []cloud.Resource{}
+		for _, child := range current {
+			for _, id := range child.Lineage() {
+				parent, exist := resources[id]
+				if !exist || visited[id] {
+					continue
+				}
+				visited[id] = true
+				if _, suggested := parent.Tags()[filter.SuggestedTagKey]; !suggested {
+					if tags := missingTags(res, parent.Tags(), keys); len(tags) > 0 {
+						return id, tags
+					}
+				}
+				next = append(next, parent)
+			}
+		}
+		current = next
+	}
+	return "", nil
+}
+
+// missingTags returns the tags among keys that have a value in source,
+// but are missing on the resource
+func missingTags(res cloud.Resource, source map[string]string, keys []string) map[string]string {
+	tags := make(map[string]string)
+	for _, key := range keys {
+		if _, exist := res.Tags()[key]; exist {
+			continue
+		}
+		if val := source[key]; val != "" {
+			tags[key] = val
+		}
+	}
+	return tags
+}
+
+func sortedKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatTags(tags map[string]string) string {
+	pairs := []string{}
+	for _, key := range sortedKeys(tags) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, tags[key]))
+	}
+	return strings.Join(pairs, ", ")
+}
@@ -4,20 +4,53 @@
 package cleanup
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"math"
+	"runtime/debug"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
 	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/metrics"
 )
 
-const (
-	releaseTag         = "Release"
-	totalCostThreshold = 10.0
+const totalCostThreshold = 10.0
+
+var (
+	// ImageParameterPaths are SSM parameter paths holding the IDs of
+	// images that are in use, such as golden AMIs. These images are
+	// never marked or cleaned up.
+	ImageParameterPaths []string
+	// ProtectLaunchTemplateImages will, if set, prevent images used by
+	// launch templates from being marked or cleaned up.
+	ProtectLaunchTemplateImages bool
+	// AccountThresholdMultipliers scale the age and idle thresholds when
+	// marking resources in specific accounts, by account. E.g. 0.5 marks
+	// resources twice as soon as the policy says.
+	AccountThresholdMultipliers map[string]float64
+	// ReleaseTagKey is the tag of released resources, which are never
+	// marked for cleanup. Release images follow ReleaseImages instead.
+	ReleaseTagKey = "Release"
+	// Policy, if set, is a policy file whose rule chains replace the
+	// built-in rules for marking the kinds of resources it covers
+	Policy *filter.Policy
 )
 
+// MaxLifetimeReason is why resources past their maximum lifetime are
+// marked, see filter.MaxLifetimeDays
+const MaxLifetimeReason = "hard lifetime exceeded"
+
+// markedCleanupDays is the number of days from when a resource is marked
+// until it's cleaned up
+const markedCleanupDays = 4
+
 // MarkForCleanup will look for resources that should be automatically
 // cleaned up. These resources are not deleted directly, but are given
 // a tag that will delete the resources 4 days from now. The rules
@@ -28,22 +61,139 @@ const (
 // 		- non-whitelisted snapshots > 6 months
 // 		- non-whitelisted volumes > 6 months
 //		- untagged resources > 30 days (this should take care of instances)
-func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRun bool) map[string]*cloud.AllResourceCollection {
-	allResources := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
+//		- tables and cache clusters not used within a configured amount of
+//		  days, if enabled
+//		- addresses not in use for a configured amount of days, if enabled
+//		- images older than the N latest images in their image family, if
+//		  enabled
+// Volumes, snapshots, images and buckets smaller than the configured
+// clean-*-min-size-gb thresholds are not marked for being old, unused
+// or untagged.
+// Resources that must be retained for compliance (see
+// filter.RetentionTagKey) are never marked, and neither are resources in
+// accounts where some regions could not be scanned (see cloud.ScanStatus).
+// The age and idle thresholds are scaled in accounts whose owner opted in
+// to another aggressiveness, see AccountThresholdMultipliers.
+// If the clean-stop-instances threshold is set, running instances are
+// marked to be stopped rather than deleted, using the filter.StopTagKey
+// tag. Instances detected as databases (see filter.IsDatabase) are only
+// marked if the clean-databases threshold is set.
+// The rules for instances, images, volumes, snapshots and buckets can be
+// replaced by the rule chains of a policy file, see Policy.
+// Resources past their maximum lifetime (see filter.MaxLifetimeDays) are
+// marked once its grace days have passed, even if they're whitelisted.
+// Resources managed by a stack (see filter.ManagedByTagKey) are never
+// marked one by one, see PlanStacks and MarkStack.
+// Accounts are marked MarkingConcurrency at a time. An account where the
+// marking fails or panics doesn't affect the others, which accounts
+// completed is returned in the MarkingReport.
+func MarkForCleanup(ctx context.Context, mngr cloud.ResourceManager, thresholds map[string]int, dryRun bool) (map[string]*cloud.AllResourceCollection, *MarkingReport) {
 	allResourcesToTag := make(map[string]*cloud.AllResourceCollection)
+	results, report := markForCleanup(ctx, mngr, thresholds, dryRun)
+	for owner, result := range results {
+		allResourcesToTag[owner] = result.resources
+	}
+	return allResourcesToTag, report
+}
+
+// CountResources returns the number of resources in all collections
+func CountResources(collections map[string]*cloud.AllResourceCollection) int {
+	count := 0
+	for _, collection := range collections {
+		count += len(collectionResources(collection))
+	}
+	return count
+}
+
+// MarkingConcurrency is the maximum number of accounts resources are
+// marked for cleanup in at the same time
+var MarkingConcurrency = 5
+
+// MarkingReport is which accounts resources were marked for cleanup in.
+// Running the marking again resumes it in the accounts that didn't
+// complete, since resources that are already marked are not marked again.
+type MarkingReport struct {
+	// Completed are the accounts where marking completed, sorted
+	Completed []string
+	// Failed are the accounts where marking failed or panicked, sorted.
+	// Resources tagged in them before that stay marked.
+	Failed cloud.AccountErrors
+	// Skipped are the accounts that were not marked, since the run was
+	// cancelled before their turn, sorted
+	Skipped []string
+}
+
+// markingResult is what was matched for marking in an account
+type markingResult struct {
+	resources *cloud.AllResourceCollection
+	// reasons are the reasons resources were matched, by their ID
+	reasons map[string]string
+	// belowCost is set if the resources are not marked, since their
+	// total cost is below totalCostThreshold
+	belowCost bool
+	// partial is set if the resources are not marked, since some
+	// regions of the account could not be scanned
+	partial bool
+	// stopInstances is set if instances are marked to be stopped
+	stopInstances bool
+	// stackResources are the resources that matched, but were not
+	// marked since they're managed by a stack
+	stackResources []cloud.Resource
+}
+
+func markForCleanup(ctx context.Context, mngr cloud.ResourceManager, thresholds map[string]int, dryRun bool) (map[string]*markingResult, *MarkingReport) {
+	allResources := mngr.AllResourcesPerAccount(ctx)
+	billing.PrefetchCollectionPrices(allResources)
+	allBuckets := mngr.BucketsPerAccount(ctx)
+	allTables := make(map[string][]cloud.Table)
+	if thresholds["clean-tables-idle-days"] > 0 {
+		allTables = mngr.TablesPerAccount(ctx)
+	}
+	allCacheClusters := make(map[string][]cloud.CacheCluster)
+	if thresholds["clean-cache-clusters-idle-days"] > 0 {
+		allCacheClusters = mngr.CacheClustersPerAccount(ctx)
+	}
+	allAddresses := make(map[string][]cloud.Address)
+	if thresholds["clean-unused-addresses-older-than-days"] > 0 {
+		allAddresses = mngr.AddressesPerAccount(ctx)
+	}
+	allGateways := make(map[string][]cloud.NetworkGateway)
+	if thresholds["clean-network-gateways-idle-days"] > 0 {
+		allGateways = mngr.NetworkGatewaysPerAccount(ctx)
+	}
+	allCapacities := make(map[string][]cloud.Capacity)
+	if thresholds["clean-unused-capacity-reservations-older-than-days"] > 0 {
+		allCapacities = mngr.CapacitiesPerAccount(ctx)
+	}
+	allDBInstances := make(map[string][]cloud.DBInstance)
+	if thresholds["clean-db-instances-idle-days"] > 0 {
+		allDBInstances = mngr.DBInstancesPerAccount(ctx)
+	}
+	allDBSnapshots := make(map[string][]cloud.DBSnapshot)
+	if thresholds["clean-db-snapshots-older-than-days"] > 0 {
+		allDBSnapshots = mngr.DBSnapshotsPerAccount(ctx)
+	}
+	referencedImages, referencedErr := findReferencedImages(ctx, mngr)
+	dependencyErr := findSnapshotDependencies(ctx, mngr)
 
-	for owner, res := range allResources {
-		log.Println("Marking resources for cleanup in", owner)
+	policy := thresholds
+	markAccount := func(owner string) (*markingResult, error) {
+		filterStart := time.Now()
+		res := allResources[owner]
+		log.Println("Marking resources for cleanup in", cloud.AccountName(owner))
+		thresholds := accountThresholds(owner, policy)
+		res.Images = withoutReferencedImages(owner, res.Images, referencedImages, referencedErr)
+		res.Snapshots = withoutUnsafeSnapshots(owner, res.Snapshots, dependencyErr)
 
+		// A missing threshold fails the account before anything is
+		// tagged, see thresholdErr
+		var thresholdErr error
 		getThreshold := func(key string, thresholds map[string]int) int {
 			threshold, found := thresholds[key]
-			if found {
-				return threshold
-			} else {
-				log.Fatalf("Threshold '%s' not found", key)
-				return 99999
+			if !found && thresholdErr == nil {
+				thresholdErr = fmt.Errorf("Threshold '%s' not found", key)
 			}
+			return threshold
 		}
 
 		untaggedFilter := filter.New()
@@ -51,136 +201,541 @@ func MarkForCleanup(mngr cloud.ResourceManager, thresholds map[string]int, dryRu
 		untaggedFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-untagged-older-than-days", thresholds)))
 		untaggedFilter.AddSnapshotRule(filter.IsNotInUse())
 		untaggedFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		untaggedFilter.AddGeneralRule(filter.Negate(filter.TaggedForStop()))
 		untaggedFilter.AddVolumeRule(filter.IsUnattached())
 
 		instanceFilter := filter.New()
 		instanceFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-instances-older-than-days", thresholds)))
-		instanceFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
+		instanceFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
 		instanceFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		instanceFilter.AddGeneralRule(filter.Negate(filter.TaggedForStop()))
 
 		snapshotFilter := filter.New()
 		snapshotFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-snapshots-older-than-days", thresholds)))
 		snapshotFilter.AddSnapshotRule(filter.IsNotInUse())
-		snapshotFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
+		snapshotFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
 		snapshotFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		snapshotFilter.AddGeneralRule(filter.Negate(filter.HasTag(filter.ArchiveTagKey)))
 
 		imageFilter := filter.New()
 		imageFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-images-older-than-days", thresholds)))
-		imageFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
+		imageFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
 		imageFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 		imageFilter.AddImageRule(filter.DoesNotFollowFormat())
 
 		volumeFilter := filter.New()
 		volumeFilter.AddVolumeRule(filter.IsUnattached())
 		volumeFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-unattatched-older-than-days", thresholds)))
-		volumeFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
+		volumeFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
 		volumeFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 
 		bucketFilter := filter.New()
 		bucketFilter.AddBucketRule(filter.NotModifiedInXDays(getThreshold("clean-bucket-not-modified-days", thresholds)))
 		bucketFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("clean-bucket-older-than-days", thresholds)))
-		bucketFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
+		bucketFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
 		bucketFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 
-		timeToDelete := time.Now().AddDate(0, 0, 4)
+		for _, fil := range []*filter.ResourceFilter{untaggedFilter, volumeFilter, snapshotFilter, imageFilter, bucketFilter} {
+			addMinSizeRules(fil, thresholds)
+		}
+
+		// The rule chains of the policy file replace the filters above for
+		// the kinds of resources they cover
+		policyFilter := filter.New()
+		policyFilter.AddGeneralRule(Policy.Matches())
+		policyFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+		policyFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		policyFilter.AddGeneralRule(filter.Negate(filter.TaggedForStop()))
+		filtersOf := func(kind string, builtIn ...*filter.ResourceFilter) []*filter.ResourceFilter {
+			if Policy.Covers(kind) {
+				return []*filter.ResourceFilter{policyFilter}
+			}
+			return builtIn
+		}
+
+		timeToDelete := clock.Now().AddDate(0, 0, markedCleanupDays)
 
-		resourcesToTag := cloud.AllResourceCollection{}
-		resourcesToTag.Owner = owner
 		// Store a separate list of all resources since I couldn't for the life of me figure out how to
 		// pass a []Image to a function that takes []Resource without explicitly converting everything...
 		tagList := []cloud.Resource{}
 		totalCost := 0.0
 
-		// Tag instances
-		for _, res := range filter.Instances(res.Instances, instanceFilter, untaggedFilter) {
-			resourcesToTag.Instances = append(resourcesToTag.Instances, res)
+		// Remember why resources are matched, resources matched by the
+		// untagged filter are reported as untagged
+		reasons := make(map[string]string)
+		untagged := collectionResources(&cloud.AllResourceCollection{
+			Instances: filter.Instances(res.Instances, untaggedFilter),
+			Images:    filter.Images(res.Images, untaggedFilter),
+			Volumes:   filter.Volumes(res.Volumes, untaggedFilter),
+			Snapshots: filter.Snapshots(res.Snapshots, untaggedFilter),
+			Buckets:   filter.Buckets(allBuckets[owner], untaggedFilter),
+		})
+		matched := func(res cloud.Resource, reason string) {
+			if name, ok := Policy.Match(res); ok {
+				reason = name
+			} else if _, isUntagged := untagged[res.ID()]; isUntagged {
+				reason = "untagged"
+			}
+			reasons[res.ID()] = reason
+		}
+
+		// Tag instances, to be stopped rather than deleted if the policy says so
+		stopInstances := getThreshold("clean-stop-instances", thresholds) > 0
+		cleanDatabases := getThreshold("clean-databases", thresholds) > 0
+		for _, res := range filter.Instances(res.Instances, filtersOf("instances", instanceFilter, untaggedFilter)...) {
+			if stopInstances && !res.Running() {
+				// Already stopped, nothing to gain
+				continue
+			}
+			if !cleanDatabases && filter.IsDatabase()(res) {
+				log.Printf("%s: Not marking %s, since it looks like a database and the policy doesn't opt in to cleaning up databases\n", cloud.AccountName(owner), res.ID())
+				continue
+			}
 			tagList = append(tagList, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			matched(res, "old instance")
+			totalCost += billing.AccumulatedCost(res)
 		}
 
 		// Tag volumes
-		for _, res := range filter.Volumes(res.Volumes, volumeFilter, untaggedFilter) {
-			resourcesToTag.Volumes = append(resourcesToTag.Volumes, res)
+		for _, res := range filter.Volumes(res.Volumes, filtersOf("volumes", volumeFilter, untaggedFilter)...) {
 			tagList = append(tagList, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			matched(res, "unattached volume")
+			totalCost += billing.AccumulatedCost(res)
 		}
 
 		// Tag snapshots
-		for _, res := range filter.Snapshots(res.Snapshots, snapshotFilter, untaggedFilter) {
-			resourcesToTag.Snapshots = append(resourcesToTag.Snapshots, res)
+		for _, res := range filter.Snapshots(res.Snapshots, filtersOf("snapshots", snapshotFilter, untaggedFilter)...) {
 			tagList = append(tagList, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			matched(res, "old snapshot")
+			totalCost += billing.AccumulatedCost(res)
 		}
 
+		// Helper map to avoid duplicated images
+		alreadySelectedImages := map[string]bool{}
+
 		// Tag untagged images
-		for _, res := range filter.Images(res.Images, untaggedFilter) {
-			resourcesToTag.Images = append(resourcesToTag.Images, res)
+		for _, res := range filter.Images(res.Images, filtersOf("images", untaggedFilter)...) {
+			alreadySelectedImages[res.ID()] = true
 			tagList = append(tagList, res)
-			days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-			costPerDay := billing.ResourceCostPerDay(res)
-			totalCost += days * costPerDay
+			matched(res, "untagged")
+			totalCost += billing.AccumulatedCost(res)
 		}
 
 		// Tag buckets
 		if buck, ok := allBuckets[owner]; ok {
-			for _, res := range filter.Buckets(buck, bucketFilter, untaggedFilter) {
-				resourcesToTag.Buckets = append(resourcesToTag.Buckets, res)
+			for _, res := range filter.Buckets(buck, filtersOf("buckets", bucketFilter, untaggedFilter)...) {
 				tagList = append(tagList, res)
-				totalCost += billing.BucketPricePerMonth(res)
+				matched(res, "unused bucket")
+				totalCost += billing.AccumulatedCost(res)
 			}
 		}
 
-		// Helper map to avoid duplicated images
-		alreadySelectedImages := map[string]bool{}
-		for _, image := range resourcesToTag.Images {
-			alreadySelectedImages[image.ID()] = true
+		// Tag volumes and snapshots left behind by terminated instances,
+		// that were included in this run by their owner
+		orphanFilter := filter.New()
+		orphanFilter.AddGeneralRule(filter.HasTag(filter.OrphanTagKey))
+		orphanFilter.AddGeneralRule(filter.HasTag(filter.OrphanIncludeTagKey))
+		orphanFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+		orphanFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		orphanFilter.AddVolumeRule(filter.IsUnattached())
+		orphanFilter.AddSnapshotRule(filter.IsNotInUse())
+		orphans := sortedResources(&cloud.AllResourceCollection{
+			Volumes:   filter.Volumes(res.Volumes, orphanFilter),
+			Snapshots: filter.Snapshots(res.Snapshots, orphanFilter),
+		})
+		for _, res := range orphans {
+			if _, found := reasons[res.ID()]; !found {
+				tagList = append(tagList, res)
+				matched(res, "orphaned by terminated instance")
+				totalCost += billing.AccumulatedCost(res)
+			}
+		}
+
+		// Tag tables and cache clusters that have not been used, if enabled
+		if days := getThreshold("clean-tables-idle-days", thresholds); days > 0 {
+			tableFilter := filter.New()
+			tableFilter.AddTableRule(filter.TableNotUsedInXDays(days))
+			tableFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			tableFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			for _, res := range filter.Tables(allTables[owner], tableFilter) {
+				tagList = append(tagList, res)
+				matched(res, "idle table")
+				totalCost += billing.AccumulatedCost(res)
+			}
+		}
+		if days := getThreshold("clean-cache-clusters-idle-days", thresholds); days > 0 {
+			cacheClusterFilter := filter.New()
+			cacheClusterFilter.AddCacheClusterRule(filter.CacheClusterNotUsedInXDays(days))
+			cacheClusterFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			cacheClusterFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			for _, res := range filter.CacheClusters(allCacheClusters[owner], cacheClusterFilter) {
+				tagList = append(tagList, res)
+				matched(res, "idle cache cluster")
+				totalCost += billing.AccumulatedCost(res)
+			}
+		}
+
+		// Tag addresses that are reserved but not in use, if enabled
+		if days := getThreshold("clean-unused-addresses-older-than-days", thresholds); days > 0 {
+			addressFilter := filter.New()
+			addressFilter.AddAddressRule(filter.AddressNotInUse())
+			addressFilter.AddGeneralRule(filter.OlderThanXDays(days))
+			addressFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			addressFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			for _, res := range filter.Addresses(allAddresses[owner], addressFilter) {
+				tagList = append(tagList, res)
+				matched(res, "unused address")
+				totalCost += billing.AccumulatedCost(res)
+			}
+		}
+
+		// Tag NAT gateways and VPC endpoints without traffic, if enabled
+		if days := getThreshold("clean-network-gateways-idle-days", thresholds); days > 0 {
+			gatewayFilter := filter.New()
+			gatewayFilter.AddNetworkGatewayRule(filter.NetworkGatewayNotUsedInXDays(days))
+			gatewayFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			gatewayFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			for _, res := range filter.NetworkGateways(allGateways[owner], gatewayFilter) {
+				tagList = append(tagList, res)
+				matched(res, "idle network gateway")
+				totalCost += billing.AccumulatedCost(res)
+			}
+		}
+
+		// Tag capacity reservations that no instance uses, if enabled.
+		// Dedicated hosts are only reported, since releasing them is
+		// rarely what the owner wants.
+		if days := getThreshold("clean-unused-capacity-reservations-older-than-days", thresholds); days > 0 {
+			capacityFilter := filter.New()
+			capacityFilter.AddCapacityRule(filter.CapacityOfType(cloud.CapacityReservationType))
+			capacityFilter.AddCapacityRule(filter.CapacityUnused())
+			capacityFilter.AddGeneralRule(filter.OlderThanXDays(days))
+			capacityFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			capacityFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			for _, res := range filter.Capacities(allCapacities[owner], capacityFilter) {
+				tagList = append(tagList, res)
+				matched(res, "unused capacity reservation")
+				totalCost += billing.AccumulatedCost(res)
+			}
+		}
+
+		// Tag databases no client has connected to, and old database
+		// snapshots, if enabled. Stopped databases are idle too, since
+		// nothing can connect to them.
+		if days := getThreshold("clean-db-instances-idle-days", thresholds); days > 0 {
+			dbInstanceFilter := filter.New()
+			dbInstanceFilter.AddDBInstanceRule(filter.DBInstanceNotUsedInXDays(days))
+			dbInstanceFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			dbInstanceFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			for _, res := range filter.DBInstances(allDBInstances[owner], dbInstanceFilter) {
+				tagList = append(tagList, res)
+				matched(res, "idle database")
+				totalCost += billing.AccumulatedCost(res)
+			}
+		}
+		if days := getThreshold("clean-db-snapshots-older-than-days", thresholds); days > 0 {
+			dbSnapshotFilter := filter.New()
+			dbSnapshotFilter.AddGeneralRule(filter.OlderThanXDays(days))
+			dbSnapshotFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			dbSnapshotFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			for _, res := range filter.DBSnapshots(allDBSnapshots[owner], dbSnapshotFilter) {
+				tagList = append(tagList, res)
+				matched(res, "old database snapshot")
+				totalCost += billing.AccumulatedCost(res)
+			}
 		}
 
 		// Tag images that DO NOT follow the component-date pattern
-		for _, image := range filter.Images(res.Images, imageFilter) {
+		for _, image := range filter.Images(res.Images, filtersOf("images", imageFilter)...) {
 			if _, found := alreadySelectedImages[image.ID()]; !found {
-				resourcesToTag.Images = append(resourcesToTag.Images, image)
+				alreadySelectedImages[image.ID()] = true
 				tagList = append(tagList, image)
+				matched(image, "old image")
+			}
+		}
+
+		// Tag images copied from another region sooner, if enabled, since
+		// they can be copied again from the primary image
+		if days := getThreshold("clean-image-copies-older-than-days", thresholds); days > 0 && !Policy.Covers("images") {
+			copyFilter := filter.New()
+			copyFilter.AddImageRule(filter.IsRegionalCopy())
+			copyFilter.AddGeneralRule(filter.OlderThanXDays(days))
+			copyFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			copyFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			addMinSizeRules(copyFilter, thresholds)
+			for _, image := range filter.Images(res.Images, copyFilter) {
+				if _, found := alreadySelectedImages[image.ID()]; !found {
+					alreadySelectedImages[image.ID()] = true
+					tagList = append(tagList, image)
+					matched(image, "old image copy")
+				}
 			}
 		}
 
 		// Tag images that DO follow the component-date pattern
 		componentImageFilter := filter.New()
-		componentImageFilter.AddGeneralRule(filter.Negate(filter.HasTag(releaseTag)))
+		componentImageFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
 		componentImageFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
 		componentImageFilter.AddImageRule(filter.FollowsFormat())
 
 		componentImages := getAllButNLatestComponents(res.Images, getThreshold("clean-keep-n-component-images", thresholds))
 		for _, image := range filter.Images(componentImages, componentImageFilter) {
 			if _, found := alreadySelectedImages[image.ID()]; !found {
-				resourcesToTag.Images = append(resourcesToTag.Images, image)
+				alreadySelectedImages[image.ID()] = true
 				tagList = append(tagList, image)
+				matched(image, "old component image")
+			}
+		}
+
+		// Tag images that are part of an image family, if enabled
+		if imagesToKeep := getThreshold("clean-keep-n-family-images", thresholds); imagesToKeep > 0 {
+			familyImageFilter := filter.New()
+			familyImageFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			familyImageFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+
+			familyImages := getAllButNLatestInFamilies(res.Images, imagesToKeep)
+			for _, image := range filter.Images(familyImages, familyImageFilter) {
+				if _, found := alreadySelectedImages[image.ID()]; !found {
+					alreadySelectedImages[image.ID()] = true
+					tagList = append(tagList, image)
+					matched(image, "old family image")
+				}
+			}
+		}
+
+		// Tag resources past their maximum lifetime once the grace days
+		// have passed, overriding the whitelist of resources that were not
+		// whitelisted again within it
+		if filter.MaxLifetimeDays > 0 {
+			maxLifetimeFilter := filter.New()
+			maxLifetimeFilter.OverrideWhitelist = true
+			maxLifetimeFilter.AddGeneralRule(filter.MaxLifetimeExceeded(filter.MaxLifetimeGraceDays))
+			maxLifetimeFilter.AddGeneralRule(filter.Negate(filter.HasTag(ReleaseTagKey)))
+			maxLifetimeFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+			maxLifetimeFilter.AddGeneralRule(filter.Negate(filter.TaggedForStop()))
+			pastMaxLifetime := sortedResources(&cloud.AllResourceCollection{
+				Instances:       filter.Instances(res.Instances, maxLifetimeFilter),
+				Images:          filter.Images(res.Images, maxLifetimeFilter),
+				Volumes:         filter.Volumes(res.Volumes, maxLifetimeFilter),
+				Snapshots:       filter.Snapshots(res.Snapshots, maxLifetimeFilter),
+				Buckets:         filter.Buckets(allBuckets[owner], maxLifetimeFilter),
+				Tables:          filter.Tables(allTables[owner], maxLifetimeFilter),
+				CacheClusters:   filter.CacheClusters(allCacheClusters[owner], maxLifetimeFilter),
+				Addresses:       filter.Addresses(allAddresses[owner], maxLifetimeFilter),
+				NetworkGateways: filter.NetworkGateways(allGateways[owner], maxLifetimeFilter),
+				Capacities:      filter.Capacities(allCapacities[owner], maxLifetimeFilter),
+				DBInstances:     filter.DBInstances(allDBInstances[owner], maxLifetimeFilter),
+				DBSnapshots:     filter.DBSnapshots(allDBSnapshots[owner], maxLifetimeFilter),
+			})
+			for _, res := range pastMaxLifetime {
+				if _, found := reasons[res.ID()]; found {
+					continue
+				}
+				if inst, isInstance := res.(cloud.Instance); isInstance && ((stopInstances && !inst.Running()) || (!cleanDatabases && filter.IsDatabase()(inst))) {
+					continue
+				}
+				tagList = append(tagList, res)
+				reasons[res.ID()] = MaxLifetimeReason
+				totalCost += billing.AccumulatedCost(res)
 			}
 		}
 
+		tagList = withoutRetainedResources(owner, tagList)
+		tagList, stackResources := withoutStackResources(owner, tagList)
+		for _, res := range stackResources {
+			totalCost -= billing.AccumulatedCost(res)
+		}
+
+		// Mark the most expensive resources first, so that the highest impact
+		// waste is addressed when not everything can be marked in one run
+		billing.SortByAccumulatedCost(tagList)
+		maxToMark := getThreshold("clean-max-marked-per-account", thresholds)
+		if thresholdErr != nil {
+			return nil, thresholdErr
+		}
+		if maxToMark > 0 && len(tagList) > maxToMark {
+			log.Printf("%s: Only marking the %d most expensive of %d resources", cloud.AccountName(owner), maxToMark, len(tagList))
+			tagList = tagList[:maxToMark]
+		}
+		resourcesToTag := collectionFromResources(owner, tagList)
+
+		// Resources are never marked based on partial data, e.g. a
+		// resource could be in use by resources in a failed region
+		partial := mngr.ScanStatus().Partial(owner)
+		metrics.ObservePhase(metrics.PhaseFilter, filterStart)
+		tagStart := time.Now()
+		failedTags := 0
 		if dryRun {
 			log.Printf("Not tagging resources since this is a dry run")
+		} else if partial {
+			log.Printf("%s: Skipping the tagging of resources, since regions %s could not be scanned", cloud.AccountName(owner), strings.Join(mngr.ScanStatus().FailedRegions(owner), ", "))
 		} else if totalCost < totalCostThreshold {
-			log.Printf("%s: Skipping the tagging of resources, total cost $%.2f is less than $%.2f", owner, totalCost, totalCostThreshold)
+			log.Printf("%s: Skipping the tagging of resources, total cost $%.2f is less than $%.2f", cloud.AccountName(owner), totalCost, totalCostThreshold)
 		} else {
 			for _, res := range tagList {
-				err := res.SetTag(filter.DeleteTagKey, timeToDelete.Format(time.RFC3339), true)
+				tagKey, action := filter.DeleteTagKey, "deletion"
+				if _, isInstance := res.(cloud.Instance); isInstance && stopInstances {
+					tagKey, action = filter.StopTagKey, "stop"
+				}
+				err := setTag(res, tagKey, timeToDelete.Format(time.RFC3339), true, reasons[res.ID()])
 				if err != nil {
-					log.Printf("%s: Failed to tag %s for deletion: %s\n", owner, res.ID(), err)
+					log.Printf("%s: Failed to tag %s for %s: %s\n", cloud.AccountName(owner), res.ID(), action, err)
+					failedTags++
 				} else {
-					log.Printf("%s: Marked %s for deletion at %s\n", owner, res.ID(), timeToDelete)
+					log.Printf("%s: Marked %s for %s at %s\n", cloud.AccountName(owner), res.ID(), action, timeToDelete)
 				}
 			}
 		}
-		allResourcesToTag[owner] = &resourcesToTag
+		metrics.ObservePhase(metrics.PhaseTag, tagStart)
+		result := &markingResult{
+			resources:      resourcesToTag,
+			reasons:        reasons,
+			belowCost:      totalCost < totalCostThreshold,
+			partial:        partial,
+			stopInstances:  stopInstances,
+			stackResources: stackResources,
+		}
+		if failedTags > 0 {
+			return result, fmt.Errorf("Failed to tag %d of %d resources", failedTags, len(tagList))
+		}
+		return result, nil
 	}
-	return allResourcesToTag
+	return markAccounts(ctx, cloud.Accounts(allResources), markAccount)
+}
+
+// markAccounts marks resources in every account with markAccount,
+// MarkingConcurrency accounts at a time. An account that fails, or whose
+// marking panics, is reported as failed without affecting the others.
+// Accounts are skipped once ctx is done.
+func markAccounts(ctx context.Context, accounts []string, markAccount func(owner string) (*markingResult, error)) (map[string]*markingResult, *MarkingReport) {
+	concurrency := MarkingConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	allResults := make(map[string]*markingResult)
+	report := &MarkingReport{Completed: []string{}, Failed: cloud.AccountErrors{}, Skipped: []string{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, owner := range accounts {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if err := ctx.Err(); err != nil {
+				log.Printf("Skipping %s: %s\n", cloud.AccountName(owner), err)
+				mu.Lock()
+				report.Skipped = append(report.Skipped, owner)
+				mu.Unlock()
+				return
+			}
+			result, err := markAccountRecovered(owner, markAccount)
+			mu.Lock()
+			defer mu.Unlock()
+			if result != nil {
+				allResults[owner] = result
+			}
+			if err != nil {
+				log.Printf("%s: Marking resources for cleanup failed: %s\n", cloud.AccountName(owner), err)
+				report.Failed = append(report.Failed, cloud.AccountError{Account: owner, Region: cloud.GlobalScan, Err: err.Error()})
+				return
+			}
+			report.Completed = append(report.Completed, owner)
+		}(owner)
+	}
+	wg.Wait()
+	sort.Strings(report.Completed)
+	sort.Strings(report.Skipped)
+	sort.Slice(report.Failed, func(i, j int) bool {
+		return report.Failed[i].Account < report.Failed[j].Account
+	})
+	return allResults, report
+}
+
+// markAccountRecovered marks resources in an account with markAccount,
+// returning a panic as an error rather than taking down the whole run.
+// Resources tagged before the panic stay marked.
+func markAccountRecovered(owner string, markAccount func(owner string) (*markingResult, error)) (result *markingResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s: Marking resources for cleanup panicked: %v\n%s", cloud.AccountName(owner), r, debug.Stack())
+			result, err = nil, fmt.Errorf("Panicked: %v", r)
+		}
+	}()
+	return markAccount(owner)
+}
+
+// accountThresholds returns the thresholds used when marking resources
+// in an account, with the age and idle thresholds, in days, scaled by the
+// multiplier of the account. Disabled thresholds stay disabled, and no
+// threshold is scaled below a day.
+func accountThresholds(owner string, thresholds map[string]int) map[string]int {
+	multiplier, ok := AccountThresholdMultipliers[owner]
+	if !ok || multiplier == 1 {
+		return thresholds
+	}
+	scaled := make(map[string]int, len(thresholds))
+	for key, threshold := range thresholds {
+		if strings.HasSuffix(key, "-days") && threshold > 0 {
+			threshold = int(math.Max(1, math.Ceil(float64(threshold)*multiplier)))
+		}
+		scaled[key] = threshold
+	}
+	log.Printf("Scaling the thresholds of %s by %.2f\n", cloud.AccountName(owner), multiplier)
+	return scaled
+}
+
+// addMinSizeRules adds rules to a filter that exclude volumes, snapshots,
+// images and buckets smaller than their configured minimum size
+func addMinSizeRules(fil *filter.ResourceFilter, thresholds map[string]int) {
+	if gb := thresholds["clean-volumes-min-size-gb"]; gb > 0 {
+		fil.AddVolumeRule(func(v cloud.Volume) bool { return filter.SizeGreaterThanGB(gb)(v) })
+	}
+	if gb := thresholds["clean-snapshots-min-size-gb"]; gb > 0 {
+		fil.AddSnapshotRule(func(s cloud.Snapshot) bool { return filter.SizeGreaterThanGB(gb)(s) })
+	}
+	if gb := thresholds["clean-images-min-size-gb"]; gb > 0 {
+		fil.AddImageRule(func(i cloud.Image) bool { return filter.SizeGreaterThanGB(gb)(i) })
+	}
+	if gb := thresholds["clean-buckets-min-size-gb"]; gb > 0 {
+		fil.AddBucketRule(func(b cloud.Bucket) bool { return filter.SizeGreaterThanGB(gb)(b) })
+	}
+}
+
+// collectionFromResources sorts a list of resources into a collection, keeping
+// the order of the list within every type of resource.
+func collectionFromResources(owner string, resources []cloud.Resource) *cloud.AllResourceCollection {
+	collection := &cloud.AllResourceCollection{Owner: owner}
+	for _, res := range resources {
+		switch r := res.(type) {
+		case cloud.Instance:
+			collection.Instances = append(collection.Instances, r)
+		case cloud.Image:
+			collection.Images = append(collection.Images, r)
+		case cloud.Volume:
+			collection.Volumes = append(collection.Volumes, r)
+		case cloud.Snapshot:
+			collection.Snapshots = append(collection.Snapshots, r)
+		case cloud.Bucket:
+			collection.Buckets = append(collection.Buckets, r)
+		case cloud.Table:
+			collection.Tables = append(collection.Tables, r)
+		case cloud.CacheCluster:
+			collection.CacheClusters = append(collection.CacheClusters, r)
+		case cloud.Address:
+			collection.Addresses = append(collection.Addresses, r)
+		case cloud.NetworkGateway:
+			collection.NetworkGateways = append(collection.NetworkGateways, r)
+		case cloud.Capacity:
+			collection.Capacities = append(collection.Capacities, r)
+		case cloud.DBInstance:
+			collection.DBInstances = append(collection.DBInstances, r)
+		case cloud.DBSnapshot:
+			collection.DBSnapshots = append(collection.DBSnapshots, r)
+		}
+	}
+	return collection
 }
 
 // GetAllButNLatestComponents will look at AMIs, and return all but the two latest for each
@@ -202,7 +757,7 @@ func getAllButNLatestComponents(images []cloud.Image, componentsToKeep int) []cl
 		times, found := componentDatesMap[componentName]
 		if !found {
 			log.Fatalln("Times not found for some reason")
-			return time.Now().AddDate(-10, 0, 0)
+			return clock.Now().AddDate(-10, 0, 0)
 		}
 
 		sort.Slice(times, func(i, j int) bool {
@@ -229,98 +784,569 @@ func getAllButNLatestComponents(images []cloud.Image, componentsToKeep int) []cl
 	return resourcesToTag
 }
 
+// getAllButNLatestInFamilies will look at images that are part of an image
+// family, such as in GCP, and return all but the N latest images in each
+// family. Images that are not part of a family are never returned.
+func getAllButNLatestInFamilies(images []cloud.Image, imagesToKeep int) []cloud.Image {
+	families := map[string][]cloud.Image{}
+	for _, image := range images {
+		if image.Family() == "" {
+			continue
+		}
+		families[image.Family()] = append(families[image.Family()], image)
+	}
+
+	resourcesToTag := []cloud.Image{}
+	for _, familyImages := range families {
+		sort.Slice(familyImages, func(i, j int) bool {
+			// Sort images so that newest are first
+			return familyImages[i].CreationTime().After(familyImages[j].CreationTime())
+		})
+		if len(familyImages) > imagesToKeep {
+			resourcesToTag = append(resourcesToTag, familyImages[imagesToKeep:]...)
+		}
+	}
+	return resourcesToTag
+}
+
 // PerformCleanup will run different cleanup functions which all
 // do some sort of rule based cleanup
-func PerformCleanup(mngr cloud.ResourceManager) {
+func PerformCleanup(ctx context.Context, mngr cloud.ResourceManager) *Result {
 	// Cleanup all resources with a lifetime tag that has passed. This
-	// includes both the lifetime and the expiry tag
-	cleanupLifetimePassed(mngr)
+	// includes both the lifetime and the expiry tag, as well as release
+	// images past their lifecycle, see ReleaseImages
+	return cleanupLifetimePassed(ctx, mngr)
 }
 
-func cleanupLifetimePassed(mngr cloud.ResourceManager) {
-	allResources := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
-	for owner, resources := range allResources {
-		log.Println("Performing lifetime check in", owner)
-		lifetimeFilter := filter.New()
-		lifetimeFilter.AddGeneralRule(filter.LifetimeExceeded())
+// Result is the outcome of a cleanup
+type Result struct {
+	// CleanedUp is the number of resources that were cleaned up
+	CleanedUp int
+	// FailedAccounts are the accounts where some resources could not be
+	// cleaned up, even when retried
+	FailedAccounts []string
+	// DestroyedGB is the size of the data destroyed by the cleanup, by
+	// account, see cloud.DataSizeGB
+	DestroyedGB map[string]float64
+	// Throttling counts the requests that were throttled by the cloud
+	// provider during the cleanup
+	Throttling cloud.ThrottleStats
+	// ArchivedVolumes is the number of volumes that were archived before
+	// being cleaned up, see ArchiveVolumeDays, and ArchiveCostPerMonth the
+	// estimated monthly cost of their snapshots
+	ArchivedVolumes     int
+	ArchiveCostPerMonth float64
+}
 
-		expiryFilter := filter.New()
-		expiryFilter.AddGeneralRule(filter.ExpiryDatePassed())
+// TotalDestroyedGB returns the size of the data destroyed in all accounts
+func (r *Result) TotalDestroyedGB() float64 {
+	total := 0.0
+	for _, size := range r.DestroyedGB {
+		total += size
+	}
+	return total
+}
 
-		deleteAtFilter := filter.New()
-		deleteAtFilter.AddGeneralRule(filter.DeleteAtPassed())
+// dependencyRetryDelay is how long to wait before retrying cleanups that
+// failed, to let dependencies cleaned up earlier in the run (such as an
+// instance a volume is attached to) finish being deleted.
+var dependencyRetryDelay = 2 * time.Minute
 
-		err := mngr.CleanupInstances(filter.Instances(resources.Instances, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup instances in %s, err:\n%s", owner, err)
+// cleanupLifetimePassed cleans up resources in the order of their
+// dependencies: instances, images, volumes, snapshots, buckets and last
+// tables, cache clusters, addresses, network gateways, capacities and
+// databases.
+// Instances marked to be stopped are stopped after the instances have been
+// cleaned up, and release images are made private after the images have
+// been cleaned up.
+// Snapshots that images or volumes depend on, possibly in other accounts,
+// are cleaned up after all accounts have been handled, if their dependents
+// were cleaned up.
+// Resources that fail are retried once all accounts have been handled,
+// since a dependency might not have been fully removed when they were
+// first attempted. A tombstone is recorded for every resource that was
+// cleaned up, see Tombstones. The volumes and snapshots left behind by
+// terminated instances are tagged with filter.OrphanTagKey.
+// Volumes are archived as a snapshot before they're cleaned up, if
+// ArchiveVolumeDays is set.
+func cleanupLifetimePassed(ctx context.Context, mngr cloud.ResourceManager) *Result {
+	allResources := mngr.AllResourcesPerAccount(ctx)
+	allBuckets := mngr.BucketsPerAccount(ctx)
+	allTables := mngr.TablesPerAccount(ctx)
+	allCacheClusters := mngr.CacheClustersPerAccount(ctx)
+	allAddresses := mngr.AddressesPerAccount(ctx)
+	allGateways := mngr.NetworkGatewaysPerAccount(ctx)
+	allCapacities := mngr.CapacitiesPerAccount(ctx)
+	allDBInstances := mngr.DBInstancesPerAccount(ctx)
+	allDBSnapshots := mngr.DBSnapshotsPerAccount(ctx)
+	referencedImages, referencedErr := findReferencedImages(ctx, mngr)
+	dependencyErr := findSnapshotDependencies(ctx, mngr)
+	deleteStart := time.Now()
+	deferredSnapshots := make(map[string][]cloud.Snapshot)
+	failed := []cloud.Resource{}
+	attempted := 0
+	failedAccounts := make(map[string]bool)
+	destroyedGB := make(map[string]float64)
+	cleanedUp := []cloud.Resource{}
+	archivedVolumes := []cloud.Volume{}
+	// handle records the outcome of cleaning up the resources of a kind.
+	// Resources that can't be retried are counted as failed right away.
+	handle := func(owner, kind string, collection *cloud.AllResourceCollection, err error) {
+		resources := sortedResources(collection)
+		sizeGB := cloud.CollectionDataSizeGB(collection)
+		attempted += len(resources)
+		destroyedGB[owner] += sizeGB
+		if err == nil {
+			cleanedUp = append(cleanedUp, resources...)
+			return
 		}
-		err = mngr.CleanupImages(filter.Images(resources.Images, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup images in %s, err:\n%s", owner, err)
+		log.Printf("Could not cleanup %s in %s, err:\n%s", kind, cloud.AccountName(owner), err)
+		if retry := failedResources(err); len(retry) > 0 {
+			failed = append(failed, retry...)
+			cleanedUp = append(cleanedUp, resources...)
+		} else {
+			attempted -= len(resources)
+			destroyedGB[owner] -= sizeGB
+			failedAccounts[owner] = true
 		}
-		err = mngr.CleanupVolumes(filter.Volumes(resources.Volumes, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup volumes in %s, err:\n%s", owner, err)
+	}
+	for _, owner := range cloud.Accounts(allResources) {
+		if stopped(ctx, owner) {
+			failedAccounts[owner] = true
+			continue
 		}
-		err = mngr.CleanupSnapshots(filter.Snapshots(resources.Snapshots, lifetimeFilter, expiryFilter, deleteAtFilter))
-		if err != nil {
-			log.Printf("Could not cleanup snapshots in %s, err:\n%s", owner, err)
+		resources := allResources[owner]
+		log.Println("Performing lifetime check in", cloud.AccountName(owner))
+		resources.Images = withoutReferencedImages(owner, resources.Images, referencedImages, referencedErr)
+		lifetimeFilter, expiryFilter, deleteAtFilter := cleanupFilters()
+
+		instancesToCleanup := filter.Instances(resources.Instances, lifetimeFilter, expiryFilter, deleteAtFilter)
+		handle(owner, "instances", &cloud.AllResourceCollection{Instances: instancesToCleanup}, mngr.CleanupInstances(ctx, instancesToCleanup))
+		stopMarkedInstances(owner, resources.Instances, instancesToCleanup)
+		imageFilters := append([]*filter.ResourceFilter{lifetimeFilter, expiryFilter, deleteAtFilter}, ReleaseImages.deregisterFilters()...)
+		images := filter.Images(resources.Images, imageFilters...)
+		handle(owner, "images", &cloud.AllResourceCollection{Images: images}, mngr.CleanupImages(ctx, images))
+		makeReleaseImagesPrivate(owner, resources.Images, images)
+		volumes, archiveFailed := archiveVolumes(owner, filter.Volumes(resources.Volumes, lifetimeFilter, expiryFilter, deleteAtFilter))
+		if archiveFailed > 0 {
+			failedAccounts[owner] = true
 		}
+		archivedVolumes = append(archivedVolumes, volumes...)
+		handle(owner, "volumes", &cloud.AllResourceCollection{Volumes: volumes}, mngr.CleanupVolumes(ctx, volumes))
+		snapshots := filter.Snapshots(withoutUnsafeSnapshots(owner, resources.Snapshots, dependencyErr), lifetimeFilter, expiryFilter, deleteAtFilter)
+		snapshots, deferredSnapshots[owner] = withoutDependents(snapshots)
+		handle(owner, "snapshots", &cloud.AllResourceCollection{Snapshots: snapshots}, mngr.CleanupSnapshots(ctx, snapshots))
 		if bucks, ok := allBuckets[owner]; ok {
-			err = mngr.CleanupBuckets(filter.Buckets(bucks, lifetimeFilter, expiryFilter, deleteAtFilter))
-			if err != nil {
-				log.Printf("Could not cleanup buckets in %s, err:\n%s", owner, err)
+			buckets := filter.Buckets(bucks, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "buckets", &cloud.AllResourceCollection{Buckets: buckets}, mngr.CleanupBuckets(ctx, buckets))
+		}
+		if tables, ok := allTables[owner]; ok {
+			tables = filter.Tables(tables, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "tables", &cloud.AllResourceCollection{Tables: tables}, mngr.CleanupTables(ctx, tables))
+		}
+		if clusters, ok := allCacheClusters[owner]; ok {
+			clusters = filter.CacheClusters(clusters, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "cache clusters", &cloud.AllResourceCollection{CacheClusters: clusters}, mngr.CleanupCacheClusters(ctx, clusters))
+		}
+		if addresses, ok := allAddresses[owner]; ok {
+			addresses = filter.Addresses(addresses, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "addresses", &cloud.AllResourceCollection{Addresses: addresses}, mngr.CleanupAddresses(ctx, addresses))
+		}
+		if gateways, ok := allGateways[owner]; ok {
+			gateways = filter.NetworkGateways(gateways, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "network gateways", &cloud.AllResourceCollection{NetworkGateways: gateways}, mngr.CleanupNetworkGateways(ctx, gateways))
+		}
+		if capacities, ok := allCapacities[owner]; ok {
+			capacities = filter.Capacities(capacities, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "capacities", &cloud.AllResourceCollection{Capacities: capacities}, mngr.CleanupCapacities(ctx, capacities))
+		}
+		if instances, ok := allDBInstances[owner]; ok {
+			instances = filter.DBInstances(instances, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "databases", &cloud.AllResourceCollection{DBInstances: instances}, mngr.CleanupDBInstances(ctx, instances))
+		}
+		if snapshots, ok := allDBSnapshots[owner]; ok {
+			snapshots = filter.DBSnapshots(snapshots, lifetimeFilter, expiryFilter, deleteAtFilter)
+			handle(owner, "database snapshots", &cloud.AllResourceCollection{DBSnapshots: snapshots}, mngr.CleanupDBSnapshots(ctx, snapshots))
+		}
+	}
+	// Snapshots that images or volumes depend on are cleaned up once their
+	// dependents are gone, since those may be in accounts handled later
+	gone := make(map[string]bool)
+	for _, res := range cleanedUp {
+		gone[res.ID()] = true
+	}
+	for _, res := range failed {
+		gone[res.ID()] = false
+	}
+	for _, owner := range cloud.Accounts(allResources) {
+		if snapshots := dependentsCleanedUp(owner, deferredSnapshots[owner], gone); len(snapshots) > 0 {
+			handle(owner, "snapshots", &cloud.AllResourceCollection{Snapshots: snapshots}, mngr.CleanupSnapshots(ctx, snapshots))
+		}
+	}
+	stillFailing := retryFailedCleanups(ctx, failed)
+	for _, res := range stillFailing {
+		failedAccounts[res.Owner()] = true
+		destroyedGB[res.Owner()] -= cloud.DataSizeGB(res)
+	}
+	recordTombstones(cleanedUp, stillFailing)
+	auditDeletions(cleanedUp, stillFailing)
+	tagOrphans(allResources, cleanedUp, stillFailing)
+	metrics.ObservePhase(metrics.PhaseDelete, deleteStart)
+	result := &Result{CleanedUp: attempted - len(stillFailing), DestroyedGB: make(map[string]float64), Throttling: cloud.Throttling()}
+	if ArchiveVolumeDays > 0 {
+		// Only the archives of the volumes that are gone are counted
+		archivedVolumes = cleanedUpVolumes(archivedVolumes, cleanedUp, stillFailing)
+		result.ArchivedVolumes = len(archivedVolumes)
+		result.ArchiveCostPerMonth = archiveCostPerMonth(archivedVolumes)
+	}
+	for _, owner := range cloud.Accounts(allResources) {
+		if destroyedGB[owner] > 0 {
+			log.Printf("Destroyed %.1f GB of data in %s\n", destroyedGB[owner], cloud.AccountName(owner))
+			result.DestroyedGB[owner] = destroyedGB[owner]
+		}
+	}
+	for account := range failedAccounts {
+		result.FailedAccounts = append(result.FailedAccounts, account)
+	}
+	sort.Strings(result.FailedAccounts)
+	return result
+}
+
+// cleanupFilters returns the filters matching resources whose lifetime,
+// expiry date or delete-at time has passed. Resources that must be
+// retained are never matched.
+func cleanupFilters() (lifetimeFilter, expiryFilter, deleteAtFilter *filter.ResourceFilter) {
+	lifetimeFilter = filter.New()
+	lifetimeFilter.AddGeneralRule(filter.LifetimeExceeded())
+
+	expiryFilter = filter.New()
+	expiryFilter.AddGeneralRule(filter.ExpiryDatePassed())
+
+	deleteAtFilter = filter.New()
+	deleteAtFilter.AddGeneralRule(filter.DeleteAtPassed())
+
+	for _, fil := range []*filter.ResourceFilter{lifetimeFilter, expiryFilter, deleteAtFilter} {
+		fil.AddGeneralRule(filter.Negate(filter.UnderRetention()))
+	}
+	return lifetimeFilter, expiryFilter, deleteAtFilter
+}
+
+// stopMarkedInstances stops instances whose stop-at time has passed, unless
+// they were cleaned up. The stop tag is removed afterwards, so that an
+// instance started again is handled like any other instance.
+func stopMarkedInstances(owner string, instances, cleanedUp []cloud.Instance) {
+	cleaned := map[string]bool{}
+	for _, inst := range cleanedUp {
+		cleaned[inst.ID()] = true
+	}
+	stopAtFilter := filter.New()
+	stopAtFilter.AddGeneralRule(filter.StopAtPassed())
+	for _, inst := range filter.Instances(instances, stopAtFilter) {
+		if cleaned[inst.ID()] {
+			continue
+		}
+		if inst.Running() {
+			if err := inst.Stop(); err != nil {
+				log.Printf("%s: Could not stop %s: %s\n", cloud.AccountName(owner), inst.ID(), err)
+				continue
 			}
+			audit(inst, AuditStopped, "", "", "stop-at passed")
+		}
+		if err := removeTag(inst, filter.StopTagKey, "stop-at passed"); err != nil {
+			log.Printf("%s: Could not remove stop tag on %s: %s\n", cloud.AccountName(owner), inst.ID(), err)
 		}
 	}
 }
 
-// ResetCloudsweeper will remove any cleanup tags existing in the accounts
-// associated with the provided resource manager
-func ResetCloudsweeper(mngr cloud.ResourceManager) {
-	allResources := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
+// withoutRetainedResources removes all resources that must still be
+// retained for compliance from a list of resources
+func withoutRetainedResources(owner string, resources []cloud.Resource) []cloud.Resource {
+	underRetention := filter.UnderRetention()
+	result := []cloud.Resource{}
+	for _, res := range resources {
+		if underRetention(res) {
+			log.Printf("%s: Skipping %s since it's under retention\n", cloud.AccountName(owner), res.ID())
+			continue
+		}
+		result = append(result, res)
+	}
+	return result
+}
 
-	for owner, res := range allResources {
-		log.Println("Resetting Cloudsweeper tags in", owner)
-		taggedFilter := filter.New()
-		taggedFilter.AddGeneralRule(filter.HasTag(filter.DeleteTagKey))
+// findReferencedImages returns the IDs of images referenced by the
+// configured SSM parameters and launch templates
+func findReferencedImages(ctx context.Context, mngr cloud.ResourceManager) (map[string]bool, error) {
+	if len(ImageParameterPaths) == 0 && !ProtectLaunchTemplateImages {
+		return make(map[string]bool), nil
+	}
+	referenced, err := mngr.ReferencedImages(ctx, ImageParameterPaths, ProtectLaunchTemplateImages)
+	if err != nil {
+		log.Printf("Could not resolve referenced images, no images will be marked or cleaned up: %s\n", err)
+		return nil, err
+	}
+	log.Printf("Found %d referenced images\n", len(referenced))
+	return referenced, nil
+}
 
-		handleError := func(res cloud.Resource, err error) {
-			if err != nil {
-				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
-			} else {
-				log.Printf("Removed cleanup tag on %s\n", res.ID())
+// withoutReferencedImages removes all referenced images from a list of
+// images. If the referenced images could not be resolved, it's not safe
+// to touch any image, so no images are returned.
+func withoutReferencedImages(owner string, images []cloud.Image, referenced map[string]bool, referencedErr error) []cloud.Image {
+	if referencedErr != nil {
+		return []cloud.Image{}
+	}
+	result := []cloud.Image{}
+	for _, image := range images {
+		if referenced[image.ID()] {
+			log.Printf("%s: Skipping image %s since it's referenced\n", cloud.AccountName(owner), image.ID())
+			continue
+		}
+		result = append(result, image)
+	}
+	return result
+}
+
+// findSnapshotDependencies sets filter.Dependencies to the images and
+// volumes depending on each snapshot, in any account
+func findSnapshotDependencies(ctx context.Context, mngr cloud.ResourceManager) error {
+	graph, err := mngr.SnapshotDependencies(ctx)
+	if err != nil {
+		log.Printf("Could not resolve snapshot dependencies, no snapshots will be marked or cleaned up: %s\n", err)
+		return err
+	}
+	filter.Dependencies = graph
+	return nil
+}
+
+// withoutUnsafeSnapshots removes the snapshots that aren't safe to delete,
+// see filter.IsSafeToDelete, from a list of snapshots. If the dependencies
+// could not be resolved, it's not safe to touch any snapshot, so no
+// snapshots are returned.
+func withoutUnsafeSnapshots(owner string, snapshots []cloud.Snapshot, dependencyErr error) []cloud.Snapshot {
+	if dependencyErr != nil {
+		return []cloud.Snapshot{}
+	}
+	safeToDelete := filter.IsSafeToDelete()
+	result := []cloud.Snapshot{}
+	for _, snapshot := range snapshots {
+		if !safeToDelete(snapshot) {
+			log.Printf("%s: Skipping snapshot %s since other resources depend on it\n", cloud.AccountName(owner), snapshot.ID())
+			continue
+		}
+		result = append(result, snapshot)
+	}
+	return result
+}
+
+// withoutDependents splits a list of snapshots into those that nothing
+// depends on, and those that have to wait for their dependents to be
+// cleaned up
+func withoutDependents(snapshots []cloud.Snapshot) (independent, dependedOn []cloud.Snapshot) {
+	independent = []cloud.Snapshot{}
+	dependedOn = []cloud.Snapshot{}
+	for _, snapshot := range snapshots {
+		if len(filter.Dependencies.Dependents(snapshot.ID())) > 0 {
+			dependedOn = append(dependedOn, snapshot)
+		} else {
+			independent = append(independent, snapshot)
+		}
+	}
+	return independent, dependedOn
+}
+
+// dependentsCleanedUp returns the snapshots whose dependents are all gone,
+// and skips the others until a later run
+func dependentsCleanedUp(owner string, snapshots []cloud.Snapshot, gone map[string]bool) []cloud.Snapshot {
+	result := []cloud.Snapshot{}
+	for _, snapshot := range snapshots {
+		ready := true
+		for _, dependent := range filter.Dependencies.Dependents(snapshot.ID()) {
+			if !gone[dependent.ID()] {
+				ready = false
+				break
 			}
 		}
+		if !ready {
+			log.Printf("%s: Skipping snapshot %s until the resources depending on it are cleaned up\n", cloud.AccountName(owner), snapshot.ID())
+			continue
+		}
+		result = append(result, snapshot)
+	}
+	return result
+}
 
-		// Un-Tag instances
-		for _, res := range filter.Instances(res.Instances, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
+// stopped returns true if ctx is done, in which case owner and the
+// accounts after it are skipped
+func stopped(ctx context.Context, owner string) bool {
+	if err := ctx.Err(); err != nil {
+		log.Printf("Skipping %s and the remaining accounts: %s\n", cloud.AccountName(owner), err)
+		return true
+	}
+	return false
+}
+
+// failedResources returns the resources that failed to be cleaned
+// up, if the error is a cloud.CleanupError
+func failedResources(err error) []cloud.Resource {
+	if cleanupErr, ok := err.(*cloud.CleanupError); ok {
+		return cleanupErr.Failed
+	}
+	return []cloud.Resource{}
+}
+
+// retryFailedCleanups makes a second attempt at cleaning up resources,
+// in the same dependency order as the first attempt. The resources that
+// still fail are returned, which are all of them if ctx is done before
+// the retry.
+func retryFailedCleanups(ctx context.Context, failed []cloud.Resource) []cloud.Resource {
+	if len(failed) == 0 {
+		return failed
+	}
+	log.Printf("Retrying %d failed cleanups in %s\n", len(failed), dependencyRetryDelay)
+	select {
+	case <-time.After(dependencyRetryDelay):
+	case <-ctx.Done():
+		log.Printf("Not retrying failed cleanups: %s\n", ctx.Err())
+		return failed
+	}
+	sort.SliceStable(failed, func(i, j int) bool {
+		return cleanupOrder(failed[i]) < cleanupOrder(failed[j])
+	})
+	stillFailing := []cloud.Resource{}
+	for _, res := range failed {
+		if err := res.Cleanup(); err != nil {
+			log.Printf("Retry of cleaning up %s in %s failed: %s\n", res.ID(), cloud.AccountName(res.Owner()), err)
+			stillFailing = append(stillFailing, res)
 		}
+	}
+	log.Printf("%d of %d failed cleanups succeeded when retried\n", len(failed)-len(stillFailing), len(failed))
+	return stillFailing
+}
 
-		// Un-Tag volumes
-		for _, res := range filter.Volumes(res.Volumes, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
+// cleanupOrder returns the position of the type of a resource in the
+// cleanup order. Resources depending on others are cleaned up later.
+func cleanupOrder(res cloud.Resource) int {
+	switch res.(type) {
+	case cloud.Instance:
+		return 0
+	case cloud.Image:
+		return 1
+	case cloud.Volume:
+		return 2
+	case cloud.Snapshot:
+		return 3
+	case cloud.Bucket:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// ResetCloudsweeper will remove any cleanup tags existing in the accounts
+// associated with the provided resource manager. If dryRun is set, the
+// tags that would have been removed are only listed, together with the
+// time the resources are currently set to be deleted at. Only the cleanup
+// and stop tags are removed, other Cloudsweeper tags such as notes are kept.
+func ResetCloudsweeper(ctx context.Context, mngr cloud.ResourceManager, dryRun bool) {
+	allResources := mngr.AllResourcesPerAccount(ctx)
+	allBuckets := mngr.BucketsPerAccount(ctx)
+	allTables := mngr.TablesPerAccount(ctx)
+	allCacheClusters := mngr.CacheClustersPerAccount(ctx)
+	allAddresses := mngr.AddressesPerAccount(ctx)
+	allGateways := mngr.NetworkGatewaysPerAccount(ctx)
+	allCapacities := mngr.CapacitiesPerAccount(ctx)
+	allDBInstances := mngr.DBInstancesPerAccount(ctx)
+	allDBSnapshots := mngr.DBSnapshotsPerAccount(ctx)
+
+	owners := []string{}
+	for owner := range allResources {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	for _, owner := range owners {
+		if stopped(ctx, owner) {
+			break
+		}
+		res := allResources[owner]
+		if dryRun {
+			log.Println("Listing Cloudsweeper tags that would be removed in", cloud.AccountName(owner))
+		} else {
+			log.Println("Resetting Cloudsweeper tags in", cloud.AccountName(owner))
 		}
+		taggedFilter := filter.New()
+		taggedFilter.AddGeneralRule(filter.HasTag(filter.DeleteTagKey))
 
-		// Un-Tag snapshots
+		tagged := []cloud.Resource{}
+		for _, res := range filter.Instances(res.Instances, taggedFilter) {
+			tagged = append(tagged, res)
+		}
+		for _, res := range filter.Volumes(res.Volumes, taggedFilter) {
+			tagged = append(tagged, res)
+		}
 		for _, res := range filter.Snapshots(res.Snapshots, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
+			tagged = append(tagged, res)
 		}
-
-		// Un-Tag images
 		for _, res := range filter.Images(res.Images, taggedFilter) {
-			handleError(res, res.RemoveTag(filter.DeleteTagKey))
+			tagged = append(tagged, res)
 		}
-
-		// Un-Tag buckets
 		if buck, ok := allBuckets[owner]; ok {
 			for _, res := range filter.Buckets(buck, taggedFilter) {
-				handleError(res, res.RemoveTag(filter.DeleteTagKey))
+				tagged = append(tagged, res)
 			}
 		}
+		for _, res := range filter.Tables(allTables[owner], taggedFilter) {
+			tagged = append(tagged, res)
+		}
+		for _, res := range filter.CacheClusters(allCacheClusters[owner], taggedFilter) {
+			tagged = append(tagged, res)
+		}
+		for _, res := range filter.Addresses(allAddresses[owner], taggedFilter) {
+			tagged = append(tagged, res)
+		}
+		for _, res := range filter.NetworkGateways(allGateways[owner], taggedFilter) {
+			tagged = append(tagged, res)
+		}
+		for _, res := range filter.Capacities(allCapacities[owner], taggedFilter) {
+			tagged = append(tagged, res)
+		}
+		for _, res := range filter.DBInstances(allDBInstances[owner], taggedFilter) {
+			tagged = append(tagged, res)
+		}
+		for _, res := range filter.DBSnapshots(allDBSnapshots[owner], taggedFilter) {
+			tagged = append(tagged, res)
+		}
 
+		for _, res := range tagged {
+			if dryRun {
+				log.Printf("%s: Would remove cleanup tag on %s (delete at %s)\n", cloud.AccountName(owner), res.ID(), res.Tags()[filter.DeleteTagKey])
+				continue
+			}
+			err := removeTag(res, filter.DeleteTagKey, "reset")
+			if err != nil {
+				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
+			} else {
+				log.Printf("Removed cleanup tag on %s\n", res.ID())
+			}
+		}
+
+		stopTaggedFilter := filter.New()
+		stopTaggedFilter.AddGeneralRule(filter.HasTag(filter.StopTagKey))
+		stopTagged := filter.Instances(res.Instances, stopTaggedFilter)
+		for _, res := range stopTagged {
+			if dryRun {
+				log.Printf("%s: Would remove stop tag on %s (stop at %s)\n", cloud.AccountName(owner), res.ID(), res.Tags()[filter.StopTagKey])
+				continue
+			}
+			err := removeTag(res, filter.StopTagKey, "reset")
+			if err != nil {
+				log.Printf("Failed to remove tag on %s: %s\n", res.ID(), err)
+			} else {
+				log.Printf("Removed stop tag on %s\n", res.ID())
+			}
+		}
+		if dryRun {
+			log.Printf("%s: %d cleanup tags would be removed\n", cloud.AccountName(owner), len(tagged)+len(stopTagged))
+		}
 	}
 }
@@ -0,0 +1,85 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMarkAccounts(t *testing.T) {
+	defer func(concurrency int) { MarkingConcurrency = concurrency }(MarkingConcurrency)
+	MarkingConcurrency = 2
+
+	accounts := []string{"444444444444", "111111111111", "222222222222", "333333333333"}
+	results, report := markAccounts(context.Background(), accounts, func(owner string) (*markingResult, error) {
+		switch owner {
+		case "222222222222":
+			panic("nil map")
+		case "333333333333":
+			return &markingResult{}, errors.New("Failed to tag 1 of 2 resources")
+		}
+		return &markingResult{}, nil
+	})
+
+	if expected := []string{"111111111111", "444444444444"}; !reflect.DeepEqual(report.Completed, expected) {
+		t.Errorf("Completed %v, expected %v", report.Completed, expected)
+	}
+	if len(report.Skipped) != 0 {
+		t.Errorf("Skipped %v, expected none", report.Skipped)
+	}
+	failed := make(map[string]string)
+	for _, err := range report.Failed {
+		failed[err.Account] = err.Err
+	}
+	expectedFailed := map[string]string{
+		"222222222222": "Panicked: nil map",
+		"333333333333": "Failed to tag 1 of 2 resources",
+	}
+	if !reflect.DeepEqual(failed, expectedFailed) || report.Failed[0].Account != "222222222222" {
+		t.Errorf("Failed %v, expected %v in order", report.Failed, expectedFailed)
+	}
+
+	// Accounts that failed to tag some resources still have their result,
+	// but accounts that panicked have none
+	for _, owner := range []string{"111111111111", "333333333333", "444444444444"} {
+		if results[owner] == nil {
+			t.Errorf("%s has no result", owner)
+		}
+	}
+	if _, exist := results["222222222222"]; exist {
+		t.Error("Account that panicked should have no result")
+	}
+}
+
+func TestMarkAccountsCancelled(t *testing.T) {
+	defer func(concurrency int) { MarkingConcurrency = concurrency }(MarkingConcurrency)
+	MarkingConcurrency = 1
+
+	// The run is cancelled while the first account is marked, whichever
+	// account that is, so the rest are skipped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var once sync.Once
+	accounts := []string{"111111111111", "222222222222", "333333333333"}
+	results, report := markAccounts(ctx, accounts, func(owner string) (*markingResult, error) {
+		once.Do(cancel)
+		return &markingResult{}, nil
+	})
+
+	if len(report.Completed) != 1 || len(report.Skipped) != 2 || len(report.Failed) != 0 {
+		t.Fatalf("Completed %v, skipped %v and failed %v, expected 1 completed and 2 skipped", report.Completed, report.Skipped, report.Failed)
+	}
+	if len(results) != 1 || results[report.Completed[0]] == nil {
+		t.Errorf("Only %s should have a result, got %d", report.Completed[0], len(results))
+	}
+	for _, owner := range report.Skipped {
+		if owner == report.Completed[0] {
+			t.Errorf("%s was both completed and skipped", owner)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+// PolicyDiff lists how the resources matched for marking in an account
+// change when going from one policy (set of thresholds) to another
+type PolicyDiff struct {
+	Owner string
+	// Added are resources only matched by the new policy
+	Added []cloud.Resource
+	// Removed are resources only matched by the old policy
+	Removed []cloud.Resource
+	// Unchanged are resources matched by both policies
+	Unchanged []cloud.Resource
+}
+
+// DiffPolicies runs the marking logic, without marking anything, with both
+// the old and the new thresholds against the same inventory. It returns the
+// difference for every account where any resource is matched. The manager
+// should cache its resources (see cloud.NewCachedManager), otherwise the
+// inventory is listed twice and might change in between.
+func DiffPolicies(ctx context.Context, mngr cloud.ResourceManager, oldThresholds, newThresholds map[string]int) []*PolicyDiff {
+	log.Println("Matching resources with the old policy")
+	oldMatches, _ := MarkForCleanup(ctx, mngr, oldThresholds, true)
+	log.Println("Matching resources with the new policy")
+	newMatches, _ := MarkForCleanup(ctx, mngr, newThresholds, true)
+
+	owners := map[string]bool{}
+	for owner := range oldMatches {
+		owners[owner] = true
+	}
+	for owner := range newMatches {
+		owners[owner] = true
+	}
+	result := []*PolicyDiff{}
+	for owner := range owners {
+		oldResources := collectionResources(oldMatches[owner])
+		newResources := collectionResources(newMatches[owner])
+		diff := &PolicyDiff{Owner: owner}
+		for id, res := range newResources {
+			if _, matched := oldResources[id]; matched {
+				diff.Unchanged = append(diff.Unchanged, res)
+			} else {
+				diff.Added = append(diff.Added, res)
+			}
+		}
+		for id, res := range oldResources {
+			if _, matched := newResources[id]; !matched {
+				diff.Removed = append(diff.Removed, res)
+			}
+		}
+		if len(diff.Added)+len(diff.Removed)+len(diff.Unchanged) > 0 {
+			sortByID(diff.Added)
+			sortByID(diff.Removed)
+			sortByID(diff.Unchanged)
+			result = append(result, diff)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Owner < result[j].Owner
+	})
+	return result
+}
+
+// FormatPolicyDiffs returns a report of policy differences, similar to
+// a diff of code. Unchanged resources are only counted.
+func FormatPolicyDiffs(diffs []*PolicyDiff) string {
+	b := new(bytes.Buffer)
+	added, removed, unchanged := 0, 0, 0
+	for _, diff := range diffs {
+		added += len(diff.Added)
+		removed += len(diff.Removed)
+		unchanged += len(diff.Unchanged)
+		if len(diff.Added)+len(diff.Removed) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "\n%s (%d unchanged):\n", diff.Owner, len(diff.Unchanged))
+		for _, res := range diff.Added {
+			fmt.Fprintf(b, "+ %-14s %s (%s)\n", ResourceKind(res), res.ID(), res.Location())
+		}
+		for _, res := range diff.Removed {
+			fmt.Fprintf(b, "- %-14s %s (%s)\n", ResourceKind(res), res.ID(), res.Location())
+		}
+	}
+	fmt.Fprintf(b, "\n%d newly matched, %d no longer matched, %d unchanged\n", added, removed, unchanged)
+	return b.String()
+}
+
+// collectionResources returns all resources in a collection by their ID
+func collectionResources(collection *cloud.AllResourceCollection) map[string]cloud.Resource {
+	result := make(map[string]cloud.Resource)
+	if collection == nil {
+		return result
+	}
+	for _, res := range collection.Instances {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.Images {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.Volumes {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.Snapshots {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.Buckets {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.Tables {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.CacheClusters {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.Addresses {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.NetworkGateways {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.Capacities {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.DBInstances {
+		result[res.ID()] = res
+	}
+	for _, res := range collection.DBSnapshots {
+		result[res.ID()] = res
+	}
+	return result
+}
+
+// ResourceKind returns the name of the type of a resource, e.g. "volume"
+func ResourceKind(res cloud.Resource) string {
+	switch r := res.(type) {
+	case cloud.Instance:
+		return "instance"
+	case cloud.Image:
+		return "image"
+	case cloud.Volume:
+		return "volume"
+	case cloud.Snapshot:
+		return "snapshot"
+	case cloud.Bucket:
+		return "bucket"
+	case cloud.Table:
+		return "table"
+	case cloud.CacheCluster:
+		return "cache-cluster"
+	case cloud.Address:
+		return "address"
+	case cloud.NetworkGateway:
+		return r.GatewayType()
+	case cloud.Capacity:
+		return r.CapacityType()
+	case cloud.DBInstance:
+		return "db-instance"
+	case cloud.DBSnapshot:
+		return "db-snapshot"
+	default:
+		return "resource"
+	}
+}
+
+func sortByID(resources []cloud.Resource) {
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ID() < resources[j].ID()
+	})
+}
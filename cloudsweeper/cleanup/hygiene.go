@@ -0,0 +1,91 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// FindTagConflicts returns the conflicting or duplicate Cloudsweeper tags
+// of resources in all accounts, see filter.TagConflicts for how they are
+// resolved
+func FindTagConflicts(ctx context.Context, mngr cloud.ResourceManager) []*filter.TagConflict {
+	collections := accountCollections(ctx, mngr)
+	conflicts := []*filter.TagConflict{}
+	for _, owner := range cloud.AllAccounts(collections) {
+		found := len(conflicts)
+		for _, res := range sortedResources(collections[owner]) {
+			conflicts = append(conflicts, filter.TagConflicts(res)...)
+		}
+		log.Printf("%s: Found %d tag conflicts\n", cloud.AccountName(owner), len(conflicts)-found)
+	}
+	return conflicts
+}
+
+// RepairTagConflicts makes the tag changes that resolve the conflicts. It
+// returns the number of conflicts that failed to be repaired.
+func RepairTagConflicts(conflicts []*filter.TagConflict) int {
+	failed := 0
+	for _, conflict := range conflicts {
+		res := conflict.Resource
+		if err := repairTagConflict(conflict); err != nil {
+			log.Printf("%s: Could not repair tags of %s: %s\n", cloud.AccountName(res.Owner()), res.ID(), err)
+			failed++
+			continue
+		}
+		log.Printf("%s: Repaired tags of %s, %s\n", cloud.AccountName(res.Owner()), res.ID(), conflict.Problem)
+	}
+	return failed
+}
+
+// repairTagConflict sets the tags of a conflict before removing any, so
+// that the value of a renamed tag is never lost
+func repairTagConflict(conflict *filter.TagConflict) error {
+	for _, key := range sortedKeys(conflict.Set) {
+		if err := setTag(conflict.Resource, key, conflict.Set[key], true, conflict.Problem); err != nil {
+			return err
+		}
+	}
+	for _, key := range conflict.Remove {
+		if err := removeTag(conflict.Resource, key, conflict.Problem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatTagConflicts returns a report of the tag conflicts, one conflict
+// per line
+func FormatTagConflicts(conflicts []*filter.TagConflict) string {
+	b := new(bytes.Buffer)
+	owner := ""
+	for _, conflict := range conflicts {
+		res := conflict.Resource
+		if res.Owner() != owner {
+			owner = res.Owner()
+			fmt.Fprintf(b, "\n%s:\n", owner)
+		}
+		fmt.Fprintf(b, "  %-14s %-24s %s (%s)\n", ResourceKind(res), res.ID(), conflict.Problem, formatRepair(conflict))
+	}
+	fmt.Fprintf(b, "\nFound %d tag conflicts\n", len(conflicts))
+	return b.String()
+}
+
+func formatRepair(conflict *filter.TagConflict) string {
+	changes := []string{}
+	if len(conflict.Set) > 0 {
+		changes = append(changes, "set "+formatTags(conflict.Set))
+	}
+	if len(conflict.Remove) > 0 {
+		changes = append(changes, "remove "+strings.Join(conflict.Remove, ", "))
+	}
+	return strings.Join(changes, ", ")
+}
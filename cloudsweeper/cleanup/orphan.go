@@ -0,0 +1,131 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"context"
+	"log"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// orphanIncludeTagValue is the value of the tag set by IncludeOrphans
+const orphanIncludeTagValue = "true"
+
+// tagOrphans tags the volumes and snapshots left behind by the instances
+// that were terminated with the ID of their instance (see
+// filter.OrphanTagKey), since the attachment history of a volume is lost
+// once its instance is gone. Resources that were cleaned up themselves are
+// not tagged.
+func tagOrphans(allResources map[string]*cloud.ResourceCollection, cleanedUp, stillFailing []cloud.Resource) {
+	removed := make(map[string]bool)
+	for _, res := range cleanedUp {
+		removed[res.ID()] = true
+	}
+	for _, res := range stillFailing {
+		removed[res.ID()] = false
+	}
+	for _, res := range cleanedUp {
+		inst, ok := res.(cloud.Instance)
+		if !ok || !removed[inst.ID()] {
+			continue
+		}
+		for _, orphan := range orphanChain(inst, allResources[inst.Owner()], removed) {
+			if err := setTag(orphan, filter.OrphanTagKey, inst.ID(), true, "instance terminated"); err != nil {
+				log.Printf("%s: Could not tag %s as left behind by %s: %s\n", cloud.AccountName(inst.Owner()), orphan.ID(), inst.ID(), err)
+			}
+		}
+	}
+}
+
+// orphanChain returns the volumes attached to an instance, or created for
+// it according to their tags, and the snapshots of those volumes or of
+// the instance. Removed resources are left out, but their snapshots are
+// not.
+func orphanChain(inst cloud.Instance, collection *cloud.ResourceCollection, removed map[string]bool) []cloud.Resource {
+	chain := []cloud.Resource{}
+	if collection == nil {
+		return chain
+	}
+	volumes := make(map[string]bool)
+	for _, id := range inst.Lineage() {
+		volumes[id] = true
+	}
+	for _, vol := range collection.Volumes {
+		if !volumes[vol.ID()] && !references(vol, inst.ID()) {
+			continue
+		}
+		volumes[vol.ID()] = true
+		if !removed[vol.ID()] {
+			chain = append(chain, vol)
+		}
+	}
+	for _, snap := range collection.Snapshots {
+		if removed[snap.ID()] {
+			continue
+		}
+		if references(snap, inst.ID()) || fromAny(snap, volumes) {
+			chain = append(chain, snap)
+		}
+	}
+	return chain
+}
+
+// references checks if a resource is attached to or was created from the
+// resource with the specified ID, or has a tag whose value is the ID
+func references(res cloud.Resource, id string) bool {
+	for _, lineageID := range res.Lineage() {
+		if lineageID == id {
+			return true
+		}
+	}
+	for _, value := range res.Tags() {
+		if value == id {
+			return true
+		}
+	}
+	return false
+}
+
+// fromAny checks if a resource was created from any of the resources
+// with the specified IDs
+func fromAny(res cloud.Resource, ids map[string]bool) bool {
+	for _, id := range res.Lineage() {
+		if ids[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludeOrphans includes the volumes and snapshots left behind by
+// terminated instances, in all accounts of the manager, in the next
+// marking run by tagging them with filter.OrphanIncludeTagKey. Orphans
+// that are whitelisted, snoozed or already marked are left as they are.
+// It returns the number of orphans included and the number that failed.
+func IncludeOrphans(ctx context.Context, mngr cloud.ResourceManager) (included, failed int) {
+	allResources := mngr.AllResourcesPerAccount(ctx)
+	orphanFilter := filter.New()
+	orphanFilter.AddGeneralRule(filter.HasTag(filter.OrphanTagKey))
+	orphanFilter.AddGeneralRule(filter.Negate(filter.HasTag(filter.OrphanIncludeTagKey)))
+	orphanFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+	for _, owner := range cloud.Accounts(allResources) {
+		collection := allResources[owner]
+		orphans := sortedResources(&cloud.AllResourceCollection{
+			Volumes:   filter.Volumes(collection.Volumes, orphanFilter),
+			Snapshots: filter.Snapshots(collection.Snapshots, orphanFilter),
+		})
+		for _, res := range orphans {
+			if err := setTag(res, filter.OrphanIncludeTagKey, orphanIncludeTagValue, true, "orphan included"); err != nil {
+				log.Printf("%s: Could not include %s in the next marking run: %s\n", cloud.AccountName(owner), res.ID(), err)
+				failed++
+				continue
+			}
+			log.Printf("%s: Included %s, left behind by %s, in the next marking run\n", cloud.AccountName(owner), res.ID(), res.Tags()[filter.OrphanTagKey])
+			included++
+		}
+	}
+	return included, failed
+}
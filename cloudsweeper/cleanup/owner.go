@@ -0,0 +1,197 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// ownerReason is the reason recorded in the audit log and tombstones for
+// changes the owner of a resource requested with the owner commands
+const ownerReason = "requested by owner"
+
+// FlaggedResources returns the resources in all accounts of the manager
+// that are marked to be deleted or stopped. The manager of the owner
+// commands only covers the accounts of the employee running them.
+func FlaggedResources(ctx context.Context, mngr cloud.ResourceManager) []cloud.Resource {
+	collections := accountCollections(ctx, mngr)
+	flagged := []cloud.Resource{}
+	for _, owner := range cloud.AllAccounts(collections) {
+		for _, res := range sortedResources(collections[owner]) {
+			if _, _, marked := markTag(res); marked {
+				flagged = append(flagged, res)
+			}
+		}
+	}
+	return flagged
+}
+
+// FormatFlaggedResources lists flagged resources by account, with when
+// they will be deleted or stopped
+func FormatFlaggedResources(resources []cloud.Resource) string {
+	b := new(bytes.Buffer)
+	owner := ""
+	for _, res := range resources {
+		if res.Owner() != owner {
+			owner = res.Owner()
+			fmt.Fprintf(b, "\n%s:\n", owner)
+		}
+		key, value, _ := markTag(res)
+		action := "delete at"
+		if key == filter.StopTagKey {
+			action = "stop at"
+		}
+		fmt.Fprintf(b, "  %-14s %-24s %s %s\n", ResourceKind(res), res.ID(), action, value)
+	}
+	fmt.Fprintf(b, "\nFound %d resources marked for cleanup\n", len(resources))
+	return b.String()
+}
+
+// markTag returns the key and value of the delete-at or stop-at tag of a
+// resource, and whether it has any of them
+func markTag(res cloud.Resource) (key, value string, marked bool) {
+	for _, key := range []string{filter.DeleteTagKey, filter.StopTagKey} {
+		if value, exist := res.Tags()[key]; exist {
+			return key, value, true
+		}
+	}
+	return "", "", false
+}
+
+// ExtendResource postpones the deletion or stop of the marked resource
+// with the specified ID by the specified number of days. A time that has
+// already passed is postponed from now instead.
+func ExtendResource(ctx context.Context, mngr cloud.ResourceManager, id string, days int) error {
+	if days <= 0 {
+		return fmt.Errorf("Must extend by at least one day")
+	}
+	res, err := findResource(ctx, mngr, id)
+	if err != nil {
+		return err
+	}
+	key, value, marked := markTag(res)
+	if !marked {
+		return fmt.Errorf("%s is not marked for cleanup", res.ID())
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("%s has a malformed %s tag: %s", res.ID(), key, value)
+	}
+	if now := clock.Now(); now.After(at) {
+		at = now
+	}
+	extended := at.AddDate(0, 0, days).Format(time.RFC3339)
+	log.Printf("Extending %s in %s until %s", res.ID(), cloud.AccountName(res.Owner()), extended)
+	if err := setTag(res, key, extended, true, ownerReason); err != nil {
+		return fmt.Errorf("Could not extend %s: %s", res.ID(), err)
+	}
+	return nil
+}
+
+// WhitelistResource whitelists the resource with the specified ID on
+// behalf of the employee with the specified username, which is the value
+// of the whitelist tag. An already whitelisted resource is whitelisted
+// again, so its maximum lifetime starts over. Whitelisting an expensive
+// resource must still be approved, unless the employee is one of the
+// filter.WhitelistApprovers, who is then set as its approver.
+func WhitelistResource(ctx context.Context, mngr cloud.ResourceManager, id, username string) error {
+	res, err := findResource(ctx, mngr, id)
+	if err != nil {
+		return err
+	}
+	log.Printf("Whitelisting %s in %s", res.ID(), cloud.AccountName(res.Owner()))
+	entry := &WhitelistEntry{Account: res.Owner(), Kind: ResourceKind(res), ID: res.ID(), Value: username, Renew: true}
+	for _, approver := range filter.WhitelistApprovers {
+		if strings.EqualFold(username, approver) {
+			entry.Approver = approver
+		}
+	}
+	if err := applyWhitelistEntry(res, entry); err != nil {
+		return fmt.Errorf("Could not whitelist %s: %s", res.ID(), err)
+	}
+	return nil
+}
+
+// DeleteResourceNow cleans up the resource with the specified ID right
+// away, instead of waiting for its delete-at or stop-at time to pass. Only
+// resources marked for cleanup can be deleted, and the same safeguards as
+// in the scheduled cleanup apply: resources under retention, referenced
+// images and snapshots that other resources depend on are never deleted.
+// The cleanup is made through the manager, so that it's handed to the
+// cleanup delegate if there is one, and recorded in the audit log and as a
+// tombstone.
+func DeleteResourceNow(ctx context.Context, mngr cloud.ResourceManager, id string) error {
+	res, err := findResource(ctx, mngr, id)
+	if err != nil {
+		return err
+	}
+	if _, _, marked := markTag(res); !marked {
+		return fmt.Errorf("%s is not marked for cleanup", res.ID())
+	}
+	if filter.UnderRetention()(res) {
+		return fmt.Errorf("%s must not be deleted since it's under retention", res.ID())
+	}
+	switch r := res.(type) {
+	case cloud.Image:
+		referenced, referencedErr := findReferencedImages(ctx, mngr)
+		if len(withoutReferencedImages(r.Owner(), []cloud.Image{r}, referenced, referencedErr)) == 0 {
+			return fmt.Errorf("%s must not be deleted since it's referenced, or the referenced images are unknown", r.ID())
+		}
+	case cloud.Snapshot:
+		dependencyErr := findSnapshotDependencies(ctx, mngr)
+		snapshots, dependedOn := withoutDependents(withoutUnsafeSnapshots(r.Owner(), []cloud.Snapshot{r}, dependencyErr))
+		if len(snapshots) == 0 || len(dependedOn) > 0 {
+			return fmt.Errorf("%s must not be deleted since other resources depend on it, or its dependencies are unknown", r.ID())
+		}
+	}
+	log.Printf("Cleaning up %s in %s", res.ID(), cloud.AccountName(res.Owner()))
+	if err := cleanupResource(ctx, mngr, res); err != nil {
+		return fmt.Errorf("Could not clean up %s: %s", res.ID(), err)
+	}
+	audit(res, AuditDeleted, "", "", ownerReason)
+	recordTombstone(res, ownerReason, clock.Now())
+	return nil
+}
+
+// cleanupResource cleans up a single resource with the cleanup method of
+// the manager for its type
+func cleanupResource(ctx context.Context, mngr cloud.ResourceManager, res cloud.Resource) error {
+	switch r := res.(type) {
+	case cloud.Instance:
+		return mngr.CleanupInstances(ctx, []cloud.Instance{r})
+	case cloud.Image:
+		return mngr.CleanupImages(ctx, []cloud.Image{r})
+	case cloud.Volume:
+		return mngr.CleanupVolumes(ctx, []cloud.Volume{r})
+	case cloud.Snapshot:
+		return mngr.CleanupSnapshots(ctx, []cloud.Snapshot{r})
+	case cloud.Bucket:
+		return mngr.CleanupBuckets(ctx, []cloud.Bucket{r})
+	case cloud.Table:
+		return mngr.CleanupTables(ctx, []cloud.Table{r})
+	case cloud.CacheCluster:
+		return mngr.CleanupCacheClusters(ctx, []cloud.CacheCluster{r})
+	case cloud.Address:
+		return mngr.CleanupAddresses(ctx, []cloud.Address{r})
+	case cloud.NetworkGateway:
+		return mngr.CleanupNetworkGateways(ctx, []cloud.NetworkGateway{r})
+	case cloud.Capacity:
+		return mngr.CleanupCapacities(ctx, []cloud.Capacity{r})
+	case cloud.DBInstance:
+		return mngr.CleanupDBInstances(ctx, []cloud.DBInstance{r})
+	case cloud.DBSnapshot:
+		return mngr.CleanupDBSnapshots(ctx, []cloud.DBSnapshot{r})
+	default:
+		return fmt.Errorf("%s can't be cleaned up", res.ID())
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+const (
+	// ActionDelete is the action of resources that are deleted
+	ActionDelete = "delete"
+	// ActionStop is the action of instances that are stopped
+	ActionStop = "stop"
+	// ActionMakePrivate is the action of release images that are made
+	// private, see ReleaseImages
+	ActionMakePrivate = "private"
+)
+
+// PlannedResource is a resource that would be marked or cleaned up
+type PlannedResource struct {
+	Owner    string
+	Resource cloud.Resource
+	// Action is what is done to the resource, ActionDelete, ActionStop or
+	// ActionMakePrivate
+	Action string
+	// Reason is the rule that matched the resource, e.g. "untagged"
+	Reason string
+}
+
+// PlanMarking returns the resources that MarkForCleanup would mark with
+// the specified thresholds, without marking anything. Accounts where
+// nothing would be marked, since the total cost of the resources is too
+// low or the account could not be fully scanned, are left out.
+func PlanMarking(ctx context.Context, mngr cloud.ResourceManager, thresholds map[string]int) []*PlannedResource {
+	results, _ := markForCleanup(ctx, mngr, thresholds, true)
+	owners := []string{}
+	for owner := range results {
+		owners = append(owners, owner)
+	}
+	cloud.SortIDs(owners)
+
+	planned := []*PlannedResource{}
+	for _, owner := range owners {
+		result := results[owner]
+		if result.belowCost || result.partial {
+			continue
+		}
+		for _, res := range sortedResources(result.resources) {
+			action := ActionDelete
+			if _, isInstance := res.(cloud.Instance); isInstance && result.stopInstances {
+				action = ActionStop
+			}
+			planned = append(planned, &PlannedResource{
+				Owner:    owner,
+				Resource: res,
+				Action:   action,
+				Reason:   result.reasons[res.ID()],
+			})
+		}
+	}
+	return planned
+}
+
+// PlanCleanup returns the resources that PerformCleanup would clean up
+// or stop if it ran at the specified time, without touching anything
+func PlanCleanup(ctx context.Context, mngr cloud.ResourceManager, at time.Time) []*PlannedResource {
+	previous := clock.Current()
+	clock.Set(clock.Frozen(at))
+	defer clock.Set(previous)
+
+	allResources := mngr.AllResourcesPerAccount(ctx)
+	allBuckets := mngr.BucketsPerAccount(ctx)
+	allTables := mngr.TablesPerAccount(ctx)
+	allCacheClusters := mngr.CacheClustersPerAccount(ctx)
+	allAddresses := mngr.AddressesPerAccount(ctx)
+	allGateways := mngr.NetworkGatewaysPerAccount(ctx)
+	allCapacities := mngr.CapacitiesPerAccount(ctx)
+	allDBInstances := mngr.DBInstancesPerAccount(ctx)
+	allDBSnapshots := mngr.DBSnapshotsPerAccount(ctx)
+	referencedImages, referencedErr := findReferencedImages(ctx, mngr)
+	dependencyErr := findSnapshotDependencies(ctx, mngr)
+	planned := []*PlannedResource{}
+	for _, owner := range cloud.Accounts(allResources) {
+		resources := allResources[owner]
+		log.Println("Planning cleanup in", cloud.AccountName(owner))
+		resources.Images = withoutReferencedImages(owner, resources.Images, referencedImages, referencedErr)
+		resources.Snapshots = withoutUnsafeSnapshots(owner, resources.Snapshots, dependencyErr)
+		lifetimeFilter, expiryFilter, deleteAtFilter := cleanupFilters()
+
+		instancesToCleanup := filter.Instances(resources.Instances, lifetimeFilter, expiryFilter, deleteAtFilter)
+		imageFilters := append([]*filter.ResourceFilter{lifetimeFilter, expiryFilter, deleteAtFilter}, ReleaseImages.deregisterFilters()...)
+		toCleanup := &cloud.AllResourceCollection{
+			Instances:       instancesToCleanup,
+			Images:          filter.Images(resources.Images, imageFilters...),
+			Volumes:         filter.Volumes(resources.Volumes, lifetimeFilter, expiryFilter, deleteAtFilter),
+			Snapshots:       filter.Snapshots(resources.Snapshots, lifetimeFilter, expiryFilter, deleteAtFilter),
+			Buckets:         filter.Buckets(allBuckets[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+			Tables:          filter.Tables(allTables[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+			CacheClusters:   filter.CacheClusters(allCacheClusters[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+			Addresses:       filter.Addresses(allAddresses[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+			NetworkGateways: filter.NetworkGateways(allGateways[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+			Capacities:      filter.Capacities(allCapacities[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+			DBInstances:     filter.DBInstances(allDBInstances[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+			DBSnapshots:     filter.DBSnapshots(allDBSnapshots[owner], lifetimeFilter, expiryFilter, deleteAtFilter),
+		}
+		for _, res := range sortedResources(toCleanup) {
+			planned = append(planned, &PlannedResource{
+				Owner:    owner,
+				Resource: res,
+				Action:   ActionDelete,
+				Reason:   cleanupReason(res),
+			})
+		}
+
+		// Same as stopMarkedInstances, instances that are already
+		// stopped only get their stop tag removed
+		cleaned := map[string]bool{}
+		for _, inst := range instancesToCleanup {
+			cleaned[inst.ID()] = true
+		}
+		stopAtFilter := filter.New()
+		stopAtFilter.AddGeneralRule(filter.StopAtPassed())
+		stopAtFilter.AddInstanceRule(filter.IsRunning())
+		for _, inst := range filter.Instances(resources.Instances, stopAtFilter) {
+			if !cleaned[inst.ID()] {
+				planned = append(planned, &PlannedResource{
+					Owner:    owner,
+					Resource: inst,
+					Action:   ActionStop,
+					Reason:   "stop-at passed",
+				})
+			}
+		}
+
+		for _, image := range releaseImagesToMakePrivate(resources.Images, toCleanup.Images) {
+			planned = append(planned, &PlannedResource{
+				Owner:    owner,
+				Resource: image,
+				Action:   ActionMakePrivate,
+				Reason:   "release image aged",
+			})
+		}
+	}
+	return planned
+}
+
+// cleanupReason returns which of the cleanup filters matched a resource
+func cleanupReason(res cloud.Resource) string {
+	switch {
+	case filter.LifetimeExceeded()(res):
+		return "lifetime exceeded"
+	case filter.ExpiryDatePassed()(res):
+		return "expiry date passed"
+	case releaseImageExpired(res):
+		return "release image expired"
+	default:
+		return "delete-at passed"
+	}
+}
+
+// sortedResources returns the resources of a collection sorted by ID
+func sortedResources(collection *cloud.AllResourceCollection) []cloud.Resource {
+	result := []cloud.Resource{}
+	for _, res := range collectionResources(collection) {
+		result = append(result, res)
+	}
+	sortByID(result)
+	return result
+}
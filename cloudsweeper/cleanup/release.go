@@ -0,0 +1,95 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"log"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// ReleaseImageLifecycle is how long release images, which are tagged with
+// ReleaseTagKey and usually shared publicly, are kept around. Release
+// images are never marked for cleanup. Instead they are made private once
+// they are older than MakePrivateDays, and cleaned up once they have been
+// private for another DeregisterDays. A step with 0 days is skipped.
+type ReleaseImageLifecycle struct {
+	MakePrivateDays int
+	DeregisterDays  int
+}
+
+// ReleaseImages is the lifecycle of release images applied by
+// PerformCleanup. Release images are left alone if it's nil.
+var ReleaseImages *ReleaseImageLifecycle
+
+// releaseImageFilter returns a filter matching release images older than
+// the specified amount of days, that are not under retention
+func releaseImageFilter(days int) *filter.ResourceFilter {
+	fil := filter.New()
+	fil.AddGeneralRule(filter.HasTag(ReleaseTagKey))
+	fil.AddGeneralRule(filter.OlderThanXDays(days))
+	fil.AddGeneralRule(filter.Negate(filter.UnderRetention()))
+	return fil
+}
+
+// makePrivateFilters returns the filters matching public release images
+// that should be made private
+func (l *ReleaseImageLifecycle) makePrivateFilters() []*filter.ResourceFilter {
+	if l == nil || l.MakePrivateDays <= 0 {
+		return nil
+	}
+	fil := releaseImageFilter(l.MakePrivateDays)
+	fil.AddGeneralRule(filter.IsPublic())
+	return []*filter.ResourceFilter{fil}
+}
+
+// deregisterFilters returns the filters matching release images that
+// should be cleaned up
+func (l *ReleaseImageLifecycle) deregisterFilters() []*filter.ResourceFilter {
+	if l == nil || l.DeregisterDays <= 0 {
+		return nil
+	}
+	days := l.DeregisterDays
+	if l.MakePrivateDays > 0 {
+		days += l.MakePrivateDays
+	}
+	return []*filter.ResourceFilter{releaseImageFilter(days)}
+}
+
+// releaseImageExpired checks if a resource is a release image past its
+// lifecycle
+func releaseImageExpired(res cloud.Resource) bool {
+	image, ok := res.(cloud.Image)
+	if !ok {
+		return false
+	}
+	return len(filter.Images([]cloud.Image{image}, ReleaseImages.deregisterFilters()...)) > 0
+}
+
+// releaseImagesToMakePrivate returns the release images that should be
+// made private, leaving out those that are cleaned up
+func releaseImagesToMakePrivate(images, cleanedUp []cloud.Image) []cloud.Image {
+	cleaned := map[string]bool{}
+	for _, image := range cleanedUp {
+		cleaned[image.ID()] = true
+	}
+	result := []cloud.Image{}
+	for _, image := range filter.Images(images, ReleaseImages.makePrivateFilters()...) {
+		if !cleaned[image.ID()] {
+			result = append(result, image)
+		}
+	}
+	return result
+}
+
+// makeReleaseImagesPrivate makes public release images private once they
+// are older than the lifecycle allows, unless they were cleaned up
+func makeReleaseImagesPrivate(owner string, images, cleanedUp []cloud.Image) {
+	for _, image := range releaseImagesToMakePrivate(images, cleanedUp) {
+		if err := image.MakePrivate(); err != nil {
+			log.Printf("%s: Could not make release image %s private: %s\n", cloud.AccountName(owner), image.ID(), err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// SnoozeResource tags the resource with the specified ID so that it's
+// excluded from reviews, warnings, marking and cleanup for the specified
+// number of days. Any delete-at and stop-at tags are removed, so that the
+// resource goes through marking and warnings again once the snooze ends,
+// instead of being cleaned up right away.
+func SnoozeResource(ctx context.Context, mngr cloud.ResourceManager, id string, days int) error {
+	if days <= 0 {
+		return fmt.Errorf("Must snooze for at least one day")
+	}
+	res, err := findResource(ctx, mngr, id)
+	if err != nil {
+		return err
+	}
+	until := clock.Now().AddDate(0, 0, days).Format(filter.ExpiryTagValueFormat)
+	log.Printf("Snoozing %s in %s until %s", res.ID(), cloud.AccountName(res.Owner()), until)
+	if err := setTag(res, filter.SnoozeTagKey, until, true, "snoozed"); err != nil {
+		return fmt.Errorf("Could not snooze %s: %s", res.ID(), err)
+	}
+	for _, key := range []string{filter.DeleteTagKey, filter.StopTagKey} {
+		if _, exist := res.Tags()[key]; exist {
+			if err := removeTag(res, key, "snoozed"); err != nil {
+				return fmt.Errorf("Could not remove %s tag from %s: %s", key, res.ID(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// findResource looks for a resource of any type with the specified ID
+// in all accounts of the manager
+func findResource(ctx context.Context, mngr cloud.ResourceManager, id string) (cloud.Resource, error) {
+	collections := accountCollections(ctx, mngr)
+	for _, owner := range cloud.AllAccounts(collections) {
+		if res, ok := collectionResources(collections[owner])[id]; ok {
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("Resource %s not found in any account", id)
+}
+
+// accountCollections returns the resources of all types in each account
+// of the manager
+func accountCollections(ctx context.Context, mngr cloud.ResourceManager) map[string]*cloud.AllResourceCollection {
+	allResources := mngr.AllResourcesPerAccount(ctx)
+	allBuckets := mngr.BucketsPerAccount(ctx)
+	allTables := mngr.TablesPerAccount(ctx)
+	allCacheClusters := mngr.CacheClustersPerAccount(ctx)
+	allAddresses := mngr.AddressesPerAccount(ctx)
+	allGateways := mngr.NetworkGatewaysPerAccount(ctx)
+	allCapacities := mngr.CapacitiesPerAccount(ctx)
+	allDBInstances := mngr.DBInstancesPerAccount(ctx)
+	allDBSnapshots := mngr.DBSnapshotsPerAccount(ctx)
+	collections := make(map[string]*cloud.AllResourceCollection)
+	for _, owner := range cloud.Accounts(allResources) {
+		resources := allResources[owner]
+		collections[owner] = &cloud.AllResourceCollection{
+			Owner:           owner,
+			Instances:       resources.Instances,
+			Images:          resources.Images,
+			Volumes:         resources.Volumes,
+			Snapshots:       resources.Snapshots,
+			Buckets:         allBuckets[owner],
+			Tables:          allTables[owner],
+			CacheClusters:   allCacheClusters[owner],
+			Addresses:       allAddresses[owner],
+			NetworkGateways: allGateways[owner],
+			Capacities:      allCapacities[owner],
+			DBInstances:     allDBInstances[owner],
+			DBSnapshots:     allDBSnapshots[owner],
+		}
+	}
+	return collections
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// stackOf returns the ID of the stack managing a resource, see
+// filter.ManagedByTagKey, or an empty string if it isn't managed by one
+func stackOf(res cloud.Resource) string {
+	return strings.TrimSpace(res.Tags()[filter.ManagedByTagKey])
+}
+
+// withoutStackResources splits a list of resources into those that can be
+// marked one by one, and those that are managed by a stack
+func withoutStackResources(owner string, resources []cloud.Resource) (individual, managed []cloud.Resource) {
+	individual = []cloud.Resource{}
+	managed = []cloud.Resource{}
+	for _, res := range resources {
+		if stack := stackOf(res); stack != "" {
+			log.Printf("%s: Not marking %s since it's managed by the stack %s\n", cloud.AccountName(owner), res.ID(), stack)
+			managed = append(managed, res)
+			continue
+		}
+		individual = append(individual, res)
+	}
+	return individual, managed
+}
+
+// PlanStacks returns the resources that MarkForCleanup would have marked
+// with the specified thresholds, if they weren't managed by a stack, by
+// the ID of their stack. The reasons they matched are returned by resource
+// ID. Accounts that could not be fully scanned are left out.
+func PlanStacks(ctx context.Context, mngr cloud.ResourceManager, thresholds map[string]int) (stacks map[string][]cloud.Resource, reasons map[string]string) {
+	stacks = make(map[string][]cloud.Resource)
+	reasons = make(map[string]string)
+	results, _ := markForCleanup(ctx, mngr, thresholds, true)
+	for _, result := range results {
+		if result.partial {
+			continue
+		}
+		for _, res := range result.stackResources {
+			stacks[stackOf(res)] = append(stacks[stackOf(res)], res)
+			reasons[res.ID()] = result.reasons[res.ID()]
+		}
+	}
+	for _, resources := range stacks {
+		sortByID(resources)
+	}
+	return stacks, reasons
+}
+
+// MarkStack marks every resource of a stack, in all accounts of the
+// manager, for deletion at the same time, so that the stack is cleaned up
+// as a whole. Nothing is marked if any resource of the stack is whitelisted
+// or must be retained, since the stack couldn't be cleaned up consistently.
+// The resources of the stack are returned, with the number that could not
+// be marked. Nothing is tagged if dryRun is set.
+func MarkStack(ctx context.Context, mngr cloud.ResourceManager, stack string, dryRun bool) ([]cloud.Resource, int, error) {
+	collections := accountCollections(ctx, mngr)
+	resources := []cloud.Resource{}
+	blocked := []string{}
+	underRetention := filter.UnderRetention()
+	for _, owner := range cloud.AllAccounts(collections) {
+		for _, res := range sortedResources(collections[owner]) {
+			if stackOf(res) != stack {
+				continue
+			}
+			resources = append(resources, res)
+			if filter.IsWhitelisted(res) || underRetention(res) {
+				blocked = append(blocked, res.ID())
+			}
+		}
+	}
+	if len(resources) == 0 {
+		return resources, 0, fmt.Errorf("no resources are managed by the stack %s", stack)
+	}
+	if len(blocked) > 0 {
+		return resources, 0, fmt.Errorf("not marking the stack %s, since %s are whitelisted or must be retained", stack, strings.Join(blocked, ", "))
+	}
+	if dryRun {
+		for _, res := range resources {
+			log.Printf("%s: Would mark %s for deletion\n", cloud.AccountName(res.Owner()), res.ID())
+		}
+		return resources, 0, nil
+	}
+
+	timeToDelete := clock.Now().AddDate(0, 0, markedCleanupDays)
+	reason := fmt.Sprintf("stack %s marked", stack)
+	failed := 0
+	for _, res := range resources {
+		if err := setTag(res, filter.DeleteTagKey, timeToDelete.Format(time.RFC3339), true, reason); err != nil {
+			log.Printf("%s: Failed to tag %s for deletion: %s\n", cloud.AccountName(res.Owner()), res.ID(), err)
+			failed++
+		} else {
+			log.Printf("%s: Marked %s for deletion at %s\n", cloud.AccountName(res.Owner()), res.ID(), timeToDelete)
+		}
+	}
+	return resources, failed, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+const tombstoneNamespace = "tombstone"
+
+var (
+	// Tombstones, if set, keeps a tombstone of every resource cleaned up,
+	// so that owners can find out what happened to their resources
+	Tombstones cloud.StateStore
+	// RunID identifies the run of Cloudsweeper in tombstones
+	RunID string
+)
+
+// Tombstone is what is known about a resource that was cleaned up
+type Tombstone struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Account   string    `json:"account"`
+	DeletedAt time.Time `json:"deleted_at"`
+	// Policy is the rule that matched the resource, e.g. "delete-at passed"
+	Policy string `json:"policy"`
+	RunID  string `json:"run_id"`
+}
+
+// recordTombstones records a tombstone of every cleaned up resource,
+// except those that still failed after being retried
+func recordTombstones(cleanedUp, stillFailing []cloud.Resource) {
+	if Tombstones == nil {
+		return
+	}
+	failed := map[string]bool{}
+	for _, res := range stillFailing {
+		failed[res.ID()] = true
+	}
+	now := clock.Now()
+	for _, res := range cleanedUp {
+		if !failed[res.ID()] {
+			recordTombstone(res, cleanupReason(res), now)
+		}
+	}
+}
+
+// recordTombstone records a tombstone of a resource that was cleaned up
+// at the specified time because of policy
+func recordTombstone(res cloud.Resource, policy string, deletedAt time.Time) {
+	if Tombstones == nil {
+		return
+	}
+	tombstone := &Tombstone{
+		ID:        res.ID(),
+		Kind:      ResourceKind(res),
+		Account:   res.Owner(),
+		DeletedAt: deletedAt,
+		Policy:    policy,
+		RunID:     RunID,
+	}
+	if err := Tombstones.Put(tombstoneNamespace, res.ID(), tombstone); err != nil {
+		log.Printf("%s: Could not record tombstone of %s: %s\n", cloud.AccountName(res.Owner()), res.ID(), err)
+	}
+}
+
+// LookupTombstone returns the tombstone of a resource that was cleaned
+// up, and whether there is one
+func LookupTombstone(id string) (*Tombstone, bool, error) {
+	if Tombstones == nil {
+		return nil, false, errors.New("Tombstones are only kept when there is a state file")
+	}
+	tombstone := &Tombstone{}
+	found, err := Tombstones.Get(tombstoneNamespace, id, tombstone)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return tombstone, true, nil
+}
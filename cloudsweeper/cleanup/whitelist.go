@@ -0,0 +1,174 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// whitelistTagValue is the value of the whitelist tag set by
+// ApplyWhitelist, if an entry has no value
+const whitelistTagValue = "true"
+
+// WhitelistEntry is a whitelisted resource in a whitelist file, so that
+// whitelisting can be reviewed like code instead of only living as tags
+type WhitelistEntry struct {
+	Account string `yaml:"account"`
+	Kind    string `yaml:"kind"`
+	ID      string `yaml:"id"`
+	// Owner is the employee owning the account
+	Owner string `yaml:"owner,omitempty"`
+	// Value is the value of the whitelist tag
+	Value string `yaml:"value,omitempty"`
+	// Approver is the username of the approver of the whitelisting, see
+	// filter.WhitelistApproverTagKey
+	Approver string `yaml:"approver,omitempty"`
+	// Note is why the resource is whitelisted, see filter.NoteTagKey
+	Note string `yaml:"note,omitempty"`
+	// Renew whitelists an already whitelisted resource again, so that
+	// its maximum lifetime starts over, see filter.MaxLifetimeDays
+	Renew bool `yaml:"renew,omitempty"`
+	// AgeDays is only informative, it's not used when applying the file
+	AgeDays int `yaml:"age_days,omitempty"`
+}
+
+// ExportWhitelist returns all whitelisted resources, by account and ID,
+// with the employee owning their account in accountToUser
+func ExportWhitelist(ctx context.Context, mngr cloud.ResourceManager, accountToUser map[string]string) []*WhitelistEntry {
+	collections := accountCollections(ctx, mngr)
+	entries := []*WhitelistEntry{}
+	for _, owner := range cloud.AllAccounts(collections) {
+		for _, res := range sortedResources(collections[owner]) {
+			if !filter.IsWhitelisted(res) && !filter.WhitelistPendingApproval(res) {
+				continue
+			}
+			entries = append(entries, &WhitelistEntry{
+				Account:  owner,
+				Kind:     ResourceKind(res),
+				ID:       res.ID(),
+				Owner:    accountToUser[owner],
+				Value:    whitelistValue(res),
+				Approver: filter.WhitelistApprover(res),
+				Note:     res.Tags()[filter.NoteTagKey],
+				AgeDays:  int(clock.Now().Sub(res.CreationTime()).Hours() / 24.0),
+			})
+		}
+	}
+	return entries
+}
+
+// whitelistValue returns the value of the whitelist tag of a resource,
+// whose key may not be canonical, such as Cloudsweeper_Whitelisted
+func whitelistValue(res cloud.Resource) string {
+	for key, val := range res.Tags() {
+		if strings.Replace(strings.ToLower(key), "_", "-", -1) == filter.WhitelistTagKey {
+			return val
+		}
+	}
+	return ""
+}
+
+// WriteWhitelist writes whitelist entries to a YAML file
+func WriteWhitelist(fileName string, entries []*WhitelistEntry) error {
+	raw, err := yaml.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, raw, 0644)
+}
+
+// ReadWhitelist reads whitelist entries from a YAML file
+func ReadWhitelist(fileName string) ([]*WhitelistEntry, error) {
+	raw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*WhitelistEntry{}
+	if err := yaml.UnmarshalStrict(raw, &entries); err != nil {
+		return nil, fmt.Errorf("Could not parse whitelist file '%s': %s", fileName, err)
+	}
+	for i, entry := range entries {
+		if entry.Account == "" || entry.ID == "" {
+			return nil, fmt.Errorf("Entry %d of whitelist file '%s' must have an account and an id", i+1, fileName)
+		}
+	}
+	return entries, nil
+}
+
+// ApplyWhitelist whitelists the resources in the entries, and sets their
+// approvers and notes. Resources that weren't whitelisted yet, and entries to renew, are
+// tagged with the date they were whitelisted, see
+// filter.WhitelistedAtTagKey. Like snoozing, any delete-at and stop-at
+// tags are removed, since whitelisting takes precedence over them.
+// Resources that are whitelisted but missing from the entries are left as
+// they are. It returns the number of entries that failed.
+func ApplyWhitelist(ctx context.Context, mngr cloud.ResourceManager, entries []*WhitelistEntry) int {
+	collections := accountCollections(ctx, mngr)
+	failed := 0
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Not whitelisting the remaining %d resources: %s\n", len(entries)-i, err)
+			failed += len(entries) - i
+			break
+		}
+		res, exist := collectionResources(collections[entry.Account])[entry.ID]
+		if !exist {
+			log.Printf("%s: Could not whitelist %s, it was not found\n", cloud.AccountName(entry.Account), entry.ID)
+			failed++
+			continue
+		}
+		if err := applyWhitelistEntry(res, entry); err != nil {
+			log.Printf("%s: Could not whitelist %s: %s\n", cloud.AccountName(entry.Account), entry.ID, err)
+			failed++
+			continue
+		}
+		log.Printf("%s: Whitelisted %s\n", cloud.AccountName(entry.Account), entry.ID)
+	}
+	return failed
+}
+
+func applyWhitelistEntry(res cloud.Resource, entry *WhitelistEntry) error {
+	value := entry.Value
+	if value == "" {
+		value = whitelistTagValue
+	}
+	// Applying a whitelist file again must not renew every resource in it,
+	// only those whose whitelisting has expired
+	renew := entry.Renew || whitelistValue(res) == "" || filter.WhitelistExpired(res)
+	if err := setTag(res, filter.WhitelistTagKey, value, true, "whitelisted"); err != nil {
+		return err
+	}
+	if renew {
+		if err := setTag(res, filter.WhitelistedAtTagKey, clock.Now().Format(filter.ExpiryTagValueFormat), true, "whitelisted"); err != nil {
+			return err
+		}
+	}
+	if entry.Approver != "" {
+		if err := setTag(res, filter.WhitelistApproverTagKey, entry.Approver, true, "whitelisted"); err != nil {
+			return err
+		}
+	}
+	if entry.Note != "" {
+		if err := setTag(res, filter.NoteTagKey, entry.Note, true, "whitelisted"); err != nil {
+			return err
+		}
+	}
+	for _, key := range []string{filter.DeleteTagKey, filter.StopTagKey} {
+		if _, exist := res.Tags()[key]; exist {
+			if err := removeTag(res, key, "whitelisted"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build noaws
+// +build noaws
+
+package dashboard
+
+import "errors"
+
+// Upload is not supported when Cloudsweeper is built without AWS support,
+// use WriteDir instead
+func Upload(pages []*Page, bucket, region string) error {
+	return errors.New("Cloudsweeper is built without support for AWS, can't upload dashboards to S3")
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"sort"
+)
+
+// chartColors are the colors of the slices of pie charts, in order
+var chartColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+const chartRadius = 80.0
+
+type slice struct {
+	Label string
+	Value float64
+}
+
+// sortedSlices returns the slices of a chart, the largest first
+func sortedSlices(values map[string]float64) []slice {
+	slices := []slice{}
+	for label, value := range values {
+		slices = append(slices, slice{Label: label, Value: value})
+	}
+	sort.Slice(slices, func(i, j int) bool {
+		if slices[i].Value != slices[j].Value {
+			return slices[i].Value > slices[j].Value
+		}
+		return slices[i].Label < slices[j].Label
+	})
+	return slices
+}
+
+// pieChart renders a pie chart as an inline SVG with a legend, where the
+// values in the legend are formatted with valueFormat
+func pieChart(title string, slices []slice, valueFormat string) template.HTML {
+	total := 0.0
+	for _, s := range slices {
+		total += s.Value
+	}
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "<div class=\"chart\"><h3>%s</h3>\n", html.EscapeString(title))
+	fmt.Fprintf(b, "<svg width=\"%.0f\" height=\"%.0f\" viewBox=\"%.0f %.0f %.0f %.0f\">\n", 2*chartRadius, 2*chartRadius, -chartRadius, -chartRadius, 2*chartRadius, 2*chartRadius)
+	if total <= 0 {
+		fmt.Fprintf(b, "<circle r=\"%.0f\" fill=\"#eeeeee\" />\n", chartRadius)
+	}
+	angle := 0.0
+	for i, s := range slices {
+		if s.Value <= 0 || total <= 0 {
+			continue
+		}
+		color := chartColors[i%len(chartColors)]
+		fraction := s.Value / total
+		if fraction >= 1 {
+			fmt.Fprintf(b, "<circle r=\"%.0f\" fill=\"%s\" />\n", chartRadius, color)
+			break
+		}
+		end := angle + fraction*2*math.Pi
+		largeArc := 0
+		if fraction > 0.5 {
+			largeArc = 1
+		}
+		fmt.Fprintf(b, "<path d=\"M 0 0 L %.2f %.2f A %.0f %.0f 0 %d 1 %.2f %.2f Z\" fill=\"%s\" />\n",
+			chartRadius*math.Sin(angle), -chartRadius*math.Cos(angle),
+			chartRadius, chartRadius, largeArc,
+			chartRadius*math.Sin(end), -chartRadius*math.Cos(end), color)
+		angle = end
+	}
+	b.WriteString("</svg>\n<ul class=\"legend\">\n")
+	for i, s := range slices {
+		value := fmt.Sprintf(valueFormat, s.Value)
+		fmt.Fprintf(b, "<li><span style=\"background-color: %s;\"></span>%s: %s</li>\n", chartColors[i%len(chartColors)], html.EscapeString(s.Label), value)
+	}
+	b.WriteString("</ul></div>\n")
+	return template.HTML(b.String())
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package dashboard renders static HTML dashboards of the resources in
+// the org, in each team and in each account. They give managers a view
+// of their resources that doesn't depend on email, and are linked from
+// the reviews.
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/cleanup"
+)
+
+// IndexPage is the name of the dashboard of the whole org
+const IndexPage = "index.html"
+
+// AccountPage returns the name of the dashboard of an account
+func AccountPage(account string) string {
+	return fmt.Sprintf("account-%s.html", account)
+}
+
+// TeamPage returns the name of the dashboard of a manager's team
+func TeamPage(manager string) string {
+	return fmt.Sprintf("team-%s.html", manager)
+}
+
+// Page is a rendered dashboard
+type Page struct {
+	Name    string
+	Content []byte
+}
+
+// ageBuckets are the upper limits, in days, of the age groups in the
+// resource age chart
+var ageBuckets = []struct {
+	label   string
+	maxDays int
+}{
+	{"< 1 week", 7},
+	{"1 week - 1 month", 30},
+	{"1 - 3 months", 90},
+	{"3 - 6 months", 182},
+	{"> 6 months", -1},
+}
+
+type link struct {
+	Name string
+	Page string
+}
+
+type row struct {
+	Account      string
+	Owner        string
+	Type         string
+	ID           string
+	Location     string
+	AgeDays      int
+	CostPerMonth float64
+	State        string
+	CleanupTime  string
+}
+
+type pageData struct {
+	Title     string
+	Generated time.Time
+	Teams     []link
+	Accounts  []link
+	Ages      template.HTML
+	Costs     template.HTML
+	States    template.HTML
+	Rows      []row
+	TotalCost float64
+}
+
+// Generate renders the dashboards of the org, of every manager's team and
+// of every account, from the resources in the manager
+func Generate(ctx context.Context, mngr cloud.ResourceManager, org *cs.Organization, csp cloud.CSP) ([]*Page, error) {
+	accountUsers := org.AccountToUserMapping(csp)
+	inventory := collectInventory(ctx, mngr, accountUsers)
+	accounts := []string{}
+	for account := range inventory {
+		accounts = append(accounts, account)
+	}
+	cloud.SortIDs(accounts)
+
+	pages := []*Page{}
+	all := []row{}
+	accountLinks := []link{}
+	for _, account := range accounts {
+		rows := inventory[account]
+		all = append(all, rows...)
+		title := fmt.Sprintf("Account %s", cloud.AccountName(account))
+		if owner := accountUsers[account]; owner != "" {
+			title = fmt.Sprintf("Account %s, owned by %s", cloud.AccountName(account), owner)
+		}
+		page, err := render(AccountPage(account), &pageData{Title: title}, rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+		accountLinks = append(accountLinks, link{Name: title, Page: AccountPage(account)})
+	}
+
+	teamLinks := []link{}
+	for _, manager := range org.Managers {
+		employees, err := org.EmployeesForManager(manager)
+		if err != nil {
+			return nil, err
+		}
+		rows := []row{}
+		for _, employee := range employees {
+			for _, account := range employee.Accounts(csp) {
+				rows = append(rows, inventory[account]...)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		title := fmt.Sprintf("Team of %s", manager.Username)
+		page, err := render(TeamPage(manager.Username), &pageData{Title: title}, rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+		teamLinks = append(teamLinks, link{Name: title, Page: TeamPage(manager.Username)})
+	}
+
+	index, err := render(IndexPage, &pageData{Title: "All accounts", Teams: teamLinks, Accounts: accountLinks}, all)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Generated dashboards of %d accounts and %d teams\n", len(accountLinks), len(teamLinks))
+	return append(pages, index), nil
+}
+
+// collectInventory returns a row of every resource, by account
+func collectInventory(ctx context.Context, mngr cloud.ResourceManager, accountUsers map[string]string) map[string][]row {
+	allCompute := mngr.AllResourcesPerAccount(ctx)
+	billing.PrefetchCollectionPrices(allCompute)
+	inventory := make(map[string][]row)
+	add := func(account string, res cloud.Resource) {
+		inventory[account] = append(inventory[account], toRow(account, accountUsers[account], res))
+	}
+	for account, resources := range allCompute {
+		for _, res := range resources.Instances {
+			add(account, res)
+		}
+		for _, res := range resources.Images {
+			add(account, res)
+		}
+		for _, res := range resources.Volumes {
+			add(account, res)
+		}
+		for _, res := range resources.Snapshots {
+			add(account, res)
+		}
+	}
+	for account, buckets := range mngr.BucketsPerAccount(ctx) {
+		for _, res := range buckets {
+			add(account, res)
+		}
+	}
+	for account, tables := range mngr.TablesPerAccount(ctx) {
+		for _, res := range tables {
+			add(account, res)
+		}
+	}
+	for account, clusters := range mngr.CacheClustersPerAccount(ctx) {
+		for _, res := range clusters {
+			add(account, res)
+		}
+	}
+	for account, addresses := range mngr.AddressesPerAccount(ctx) {
+		for _, res := range addresses {
+			add(account, res)
+		}
+	}
+	for account, gateways := range mngr.NetworkGatewaysPerAccount(ctx) {
+		for _, res := range gateways {
+			add(account, res)
+		}
+	}
+	for account, capacities := range mngr.CapacitiesPerAccount(ctx) {
+		for _, res := range capacities {
+			add(account, res)
+		}
+	}
+	for account, instances := range mngr.DBInstancesPerAccount(ctx) {
+		for _, res := range instances {
+			add(account, res)
+		}
+	}
+	for account, snapshots := range mngr.DBSnapshotsPerAccount(ctx) {
+		for _, res := range snapshots {
+			add(account, res)
+		}
+	}
+	return inventory
+}
+
+func toRow(account, owner string, res cloud.Resource) row {
+	r := row{
+		Account:  cloud.AccountName(account),
+		Owner:    owner,
+		Type:     cleanup.ResourceKind(res),
+		ID:       res.ID(),
+		Location: res.Location(),
+		AgeDays:  int(clock.Now().Sub(res.CreationTime()).Hours() / 24.0),
+	}
+	if bucket, ok := res.(cloud.Bucket); ok {
+		r.CostPerMonth = billing.BucketPricePerMonth(bucket)
+	} else {
+		r.CostPerMonth = billing.ResourceCostPerDay(res) * 30.0
+	}
+	switch {
+	case filter.IsWhitelisted(res):
+		r.State = "whitelisted"
+	case filter.IsSnoozed(res):
+		r.State = "snoozed"
+	case filter.TaggedForCleanup()(res):
+		r.State = "marked"
+		r.CleanupTime = res.Tags()[filter.DeleteTagKey]
+	case filter.TaggedForStop()(res):
+		r.State = "marked"
+		r.CleanupTime = res.Tags()[filter.StopTagKey]
+	case filter.WhitelistPendingApproval(res):
+		r.State = "whitelist pending approval"
+	}
+	return r
+}
+
+// render fills in the charts and table of a dashboard from its rows
+func render(name string, data *pageData, rows []row) (*Page, error) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].CostPerMonth > rows[j].CostPerMonth
+	})
+	data.Generated = clock.Now()
+	data.Rows = rows
+
+	ages := make([]float64, len(ageBuckets))
+	costs := make(map[string]float64)
+	states := make(map[string]float64)
+	for _, r := range rows {
+		for i, bucket := range ageBuckets {
+			if bucket.maxDays < 0 || r.AgeDays < bucket.maxDays {
+				ages[i]++
+				break
+			}
+		}
+		costs[r.Type] += r.CostPerMonth
+		data.TotalCost += r.CostPerMonth
+		state := r.State
+		if state == "" {
+			state = "other"
+		}
+		states[state]++
+	}
+	ageSlices := []slice{}
+	for i, bucket := range ageBuckets {
+		ageSlices = append(ageSlices, slice{Label: bucket.label, Value: ages[i]})
+	}
+	data.Ages = pieChart("Resource age", ageSlices, "%.0f")
+	data.Costs = pieChart("Monthly cost per type", sortedSlices(costs), "$%.2f")
+	data.States = pieChart("Marked vs. whitelisted", sortedSlices(states), "%.0f")
+
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"fdate": func(t time.Time, format string) string { return t.Format(format) },
+	}).Parse(dashboardTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("Could not render dashboard %s: %s", name, err)
+	}
+	return &Page{Name: name, Content: b.Bytes()}, nil
+}
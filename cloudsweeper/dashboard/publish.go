@@ -0,0 +1,26 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package dashboard
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// WriteDir writes the dashboards to files in the specified directory,
+// which is created if it doesn't exist
+func WriteDir(pages []*Page, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if err := ioutil.WriteFile(filepath.Join(dir, page.Name), page.Content, 0644); err != nil {
+			return err
+		}
+	}
+	log.Printf("Wrote %d dashboards to %s\n", len(pages), dir)
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package dashboard
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+// Upload uploads the dashboards to an S3 bucket in the specified region,
+// using the credentials Cloudsweeper runs with
+func Upload(pages []*Page, bucket, region string) error {
+	sess := cloud.NewAWSSession()
+	sess.Config.Region = aws.String(region)
+	uploader := s3manager.NewUploader(sess)
+	for _, page := range pages {
+		_, err := uploader.Upload(&s3manager.UploadInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(page.Name),
+			Body:        bytes.NewReader(page.Content),
+			ContentType: aws.String("text/html; charset=utf-8"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Uploaded %d dashboards to %s\n", len(pages), bucket)
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package dashboard
+
+const dashboardTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>Cloudsweeper: {{ .Title }}</title>
+<style>
+	body { font-family: sans-serif; margin: 2em; }
+	.charts { display: flex; flex-wrap: wrap; }
+	.chart { margin-right: 3em; }
+	.legend { list-style: none; padding: 0; }
+	.legend span { display: inline-block; width: 1em; height: 1em; margin-right: 0.5em; vertical-align: middle; }
+	table { width: 100%; border-collapse: collapse; }
+	th { text-align: left; cursor: pointer; }
+	tr:nth-child(even) { background-color: #f2f2f2; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>
+Generated by Cloudsweeper {{ fdate .Generated "2006-01-02 15:04 MST" }}.
+{{ len .Rows }} resources, with an estimated monthly cost of {{ printf "$%.2f" .TotalCost }}.
+</p>
+
+{{ if gt (len .Teams) 0 }}
+<h2>Teams</h2>
+<ul>
+{{ range .Teams }}	<li><a href="{{ .Page }}">{{ .Name }}</a></li>
+{{ end }}</ul>
+{{ end }}
+{{ if gt (len .Accounts) 0 }}
+<h2>Accounts</h2>
+<ul>
+{{ range .Accounts }}	<li><a href="{{ .Page }}">{{ .Name }}</a></li>
+{{ end }}</ul>
+{{ end }}
+
+<div class="charts">
+{{ .Ages }}
+{{ .Costs }}
+{{ .States }}
+</div>
+
+<h2>Resources</h2>
+<p><small>Click a column header to sort by it.</small></p>
+<table id="resources">
+	<thead>
+		<tr>
+			<th>Account</th>
+			<th>Owner</th>
+			<th>Type</th>
+			<th>ID</th>
+			<th>Location</th>
+			<th data-numeric>Age (days)</th>
+			<th data-numeric>Monthly cost</th>
+			<th>State</th>
+			<th>Cleaned up at</th>
+		</tr>
+	</thead>
+	<tbody>
+	{{ range .Rows }}
+		<tr>
+			<td>{{ .Account }}</td>
+			<td>{{ .Owner }}</td>
+			<td>{{ .Type }}</td>
+			<td>{{ .ID }}</td>
+			<td>{{ .Location }}</td>
+			<td>{{ .AgeDays }}</td>
+			<td>{{ printf "$%.2f" .CostPerMonth }}</td>
+			<td>{{ .State }}</td>
+			<td>{{ .CleanupTime }}</td>
+		</tr>
+	{{ end }}
+	</tbody>
+</table>
+
+<script>
+(function() {
+	var table = document.getElementById("resources");
+	var headers = table.tHead.rows[0].cells;
+	for (var i = 0; i < headers.length; i++) {
+		headers[i].addEventListener("click", sortBy(i, headers[i].hasAttribute("data-numeric")));
+	}
+	function value(row, column, numeric) {
+		var text = row.cells[column].textContent;
+		return numeric ? parseFloat(text.replace("$", "")) : text;
+	}
+	function sortBy(column, numeric) {
+		var ascending = false;
+		return function() {
+			ascending = !ascending;
+			var body = table.tBodies[0];
+			var rows = Array.prototype.slice.call(body.rows);
+			rows.sort(function(a, b) {
+				var x = value(a, column, numeric), y = value(b, column, numeric);
+				var order = x < y ? -1 : (x > y ? 1 : 0);
+				return ascending ? order : -order;
+			});
+			rows.forEach(function(row) { body.appendChild(row); });
+		};
+	}
+})();
+</script>
+</body>
+</html>
+`
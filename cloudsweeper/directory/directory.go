@@ -0,0 +1,91 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package directory is used to look up employees in a user directory,
+// such as an SSO provider exposing a SCIM API. This makes it possible
+// to send email to the verified primary address of an employee, and to
+// detect when the organization file has gone stale.
+package directory
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+)
+
+// User is an user as described by the directory
+type User struct {
+	Username        string
+	PrimaryEmail    string
+	ManagerUsername string
+	Active          bool
+}
+
+// Directory is used to look up users in a user directory
+type Directory interface {
+	// LookupUser returns the user with the specified username. If the
+	// user does not exist in the directory, nil is returned.
+	LookupUser(username string) (*User, error)
+}
+
+// Resolution is the result of resolving all the employees in an
+// organization using a Directory.
+type Resolution struct {
+	// Emails maps usernames to their verified primary email
+	Emails map[string]string
+	// Managers maps usernames to the username of their manager
+	// according to the directory
+	Managers map[string]string
+	// Mismatches describes every difference found between the
+	// organization and the directory
+	Mismatches []string
+}
+
+// Resolve will look up every employee in the organization in the
+// directory. Employees not found in the directory are reported as
+// mismatches, and keep using the addresses from the organization.
+func Resolve(org *cs.Organization, dir Directory) (*Resolution, error) {
+	res := &Resolution{
+		Emails:     make(map[string]string),
+		Managers:   make(map[string]string),
+		Mismatches: []string{},
+	}
+	for _, employee := range org.Employees {
+		user, err := dir.LookupUser(employee.Username)
+		if err != nil {
+			return nil, fmt.Errorf("Could not look up %s in directory: %s", employee.Username, err)
+		}
+		if user == nil {
+			res.Mismatches = append(res.Mismatches, fmt.Sprintf("%s does not exist in the directory", employee.Username))
+			continue
+		}
+		if user.PrimaryEmail != "" {
+			res.Emails[employee.Username] = user.PrimaryEmail
+		}
+		if user.ManagerUsername != "" {
+			res.Managers[employee.Username] = user.ManagerUsername
+		}
+		if !user.Active && !employee.Disabled {
+			res.Mismatches = append(res.Mismatches, fmt.Sprintf("%s is not active in the directory, but is enabled in the organization", employee.Username))
+		}
+		if user.ManagerUsername != "" && user.ManagerUsername != employee.ManagerID {
+			res.Mismatches = append(res.Mismatches, fmt.Sprintf("%s has manager %s in the directory, but %s in the organization", employee.Username, user.ManagerUsername, employee.ManagerID))
+		}
+	}
+	sort.Strings(res.Mismatches)
+	return res, nil
+}
+
+// LogMismatches will log all the mismatches found during resolution
+func (r *Resolution) LogMismatches() {
+	if len(r.Mismatches) == 0 {
+		log.Println("Organization matches the directory")
+		return
+	}
+	log.Printf("Found %d mismatches between the organization and the directory:\n", len(r.Mismatches))
+	for _, mismatch := range r.Mismatches {
+		log.Printf("\t%s\n", mismatch)
+	}
+}
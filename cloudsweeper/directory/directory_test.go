@@ -0,0 +1,81 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package directory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+)
+
+const resolveTestOrg = `{
+	"departments": [{"number": 1, "id": "dev", "name": "Developers"}],
+	"managers": [{"username": "mallory"}],
+	"employees": [
+		{"username": "mallory", "department": "dev", "aws_accounts": [], "gcp_projects": []},
+		{"username": "trent", "department": "dev", "aws_accounts": [], "gcp_projects": []},
+		{"username": "alice", "department": "dev", "manager": "mallory", "aws_accounts": [], "gcp_projects": []},
+		{"username": "bob", "department": "dev", "manager": "mallory", "aws_accounts": [], "gcp_projects": []},
+		{"username": "carol", "department": "dev", "disabled": true, "aws_accounts": [], "gcp_projects": []},
+		{"username": "dave", "department": "dev", "aws_accounts": [], "gcp_projects": []}
+	]
+}`
+
+type fakeDirectory map[string]*User
+
+func (d fakeDirectory) LookupUser(username string) (*User, error) {
+	if username == "broken" {
+		return nil, errors.New("directory is down")
+	}
+	return d[username], nil
+}
+
+func TestResolve(t *testing.T) {
+	org, err := cs.InitOrganization([]byte(resolveTestOrg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := fakeDirectory{
+		"mallory": {Username: "mallory", PrimaryEmail: "mallory@example.com", Active: true},
+		"trent":   {Username: "trent", PrimaryEmail: "trent@example.com", Active: true},
+		"alice":   {Username: "alice", PrimaryEmail: "alice.smith@example.com", ManagerUsername: "mallory", Active: true},
+		"bob":     {Username: "bob", PrimaryEmail: "bob@example.com", ManagerUsername: "trent", Active: false},
+		"carol":   {Username: "carol", Active: false},
+	}
+	res, err := Resolve(org, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedEmails := map[string]string{
+		"mallory": "mallory@example.com",
+		"trent":   "trent@example.com",
+		"alice":   "alice.smith@example.com",
+		"bob":     "bob@example.com",
+	}
+	if !reflect.DeepEqual(res.Emails, expectedEmails) {
+		t.Errorf("Resolved emails %v, expected %v", res.Emails, expectedEmails)
+	}
+	expectedManagers := map[string]string{
+		"alice": "mallory",
+		"bob":   "trent",
+	}
+	if !reflect.DeepEqual(res.Managers, expectedManagers) {
+		t.Errorf("Resolved managers %v, expected %v", res.Managers, expectedManagers)
+	}
+	expectedMismatches := []string{
+		"bob has manager trent in the directory, but mallory in the organization",
+		"bob is not active in the directory, but is enabled in the organization",
+		"dave does not exist in the directory",
+	}
+	if !reflect.DeepEqual(res.Mismatches, expectedMismatches) {
+		t.Errorf("Found mismatches %q, expected %q", res.Mismatches, expectedMismatches)
+	}
+
+	org.Employees = append(org.Employees, &cs.Employee{Username: "broken"})
+	if _, err := Resolve(org, dir); err == nil {
+		t.Error("Resolved the organization even though a lookup failed")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const scimRequestTimeout = 30 * time.Second
+
+type scimDirectory struct {
+	baseURL string
+	token   string
+	client  *http.Client
+
+	// Manager references are IDs, which are resolved to usernames
+	idMutex       sync.Mutex
+	idToUsernames map[string]string
+}
+
+// NewSCIM will create a Directory backed by a SCIM 2.0 API, such as the
+// ones exposed by most SSO providers. The baseURL should point to the
+// SCIM root (the URL which /Users is appended to), and the token is sent
+// as a bearer token.
+func NewSCIM(baseURL, token string) Directory {
+	return &scimDirectory{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		token:         token,
+		client:        &http.Client{Timeout: scimRequestTimeout},
+		idToUsernames: make(map[string]string),
+	}
+}
+
+type scimUser struct {
+	ID       string `json:"id"`
+	UserName string `json:"userName"`
+	Active   bool   `json:"active"`
+	Emails   []struct {
+		Value   string `json:"value"`
+		Primary bool   `json:"primary"`
+	} `json:"emails"`
+	Enterprise struct {
+		Manager struct {
+			Value string `json:"value"`
+		} `json:"manager"`
+	} `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"`
+}
+
+type scimListResponse struct {
+	TotalResults int        `json:"totalResults"`
+	Resources    []scimUser `json:"Resources"`
+}
+
+func (d *scimDirectory) LookupUser(username string) (*User, error) {
+	query := url.Values{}
+	query.Set("filter", fmt.Sprintf("userName eq \"%s\"", username))
+	list := new(scimListResponse)
+	if err := d.get("/Users?"+query.Encode(), list); err != nil {
+		return nil, err
+	}
+	if len(list.Resources) == 0 {
+		return nil, nil
+	}
+	raw := list.Resources[0]
+	user := &User{
+		Username: raw.UserName,
+		Active:   raw.Active,
+	}
+	for _, email := range raw.Emails {
+		if email.Primary || user.PrimaryEmail == "" {
+			user.PrimaryEmail = email.Value
+		}
+	}
+	if managerID := raw.Enterprise.Manager.Value; managerID != "" {
+		manager, err := d.usernameForID(managerID)
+		if err != nil {
+			return nil, err
+		}
+		user.ManagerUsername = manager
+	}
+	return user, nil
+}
+
+func (d *scimDirectory) usernameForID(id string) (string, error) {
+	d.idMutex.Lock()
+	username, exist := d.idToUsernames[id]
+	d.idMutex.Unlock()
+	if exist {
+		return username, nil
+	}
+	user := new(scimUser)
+	if err := d.get("/Users/"+url.PathEscape(id), user); err != nil {
+		return "", err
+	}
+	d.idMutex.Lock()
+	d.idToUsernames[id] = user.UserName
+	d.idMutex.Unlock()
+	return user.UserName, nil
+}
+
+func (d *scimDirectory) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, d.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/scim+json")
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SCIM request to %s failed with status %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package directory
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const scimTestToken = "s3cret"
+
+var scimTestUsers = map[string]string{
+	"alice": `{
+		"id": "id-alice",
+		"userName": "alice",
+		"active": true,
+		"emails": [
+			{"value": "alice@old.example.com", "primary": false},
+			{"value": "alice@example.com", "primary": true}
+		],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"manager": {"value": "id-mallory"}}
+	}`,
+	"mallory": `{
+		"id": "id-mallory",
+		"userName": "mallory",
+		"active": false,
+		"emails": [{"value": "mallory@example.com"}]
+	}`,
+}
+
+func newSCIMTestServer(t *testing.T) (*httptest.Server, map[string]int) {
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		if r.Header.Get("Authorization") != "Bearer "+scimTestToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/scim/v2/Users":
+			var username string
+			if _, err := fmt.Sscanf(r.URL.Query().Get("filter"), "userName eq %q", &username); err != nil {
+				t.Errorf("Unexpected filter %q", r.URL.Query().Get("filter"))
+			}
+			if username == "broken" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if user, exist := scimTestUsers[username]; exist {
+				fmt.Fprintf(w, `{"totalResults": 1, "Resources": [%s]}`, user)
+			} else {
+				fmt.Fprint(w, `{"totalResults": 0, "Resources": []}`)
+			}
+		case "/scim/v2/Users/id-mallory":
+			fmt.Fprint(w, scimTestUsers["mallory"])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, requests
+}
+
+func TestSCIMLookupUser(t *testing.T) {
+	server, requests := newSCIMTestServer(t)
+	defer server.Close()
+	dir := NewSCIM(server.URL+"/scim/v2/", scimTestToken)
+
+	tests := []struct {
+		username string
+		expected *User
+	}{
+		{"alice", &User{Username: "alice", PrimaryEmail: "alice@example.com", ManagerUsername: "mallory", Active: true}},
+		{"mallory", &User{Username: "mallory", PrimaryEmail: "mallory@example.com"}},
+		{"dave", nil},
+	}
+	for _, test := range tests {
+		user, err := dir.LookupUser(test.username)
+		if err != nil {
+			t.Errorf("Could not look up %s: %s", test.username, err)
+			continue
+		}
+		if !reflect.DeepEqual(user, test.expected) {
+			t.Errorf("Looked up %s as %+v, expected %+v", test.username, user, test.expected)
+		}
+	}
+
+	// Manager IDs are only resolved once
+	if _, err := dir.LookupUser("alice"); err != nil {
+		t.Error(err)
+	}
+	if requests["/scim/v2/Users/id-mallory"] != 1 {
+		t.Errorf("Resolved the manager ID %d times, expected once", requests["/scim/v2/Users/id-mallory"])
+	}
+
+	if _, err := dir.LookupUser("broken"); err == nil {
+		t.Error("Looked up a user even though the request failed")
+	}
+	if _, err := NewSCIM(server.URL+"/scim/v2", "wrong").LookupUser("alice"); err == nil {
+		t.Error("Looked up a user with the wrong token")
+	}
+}
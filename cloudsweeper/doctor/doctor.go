@@ -0,0 +1,93 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package doctor checks that Cloudsweeper is ready to run, by trying each
+// of the integrations it depends on end-to-end, such as assuming roles in
+// the accounts and logging in to the SMTP server.
+package doctor
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+// Check is a check of an integration. Run returns an error if the check
+// failed, or an error from Skip if it doesn't apply.
+type Check struct {
+	Name string
+	Run  func() error
+}
+
+type skipError string
+
+func (e skipError) Error() string {
+	return string(e)
+}
+
+// Skip returns an error telling that a check was skipped, and why
+func Skip(reason string) error {
+	return skipError(reason)
+}
+
+// Result is the outcome of a Check
+type Result struct {
+	Name string
+	// Err is nil if the check passed
+	Err error
+}
+
+// Skipped checks if the check was skipped
+func (r *Result) Skipped() bool {
+	_, skipped := r.Err.(skipError)
+	return skipped
+}
+
+// Failed checks if the check failed
+func (r *Result) Failed() bool {
+	return r.Err != nil && !r.Skipped()
+}
+
+// Run runs the checks one at a time, in order
+func Run(checks []Check) []*Result {
+	results := make([]*Result, 0, len(checks))
+	for _, check := range checks {
+		log.Printf("Checking %s\n", check.Name)
+		results = append(results, &Result{Name: check.Name, Err: check.Run()})
+	}
+	return results
+}
+
+// Failures returns the number of failed checks
+func Failures(results []*Result) int {
+	failures := 0
+	for _, result := range results {
+		if result.Failed() {
+			failures++
+		}
+	}
+	return failures
+}
+
+// FormatResults returns a table with the outcome of every check
+func FormatResults(results []*Result) string {
+	width := 0
+	for _, result := range results {
+		if len(result.Name) > width {
+			width = len(result.Name)
+		}
+	}
+	b := new(bytes.Buffer)
+	for _, result := range results {
+		switch {
+		case result.Failed():
+			fmt.Fprintf(b, "  FAIL  %-*s  %s\n", width, result.Name, result.Err)
+		case result.Skipped():
+			fmt.Fprintf(b, "  SKIP  %-*s  %s\n", width, result.Name, result.Err)
+		default:
+			fmt.Fprintf(b, "  PASS  %s\n", result.Name)
+		}
+	}
+	fmt.Fprintf(b, "\n%d of %d checks failed\n", Failures(results), len(results))
+	return b.String()
+}
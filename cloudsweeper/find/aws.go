@@ -4,6 +4,7 @@
 package find
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -31,20 +32,20 @@ func (c *awsClient) CSP() cloud.CSP {
 	return cloud.AWS
 }
 
-func (c *awsClient) FindResource(id string) error {
+func (c *awsClient) FindResource(ctx context.Context, id string) error {
 	resourceType, err := c.determineResourceType(id)
 	if err != nil {
 		return err
 	}
 
-	for account, resources := range c.cloudManager.AllResourcesPerAccount() {
-		log.Printf("Looking for %s in account %s\n", id, account)
+	for account, resources := range c.cloudManager.AllResourcesPerAccount(ctx) {
+		log.Printf("Looking for %s in account %s\n", id, cloud.AccountName(account))
 		switch resourceType {
 		case awsTypeInstance:
 			for _, inst := range resources.Instances {
 				if inst.ID() == id {
 					// Found instance
-					log.Printf("Found instance in account %s", account)
+					log.Printf("Found instance in account %s", cloud.AccountName(account))
 					employee, err := c.getEmployee(account)
 					if err != nil {
 						return err
@@ -6,11 +6,13 @@
 package find
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
 	"github.com/cloudtools/cloudsweeper/cloudsweeper"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/cleanup"
 )
 
 const foundBannerTemplate = `
@@ -23,7 +25,7 @@ const foundBannerTemplate = `
 
 // Client is a client for finding a resource in a specific cloud
 type Client interface {
-	FindResource(id string) error
+	FindResource(ctx context.Context, id string) error
 	CSP() cloud.CSP
 }
 
@@ -38,6 +40,26 @@ func Init(mngr cloud.ResourceManager, org *cloudsweeper.Organization, csp cloud.
 	return nil, fmt.Errorf("Unsupported CSP: %s", csp)
 }
 
+// FindTombstone prints the tombstone of a resource that was cleaned up,
+// for resources that can no longer be found
+func FindTombstone(id string) error {
+	tombstone, found, err := cleanup.LookupTombstone(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("No tombstone found for %s", id)
+	}
+	fmt.Printf(foundBannerTemplate, "Tombstone")
+	fmt.Printf("Account:       %s\n", tombstone.Account)
+	fmt.Printf("Resource ID:   %s\n", tombstone.ID)
+	fmt.Printf("Resource type: %s\n", tombstone.Kind)
+	fmt.Printf("Deleted at:    %s\n", tombstone.DeletedAt.Format(time.RFC3339))
+	fmt.Printf("Policy:        %s\n", tombstone.Policy)
+	fmt.Printf("Run ID:        %s\n", tombstone.RunID)
+	return nil
+}
+
 func foundInstance(inst cloud.Instance, account string, owner *cloudsweeper.Employee) {
 	fmt.Printf(foundBannerTemplate, "Instance")
 	foundResource(inst, account, owner)
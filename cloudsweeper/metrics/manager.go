@@ -0,0 +1,207 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+// instrumentedManager wraps another ResourceManager, and records how many
+// resources it lists in each account and how long listing them takes, in
+// the scan phase.
+// All other calls are passed on to the wrapped manager.
+type instrumentedManager struct {
+	cloud.ResourceManager
+}
+
+// NewInstrumentedManager returns a ResourceManager that records the
+// ResourcesScanned and ScanDuration of the specified manager
+func NewInstrumentedManager(mngr cloud.ResourceManager) cloud.ResourceManager {
+	return &instrumentedManager{ResourceManager: mngr}
+}
+
+// observeScan records a scan of a type of resources that started at start,
+// with the number of resources found in each account
+func observeScan(resourceType string, start time.Time, counts map[string]int) {
+	ScanDuration.Set(time.Since(start).Seconds(), resourceType)
+	for account, count := range counts {
+		ResourcesScanned.Set(float64(count), account, resourceType)
+	}
+}
+
+// ObserveScanStatus records the AccountErrors of the accounts of a
+// manager, from the regions that could not be scanned
+func ObserveScanStatus(mngr cloud.ResourceManager) {
+	status := mngr.ScanStatus()
+	for _, account := range mngr.Owners() {
+		AccountErrors.Set(float64(len(status.FailedRegions(account))), account)
+	}
+}
+
+func (m *instrumentedManager) BucketsPerAccount(ctx context.Context) map[string][]cloud.Bucket {
+	start := time.Now()
+	result := m.ResourceManager.BucketsPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("bucket", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) InstancesPerAccount(ctx context.Context) map[string][]cloud.Instance {
+	start := time.Now()
+	result := m.ResourceManager.InstancesPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("instance", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) ImagesPerAccount(ctx context.Context) map[string][]cloud.Image {
+	start := time.Now()
+	result := m.ResourceManager.ImagesPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("image", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) VolumesPerAccount(ctx context.Context) map[string][]cloud.Volume {
+	start := time.Now()
+	result := m.ResourceManager.VolumesPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("volume", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) SnapshotsPerAccount(ctx context.Context) map[string][]cloud.Snapshot {
+	start := time.Now()
+	result := m.ResourceManager.SnapshotsPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("snapshot", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) TablesPerAccount(ctx context.Context) map[string][]cloud.Table {
+	start := time.Now()
+	result := m.ResourceManager.TablesPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("table", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) CacheClustersPerAccount(ctx context.Context) map[string][]cloud.CacheCluster {
+	start := time.Now()
+	result := m.ResourceManager.CacheClustersPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("cache-cluster", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) AddressesPerAccount(ctx context.Context) map[string][]cloud.Address {
+	start := time.Now()
+	result := m.ResourceManager.AddressesPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("address", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) NetworkGatewaysPerAccount(ctx context.Context) map[string][]cloud.NetworkGateway {
+	start := time.Now()
+	result := m.ResourceManager.NetworkGatewaysPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("network-gateway", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) CapacitiesPerAccount(ctx context.Context) map[string][]cloud.Capacity {
+	start := time.Now()
+	result := m.ResourceManager.CapacitiesPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("capacity", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) DBInstancesPerAccount(ctx context.Context) map[string][]cloud.DBInstance {
+	start := time.Now()
+	result := m.ResourceManager.DBInstancesPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("db-instance", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+func (m *instrumentedManager) DBSnapshotsPerAccount(ctx context.Context) map[string][]cloud.DBSnapshot {
+	start := time.Now()
+	result := m.ResourceManager.DBSnapshotsPerAccount(ctx)
+	counts := make(map[string]int)
+	for account, resources := range result {
+		counts[account] = len(resources)
+	}
+	observeScan("db-snapshot", start, counts)
+	ObservePhase(PhaseScan, start)
+	return result
+}
+
+// AllResourcesPerAccount lists instances, images, volumes and snapshots
+// at the same time, so they are recorded with the same duration
+func (m *instrumentedManager) AllResourcesPerAccount(ctx context.Context) map[string]*cloud.ResourceCollection {
+	start := time.Now()
+	result := m.ResourceManager.AllResourcesPerAccount(ctx)
+	instances, images, volumes, snapshots := make(map[string]int), make(map[string]int), make(map[string]int), make(map[string]int)
+	for account, collection := range result {
+		instances[account] = len(collection.Instances)
+		images[account] = len(collection.Images)
+		volumes[account] = len(collection.Volumes)
+		snapshots[account] = len(collection.Snapshots)
+	}
+	observeScan("instance", start, instances)
+	observeScan("image", start, images)
+	observeScan("volume", start, volumes)
+	observeScan("snapshot", start, snapshots)
+	ObservePhase(PhaseScan, start)
+	return result
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package metrics exports counters and gauges of what Cloudsweeper does,
+// such as the resources it scanned, marked and deleted, in the Prometheus
+// text format. They are either served on /metrics by the serve command,
+// or pushed to a Prometheus Pushgateway when a command finishes.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	counterType = "counter"
+	gaugeType   = "gauge"
+)
+
+// The metrics of Cloudsweeper. Resources are labeled with their account
+// and type, such as "instance", see cleanup.ResourceKind.
+var (
+	ResourcesScanned = newMetric("cloudsweeper_resources_scanned", gaugeType, "Resources found in the last scan", "account", "type")
+	ScanDuration     = newMetric("cloudsweeper_scan_duration_seconds", gaugeType, "Time it took to list the resources in the last scan", "type")
+	ResourcesMarked  = newMetric("cloudsweeper_resources_marked_total", counterType, "Resources tagged to be deleted or stopped", "account", "type")
+	ResourcesDeleted = newMetric("cloudsweeper_resources_deleted_total", counterType, "Resources cleaned up", "account", "type")
+	CostReclaimed    = newMetric("cloudsweeper_cost_reclaimed_dollars_per_month_total", counterType, "Monthly cost of the resources cleaned up", "account")
+	AccountErrors    = newMetric("cloudsweeper_account_errors", gaugeType, "Regions of an account that could not be scanned in the last scan, including global for an account that could not be accessed", "account")
+	LastRun          = newMetric("cloudsweeper_last_run_timestamp_seconds", gaugeType, "When a command last finished", "command")
+	LastExitCode     = newMetric("cloudsweeper_last_run_exit_code", gaugeType, "Exit code of the command that last finished", "command")
+
+	PhaseDuration       = newMetric("cloudsweeper_phase_duration_seconds_total", counterType, "Wall-clock time spent in a phase of a command: scan, filter, tag, delete or notify", "phase")
+	APICalls            = newMetric("cloudsweeper_api_calls_total", counterType, "Requests made to a service of the cloud provider", "service")
+	APIRetries          = newMetric("cloudsweeper_api_retries_total", counterType, "Attempts made after the first one of requests to a service of the cloud provider", "service")
+	APIThrottled        = newMetric("cloudsweeper_api_throttled_total", counterType, "Attempts that were throttled by the cloud provider")
+	APIThrottleFailures = newMetric("cloudsweeper_api_throttle_failures_total", counterType, "Requests that were still throttled after all retries, and failed")
+)
+
+var (
+	registryMu sync.Mutex
+	registry   []*Metric
+)
+
+// Metric is a counter or gauge, with a value for every combination of
+// label values
+type Metric struct {
+	name   string
+	kind   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newMetric(name, kind, help string, labels ...string) *Metric {
+	m := &Metric{name: name, kind: kind, help: help, labels: labels, values: make(map[string]float64)}
+	registryMu.Lock()
+	registry = append(registry, m)
+	registryMu.Unlock()
+	return m
+}
+
+// Add adds to the value with the specified label values, which must be in
+// the order of the labels of the metric
+func (m *Metric) Add(value float64, labelValues ...string) {
+	key := m.key(labelValues)
+	m.mu.Lock()
+	m.values[key] += value
+	m.mu.Unlock()
+}
+
+// Set sets the value with the specified label values, which must be in
+// the order of the labels of the metric
+func (m *Metric) Set(value float64, labelValues ...string) {
+	key := m.key(labelValues)
+	m.mu.Lock()
+	m.values[key] = value
+	m.mu.Unlock()
+}
+
+// value returns the value with the specified label values, if it's set
+func (m *Metric) value(labelValues ...string) (float64, bool) {
+	key := m.key(labelValues)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, found := m.values[key]
+	return value, found
+}
+
+// labelEscaper escapes label values as the Prometheus text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// key formats the label values as they are written, e.g.
+// {account="123",type="instance"}
+func (m *Metric) key(labelValues []string) string {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("%s has %d labels, got %d values", m.name, len(m.labels), len(labelValues)))
+	}
+	if len(m.labels) == 0 {
+		return ""
+	}
+	pairs := []string{}
+	for i, label := range m.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(labelValues[i])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// write writes the metric in the Prometheus text format. Metrics without
+// any values are left out.
+func (m *Metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.values) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(m.values))
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %g\n", m.name, key, m.values[key])
+	}
+}
+
+// Write writes all metrics in the Prometheus text format
+func Write(w io.Writer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, m := range registry {
+		m.write(w)
+	}
+}
+
+// Handler serves all metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		ObserveAPICalls()
+		Write(w)
+	})
+}
+
+// pushTimeout is the maximum time spent pushing metrics
+const pushTimeout = 30 * time.Second
+
+// Push replaces the metrics of the job, grouped by the specified labels
+// and values, in the Prometheus Pushgateway at gatewayURL
+func Push(ctx context.Context, gatewayURL, job string, grouping map[string]string) error {
+	path := "/metrics/job/" + url.PathEscape(job)
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path += "/" + url.PathEscape(name) + "/" + url.PathEscape(grouping[name])
+	}
+	body := new(bytes.Buffer)
+	Write(body)
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(gatewayURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Pushgateway responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+// Phases of a command, whose duration is recorded with ObservePhase
+const (
+	// PhaseScan is spent listing resources
+	PhaseScan = "scan"
+	// PhaseFilter is spent matching resources to mark
+	PhaseFilter = "filter"
+	// PhaseTag is spent tagging the matched resources
+	PhaseTag = "tag"
+	// PhaseDelete is spent cleaning up resources
+	PhaseDelete = "delete"
+	// PhaseNotify is spent sending, holding or planning mails
+	PhaseNotify = "notify"
+)
+
+var phases = []string{PhaseScan, PhaseFilter, PhaseTag, PhaseDelete, PhaseNotify}
+
+// ObservePhase adds the time since start to the PhaseDuration of a phase
+func ObservePhase(phase string, start time.Time) {
+	PhaseDuration.Add(time.Since(start).Seconds(), phase)
+}
+
+// ObserveAPICalls records the APICalls, APIRetries, APIThrottled and
+// APIThrottleFailures of the run so far
+func ObserveAPICalls() {
+	for service, stats := range cloud.APICalls() {
+		APICalls.Set(float64(stats.Calls), service)
+		APIRetries.Set(float64(stats.Retries), service)
+	}
+	throttling := cloud.Throttling()
+	APIThrottled.Set(float64(throttling.Throttled))
+	APIThrottleFailures.Set(float64(throttling.Exhausted))
+}
+
+// RunSummary returns the time spent in each phase and the requests made
+// to the cloud provider so far, to be logged when a command finishes. It's
+// empty if the command didn't do any of that.
+func RunSummary() string {
+	b := new(bytes.Buffer)
+	for _, phase := range phases {
+		if seconds, found := PhaseDuration.value(phase); found {
+			fmt.Fprintf(b, "\t%-8s %s\n", phase, time.Duration(seconds*float64(time.Second)).Round(time.Millisecond))
+		}
+	}
+	calls := cloud.APICalls()
+	services := make([]string, 0, len(calls))
+	for service := range calls {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		fmt.Fprintf(b, "\t%-24s %d calls, %d retries\n", service, calls[service].Calls, calls[service].Retries)
+	}
+	if throttling := cloud.Throttling(); throttling.Throttled > 0 {
+		fmt.Fprintf(b, "\t%d requests were throttled, %d of them failed after retrying\n", throttling.Throttled, throttling.Exhausted)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "Run summary:\n" + b.String()
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+)
+
+type costAnomalyMailData struct {
+	Owner   string
+	CSP     cloud.CSP
+	Anomaly billing.CostAnomaly
+}
+
+// CostAnomalyAlert sends an email about every account/project whose daily
+// cost jumped to the owner of the account and the BillingReportAddressee,
+// right away rather than waiting for the month-to-date report.
+func (c *Client) CostAnomalyAlert(anomalies []billing.CostAnomaly, csp cloud.CSP, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	for _, anomaly := range anomalies {
+		username := accountUserMapping[anomaly.Owner]
+		if username == "" && c.config.BillingReportAddressee == "" {
+			log.Printf("Not alerting about the cost of %s, since it has no owner and there is no billing addressee\n", cloud.AccountName(anomaly.Owner))
+			continue
+		}
+		mailData := costAnomalyMailData{Owner: username, CSP: csp, Anomaly: anomaly}
+		if mailData.Owner == "" {
+			mailData.Owner = c.config.BillingReportAddressee
+		}
+		mailContent, err := generateMail(mailData, costAnomalyTemplate)
+		if err != nil {
+			log.Fatalln("Could not generate email:", err)
+		}
+		settings := c.mailSettings(mailData.Owner, anomaly.Owner)
+		recipients := []string{}
+		if username != "" {
+			recipients = append(recipients, convertEmailExceptions(c.emailForUser(username, settings)))
+		}
+		if c.config.BillingReportAddressee != "" {
+			recipients = append(recipients, convertEmailExceptions(fmt.Sprintf("%s@%s", c.config.BillingReportAddressee, settings.EmailDomain)))
+		}
+		title := c.subject(CostAnomalyMail, subjectData{Account: anomaly.Owner, Owner: mailData.Owner, CSP: csp})
+		record := OutputRecord{
+			Report:       CostAnomalyMail,
+			Recipient:    recipients[0],
+			Account:      anomaly.Owner,
+			AccountAlias: accountAlias(anomaly.Owner),
+			Type:         "account",
+			ID:           anomaly.Owner,
+			TotalCost:    anomaly.Cost,
+		}
+		if c.outputReport(mailContent, []OutputRecord{record}) {
+			continue
+		}
+		if c.isDuplicateMail(recipients[0], costAnomalyTemplate, title, mailContent) {
+			continue
+		}
+		log.Printf("Alerting %v about the cost of %s\n", recipients, cloud.AccountName(anomaly.Owner))
+		err = c.deliverMail(settings, title, mailContent, recipients...)
+		if err != nil {
+			log.Printf("Failed to email %v: %s\n", recipients, err)
+		} else {
+			c.recordMail(recipients[0], costAnomalyTemplate, mailContent)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+const (
+	resourceCreatorNamespace = "resource-creator"
+	// creatorLookupDelay is how old a resource must be before its
+	// creator is assumed to never show up in CloudTrail, since
+	// events are delivered with a delay
+	creatorLookupDelay = time.Hour
+	// minGuessedUsernameLength is the length of the shortest username
+	// guessed as owner, shorter ones match too many names by chance
+	minGuessedUsernameLength = 3
+)
+
+// resourceCreator returns the principal that created a resource, or an
+// empty string if it's unknown. Creators are cached in the state store,
+// if there is one, to avoid looking them up in every run.
+func (c *Client) resourceCreator(res cloud.Resource) string {
+	key := res.Owner() + "/" + res.ID()
+	if c.config.State != nil {
+		var creator string
+		found, err := c.config.State.Get(resourceCreatorNamespace, key, &creator)
+		if err != nil {
+			log.Printf("Could not read creator of %s: %s", res.ID(), err)
+		} else if found {
+			return creator
+		}
+	}
+	creator, err := cloud.LookupAWSCreator(res)
+	if err != nil {
+		log.Printf("Could not look up creator of %s: %s", res.ID(), err)
+		return ""
+	}
+	if c.config.State != nil && (creator != "" || clock.Now().After(res.CreationTime().Add(creatorLookupDelay))) {
+		if err := c.config.State.Put(resourceCreatorNamespace, key, creator); err != nil {
+			log.Printf("Could not record creator of %s: %s", res.ID(), err)
+		}
+	}
+	return creator
+}
+
+// splitByCreator splits the mail data of a shared account into mail data
+// for each employee that created any of the resources. Resources created
+// by the owner, or whose creator is unknown, are kept in the mail data of
+// the owner, which is always first. The mail data is returned as is if
+// creator lookup isn't enabled or the account isn't shared.
+func (c *Client) splitByCreator(mailData *resourceMailData) []*resourceMailData {
+	if !c.config.CreatorLookup || c.config.Organization == nil || !c.config.Organization.SharedAccounts()[mailData.OwnerID] {
+		return []*resourceMailData{mailData}
+	}
+	creators := make(map[string]string)
+	for _, res := range mailData.allResources() {
+		employee := c.config.Organization.EmployeeForPrincipal(c.resourceCreator(res), c.config.EmailDomain)
+		if employee != nil && employee.Username != mailData.Owner {
+			creators[res.ID()] = employee.Username
+		}
+	}
+	if len(creators) == 0 {
+		return []*resourceMailData{mailData}
+	}
+
+	usernames := []string{}
+	seen := make(map[string]bool)
+	for _, username := range creators {
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+
+	result := []*resourceMailData{mailData.withCreator(creators, "")}
+	for _, username := range usernames {
+		log.Printf("Attributing resources in %s to their creator %s", mailData.OwnerID, username)
+		result = append(result, mailData.withCreator(creators, username))
+	}
+	return result
+}
+
+// withCreator returns a copy of the mail data, addressed to username, with
+// only the resources attributed to username in creators. An empty username
+// gives the resources without a creator, addressed to the owner.
+func (d *resourceMailData) withCreator(creators map[string]string, username string) *resourceMailData {
+	creatorFilter := filter.New()
+	creatorFilter.OverrideWhitelist = true
+	creatorFilter.AddGeneralRule(func(r cloud.Resource) bool {
+		return creators[r.ID()] == username
+	})
+	owner := username
+	if owner == "" {
+		owner = d.Owner
+	}
+	maxLifetimeExceeded := []cloud.Resource{}
+	for _, res := range d.MaxLifetimeExceeded {
+		if creators[res.ID()] == username {
+			maxLifetimeExceeded = append(maxLifetimeExceeded, res)
+		}
+	}
+	return &resourceMailData{
+		Owner:               owner,
+		OwnerID:             d.OwnerID,
+		Instances:           filter.Instances(d.Instances, creatorFilter),
+		Images:              filter.Images(d.Images, creatorFilter),
+		Snapshots:           filter.Snapshots(d.Snapshots, creatorFilter),
+		Volumes:             filter.Volumes(d.Volumes, creatorFilter),
+		Buckets:             filter.Buckets(d.Buckets, creatorFilter),
+		Tables:              filter.Tables(d.Tables, creatorFilter),
+		CacheClusters:       filter.CacheClusters(d.CacheClusters, creatorFilter),
+		Addresses:           filter.Addresses(d.Addresses, creatorFilter),
+		NetworkGateways:     filter.NetworkGateways(d.NetworkGateways, creatorFilter),
+		Capacities:          filter.Capacities(d.Capacities, creatorFilter),
+		DBInstances:         filter.DBInstances(d.DBInstances, creatorFilter),
+		DBSnapshots:         filter.DBSnapshots(d.DBSnapshots, creatorFilter),
+		InUseVolumes:        filter.Volumes(d.InUseVolumes, creatorFilter),
+		InUseSnapshots:      filter.Snapshots(d.InUseSnapshots, creatorFilter),
+		MaxLifetimeExceeded: maxLifetimeExceeded,
+		HoursInAdvance:      d.HoursInAdvance,
+		Reminder:            d.Reminder,
+		ReminderCount:       d.ReminderCount,
+		NextReminderHours:   d.NextReminderHours,
+		DashboardURL:        d.DashboardURL,
+		AttachedVolumes:     d.AttachedVolumes,
+		PartialScans:        d.PartialScans,
+	}
+}
+
+// probableOwners guesses who owns each of the resources, by looking for
+// the username of an employee in their Name tag, key pair and security
+// groups, e.g. alice for an instance named alice-test-box. The guesses are
+// returned by resource ID, together with where the username was found.
+func (c *Client) probableOwners(resources []cloud.Resource) map[string]string {
+	guesses := make(map[string]string)
+	if c.config.Organization == nil {
+		return guesses
+	}
+	usernames := make(map[string][]string)
+	for _, employee := range c.config.Organization.Employees {
+		if !employee.Disabled && len(employee.Username) >= minGuessedUsernameLength {
+			usernames[employee.Username] = nameTokens(employee.Username)
+		}
+	}
+	for _, res := range resources {
+		// Names are checked in order, the first match is the guess
+		names := [][2]string{{"Name tag", res.Tags()["Name"]}}
+		if inst, ok := res.(cloud.Instance); ok {
+			names = append(names, [2]string{"key pair", inst.KeyName()})
+			for _, group := range inst.SecurityGroups() {
+				names = append(names, [2]string{"security group", group})
+			}
+		}
+		for _, name := range names {
+			if username := usernameIn(nameTokens(name[1]), usernames); username != "" {
+				guesses[res.ID()] = fmt.Sprintf("%s (from %s)", username, name[0])
+				break
+			}
+		}
+	}
+	return guesses
+}
+
+// usernameIn returns the username whose words are found in tokens. The
+// longest username wins if several are, since it's the most specific.
+func usernameIn(tokens []string, usernames map[string][]string) string {
+	result := ""
+	for username, words := range usernames {
+		if containsTokens(tokens, words) && (len(username) > len(result) || len(username) == len(result) && username < result) {
+			result = username
+		}
+	}
+	return result
+}
+
+// nameTokens splits a name into its lower case words, e.g.
+// alice-test_box into alice, test and box
+func nameTokens(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsTokens returns true if words are found in order, next to each
+// other, in tokens
+func containsTokens(tokens, words []string) bool {
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		match := true
+		for j := range words {
+			if tokens[i+j] != words[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
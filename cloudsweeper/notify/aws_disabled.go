@@ -0,0 +1,15 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build noaws
+// +build noaws
+
+package notify
+
+import "errors"
+
+// NewS3Queue is not supported when Cloudsweeper is built without AWS
+// support, use NewDirQueue instead
+func NewS3Queue(bucket, region string) (MailQueue, error) {
+	return nil, errors.New("Cloudsweeper is built without support for AWS, can't hold mails in S3")
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+// staleKey is an access key listed in a credential hygiene mail, with the
+// reason it's listed
+type staleKey struct {
+	*cloud.AccessKey
+	Reason string
+}
+
+type credentialHygieneMailData struct {
+	Owner   string
+	OwnerID string
+	CSP     cloud.CSP
+	Keys    []staleKey
+	// UsageUnknown is true if the last use of some keys is unknown, so
+	// only their age was checked
+	UsageUnknown bool
+}
+
+// staleKeyReason returns why a key should be rotated or removed, or an
+// empty string if it shouldn't. A key is stale if it's older than
+// maxAgeDays, or if it hasn't been used in unusedDays. A threshold of 0
+// disables that check.
+func staleKeyReason(key *cloud.AccessKey, maxAgeDays, unusedDays int) string {
+	now := clock.Now()
+	days := func(t time.Time) int { return int(now.Sub(t).Hours() / 24.0) }
+	if maxAgeDays > 0 && days(key.CreationTime) > maxAgeDays {
+		return fmt.Sprintf("Older than %d days", maxAgeDays)
+	}
+	if unusedDays > 0 && key.LastUsedKnown && days(key.CreationTime) > unusedDays {
+		if key.LastUsed.IsZero() {
+			return "Never used"
+		}
+		if days(key.LastUsed) > unusedDays {
+			return fmt.Sprintf("Not used in %d days", unusedDays)
+		}
+	}
+	return ""
+}
+
+// CredentialHygieneReport sends an email to the owner of each account
+// listing the access keys that are older than maxAgeDays, or that haven't
+// been used in unusedDays, so that they can be rotated or removed.
+func (c *Client) CredentialHygieneReport(csp cloud.CSP, keys map[string][]*cloud.AccessKey, accountUserMapping map[string]string, maxAgeDays, unusedDays int) {
+	defer c.logSuppressedMail()
+	accounts := make([]string, 0, len(keys))
+	for account := range keys {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		log.Println("Looking for stale access keys in", cloud.AccountName(account))
+		username := accountUserMapping[account]
+		mailData := &credentialHygieneMailData{
+			Owner:   username,
+			OwnerID: account,
+			CSP:     csp,
+			Keys:    []staleKey{},
+		}
+		for _, key := range keys[account] {
+			if !key.LastUsedKnown {
+				mailData.UsageUnknown = true
+			}
+			if reason := staleKeyReason(key, maxAgeDays, unusedDays); reason != "" {
+				mailData.Keys = append(mailData.Keys, staleKey{AccessKey: key, Reason: reason})
+			}
+		}
+		if len(mailData.Keys) == 0 {
+			continue
+		}
+		if username == "" {
+			log.Printf("Not sending credential hygiene mail for %s, since it has no owner\n", cloud.AccountName(account))
+			continue
+		}
+		sort.Slice(mailData.Keys, func(i, j int) bool {
+			if !mailData.Keys[i].CreationTime.Equal(mailData.Keys[j].CreationTime) {
+				return mailData.Keys[i].CreationTime.Before(mailData.Keys[j].CreationTime)
+			}
+			return mailData.Keys[i].ID < mailData.Keys[j].ID
+		})
+
+		mailContent, err := generateMail(mailData, credentialHygieneTemplate)
+		if err != nil {
+			log.Fatalln("Could not generate email:", err)
+		}
+		settings := c.mailSettings(username, account)
+		recipientMail := convertEmailExceptions(c.emailForUser(username, settings))
+		title := c.subject(CredentialHygieneMail, subjectData{Count: len(mailData.Keys), Account: account, Owner: username, CSP: csp})
+		if c.outputReport(mailContent, keyRecords(recipientMail, mailData.Keys)) {
+			continue
+		}
+		if c.isDuplicateMail(recipientMail, credentialHygieneTemplate, title, mailContent) {
+			continue
+		}
+		log.Printf("Sending out credential hygiene mail to %s\n", recipientMail)
+		err = c.deliverMail(settings, title, mailContent, recipientMail)
+		if err != nil {
+			log.Printf("Failed to email %s: %s\n", recipientMail, err)
+			continue
+		}
+		c.recordMail(recipientMail, credentialHygieneTemplate, mailContent)
+	}
+}
+
+// keyRecords returns an OutputRecord for each of the keys
+func keyRecords(recipient string, keys []staleKey) []OutputRecord {
+	records := []OutputRecord{}
+	for _, key := range keys {
+		records = append(records, OutputRecord{
+			Report:       CredentialHygieneMail,
+			Recipient:    recipient,
+			Account:      key.Account,
+			AccountAlias: accountAlias(key.Account),
+			Type:         "access-key",
+			ID:           key.ID,
+			Name:         key.Principal,
+			Created:      key.CreationTime.Format(time.RFC3339),
+		})
+	}
+	return records
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+const (
+	sentMailNamespace      = "sent-mail"
+	recipientMailNamespace = "recipient-mail"
+)
+
+// isDuplicateMail checks if a mail should be suppressed, either because
+// the exact same mail was already sent to the recipient within the dedupe
+// window, or because the recipient has reached the maximum amount of mails
+// within that window.
+func (c *Client) isDuplicateMail(recipient, mailTemplate, title, content string) bool {
+	if c.config.State == nil || c.config.MailDedupeWindow <= 0 {
+		return false
+	}
+	var sentAt time.Time
+	found, err := c.config.State.Get(sentMailNamespace, sentMailKey(recipient, mailTemplate, content), &sentAt)
+	if err != nil {
+		log.Printf("Could not read mail state for %s: %s", recipient, err)
+		return false
+	}
+	if found && clock.Now().Before(sentAt.Add(c.config.MailDedupeWindow)) {
+		c.suppressMail(recipient, title, fmt.Sprintf("identical mail sent at %s", sentAt.Format(time.RFC3339)))
+		return true
+	}
+	if c.config.MailMaxPerRecipient > 0 {
+		sent := c.recentMailTimes(recipient)
+		if len(sent) >= c.config.MailMaxPerRecipient {
+			c.suppressMail(recipient, title, fmt.Sprintf("%d mails already sent within %s", len(sent), c.config.MailDedupeWindow))
+			return true
+		}
+	}
+	return false
+}
+
+// recordMail remembers that a mail was sent, so that identical mails
+// can be suppressed later on. Only the times within the dedupe window
+// are kept for the recipient.
+func (c *Client) recordMail(recipient, mailTemplate, content string) {
+	if c.config.State == nil || c.config.MailDedupeWindow <= 0 || c.config.Plan {
+		return
+	}
+	c.pruneOnce.Do(c.pruneMailState)
+	now := clock.Now()
+	err := c.config.State.Put(sentMailNamespace, sentMailKey(recipient, mailTemplate, content), now)
+	if err != nil {
+		log.Printf("Could not record mail to %s: %s", recipient, err)
+	}
+	err = c.config.State.Put(recipientMailNamespace, recipient, append(c.recentMailTimes(recipient), now))
+	if err != nil {
+		log.Printf("Could not record mail to %s: %s", recipient, err)
+	}
+}
+
+// pruneMailState forgets the mails sent before the dedupe window, and
+// the recipients who haven't been sent any mail within it, so that the
+// state file doesn't keep growing.
+func (c *Client) pruneMailState() {
+	expired := []string{}
+	for _, key := range c.config.State.Keys(sentMailNamespace) {
+		var sentAt time.Time
+		if _, err := c.config.State.Get(sentMailNamespace, key, &sentAt); err != nil || !clock.Now().Before(sentAt.Add(c.config.MailDedupeWindow)) {
+			expired = append(expired, key)
+		}
+	}
+	if err := c.config.State.DeleteKeys(sentMailNamespace, expired); err != nil {
+		log.Printf("Could not prune the sent mails: %s", err)
+	}
+	expired = []string{}
+	for _, recipient := range c.config.State.Keys(recipientMailNamespace) {
+		if len(c.recentMailTimes(recipient)) == 0 {
+			expired = append(expired, recipient)
+		}
+	}
+	if err := c.config.State.DeleteKeys(recipientMailNamespace, expired); err != nil {
+		log.Printf("Could not prune the mail recipients: %s", err)
+	}
+}
+
+// recentMailTimes returns the times mails were sent to the recipient
+// within the dedupe window.
+func (c *Client) recentMailTimes(recipient string) []time.Time {
+	var sent []time.Time
+	if _, err := c.config.State.Get(recipientMailNamespace, recipient, &sent); err != nil {
+		log.Printf("Could not read mail state for %s: %s", recipient, err)
+	}
+	recent := []time.Time{}
+	for _, t := range sent {
+		if clock.Now().Before(t.Add(c.config.MailDedupeWindow)) {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+func (c *Client) suppressMail(recipient, title, reason string) {
+	log.Printf("Not sending \"%s\" to %s: %s\n", title, recipient, reason)
+	c.suppressedMu.Lock()
+	c.suppressedMail = append(c.suppressedMail, fmt.Sprintf("%s: %s", recipient, title))
+	c.suppressedMu.Unlock()
+}
+
+// logSuppressedMail will log a summary of all mails that were not
+// sent since they had already been sent recently.
+func (c *Client) logSuppressedMail() {
+	c.suppressedMu.Lock()
+	defer c.suppressedMu.Unlock()
+	if len(c.suppressedMail) == 0 {
+		return
+	}
+	log.Printf("Suppressed %d duplicate mails:\n", len(c.suppressedMail))
+	for _, mail := range c.suppressedMail {
+		log.Printf("\t%s\n", mail)
+	}
+	c.suppressedMail = nil
+}
+
+func sentMailKey(recipient, mailTemplate, content string) string {
+	templateHash := sha256.Sum256([]byte(mailTemplate))
+	contentHash := sha256.Sum256([]byte(content))
+	return fmt.Sprintf("%s/%s/%s", recipient, hex.EncodeToString(templateHash[:8]), hex.EncodeToString(contentHash[:]))
+}
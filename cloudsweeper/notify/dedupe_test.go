@@ -0,0 +1,57 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/state"
+)
+
+func TestRecordMailPrunesState(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock.Set(clock.Frozen(start))
+	defer clock.Set(nil)
+
+	old := Init(&Config{State: store, MailDedupeWindow: 24 * time.Hour})
+	old.recordMail("alice@example.com", "review", "old review")
+	old.recordMail("bob@example.com", "review", "old review")
+	clock.Set(clock.Frozen(start.Add(20 * time.Hour)))
+	old.recordMail("bob@example.com", "warning", "recent warning")
+
+	clock.Set(clock.Frozen(start.Add(30 * time.Hour)))
+	client := Init(&Config{State: store, MailDedupeWindow: 24 * time.Hour})
+	client.recordMail("carol@example.com", "review", "new review")
+
+	if keys := store.Keys(sentMailNamespace); len(keys) != 2 {
+		t.Errorf("Kept %d sent mails, expected the 2 within the window: %v", len(keys), keys)
+	}
+	if !client.isDuplicateMail("bob@example.com", "warning", "title", "recent warning") {
+		t.Error("Recent mail to bob was forgotten")
+	}
+	if client.isDuplicateMail("alice@example.com", "review", "title", "old review") {
+		t.Error("Old mail to alice was remembered")
+	}
+	expected := []string{"bob@example.com", "carol@example.com"}
+	if recipients := store.Keys(recipientMailNamespace); !reflect.DeepEqual(recipients, expected) {
+		t.Errorf("Kept recipients %v, expected %v", recipients, expected)
+	}
+
+	client.recordMail("bob@example.com", "review", "new review")
+	var sent []time.Time
+	if _, err := store.Get(recipientMailNamespace, "bob@example.com", &sent); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 {
+		t.Errorf("Kept %d mail times for bob, expected the 2 within the window: %v", len(sent), sent)
+	}
+}
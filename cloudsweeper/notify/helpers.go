@@ -7,11 +7,15 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"strings"
 	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
 	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
 	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/metrics"
 	"github.com/cloudtools/cloudsweeper/mailer"
 )
 
@@ -41,20 +45,125 @@ func convertEmailExceptions(oldMail string) string {
 	return oldMail
 }
 
-func getMailClient(notifyClient *Client) mailer.Client {
-	username := notifyClient.config.SMTPUsername
-	password := notifyClient.config.SMTPPassword
-	server := notifyClient.config.SMTPServer
-	port := notifyClient.config.SMTPPort
-	from := notifyClient.config.MailFrom
+// mailSettings returns the mail settings used for mails to the specified
+// user about the specified account, which are the configured settings
+// unless they are overridden for the account or the user's department in
+// the organization
+func (c *Client) mailSettings(username, account string) cs.MailSettings {
+	settings := cs.MailSettings{
+		EmailDomain:  c.config.EmailDomain,
+		MailFrom:     c.config.MailFrom,
+		SMTPServer:   c.config.SMTPServer,
+		SMTPPort:     c.config.SMTPPort,
+		SMTPUsername: c.config.SMTPUsername,
+		SMTPPassword: c.config.SMTPPassword,
+	}
+	if c.config.Organization == nil {
+		return settings
+	}
+	return settings.Override(c.config.Organization.MailSettingsFor(username, account))
+}
+
+// emailForUser returns the email address of the specified user. This is
+// the address from the UserEmails config if it exist, and otherwise the
+// username at the email domain of the mail settings.
+func (c *Client) emailForUser(username string, settings cs.MailSettings) string {
+	if email, exist := c.config.UserEmails[username]; exist {
+		return email
+	}
+	return fmt.Sprintf("%s@%s", username, settings.EmailDomain)
+}
+
+// dashboardURL returns the URL of a dashboard page, or an empty string if
+// no DashboardURL is configured
+func (c *Client) dashboardURL(page string) string {
+	if c.config.DashboardURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(c.config.DashboardURL, "/") + "/" + page
+}
+
+func getMailClient(notifyClient *Client, settings cs.MailSettings) mailer.Client {
 	displayName := notifyClient.config.DisplayName
-	return mailer.NewClient(username, password, displayName, from, server, port)
+	return mailer.NewClient(settings.SMTPUsername, settings.SMTPPassword, displayName, settings.MailFrom, settings.SMTPServer, settings.SMTPPort)
+}
+
+// deliverMail sends a mail using the specified mail settings, or only
+// collects it if the Client is in plan mode, or holds it for review if
+// the Client has a HoldQueue. The time it takes is the notify phase, see
+// metrics.PhaseNotify.
+func (c *Client) deliverMail(settings cs.MailSettings, subject, content string, recipients ...string) error {
+	defer metrics.ObservePhase(metrics.PhaseNotify, time.Now())
+	if c.config.Plan {
+		c.plannedMu.Lock()
+		defer c.plannedMu.Unlock()
+		c.plannedMail = append(c.plannedMail, PlannedMail{Recipients: recipients, Subject: subject})
+		return nil
+	}
+	if c.config.HoldQueue != nil {
+		return c.holdMail(settings, subject, content, recipients...)
+	}
+	return getMailClient(c, settings).SendEmail(subject, content, recipients...)
+}
+
+// SendTestMail sends a mail to the specified user, to check that mails
+// can be sent. It's sent even if the Client holds mails or is in plan
+// mode, since that's what it checks.
+func (c *Client) SendTestMail(username string) error {
+	settings := c.mailSettings(username, "")
+	recipient := convertEmailExceptions(c.emailForUser(username, settings))
+	content := fmt.Sprintf("<p>This is a test mail from %s, sent by the doctor command at %s.</p>", c.config.DisplayName, clock.Now().Format(time.RFC1123))
+	return getMailClient(c, settings).SendEmail("Cloudsweeper test mail", content, recipient)
+}
+
+// PlannedMails returns the mails collected in plan mode, in the order
+// they would have been sent
+func (c *Client) PlannedMails() []PlannedMail {
+	c.plannedMu.Lock()
+	defer c.plannedMu.Unlock()
+	return append([]PlannedMail{}, c.plannedMail...)
 }
 
 func accumulatedCost(res cloud.Resource) float64 {
-	days := time.Now().Sub(res.CreationTime()).Hours() / 24.0
-	costPerDay := billing.ResourceCostPerDay(res)
-	return days * costPerDay
+	return billing.AccumulatedDays(res) * billing.ResourceCostPerDay(res)
+}
+
+// resourceTypeName returns a human readable name of the type of a resource
+func resourceTypeName(res cloud.Resource) string {
+	switch res := res.(type) {
+	case cloud.Instance:
+		return "Instance"
+	case cloud.Image:
+		return "Image"
+	case cloud.Volume:
+		return "Volume"
+	case cloud.Snapshot:
+		return "Snapshot"
+	case cloud.Bucket:
+		return "Bucket"
+	case cloud.Table:
+		return "Table"
+	case cloud.CacheCluster:
+		return "Cache cluster"
+	case cloud.Address:
+		return "Address"
+	case cloud.NetworkGateway:
+		if res.GatewayType() == cloud.NATGatewayType {
+			return "NAT gateway"
+		}
+		return "VPC endpoint"
+	case cloud.Capacity:
+		if res.CapacityType() == cloud.DedicatedHostType {
+			return "Dedicated host"
+		}
+		return "Capacity reservation"
+	case cloud.DBInstance:
+		return "Database"
+	case cloud.DBSnapshot:
+		return "Database snapshot"
+	default:
+		return "Resource"
+	}
 }
 
 func extraTemplateFunctions() template.FuncMap {
@@ -64,7 +173,7 @@ func extraTemplateFunctions() template.FuncMap {
 			if (t == time.Time{}) {
 				return "never"
 			}
-			days := int(time.Now().Sub(t).Hours() / 24.0)
+			days := int(clock.Now().Sub(t).Hours() / 24.0)
 			switch days {
 			case 0:
 				return "today"
@@ -76,7 +185,7 @@ func extraTemplateFunctions() template.FuncMap {
 		},
 		// TODO: this should be configurable
 		"modifiedInTheLast6Months": func(t time.Time) string {
-			if time.Now().Before(t.AddDate(0, 6, 0)) {
+			if clock.Now().Before(t.AddDate(0, 6, 0)) {
 				return "true"
 			}
 			return "false"
@@ -96,6 +205,85 @@ func extraTemplateFunctions() template.FuncMap {
 			totalCost := accumulatedCost(res)
 			return fmt.Sprintf("$%.2f", totalCost)
 		},
+		"markingcost": func(res cloud.Resource) string {
+			return fmt.Sprintf("$%.2f", billing.AccumulatedCost(res))
+		},
+		"costestimate": func() string {
+			if billing.AmortizationWindowDays > 0 {
+				return fmt.Sprintf("Total cost is an estimate based on current prices, counting at most the last %d days of each resource.", billing.AmortizationWindowDays)
+			}
+			return "Total cost is an estimate based on current prices, counting the whole life of each resource."
+		},
+		"note": func(res cloud.Resource) string {
+			note := res.Tags()[filter.NoteTagKey]
+			if filter.WhitelistPendingApproval(res) {
+				return strings.TrimSuffix("Whitelist pending approval. "+note, " ")
+			}
+			return note
+		},
+		"retaineduntil": func(res cloud.Resource) string {
+			retainedUntil, hasRetention, err := filter.RetainedUntil(res)
+			if err != nil || !hasRetention {
+				return ""
+			}
+			return retainedUntil.Format("2006-01-02")
+		},
+		"maxlifetimeend": func(res cloud.Resource) string {
+			end, applies := filter.MaxLifetimeEnd(res)
+			if !applies {
+				return ""
+			}
+			return end.Format("2006-01-02")
+		},
+		"maxlifetimemarking": func(res cloud.Resource) string {
+			end, applies := filter.MaxLifetimeEnd(res)
+			if !applies {
+				return ""
+			}
+			return end.AddDate(0, 0, filter.MaxLifetimeGraceDays).Format("2006-01-02")
+		},
+		"orphanof": func(res cloud.Resource) string {
+			return res.Tags()[filter.OrphanTagKey]
+		},
+		"resourcetype": resourceTypeName,
+		"inc":          func(i int) int { return i + 1 },
+		"join":         strings.Join,
+		"volumescope": func(vol cloud.Volume) string {
+			if vol.Regional() {
+				return "Regional"
+			}
+			return "Zonal"
+		},
+		"volumeperformance": func(vol cloud.Volume) string {
+			parts := []string{}
+			if vol.Iops() > 0 {
+				parts = append(parts, fmt.Sprintf("%d IOPS", vol.Iops()))
+			}
+			if vol.ThroughputMBps() > 0 {
+				parts = append(parts, fmt.Sprintf("%d MB/s", vol.ThroughputMBps()))
+			}
+			if len(parts) == 0 {
+				return "-"
+			}
+			performanceCost := billing.VolumeIOPSCostPerDay(vol) + billing.VolumeThroughputCostPerDay(vol)
+			return fmt.Sprintf("%s ($%.2f/month)", strings.Join(parts, ", "), performanceCost*30.0)
+		},
+		"utilization": func(capacity cloud.Capacity) string {
+			if capacity.TotalInstances() == 0 {
+				return "-"
+			}
+			return fmt.Sprintf("%d of %d (%.0f%%)", capacity.UsedInstances(), capacity.TotalInstances(), 100.0*float64(capacity.UsedInstances())/float64(capacity.TotalInstances()))
+		},
+		"computecost": func(inst cloud.Instance) string {
+			return fmt.Sprintf("$%.2f", billing.AccumulatedDays(inst)*billing.InstancePricePerHour(inst)*24.0)
+		},
+		"ipv4cost": func(inst cloud.Instance) string {
+			price := billing.PublicIPv4PricePerHour(inst)
+			if price == 0 {
+				return "-"
+			}
+			return fmt.Sprintf("$%.2f", billing.AccumulatedDays(inst)*price*24.0)
+		},
 		"bucketcost": func(res cloud.Bucket) float64 {
 			return billing.BucketPricePerMonth(res)
 		},
@@ -120,6 +308,14 @@ func extraTemplateFunctions() template.FuncMap {
 			}
 			return ""
 		},
+		"creator": func(res cloud.Resource) string {
+			for _, key := range filter.CreatorTagKeys {
+				if creator, exist := res.Tags()[key]; exist {
+					return creator
+				}
+			}
+			return ""
+		},
 		"rolename": func(res cloud.Resource) string {
 			role, exist := res.Tags()["role"]
 			if exist {
@@ -131,7 +327,18 @@ func extraTemplateFunctions() template.FuncMap {
 			if name, ok := accountToUser[account]; ok {
 				return name
 			}
-			return account
+			return cloud.AccountName(account)
+		},
+		"account": cloud.AccountName,
+		"accounts": func(accounts []string) []string {
+			names := make([]string, len(accounts))
+			for i, account := range accounts {
+				names[i] = cloud.AccountName(account)
+			}
+			return names
+		},
+		"usertags": func(res cloud.Resource) map[string]string {
+			return filter.UserTags(res)
 		},
 		"prettyTag": func(key, val string) string {
 			if val == "" {
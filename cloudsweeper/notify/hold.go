@@ -0,0 +1,198 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+)
+
+// heldMailExtension is the extension of held mails in a queue
+const heldMailExtension = ".json"
+
+// HeldMail is a mail that was held for review instead of being sent, see
+// Config.HoldQueue
+type HeldMail struct {
+	// Name identifies the mail in its queue
+	Name       string    `json:"-"`
+	Recipients []string  `json:"recipients"`
+	Subject    string    `json:"subject"`
+	Content    string    `json:"content"`
+	HeldAt     time.Time `json:"held_at"`
+	// Settings are the mail settings the mail is sent with. The SMTP
+	// password is left out, and looked up when the mail is released.
+	Settings cs.MailSettings `json:"settings"`
+}
+
+// MailQueue holds mails until they are released
+type MailQueue interface {
+	// Put adds a mail to the queue
+	Put(mail *HeldMail) error
+	// List returns the mails in the queue, in the order they were held
+	List() ([]*HeldMail, error)
+	// Remove removes a mail from the queue
+	Remove(mail *HeldMail) error
+}
+
+// heldMailName returns a name of a held mail that sorts in the order
+// mails are held, and is unique for its recipients and content
+func heldMailName(mail *HeldMail) string {
+	hash := sha256.Sum256([]byte(strings.Join(mail.Recipients, ",") + "\x00" + mail.Subject + "\x00" + mail.Content))
+	return fmt.Sprintf("%s-%s%s", mail.HeldAt.UTC().Format("20060102T150405Z"), hex.EncodeToString(hash[:6]), heldMailExtension)
+}
+
+func encodeHeldMail(mail *HeldMail) ([]byte, error) {
+	return json.MarshalIndent(mail, "", "  ")
+}
+
+func decodeHeldMail(name string, data []byte) (*HeldMail, error) {
+	mail := new(HeldMail)
+	if err := json.Unmarshal(data, mail); err != nil {
+		return nil, fmt.Errorf("Could not decode held mail %s: %s", name, err)
+	}
+	mail.Name = name
+	return mail, nil
+}
+
+type dirQueue struct {
+	dir string
+}
+
+// NewDirQueue returns a queue of mails in a directory, which is created
+// if it doesn't exist. Every mail is a JSON file, and can be discarded
+// by removing the file.
+func NewDirQueue(dir string) (MailQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &dirQueue{dir: dir}, nil
+}
+
+func (q *dirQueue) Put(mail *HeldMail) error {
+	mail.Name = heldMailName(mail)
+	data, err := encodeHeldMail(mail)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(q.dir, mail.Name), data, 0600)
+}
+
+func (q *dirQueue) List() ([]*HeldMail, error) {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	mails := []*HeldMail{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != heldMailExtension {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(q.dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mail, err := decodeHeldMail(file.Name(), data)
+		if err != nil {
+			return nil, err
+		}
+		mails = append(mails, mail)
+	}
+	sort.SliceStable(mails, func(i, j int) bool {
+		return mails[i].Name < mails[j].Name
+	})
+	return mails, nil
+}
+
+func (q *dirQueue) Remove(mail *HeldMail) error {
+	return os.Remove(filepath.Join(q.dir, mail.Name))
+}
+
+// holdMail adds a mail to the hold queue, without the SMTP password
+func (c *Client) holdMail(settings cs.MailSettings, subject, content string, recipients ...string) error {
+	settings.SMTPPassword = ""
+	mail := &HeldMail{
+		Recipients: recipients,
+		Subject:    subject,
+		Content:    content,
+		HeldAt:     clock.Now(),
+		Settings:   settings,
+	}
+	if err := c.config.HoldQueue.Put(mail); err != nil {
+		return fmt.Errorf("Could not hold mail for review: %s", err)
+	}
+	log.Printf("Holding mail %s for review\n", mail.Name)
+	return nil
+}
+
+// smtpPassword returns the password of the SMTP user in the settings. It's
+// the configured password, unless the user and server are overridden with
+// a password in the organization.
+func (c *Client) smtpPassword(settings cs.MailSettings) string {
+	if c.config.Organization == nil {
+		return c.config.SMTPPassword
+	}
+	for _, override := range c.config.Organization.AllMailSettings() {
+		if override.SMTPPassword == "" {
+			continue
+		}
+		effective := cs.MailSettings{SMTPServer: c.config.SMTPServer, SMTPUsername: c.config.SMTPUsername}.Override(override)
+		if effective.SMTPServer == settings.SMTPServer && effective.SMTPUsername == settings.SMTPUsername {
+			return override.SMTPPassword
+		}
+	}
+	return c.config.SMTPPassword
+}
+
+// ReleaseHeldMails sends the mails in the queue, and removes them from it
+// once they are sent. Mails that couldn't be sent are left in the queue,
+// and their amount is returned.
+func (c *Client) ReleaseHeldMails(queue MailQueue) (failed int, err error) {
+	mails, err := queue.List()
+	if err != nil {
+		return 0, fmt.Errorf("Could not list held mails: %s", err)
+	}
+	for _, mail := range mails {
+		settings := mail.Settings
+		settings.SMTPPassword = c.smtpPassword(settings)
+		log.Printf("Releasing mail %s to %s\n", mail.Name, strings.Join(mail.Recipients, ", "))
+		if err := getMailClient(c, settings).SendEmail(mail.Subject, mail.Content, mail.Recipients...); err != nil {
+			log.Printf("Failed to send held mail %s: %s\n", mail.Name, err)
+			failed++
+			continue
+		}
+		if err := queue.Remove(mail); err != nil {
+			log.Printf("Sent held mail %s, but could not remove it from the queue: %s\n", mail.Name, err)
+			failed++
+		}
+	}
+	log.Printf("Released %d of %d held mails\n", len(mails)-failed, len(mails))
+	return failed, nil
+}
+
+// FormatHeldMails returns a table of held mails, for review before they
+// are released
+func FormatHeldMails(mails []*HeldMail) string {
+	if len(mails) == 0 {
+		return "No mails are held for review\n"
+	}
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "%d mails are held for review:\n", len(mails))
+	for _, mail := range mails {
+		fmt.Fprintf(b, "  %s  %s  %q\n", mail.Name, strings.Join(mail.Recipients, ", "), mail.Subject)
+	}
+	return b.String()
+}
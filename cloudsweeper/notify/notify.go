@@ -15,23 +15,88 @@
 package notify
 
 import (
+	"context"
 	"fmt"
+	"html/template"
 	"log"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/cloudtools/cloudsweeper/mailer"
-
 	"github.com/cloudtools/cloudsweeper/cloud"
 	"github.com/cloudtools/cloudsweeper/cloud/billing"
 	"github.com/cloudtools/cloudsweeper/cloud/filter"
 	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/dashboard"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/state"
 )
 
 // Client is used to perform the notify actions. It must be
 // initalized with correct values to work properly.
 type Client struct {
 	config *Config
+
+	suppressedMu   sync.Mutex
+	suppressedMail []string
+
+	pruneOnce sync.Once
+
+	plannedMu   sync.Mutex
+	plannedMail []PlannedMail
+}
+
+// PlannedMail is a mail that a Client in plan mode would have sent
+type PlannedMail struct {
+	Recipients []string
+	Subject    string
+}
+
+// RollupStyle defines how resources are listed in reviews sent to managers
+// and the org, which roll up the resources of several owners
+type RollupStyle string
+
+const (
+	// RollupFull lists every resource, even though the owners have
+	// already been sent them
+	RollupFull RollupStyle = "full"
+	// RollupCounts only lists the amount and cost of resources per owner
+	RollupCounts RollupStyle = "counts"
+	// RollupTop only lists the most expensive resources
+	RollupTop RollupStyle = "top"
+	// RollupNone doesn't send the review at all
+	RollupNone RollupStyle = "none"
+)
+
+// ParseRollupStyle returns the RollupStyle with the specified name
+func ParseRollupStyle(name string) (RollupStyle, error) {
+	switch style := RollupStyle(name); style {
+	case RollupFull, RollupCounts, RollupTop, RollupNone:
+		return style, nil
+	default:
+		return "", fmt.Errorf("Unknown rollup style %q, must be one of %s, %s, %s or %s", name, RollupFull, RollupCounts, RollupTop, RollupNone)
+	}
+}
+
+// MailOrder defines how the resources of each type are ordered in mails
+type MailOrder string
+
+const (
+	// OrderByCost lists the most expensive resources first
+	OrderByCost MailOrder = "cost"
+	// OrderBySize lists the largest volumes, snapshots, images, buckets
+	// and tables first. Other resources are ordered by cost.
+	OrderBySize MailOrder = "size"
+)
+
+// ParseMailOrder returns the MailOrder with the specified name
+func ParseMailOrder(name string) (MailOrder, error) {
+	switch order := MailOrder(name); order {
+	case OrderByCost, OrderBySize:
+		return order, nil
+	default:
+		return "", fmt.Errorf("Unknown mail order %q, must be %s or %s", name, OrderByCost, OrderBySize)
+	}
 }
 
 // Config is a configuration for the notify Client
@@ -45,63 +110,523 @@ type Config struct {
 	EmailDomain            string
 	BillingReportAddressee string
 	TotalSumAddresse       string
+	// WhitelistAddressee is the employee/alias that gets the
+	// report of all whitelisted resources and their cost
+	WhitelistAddressee string
+
+	// State is used to remember which mails have been sent. If it
+	// is nil, no mails are deduplicated.
+	State *state.Store
+	// MailDedupeWindow is how long an identical mail (same recipient,
+	// template and content) is suppressed after being sent
+	MailDedupeWindow time.Duration
+	// MailMaxPerRecipient is the maximum amount of mails a single
+	// recipient gets within the MailDedupeWindow. 0 means no limit.
+	MailMaxPerRecipient int
+	// UserEmails maps usernames to their email address, for users
+	// who should not get email at <username>@<EmailDomain>
+	UserEmails map[string]string
+	// AutomationPrincipals are principals, such as CI roles, whose
+	// resources are reported to the AutomationAddressee instead of
+	// the account owner. See filter.CreatedByPrincipal for the format.
+	AutomationPrincipals []string
+	// AutomationAddressee is the employee/alias, such as the platform
+	// team, that gets warned about resources created by automation
+	AutomationAddressee string
+	// ManagerRollup and OrgRollup is how resources are listed in the
+	// reviews sent to managers and the org. The empty style is RollupFull.
+	ManagerRollup RollupStyle
+	OrgRollup     RollupStyle
+	// RollupTopN is the amount of resources listed with RollupTop
+	RollupTopN int
+	// RollupDepth is how many levels of managers the resources of an
+	// owner are rolled up to. 1 (or less) only rolls them up to their
+	// manager, 2 also to the manager's manager and so on.
+	RollupDepth int
+	// Subjects overrides the subject templates of mails, by the name
+	// of the mail, such as ReviewMail
+	Subjects map[string]string
+	// SubjectBadge is a template prefixed to the subject of every mail,
+	// such as "[CS][{{ lower .CSP }}][marked:{{ .Marked }}]", so that
+	// mails can be triaged by inbox rules. See subjectData for the
+	// variables.
+	SubjectBadge string
+	// CreatorLookup enables looking up the creator of resources in
+	// shared accounts in CloudTrail, so that they are reported to
+	// their creator instead of the account owner
+	CreatorLookup bool
+	// Organization is used to find the employees behind principals,
+	// and which accounts are shared. It's required by CreatorLookup.
+	Organization *cs.Organization
+	// Plan makes the Client collect the mails it would send, see
+	// PlannedMails, instead of sending them
+	Plan bool
+	// MinResourcesPerType is the minimum amount of resources of a type,
+	// such as "snapshot", for them to be included in the review sent to
+	// an owner. They are always included in manager and org reviews.
+	MinResourcesPerType map[string]int
+	// DashboardURL is where the dashboards are served, see package
+	// dashboard. The reviews link to them if it's set.
+	DashboardURL string
+	// Order is how resources are ordered in mails. The empty order is
+	// OrderByCost.
+	Order MailOrder
+	// HoldQueue makes the Client hold mails in the queue instead of
+	// sending them, until they're reviewed and sent with ReleaseHeldMails
+	HoldQueue MailQueue
+	// Policy holds the thresholds in effect, by name such as
+	// "notify-instances-older-than-days". Reviews, warnings and dry runs
+	// describe them in an appendix, stamped with their PolicyHash.
+	Policy map[string]int
+	// Output writes every report in a machine-readable format, in
+	// addition to sending it. If OutputOnly is set, no mails are sent.
+	Output     *ReportOutput
+	OutputOnly bool
+	// Runbooks are remediation guidance, HTML fragments, shown in reviews
+	// and warnings for each type of resource in them, such as how to
+	// archive a bucket. See LoadRunbooks and GeneralRunbook.
+	Runbooks map[string]template.HTML
 }
 
+// ReviewResourceTypes are the types of resources included in reviews
+var ReviewResourceTypes = []string{"instance", "image", "volume", "snapshot", "bucket", "table", "cache-cluster", "network-gateway", "capacity", "db-instance", "db-snapshot"}
+
 // Init will initialize a notify Client with a given Config
 func Init(config *Config) *Client {
 	return &Client{config: config}
 }
 
 type resourceMailData struct {
-	Owner          string
-	OwnerID        string
-	Instances      []cloud.Instance
-	Images         []cloud.Image
-	Snapshots      []cloud.Snapshot
-	Volumes        []cloud.Volume
-	Buckets        []cloud.Bucket
-	HoursInAdvance int
+	Owner         string
+	OwnerID       string
+	Instances     []cloud.Instance
+	Images        []cloud.Image
+	Snapshots     []cloud.Snapshot
+	Volumes       []cloud.Volume
+	Buckets       []cloud.Bucket
+	Tables        []cloud.Table
+	CacheClusters []cloud.CacheCluster
+	Addresses     []cloud.Address
+	// NetworkGateways are NAT gateways and interface VPC endpoints
+	NetworkGateways []cloud.NetworkGateway
+	// Capacities are dedicated hosts and capacity reservations
+	Capacities []cloud.Capacity
+	// DBInstances and DBSnapshots are managed databases, such as RDS
+	// instances, and their manual snapshots
+	DBInstances []cloud.DBInstance
+	DBSnapshots []cloud.DBSnapshot
+	// InUseVolumes and InUseSnapshots are old storage that is still in
+	// use. They're only informational, and not counted as resources.
+	InUseVolumes   []cloud.Volume
+	InUseSnapshots []cloud.Snapshot
+	// Databases are instances detected as databases, see
+	// filter.IsDatabase. They're also only informational.
+	Databases []cloud.Instance
+	// MaxLifetimeExceeded are resources past their maximum lifetime, see
+	// filter.MaxLifetimeDays, which are listed in a section of their own
+	MaxLifetimeExceeded []cloud.Resource
+	HoursInAdvance      int
+	// Reminder is which of the ReminderCount reminders a warning is, and
+	// NextReminderHours the lead time of the next one, 0 for the last
+	Reminder          int
+	ReminderCount     int
+	NextReminderHours int
+	// MarkingOrder lists resources in the order they are marked
+	MarkingOrder []cloud.Resource
+
+	// Reports holds the mail data of each owner in a rollup
+	Reports []*resourceMailData
+	// GroupByOwner lists the resources of a rollup under a header
+	// for each owner, instead of in a single list
+	GroupByOwner bool
+	Rollup       RollupStyle
+	// TopResources are the most expensive resources, used by RollupTop
+	TopResources []cloud.Resource
+	// Teams are the subtotals of the teams in a rollup to a skip-level
+	// manager, see addTeamSubtotal
+	Teams []*teamSubtotal
+	// ProbableOwners are guesses of who owns untagged resources, by
+	// resource ID, see probableOwners
+	ProbableOwners map[string]string
+	// TagConflicts are conflicting or duplicate Cloudsweeper tags, which
+	// are listed in the org review
+	TagConflicts []*filter.TagConflict
+	// DashboardURL links to the dashboard of the resources in the mail
+	DashboardURL string
+	// AttachedVolumes are the volumes attached to the instances, by
+	// instance ID, see attachVolumes
+	AttachedVolumes map[string][]cloud.Volume
+	// PartialScans are the regions that could not be scanned, by the
+	// accounts in the mail with partial data, see markPartial
+	PartialScans map[string][]string
+	// Policy and PolicyHash are the thresholds the mail was made with,
+	// see PolicyFor
+	Policy     map[string]int
+	PolicyHash string
+	// Runbooks are the remediation guidance of the mail, by resource
+	// type, see Config.Runbooks
+	Runbooks map[string]template.HTML
+	// CSP is the CSP of the resources in a review, and Sections are the
+	// reviews of an owner merged into one mail, see mergeReviews
+	CSP      cloud.CSP
+	Sections []*resourceMailData
 }
 
 func (d *resourceMailData) ResourceCount() int {
-	return len(d.Images) + len(d.Instances) + len(d.Snapshots) + len(d.Volumes) + len(d.Buckets)
+	return len(d.Images) + len(d.Instances) + len(d.Snapshots) + len(d.Volumes) + len(d.Buckets) + len(d.Tables) + len(d.CacheClusters) + len(d.Addresses) + len(d.NetworkGateways) + len(d.Capacities) + len(d.DBInstances) + len(d.DBSnapshots)
+}
+
+// allResources returns all resources in the mail data, the most
+// expensive first
+func (d *resourceMailData) allResources() []cloud.Resource {
+	return markingOrder(&cloud.AllResourceCollection{
+		Instances:       d.Instances,
+		Images:          d.Images,
+		Snapshots:       d.Snapshots,
+		Volumes:         d.Volumes,
+		Buckets:         d.Buckets,
+		Tables:          d.Tables,
+		CacheClusters:   d.CacheClusters,
+		Addresses:       d.Addresses,
+		NetworkGateways: d.NetworkGateways,
+		Capacities:      d.Capacities,
+		DBInstances:     d.DBInstances,
+		DBSnapshots:     d.DBSnapshots,
+	})
+}
+
+// DataSizeGB returns the size of the data stored in all resources, see
+// cloud.DataSizeGB
+func (d *resourceMailData) DataSizeGB() float64 {
+	return cloud.CollectionDataSizeGB(&cloud.AllResourceCollection{
+		Volumes:     d.Volumes,
+		Snapshots:   d.Snapshots,
+		Buckets:     d.Buckets,
+		Tables:      d.Tables,
+		DBSnapshots: d.DBSnapshots,
+	})
+}
+
+// attachVolumes remembers which of the volumes are attached to which
+// instances, so that the cost of their storage is shown next to the
+// instances. Volumes list the instances they are attached to in their
+// lineage.
+func (d *resourceMailData) attachVolumes(volumes []cloud.Volume) {
+	if d.AttachedVolumes == nil {
+		d.AttachedVolumes = make(map[string][]cloud.Volume)
+	}
+	for _, vol := range volumes {
+		if !vol.Attached() {
+			continue
+		}
+		for _, id := range vol.Lineage() {
+			d.AttachedVolumes[id] = append(d.AttachedVolumes[id], vol)
+		}
+	}
+}
+
+// markPartial records that the data of an account in the mail is partial,
+// if some of its regions could not be scanned
+func (d *resourceMailData) markPartial(status *cloud.ScanStatus, account string) {
+	if !status.Partial(account) {
+		return
+	}
+	if d.PartialScans == nil {
+		d.PartialScans = make(map[string][]string)
+	}
+	d.PartialScans[account] = status.FailedRegions(account)
+}
+
+// findMaxLifetimeExceeded lists the resources of the mail that are past
+// their maximum lifetime, so owners see why they were marked even if they
+// were whitelisted
+func (d *resourceMailData) findMaxLifetimeExceeded() {
+	d.MaxLifetimeExceeded = []cloud.Resource{}
+	for _, res := range d.allResources() {
+		if filter.MaxLifetimeExceeded(0)(res) {
+			d.MaxLifetimeExceeded = append(d.MaxLifetimeExceeded, res)
+		}
+	}
+}
+
+// StorageCost returns the accumulated cost of the volumes attached to an
+// instance, which isn't included in the cost of the instance itself
+func (d *resourceMailData) StorageCost(instance cloud.Instance) float64 {
+	total := 0.0
+	for _, vol := range d.AttachedVolumes[instance.ID()] {
+		total += accumulatedCost(vol)
+	}
+	return total
+}
+
+// TotalCost returns the accumulated cost of all resources
+func (d *resourceMailData) TotalCost() float64 {
+	total := 0.0
+	for _, res := range d.allResources() {
+		total += billing.AccumulatedCost(res)
+	}
+	return total
+}
+
+// withBadges adds the number of marked resources and the estimated monthly
+// cost of the resources to the subject data of the mail. The CSP is taken
+// from the resources if it's not set.
+func (d *resourceMailData) withBadges(data subjectData) subjectData {
+	for _, res := range d.allResources() {
+		if data.CSP == "" {
+			data.CSP = res.CSP()
+		}
+		if _, marked := res.Tags()[filter.DeleteTagKey]; marked {
+			data.Marked++
+		}
+		data.CostPerMonth += costPerMonth(res)
+	}
+	return data
+}
+
+// withMinimumCounts returns a copy of the mail data without the types of
+// resources that are fewer than their minimum in minPerType
+func (d *resourceMailData) withMinimumCounts(minPerType map[string]int) *resourceMailData {
+	result := *d
+	if len(d.Instances) < minPerType["instance"] {
+		result.Instances = []cloud.Instance{}
+	}
+	if len(d.Images) < minPerType["image"] {
+		result.Images = []cloud.Image{}
+	}
+	if len(d.Volumes) < minPerType["volume"] {
+		result.Volumes = []cloud.Volume{}
+	}
+	if len(d.Snapshots) < minPerType["snapshot"] {
+		result.Snapshots = []cloud.Snapshot{}
+	}
+	if len(d.Buckets) < minPerType["bucket"] {
+		result.Buckets = []cloud.Bucket{}
+	}
+	if len(d.Tables) < minPerType["table"] {
+		result.Tables = []cloud.Table{}
+	}
+	if len(d.CacheClusters) < minPerType["cache-cluster"] {
+		result.CacheClusters = []cloud.CacheCluster{}
+	}
+	if len(d.NetworkGateways) < minPerType["network-gateway"] {
+		result.NetworkGateways = []cloud.NetworkGateway{}
+	}
+	if len(d.Capacities) < minPerType["capacity"] {
+		result.Capacities = []cloud.Capacity{}
+	}
+	if len(d.DBInstances) < minPerType["db-instance"] {
+		result.DBInstances = []cloud.DBInstance{}
+	}
+	if len(d.DBSnapshots) < minPerType["db-snapshot"] {
+		result.DBSnapshots = []cloud.DBSnapshot{}
+	}
+	return &result
+}
+
+// applyRollup sets the style used to list the resources of the rollup
+// teamSubtotal is the amount and cost of the old resources of a team, by
+// the username of the team's manager
+type teamSubtotal struct {
+	Manager       string
+	ResourceCount int
+	TotalCost     float64
+}
+
+// addTeamSubtotal adds the resources of an owner to the subtotal of their
+// team, which is led by the specified manager
+func (d *resourceMailData) addTeamSubtotal(manager string, report *resourceMailData) {
+	var team *teamSubtotal
+	for _, subtotal := range d.Teams {
+		if subtotal.Manager == manager {
+			team = subtotal
+		}
+	}
+	if team == nil {
+		team = &teamSubtotal{Manager: manager}
+		d.Teams = append(d.Teams, team)
+	}
+	team.ResourceCount += report.ResourceCount()
+	team.TotalCost += report.TotalCost()
+}
+
+// managerChain returns the managers the resources of an employee are
+// rolled up to, starting with their own manager, at most depth of them
+func managerChain(employee *cs.Employee, depth int) []*cs.Employee {
+	chain := []*cs.Employee{}
+	if employee == nil {
+		return chain
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	seen := make(map[string]bool)
+	for manager := employee.Manager; manager != nil && len(chain) < depth && !seen[manager.Username]; manager = manager.Manager {
+		seen[manager.Username] = true
+		chain = append(chain, manager)
+	}
+	return chain
+}
+
+func (d *resourceMailData) applyRollup(style RollupStyle, topN int) {
+	if style == "" {
+		style = RollupFull
+	}
+	d.Rollup = style
+	if style == RollupTop {
+		d.TopResources = d.allResources()
+		if len(d.TopResources) > topN {
+			d.TopResources = d.TopResources[:topN]
+		}
+	}
+	costs := make(map[*resourceMailData]float64, len(d.Reports))
+	for _, report := range d.Reports {
+		costs[report] = report.TotalCost()
+	}
+	sort.SliceStable(d.Reports, func(i, j int) bool {
+		return costs[d.Reports[i]] > costs[d.Reports[j]]
+	})
+	sort.SliceStable(d.Teams, func(i, j int) bool {
+		return d.Teams[i].TotalCost > d.Teams[j].TotalCost
+	})
 }
 
 func (d *resourceMailData) SortByCost() {
 	sort.Slice(d.Instances, func(i, j int) bool {
-		return accumulatedCost(d.Instances[i]) > accumulatedCost(d.Instances[j])
+		return moreExpensive(d.Instances[i], d.Instances[j], accumulatedCost)
 	})
 	sort.Slice(d.Images, func(i, j int) bool {
-		return accumulatedCost(d.Images[i]) > accumulatedCost(d.Images[j])
+		return moreExpensive(d.Images[i], d.Images[j], accumulatedCost)
 	})
 	sort.Slice(d.Snapshots, func(i, j int) bool {
-		return accumulatedCost(d.Snapshots[i]) > accumulatedCost(d.Snapshots[j])
+		return moreExpensive(d.Snapshots[i], d.Snapshots[j], accumulatedCost)
 	})
 	sort.Slice(d.Volumes, func(i, j int) bool {
-		return accumulatedCost(d.Volumes[i]) > accumulatedCost(d.Volumes[j])
+		return moreExpensive(d.Volumes[i], d.Volumes[j], accumulatedCost)
 	})
 	sort.Slice(d.Buckets, func(i, j int) bool {
-		return billing.BucketPricePerMonth(d.Buckets[i]) > billing.BucketPricePerMonth(d.Buckets[j])
+		return moreExpensive(d.Buckets[i], d.Buckets[j], bucketCost)
+	})
+	sort.Slice(d.Tables, func(i, j int) bool {
+		return moreExpensive(d.Tables[i], d.Tables[j], accumulatedCost)
+	})
+	sort.Slice(d.CacheClusters, func(i, j int) bool {
+		return moreExpensive(d.CacheClusters[i], d.CacheClusters[j], accumulatedCost)
+	})
+	sort.Slice(d.Addresses, func(i, j int) bool {
+		return moreExpensive(d.Addresses[i], d.Addresses[j], accumulatedCost)
+	})
+	sort.Slice(d.NetworkGateways, func(i, j int) bool {
+		return moreExpensive(d.NetworkGateways[i], d.NetworkGateways[j], accumulatedCost)
+	})
+	sort.Slice(d.Capacities, func(i, j int) bool {
+		return moreExpensive(d.Capacities[i], d.Capacities[j], accumulatedCost)
+	})
+	sort.Slice(d.DBInstances, func(i, j int) bool {
+		return moreExpensive(d.DBInstances[i], d.DBInstances[j], accumulatedCost)
+	})
+	sort.Slice(d.DBSnapshots, func(i, j int) bool {
+		return moreExpensive(d.DBSnapshots[i], d.DBSnapshots[j], accumulatedCost)
+	})
+	sort.Slice(d.InUseVolumes, func(i, j int) bool {
+		return moreExpensive(d.InUseVolumes[i], d.InUseVolumes[j], accumulatedCost)
 	})
+	sort.Slice(d.InUseSnapshots, func(i, j int) bool {
+		return moreExpensive(d.InUseSnapshots[i], d.InUseSnapshots[j], accumulatedCost)
+	})
+}
+
+// SortBySize orders volumes, snapshots, images, buckets, tables and
+// database snapshots by their size, the largest first
+func (d *resourceMailData) SortBySize() {
+	sort.Slice(d.Images, func(i, j int) bool {
+		return moreExpensive(d.Images[i], d.Images[j], sizeGB)
+	})
+	sort.Slice(d.Snapshots, func(i, j int) bool {
+		return moreExpensive(d.Snapshots[i], d.Snapshots[j], sizeGB)
+	})
+	sort.Slice(d.Volumes, func(i, j int) bool {
+		return moreExpensive(d.Volumes[i], d.Volumes[j], sizeGB)
+	})
+	sort.Slice(d.Buckets, func(i, j int) bool {
+		return moreExpensive(d.Buckets[i], d.Buckets[j], sizeGB)
+	})
+	sort.Slice(d.Tables, func(i, j int) bool {
+		return moreExpensive(d.Tables[i], d.Tables[j], sizeGB)
+	})
+	sort.Slice(d.DBSnapshots, func(i, j int) bool {
+		return moreExpensive(d.DBSnapshots[i], d.DBSnapshots[j], sizeGB)
+	})
+}
+
+// sizeGB is the size of a resource, including images unlike
+// cloud.DataSizeGB
+func sizeGB(res cloud.Resource) float64 {
+	if image, ok := res.(cloud.Image); ok {
+		return float64(image.SizeGB())
+	}
+	return cloud.DataSizeGB(res)
+}
+
+// moreExpensive reports whether a resource costs more than another one,
+// or is larger than it when used with sizeGB.
+// Resources with equal cost are ordered by account and ID if cloud.Ordered
+// is set, so that mails are identical between runs.
+func moreExpensive(a, b cloud.Resource, cost func(cloud.Resource) float64) bool {
+	costA, costB := cost(a), cost(b)
+	if costA != costB || !cloud.Ordered {
+		return costA > costB
+	}
+	return cloud.ResourceLess(a, b)
 }
 
-func (d *resourceMailData) SendEmail(client mailer.Client, domain, mailTemplate, title string, debugAddressees ...string) {
-	// Always sort by cost
-	d.SortByCost()
+func bucketCost(res cloud.Resource) float64 {
+	return billing.BucketPricePerMonth(res.(cloud.Bucket))
+}
+
+// SendEmail sends the mail to its owner, and returns false if it wasn't
+// sent, since it has no addressee or was a duplicate
+func (d *resourceMailData) SendEmail(c *Client, mail, mailTemplate, title string, debugAddressees ...string) bool {
+	if d.Owner == "" {
+		log.Printf("Not sending %q, since it has no addressee\n", title)
+		return false
+	}
+
+	// Always sort by cost, and then by size if configured
+	for _, data := range append([]*resourceMailData{d}, d.Sections...) {
+		data.SortByCost()
+		if c.config.Order == OrderBySize {
+			data.SortBySize()
+		}
+	}
+	if c.config.Policy != nil {
+		d.Policy = c.config.Policy
+		d.PolicyHash = PolicyHash(c.config.Policy)
+	}
+	d.Runbooks = c.config.Runbooks
 
 	mailContent, err := generateMail(d, mailTemplate)
 	if err != nil {
 		log.Fatalln("Could not generate email:", err)
 	}
 
-	ownerMail := fmt.Sprintf("%s@%s", d.Owner, domain)
+	settings := c.mailSettings(d.Owner, d.OwnerID)
+	ownerMail := c.emailForUser(d.Owner, settings)
 	recieverMail := convertEmailExceptions(ownerMail)
+	if c.outputReport(mailContent, resourceRecords(mail, recieverMail, d.allResources())) {
+		return false
+	}
+	if c.isDuplicateMail(recieverMail, mailTemplate, title, mailContent) {
+		return false
+	}
 	log.Printf("Sending out email to %s\n", recieverMail)
 	addressees := append(debugAddressees, recieverMail)
-	err = client.SendEmail(title, mailContent, addressees...)
+	err = c.deliverMail(settings, title, mailContent, addressees...)
 	if err != nil {
 		log.Fatalf("Failed to email %s: %s\n", recieverMail, err)
 	}
+	c.recordMail(recieverMail, mailTemplate, mailContent)
+	return true
 }
 
 type monthToDateData struct {
@@ -111,16 +636,112 @@ type monthToDateData struct {
 	MinimumTotalCost float64
 	MinimumCost      float64
 	AccountToUser    map[string]string
+	Departments      billing.UserList
+}
+
+// markingOrder returns all resources in a collection in the order they
+// are prioritized when marking, the most expensive first.
+func markingOrder(resources *cloud.AllResourceCollection) []cloud.Resource {
+	order := []cloud.Resource{}
+	for _, res := range resources.Instances {
+		order = append(order, res)
+	}
+	for _, res := range resources.Images {
+		order = append(order, res)
+	}
+	for _, res := range resources.Volumes {
+		order = append(order, res)
+	}
+	for _, res := range resources.Snapshots {
+		order = append(order, res)
+	}
+	for _, res := range resources.Buckets {
+		order = append(order, res)
+	}
+	for _, res := range resources.Tables {
+		order = append(order, res)
+	}
+	for _, res := range resources.CacheClusters {
+		order = append(order, res)
+	}
+	for _, res := range resources.Addresses {
+		order = append(order, res)
+	}
+	for _, res := range resources.NetworkGateways {
+		order = append(order, res)
+	}
+	for _, res := range resources.Capacities {
+		order = append(order, res)
+	}
+	for _, res := range resources.DBInstances {
+		order = append(order, res)
+	}
+	for _, res := range resources.DBSnapshots {
+		order = append(order, res)
+	}
+	billing.SortByAccumulatedCost(order)
+	return order
+}
+
+// accountTagConflicts returns the tag conflicts of all resources in the
+// collection, see filter.TagConflicts
+func accountTagConflicts(resources *cloud.AllResourceCollection) []*filter.TagConflict {
+	all := []cloud.Resource{}
+	for _, res := range resources.Instances {
+		all = append(all, res)
+	}
+	for _, res := range resources.Images {
+		all = append(all, res)
+	}
+	for _, res := range resources.Volumes {
+		all = append(all, res)
+	}
+	for _, res := range resources.Snapshots {
+		all = append(all, res)
+	}
+	for _, res := range resources.Buckets {
+		all = append(all, res)
+	}
+	for _, res := range resources.Tables {
+		all = append(all, res)
+	}
+	for _, res := range resources.CacheClusters {
+		all = append(all, res)
+	}
+	for _, res := range resources.NetworkGateways {
+		all = append(all, res)
+	}
+	for _, res := range resources.Capacities {
+		all = append(all, res)
+	}
+	for _, res := range resources.DBInstances {
+		all = append(all, res)
+	}
+	for _, res := range resources.DBSnapshots {
+		all = append(all, res)
+	}
+	conflicts := []*filter.TagConflict{}
+	for _, res := range all {
+		conflicts = append(conflicts, filter.TagConflicts(res)...)
+	}
+	return conflicts
 }
 
 func initTotalSummaryMailData(totalSumAddressee string) *resourceMailData {
 	return &resourceMailData{
-		Owner:     totalSumAddressee,
-		Instances: []cloud.Instance{},
-		Images:    []cloud.Image{},
-		Snapshots: []cloud.Snapshot{},
-		Volumes:   []cloud.Volume{},
-		Buckets:   []cloud.Bucket{},
+		Owner:           totalSumAddressee,
+		Instances:       []cloud.Instance{},
+		Images:          []cloud.Image{},
+		Snapshots:       []cloud.Snapshot{},
+		Volumes:         []cloud.Volume{},
+		Buckets:         []cloud.Bucket{},
+		Tables:          []cloud.Table{},
+		CacheClusters:   []cloud.CacheCluster{},
+		Addresses:       []cloud.Address{},
+		NetworkGateways: []cloud.NetworkGateway{},
+		Capacities:      []cloud.Capacity{},
+		DBInstances:     []cloud.DBInstance{},
+		DBSnapshots:     []cloud.DBSnapshot{},
 	}
 }
 
@@ -128,17 +749,34 @@ func initManagerToMailDataMapping(managers cs.Employees) map[string]*resourceMai
 	result := make(map[string]*resourceMailData)
 	for _, manager := range managers {
 		result[manager.Username] = &resourceMailData{
-			Owner:     manager.Username,
-			Instances: []cloud.Instance{},
-			Images:    []cloud.Image{},
-			Snapshots: []cloud.Snapshot{},
-			Volumes:   []cloud.Volume{},
-			Buckets:   []cloud.Bucket{},
+			Owner:           manager.Username,
+			Instances:       []cloud.Instance{},
+			Images:          []cloud.Image{},
+			Snapshots:       []cloud.Snapshot{},
+			Volumes:         []cloud.Volume{},
+			Buckets:         []cloud.Bucket{},
+			Tables:          []cloud.Table{},
+			CacheClusters:   []cloud.CacheCluster{},
+			Addresses:       []cloud.Address{},
+			NetworkGateways: []cloud.NetworkGateway{},
+			Capacities:      []cloud.Capacity{},
+			DBInstances:     []cloud.DBInstance{},
+			DBSnapshots:     []cloud.DBSnapshot{},
 		}
 	}
 	return result
 }
 
+// cancelled returns true if ctx is done, in which case the mails of a
+// report are not sent, since the resources may only be partially listed
+func cancelled(ctx context.Context, report string) bool {
+	if err := ctx.Err(); err != nil {
+		log.Printf("Not sending %s mails: %s\n", report, err)
+		return true
+	}
+	return false
+}
+
 // OldResourceReview will review (but not do any cleanup action) old resources
 // that an owner might want to consider doing something about. The owner is then
 // sent an email with a list of these resources. Resources are sent for review
@@ -146,13 +784,30 @@ func initManagerToMailDataMapping(managers cs.Employees) map[string]*resourceMai
 //		- Resource is older than 30 days
 //		- A whitelisted resource is older than 6 months
 //		- An instance marked with do-not-delete is older than a week
-func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organization, csp cloud.CSP, thresholds map[string]int) {
-	allCompute := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
-	accountUserMapping := org.AccountToUserMapping(csp)
+//		- A table or cache cluster has not been used within 30 days
+//		- A NAT gateway or VPC endpoint has had no traffic within 30 days
+//		- A dedicated host or capacity reservation is older than a week
+//		- A database has not been used within 14 days, or is stopped
+//		- A database snapshot is older than 30 days
+// Old volumes and snapshots that are in use can also be listed, but only as
+// information, since they can't be cleaned up. The resources of every CSP
+// with a manager are reviewed together, and owners with accounts in
+// several of them get one mail with a section per account.
+func (c *Client) OldResourceReview(ctx context.Context, mngrs map[cloud.CSP]cloud.ResourceManager, org *cs.Organization, thresholds map[string]int) {
+	defer c.logSuppressedMail()
+	csps := []cloud.CSP{}
+	for csp := range mngrs {
+		csps = append(csps, csp)
+	}
+	sort.Slice(csps, func(i, j int) bool { return csps[i] < csps[j] })
 	userEmployeeMapping := org.UsernameToEmployeeMapping()
 	totalSummaryMailData := initTotalSummaryMailData(c.config.TotalSumAddresse)
 	managerToMailDataMapping := initManagerToMailDataMapping(org.Managers)
+	accountSummaries := make(map[cloud.CSP]map[string]*accountSummary)
+
+	// The reviews of each owner, who are in the order of their first account
+	owners := []string{}
+	ownerReviews := make(map[string][]*resourceMailData)
 
 	getThreshold := func(key string, thresholds map[string]int) int {
 		threshold, found := thresholds[key]
@@ -179,9 +834,49 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 	snapshotFilter := filter.New()
 	snapshotFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-snapshots-older-than-days", thresholds)))
 
+	// Old storage that is in use is listed separately, since it can't be
+	// cleaned up as long as it's used
+	inUseDays := getThreshold("notify-in-use-storage-older-than-days", thresholds)
+	inUseVolumeFilter := filter.New()
+	inUseVolumeFilter.AddVolumeRule(filter.IsAttached())
+	inUseVolumeFilter.AddGeneralRule(filter.OlderThanXDays(inUseDays))
+	inUseSnapshotFilter := filter.New()
+	inUseSnapshotFilter.AddSnapshotRule(filter.IsInUse())
+	inUseSnapshotFilter.AddGeneralRule(filter.OlderThanXDays(inUseDays))
+	if inUseDays > 0 {
+		snapshotFilter.AddSnapshotRule(filter.IsNotInUse())
+	}
+
 	bucketFilter := filter.New()
 	bucketFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-buckets-older-than-days", thresholds)))
 
+	tableFilter := filter.New()
+	tableFilter.AddTableRule(filter.TableNotUsedInXDays(getThreshold("notify-tables-idle-days", thresholds)))
+
+	cacheClusterFilter := filter.New()
+	cacheClusterFilter.AddCacheClusterRule(filter.CacheClusterNotUsedInXDays(getThreshold("notify-cache-clusters-idle-days", thresholds)))
+
+	// Reserved addresses are charged for as long as they're not in use
+	addressFilter := filter.New()
+	addressFilter.AddAddressRule(filter.AddressNotInUse())
+	addressFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-unused-addresses-older-than-days", thresholds)))
+
+	gatewayFilter := filter.New()
+	gatewayFilter.AddNetworkGatewayRule(filter.NetworkGatewayNotUsedInXDays(getThreshold("notify-network-gateways-idle-days", thresholds)))
+
+	capacityFilter := filter.New()
+	capacityFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-capacities-older-than-days", thresholds)))
+
+	// Stopped databases are still charged for their storage, and are
+	// started again by AWS after a week
+	dbInstanceFilter := filter.New()
+	dbInstanceFilter.AddDBInstanceRule(filter.DBInstanceNotUsedInXDays(getThreshold("notify-db-instances-idle-days", thresholds)))
+	dbStoppedFilter := filter.New()
+	dbStoppedFilter.AddDBInstanceRule(filter.DBInstanceStopped())
+
+	dbSnapshotFilter := filter.New()
+	dbSnapshotFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-db-snapshots-older-than-days", thresholds)))
+
 	whitelistFilter := filter.New()
 	whitelistFilter.OverrideWhitelist = true
 	whitelistFilter.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-whitelist-older-than-days", thresholds)))
@@ -201,70 +896,323 @@ func (c *Client) OldResourceReview(mngr cloud.ResourceManager, org *cs.Organizat
 	dndFilter2.AddGeneralRule(filter.NameContains("do-not-delete"))
 	dndFilter2.AddGeneralRule(filter.OlderThanXDays(getThreshold("notify-dnd-older-than-days", thresholds)))
 
-	for account, resources := range allCompute {
-		log.Println("Performing old resource review in", account)
-		username := accountUserMapping[account]
-		employee := userEmployeeMapping[username]
+	instanceFilters := []*filter.ResourceFilter{instanceFilter, whitelistFilter, dndFilter, dndFilter2, untaggedFilter}
 
-		// Apply filters
-		userMailData := resourceMailData{
-			Owner:     username,
-			Instances: filter.Instances(resources.Instances, instanceFilter, whitelistFilter, dndFilter, dndFilter2, untaggedFilter),
-			Images:    filter.Images(resources.Images, imageFilter, whitelistFilter, untaggedFilter),
-			Volumes:   filter.Volumes(resources.Volumes, volumeFilter, whitelistFilter, untaggedFilter),
-			Snapshots: filter.Snapshots(resources.Snapshots, snapshotFilter, whitelistFilter, untaggedFilter),
-			Buckets:   []cloud.Bucket{},
-		}
-		if buckets, ok := allBuckets[account]; ok {
-			userMailData.Buckets = filter.Buckets(buckets, bucketFilter, whitelistFilter, untaggedFilter)
-		}
+	// Public instances pay for their IPv4 address even if nothing uses it
+	if days := getThreshold("notify-public-instances-idle-days", thresholds); days > 0 {
+		publicInstanceFilter := filter.New()
+		publicInstanceFilter.AddInstanceRule(filter.PublicWithoutInboundTrafficInXDays(days))
+		instanceFilters = append(instanceFilters, publicInstanceFilter)
+	}
 
-		// Add to the manager summary
-		if managerSummaryMailData, ok := managerToMailDataMapping[employee.Manager.Username]; ok { // safe or org _should_ have thrown an error
-			managerSummaryMailData.Instances = append(managerSummaryMailData.Instances, userMailData.Instances...)
-			managerSummaryMailData.Images = append(managerSummaryMailData.Images, userMailData.Images...)
-			managerSummaryMailData.Snapshots = append(managerSummaryMailData.Snapshots, userMailData.Snapshots...)
-			managerSummaryMailData.Volumes = append(managerSummaryMailData.Volumes, userMailData.Volumes...)
-			managerSummaryMailData.Buckets = append(managerSummaryMailData.Buckets, userMailData.Buckets...)
-		} else {
-			log.Fatalf("%s is not a manager??? Verify `organization.go` and the org repo itself for issues", employee.Manager.Username)
+	// Databases are listed separately, since they're never marked unless
+	// the cleanup policy opts in to it
+	databaseFilter := filter.New()
+	databaseFilter.AddInstanceRule(filter.IsDatabase())
+
+	// Resources past their maximum lifetime are listed separately too, since
+	// they're marked even if whitelisted, once the grace days have passed
+	maxLifetimeFilter := filter.New()
+	maxLifetimeFilter.OverrideWhitelist = true
+	maxLifetimeFilter.AddGeneralRule(filter.MaxLifetimeExceeded(0))
+	maxLifetimeFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+	maxLifetimeFilter.AddGeneralRule(filter.Negate(filter.TaggedForStop()))
+
+	// Owners with fewer resources only get them in the manager and org reviews
+	minResourcesPerMail := getThreshold("notify-min-resources-per-email", thresholds)
+
+	for _, csp := range csps {
+		mngr := mngrs[csp]
+		allCompute := mngr.AllResourcesPerAccount(ctx)
+		billing.PrefetchCollectionPrices(allCompute)
+		allBuckets := mngr.BucketsPerAccount(ctx)
+		allTables := mngr.TablesPerAccount(ctx)
+		allCacheClusters := mngr.CacheClustersPerAccount(ctx)
+		allAddresses := mngr.AddressesPerAccount(ctx)
+		allGateways := mngr.NetworkGatewaysPerAccount(ctx)
+		allCapacities := mngr.CapacitiesPerAccount(ctx)
+		allDBInstances := mngr.DBInstancesPerAccount(ctx)
+		allDBSnapshots := mngr.DBSnapshotsPerAccount(ctx)
+		if cancelled(ctx, "review") {
+			return
 		}
+		accountUserMapping := org.AccountToUserMapping(csp)
+		accountSummaries[csp] = make(map[string]*accountSummary)
+
+		for _, account := range cloud.Accounts(allCompute) {
+			resources := allCompute[account]
+			log.Println("Performing old resource review in", cloud.AccountName(account))
+			username := accountUserMapping[account]
+			employee := userEmployeeMapping[username]
 
-		// Add to the total summary
-		totalSummaryMailData.Instances = append(totalSummaryMailData.Instances, userMailData.Instances...)
-		totalSummaryMailData.Images = append(totalSummaryMailData.Images, userMailData.Images...)
-		totalSummaryMailData.Snapshots = append(totalSummaryMailData.Snapshots, userMailData.Snapshots...)
-		totalSummaryMailData.Volumes = append(totalSummaryMailData.Volumes, userMailData.Volumes...)
-		totalSummaryMailData.Buckets = append(totalSummaryMailData.Buckets, userMailData.Buckets...)
+			// Apply filters
+			userMailData := &resourceMailData{
+				Owner:           username,
+				OwnerID:         account,
+				Instances:       filter.Instances(resources.Instances, instanceFilters...),
+				Images:          filter.Images(resources.Images, imageFilter, whitelistFilter, untaggedFilter),
+				Volumes:         filter.Volumes(resources.Volumes, volumeFilter, whitelistFilter, untaggedFilter),
+				Snapshots:       filter.Snapshots(resources.Snapshots, snapshotFilter, whitelistFilter, untaggedFilter),
+				Buckets:         []cloud.Bucket{},
+				Tables:          filter.Tables(allTables[account], tableFilter, whitelistFilter),
+				CacheClusters:   filter.CacheClusters(allCacheClusters[account], cacheClusterFilter, whitelistFilter),
+				Addresses:       filter.Addresses(allAddresses[account], addressFilter, whitelistFilter),
+				NetworkGateways: filter.NetworkGateways(allGateways[account], gatewayFilter, whitelistFilter),
+				Capacities:      filter.Capacities(allCapacities[account], capacityFilter, whitelistFilter),
+				DBInstances:     filter.DBInstances(allDBInstances[account], dbInstanceFilter, dbStoppedFilter, whitelistFilter),
+				DBSnapshots:     filter.DBSnapshots(allDBSnapshots[account], dbSnapshotFilter, whitelistFilter, untaggedFilter),
+			}
+			if buckets, ok := allBuckets[account]; ok {
+				userMailData.Buckets = filter.Buckets(buckets, bucketFilter, whitelistFilter, untaggedFilter)
+			}
+			if inUseDays > 0 {
+				userMailData.InUseVolumes = filter.Volumes(resources.Volumes, inUseVolumeFilter)
+				userMailData.InUseSnapshots = filter.Snapshots(resources.Snapshots, inUseSnapshotFilter)
+			}
+			userMailData.Databases = filter.Instances(resources.Instances, databaseFilter)
+			userMailData.MaxLifetimeExceeded = markingOrder(&cloud.AllResourceCollection{
+				Instances:       filter.Instances(resources.Instances, maxLifetimeFilter),
+				Images:          filter.Images(resources.Images, maxLifetimeFilter),
+				Volumes:         filter.Volumes(resources.Volumes, maxLifetimeFilter),
+				Snapshots:       filter.Snapshots(resources.Snapshots, maxLifetimeFilter),
+				Buckets:         filter.Buckets(allBuckets[account], maxLifetimeFilter),
+				Tables:          filter.Tables(allTables[account], maxLifetimeFilter),
+				CacheClusters:   filter.CacheClusters(allCacheClusters[account], maxLifetimeFilter),
+				Addresses:       filter.Addresses(allAddresses[account], maxLifetimeFilter),
+				NetworkGateways: filter.NetworkGateways(allGateways[account], maxLifetimeFilter),
+				Capacities:      filter.Capacities(allCapacities[account], maxLifetimeFilter),
+				DBInstances:     filter.DBInstances(allDBInstances[account], maxLifetimeFilter),
+				DBSnapshots:     filter.DBSnapshots(allDBSnapshots[account], maxLifetimeFilter),
+			})
+			userMailData.DashboardURL = c.dashboardURL(dashboard.AccountPage(account))
+			userMailData.attachVolumes(resources.Volumes)
+			userMailData.markPartial(mngr.ScanStatus(), account)
 
-		if userMailData.ResourceCount() > 0 {
-			title := fmt.Sprintf("You have %d old resources to review (%s)", userMailData.ResourceCount(), time.Now().Format("2006-01-02"))
-			userMailData.SendEmail(getMailClient(c), c.config.EmailDomain, reviewMailTemplate, title)
+			// Add to the summaries of the managers, up to the rollup depth.
+			// Skip-level managers get a subtotal per team below them.
+			chain := managerChain(employee, c.config.RollupDepth)
+			if len(chain) == 0 {
+				log.Fatalf("%s has no manager??? Verify `organization.go` and the org repo itself for issues", username)
+			}
+			for level, manager := range chain {
+				managerSummaryMailData, ok := managerToMailDataMapping[manager.Username] // safe or org _should_ have thrown an error
+				if !ok {
+					log.Fatalf("%s is not a manager??? Verify `organization.go` and the org repo itself for issues", manager.Username)
+				}
+				managerSummaryMailData.Instances = append(managerSummaryMailData.Instances, userMailData.Instances...)
+				managerSummaryMailData.Images = append(managerSummaryMailData.Images, userMailData.Images...)
+				managerSummaryMailData.Snapshots = append(managerSummaryMailData.Snapshots, userMailData.Snapshots...)
+				managerSummaryMailData.Volumes = append(managerSummaryMailData.Volumes, userMailData.Volumes...)
+				managerSummaryMailData.Buckets = append(managerSummaryMailData.Buckets, userMailData.Buckets...)
+				managerSummaryMailData.Tables = append(managerSummaryMailData.Tables, userMailData.Tables...)
+				managerSummaryMailData.CacheClusters = append(managerSummaryMailData.CacheClusters, userMailData.CacheClusters...)
+				managerSummaryMailData.NetworkGateways = append(managerSummaryMailData.NetworkGateways, userMailData.NetworkGateways...)
+				managerSummaryMailData.Capacities = append(managerSummaryMailData.Capacities, userMailData.Capacities...)
+				managerSummaryMailData.DBInstances = append(managerSummaryMailData.DBInstances, userMailData.DBInstances...)
+				managerSummaryMailData.DBSnapshots = append(managerSummaryMailData.DBSnapshots, userMailData.DBSnapshots...)
+				managerSummaryMailData.attachVolumes(resources.Volumes)
+				managerSummaryMailData.markPartial(mngr.ScanStatus(), account)
+				if userMailData.ResourceCount() > 0 {
+					managerSummaryMailData.Reports = append(managerSummaryMailData.Reports, userMailData)
+					team := manager.Username
+					if level > 0 {
+						team = chain[level-1].Username
+					}
+					managerSummaryMailData.addTeamSubtotal(team, userMailData)
+				}
+			}
+
+			// Add to the total summary
+			totalSummaryMailData.Instances = append(totalSummaryMailData.Instances, userMailData.Instances...)
+			totalSummaryMailData.Images = append(totalSummaryMailData.Images, userMailData.Images...)
+			totalSummaryMailData.Snapshots = append(totalSummaryMailData.Snapshots, userMailData.Snapshots...)
+			totalSummaryMailData.Volumes = append(totalSummaryMailData.Volumes, userMailData.Volumes...)
+			totalSummaryMailData.Buckets = append(totalSummaryMailData.Buckets, userMailData.Buckets...)
+			totalSummaryMailData.Tables = append(totalSummaryMailData.Tables, userMailData.Tables...)
+			totalSummaryMailData.CacheClusters = append(totalSummaryMailData.CacheClusters, userMailData.CacheClusters...)
+			totalSummaryMailData.NetworkGateways = append(totalSummaryMailData.NetworkGateways, userMailData.NetworkGateways...)
+			totalSummaryMailData.Capacities = append(totalSummaryMailData.Capacities, userMailData.Capacities...)
+			totalSummaryMailData.DBInstances = append(totalSummaryMailData.DBInstances, userMailData.DBInstances...)
+			totalSummaryMailData.DBSnapshots = append(totalSummaryMailData.DBSnapshots, userMailData.DBSnapshots...)
+			totalSummaryMailData.attachVolumes(resources.Volumes)
+			totalSummaryMailData.markPartial(mngr.ScanStatus(), account)
+			if userMailData.ResourceCount() > 0 {
+				totalSummaryMailData.Reports = append(totalSummaryMailData.Reports, userMailData)
+			}
+			totalSummaryMailData.TagConflicts = append(totalSummaryMailData.TagConflicts, accountTagConflicts(&cloud.AllResourceCollection{
+				Instances:       resources.Instances,
+				Images:          resources.Images,
+				Volumes:         resources.Volumes,
+				Snapshots:       resources.Snapshots,
+				Buckets:         allBuckets[account],
+				Tables:          allTables[account],
+				CacheClusters:   allCacheClusters[account],
+				NetworkGateways: allGateways[account],
+				Capacities:      allCapacities[account],
+				DBInstances:     allDBInstances[account],
+				DBSnapshots:     allDBSnapshots[account],
+			})...)
+
+			accountSummaries[csp][account] = summarizeAccount(account, resources, allBuckets[account], allTables[account], allCacheClusters[account], userMailData.ResourceCount())
+
+			for _, data := range c.splitByCreator(userMailData) {
+				data = data.withMinimumCounts(c.config.MinResourcesPerType)
+				data.CSP = csp
+				if _, exist := ownerReviews[data.Owner]; !exist {
+					owners = append(owners, data.Owner)
+				}
+				ownerReviews[data.Owner] = append(ownerReviews[data.Owner], data)
+			}
+		}
+	}
+
+	// Send out the reviews of the owners, merged across CSPs
+	for _, owner := range owners {
+		reviews := ownerReviews[owner]
+		if len(csps) > 1 {
+			reviews = []*resourceMailData{mergeReviews(owner, reviews)}
+		}
+		for _, data := range reviews {
+			c.sendReview(data, minResourcesPerMail)
 		}
 	}
 
 	// Send out manager emails
-	for username, managerSummaryMailData := range managerToMailDataMapping {
+	managers := []string{}
+	if c.config.ManagerRollup == RollupNone {
+		log.Println("Not sending reviews to managers, since they are disabled")
+		managerToMailDataMapping = map[string]*resourceMailData{}
+	}
+	for username := range managerToMailDataMapping {
+		managers = append(managers, username)
+	}
+	cloud.SortIDs(managers)
+	for _, username := range managers {
+		managerSummaryMailData := managerToMailDataMapping[username]
 		log.Printf("Collecting old resources to review for %s's team\n", username)
 		if managerSummaryMailData.ResourceCount() > 0 {
-			title := fmt.Sprintf("Your team has %d old resources to review (%s)", managerSummaryMailData.ResourceCount(), time.Now().Format("2006-01-02"))
-			managerSummaryMailData.SendEmail(getMailClient(c), c.config.EmailDomain, managerReviewMailTemplate, title)
+			managerSummaryMailData.GroupByOwner = true
+			managerSummaryMailData.DashboardURL = c.dashboardURL(dashboard.TeamPage(username))
+			managerSummaryMailData.applyRollup(c.config.ManagerRollup, c.config.RollupTopN)
+			title := c.subject(ManagerReviewMail, managerSummaryMailData.withBadges(subjectData{Count: managerSummaryMailData.ResourceCount(), Owner: username, CSP: joinCSPs(csps)}))
+			managerSummaryMailData.SendEmail(c, ManagerReviewMail, managerReviewMailTemplate, title)
 		}
 	}
 
+	// Send out account summaries to those who opted in
+	for _, csp := range csps {
+		c.sendAccountSummaries(org, csp, accountSummaries[csp])
+	}
+
 	// Send out a total summary
+	if c.config.OrgRollup == RollupNone {
+		log.Println("Not sending the review for the org, since it's disabled")
+		return
+	}
 	log.Println("Collecting old resource review for the org")
-	title := fmt.Sprintf("Your org has %d old resources to review (%s)", totalSummaryMailData.ResourceCount(), time.Now().Format("2006-01-02"))
-	totalSummaryMailData.SendEmail(getMailClient(c), c.config.EmailDomain, totalReviewMailTemplate, title)
+	totalSummaryMailData.applyRollup(c.config.OrgRollup, c.config.RollupTopN)
+	totalSummaryMailData.DashboardURL = c.dashboardURL(dashboard.IndexPage)
+	title := c.subject(OrgReviewMail, totalSummaryMailData.withBadges(subjectData{Count: totalSummaryMailData.ResourceCount(), Owner: totalSummaryMailData.Owner, CSP: joinCSPs(csps)}))
+	totalSummaryMailData.SendEmail(c, OrgReviewMail, totalReviewMailTemplate, title)
+}
+
+// sendReview sends a review to its owner, unless it has no resources or
+// fewer than minResources
+func (c *Client) sendReview(data *resourceMailData, minResources int) {
+	if data.ResourceCount() == 0 {
+		return
+	}
+	if data.ResourceCount() < minResources {
+		log.Printf("Not sending review to %s, since it only has %d resources", data.Owner, data.ResourceCount())
+		return
+	}
+	if len(data.Sections) > 0 {
+		title := c.subject(MergedReviewMail, data.withBadges(subjectData{Count: data.ResourceCount(), Owner: data.Owner, CSP: data.CSP}))
+		data.SendEmail(c, MergedReviewMail, mergedReviewMailTemplate, title)
+		return
+	}
+	title := c.subject(ReviewMail, data.withBadges(subjectData{Count: data.ResourceCount(), Account: data.OwnerID, Owner: data.Owner, CSP: data.CSP}))
+	data.SendEmail(c, ReviewMail, reviewMailTemplate, title)
+}
+
+// mergeReviews merges the reviews of an owner in several CSPs into one
+// mail, with a section for each review that has any resources. A single
+// review with resources is returned as is. The mail settings of the
+// merged mail are those of the account of the first section.
+func mergeReviews(owner string, reviews []*resourceMailData) *resourceMailData {
+	sections := []*resourceMailData{}
+	for _, review := range reviews {
+		if review.ResourceCount() > 0 {
+			sections = append(sections, review)
+		}
+	}
+	if len(sections) == 0 {
+		return reviews[0]
+	} else if len(sections) == 1 {
+		return sections[0]
+	}
+
+	merged := &resourceMailData{
+		Owner:    owner,
+		OwnerID:  sections[0].OwnerID,
+		Sections: sections,
+	}
+	csps := []cloud.CSP{}
+	for _, section := range sections {
+		if len(csps) == 0 || csps[len(csps)-1] != section.CSP {
+			csps = append(csps, section.CSP)
+		}
+		merged.Instances = append(merged.Instances, section.Instances...)
+		merged.Images = append(merged.Images, section.Images...)
+		merged.Snapshots = append(merged.Snapshots, section.Snapshots...)
+		merged.Volumes = append(merged.Volumes, section.Volumes...)
+		merged.Buckets = append(merged.Buckets, section.Buckets...)
+		merged.Tables = append(merged.Tables, section.Tables...)
+		merged.CacheClusters = append(merged.CacheClusters, section.CacheClusters...)
+		merged.Addresses = append(merged.Addresses, section.Addresses...)
+		merged.NetworkGateways = append(merged.NetworkGateways, section.NetworkGateways...)
+		merged.Capacities = append(merged.Capacities, section.Capacities...)
+		merged.DBInstances = append(merged.DBInstances, section.DBInstances...)
+		merged.DBSnapshots = append(merged.DBSnapshots, section.DBSnapshots...)
+		for account, regions := range section.PartialScans {
+			if merged.PartialScans == nil {
+				merged.PartialScans = make(map[string][]string)
+			}
+			merged.PartialScans[account] = regions
+		}
+	}
+	merged.CSP = joinCSPs(csps)
+	return merged
+}
+
+// joinCSPs names several CSPs as one, such as "AWS and GCP", for the
+// subjects of reviews across them
+func joinCSPs(csps []cloud.CSP) cloud.CSP {
+	names := []string{}
+	for _, csp := range csps {
+		names = append(names, string(csp))
+	}
+	if len(names) < 2 {
+		return cloud.CSP(strings.Join(names, ""))
+	}
+	return cloud.CSP(strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1])
 }
 
 // UntaggedResourcesReview will look for resources without any tags, and
 // send out a mail encouraging to tag tag them
-func (c *Client) UntaggedResourcesReview(mngr cloud.ResourceManager, accountUserMapping map[string]string) {
-	// We only care about untagged resources in EC2
-	allCompute := mngr.AllResourcesPerAccount()
-	for account, resources := range allCompute {
-		log.Printf("Performing untagged resources review in %s", account)
+func (c *Client) UntaggedResourcesReview(ctx context.Context, mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	// We only care about untagged resources in EC2, and addresses and
+	// gateways since they're charged for whether they're used or not
+	allCompute := mngr.AllResourcesPerAccount(ctx)
+	allAddresses := mngr.AddressesPerAccount(ctx)
+	allGateways := mngr.NetworkGatewaysPerAccount(ctx)
+	if cancelled(ctx, "untagged resources") {
+		return
+	}
+	for _, account := range cloud.Accounts(allCompute) {
+		resources := allCompute[account]
+		log.Printf("Performing untagged resources review in %s", cloud.AccountName(account))
 		untaggedFilter := filter.New()
 		untaggedFilter.AddGeneralRule(filter.IsUntaggedWithException("Name"))
 
@@ -276,100 +1224,310 @@ func (c *Client) UntaggedResourcesReview(mngr cloud.ResourceManager, accountUser
 			Owner:     username,
 			OwnerID:   account,
 			Instances: filter.Instances(resources.Instances, untaggedFilter),
-			// Only report on instances for now
+			// Only report on instances, addresses and gateways for now
 			//Images:    filter.Images(resources.Images, untaggedFilter),
 			//Snapshots: filter.Snapshots(resources.Snapshots, untaggedFilter),
 			//Volumes:   filter.Volumes(resources.Volumes, untaggedFilter),
-			Buckets: []cloud.Bucket{},
+			Buckets:         []cloud.Bucket{},
+			Addresses:       filter.Addresses(allAddresses[account], untaggedFilter),
+			NetworkGateways: filter.NetworkGateways(allGateways[account], untaggedFilter),
 		}
+		mailData.markPartial(mngr.ScanStatus(), account)
 
-		if mailData.ResourceCount() > 0 {
-			// Send mail
-			title := fmt.Sprintf("You have %d un-tagged resources to review (%s)", mailData.ResourceCount(), time.Now().Format("2006-01-02"))
-			// You can add some debug email address to ensure it works
-			// debugAddressees := []string{"ben@example.com"}
-			// mailData.SendEmail(getMailClient(c), c.config.EmailDomain, untaggedMailTemplate, title, debugAddressees...)
-			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, untaggedMailTemplate, title)
+		for _, data := range c.splitByCreator(&mailData) {
+			if data.ResourceCount() > 0 {
+				data.ProbableOwners = c.probableOwners(data.allResources())
+				// Send mail
+				title := c.subject(UntaggedMail, data.withBadges(subjectData{Count: data.ResourceCount(), Account: account, Owner: data.Owner}))
+				// You can add some debug email address to ensure it works
+				// debugAddressees := []string{"ben@example.com"}
+				// data.SendEmail(c, UntaggedMail, untaggedMailTemplate, title, debugAddressees...)
+				data.SendEmail(c, UntaggedMail, untaggedMailTemplate, title)
+			}
 		}
 	}
 }
 
 // DeletionWarning will find resources which are about to be deleted within
-// `hoursInAdvance` hours, and send an email to the owner of those resources
-// with a warning. Resources explicitly tagged to be deleted are not included
-// in this warning.
-func (c *Client) DeletionWarning(hoursInAdvance int, mngr cloud.ResourceManager, accountUserMapping map[string]string) {
-	allCompute := mngr.AllResourcesPerAccount()
-	allBuckets := mngr.BucketsPerAccount()
-	for account, resources := range allCompute {
+// the lead time of any of the reminders, and send an email to the owner of
+// those resources with a warning. Each resource is included in one mail per
+// reminder. Resources explicitly tagged to be deleted are not included in
+// this warning.
+func (c *Client) DeletionWarning(ctx context.Context, reminders Reminders, mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	allCompute := mngr.AllResourcesPerAccount(ctx)
+	billing.PrefetchCollectionPrices(allCompute)
+	allBuckets := mngr.BucketsPerAccount(ctx)
+	allTables := mngr.TablesPerAccount(ctx)
+	allCacheClusters := mngr.CacheClustersPerAccount(ctx)
+	allAddresses := mngr.AddressesPerAccount(ctx)
+	allGateways := mngr.NetworkGatewaysPerAccount(ctx)
+	allCapacities := mngr.CapacitiesPerAccount(ctx)
+	allDBInstances := mngr.DBInstancesPerAccount(ctx)
+	allDBSnapshots := mngr.DBSnapshotsPerAccount(ctx)
+	if cancelled(ctx, "deletion warning") {
+		return
+	}
+	automationMailData := make([]*resourceMailData, len(reminders))
+	for i := range reminders {
+		automationMailData[i] = initTotalSummaryMailData(c.config.AutomationAddressee)
+		automationMailData[i].setReminder(reminders, i)
+	}
+	for _, account := range cloud.Accounts(allCompute) {
+		resources := allCompute[account]
 		ownerName := convertEmailExceptions(accountUserMapping[account])
-		fil := filter.New()
-		fil.AddGeneralRule(filter.DeleteWithinXHours(hoursInAdvance))
-		mailData := resourceMailData{
-			ownerName,
-			account,
-			filter.Instances(resources.Instances, fil),
-			filter.Images(resources.Images, fil),
-			filter.Snapshots(resources.Snapshots, fil),
-			filter.Volumes(resources.Volumes, fil),
-			[]cloud.Bucket{},
-			hoursInAdvance,
+		for i, hoursInAdvance := range reminders {
+			fil := filter.New()
+			fil.AddGeneralRule(filter.DeleteWithinXHours(reminders[0]))
+			fil.AddGeneralRule(filter.Negate(filter.UnderRetention()))
+			fil.AddGeneralRule(c.reminderDue(DeletionWarningMail, filter.DeleteTagKey, reminders, i))
+			mailData := resourceMailData{
+				Owner:           ownerName,
+				OwnerID:         account,
+				Instances:       filter.Instances(resources.Instances, fil),
+				Images:          filter.Images(resources.Images, fil),
+				Snapshots:       filter.Snapshots(resources.Snapshots, fil),
+				Volumes:         filter.Volumes(resources.Volumes, fil),
+				Buckets:         []cloud.Bucket{},
+				Tables:          filter.Tables(allTables[account], fil),
+				CacheClusters:   filter.CacheClusters(allCacheClusters[account], fil),
+				Addresses:       filter.Addresses(allAddresses[account], fil),
+				NetworkGateways: filter.NetworkGateways(allGateways[account], fil),
+				Capacities:      filter.Capacities(allCapacities[account], fil),
+				DBInstances:     filter.DBInstances(allDBInstances[account], fil),
+				DBSnapshots:     filter.DBSnapshots(allDBSnapshots[account], fil),
+			}
+			mailData.setReminder(reminders, i)
+			if buckets, ok := allBuckets[account]; ok {
+				mailData.Buckets = filter.Buckets(buckets, fil)
+			}
+			mailData.attachVolumes(resources.Volumes)
+			automationMailData[i].attachVolumes(resources.Volumes)
+			mailData.markPartial(mngr.ScanStatus(), account)
+			automationMailData[i].markPartial(mngr.ScanStatus(), account)
+			c.separateAutomationResources(&mailData, automationMailData[i])
+			mailData.findMaxLifetimeExceeded()
+
+			for _, data := range c.splitByCreator(&mailData) {
+				if data.ResourceCount() > 0 {
+					// Send email
+					title := c.subject(DeletionWarningMail, data.withBadges(subjectData{Count: data.ResourceCount(), Account: account, Owner: data.Owner, Hours: hoursInAdvance}))
+					if data.SendEmail(c, DeletionWarningMail, deletionWarningTemplate, title) {
+						c.recordReminders(DeletionWarningMail, filter.DeleteTagKey, data.allResources(), hoursInAdvance)
+					}
+				}
+			}
 		}
-		if buckets, ok := allBuckets[account]; ok {
-			mailData.Buckets = filter.Buckets(buckets, fil)
+	}
+
+	for i, data := range automationMailData {
+		data.findMaxLifetimeExceeded()
+		if data.ResourceCount() > 0 {
+			log.Printf("Sending out deletion warning for automation resources, %d hours in advance\n", reminders[i])
+			title := c.subject(AutomationWarningMail, data.withBadges(subjectData{Count: data.ResourceCount(), Owner: data.Owner, Hours: reminders[i]}))
+			if data.SendEmail(c, AutomationWarningMail, automationWarningTemplate, title) {
+				c.recordReminders(DeletionWarningMail, filter.DeleteTagKey, data.allResources(), reminders[i])
+			}
 		}
+	}
+}
+
+// StopWarning will find running instances which are about to be stopped
+// within the lead time of any of the reminders, and send an email to the
+// owner of those instances with a warning. Each instance is included in
+// one mail per reminder.
+func (c *Client) StopWarning(ctx context.Context, reminders Reminders, mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	allCompute := mngr.AllResourcesPerAccount(ctx)
+	if cancelled(ctx, "stop warning") {
+		return
+	}
+	billing.PrefetchCollectionPrices(allCompute)
+	for _, account := range cloud.Accounts(allCompute) {
+		resources := allCompute[account]
+		ownerName := convertEmailExceptions(accountUserMapping[account])
+		for i, hoursInAdvance := range reminders {
+			fil := filter.New()
+			fil.AddGeneralRule(filter.StopWithinXHours(reminders[0]))
+			fil.AddGeneralRule(c.reminderDue(StopWarningMail, filter.StopTagKey, reminders, i))
+			fil.AddInstanceRule(filter.IsRunning())
+			mailData := resourceMailData{
+				Owner:     ownerName,
+				OwnerID:   account,
+				Instances: filter.Instances(resources.Instances, fil),
+			}
+			mailData.setReminder(reminders, i)
+			mailData.attachVolumes(resources.Volumes)
+			mailData.markPartial(mngr.ScanStatus(), account)
+			mailData.findMaxLifetimeExceeded()
+
+			for _, data := range c.splitByCreator(&mailData) {
+				if data.ResourceCount() > 0 {
+					title := c.subject(StopWarningMail, data.withBadges(subjectData{Count: data.ResourceCount(), Account: account, Owner: data.Owner, Hours: hoursInAdvance}))
+					if data.SendEmail(c, StopWarningMail, stopWarningTemplate, title) {
+						c.recordReminders(StopWarningMail, filter.StopTagKey, data.allResources(), hoursInAdvance)
+					}
+				}
+			}
+		}
+	}
+}
+
+// separateAutomationResources moves all resources created by any of the
+// configured automation principals from mailData to automationData.
+func (c *Client) separateAutomationResources(mailData, automationData *resourceMailData) {
+	if len(c.config.AutomationPrincipals) == 0 {
+		return
+	}
+	automationFilter := filter.New()
+	automationFilter.OverrideWhitelist = true
+	automationFilter.AddGeneralRule(filter.CreatedByPrincipal(c.config.AutomationPrincipals...))
+
+	ownerFilter := filter.New()
+	ownerFilter.OverrideWhitelist = true
+	ownerFilter.AddGeneralRule(filter.Negate(filter.CreatedByPrincipal(c.config.AutomationPrincipals...)))
+
+	automationData.Instances = append(automationData.Instances, filter.Instances(mailData.Instances, automationFilter)...)
+	automationData.Images = append(automationData.Images, filter.Images(mailData.Images, automationFilter)...)
+	automationData.Snapshots = append(automationData.Snapshots, filter.Snapshots(mailData.Snapshots, automationFilter)...)
+	automationData.Volumes = append(automationData.Volumes, filter.Volumes(mailData.Volumes, automationFilter)...)
+	automationData.Buckets = append(automationData.Buckets, filter.Buckets(mailData.Buckets, automationFilter)...)
+	automationData.Tables = append(automationData.Tables, filter.Tables(mailData.Tables, automationFilter)...)
+	automationData.CacheClusters = append(automationData.CacheClusters, filter.CacheClusters(mailData.CacheClusters, automationFilter)...)
+	automationData.Addresses = append(automationData.Addresses, filter.Addresses(mailData.Addresses, automationFilter)...)
+	automationData.NetworkGateways = append(automationData.NetworkGateways, filter.NetworkGateways(mailData.NetworkGateways, automationFilter)...)
+	automationData.Capacities = append(automationData.Capacities, filter.Capacities(mailData.Capacities, automationFilter)...)
+	automationData.DBInstances = append(automationData.DBInstances, filter.DBInstances(mailData.DBInstances, automationFilter)...)
+	automationData.DBSnapshots = append(automationData.DBSnapshots, filter.DBSnapshots(mailData.DBSnapshots, automationFilter)...)
+
+	mailData.Instances = filter.Instances(mailData.Instances, ownerFilter)
+	mailData.Images = filter.Images(mailData.Images, ownerFilter)
+	mailData.Snapshots = filter.Snapshots(mailData.Snapshots, ownerFilter)
+	mailData.Volumes = filter.Volumes(mailData.Volumes, ownerFilter)
+	mailData.Buckets = filter.Buckets(mailData.Buckets, ownerFilter)
+	mailData.Tables = filter.Tables(mailData.Tables, ownerFilter)
+	mailData.CacheClusters = filter.CacheClusters(mailData.CacheClusters, ownerFilter)
+	mailData.Addresses = filter.Addresses(mailData.Addresses, ownerFilter)
+	mailData.NetworkGateways = filter.NetworkGateways(mailData.NetworkGateways, ownerFilter)
+	mailData.Capacities = filter.Capacities(mailData.Capacities, ownerFilter)
+	mailData.DBInstances = filter.DBInstances(mailData.DBInstances, ownerFilter)
+	mailData.DBSnapshots = filter.DBSnapshots(mailData.DBSnapshots, ownerFilter)
+}
+
+// RetentionLapsedReport will find images and snapshots with a retention
+// tag (see filter.RetentionTagKey) whose retention period has passed, and
+// send an email to their owner that they are no longer required to be kept.
+func (c *Client) RetentionLapsedReport(ctx context.Context, mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	if filter.RetentionTagKey == "" {
+		log.Println("No retention tag key is configured, so no resources have a retention")
+		return
+	}
+	allCompute := mngr.AllResourcesPerAccount(ctx)
+	if cancelled(ctx, "retention lapsed") {
+		return
+	}
+	for _, account := range cloud.Accounts(allCompute) {
+		resources := allCompute[account]
+		log.Println("Looking for lapsed retention in", cloud.AccountName(account))
+		lapsedFilter := filter.New()
+		lapsedFilter.AddGeneralRule(filter.RetentionLapsed())
+		// Report on lapsed retention regardless of whitelisting
+		lapsedFilter.OverrideWhitelist = true
+
+		username := accountUserMapping[account]
+		mailData := resourceMailData{
+			Owner:     username,
+			OwnerID:   account,
+			Images:    filter.Images(resources.Images, lapsedFilter),
+			Snapshots: filter.Snapshots(resources.Snapshots, lapsedFilter),
+		}
+		mailData.markPartial(mngr.ScanStatus(), account)
 
 		if mailData.ResourceCount() > 0 {
-			// Send email
-			title := fmt.Sprintf("Deletion warning, %d resources are cleaned up within %d hours", mailData.ResourceCount(), hoursInAdvance)
-			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, deletionWarningTemplate, title)
+			title := c.subject(RetentionLapsedMail, mailData.withBadges(subjectData{Count: mailData.ResourceCount(), Account: account, Owner: username}))
+			mailData.SendEmail(c, RetentionLapsedMail, retentionLapsedTemplate, title)
 		}
 	}
 }
 
 // MonthToDateReport sends an email to engineering with the
-// Month-to-Date billing report
-func (c *Client) MonthToDateReport(report billing.Report, accountUserMapping map[string]string, sortedByTags bool) {
-	mailClient := getMailClient(c)
+// Month-to-Date billing report. The report includes the costs
+// per department of the organization, if it has any departments.
+func (c *Client) MonthToDateReport(report billing.Report, org *cs.Organization, sortedByTags bool) {
+	defer c.logSuppressedMail()
+	if c.config.BillingReportAddressee == "" {
+		log.Println("Not sending the month-to-date report, since it has no addressee")
+		return
+	}
+	accountUserMapping := org.AccountToUserMapping(report.CSP)
 	var sorted billing.UserList
 	if sortedByTags {
 		sorted = report.SortedTagsByTotalCost()
 	} else {
 		sorted = report.SortedUsersByTotalCost()
 	}
-	reportData := monthToDateData{report.CSP, report.TotalCost(), sorted, billing.MinimumTotalCost, billing.MinimumCost, accountUserMapping}
+	departments := billing.UserList{}
+	if len(org.Departments) > 0 {
+		departments = report.SortedGroupsByTotalCost(org.AccountToDepartmentMapping(report.CSP), org.TagToDepartmentMapping())
+	}
+	reportData := monthToDateData{report.CSP, report.TotalCost(), sorted, billing.MinimumTotalCost, billing.MinimumCost, accountUserMapping, departments}
 	mailContent, err := generateMail(reportData, monthToDateTemplate)
 	if err != nil {
 		log.Fatalln("Could not generate email:", err)
 	}
-	billingReportMail := fmt.Sprintf("%s@%s", c.config.BillingReportAddressee, c.config.EmailDomain)
+	settings := c.mailSettings(c.config.BillingReportAddressee, "")
+	billingReportMail := fmt.Sprintf("%s@%s", c.config.BillingReportAddressee, settings.EmailDomain)
 	recipientMail := convertEmailExceptions(billingReportMail)
+	title := c.subject(MonthToDateMail, subjectData{Owner: c.config.BillingReportAddressee, CSP: report.CSP})
+	costType := "user"
+	if sortedByTags {
+		costType = "tag"
+	}
+	records := append(costRecords(MonthToDateMail, recipientMail, costType, sorted), costRecords(MonthToDateMail, recipientMail, "department", departments)...)
+	if c.outputReport(mailContent, records) {
+		return
+	}
+	if c.isDuplicateMail(recipientMail, monthToDateTemplate, title, mailContent) {
+		return
+	}
 	log.Printf("Sending the Month-to-date report to %s\n", recipientMail)
-	title := fmt.Sprintf("Month-to-date %s billing report", report.CSP)
-	err = mailClient.SendEmail(title, mailContent, recipientMail)
+	err = c.deliverMail(settings, title, mailContent, recipientMail)
 	if err != nil {
 		log.Printf("Failed to email %s: %s\n", recipientMail, err)
+	} else {
+		c.recordMail(recipientMail, monthToDateTemplate, mailContent)
 	}
 }
 
 // MarkingDryRunReport will send an email with all the resources that would have been marked for deletion
 func (c *Client) MarkingDryRunReport(taggedResources map[string]*cloud.AllResourceCollection, accountUserMapping map[string]string) {
-	for account, resources := range taggedResources {
+	defer c.logSuppressedMail()
+	for _, account := range cloud.AllAccounts(taggedResources) {
+		resources := taggedResources[account]
 		// Use a debug user here
 		mailData := resourceMailData{
-			Owner:     "cloudsweeper-test",
-			OwnerID:   account,
-			Instances: resources.Instances,
-			Images:    resources.Images,
-			Snapshots: resources.Snapshots,
-			Volumes:   resources.Volumes,
-			Buckets:   resources.Buckets,
+			Owner:           "cloudsweeper-test",
+			OwnerID:         account,
+			Instances:       resources.Instances,
+			Images:          resources.Images,
+			Snapshots:       resources.Snapshots,
+			Volumes:         resources.Volumes,
+			Buckets:         resources.Buckets,
+			Tables:          resources.Tables,
+			CacheClusters:   resources.CacheClusters,
+			Addresses:       resources.Addresses,
+			NetworkGateways: resources.NetworkGateways,
+			Capacities:      resources.Capacities,
+			DBInstances:     resources.DBInstances,
+			DBSnapshots:     resources.DBSnapshots,
 		}
+		mailData.MarkingOrder = markingOrder(resources)
 
 		if mailData.ResourceCount() > 0 {
 			// Send email
-			title := fmt.Sprintf("Marking Dry Run Warning. The following resources would have been marked for deletion:")
-			mailData.SendEmail(getMailClient(c), c.config.EmailDomain, markingDryRunTemplate, title)
+			title := c.subject(MarkingDryRunMail, mailData.withBadges(subjectData{Count: mailData.ResourceCount(), Account: account, Owner: mailData.Owner}))
+			mailData.SendEmail(c, MarkingDryRunMail, markingDryRunTemplate, title)
 		}
 	}
 }
@@ -0,0 +1,46 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"context"
+	"log"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// OrphanReport finds the volumes and snapshots left behind by instances
+// that Cloudsweeper terminated (see filter.OrphanTagKey), and sends an
+// email to their owner listing them, with how to include them in the next
+// marking run. Orphans that are already included or marked are left out.
+func (c *Client) OrphanReport(ctx context.Context, mngr cloud.ResourceManager, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	allCompute := mngr.AllResourcesPerAccount(ctx)
+	if cancelled(ctx, "orphan") {
+		return
+	}
+	for _, account := range cloud.Accounts(allCompute) {
+		resources := allCompute[account]
+		log.Println("Looking for storage left behind by terminated instances in", cloud.AccountName(account))
+		orphanFilter := filter.New()
+		orphanFilter.AddGeneralRule(filter.HasTag(filter.OrphanTagKey))
+		orphanFilter.AddGeneralRule(filter.Negate(filter.HasTag(filter.OrphanIncludeTagKey)))
+		orphanFilter.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+
+		username := accountUserMapping[account]
+		mailData := resourceMailData{
+			Owner:     username,
+			OwnerID:   account,
+			Volumes:   filter.Volumes(resources.Volumes, orphanFilter),
+			Snapshots: filter.Snapshots(resources.Snapshots, orphanFilter),
+		}
+		mailData.markPartial(mngr.ScanStatus(), account)
+
+		if mailData.ResourceCount() > 0 {
+			title := c.subject(OrphanMail, mailData.withBadges(subjectData{Count: mailData.ResourceCount(), Account: account, Owner: username}))
+			mailData.SendEmail(c, OrphanMail, orphanTemplate, title)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+)
+
+// OutputFormat defines how reports are written to a ReportOutput
+type OutputFormat string
+
+const (
+	// OutputJSON writes a JSON object per line for every resource or
+	// cost in a report, see OutputRecord
+	OutputJSON OutputFormat = "json"
+	// OutputCSV writes a row for every resource or cost in a report,
+	// with the fields of OutputRecord except the tags
+	OutputCSV OutputFormat = "csv"
+	// OutputHTML writes the content of the mails
+	OutputHTML OutputFormat = "html"
+)
+
+// ParseOutputFormat returns the OutputFormat with the specified name
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch format := OutputFormat(name); format {
+	case OutputJSON, OutputCSV, OutputHTML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("Unknown output format %q, must be %s, %s or %s", name, OutputJSON, OutputCSV, OutputHTML)
+	}
+}
+
+// OutputRecord is a resource, or a cost in a billing report, listed in a
+// report
+type OutputRecord struct {
+	// Report is the name of the mail, such as ReviewMail
+	Report    string `json:"report"`
+	Recipient string `json:"recipient"`
+	Account   string `json:"account,omitempty"`
+	// AccountAlias is the alias of the account, see cloud.AccountAlias
+	AccountAlias string `json:"account_alias,omitempty"`
+	// Type is the type of resource, or user, tag, department or account
+	// for costs
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Created is on the RFC 3339 format, it's empty for costs
+	Created      string            `json:"created,omitempty"`
+	CostPerMonth float64           `json:"cost_per_month"`
+	TotalCost    float64           `json:"total_cost"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+var outputCSVHeader = []string{"report", "recipient", "account", "account_alias", "type", "id", "name", "location", "created", "cost_per_month", "total_cost"}
+
+func (r *OutputRecord) csvRow() []string {
+	return []string{
+		r.Report,
+		r.Recipient,
+		r.Account,
+		r.AccountAlias,
+		r.Type,
+		r.ID,
+		r.Name,
+		r.Location,
+		r.Created,
+		strconv.FormatFloat(r.CostPerMonth, 'f', 2, 64),
+		strconv.FormatFloat(r.TotalCost, 'f', 2, 64),
+	}
+}
+
+// ReportOutput writes every report of a Client to a writer, such as
+// stdout or a file, so that they can be processed by other tools
+type ReportOutput struct {
+	format OutputFormat
+	w      io.Writer
+	csv    *csv.Writer
+
+	mu          sync.Mutex
+	wroteHeader bool
+}
+
+// NewReportOutput returns a ReportOutput writing reports on the specified
+// format to w. Flush must be called once all reports have been written.
+func NewReportOutput(format OutputFormat, w io.Writer) *ReportOutput {
+	return &ReportOutput{format: format, w: w, csv: csv.NewWriter(w)}
+}
+
+// write writes a report, as the content of its mail in HTML and as its
+// records in the other formats
+func (o *ReportOutput) write(content string, records []OutputRecord) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch o.format {
+	case OutputHTML:
+		_, err := io.WriteString(o.w, content+"\n")
+		return err
+	case OutputCSV:
+		if !o.wroteHeader {
+			if err := o.csv.Write(outputCSVHeader); err != nil {
+				return err
+			}
+			o.wroteHeader = true
+		}
+		for i := range records {
+			if err := o.csv.Write(records[i].csvRow()); err != nil {
+				return err
+			}
+		}
+		o.csv.Flush()
+		return o.csv.Error()
+	default:
+		encoder := json.NewEncoder(o.w)
+		for i := range records {
+			if err := encoder.Encode(&records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Flush writes any buffered data
+func (o *ReportOutput) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.csv.Flush()
+	return o.csv.Error()
+}
+
+// outputReport writes a report to the output of the Client, if it has one.
+// It returns true if the mail of the report shouldn't be sent, since the
+// Client only outputs reports.
+func (c *Client) outputReport(content string, records []OutputRecord) bool {
+	if c.config.Output == nil {
+		return false
+	}
+	if err := c.config.Output.write(content, records); err != nil {
+		log.Fatalln("Could not write report:", err)
+	}
+	return c.config.OutputOnly
+}
+
+// resourceRecords returns an OutputRecord for each of the resources
+func resourceRecords(report, recipient string, resources []cloud.Resource) []OutputRecord {
+	records := []OutputRecord{}
+	for _, res := range resources {
+		records = append(records, OutputRecord{
+			Report:       report,
+			Recipient:    recipient,
+			Account:      res.Owner(),
+			AccountAlias: accountAlias(res.Owner()),
+			Type:         outputType(res),
+			ID:           res.ID(),
+			Name:         res.Tags()["Name"],
+			Location:     res.Location(),
+			Created:      res.CreationTime().Format(time.RFC3339),
+			CostPerMonth: costPerMonth(res),
+			TotalCost:    accumulatedCost(res),
+			Tags:         res.Tags(),
+		})
+	}
+	return records
+}
+
+// costRecords returns an OutputRecord for each user, tag or department in
+// a billing report
+func costRecords(report, recipient, costType string, users billing.UserList) []OutputRecord {
+	records := []OutputRecord{}
+	for _, user := range users {
+		records = append(records, OutputRecord{
+			Report:    report,
+			Recipient: recipient,
+			Type:      costType,
+			ID:        user.Name,
+			TotalCost: user.TotalCost,
+		})
+	}
+	return records
+}
+
+// accountAlias returns the alias of an account, or an empty string if it
+// has none
+func accountAlias(account string) string {
+	alias, _ := cloud.AccountAlias(account)
+	return alias
+}
+
+// outputType returns the type of a resource in an OutputRecord
+func outputType(res cloud.Resource) string {
+	switch r := res.(type) {
+	case cloud.Instance:
+		return "instance"
+	case cloud.Image:
+		return "image"
+	case cloud.Volume:
+		return "volume"
+	case cloud.Snapshot:
+		return "snapshot"
+	case cloud.Bucket:
+		return "bucket"
+	case cloud.Table:
+		return "table"
+	case cloud.CacheCluster:
+		return "cache-cluster"
+	case cloud.Address:
+		return "address"
+	case cloud.NetworkGateway:
+		return r.GatewayType()
+	case cloud.Capacity:
+		return r.CapacityType()
+	case cloud.DBInstance:
+		return "db-instance"
+	case cloud.DBSnapshot:
+		return "db-snapshot"
+	default:
+		return "resource"
+	}
+}
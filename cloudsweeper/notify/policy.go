@@ -0,0 +1,49 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PolicySetting is a threshold of the policy a mail was sent with
+type PolicySetting struct {
+	Name  string
+	Value int
+}
+
+// PolicyHash identifies the thresholds of a policy, so that a mail or a
+// run can be traced back to the exact policy it was made with
+func PolicyHash(policy map[string]int) string {
+	names := make([]string, 0, len(policy))
+	for name := range policy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%d\n", name, policy[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// PolicyFor returns the thresholds of the policy whose names start with
+// the prefix, such as "notify-" for the thresholds of reviews, sorted by
+// name
+func (d *resourceMailData) PolicyFor(prefix string) []PolicySetting {
+	settings := []PolicySetting{}
+	for name, value := range d.Policy {
+		if strings.HasPrefix(name, prefix) {
+			settings = append(settings, PolicySetting{Name: name, Value: value})
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Name < settings[j].Name
+	})
+	return settings
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build !noaws
+// +build !noaws
+
+package notify
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+// heldMailPrefix is the prefix of held mails in an S3 bucket
+const heldMailPrefix = "held-mail/"
+
+type s3Queue struct {
+	bucket string
+	client *s3.S3
+}
+
+// NewS3Queue returns a queue of mails in an S3 bucket in the specified
+// region, using the credentials Cloudsweeper runs with. Every mail is a
+// JSON object under held-mail/, and can be discarded by deleting it.
+func NewS3Queue(bucket, region string) (MailQueue, error) {
+	sess := cloud.NewAWSSession()
+	client := s3.New(sess, &aws.Config{Region: aws.String(region)})
+	return &s3Queue{bucket: bucket, client: client}, nil
+}
+
+func (q *s3Queue) Put(mail *HeldMail) error {
+	mail.Name = heldMailName(mail)
+	data, err := encodeHeldMail(mail)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(q.bucket),
+		Key:         aws.String(heldMailPrefix + mail.Name),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+func (q *s3Queue) List() ([]*HeldMail, error) {
+	keys := []string{}
+	err := q.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(q.bucket),
+		Prefix: aws.String(heldMailPrefix),
+	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range output.Contents {
+			if key := aws.StringValue(obj.Key); strings.HasSuffix(key, heldMailExtension) {
+				keys = append(keys, key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Keys are listed in lexicographic order, which is the order the
+	// mails were held in
+	mails := []*HeldMail{}
+	for _, key := range keys {
+		output, err := q.client.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(q.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(output.Body)
+		output.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		mail, err := decodeHeldMail(path.Base(key), data)
+		if err != nil {
+			return nil, err
+		}
+		mails = append(mails, mail)
+	}
+	return mails, nil
+}
+
+func (q *s3Queue) Remove(mail *HeldMail) error {
+	_, err := q.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(heldMailPrefix + mail.Name),
+	})
+	return err
+}
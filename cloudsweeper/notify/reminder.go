@@ -0,0 +1,112 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+const sentReminderNamespace = "sent-reminder"
+
+// Reminders are the lead times, in hours before resources are cleaned up
+// or stopped, at which their owners are warned, from the earliest to the
+// last reminder. Owners are warned about each resource once per reminder,
+// which is tracked in the state store.
+type Reminders []int
+
+// ParseReminders parses a list of lead times in hours, e.g. 168, 48 and 4
+// to remind owners a week, two days and four hours in advance
+func ParseReminders(hours []string) (Reminders, error) {
+	if len(hours) == 0 {
+		return nil, fmt.Errorf("No reminders specified")
+	}
+	seen := make(map[int]bool)
+	reminders := Reminders{}
+	for _, val := range hours {
+		h, err := strconv.Atoi(val)
+		if err != nil || h <= 0 {
+			return nil, fmt.Errorf("Invalid reminder %q, must be a positive number of hours", val)
+		}
+		if !seen[h] {
+			seen[h] = true
+			reminders = append(reminders, h)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(reminders)))
+	return reminders, nil
+}
+
+// due returns the index of the latest reminder whose lead time has been
+// reached for a resource cleaned up or stopped at the specified time
+func (r Reminders) due(at time.Time) int {
+	due := 0
+	for i, hours := range r {
+		if clock.Now().After(at.Add(-(time.Duration(hours) * time.Hour))) {
+			due = i
+		}
+	}
+	return due
+}
+
+// setReminder sets which reminder a mail is, out of all reminders
+func (d *resourceMailData) setReminder(reminders Reminders, i int) {
+	d.HoursInAdvance = reminders[i]
+	d.Reminder = i + 1
+	d.ReminderCount = len(reminders)
+	d.NextReminderHours = 0
+	if i+1 < len(reminders) {
+		d.NextReminderHours = reminders[i+1]
+	}
+}
+
+// reminderDue returns a rule matching resources that are due the i:th
+// reminder, according to the time in their tag with the specified key,
+// and haven't been sent it yet. The kind of mail, e.g. a deletion
+// warning, is tracked separately, so resources can get both kinds.
+func (c *Client) reminderDue(kind, tagKey string, reminders Reminders, i int) func(cloud.Resource) bool {
+	return func(r cloud.Resource) bool {
+		tagValue := r.Tags()[tagKey]
+		at, err := time.Parse(time.RFC3339, tagValue)
+		if err != nil || reminders.due(at) != i {
+			return false
+		}
+		if c.config.State == nil {
+			return true
+		}
+		var sentHours int
+		found, err := c.config.State.Get(sentReminderNamespace, sentReminderKey(kind, r, tagValue), &sentHours)
+		if err != nil {
+			log.Printf("Could not read reminder state for %s: %s", r.ID(), err)
+			return true
+		}
+		return !found || sentHours > reminders[i]
+	}
+}
+
+// recordReminders remembers that resources were sent the reminder with
+// the specified lead time, so they aren't sent it again
+func (c *Client) recordReminders(kind, tagKey string, resources []cloud.Resource, hours int) {
+	if c.config.State == nil || c.config.Plan {
+		return
+	}
+	for _, r := range resources {
+		err := c.config.State.Put(sentReminderNamespace, sentReminderKey(kind, r, r.Tags()[tagKey]), hours)
+		if err != nil {
+			log.Printf("Could not record reminder for %s: %s", r.ID(), err)
+		}
+	}
+}
+
+// sentReminderKey includes the time in the tag, so a resource that is
+// marked again is reminded again
+func sentReminderKey(kind string, r cloud.Resource, tagValue string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", kind, r.Owner(), r.ID(), tagValue)
+}
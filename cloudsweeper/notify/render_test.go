@@ -0,0 +1,443 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// The mail templates are rendered with representative data sets, and
+// compared with the golden files in testdata, so that a change to a
+// template, or to the data it's rendered with, shows up as a diff. After an
+// intended change, regenerate the golden files with "make update-goldens"
+// and review the diff. A missing golden file, such as for a new template,
+// fails the test until it's written with "make update-goldens".
+
+var updateGoldens = flag.Bool("update", false, "Regenerate the golden files of the mail templates in testdata")
+
+// goldenNow is the time the mails are rendered at, so that the ages and
+// costs in the golden files don't change from day to day
+var goldenNow = time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+
+// hugeDataSetSize is the number of resources of each type in the huge
+// data set, enough to render long tables while keeping the golden files
+// small enough to review
+const hugeDataSetSize = 30
+
+type goldenResource struct {
+	owner    string
+	id       string
+	location string
+	created  time.Time
+	tags     map[string]string
+}
+
+func (r *goldenResource) CSP() cloud.CSP                                 { return cloud.GCP }
+func (r *goldenResource) Owner() string                                  { return r.owner }
+func (r *goldenResource) ID() string                                     { return r.id }
+func (r *goldenResource) Tags() map[string]string                        { return r.tags }
+func (r *goldenResource) Location() string                               { return r.location }
+func (r *goldenResource) Public() bool                                   { return false }
+func (r *goldenResource) CreationTime() time.Time                        { return r.created }
+func (r *goldenResource) Lineage() []string                              { return nil }
+func (r *goldenResource) SetTag(key, value string, overwrite bool) error { return nil }
+func (r *goldenResource) RemoveTag(key string) error                     { return nil }
+func (r *goldenResource) Cleanup() error                                 { return nil }
+
+type goldenInstance struct {
+	goldenResource
+}
+
+func (i *goldenInstance) InstanceType() string          { return "n1-standard-1" }
+func (i *goldenInstance) Running() bool                 { return true }
+func (i *goldenInstance) Stop() error                   { return nil }
+func (i *goldenInstance) KeyName() string               { return "" }
+func (i *goldenInstance) SecurityGroups() []string      { return nil }
+func (i *goldenInstance) LastInboundTraffic() time.Time { return time.Time{} }
+
+type goldenImage struct {
+	goldenResource
+	sizeGB int64
+}
+
+func (i *goldenImage) Name() string          { return i.id }
+func (i *goldenImage) SizeGB() int64         { return i.sizeGB }
+func (i *goldenImage) Family() string        { return "" }
+func (i *goldenImage) SourceImageID() string { return "" }
+func (i *goldenImage) SourceRegion() string  { return "" }
+func (i *goldenImage) MakePrivate() error    { return nil }
+
+type goldenVolume struct {
+	goldenResource
+	sizeGB int64
+}
+
+func (v *goldenVolume) SizeGB() int64         { return v.sizeGB }
+func (v *goldenVolume) Attached() bool        { return false }
+func (v *goldenVolume) Encrypted() bool       { return false }
+func (v *goldenVolume) VolumeType() string    { return "pd-standard" }
+func (v *goldenVolume) Regional() bool        { return false }
+func (v *goldenVolume) Iops() int64           { return 0 }
+func (v *goldenVolume) ThroughputMBps() int64 { return 0 }
+
+type goldenSnapshot struct {
+	goldenResource
+	sizeGB int64
+}
+
+func (s *goldenSnapshot) Encrypted() bool { return false }
+func (s *goldenSnapshot) InUse() bool     { return false }
+func (s *goldenSnapshot) SizeGB() int64   { return s.sizeGB }
+
+type goldenBucket struct {
+	goldenResource
+	sizeGB float64
+}
+
+func (b *goldenBucket) LastModified() time.Time { return b.created }
+func (b *goldenBucket) ObjectCount() int64      { return int64(b.sizeGB) * 100 }
+func (b *goldenBucket) TotalSizeGB() float64    { return b.sizeGB }
+func (b *goldenBucket) StorageTypeSizesGB() map[string]float64 {
+	return map[string]float64{"STANDARD": b.sizeGB}
+}
+func (b *goldenBucket) SizeKnown() bool { return true }
+
+// goldenDataSet is a set of resources of one owner, rendered by every
+// template
+type goldenDataSet struct {
+	name      string
+	owner     string
+	account   string
+	instances []cloud.Instance
+	images    []cloud.Image
+	volumes   []cloud.Volume
+	snapshots []cloud.Snapshot
+	buckets   []cloud.Bucket
+}
+
+// add adds one resource of each type to the data set, created daysOld
+// days before goldenNow, with the specified size and tags
+func (s *goldenDataSet) add(i, daysOld int, sizeGB int64, tags map[string]string) {
+	base := func(kind string) goldenResource {
+		return goldenResource{
+			owner:    s.account,
+			id:       fmt.Sprintf("%s-%s-%03d", s.name, kind, i),
+			location: "us-central1-a",
+			created:  goldenNow.AddDate(0, 0, -daysOld),
+			tags:     tags,
+		}
+	}
+	s.instances = append(s.instances, &goldenInstance{base("instance")})
+	s.images = append(s.images, &goldenImage{base("image"), sizeGB})
+	s.volumes = append(s.volumes, &goldenVolume{base("volume"), sizeGB})
+	s.snapshots = append(s.snapshots, &goldenSnapshot{base("snapshot"), sizeGB})
+	s.buckets = append(s.buckets, &goldenBucket{base("bucket"), float64(sizeGB)})
+}
+
+func (s *goldenDataSet) resources() []cloud.Resource {
+	return markingOrder(&cloud.AllResourceCollection{
+		Instances: s.instances,
+		Images:    s.images,
+		Volumes:   s.volumes,
+		Snapshots: s.snapshots,
+		Buckets:   s.buckets,
+	})
+}
+
+// goldenDataSets returns the data sets every template is rendered with:
+// no resources at all, typical resources, a huge number of resources,
+// names and notes outside ASCII, and resources that don't cost anything
+func goldenDataSets() []*goldenDataSet {
+	empty := &goldenDataSet{name: "empty", owner: "alice", account: "123456789012"}
+
+	typical := &goldenDataSet{name: "typical", owner: "alice", account: "123456789012"}
+	cloud.SetAccountAlias(typical.account, "alice-dev")
+	typical.add(1, 200, 100, map[string]string{"product": "web", "role": "frontend"})
+	typical.add(2, 45, 20, map[string]string{filter.WhitelistTagKey: "true", filter.NoteTagKey: "needed for Q4 audit, contact alice"})
+	typical.add(3, 31, 500, map[string]string{filter.DeleteTagKey: goldenNow.Add(48 * time.Hour).Format(time.RFC3339)})
+
+	huge := &goldenDataSet{name: "huge", owner: "bob", account: "234567890123"}
+	for i := 0; i < hugeDataSetSize; i++ {
+		huge.add(i, 30+i, int64(10+i), map[string]string{"product": "batch"})
+	}
+
+	unicode := &goldenDataSet{name: "unicode", owner: "zoë", account: "projet-données"}
+	unicode.add(1, 90, 50, map[string]string{"product": "日本語", filter.NoteTagKey: "für die Prüfung — contact Zoë <zoe@example.com> 🚀"})
+
+	zeroCost := &goldenDataSet{name: "zero-cost", owner: "carol", account: "345678901234"}
+	zeroCost.add(1, 0, 0, map[string]string{})
+
+	return []*goldenDataSet{empty, typical, huge, unicode, zeroCost}
+}
+
+// reviewData returns the mail data of a review of the data set
+func (s *goldenDataSet) reviewData() *resourceMailData {
+	data := &resourceMailData{
+		Owner:     s.owner,
+		OwnerID:   s.account,
+		Instances: s.instances,
+		Images:    s.images,
+		Volumes:   s.volumes,
+		Snapshots: s.snapshots,
+		Buckets:   s.buckets,
+	}
+	data.SortByCost()
+	return data
+}
+
+// mergedReviewData returns the mail data of a review of the data set
+// across CSPs, with the instances and images in an AWS account and the
+// rest in a GCP project
+func (s *goldenDataSet) mergedReviewData() *resourceMailData {
+	aws := &resourceMailData{
+		Owner:     s.owner,
+		OwnerID:   s.account,
+		CSP:       cloud.AWS,
+		Instances: s.instances,
+		Images:    s.images,
+	}
+	gcp := &resourceMailData{
+		Owner:     s.owner,
+		OwnerID:   s.account + "-project",
+		CSP:       cloud.GCP,
+		Volumes:   s.volumes,
+		Snapshots: s.snapshots,
+		Buckets:   s.buckets,
+	}
+	data := mergeReviews(s.owner, []*resourceMailData{aws, gcp})
+	for _, section := range append([]*resourceMailData{data}, data.Sections...) {
+		section.SortByCost()
+	}
+	return data
+}
+
+// rollupData returns the mail data of a manager or org review, rolling up
+// the review of the data set
+func (s *goldenDataSet) rollupData(owner string) *resourceMailData {
+	report := s.reviewData()
+	data := &resourceMailData{
+		Owner:        owner,
+		Instances:    report.Instances,
+		Images:       report.Images,
+		Volumes:      report.Volumes,
+		Snapshots:    report.Snapshots,
+		Buckets:      report.Buckets,
+		GroupByOwner: true,
+	}
+	if report.ResourceCount() > 0 {
+		data.Reports = []*resourceMailData{report}
+		data.addTeamSubtotal(owner, report)
+	}
+	data.applyRollup(RollupFull, 0)
+	return data
+}
+
+// warningData returns the mail data of a deletion or stop warning
+func (s *goldenDataSet) warningData() *resourceMailData {
+	data := s.reviewData()
+	data.HoursInAdvance = 48
+	data.Reminder = 1
+	data.ReminderCount = 2
+	data.NextReminderHours = 4
+	data.MarkingOrder = s.resources()
+	return data
+}
+
+func (s *goldenDataSet) whitelistData() *whitelistReportMailData {
+	data := &whitelistReportMailData{Owner: s.owner, CSP: cloud.GCP, Resources: []whitelistedResource{}, Days: 14}
+	for _, res := range s.resources() {
+		data.Resources = append(data.Resources, newWhitelistedResource(res, s.owner))
+	}
+	return data
+}
+
+func (s *goldenDataSet) stackData() *stackReportMailData {
+	data := &stackReportMailData{Owner: s.owner, Stack: "terraform/" + s.name, CSP: cloud.GCP, Resources: []stackResource{}}
+	for _, res := range s.resources() {
+		data.Resources = append(data.Resources, stackResource{Resource: res, Reason: "old " + resourceTypeName(res)})
+	}
+	return data
+}
+
+func (s *goldenDataSet) accountSummaryData() *accountSummaryMailData {
+	data := &accountSummaryMailData{Owner: s.owner}
+	summary := &accountSummary{
+		Account:     s.account,
+		Instances:   len(s.instances),
+		Images:      len(s.images),
+		Volumes:     len(s.volumes),
+		Snapshots:   len(s.snapshots),
+		Buckets:     len(s.buckets),
+		ReviewCount: len(s.resources()),
+	}
+	for _, res := range s.resources() {
+		summary.CostPerMonth += costPerMonth(res)
+		if _, marked := res.Tags()[filter.DeleteTagKey]; marked {
+			summary.MarkedCount++
+			summary.NextDeletion = goldenNow.Add(48 * time.Hour)
+		}
+	}
+	data.Accounts = append(data.Accounts, summary)
+	return data
+}
+
+func (s *goldenDataSet) credentialHygieneData() *credentialHygieneMailData {
+	data := &credentialHygieneMailData{Owner: s.owner, OwnerID: s.account, CSP: cloud.GCP, Keys: []staleKey{}}
+	for _, inst := range s.instances {
+		key := &cloud.AccessKey{
+			Account:       s.account,
+			Principal:     inst.ID() + "@" + s.account + ".iam.gserviceaccount.com",
+			ID:            inst.ID() + "-key",
+			CreationTime:  inst.CreationTime(),
+			LastUsed:      inst.CreationTime(),
+			LastUsedKnown: true,
+		}
+		data.Keys = append(data.Keys, staleKey{AccessKey: key, Reason: staleKeyReason(key, 90, 90)})
+	}
+	return data
+}
+
+func (s *goldenDataSet) monthToDateData() monthToDateData {
+	users := billing.UserList{}
+	total := 0.0
+	for _, res := range s.resources() {
+		cost := accumulatedCost(res)
+		users = append(users, billing.User{
+			Name:          res.ID(),
+			TotalCost:     cost,
+			DetailedCosts: billing.CostList{billing.DetailedCost{Cost: cost, Description: resourceTypeName(res)}},
+		})
+		total += cost
+	}
+	return monthToDateData{cloud.GCP, total, users, billing.MinimumTotalCost, billing.MinimumCost, map[string]string{s.account: s.owner}, billing.UserList{}}
+}
+
+func (s *goldenDataSet) costAnomalyData() *costAnomalyMailData {
+	previous := 0.0
+	for _, res := range s.resources() {
+		previous += billing.ResourceCostPerDay(res)
+	}
+	return &costAnomalyMailData{
+		Owner:   s.owner,
+		CSP:     cloud.GCP,
+		Anomaly: billing.CostAnomaly{Owner: s.account, Day: goldenNow.Format("2006-01-02"), PreviousCost: previous, Cost: previous + 250},
+	}
+}
+
+// goldenMails are the templates to render, with the data of each data set
+var goldenMails = []struct {
+	name     string
+	template string
+	data     func(*goldenDataSet) interface{}
+}{
+	{ReviewMail, reviewMailTemplate, func(s *goldenDataSet) interface{} { return s.reviewData() }},
+	{ManagerReviewMail, managerReviewMailTemplate, func(s *goldenDataSet) interface{} { return s.rollupData("dave") }},
+	{OrgReviewMail, totalReviewMailTemplate, func(s *goldenDataSet) interface{} { return s.rollupData("cloud-team") }},
+	{MergedReviewMail, mergedReviewMailTemplate, func(s *goldenDataSet) interface{} { return s.mergedReviewData() }},
+	{UntaggedMail, untaggedMailTemplate, func(s *goldenDataSet) interface{} { return s.reviewData() }},
+	{DeletionWarningMail, deletionWarningTemplate, func(s *goldenDataSet) interface{} { return s.warningData() }},
+	{StopWarningMail, stopWarningTemplate, func(s *goldenDataSet) interface{} { return s.warningData() }},
+	{AutomationWarningMail, automationWarningTemplate, func(s *goldenDataSet) interface{} { return s.warningData() }},
+	{MarkingDryRunMail, markingDryRunTemplate, func(s *goldenDataSet) interface{} { return s.warningData() }},
+	{RetentionLapsedMail, retentionLapsedTemplate, func(s *goldenDataSet) interface{} { return s.reviewData() }},
+	{OrphanMail, orphanTemplate, func(s *goldenDataSet) interface{} { return s.reviewData() }},
+	{AccountSummaryMail, accountSummaryTemplate, func(s *goldenDataSet) interface{} { return s.accountSummaryData() }},
+	{CredentialHygieneMail, credentialHygieneTemplate, func(s *goldenDataSet) interface{} { return s.credentialHygieneData() }},
+	{WhitelistReportMail, whitelistReportTemplate, func(s *goldenDataSet) interface{} { return s.whitelistData() }},
+	{WhitelistExpiryMail, whitelistExpiryTemplate, func(s *goldenDataSet) interface{} { return s.whitelistData() }},
+	{WhitelistReapprovalMail, whitelistReapprovalTemplate, func(s *goldenDataSet) interface{} { return s.whitelistData() }},
+	{StackReportMail, stackReportTemplate, func(s *goldenDataSet) interface{} { return s.stackData() }},
+	{MonthToDateMail, monthToDateTemplate, func(s *goldenDataSet) interface{} { return s.monthToDateData() }},
+	{CostAnomalyMail, costAnomalyTemplate, func(s *goldenDataSet) interface{} { return s.costAnomalyData() }},
+}
+
+func TestMailGolden(t *testing.T) {
+	clock.Set(clock.Frozen(goldenNow))
+	defer clock.Set(nil)
+	for _, mail := range goldenMails {
+		for _, set := range goldenDataSets() {
+			name := mail.name + "-" + set.name
+			t.Run(name, func(t *testing.T) {
+				content, err := generateMail(mail.data(set), mail.template)
+				if err != nil {
+					t.Fatalf("Could not render the mail: %s", err)
+				}
+				checkGolden(t, name, []byte(content))
+			})
+		}
+	}
+}
+
+// TestMailGoldenCoverage checks that every mail has golden files, so that
+// a new template isn't left untested
+func TestMailGoldenCoverage(t *testing.T) {
+	tested := make(map[string]bool)
+	for _, mail := range goldenMails {
+		tested[mail.name] = true
+	}
+	for _, name := range SubjectNames() {
+		if !tested[name] {
+			t.Errorf("The %s mail has no golden files, add it to goldenMails", name)
+		}
+	}
+}
+
+// checkGolden compares a rendered mail with its golden file, which is
+// written instead if the golden files are updated
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden.html")
+	if *updateGoldens {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("Wrote %s", path)
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("%s is missing, run \"make update-goldens\" to write it", path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("The mail doesn't match %s, run \"make update-goldens\" if the change is intended\n%s", path, firstDifference(want, got))
+	}
+}
+
+// firstDifference describes the first line that differs between the golden
+// file and the rendered mail
+func firstDifference(want, got []byte) string {
+	wantLines := bytes.Split(want, []byte("\n"))
+	gotLines := bytes.Split(got, []byte("\n"))
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var wantLine, gotLine []byte
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if !bytes.Equal(wantLine, gotLine) {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, wantLine, gotLine)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// GeneralRunbook is the runbook shown in every review and warning, such
+// as a link to where Cloudsweeper and its tags are documented
+const GeneralRunbook = "general"
+
+// runbookHeadings are the headings of the runbooks of each resource type,
+// in the order they are shown
+var runbookHeadings = []struct {
+	Type    string
+	Heading string
+}{
+	{"instance", "Instances"},
+	{"image", "Images"},
+	{"volume", "Volumes"},
+	{"snapshot", "Snapshots"},
+	{"bucket", "Buckets"},
+	{"table", "Tables"},
+	{"cache-cluster", "Cache clusters"},
+	{"address", "IP addresses"},
+	{"network-gateway", "Network gateways"},
+	{"capacity", "Reserved capacity"},
+	{"db-instance", "Database instances"},
+	{"db-snapshot", "Database snapshots"},
+}
+
+// LoadRunbooks reads the remediation guidance shown in reviews and
+// warnings from a directory, with one file per resource type, such as
+// bucket.html, or GeneralRunbook. Files ending with .html are HTML
+// fragments and are shown as they are, files ending with .md are Markdown
+// and are converted to HTML. Other files are ignored.
+func LoadRunbooks(dir string) (map[string]template.HTML, error) {
+	types := map[string]bool{GeneralRunbook: true}
+	for _, runbook := range runbookHeadings {
+		types[runbook.Type] = true
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read runbooks: %s", err)
+	}
+	runbooks := make(map[string]template.HTML)
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || (ext != ".html" && ext != ".md") {
+			continue
+		}
+		resourceType := strings.TrimSuffix(file.Name(), ext)
+		if !types[resourceType] {
+			return nil, fmt.Errorf("Runbook %s is not for a resource type, such as instance.html, or %s", file.Name(), GeneralRunbook)
+		}
+		if _, exist := runbooks[resourceType]; exist {
+			return nil, fmt.Errorf("There is more than one runbook for %s", resourceType)
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("Could not read runbook %s: %s", file.Name(), err)
+		}
+		if ext == ".md" {
+			runbooks[resourceType] = markdownToHTML(string(raw))
+		} else {
+			runbooks[resourceType] = template.HTML(raw)
+		}
+	}
+	return runbooks, nil
+}
+
+type runbookEntry struct {
+	Heading  string
+	Guidance template.HTML
+}
+
+// RunbookEntries returns the runbooks of the resource types in the mail,
+// which are shown after the resources
+func (d *resourceMailData) RunbookEntries() []runbookEntry {
+	counts := map[string]int{
+		"instance":        len(d.Instances),
+		"image":           len(d.Images),
+		"volume":          len(d.Volumes),
+		"snapshot":        len(d.Snapshots),
+		"bucket":          len(d.Buckets),
+		"table":           len(d.Tables),
+		"cache-cluster":   len(d.CacheClusters),
+		"address":         len(d.Addresses),
+		"network-gateway": len(d.NetworkGateways),
+		"capacity":        len(d.Capacities),
+		"db-instance":     len(d.DBInstances),
+		"db-snapshot":     len(d.DBSnapshots),
+	}
+	entries := []runbookEntry{}
+	for _, runbook := range runbookHeadings {
+		if guidance, exist := d.Runbooks[runbook.Type]; exist && counts[runbook.Type] > 0 {
+			entries = append(entries, runbookEntry{Heading: runbook.Heading, Guidance: guidance})
+		}
+	}
+	return entries
+}
+
+var (
+	markdownHeading  = regexp.MustCompile(`^#{1,6}\s+`)
+	markdownListItem = regexp.MustCompile(`^(\s*[-*]|\s*\d+\.)\s+`)
+	markdownOrdered  = regexp.MustCompile(`^\s*\d+\.`)
+	markdownLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownCode     = regexp.MustCompile("`([^`]+)`")
+	markdownBold     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markdownItalic   = regexp.MustCompile(`\*([^*]+)\*`)
+)
+
+// markdownToHTML converts the Markdown commonly used in runbooks to HTML:
+// paragraphs, headings, lists, links, code, bold and italic text. All
+// other text is escaped.
+func markdownToHTML(markdown string) template.HTML {
+	var b strings.Builder
+	blocks := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n\n")
+	for _, block := range blocks {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		if lines[0] == "" {
+			continue
+		}
+		switch {
+		case markdownHeading.MatchString(lines[0]) && len(lines) == 1:
+			fmt.Fprintf(&b, "<h4>%s</h4>\n", markdownInline(markdownHeading.ReplaceAllString(lines[0], "")))
+		case markdownListItem.MatchString(lines[0]):
+			tag := "ul"
+			if markdownOrdered.MatchString(lines[0]) {
+				tag = "ol"
+			}
+			fmt.Fprintf(&b, "<%s>\n", tag)
+			for _, line := range lines {
+				fmt.Fprintf(&b, "<li>%s</li>\n", markdownInline(markdownListItem.ReplaceAllString(line, "")))
+			}
+			fmt.Fprintf(&b, "</%s>\n", tag)
+		default:
+			fmt.Fprintf(&b, "<p>\n%s\n</p>\n", markdownInline(strings.Join(lines, "\n")))
+		}
+	}
+	return template.HTML(b.String())
+}
+
+// markdownInline escapes text and converts its links, code, bold and
+// italic text to HTML
+func markdownInline(text string) string {
+	text = html.EscapeString(text)
+	text = markdownLink.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = markdownCode.ReplaceAllString(text, "<code>$1</code>")
+	text = markdownBold.ReplaceAllString(text, "<b>$1</b>")
+	return markdownItalic.ReplaceAllString(text, "<i>$1</i>")
+}
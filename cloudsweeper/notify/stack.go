@@ -0,0 +1,101 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"log"
+	"sort"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+)
+
+// stackResource is a resource listed in a stack report, with the rule
+// that would have marked it
+type stackResource struct {
+	Resource cloud.Resource
+	Reason   string
+}
+
+type stackReportMailData struct {
+	Owner     string
+	Stack     string
+	CSP       cloud.CSP
+	Resources []stackResource
+}
+
+// TotalCost returns the accumulated cost of all resources in the report
+func (d *stackReportMailData) TotalCost() float64 {
+	total := 0.0
+	for _, res := range d.Resources {
+		total += accumulatedCost(res.Resource)
+	}
+	return total
+}
+
+// stackOwner returns the owner of a stack: the username in the
+// filter.StackOwnerTagKey tag of any of its resources, or else the owner
+// of the account of its first resource
+func stackOwner(resources []cloud.Resource, accountUserMapping map[string]string) string {
+	for _, res := range resources {
+		if owner := res.Tags()[filter.StackOwnerTagKey]; owner != "" {
+			return owner
+		}
+	}
+	if len(resources) == 0 {
+		return ""
+	}
+	return accountUserMapping[resources[0].Owner()]
+}
+
+// StackReport sends an email to the owner of each stack (see
+// filter.ManagedByTagKey), rolling up the resources of the stack that
+// would have been marked if they weren't managed by it, with the reasons
+// they matched by resource ID. Resources of stacks are never marked one by
+// one, so the owner can update the stack or have it marked as a whole.
+func (c *Client) StackReport(csp cloud.CSP, stacks map[string][]cloud.Resource, reasons map[string]string, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	ids := make([]string, 0, len(stacks))
+	for id := range stacks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		username := stackOwner(stacks[id], accountUserMapping)
+		if username == "" {
+			log.Printf("Not sending the report of the stack %s, since it has no owner\n", id)
+			continue
+		}
+		mailData := &stackReportMailData{
+			Owner:     username,
+			Stack:     id,
+			CSP:       csp,
+			Resources: []stackResource{},
+		}
+		for _, res := range stacks[id] {
+			mailData.Resources = append(mailData.Resources, stackResource{Resource: res, Reason: reasons[res.ID()]})
+		}
+
+		mailContent, err := generateMail(mailData, stackReportTemplate)
+		if err != nil {
+			log.Fatalln("Could not generate email:", err)
+		}
+		settings := c.mailSettings(username, stacks[id][0].Owner())
+		recipientMail := convertEmailExceptions(c.emailForUser(username, settings))
+		title := c.subject(StackReportMail, subjectData{Count: len(mailData.Resources), Owner: username, CSP: csp, Stack: id})
+		if c.outputReport(mailContent, resourceRecords(StackReportMail, recipientMail, stacks[id])) {
+			continue
+		}
+		if c.isDuplicateMail(recipientMail, stackReportTemplate, title, mailContent) {
+			continue
+		}
+		log.Printf("Sending out the report of the stack %s to %s\n", id, recipientMail)
+		err = c.deliverMail(settings, title, mailContent, recipientMail)
+		if err != nil {
+			log.Printf("Failed to email %s: %s\n", recipientMail, err)
+			continue
+		}
+		c.recordMail(recipientMail, stackReportTemplate, mailContent)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+)
+
+// Names of the mails sent by Cloudsweeper, used to override their
+// subject in Config.Subjects
+const (
+	ReviewMail              = "review"
+	ManagerReviewMail       = "manager-review"
+	OrgReviewMail           = "org-review"
+	MergedReviewMail        = "merged-review"
+	UntaggedMail            = "untagged"
+	DeletionWarningMail     = "deletion-warning"
+	AutomationWarningMail   = "automation-warning"
+	MonthToDateMail         = "month-to-date"
+	MarkingDryRunMail       = "marking-dry-run"
+	RetentionLapsedMail     = "retention-lapsed"
+	AccountSummaryMail      = "account-summary"
+	StopWarningMail         = "stop-warning"
+	CredentialHygieneMail   = "credential-hygiene"
+	WhitelistReportMail     = "whitelist-report"
+	CostAnomalyMail         = "cost-anomaly"
+	OrphanMail              = "orphan"
+	StackReportMail         = "stack-report"
+	WhitelistExpiryMail     = "whitelist-expiry"
+	WhitelistReapprovalMail = "whitelist-reapproval"
+)
+
+// subjectData is the data available to subject templates. Fields that
+// don't apply to a mail, such as Hours for a review, are empty.
+type subjectData struct {
+	// Count is the number of resources listed in the mail, or the
+	// number of accounts for an account summary
+	Count int
+	// Date is the current date, on the form YYYY-MM-DD
+	Date string
+	// Account is the account/project the resources belong to, on the
+	// form "alias (ID)" if it has an alias, see cloud.AccountName
+	Account string
+	// Owner is the username the mail is sent to
+	Owner string
+	// Hours is the number of hours until resources are cleaned up
+	Hours int
+	CSP   cloud.CSP
+	// Mail is the name of the mail, such as ReviewMail
+	Mail string
+	// Stack is the ID of the stack a stack report is about
+	Stack string
+	// Marked is the number of resources in the mail that are marked
+	// for deletion, and CostPerMonth their estimated monthly cost
+	Marked       int
+	CostPerMonth float64
+}
+
+// SubjectNames returns the names of all mails whose subject can be
+// overridden, in alphabetical order
+func SubjectNames() []string {
+	names := []string{}
+	for name := range defaultSubjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateSubjects checks that subject templates only override known
+// mails, and that they can be rendered
+func ValidateSubjects(subjects map[string]string) error {
+	for name, subject := range subjects {
+		if _, exist := defaultSubjects[name]; !exist {
+			return fmt.Errorf("Unknown mail: %s", name)
+		}
+		if _, err := generateSubject(subject, subjectData{}); err != nil {
+			return fmt.Errorf("Invalid subject for %s mail: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateSubjectBadge checks that a subject badge template can be
+// rendered
+func ValidateSubjectBadge(badge string) error {
+	_, err := generateSubject(badge, subjectData{})
+	return err
+}
+
+// subject renders the subject of a mail, using the configured subject
+// template if there is one. The subject is prefixed with the rendered
+// SubjectBadge, if one is configured.
+func (c *Client) subject(name string, data subjectData) string {
+	subjectTemplate, exist := c.config.Subjects[name]
+	if !exist {
+		subjectTemplate = defaultSubjects[name]
+	}
+	data.Date = clock.Now().Format("2006-01-02")
+	data.Mail = name
+	data.Account = cloud.AccountName(data.Account)
+	subject, err := generateSubject(subjectTemplate, data)
+	if err != nil {
+		log.Fatalf("Could not generate subject of %s mail: %s", name, err)
+	}
+	if c.config.SubjectBadge == "" {
+		return subject
+	}
+	badge, err := generateSubject(c.config.SubjectBadge, data)
+	if err != nil {
+		log.Fatalf("Could not generate subject badge of %s mail: %s", name, err)
+	}
+	return badge + " " + subject
+}
+
+func generateSubject(subjectTemplate string, data subjectData) (string, error) {
+	t, err := template.New("subjectTemplate").Funcs(template.FuncMap{"lower": strings.ToLower}).Parse(subjectTemplate)
+	if err != nil {
+		return "", err
+	}
+	var result bytes.Buffer
+	err = t.Execute(&result, data)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+)
+
+// daysPerMonth is used to estimate the monthly cost of resources
+const daysPerMonth = 30.0
+
+// accountSummary summarizes the resources of a single account
+type accountSummary struct {
+	Account       string
+	Instances     int
+	Images        int
+	Volumes       int
+	Snapshots     int
+	Buckets       int
+	Tables        int
+	CacheClusters int
+	// ReviewCount is the number of resources sent for review
+	ReviewCount int
+	// CostPerMonth is the estimated monthly cost of all resources
+	CostPerMonth float64
+	// MarkedCount is the number of resources marked for deletion
+	MarkedCount int
+	// NextDeletion is when the first marked resource is cleaned up,
+	// it's zero if no resources are marked
+	NextDeletion time.Time
+}
+
+type accountSummaryMailData struct {
+	Owner    string
+	Accounts []*accountSummary
+}
+
+// TotalCostPerMonth is the estimated monthly cost of all accounts
+func (d *accountSummaryMailData) TotalCostPerMonth() float64 {
+	total := 0.0
+	for _, account := range d.Accounts {
+		total += account.CostPerMonth
+	}
+	return total
+}
+
+// TotalMarkedCount is the number of resources marked in all accounts
+func (d *accountSummaryMailData) TotalMarkedCount() int {
+	total := 0
+	for _, account := range d.Accounts {
+		total += account.MarkedCount
+	}
+	return total
+}
+
+// summarizeAccount summarizes the resources found in an account, and how
+// many of them were sent for review
+func summarizeAccount(account string, resources *cloud.ResourceCollection, buckets []cloud.Bucket, tables []cloud.Table, cacheClusters []cloud.CacheCluster, reviewCount int) *accountSummary {
+	summary := &accountSummary{
+		Account:       account,
+		Instances:     len(resources.Instances),
+		Images:        len(resources.Images),
+		Volumes:       len(resources.Volumes),
+		Snapshots:     len(resources.Snapshots),
+		Buckets:       len(buckets),
+		Tables:        len(tables),
+		CacheClusters: len(cacheClusters),
+		ReviewCount:   reviewCount,
+	}
+	add := func(res cloud.Resource) {
+		summary.CostPerMonth += costPerMonth(res)
+		deleteAt, exist := res.Tags()[filter.DeleteTagKey]
+		if !exist {
+			return
+		}
+		summary.MarkedCount++
+		deleteAtTime, err := time.Parse(time.RFC3339, deleteAt)
+		if err != nil {
+			log.Printf("%s has malformed deletion tag: %s\n", res.ID(), deleteAt)
+			return
+		}
+		if summary.NextDeletion.IsZero() || deleteAtTime.Before(summary.NextDeletion) {
+			summary.NextDeletion = deleteAtTime
+		}
+	}
+	for _, res := range resources.Instances {
+		add(res)
+	}
+	for _, res := range resources.Images {
+		add(res)
+	}
+	for _, res := range resources.Volumes {
+		add(res)
+	}
+	for _, res := range resources.Snapshots {
+		add(res)
+	}
+	for _, res := range buckets {
+		add(res)
+	}
+	for _, res := range tables {
+		add(res)
+	}
+	for _, res := range cacheClusters {
+		add(res)
+	}
+	return summary
+}
+
+func costPerMonth(res cloud.Resource) float64 {
+	if bucket, ok := res.(cloud.Bucket); ok {
+		return billing.BucketPricePerMonth(bucket)
+	}
+	return billing.ResourceCostPerDay(res) * daysPerMonth
+}
+
+// sendAccountSummaries sends a summary of all their accounts to every
+// employee who opted in to it
+func (c *Client) sendAccountSummaries(org *cs.Organization, csp cloud.CSP, summaries map[string]*accountSummary) {
+	for _, employee := range org.Employees {
+		if !employee.AccountSummary || employee.Disabled {
+			continue
+		}
+		log.Printf("Collecting account summary for %s\n", employee.Username)
+		mailData := &accountSummaryMailData{
+			Owner:    employee.Username,
+			Accounts: []*accountSummary{},
+		}
+		for _, account := range employee.Accounts(csp) {
+			if summary, exist := summaries[account]; exist {
+				mailData.Accounts = append(mailData.Accounts, summary)
+			}
+		}
+		if len(mailData.Accounts) == 0 {
+			continue
+		}
+		sort.Slice(mailData.Accounts, func(i, j int) bool {
+			costI, costJ := mailData.Accounts[i].CostPerMonth, mailData.Accounts[j].CostPerMonth
+			if costI != costJ || !cloud.Ordered {
+				return costI > costJ
+			}
+			return mailData.Accounts[i].Account < mailData.Accounts[j].Account
+		})
+
+		mailContent, err := generateMail(mailData, accountSummaryTemplate)
+		if err != nil {
+			log.Fatalln("Could not generate email:", err)
+		}
+		settings := c.mailSettings(employee.Username, "")
+		recipientMail := convertEmailExceptions(c.emailForUser(employee.Username, settings))
+		title := c.subject(AccountSummaryMail, subjectData{Count: len(mailData.Accounts), Owner: employee.Username, CSP: csp, Marked: mailData.TotalMarkedCount(), CostPerMonth: mailData.TotalCostPerMonth()})
+		if c.outputReport(mailContent, []OutputRecord{}) {
+			continue
+		}
+		if c.isDuplicateMail(recipientMail, accountSummaryTemplate, title, mailContent) {
+			continue
+		}
+		log.Printf("Sending out account summary to %s\n", recipientMail)
+		err = c.deliverMail(settings, title, mailContent, recipientMail)
+		if err != nil {
+			log.Printf("Failed to email %s: %s\n", recipientMail, err)
+			continue
+		}
+		c.recordMail(recipientMail, accountSummaryTemplate, mailContent)
+	}
+}
@@ -3,7 +3,33 @@
 
 package notify
 
-const reviewMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+// defaultSubjects are the subject templates of every mail, unless they
+// are overridden in Config.Subjects. See subjectData for the variables.
+var defaultSubjects = map[string]string{
+	ReviewMail:              "You have {{ .Count }} old {{ .CSP }} resources to review ({{ .Date }})",
+	ManagerReviewMail:       "Your team has {{ .Count }} old {{ .CSP }} resources to review ({{ .Date }})",
+	OrgReviewMail:           "Your org has {{ .Count }} old {{ .CSP }} resources to review ({{ .Date }})",
+	MergedReviewMail:        "You have {{ .Count }} old {{ .CSP }} resources to review ({{ .Date }})",
+	UntaggedMail:            "You have {{ .Count }} un-tagged resources to review ({{ .Date }})",
+	DeletionWarningMail:     "Deletion warning, {{ .Count }} resources are cleaned up within {{ .Hours }} hours",
+	AutomationWarningMail:   "Deletion warning, {{ .Count }} automation resources are cleaned up within {{ .Hours }} hours",
+	MonthToDateMail:         "Month-to-date {{ .CSP }} billing report",
+	MarkingDryRunMail:       "Marking Dry Run Warning. The following resources would have been marked for deletion:",
+	RetentionLapsedMail:     "You have {{ .Count }} backups whose retention has lapsed ({{ .Date }})",
+	AccountSummaryMail:      "Summary of your {{ .Count }} accounts ({{ .Date }})",
+	StopWarningMail:         "Stop warning, {{ .Count }} instances are stopped within {{ .Hours }} hours",
+	CredentialHygieneMail:   "You have {{ .Count }} stale {{ .CSP }} access keys to rotate ({{ .Date }})",
+	WhitelistReportMail:     "{{ .Count }} whitelisted {{ .CSP }} resources cost ${{ printf `%.0f` .CostPerMonth }}/month ({{ .Date }})",
+	CostAnomalyMail:         "The {{ .CSP }} cost of {{ .Account }} jumped ({{ .Date }})",
+	OrphanMail:              "You have {{ .Count }} volumes and snapshots left behind by terminated instances ({{ .Date }})",
+	StackReportMail:         "The stack {{ .Stack }} has {{ .Count }} old {{ .CSP }} resources to review ({{ .Date }})",
+	WhitelistExpiryMail:     "The whitelisting of {{ .Count }} {{ .CSP }} resources expires soon ({{ .Date }})",
+	WhitelistReapprovalMail: "{{ .Count }} whitelisted {{ .CSP }} resources need to be approved again ({{ .Date }})",
+}
+
+// reviewIntro is the start of the review mails, on what owners can do
+// about their old resources
+const reviewIntro = `<h1>Hello {{ .Owner -}},</h1>
 
 <p>
 In a weekly review, Cloudsweeper has detected resources that may be out of use, based upon their age
@@ -30,6 +56,11 @@ Conversely, if you see a resource here that you know that you want to keep for a
 whitelist it: add a tag with the key "cloudsweeper-whitelisted" to it.
 </p>
 
+<p>
+To let others know why a resource is needed, add a tag with the key "cloudsweeper-note" and a short
+note as value, e.g. "needed for Q4 audit, contact alice". The note is shown next to the resource in all reports.
+</p>
+
 <p>
 To schedule automated clean up, please add one of the following two types of tags (key: value) to your resource:
 <br />
@@ -38,16 +69,18 @@ To schedule automated clean up, please add one of the following two types of tag
 "<b>cloudsweeper-expiry</b>: YYYY-MM-DD", to clean a resource up after the specified date, e.g. 2018-01-30
 </p>
 
-<p>
-Read more about how Cloudsweeper works and how to better tag your resources at
-<a href="#">this Wiki page</a>.
-</p>
+` + generalRunbookSection + `
 
 <h2>Old resources:</h2>
 <p>
 Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
 </p>
-{{ if gt (len .Instances) 0 }}
+`
+
+// reviewResourcesSection lists the old resources of a review. It's a
+// template of its own, so the merged review can list the resources of
+// each account in a section, see mergeReviews.
+const reviewResourcesSection = `{{ define "review-resources" }}{{ if gt (len .Instances) 0 }}
 	<h3>Instances</h3>
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
@@ -59,11 +92,14 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Instance type</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
-			<th><strong>Total cost</strong></th>
+			<th><strong>Compute cost</strong></th>
+			<th><strong>Attached storage cost</strong></th>
+			<th><strong>IPv4 cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+			<td>{{ account $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
 			<td>{{ $instance.ID }}</td>
@@ -71,7 +107,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $instance.InstanceType }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
-			<td>{{ accucost $instance }}</td>
+			<td>{{ computecost $instance }}</td>
+			<td>{{ printf "$%.2f" ($.StorageCost $instance) }}</td>
+			<td>{{ ipv4cost $instance }}</td>
+			<td>{{ note $instance }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -86,20 +125,24 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
+			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $image := .Images }}
 	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+			<td>{{ account $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
 			<td>{{ $image.ID }}</td>
 			<td>{{ $image.Name }}</td>
+			<td>{{ $image.SizeGB }} GB</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
 			<td>{{ accucost $image }}</td>
+			<td>{{ note $image }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -118,11 +161,14 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Volume type</strong></th>
+			<th><strong>Replication</strong></th>
+			<th><strong>Provisioned performance</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ account $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
 			<td>{{ $volume.ID }}</td>
@@ -131,7 +177,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
 			<td>{{ $volume.VolumeType }}</td>
+			<td>{{ volumescope $volume }}</td>
+			<td>{{ volumeperformance $volume }}</td>
 			<td>{{ accucost $volume }}</td>
+			<td>{{ note $volume }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -149,10 +198,11 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ account $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
 			<td>{{ $snapshot.ID }}</td>
@@ -160,6 +210,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -177,38 +228,127 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+			<td>{{ account $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
 			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "%.3f GB" $bucket.TotalSizeGB }}{{ else }}Unknown{{ end }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
-			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "$%.3f" (bucketcost $bucket) }}{{ else }}Unknown{{ end }}</td>
+			<td>{{ note $bucket }}</td>
 		</tr>
 	{{ end }}
 	</table>
 {{ end }}
 
+` + dataServicesSection + `
+` + inUseStorageSection + `
+` + databaseSection + `
+` + maxLifetimeSection + `
+` + dashboardSection + `
+{{ end }}`
+
+// reviewFooter is the end of the review mails
+const reviewFooter = runbookSection + `
+` + partialDataSection + `
+` + costEstimateSection + `
+` + reviewPolicySection + `
 <p>
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
 `
 
+const reviewMailTemplate = reviewIntro + `{{ template "review-resources" . }}` + reviewFooter + reviewResourcesSection
+
+// mergedReviewMailTemplate is the review of an owner with accounts in
+// several CSPs, with a section for each account
+const mergedReviewMailTemplate = reviewIntro + `{{ range .Sections }}
+<h2>{{ .CSP }}: {{ account .OwnerID }}</h2>
+{{ template "review-resources" . }}{{ end }}` + reviewFooter + reviewResourcesSection
+
 const managerReviewMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
 
 <p>
 This is a summary of all old/unused resources for your team.
 </p>
 
-<h2>Old resources:</h2>
+{{ if gt (len .Teams) 1 }}
+<h2>Old resources per team:</h2>
+<table>
+	<tr style="text-align:left;">
+		<th><strong>Team of</strong></th>
+		<th><strong>Resources</strong></th>
+		<th><strong>Total cost</strong></th>
+	</tr>
+{{ range $i, $team := .Teams }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ $team.Manager }}</td>
+		<td>{{ $team.ResourceCount }}</td>
+		<td>{{ printf "$%.2f" $team.TotalCost }}</td>
+	</tr>
+{{ end }}
+</table>
+{{ end }}
+
+` + rollupSection + `
+` + dashboardSection + `
+` + partialDataSection + `
+` + costEstimateSection + `
+` + reviewPolicySection + `
 <p>
-Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const totalReviewMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+This is a summary of all old/unused resources for your org.
+</p>
+
+` + rollupSection + `
+` + tagConflictSection + `
+` + dashboardSection + `
+` + partialDataSection + `
+` + costEstimateSection + `
+` + reviewPolicySection + `
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
 </p>
+`
+
+const deletionWarningTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Resources will be cleaned up within {{ .HoursInAdvance }} hours</h2>
+<p>
+Unless you take action, the resources listed below will be cleaned up
+from your account within the next {{ .HoursInAdvance }} hours. <b>Make sure
+you don't need to keep any of these resources</b>
+</p>
+
+` + reminderSection + `
+{{ if gt .DataSizeGB 0.0 }}
+<p>
+In total, <b>{{ printf "%.1f" .DataSizeGB }} GB</b> of data in volumes, snapshots,
+buckets and tables will be destroyed.
+</p>
+{{ end }}
+
+<p>
+If you want to save any of these resources, add a tag with the key <b>whitelisted</b>
+</p>
+
+` + generalRunbookSection + `
+
+<h2>Old resources:</h2>
 {{ if gt (len .Instances) 0 }}
 	<h3>Instances</h3>
 	<table style="width: 100%;">
@@ -221,11 +361,14 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Instance type</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
-			<th><strong>Total cost</strong></th>
+			<th><strong>Compute cost</strong></th>
+			<th><strong>Attached storage cost</strong></th>
+			<th><strong>IPv4 cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $instance := .Instances }}
-		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
 			<td>{{ $instance.ID }}</td>
@@ -233,7 +376,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $instance.InstanceType }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
-			<td>{{ accucost $instance }}</td>
+			<td>{{ computecost $instance }}</td>
+			<td>{{ printf "$%.2f" ($.StorageCost $instance) }}</td>
+			<td>{{ ipv4cost $instance }}</td>
+			<td>{{ note $instance }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -248,20 +394,24 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
+			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $image := .Images }}
-	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
 			<td>{{ $image.ID }}</td>
 			<td>{{ $image.Name }}</td>
+			<td>{{ $image.SizeGB }} GB</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
 			<td>{{ accucost $image }}</td>
+			<td>{{ note $image }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -280,11 +430,14 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Volume type</strong></th>
+			<th><strong>Replication</strong></th>
+			<th><strong>Provisioned performance</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $volume := .Volumes }}
-	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
 			<td>{{ $volume.ID }}</td>
@@ -293,7 +446,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
 			<td>{{ $volume.VolumeType }}</td>
+			<td>{{ volumescope $volume }}</td>
+			<td>{{ volumeperformance $volume }}</td>
 			<td>{{ accucost $volume }}</td>
+			<td>{{ note $volume }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -311,10 +467,11 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
-	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
 			<td>{{ $snapshot.ID }}</td>
@@ -322,6 +479,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -339,43 +497,128 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
-	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
 			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "%.3f GB" $bucket.TotalSizeGB }}{{ else }}Unknown{{ end }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
-			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "$%.3f" (bucketcost $bucket) }}{{ else }}Unknown{{ end }}</td>
+			<td>{{ note $bucket }}</td>
 		</tr>
 	{{ end }}
 	</table>
 {{ end }}
 
+` + dataServicesSection + `
+` + maxLifetimeSection + `
+` + runbookSection + `
+` + partialDataSection + `
+` + costEstimateSection + `
+` + cleanupPolicySection + `
 <p>
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
 `
 
-const totalReviewMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+const stopWarningTemplate = `<h1>Hello {{ .Owner -}},</h1>
 
+<h2>Instances will be stopped within {{ .HoursInAdvance }} hours</h2>
 <p>
-This is a summary of all old/unused resources for your org.
+Unless you take action, the instances listed below will be stopped within
+the next {{ .HoursInAdvance }} hours. They are not deleted, and can be
+started again at any time. <b>Make sure nothing depends on these instances
+running</b>
 </p>
 
-<h2>Old resources:</h2>
+` + reminderSection + `
 <p>
-Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+If you want to keep any of these instances running, add a tag with the key <b>whitelisted</b>
+</p>
+
+<h2>Instances to be stopped:</h2>
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Product</strong></th>
+		<th><strong>Role</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Name</strong></th>
+		<th><strong>Instance type</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Created</strong></th>
+		<th><strong>Compute cost</strong></th>
+		<th><strong>Attached storage cost</strong></th>
+		<th><strong>IPv4 cost</strong></th>
+		<th><strong>Note</strong></th>
+	</tr>
+{{ range $i, $instance := .Instances }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ account $instance.Owner }}</td>
+		<td>{{ productname $instance }}</td>
+		<td>{{ rolename $instance }}</td>
+		<td>{{ $instance.ID }}</td>
+		<td>{{ instname $instance }}</td>
+		<td>{{ $instance.InstanceType }}</td>
+		<td>{{ $instance.Location }}</td>
+		<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+		<td>{{ computecost $instance }}</td>
+		<td>{{ printf "$%.2f" ($.StorageCost $instance) }}</td>
+		<td>{{ ipv4cost $instance }}</td>
+		<td>{{ note $instance }}</td>
+	</tr>
+{{ end }}
+</table>
+
+` + maxLifetimeSection + `
+` + runbookSection + `
+` + partialDataSection + `
+` + costEstimateSection + `
+` + cleanupPolicySection + `
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const automationWarningTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>Automation resources will be cleaned up within {{ .HoursInAdvance }} hours</h2>
+<p>
+Unless you take action, the resources listed below will be cleaned up
+within the next {{ .HoursInAdvance }} hours. These resources were created by
+automation principals (such as CI roles), which is why they are sent to you
+instead of the account owners. <b>Make sure none of these resources are
+still needed</b>
+</p>
+
+` + reminderSection + `
+{{ if gt .DataSizeGB 0.0 }}
+<p>
+In total, <b>{{ printf "%.1f" .DataSizeGB }} GB</b> of data in volumes, snapshots,
+buckets and tables will be destroyed.
+</p>
+{{ end }}
+
+<p>
+If you want to save any of these resources, add a tag with the key <b>whitelisted</b>
 </p>
+
+` + generalRunbookSection + `
+
+<h2>Old resources:</h2>
 {{ if gt (len .Instances) 0 }}
 	<h3>Instances</h3>
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
+			<th><strong>Created by</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
@@ -383,11 +626,15 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Instance type</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
-			<th><strong>Total cost</strong></th>
+			<th><strong>Compute cost</strong></th>
+			<th><strong>Attached storage cost</strong></th>
+			<th><strong>IPv4 cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $instance := .Instances }}
-		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $instance.Owner }}</td>
+			<td>{{ creator $instance }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
 			<td>{{ $instance.ID }}</td>
@@ -395,7 +642,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $instance.InstanceType }}</td>
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
-			<td>{{ accucost $instance }}</td>
+			<td>{{ computecost $instance }}</td>
+			<td>{{ printf "$%.2f" ($.StorageCost $instance) }}</td>
+			<td>{{ ipv4cost $instance }}</td>
+			<td>{{ note $instance }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -406,24 +656,30 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
+			<th><strong>Created by</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
+			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $image := .Images }}
-	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $image.Owner }}</td>
+			<td>{{ creator $image }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
 			<td>{{ $image.ID }}</td>
 			<td>{{ $image.Name }}</td>
+			<td>{{ $image.SizeGB }} GB</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
 			<td>{{ accucost $image }}</td>
+			<td>{{ note $image }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -434,6 +690,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
+			<th><strong>Created by</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
@@ -442,11 +699,15 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Volume type</strong></th>
+			<th><strong>Replication</strong></th>
+			<th><strong>Provisioned performance</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $volume := .Volumes }}
-	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $volume.Owner }}</td>
+			<td>{{ creator $volume }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
 			<td>{{ $volume.ID }}</td>
@@ -455,7 +716,10 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
 			<td>{{ $volume.VolumeType }}</td>
+			<td>{{ volumescope $volume }}</td>
+			<td>{{ volumeperformance $volume }}</td>
 			<td>{{ accucost $volume }}</td>
+			<td>{{ note $volume }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -466,6 +730,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
+			<th><strong>Created by</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
@@ -473,10 +738,12 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
-	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $snapshot.Owner }}</td>
+			<td>{{ creator $snapshot }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
 			<td>{{ $snapshot.ID }}</td>
@@ -484,6 +751,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -494,6 +762,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
+			<th><strong>Created by</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
@@ -501,45 +770,74 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
-	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $bucket.Owner }}</td>
+			<td>{{ creator $bucket }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
 			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "%.3f GB" $bucket.TotalSizeGB }}{{ else }}Unknown{{ end }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
-			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "$%.3f" (bucketcost $bucket) }}{{ else }}Unknown{{ end }}</td>
+			<td>{{ note $bucket }}</td>
 		</tr>
 	{{ end }}
 	</table>
 {{ end }}
 
+` + dataServicesSection + `
+` + maxLifetimeSection + `
+` + runbookSection + `
+` + partialDataSection + `
+` + costEstimateSection + `
+` + cleanupPolicySection + `
 <p>
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
 `
 
-const deletionWarningTemplate = `<h1>Hello {{ .Owner -}},</h1>
+const markingDryRunTemplate = `<h1>Hello {{ .Owner -}},</h1>
 
-<h2>Resources will be cleaned up within {{ .HoursInAdvance }} hours</h2>
+<h2>Resources would have been deleted if this was not a dry run</h2>
 <p>
-Unless you take action, the resources listed below will be cleaned up
-from your account within the next {{ .HoursInAdvance }} hours. <b>Make sure
-you don't need to keep any of these resources</b>
-</p>
+These are the resources that would have been marked if this was a real run. Please
+look over these and make sure everything is in order. </p>
 
 <p>
 If you want to save any of these resources, add a tag with the key <b>whitelisted</b>
 </p>
 
-<p>
-Read more about how Cloudsweeper works and how to better tag your resources at
-<a href="#">this Wiki page</a>.
-</p>
+{{ if gt (len .MarkingOrder) 0 }}
+	<h2>Marking priority:</h2>
+	<p>
+	Resources are marked in the order listed below, the most expensive first. If the
+	number of resources that can be marked per run is limited, the ones at the top are
+	marked first.
+	</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Priority</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Cost</strong></th>
+		</tr>
+	{{ range $i, $res := .MarkingOrder }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ inc $i }}</td>
+			<td>{{ resourcetype $res }}</td>
+			<td>{{ $res.ID }}</td>
+			<td>{{ $res.Location }}</td>
+			<td>{{ markingcost $res }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
 
 <h2>Old resources:</h2>
 {{ if gt (len .Instances) 0 }}
@@ -555,10 +853,12 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>IPv4 cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
+			<td>{{ account $instance.Owner }}</td>
 			<td>{{ productname $instance }}</td>
 			<td>{{ rolename $instance }}</td>
 			<td>{{ $instance.ID }}</td>
@@ -567,6 +867,8 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<td>{{ $instance.Location }}</td>
 			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
 			<td>{{ accucost $instance }}</td>
+			<td>{{ ipv4cost $instance }}</td>
+			<td>{{ note $instance }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -581,20 +883,24 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
+			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $image := .Images }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
+			<td>{{ account $image.Owner }}</td>
 			<td>{{ productname $image }}</td>
 			<td>{{ rolename $image }}</td>
 			<td>{{ $image.ID }}</td>
 			<td>{{ $image.Name }}</td>
+			<td>{{ $image.SizeGB }} GB</td>
 			<td>{{ $image.Location }}</td>
 			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
 			<td>{{ accucost $image }}</td>
+			<td>{{ note $image }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -613,11 +919,14 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<th><strong>Attached to instance</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Volume type</strong></th>
+			<th><strong>Replication</strong></th>
+			<th><strong>Provisioned performance</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ account $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
 			<td>{{ $volume.ID }}</td>
@@ -626,7 +935,10 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<td>{{ yesno $volume.Attached }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
 			<td>{{ $volume.VolumeType }}</td>
+			<td>{{ volumescope $volume }}</td>
+			<td>{{ volumeperformance $volume }}</td>
 			<td>{{ accucost $volume }}</td>
+			<td>{{ note $volume }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -644,10 +956,11 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ account $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
 			<td>{{ $snapshot.ID }}</td>
@@ -655,6 +968,7 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<td>{{ $snapshot.Location }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -672,42 +986,105 @@ Read more about how Cloudsweeper works and how to better tag your resources at
 			<th><strong>Files</strong></th>
 			<th><strong>Modified in < 6 months</strong></th>
 			<th><strong>Monthly cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $bucket := .Buckets }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
+			<td>{{ account $bucket.Owner }}</td>
 			<td>{{ productname $bucket }}</td>
 			<td>{{ rolename $bucket }}</td>
 			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "%.3f GB" $bucket.TotalSizeGB }}{{ else }}Unknown{{ end }}</td>
 			<td>{{ $bucket.ObjectCount }}</td>
 			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
-			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "$%.3f" (bucketcost $bucket) }}{{ else }}Unknown{{ end }}</td>
+			<td>{{ note $bucket }}</td>
 		</tr>
 	{{ end }}
 	</table>
 {{ end }}
 
+` + dataServicesSection + `
+` + costEstimateSection + `
+` + cleanupPolicySection + `
 <p>
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
 `
 
-const markingDryRunTemplate = `<h1>Hello {{ .Owner -}},</h1>
+const accountSummaryTemplate = `<h1>Hello {{ .Owner -}},</h1>
 
-<h2>Resources would have been deleted if this was not a dry run</h2>
+<h2>Summary of your accounts</h2>
 <p>
-These are the resources that would have been marked if this was a real run. Please
-look over these and make sure everything is in order. </p>
+This is a summary of all your accounts, from the resources found during the
+latest review. Resources in review are listed in the review email of each account.
+The run-rate is an estimate of the monthly cost of all resources in the account.
+</p>
 
 <p>
-If you want to save any of these resources, add a tag with the key <b>whitelisted</b>
+<strong>Total run-rate:</strong> ${{ printf "%.2f" .TotalCostPerMonth }} per month<br />
+<strong>Resources marked for deletion:</strong> {{ .TotalMarkedCount }}
 </p>
 
-<h2>Old resources:</h2>
-{{ if gt (len .Instances) 0 }}
-	<h3>Instances</h3>
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Instances</strong></th>
+		<th><strong>Images</strong></th>
+		<th><strong>Volumes</strong></th>
+		<th><strong>Snapshots</strong></th>
+		<th><strong>Buckets</strong></th>
+		<th><strong>Tables</strong></th>
+		<th><strong>Cache clusters</strong></th>
+		<th><strong>In review</strong></th>
+		<th><strong>Run-rate per month</strong></th>
+		<th><strong>Marked</strong></th>
+		<th><strong>Next deletion</strong></th>
+	</tr>
+{{ range $i, $account := .Accounts }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ account $account.Account }}</td>
+		<td>{{ $account.Instances }}</td>
+		<td>{{ $account.Images }}</td>
+		<td>{{ $account.Volumes }}</td>
+		<td>{{ $account.Snapshots }}</td>
+		<td>{{ $account.Buckets }}</td>
+		<td>{{ $account.Tables }}</td>
+		<td>{{ $account.CacheClusters }}</td>
+		<td>{{ $account.ReviewCount }}</td>
+		<td>${{ printf "%.2f" $account.CostPerMonth }}</td>
+		<td>{{ $account.MarkedCount }}</td>
+		<td>{{ if $account.NextDeletion.IsZero }}-{{ else }}{{ fdate $account.NextDeletion "2006-01-02" }}{{ end }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const retentionLapsedTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>The retention of these backups has lapsed</h2>
+<p>
+The images and snapshots listed below were kept because they have a retention
+tag. Their retention period has now passed, so they are no longer required for
+compliance and can be removed. Cloudsweeper handles them like any other resource
+from now on.
+</p>
+
+<p>
+If you still need any of these resources, extend their retention tag or add a tag
+with the key <b>whitelisted</b>
+</p>
+
+<h2>Backups with lapsed retention:</h2>
+<p><strong>Account ID:</strong> {{ account .OwnerID }}</p>
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
@@ -715,55 +1092,90 @@ If you want to save any of these resources, add a tag with the key <b>whiteliste
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
 			<th><strong>Name</strong></th>
-			<th><strong>Instance type</strong></th>
+			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
+			<th><strong>Retained until</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
-	{{ range $i, $instance := .Instances }}
+	{{ range $i, $image := .Images }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $instance.Owner }}</td>
-			<td>{{ productname $instance }}</td>
-			<td>{{ rolename $instance }}</td>
-			<td>{{ $instance.ID }}</td>
-			<td>{{ instname $instance }}</td>
-			<td>{{ $instance.InstanceType }}</td>
-			<td>{{ $instance.Location }}</td>
-			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
-			<td>{{ accucost $instance }}</td>
+			<td>{{ account $image.Owner }}</td>
+			<td>{{ productname $image }}</td>
+			<td>{{ rolename $image }}</td>
+			<td>{{ $image.ID }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ $image.SizeGB }} GB</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ retaineduntil $image }}</td>
+			<td>{{ accucost $image }}</td>
+			<td>{{ note $image }}</td>
 		</tr>
 	{{ end }}
 	</table>
 {{ end }}
 
-{{ if gt (len .Images) 0 }}
-	<h3>Images</h3>
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
 	<table style="width: 100%;">
 		<tr style="text-align:left;">
 			<th><strong>Account</strong></th>
 			<th><strong>Product</strong></th>
 			<th><strong>Role</strong></th>
 			<th><strong>ID</strong></th>
-			<th><strong>Name</strong></th>
+			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
 			<th><strong>Created</strong></th>
+			<th><strong>Retained until</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
-	{{ range $i, $image := .Images }}
+	{{ range $i, $snapshot := .Snapshots }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $image.Owner }}</td>
-			<td>{{ productname $image }}</td>
-			<td>{{ rolename $image }}</td>
-			<td>{{ $image.ID }}</td>
-			<td>{{ $image.Name }}</td>
-			<td>{{ $image.Location }}</td>
-			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
-			<td>{{ accucost $image }}</td>
+			<td>{{ account $snapshot.Owner }}</td>
+			<td>{{ productname $snapshot }}</td>
+			<td>{{ rolename $snapshot }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ retaineduntil $snapshot }}</td>
+			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
 		</tr>
 	{{ end }}
 	</table>
 {{ end }}
 
+` + partialDataSection + `
+` + costEstimateSection + `
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const orphanTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>This storage was left behind by terminated instances</h2>
+<p>
+The volumes and snapshots listed below belonged to instances that Cloudsweeper
+terminated, since they were attached to them, were taken of their volumes or have
+tags referencing them. They are still costing money, but are no longer tracked
+together with their instance.
+</p>
+
+<p>
+To clean them up, include all of them in the next marking run with the Cloudsweeper
+command <b>owner include-orphans</b>, or single ones by adding a tag with the key
+<b>cloudsweeper-orphan-include</b>. They are then marked and cleaned up like other
+resources, after the usual warnings. If you still need any of them, add a tag with
+the key <b>whitelisted</b>
+</p>
+
+<p><strong>Account ID:</strong> {{ account .OwnerID }}</p>
 {{ if gt (len .Volumes) 0 }}
 	<h3>Volumes</h3>
 	<table style="width: 100%;">
@@ -774,23 +1186,23 @@ If you want to save any of these resources, add a tag with the key <b>whiteliste
 			<th><strong>ID</strong></th>
 			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
-			<th><strong>Attached to instance</strong></th>
+			<th><strong>Left behind by</strong></th>
 			<th><strong>Created</strong></th>
-			<th><strong>Volume type</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $volume := .Volumes }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $volume.Owner }}</td>
+			<td>{{ account $volume.Owner }}</td>
 			<td>{{ productname $volume }}</td>
 			<td>{{ rolename $volume }}</td>
 			<td>{{ $volume.ID }}</td>
 			<td>{{ $volume.SizeGB }} GB</td>
 			<td>{{ $volume.Location }}</td>
-			<td>{{ yesno $volume.Attached }}</td>
+			<td>{{ orphanof $volume }}</td>
 			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
-			<td>{{ $volume.VolumeType }}</td>
 			<td>{{ accucost $volume }}</td>
+			<td>{{ note $volume }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -806,81 +1218,317 @@ If you want to save any of these resources, add a tag with the key <b>whiteliste
 			<th><strong>ID</strong></th>
 			<th><strong>Size (GB)</strong></th>
 			<th><strong>Location</strong></th>
+			<th><strong>Left behind by</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
 		</tr>
 	{{ range $i, $snapshot := .Snapshots }}
 		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $snapshot.Owner }}</td>
+			<td>{{ account $snapshot.Owner }}</td>
 			<td>{{ productname $snapshot }}</td>
 			<td>{{ rolename $snapshot }}</td>
 			<td>{{ $snapshot.ID }}</td>
 			<td>{{ $snapshot.SizeGB }} GB</td>
 			<td>{{ $snapshot.Location }}</td>
+			<td>{{ orphanof $snapshot }}</td>
 			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
 			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
 		</tr>
 	{{ end }}
 	</table>
 {{ end }}
 
-{{ if gt (len .Buckets) 0 }}
-	<h3>Buckets</h3>
-	<table style="width: 100%;">
-		<tr style="text-align:left;">
-			<th><strong>Account</strong></th>
-			<th><strong>Product</strong></th>
-			<th><strong>Role</strong></th>
-			<th><strong>ID</strong></th>
-			<th><strong>Size (GB)</strong></th>
-			<th><strong>Files</strong></th>
-			<th><strong>Modified in < 6 months</strong></th>
-			<th><strong>Monthly cost</strong></th>
-		</tr>
-	{{ range $i, $bucket := .Buckets }}
-		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
-			<td>{{ $bucket.Owner }}</td>
-			<td>{{ productname $bucket }}</td>
-			<td>{{ rolename $bucket }}</td>
-			<td>{{ $bucket.ID }}</td>
-			<td>{{ printf "%.3f GB" $bucket.TotalSizeGB }}</td>
-			<td>{{ $bucket.ObjectCount }}</td>
-			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
-			<td>{{ printf "$%.3f" (bucketcost $bucket) }}</td>
-		</tr>
-	{{ end }}
-	</table>
-{{ end }}
-
+` + partialDataSection + `
+` + costEstimateSection + `
 <p>
 Thank you,<br />
 Your loyal Cloudsweeper
 </p>
 `
 
-const untaggedMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+const credentialHygieneTemplate = `<h1>Hello {{ .Owner -}},</h1>
 
+<h2>These {{ .CSP }} access keys should be rotated or removed</h2>
 <p>
-The following listed resources are missing proper <strong>env/product/role</strong> tags.
-These tags are important to help us track resource purpose and cost.
-You can always add other tags to resources, but should always include a <strong>env/product/role</strong> tag.
-You can read more about tagging rules in
-<a href="#">this wiki</a>.
+Long-lived access keys are a security risk, especially when they are old or no
+longer used. Please rotate the keys listed below, or delete them if they are not
+needed anymore.
 </p>
 
+<p><strong>Account ID:</strong> {{ account .OwnerID }}</p>
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Service account</strong></th>
+		<th><strong>Key ID</strong></th>
+		<th><strong>Created</strong></th>
+		<th><strong>Last used</strong></th>
+		<th><strong>Reason</strong></th>
+	</tr>
+{{ range $i, $key := .Keys }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ $key.Principal }}</td>
+		<td>{{ $key.ID }}</td>
+		<td>{{ fdate $key.CreationTime "2006-01-02" }} ({{ daysrunning $key.CreationTime }})</td>
+		<td>{{ if $key.LastUsedKnown }}{{ daysrunning $key.LastUsed }}{{ else }}Unknown{{ end }}</td>
+		<td>{{ $key.Reason }}</td>
+	</tr>
+{{ end }}
+</table>
+
+{{ if .UsageUnknown }}
 <p>
-Please tag these resources appropriately.
+The last use of some keys could not be looked up, so only their age was checked.
 </p>
+{{ end }}
 
 <p>
-Read more about how Cloudsweeper works and how to better tag your resources at
-<a href="#">this Wiki page</a>.
+Thank you,<br />
+Your loyal Cloudsweeper
 </p>
+`
 
-<h2>Untagged resources:</h2>
-<p><strong>Account ID:</strong> {{ .OwnerID }}</p>
+const whitelistReportTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>These {{ .CSP }} resources are whitelisted</h2>
 <p>
-Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+Whitelisted resources are never cleaned up by Cloudsweeper, so they keep costing
+money until someone removes them. Please challenge the most expensive ones with
+their owners, and ask them to remove the <b>cloudsweeper-whitelisted</b> tag from
+resources that are no longer needed.
+</p>
+
+<p>
+<strong>Whitelisted resources:</strong> {{ len .Resources }}<br />
+<strong>Cost per month:</strong> ${{ printf "%.2f" .CostPerMonth }}<br />
+<strong>Total cost:</strong> ${{ printf "%.2f" .TotalCost }}
+</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Owner</strong></th>
+		<th><strong>Type</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Created</strong></th>
+		<th><strong>Cost per month</strong></th>
+		<th><strong>Total cost</strong></th>
+		<th><strong>Note</strong></th>
+	</tr>
+{{ range $i, $res := .Resources }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ account $res.Resource.Owner }}</td>
+		<td>{{ $res.Employee }}</td>
+		<td>{{ resourcetype $res.Resource }}</td>
+		<td>{{ $res.Resource.ID }}</td>
+		<td>{{ $res.Resource.Location }}</td>
+		<td>{{ fdate $res.Resource.CreationTime "2006-01-02" }} ({{ daysrunning $res.Resource.CreationTime }})</td>
+		<td>${{ printf "%.2f" $res.CostPerMonth }}</td>
+		<td>${{ printf "%.2f" $res.TotalCost }}</td>
+		<td>{{ note $res.Resource }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>{{ costestimate }}</p>
+
+{{ if gt (len .PartialAccounts) 0 }}
+<p>
+Some regions of {{ join (accounts .PartialAccounts) ", " }} could not be scanned, so their
+whitelisted resources may be missing from this report.
+</p>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const whitelistExpiryTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>The whitelisting of these {{ .CSP }} resources expires soon</h2>
+<p>
+The resources listed below are whitelisted until the date in their <b>cloudsweeper-whitelisted</b>
+tag, which is within {{ .Days }} days. Once it has passed, Cloudsweeper handles them like any other
+resource, and they may be marked for cleanup.
+</p>
+
+<p>
+If you still need any of these resources, set their <b>cloudsweeper-whitelisted</b> tag to a later
+date (YYYY-MM-DD). Otherwise, please remove them yourself, or let Cloudsweeper clean them up.
+</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Type</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Created</strong></th>
+		<th><strong>Whitelisted until</strong></th>
+		<th><strong>Cost per month</strong></th>
+		<th><strong>Note</strong></th>
+	</tr>
+{{ range $i, $res := .Resources }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ account $res.Resource.Owner }}</td>
+		<td>{{ resourcetype $res.Resource }}</td>
+		<td>{{ $res.Resource.ID }}</td>
+		<td>{{ $res.Resource.Location }}</td>
+		<td>{{ fdate $res.Resource.CreationTime "2006-01-02" }} ({{ daysrunning $res.Resource.CreationTime }})</td>
+		<td>{{ fdate $res.Expires "2006-01-02" }}</td>
+		<td>${{ printf "%.2f" $res.CostPerMonth }}</td>
+		<td>{{ note $res.Resource }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>{{ costestimate }}</p>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const whitelistReapprovalTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>These {{ .CSP }} resources need to be approved again</h2>
+<p>
+The resources listed below belong to your team, and were whitelisted more than {{ .Days }} days
+ago. Whitelisted resources are never cleaned up by Cloudsweeper, so please check with their
+owners that they are still needed.
+</p>
+
+<p>
+To approve keeping a resource, have it whitelisted again, e.g. with the Cloudsweeper command
+<b>owner whitelist</b>. Otherwise, ask its owner to remove the <b>cloudsweeper-whitelisted</b> tag.
+</p>
+
+<p>
+<strong>Resources to approve:</strong> {{ len .Resources }}<br />
+<strong>Cost per month:</strong> ${{ printf "%.2f" .CostPerMonth }}<br />
+<strong>Total cost:</strong> ${{ printf "%.2f" .TotalCost }}
+</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Owner</strong></th>
+		<th><strong>Type</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Whitelisted</strong></th>
+		<th><strong>Cost per month</strong></th>
+		<th><strong>Total cost</strong></th>
+		<th><strong>Note</strong></th>
+	</tr>
+{{ range $i, $res := .Resources }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ account $res.Resource.Owner }}</td>
+		<td>{{ $res.Employee }}</td>
+		<td>{{ resourcetype $res.Resource }}</td>
+		<td>{{ $res.Resource.ID }}</td>
+		<td>{{ $res.Resource.Location }}</td>
+		<td>{{ fdate $res.Since "2006-01-02" }} ({{ daysrunning $res.Since }})</td>
+		<td>${{ printf "%.2f" $res.CostPerMonth }}</td>
+		<td>${{ printf "%.2f" $res.TotalCost }}</td>
+		<td>{{ note $res.Resource }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>{{ costestimate }}</p>
+
+{{ if gt (len .PartialAccounts) 0 }}
+<p>
+Some regions of {{ join (accounts .PartialAccounts) ", " }} could not be scanned, so their
+whitelisted resources may be missing from this report.
+</p>
+{{ end }}
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const stackReportTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>The stack {{ .Stack }} has old resources</h2>
+<p>
+The {{ .CSP }} resources listed below would have been marked for cleanup, but they are
+managed by the stack <b>{{ .Stack }}</b> according to their <b>cloudsweeper-managed-by</b>
+tag. Resources of a stack are never marked one by one, since that would leave the stack
+half deleted.
+</p>
+
+<p>
+If they are no longer needed, remove them from the stack in your pipeline, or have the
+whole stack marked for cleanup with the Cloudsweeper command <b>mark-stack</b>. Every
+resource of the stack is then cleaned up at the same time, after the usual warnings.
+</p>
+
+<p>
+<strong>Resources:</strong> {{ len .Resources }}<br />
+<strong>Total cost:</strong> ${{ printf "%.2f" .TotalCost }}
+</p>
+
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>Account</strong></th>
+		<th><strong>Type</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Created</strong></th>
+		<th><strong>Reason</strong></th>
+		<th><strong>Total cost</strong></th>
+		<th><strong>Note</strong></th>
+	</tr>
+{{ range $i, $res := .Resources }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ account $res.Resource.Owner }}</td>
+		<td>{{ resourcetype $res.Resource }}</td>
+		<td>{{ $res.Resource.ID }}</td>
+		<td>{{ $res.Resource.Location }}</td>
+		<td>{{ fdate $res.Resource.CreationTime "2006-01-02" }} ({{ daysrunning $res.Resource.CreationTime }})</td>
+		<td>{{ $res.Reason }}</td>
+		<td>{{ accucost $res.Resource }}</td>
+		<td>{{ note $res.Resource }}</td>
+	</tr>
+{{ end }}
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+const untaggedMailTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<p>
+The following listed resources are missing proper <strong>env/product/role</strong> tags.
+These tags are important to help us track resource purpose and cost.
+You can always add other tags to resources, but should always include a <strong>env/product/role</strong> tag.
+You can read more about tagging rules in
+<a href="#">this wiki</a>.
+</p>
+
+<p>
+Please tag these resources appropriately.
+</p>
+
+` + generalRunbookSection + `
+
+<h2>Untagged resources:</h2>
+<p><strong>Account ID:</strong> {{ account .OwnerID }}</p>
+<p>
+Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+The probable owner is only a guess, based on a username found in the name, key pair or security groups of the resource.
 </p>
 {{ if gt (len .Instances) 0 }}
 	<h3>Instances</h3>
@@ -890,6 +1538,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<th><strong>ID</strong></th>
 			<th><strong>Created</strong></th>
 			<th><strong>Tags</strong></th>
+			<th><strong>Probable owner (guess)</strong></th>
 		</tr>
 	{{ range $i, $instance := .Instances }}
 		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
@@ -897,10 +1546,11 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td style="white-space: nowrap;">{{ $instance.ID }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $instance.CreationTime }}</td>
 			<td>
-			{{ range $key, $val := $instance.Tags }}
+			{{ range $key, $val := usertags $instance }}
 			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
 			{{ end }}
 			</td>
+			<td style="white-space: nowrap;">{{ index $.ProbableOwners $instance.ID }}</td>
 		</tr>
 	{{ end }}
 	</table>
@@ -922,7 +1572,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td style="white-space: nowrap;">{{ $image.ID }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $image.CreationTime }}</td>
 			<td>
-			{{ range $key, $val := $image.Tags }}
+			{{ range $key, $val := usertags $image }}
 			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
 			{{ end }}
 			</td>
@@ -946,7 +1596,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td style="white-space: nowrap;">{{ $volume.ID }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $volume.CreationTime }}</td>
 			<td>
-			{{ range $key, $val := $volume.Tags }}
+			{{ range $key, $val := usertags $volume }}
 			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
 			{{ end }}
 			</td>
@@ -970,7 +1620,59 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 			<td style="white-space: nowrap;">{{ $snapshot.ID }}</td>
 			<td style="white-space: nowrap;">{{ daysrunning $snapshot.CreationTime }}</td>
 			<td>
-			{{ range $key, $val := $snapshot.Tags }}
+			{{ range $key, $val := usertags $snapshot }}
+			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
+			{{ end }}
+			</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Addresses) 0 }}
+	<h3>Addresses</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>IP</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Tags</strong></th>
+		</tr>
+	{{ range $i, $address := .Addresses }}
+	<tr {{ if and (even $i) (not (whitelisted $address)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $address }}style="background-color: #c9fc99;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $address.Location }}</td>
+			<td style="white-space: nowrap;">{{ $address.ID }}</td>
+			<td style="white-space: nowrap;">{{ $address.IP }}</td>
+			<td style="white-space: nowrap;">{{ daysrunning $address.CreationTime }}</td>
+			<td>
+			{{ range $key, $val := usertags $address }}
+			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
+			{{ end }}
+			</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .NetworkGateways) 0 }}
+	<h3>Network gateways</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Location</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Tags</strong></th>
+		</tr>
+	{{ range $i, $gateway := .NetworkGateways }}
+	<tr {{ if and (even $i) (not (whitelisted $gateway)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $gateway }}style="background-color: #c9fc99;"{{ end }}>
+			<td style="white-space: nowrap;">{{ $gateway.Location }}</td>
+			<td style="white-space: nowrap;">{{ $gateway.ID }}</td>
+			<td style="white-space: nowrap;">{{ resourcetype $gateway }}</td>
+			<td style="white-space: nowrap;">{{ daysrunning $gateway.CreationTime }}</td>
+			<td>
+			{{ range $key, $val := usertags $gateway }}
 			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
 			{{ end }}
 			</td>
@@ -990,7 +1692,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
 			<td style="white-space: nowrap;">{{ $bucket.ID }}</td>
 			<td>
-			{{ range $key, $val := $bucket.Tags }}
+			{{ range $key, $val := usertags $bucket }}
 			<span style="background-color: #d6d6d6; padding-top: 0.2em; padding-bottom: 0.2em; padding-left: 0.5em; padding-right: 0.5em; border-radius: 2em; margin-left: 0.1em; margin-right: 0.1em; margin-top:0.01em; margin-bottom: 0.01em; color: #000; display: inline-block;">{{ prettyTag $key $val }}</span>
 			{{ end }}
 			</td>
@@ -999,6 +1701,7 @@ Resources marked <span style="background-color: #c9fc99;">in green</span> are wh
 	</table>
 {{ end }}
 
+` + partialDataSection + `
 <p>
 Thank you,<br />
 Your loyal Cloudsweeper
@@ -1036,11 +1739,31 @@ In the detailed breakdown, only costs over ${{ .MinimumCost }} are listed (but e
 	</table>
 {{ end }}
 
+{{ if gt (len .Departments) 0 }}
+<h3>Departments:</h3>
+<p>
+Costs are attributed to the department of the account owner. Costs in other accounts are attributed using the billing sort tag, if it names a department or an employee.
+</p>
+	<table>
+		<tr style="text-align:left;">
+			<th><strong>Department</strong></th>
+			<th><strong>Cost</strong></th>
+		</tr>
+	{{ range $i, $department := .Departments }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ if $department.Name }}{{ $department.Name }}{{ else }}&lt;unattributed&gt;{{ end }}</td>
+			<td>{{ printf "$%.2f" $department.TotalCost }}</td>
+		</tr>
+	{{ end }}
+		<td colspan="2"><strong>Total cost: {{ printf "$%.2f" .TotalCost }}<strong></td>
+	</table>
+{{ end }}
+
 <h3>Details:</h3>
 {{ if gt (len .SortedUsers) 0 }}
 	{{ range $index, $user := .SortedUsers }}
 		<h3>{{- maybeRealName $user.Name $accountToUserMapping -}}'s costs:</h3>
-		<h4>(Account ID: {{ $user.Name }})</h4>
+		<h4>(Account ID: {{ account $user.Name }})</h4>
 		<table>
 		<tr style="text-align:left;">
 			<th><strong>Cost</strong></th>
@@ -1063,3 +1786,792 @@ Thank you,<br />
 Your loyal Cloudsweeper
 </p>
 `
+
+const costAnomalyTemplate = `<h1>Hello {{ .Owner -}},</h1>
+
+<h2>The cost of {{ account .Anomaly.Owner }} jumped</h2>
+<p>
+The daily {{ .CSP }} cost of account {{ account .Anomaly.Owner }} increased a lot compared to the
+day before. Please check that nothing was started by mistake, such as instances that
+were never stopped or data transfers that never ended.
+</p>
+
+<table>
+	<tr style="text-align:left;">
+		<th><strong>Day</strong></th>
+		<th><strong>Cost</strong></th>
+		<th><strong>Cost the day before</strong></th>
+		<th><strong>Increase</strong></th>
+	</tr>
+	<tr style="background-color: #f2f2f2;">
+		<td>{{ .Anomaly.Day }}</td>
+		<td>{{ printf "$%.2f" .Anomaly.Cost }}</td>
+		<td>{{ printf "$%.2f" .Anomaly.PreviousCost }}</td>
+		<td>{{ printf "$%.2f" .Anomaly.Increase }}{{ if gt .Anomaly.PreviousCost 0.0 }} ({{ printf "%.0f" .Anomaly.IncreasePercent }}%){{ end }}</td>
+	</tr>
+</table>
+
+<p>
+Thank you,<br />
+Your loyal Cloudsweeper
+</p>
+`
+
+// costEstimateSection explains how the total cost of resources is estimated
+const costEstimateSection = `<p><small>{{ costestimate }}</small></p>
+`
+
+// reviewPolicySection describes the thresholds resources are reviewed
+// with, and stamps the mail with the hash of the policy
+const reviewPolicySection = `{{ if .PolicyHash }}
+<details>
+<summary>Why are these resources listed?</summary>
+<p>
+Resources are listed when they are older than the thresholds below, or
+unattached, idle or unused for longer than them. Whitelisted resources are
+only listed past the whitelist threshold. A threshold of 0 is disabled.
+</p>
+<ul>
+{{ range .PolicyFor "notify-" }}
+	<li>{{ .Name }}: {{ .Value }}</li>
+{{ end }}
+</ul>
+</details>
+<p><small>Policy {{ .PolicyHash }}</small></p>
+{{ end }}
+`
+
+// cleanupPolicySection describes the thresholds resources are marked and
+// cleaned up with, and stamps the mail with the hash of the policy
+const cleanupPolicySection = `{{ if .PolicyHash }}
+<details>
+<summary>Why are these resources affected?</summary>
+<p>
+Resources are marked when they are older than the thresholds below, or
+unattached, idle or unused for longer than them, unless they are
+whitelisted or released. Marked resources are cleaned up after the grace
+period. A threshold of 0 is disabled.
+</p>
+<ul>
+{{ range .PolicyFor "clean-" }}
+	<li>{{ .Name }}: {{ .Value }}</li>
+{{ end }}
+</ul>
+</details>
+<p><small>Policy {{ .PolicyHash }}</small></p>
+{{ end }}
+`
+
+// reminderSection tells which reminder a warning is, if owners are
+// reminded more than once before resources are cleaned up or stopped
+const reminderSection = `{{ if gt .ReminderCount 1 }}
+<p>
+{{ if .NextReminderHours -}}
+This is reminder {{ .Reminder }} of {{ .ReminderCount }}, you will be reminded
+again {{ .NextReminderHours }} hours in advance.
+{{- else -}}
+This is the last reminder about these resources.
+{{- end }}
+</p>
+{{ end }}
+`
+
+// runbookSection shows the runbooks of the resource types in a mail, see
+// LoadRunbooks
+const runbookSection = `{{ with .RunbookEntries }}
+<h2>How to handle these resources</h2>
+{{ range . }}
+<h3>{{ .Heading }}</h3>
+{{ .Guidance }}
+{{ end }}
+{{ end }}`
+
+// generalRunbookSection shows the GeneralRunbook, if there is one
+const generalRunbookSection = `{{ with index .Runbooks "general" }}
+{{ . }}
+{{ end }}`
+
+// partialDataSection warns that accounts in a mail could not be scanned
+// completely, so resources in them may be missing
+const partialDataSection = `{{ if gt (len .PartialScans) 0 }}
+<p>
+<strong>Partial data:</strong> some regions could not be scanned, so
+resources in them are missing from this mail, and no resources were marked
+in these accounts:
+</p>
+<ul>
+{{ range $account, $regions := .PartialScans }}
+	<li>{{ account $account }}: {{ join $regions ", " }}</li>
+{{ end }}
+</ul>
+{{ end }}
+`
+
+// inUseStorageSection lists old volumes and snapshots that are still in
+// use. They're not marked, so they're kept apart from the resources above.
+const inUseStorageSection = `{{ if or .InUseVolumes .InUseSnapshots }}
+	<h2>For your information: old storage in use</h2>
+	<p>
+	These volumes and snapshots are old, but still in use, so Cloudsweeper will
+	not clean them up and there is nothing you have to do. They are listed since
+	they can be expensive, in case they are used by something that is no longer needed.
+	</p>
+{{ end }}
+{{ if gt (len .InUseVolumes) 0 }}
+	<h3>Attached volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $volume := .InUseVolumes }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $volume.Owner }}</td>
+			<td>{{ productname $volume }}</td>
+			<td>{{ rolename $volume }}</td>
+			<td>{{ $volume.ID }}</td>
+			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ accucost $volume }}</td>
+			<td>{{ note $volume }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+{{ if gt (len .InUseSnapshots) 0 }}
+	<h3>Snapshots used by images</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .InUseSnapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $snapshot.Owner }}</td>
+			<td>{{ productname $snapshot }}</td>
+			<td>{{ rolename $snapshot }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+`
+
+// databaseSection lists instances detected as databases, which are never
+// marked for cleanup unless the cleanup policy opts in to it
+const databaseSection = `{{ if gt (len .Databases) 0 }}
+	<h2>Databases detected</h2>
+	<p>
+	These instances look like databases, by their name, tags or security groups.
+	Cloudsweeper will not mark them for cleanup unless the cleanup policy explicitly
+	opts in to cleaning up databases. If they are no longer needed, please back up
+	their data and delete them yourself.
+	</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $instance := .Databases }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $instance.Owner }}</td>
+			<td>{{ productname $instance }}</td>
+			<td>{{ rolename $instance }}</td>
+			<td>{{ $instance.ID }}</td>
+			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.Location }}</td>
+			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+			<td>{{ accucost $instance }}</td>
+			<td>{{ note $instance }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+`
+
+// maxLifetimeSection lists resources past their maximum lifetime, which
+// are marked even if they're whitelisted, see filter.MaxLifetimeDays
+const maxLifetimeSection = `{{ if gt (len .MaxLifetimeExceeded) 0 }}
+	<h2>Hard lifetime exceeded</h2>
+	<p>
+	These resources are older than the maximum lifetime of resources in their account.
+	Once the grace period has passed, they are marked for cleanup even if they are
+	whitelisted. If a resource is still needed, whitelist it again before then, and
+	its maximum lifetime starts over.
+	</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Type</strong></th>
+			<th><strong>Account</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Lifetime ended</strong></th>
+			<th><strong>Marked after</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $res := .MaxLifetimeExceeded }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ resourcetype $res }}</td>
+			<td>{{ account $res.Owner }}</td>
+			<td>{{ $res.ID }}</td>
+			<td>{{ fdate $res.CreationTime "2006-01-02" }} ({{ daysrunning $res.CreationTime }})</td>
+			<td>{{ maxlifetimeend $res }}</td>
+			<td>{{ maxlifetimemarking $res }}</td>
+			<td>{{ accucost $res }}</td>
+			<td>{{ note $res }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+`
+
+// dashboardSection links to the dashboard of the resources in a review
+const dashboardSection = `{{ if .DashboardURL }}
+<p>
+See all resources, their age, cost and state in the
+<a href="{{ .DashboardURL }}">dashboard</a>.
+</p>
+{{ end }}
+`
+
+// tagConflictSection lists resources with conflicting Cloudsweeper tags
+const tagConflictSection = `{{ if gt (len .TagConflicts) 0 }}
+	<h3>Tag conflicts</h3>
+	<p>
+	These resources have conflicting or duplicate Cloudsweeper tags. Run
+	Cloudsweeper with the tag-hygiene command and --repair to resolve them.
+	</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Conflict</strong></th>
+		</tr>
+	{{ range $i, $conflict := .TagConflicts }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $conflict.Resource.Owner }}</td>
+			<td>{{ resourcetype $conflict.Resource }}</td>
+			<td>{{ $conflict.Resource.ID }}</td>
+			<td>{{ $conflict.Problem }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+`
+
+// dataServicesSection lists tables, cache clusters, addresses, network
+// gateways, capacities and databases, and is shared by all templates listing resources of an owner
+const dataServicesSection = `{{ if gt (len .Tables) 0 }}
+	<h3>Tables</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Items</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Last used</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $table := .Tables }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $table.Owner }}</td>
+			<td>{{ productname $table }}</td>
+			<td>{{ rolename $table }}</td>
+			<td>{{ $table.ID }}</td>
+			<td>{{ printf "%.3f GB" $table.SizeGB }}</td>
+			<td>{{ $table.ItemCount }}</td>
+			<td>{{ $table.Location }}</td>
+			<td>{{ daysrunning $table.LastActivity }}</td>
+			<td>{{ fdate $table.CreationTime "2006-01-02" }} ({{ daysrunning $table.CreationTime }})</td>
+			<td>{{ accucost $table }}</td>
+			<td>{{ note $table }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .CacheClusters) 0 }}
+	<h3>Cache clusters</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Engine</strong></th>
+			<th><strong>Node type</strong></th>
+			<th><strong>Nodes</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Last used</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $cluster := .CacheClusters }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $cluster.Owner }}</td>
+			<td>{{ productname $cluster }}</td>
+			<td>{{ rolename $cluster }}</td>
+			<td>{{ $cluster.ID }}</td>
+			<td>{{ $cluster.Engine }}</td>
+			<td>{{ $cluster.NodeType }}</td>
+			<td>{{ $cluster.NodeCount }}</td>
+			<td>{{ $cluster.Location }}</td>
+			<td>{{ daysrunning $cluster.LastActivity }}</td>
+			<td>{{ fdate $cluster.CreationTime "2006-01-02" }} ({{ daysrunning $cluster.CreationTime }})</td>
+			<td>{{ accucost $cluster }}</td>
+			<td>{{ note $cluster }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Addresses) 0 }}
+	<h3>Addresses</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>IP</strong></th>
+			<th><strong>In use</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $address := .Addresses }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $address.Owner }}</td>
+			<td>{{ productname $address }}</td>
+			<td>{{ rolename $address }}</td>
+			<td>{{ $address.ID }}</td>
+			<td>{{ $address.IP }}</td>
+			<td>{{ $address.InUse }}</td>
+			<td>{{ $address.Location }}</td>
+			<td>{{ fdate $address.CreationTime "2006-01-02" }} ({{ daysrunning $address.CreationTime }})</td>
+			<td>{{ accucost $address }}</td>
+			<td>{{ note $address }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .NetworkGateways) 0 }}
+	<h3>Network gateways</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>Network</strong></th>
+			<th><strong>Zones</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Last used</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $gateway := .NetworkGateways }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $gateway.Owner }}</td>
+			<td>{{ productname $gateway }}</td>
+			<td>{{ rolename $gateway }}</td>
+			<td>{{ $gateway.ID }}</td>
+			<td>{{ resourcetype $gateway }}</td>
+			<td>{{ $gateway.Network }}</td>
+			<td>{{ $gateway.Zones }}</td>
+			<td>{{ $gateway.Location }}</td>
+			<td>{{ daysrunning $gateway.LastActivity }}</td>
+			<td>{{ fdate $gateway.CreationTime "2006-01-02" }} ({{ daysrunning $gateway.CreationTime }})</td>
+			<td>{{ accucost $gateway }}</td>
+			<td>{{ note $gateway }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Capacities) 0 }}
+	<h3>Dedicated hosts and capacity reservations</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Type</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>Instances used</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $capacity := .Capacities }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $capacity.Owner }}</td>
+			<td>{{ productname $capacity }}</td>
+			<td>{{ rolename $capacity }}</td>
+			<td>{{ $capacity.ID }}</td>
+			<td>{{ resourcetype $capacity }}</td>
+			<td>{{ $capacity.InstanceType }}</td>
+			<td>{{ utilization $capacity }}</td>
+			<td>{{ $capacity.Location }}</td>
+			<td>{{ fdate $capacity.CreationTime "2006-01-02" }} ({{ daysrunning $capacity.CreationTime }})</td>
+			<td>{{ accucost $capacity }}</td>
+			<td>{{ note $capacity }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .DBInstances) 0 }}
+	<h3>Databases</h3>
+	<p>A final snapshot is taken of every database before it's deleted.</p>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Engine</strong></th>
+			<th><strong>Class</strong></th>
+			<th><strong>Storage</strong></th>
+			<th><strong>Stopped</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Last used</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $db := .DBInstances }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $db.Owner }}</td>
+			<td>{{ productname $db }}</td>
+			<td>{{ rolename $db }}</td>
+			<td>{{ $db.ID }}</td>
+			<td>{{ $db.Engine }}</td>
+			<td>{{ $db.InstanceClass }}{{ if $db.MultiAZ }} (multi-AZ){{ end }}</td>
+			<td>{{ $db.StorageGB }} GB</td>
+			<td>{{ yesno $db.Stopped }}</td>
+			<td>{{ $db.Location }}</td>
+			<td>{{ daysrunning $db.LastActivity }}</td>
+			<td>{{ fdate $db.CreationTime "2006-01-02" }} ({{ daysrunning $db.CreationTime }})</td>
+			<td>{{ accucost $db }}</td>
+			<td>{{ note $db }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .DBSnapshots) 0 }}
+	<h3>Database snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Database</strong></th>
+			<th><strong>Engine</strong></th>
+			<th><strong>Size</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $snap := .DBSnapshots }}
+		<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+			<td>{{ account $snap.Owner }}</td>
+			<td>{{ productname $snap }}</td>
+			<td>{{ rolename $snap }}</td>
+			<td>{{ $snap.ID }}</td>
+			<td>{{ $snap.DBInstanceID }}</td>
+			<td>{{ $snap.Engine }}</td>
+			<td>{{ $snap.StorageGB }} GB</td>
+			<td>{{ $snap.Location }}</td>
+			<td>{{ fdate $snap.CreationTime "2006-01-02" }} ({{ daysrunning $snap.CreationTime }})</td>
+			<td>{{ accucost $snap }}</td>
+			<td>{{ note $snap }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+`
+
+// rollupSection lists the resources of several owners, in the style
+// chosen for the audience of the rollup. It's shared by the manager and
+// org reviews.
+const rollupSection = `{{ if eq .Rollup "counts" }}
+<h2>Old resources per owner:</h2>
+<p>
+Every owner has been sent a list of their own old resources.
+</p>
+<table>
+	<tr style="text-align:left;">
+		<th><strong>Owner</strong></th>
+		<th><strong>Account</strong></th>
+		<th><strong>Resources</strong></th>
+		<th><strong>Total cost</strong></th>
+	</tr>
+{{ range $i, $report := .Reports }}
+	<tr {{ if even $i }}style="background-color: #f2f2f2;"{{ end }}>
+		<td>{{ $report.Owner }}</td>
+		<td>{{ account $report.OwnerID }}</td>
+		<td>{{ $report.ResourceCount }}</td>
+		<td>{{ printf "$%.2f" $report.TotalCost }}</td>
+	</tr>
+{{ end }}
+</table>
+{{ else if eq .Rollup "top" }}
+<h2>The {{ len .TopResources }} most expensive of {{ .ResourceCount }} old resources:</h2>
+<p>
+Every owner has been sent a list of their own old resources.
+</p>
+<table style="width: 100%;">
+	<tr style="text-align:left;">
+		<th><strong>#</strong></th>
+		<th><strong>Type</strong></th>
+		<th><strong>Account</strong></th>
+		<th><strong>ID</strong></th>
+		<th><strong>Location</strong></th>
+		<th><strong>Created</strong></th>
+		<th><strong>Total cost</strong></th>
+		<th><strong>Note</strong></th>
+	</tr>
+{{ range $i, $res := .TopResources }}
+	<tr {{ if and (even $i) (not (whitelisted $res)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $res }}style="background-color: #c9fc99;"{{ end }}>
+		<td>{{ inc $i }}</td>
+		<td>{{ resourcetype $res }}</td>
+		<td>{{ account $res.Owner }}</td>
+		<td>{{ $res.ID }}</td>
+		<td>{{ $res.Location }}</td>
+		<td>{{ fdate $res.CreationTime "2006-01-02" }} ({{ daysrunning $res.CreationTime }})</td>
+		<td>{{ markingcost $res }}</td>
+		<td>{{ note $res }}</td>
+	</tr>
+{{ end }}
+</table>
+{{ else if .GroupByOwner }}
+<p>
+Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+</p>
+{{ range $report := .Reports }}
+<h2>{{ $report.Owner }}'s old resources ({{ account $report.OwnerID }}):</h2>
+{{ template "rollupResources" $report }}
+{{ end }}
+{{ else }}
+<h2>Old resources:</h2>
+<p>
+Resources marked <span style="background-color: #c9fc99;">in green</span> are whitelisted.
+</p>
+{{ template "rollupResources" . }}
+{{ end }}
+
+{{ define "rollupResources" }}
+{{ if gt (len .Instances) 0 }}
+	<h3>Instances</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Instance type</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Compute cost</strong></th>
+			<th><strong>Attached storage cost</strong></th>
+			<th><strong>IPv4 cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $instance := .Instances }}
+		<tr {{ if and (even $i) (not (whitelisted $instance)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $instance }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ account $instance.Owner }}</td>
+			<td>{{ productname $instance }}</td>
+			<td>{{ rolename $instance }}</td>
+			<td>{{ $instance.ID }}</td>
+			<td>{{ instname $instance }}</td>
+			<td>{{ $instance.InstanceType }}</td>
+			<td>{{ $instance.Location }}</td>
+			<td>{{ fdate $instance.CreationTime "2006-01-02" }} ({{ daysrunning $instance.CreationTime }})</td>
+			<td>{{ computecost $instance }}</td>
+			<td>{{ printf "$%.2f" ($.StorageCost $instance) }}</td>
+			<td>{{ ipv4cost $instance }}</td>
+			<td>{{ note $instance }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Images) 0 }}
+	<h3>Images</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Name</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $image := .Images }}
+	<tr {{ if and (even $i) (not (whitelisted $image)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $image }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ account $image.Owner }}</td>
+			<td>{{ productname $image }}</td>
+			<td>{{ rolename $image }}</td>
+			<td>{{ $image.ID }}</td>
+			<td>{{ $image.Name }}</td>
+			<td>{{ $image.SizeGB }} GB</td>
+			<td>{{ $image.Location }}</td>
+			<td>{{ fdate $image.CreationTime "2006-01-02" }} ({{ daysrunning $image.CreationTime }})</td>
+			<td>{{ accucost $image }}</td>
+			<td>{{ note $image }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Volumes) 0 }}
+	<h3>Volumes</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Attached to instance</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Volume type</strong></th>
+			<th><strong>Replication</strong></th>
+			<th><strong>Provisioned performance</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $volume := .Volumes }}
+	<tr {{ if and (even $i) (not (whitelisted $volume)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $volume }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ account $volume.Owner }}</td>
+			<td>{{ productname $volume }}</td>
+			<td>{{ rolename $volume }}</td>
+			<td>{{ $volume.ID }}</td>
+			<td>{{ $volume.SizeGB }} GB</td>
+			<td>{{ $volume.Location }}</td>
+			<td>{{ yesno $volume.Attached }}</td>
+			<td>{{ fdate $volume.CreationTime "2006-01-02" }} ({{ daysrunning $volume.CreationTime }})</td>
+			<td>{{ $volume.VolumeType }}</td>
+			<td>{{ volumescope $volume }}</td>
+			<td>{{ volumeperformance $volume }}</td>
+			<td>{{ accucost $volume }}</td>
+			<td>{{ note $volume }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Snapshots) 0 }}
+	<h3>Snapshots</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Location</strong></th>
+			<th><strong>Created</strong></th>
+			<th><strong>Total cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $snapshot := .Snapshots }}
+	<tr {{ if and (even $i) (not (whitelisted $snapshot)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $snapshot }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ account $snapshot.Owner }}</td>
+			<td>{{ productname $snapshot }}</td>
+			<td>{{ rolename $snapshot }}</td>
+			<td>{{ $snapshot.ID }}</td>
+			<td>{{ $snapshot.SizeGB }} GB</td>
+			<td>{{ $snapshot.Location }}</td>
+			<td>{{ fdate $snapshot.CreationTime "2006-01-02" }} ({{ daysrunning $snapshot.CreationTime }})</td>
+			<td>{{ accucost $snapshot }}</td>
+			<td>{{ note $snapshot }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+{{ if gt (len .Buckets) 0 }}
+	<h3>Buckets</h3>
+	<table style="width: 100%;">
+		<tr style="text-align:left;">
+			<th><strong>Account</strong></th>
+			<th><strong>Product</strong></th>
+			<th><strong>Role</strong></th>
+			<th><strong>ID</strong></th>
+			<th><strong>Size (GB)</strong></th>
+			<th><strong>Files</strong></th>
+			<th><strong>Modified in < 6 months</strong></th>
+			<th><strong>Monthly cost</strong></th>
+			<th><strong>Note</strong></th>
+		</tr>
+	{{ range $i, $bucket := .Buckets }}
+	<tr {{ if and (even $i) (not (whitelisted $bucket)) }}style="background-color: #f2f2f2;"{{ else if whitelisted $bucket }}style="background-color: #c9fc99;"{{ end }}>
+			<td>{{ account $bucket.Owner }}</td>
+			<td>{{ productname $bucket }}</td>
+			<td>{{ rolename $bucket }}</td>
+			<td>{{ $bucket.ID }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "%.3f GB" $bucket.TotalSizeGB }}{{ else }}Unknown{{ end }}</td>
+			<td>{{ $bucket.ObjectCount }}</td>
+			<td>{{ modifiedInTheLast6Months $bucket.LastModified }}</td>
+			<td>{{ if $bucket.SizeKnown }}{{ printf "$%.3f" (bucketcost $bucket) }}{{ else }}Unknown{{ end }}</td>
+			<td>{{ note $bucket }}</td>
+		</tr>
+	{{ end }}
+	</table>
+{{ end }}
+
+` + dataServicesSection + `
+{{ end }}
+`
@@ -0,0 +1,340 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+)
+
+// whitelistedResource is a resource listed in the whitelist report, with
+// the employee owning its account and its costs
+type whitelistedResource struct {
+	Resource     cloud.Resource
+	Employee     string
+	TotalCost    float64
+	CostPerMonth float64
+	// Since is when the resource was last whitelisted, and Expires when
+	// its whitelisting expires, which is zero if it never does
+	Since   time.Time
+	Expires time.Time
+}
+
+// newWhitelistedResource returns a whitelisted resource with its costs
+func newWhitelistedResource(res cloud.Resource, employee string) whitelistedResource {
+	expires, _ := filter.WhitelistExpiry(res)
+	return whitelistedResource{
+		Resource:     res,
+		Employee:     employee,
+		TotalCost:    accumulatedCost(res),
+		CostPerMonth: costPerMonth(res),
+		Since:        filter.WhitelistedSince(res),
+		Expires:      expires,
+	}
+}
+
+type whitelistReportMailData struct {
+	Owner     string
+	CSP       cloud.CSP
+	Resources []whitelistedResource
+	// Days is the lead time of a whitelist expiry warning, or the age of
+	// the whitelistings in a re-approval report
+	Days int
+	// PartialAccounts are the accounts that could not be fully scanned,
+	// so some of their whitelisted resources may be missing
+	PartialAccounts []string
+}
+
+// TotalCost returns the accumulated cost of all resources in the report
+func (d *whitelistReportMailData) TotalCost() float64 {
+	total := 0.0
+	for _, res := range d.Resources {
+		total += res.TotalCost
+	}
+	return total
+}
+
+// CostPerMonth returns the monthly cost of all resources in the report
+func (d *whitelistReportMailData) CostPerMonth() float64 {
+	total := 0.0
+	for _, res := range d.Resources {
+		total += res.CostPerMonth
+	}
+	return total
+}
+
+// WhitelistReport sends an email to the WhitelistAddressee listing
+// all whitelisted resources in the org, including those pending approval,
+// with the most expensive first. Whitelisted resources are never cleaned
+// up, so the report lets their cost be challenged periodically.
+func (c *Client) WhitelistReport(ctx context.Context, mngr cloud.ResourceManager, csp cloud.CSP, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	if c.config.WhitelistAddressee == "" {
+		log.Println("Not sending the whitelist report, since it has no addressee")
+		return
+	}
+	resources := whitelistedResourcesPerAccount(ctx, mngr)
+	if cancelled(ctx, "whitelist report") {
+		return
+	}
+	mailData := &whitelistReportMailData{
+		Owner:           c.config.WhitelistAddressee,
+		CSP:             csp,
+		Resources:       []whitelistedResource{},
+		PartialAccounts: mngr.ScanStatus().PartialAccounts(),
+	}
+	accounts := []string{}
+	for account := range resources {
+		accounts = append(accounts, account)
+	}
+	cloud.SortIDs(accounts)
+	for _, account := range accounts {
+		log.Println("Collecting whitelisted resources in", cloud.AccountName(account))
+		for _, res := range resources[account] {
+			mailData.Resources = append(mailData.Resources, newWhitelistedResource(res, accountUserMapping[account]))
+		}
+	}
+	if len(mailData.Resources) == 0 {
+		log.Println("No whitelisted resources to report")
+		return
+	}
+	sort.SliceStable(mailData.Resources, func(i, j int) bool {
+		return mailData.Resources[i].TotalCost > mailData.Resources[j].TotalCost
+	})
+
+	mailContent, err := generateMail(mailData, whitelistReportTemplate)
+	if err != nil {
+		log.Fatalln("Could not generate email:", err)
+	}
+	settings := c.mailSettings(c.config.WhitelistAddressee, "")
+	recipientMail := convertEmailExceptions(fmt.Sprintf("%s@%s", c.config.WhitelistAddressee, settings.EmailDomain))
+	title := c.subject(WhitelistReportMail, subjectData{Count: len(mailData.Resources), Owner: c.config.WhitelistAddressee, CSP: csp, CostPerMonth: mailData.CostPerMonth()})
+	records := []cloud.Resource{}
+	for _, res := range mailData.Resources {
+		records = append(records, res.Resource)
+	}
+	if c.outputReport(mailContent, resourceRecords(WhitelistReportMail, recipientMail, records)) {
+		return
+	}
+	if c.isDuplicateMail(recipientMail, whitelistReportTemplate, title, mailContent) {
+		return
+	}
+	log.Printf("Sending the whitelist report to %s\n", recipientMail)
+	err = c.deliverMail(settings, title, mailContent, recipientMail)
+	if err != nil {
+		log.Printf("Failed to email %s: %s\n", recipientMail, err)
+	} else {
+		c.recordMail(recipientMail, whitelistReportTemplate, mailContent)
+	}
+}
+
+// WhitelistExpiryWarning sends an email to the owner of each account with
+// resources whose whitelisting expires within the specified amount of
+// days, see filter.WhitelistTagKey. Once it has expired, they're marked and
+// cleaned up like any other resource, unless they're whitelisted again.
+func (c *Client) WhitelistExpiryWarning(ctx context.Context, mngr cloud.ResourceManager, csp cloud.CSP, days int, accountUserMapping map[string]string) {
+	defer c.logSuppressedMail()
+	resources := whitelistedResourcesPerAccount(ctx, mngr)
+	if cancelled(ctx, "whitelist expiry warning") {
+		return
+	}
+	expiring := filter.WhitelistExpiresWithinXDays(days)
+	accounts := []string{}
+	for account := range resources {
+		accounts = append(accounts, account)
+	}
+	cloud.SortIDs(accounts)
+	for _, account := range accounts {
+		log.Println("Looking for expiring whitelistings in", cloud.AccountName(account))
+		username := accountUserMapping[account]
+		mailData := &whitelistReportMailData{
+			Owner:           username,
+			CSP:             csp,
+			Resources:       []whitelistedResource{},
+			Days:            days,
+			PartialAccounts: mngr.ScanStatus().PartialAccounts(),
+		}
+		for _, res := range resources[account] {
+			if expiring(res) {
+				mailData.Resources = append(mailData.Resources, newWhitelistedResource(res, username))
+			}
+		}
+		if len(mailData.Resources) == 0 {
+			continue
+		}
+		if username == "" {
+			log.Printf("Not warning about %d expiring whitelistings in %s, since it has no owner\n", len(mailData.Resources), cloud.AccountName(account))
+			continue
+		}
+		sort.SliceStable(mailData.Resources, func(i, j int) bool {
+			return mailData.Resources[i].Expires.Before(mailData.Resources[j].Expires)
+		})
+		title := c.subject(WhitelistExpiryMail, subjectData{Count: len(mailData.Resources), Account: account, Owner: username, CSP: csp, CostPerMonth: mailData.CostPerMonth()})
+		c.sendWhitelistMail(mailData, account, WhitelistExpiryMail, whitelistExpiryTemplate, title)
+	}
+}
+
+// WhitelistReapprovalReport sends an email to the manager of each owner of
+// resources that were last whitelisted more than the specified amount of
+// days ago, so that the manager can approve keeping them again. Resources
+// of owners without a manager are sent to the WhitelistAddressee instead.
+func (c *Client) WhitelistReapprovalReport(ctx context.Context, mngr cloud.ResourceManager, org *cs.Organization, csp cloud.CSP, days int) {
+	defer c.logSuppressedMail()
+	resources := whitelistedResourcesPerAccount(ctx, mngr)
+	if cancelled(ctx, "whitelist re-approval report") {
+		return
+	}
+	accountUserMapping := org.AccountToUserMapping(csp)
+	userEmployeeMapping := org.UsernameToEmployeeMapping()
+	reapproval := filter.WhitelistedMoreThanXDays(days)
+	managerToMailData := make(map[string]*whitelistReportMailData)
+	accounts := []string{}
+	for account := range resources {
+		accounts = append(accounts, account)
+	}
+	cloud.SortIDs(accounts)
+	for _, account := range accounts {
+		log.Println("Looking for whitelistings to re-approve in", cloud.AccountName(account))
+		username := accountUserMapping[account]
+		manager := c.config.WhitelistAddressee
+		if employee, exist := userEmployeeMapping[username]; exist && employee.Manager != nil {
+			manager = employee.Manager.Username
+		}
+		for _, res := range resources[account] {
+			if !reapproval(res) {
+				continue
+			}
+			if manager == "" {
+				log.Printf("Not reporting %s in %s for re-approval, since its owner has no manager\n", res.ID(), cloud.AccountName(account))
+				continue
+			}
+			mailData, exist := managerToMailData[manager]
+			if !exist {
+				mailData = &whitelistReportMailData{
+					Owner:           manager,
+					CSP:             csp,
+					Resources:       []whitelistedResource{},
+					Days:            days,
+					PartialAccounts: mngr.ScanStatus().PartialAccounts(),
+				}
+				managerToMailData[manager] = mailData
+			}
+			mailData.Resources = append(mailData.Resources, newWhitelistedResource(res, username))
+		}
+	}
+	managers := []string{}
+	for manager := range managerToMailData {
+		managers = append(managers, manager)
+	}
+	cloud.SortIDs(managers)
+	for _, manager := range managers {
+		mailData := managerToMailData[manager]
+		sort.SliceStable(mailData.Resources, func(i, j int) bool {
+			return mailData.Resources[i].Since.Before(mailData.Resources[j].Since)
+		})
+		title := c.subject(WhitelistReapprovalMail, subjectData{Count: len(mailData.Resources), Owner: manager, CSP: csp, CostPerMonth: mailData.CostPerMonth()})
+		c.sendWhitelistMail(mailData, "", WhitelistReapprovalMail, whitelistReapprovalTemplate, title)
+	}
+}
+
+// sendWhitelistMail sends a mail listing whitelisted resources to its
+// owner, using the mail settings of the account, if any
+func (c *Client) sendWhitelistMail(mailData *whitelistReportMailData, account, mail, mailTemplate, title string) {
+	mailContent, err := generateMail(mailData, mailTemplate)
+	if err != nil {
+		log.Fatalln("Could not generate email:", err)
+	}
+	settings := c.mailSettings(mailData.Owner, account)
+	recipientMail := convertEmailExceptions(c.emailForUser(mailData.Owner, settings))
+	records := []cloud.Resource{}
+	for _, res := range mailData.Resources {
+		records = append(records, res.Resource)
+	}
+	if c.outputReport(mailContent, resourceRecords(mail, recipientMail, records)) {
+		return
+	}
+	if c.isDuplicateMail(recipientMail, mailTemplate, title, mailContent) {
+		return
+	}
+	log.Printf("Sending out email to %s\n", recipientMail)
+	err = c.deliverMail(settings, title, mailContent, recipientMail)
+	if err != nil {
+		log.Printf("Failed to email %s: %s\n", recipientMail, err)
+		return
+	}
+	c.recordMail(recipientMail, mailTemplate, mailContent)
+}
+
+// whitelistedResourcesPerAccount returns the resources of all types that
+// are whitelisted, or pending approval to be whitelisted, in each account
+func whitelistedResourcesPerAccount(ctx context.Context, mngr cloud.ResourceManager) map[string][]cloud.Resource {
+	result := make(map[string][]cloud.Resource)
+	add := func(account string, res cloud.Resource) {
+		if filter.IsWhitelisted(res) || filter.WhitelistPendingApproval(res) {
+			result[account] = append(result[account], res)
+		}
+	}
+	for account, resources := range mngr.AllResourcesPerAccount(ctx) {
+		for _, res := range resources.Instances {
+			add(account, res)
+		}
+		for _, res := range resources.Images {
+			add(account, res)
+		}
+		for _, res := range resources.Volumes {
+			add(account, res)
+		}
+		for _, res := range resources.Snapshots {
+			add(account, res)
+		}
+	}
+	for account, buckets := range mngr.BucketsPerAccount(ctx) {
+		for _, res := range buckets {
+			add(account, res)
+		}
+	}
+	for account, tables := range mngr.TablesPerAccount(ctx) {
+		for _, res := range tables {
+			add(account, res)
+		}
+	}
+	for account, clusters := range mngr.CacheClustersPerAccount(ctx) {
+		for _, res := range clusters {
+			add(account, res)
+		}
+	}
+	for account, addresses := range mngr.AddressesPerAccount(ctx) {
+		for _, res := range addresses {
+			add(account, res)
+		}
+	}
+	for account, gateways := range mngr.NetworkGatewaysPerAccount(ctx) {
+		for _, res := range gateways {
+			add(account, res)
+		}
+	}
+	for account, capacities := range mngr.CapacitiesPerAccount(ctx) {
+		for _, res := range capacities {
+			add(account, res)
+		}
+	}
+	for account, instances := range mngr.DBInstancesPerAccount(ctx) {
+		for _, res := range instances {
+			add(account, res)
+		}
+	}
+	for account, snapshots := range mngr.DBSnapshotsPerAccount(ctx) {
+		for _, res := range snapshots {
+			add(account, res)
+		}
+	}
+	return result
+}
@@ -9,6 +9,7 @@ package cloudsweeper
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
 )
@@ -34,42 +35,119 @@ type managerID struct {
 	ID string `json:"username"`
 }
 
-// Department represents a department in your org
+// Department represents a department in your org. Departments with
+// Mail set, such as subsidiaries, get their mails through other mail
+// settings than the rest of the org.
 type Department struct {
-	Number int    `json:"number"`
-	ID     string `json:"id"`
-	Name   string `json:"name"`
+	Number int           `json:"number"`
+	ID     string        `json:"id"`
+	Name   string        `json:"name"`
+	Mail   *MailSettings `json:"mail,omitempty"`
 }
 
 // Departments is a list of Department
 type Departments []*Department
 
+// MailSettings overrides the email domain and SMTP settings used for the
+// mails of a department or account. Settings that are left out use the
+// configured defaults. The SMTP password can be a reference to a secret
+// in AWS Secrets Manager or GCP Secret Manager.
+type MailSettings struct {
+	EmailDomain  string `json:"email_domain,omitempty"`
+	MailFrom     string `json:"mail_from,omitempty"`
+	SMTPServer   string `json:"smtp_server,omitempty"`
+	SMTPPort     int    `json:"smtp_port,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+}
+
+// Override returns the settings with the values set in override replacing
+// their defaults
+func (s MailSettings) Override(override *MailSettings) MailSettings {
+	if override == nil {
+		return s
+	}
+	if override.EmailDomain != "" {
+		s.EmailDomain = override.EmailDomain
+	}
+	if override.MailFrom != "" {
+		s.MailFrom = override.MailFrom
+	}
+	if override.SMTPServer != "" {
+		s.SMTPServer = override.SMTPServer
+	}
+	if override.SMTPPort != 0 {
+		s.SMTPPort = override.SMTPPort
+	}
+	if override.SMTPUsername != "" {
+		s.SMTPUsername = override.SMTPUsername
+	}
+	if override.SMTPPassword != "" {
+		s.SMTPPassword = override.SMTPPassword
+	}
+	return s
+}
+
 // Employee represents an employee, which
 // belong to a department and has a manager. An employee can
 // also have multiple accounts and projects associated with
 // them in AWS and GCP. "Disabled" employees are employees
-// who should no longer be regarded as active in the company
+// who should no longer be regarded as active in the company.
+// Employees with AccountSummary set get a summary of all
+// their accounts along with their reviews. Principals are
+// the IAM principals, such as user ARNs, used by the employee.
+// Aggressiveness opts the accounts of the employee in to being marked
+// for cleanup sooner or later than the policy says.
 type Employee struct {
-	Username     string      `json:"username"`
-	RealName     string      `json:"real_name"`
-	ManagerID    string      `json:"manager"`
-	Manager      *Employee   `json:"-"`
-	DepartmentID string      `json:"department"`
-	Department   *Department `json:"-"`
-	Disabled     bool        `json:"disabled,omitempty"`
-	AWSAccounts  AWSAccounts `json:"aws_accounts"`
-	GCPProjects  GCPProjects `json:"gcp_projects"`
+	Username       string      `json:"username"`
+	RealName       string      `json:"real_name"`
+	ManagerID      string      `json:"manager"`
+	Manager        *Employee   `json:"-"`
+	DepartmentID   string      `json:"department"`
+	Department     *Department `json:"-"`
+	Disabled       bool        `json:"disabled,omitempty"`
+	AccountSummary bool        `json:"account_summary,omitempty"`
+	Principals     []string    `json:"principals,omitempty"`
+	AWSAccounts    AWSAccounts `json:"aws_accounts"`
+	GCPProjects    GCPProjects `json:"gcp_projects"`
+	// Aggressiveness is empty for the standard level
+	Aggressiveness Aggressiveness `json:"aggressiveness,omitempty"`
 }
 
+// Aggressiveness is how eagerly the resources in the accounts of an
+// employee are marked for cleanup
+type Aggressiveness string
+
+const (
+	// Conservative marks resources later than the policy says
+	Conservative Aggressiveness = "conservative"
+	// Standard marks resources as the policy says
+	Standard Aggressiveness = "standard"
+	// Aggressive marks resources sooner than the policy says
+	Aggressive Aggressiveness = "aggressive"
+)
+
+// AggressivenessLevels are all levels of aggressiveness, from the least
+// to the most aggressive
+var AggressivenessLevels = []Aggressiveness{Conservative, Standard, Aggressive}
+
 // Employees is a list of Employee
 type Employees []*Employee
 
 // AWSAccount represents an account in AWS. An account
 // can have automatic cleanup enabled, indiacated by
-// the CloudsweeperEnabled attribute.
+// the CloudsweeperEnabled attribute. Shared accounts
+// are used by several employees, not only their owner.
+// Mail overrides the mail settings of the account's
+// department for mails about the account. Alias is
+// shown with the ID in reports, instead of the alias
+// of the account in IAM.
 type AWSAccount struct {
-	ID                  string `json:"id"`
-	CloudsweeperEnabled bool   `json:"cloudsweeper_enabled,omitempty"`
+	ID                  string        `json:"id"`
+	Alias               string        `json:"alias,omitempty"`
+	CloudsweeperEnabled bool          `json:"cloudsweeper_enabled,omitempty"`
+	Shared              bool          `json:"shared,omitempty"`
+	Mail                *MailSettings `json:"mail,omitempty"`
 }
 
 // AWSAccounts is a list of AWSAccount
@@ -77,10 +155,14 @@ type AWSAccounts []*AWSAccount
 
 // GCPProject represents a project in GPC. A project
 // can have automatic cleanup enabled, indiacated by
-// the CloudsweeperEnabled attribute.
+// the CloudsweeperEnabled attribute. Mail overrides
+// the mail settings, and Alias is shown with the ID,
+// like for an AWSAccount.
 type GCPProject struct {
-	ID                  string `json:"id"`
-	CloudsweeperEnabled bool   `json:"cloudsweeper_enabled,omitempty"`
+	ID                  string        `json:"id"`
+	Alias               string        `json:"alias,omitempty"`
+	CloudsweeperEnabled bool          `json:"cloudsweeper_enabled,omitempty"`
+	Mail                *MailSettings `json:"mail,omitempty"`
 }
 
 // GCPProjects is a list of GCPProject
@@ -101,6 +183,9 @@ func InitOrganization(orgData []byte) (*Organization, error) {
 	// First initalize all employees
 	org.employeeMapping = make(map[string]*Employee, len(org.Employees))
 	for i := range org.Employees {
+		if !org.Employees[i].Aggressiveness.Valid() {
+			return nil, fmt.Errorf("Employee %s has unknown aggressiveness %q", org.Employees[i].Username, org.Employees[i].Aggressiveness)
+		}
 		org.employeeMapping[org.Employees[i].Username] = org.Employees[i]
 		if department, exist := org.departmentMapping[org.Employees[i].DepartmentID]; exist {
 			org.Employees[i].Department = department
@@ -132,6 +217,44 @@ func InitOrganization(orgData []byte) (*Organization, error) {
 	return org, nil
 }
 
+// Accounts returns the IDs of all accounts or projects of the
+// employee in the specified CSP
+func (e *Employee) Accounts(csp cloud.CSP) []string {
+	accounts := []string{}
+	switch csp {
+	case cloud.AWS:
+		for _, account := range e.AWSAccounts {
+			accounts = append(accounts, account.ID)
+		}
+	case cloud.GCP:
+		for _, project := range e.GCPProjects {
+			accounts = append(accounts, project.ID)
+		}
+	}
+	return accounts
+}
+
+// EnabledAccounts returns the IDs of the Cloudsweeper enabled accounts or
+// projects of the employee in the specified CSP
+func (e *Employee) EnabledAccounts(csp cloud.CSP) []string {
+	accounts := []string{}
+	switch csp {
+	case cloud.AWS:
+		for _, account := range e.AWSAccounts {
+			if account.CloudsweeperEnabled {
+				accounts = append(accounts, account.ID)
+			}
+		}
+	case cloud.GCP:
+		for _, project := range e.GCPProjects {
+			if project.CloudsweeperEnabled {
+				accounts = append(accounts, project.ID)
+			}
+		}
+	}
+	return accounts
+}
+
 // EmployeesForManager gets all the employees who has the
 // specifed manager as their manager.
 func (org *Organization) EmployeesForManager(manager *Employee) (Employees, error) {
@@ -145,6 +268,41 @@ func (org *Organization) EmployeesForManager(manager *Employee) (Employees, erro
 	return Employees{}, nil
 }
 
+// SetManager will change the manager of an employee, e.g. to the manager
+// found in a user directory. The new manager becomes a manager of the
+// organization if it wasn't already.
+func (org *Organization) SetManager(username, managerUsername string) error {
+	employee, exist := org.employeeMapping[username]
+	if !exist {
+		return fmt.Errorf("%s is not in the list of employees", username)
+	}
+	manager, exist := org.employeeMapping[managerUsername]
+	if !exist {
+		return fmt.Errorf("Manager %s is not in the list of employees", managerUsername)
+	}
+	if employee.Manager == manager {
+		return nil
+	}
+	if employee.Manager != nil {
+		old := org.managerEmployees[employee.Manager.Username]
+		for i := range old {
+			if old[i] == employee {
+				org.managerEmployees[employee.Manager.Username] = append(old[:i:i], old[i+1:]...)
+				break
+			}
+		}
+	}
+	if _, isManager := org.managerMapping[managerUsername]; !isManager {
+		org.managerMapping[managerUsername] = manager
+		org.Managers = append(org.Managers, manager)
+		org.ManagerIDs = append(org.ManagerIDs, managerID{ID: managerUsername})
+	}
+	employee.ManagerID = managerUsername
+	employee.Manager = manager
+	org.managerEmployees[managerUsername] = append(org.managerEmployees[managerUsername], employee)
+	return nil
+}
+
 // EnabledAccounts will return a list of all cloudsweeper enabled accounts
 // in the specified CSP
 func (org *Organization) EnabledAccounts(csp cloud.CSP) []string {
@@ -187,6 +345,219 @@ func (org *Organization) AccountToUserMapping(csp cloud.CSP) map[string]string {
 	return result
 }
 
+// AccountAliases maps accounts/projects to the aliases they have in the
+// organization, accounts without an alias are left out
+func (org *Organization) AccountAliases(csp cloud.CSP) map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		switch csp {
+		case cloud.AWS:
+			for _, account := range employee.AWSAccounts {
+				if account.Alias != "" {
+					result[account.ID] = account.Alias
+				}
+			}
+		case cloud.GCP:
+			for _, project := range employee.GCPProjects {
+				if project.Alias != "" {
+					result[project.ID] = project.Alias
+				}
+			}
+		}
+	}
+	return result
+}
+
+// AccountAggressiveness maps accounts to the aggressiveness their owner
+// opted in to, accounts at the standard level are left out
+func (org *Organization) AccountAggressiveness(csp cloud.CSP) map[string]Aggressiveness {
+	result := make(map[string]Aggressiveness)
+	for _, employee := range org.Employees {
+		if employee.Aggressiveness == "" || employee.Aggressiveness == Standard {
+			continue
+		}
+		for _, account := range employee.Accounts(csp) {
+			result[account] = employee.Aggressiveness
+		}
+	}
+	return result
+}
+
+// Valid is true if the aggressiveness is empty or one of the known levels
+func (a Aggressiveness) Valid() bool {
+	if a == "" {
+		return true
+	}
+	for _, level := range AggressivenessLevels {
+		if a == level {
+			return true
+		}
+	}
+	return false
+}
+
+// MailSettingsFor returns the mail settings overriding the defaults for
+// mails to the specified user about the specified account, or nil if
+// there are none. Settings of the account take precedence over those of
+// the user's department. The account can be empty for mails that aren't
+// about a single account, such as manager reviews.
+func (org *Organization) MailSettingsFor(username, account string) *MailSettings {
+	if account != "" {
+		for _, employee := range org.Employees {
+			for _, acc := range employee.AWSAccounts {
+				if acc.ID == account && acc.Mail != nil {
+					return acc.Mail
+				}
+			}
+			for _, project := range employee.GCPProjects {
+				if project.ID == account && project.Mail != nil {
+					return project.Mail
+				}
+			}
+		}
+	}
+	if employee, exist := org.employeeMapping[username]; exist && employee.Department != nil {
+		return employee.Department.Mail
+	}
+	return nil
+}
+
+// AllMailSettings returns all mail settings overriding the defaults, of
+// both departments and accounts
+func (org *Organization) AllMailSettings() []*MailSettings {
+	result := []*MailSettings{}
+	for _, department := range org.Departments {
+		if department.Mail != nil {
+			result = append(result, department.Mail)
+		}
+	}
+	for _, employee := range org.Employees {
+		for _, account := range employee.AWSAccounts {
+			if account.Mail != nil {
+				result = append(result, account.Mail)
+			}
+		}
+		for _, project := range employee.GCPProjects {
+			if project.Mail != nil {
+				result = append(result, project.Mail)
+			}
+		}
+	}
+	return result
+}
+
+// AccountToDepartmentMapping is a helper method that maps accounts to the
+// name of the department of their owner. Accounts of employees without a
+// department are left out.
+func (org *Organization) AccountToDepartmentMapping(csp cloud.CSP) map[string]string {
+	result := make(map[string]string)
+	for _, employee := range org.Employees {
+		if employee.Department == nil {
+			continue
+		}
+		switch csp {
+		case cloud.AWS:
+			for _, account := range employee.AWSAccounts {
+				result[account.ID] = employee.Department.Name
+			}
+		case cloud.GCP:
+			for _, project := range employee.GCPProjects {
+				result[project.ID] = employee.Department.Name
+			}
+		}
+	}
+	return result
+}
+
+// TagToDepartmentMapping is a helper method that maps tag values to the
+// name of a department. This is used to attribute costs in shared accounts
+// that are tagged with either a department ID, a department name or the
+// username of an employee in the department.
+func (org *Organization) TagToDepartmentMapping() map[string]string {
+	result := make(map[string]string)
+	for _, department := range org.Departments {
+		result[department.ID] = department.Name
+		result[department.Name] = department.Name
+	}
+	for _, employee := range org.Employees {
+		if employee.Department != nil {
+			result[employee.Username] = employee.Department.Name
+		}
+	}
+	return result
+}
+
+// SharedAccounts returns the IDs of all AWS accounts that are
+// shared by several employees
+func (org *Organization) SharedAccounts() map[string]bool {
+	result := make(map[string]bool)
+	for _, employee := range org.Employees {
+		for _, account := range employee.AWSAccounts {
+			if account.Shared {
+				result[account.ID] = true
+			}
+		}
+	}
+	return result
+}
+
+// EmployeeForPrincipal returns the employee behind an IAM principal, such
+// as the ARN of an AWS SSO session or the email of a GCP user. The principal
+// matches an employee if it's one of their Principals, or if its name can't
+// be chosen by the caller and is their username: the session of an AWS SSO
+// role (AWSReservedSSO_*), whose name is set by IAM Identity Center, or an
+// email in mailDomain. The names of other role sessions and IAM users are
+// never trusted, since anyone who can assume a role picks its session name.
+// Disabled employees never match, and nil is returned if no employee
+// matches.
+func (org *Organization) EmployeeForPrincipal(principal, mailDomain string) *Employee {
+	if principal == "" {
+		return nil
+	}
+	principal = strings.ToLower(principal)
+	for _, employee := range org.Employees {
+		if employee.Disabled {
+			continue
+		}
+		for _, employeePrincipal := range employee.Principals {
+			if strings.ToLower(employeePrincipal) == principal {
+				return employee
+			}
+		}
+	}
+	name, trusted := trustedPrincipalName(principal, strings.ToLower(mailDomain))
+	if !trusted {
+		return nil
+	}
+	if employee, exist := org.employeeMapping[name]; exist && !employee.Disabled {
+		return employee
+	}
+	return nil
+}
+
+// trustedPrincipalName returns the username in a lower case principal,
+// if the principal is an AWS SSO session or an email in mailDomain
+func trustedPrincipalName(principal, mailDomain string) (string, bool) {
+	name := principal
+	if strings.HasPrefix(principal, "arn:") {
+		// arn:aws:sts::<account>:assumed-role/AWSReservedSSO_<set>_<id>/<session>
+		resource := principal[strings.LastIndex(principal, ":")+1:]
+		parts := strings.Split(resource, "/")
+		if len(parts) != 3 || parts[0] != "assumed-role" || !strings.HasPrefix(parts[1], "awsreservedsso_") {
+			return "", false
+		}
+		name = parts[2]
+		if !strings.Contains(name, "@") {
+			return name, name != ""
+		}
+	}
+	i := strings.LastIndex(name, "@")
+	if i <= 0 || mailDomain == "" || name[i+1:] != mailDomain {
+		return "", false
+	}
+	return name[:i], true
+}
+
 // UsernameToEmployeeMapping is a helper method that returns a map of username to Employee struct.
 func (org *Organization) UsernameToEmployeeMapping() map[string]*Employee {
 	return org.employeeMapping
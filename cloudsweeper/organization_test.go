@@ -0,0 +1,103 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloudsweeper
+
+import "testing"
+
+const principalTestOrg = `{
+	"departments": [{"number": 1, "id": "dev", "name": "Developers"}],
+	"employees": [
+		{"username": "alice", "department": "dev", "aws_accounts": [], "gcp_projects": []},
+		{"username": "bob", "department": "dev", "principals": ["arn:aws:iam::111111111111:user/ci-bob"], "aws_accounts": [], "gcp_projects": []},
+		{"username": "carol", "department": "dev", "disabled": true, "aws_accounts": [], "gcp_projects": []}
+	]
+}`
+
+func TestEmployeeForPrincipal(t *testing.T) {
+	org, err := InitOrganization([]byte(principalTestOrg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		principal string
+		employee  string
+	}{
+		// Explicit principals
+		{"arn:aws:iam::111111111111:user/ci-bob", "bob"},
+		{"ARN:AWS:IAM::111111111111:USER/CI-BOB", "bob"},
+		// Sessions named by IAM Identity Center
+		{"arn:aws:sts::111111111111:assumed-role/AWSReservedSSO_Developer_0123456789abcdef/alice", "alice"},
+		{"arn:aws:sts::111111111111:assumed-role/AWSReservedSSO_Developer_0123456789abcdef/alice@example.com", "alice"},
+		{"arn:aws:sts::111111111111:assumed-role/AWSReservedSSO_Developer_0123456789abcdef/alice@evil.com", ""},
+		// Session names chosen by whoever assumed the role
+		{"arn:aws:sts::111111111111:assumed-role/SomeRole/alice", ""},
+		{"arn:aws:sts::111111111111:assumed-role/SomeRole/alice@example.com", ""},
+		{"arn:aws:iam::111111111111:user/alice", ""},
+		// GCP accounts
+		{"alice@example.com", "alice"},
+		{"Alice@Example.com", "alice"},
+		{"alice@some-project.iam.gserviceaccount.com", ""},
+		{"alice", ""},
+		// Disabled and unknown employees
+		{"carol@example.com", ""},
+		{"dave@example.com", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		employee := org.EmployeeForPrincipal(test.principal, "example.com")
+		username := ""
+		if employee != nil {
+			username = employee.Username
+		}
+		if username != test.employee {
+			t.Errorf("%q matched %q, expected %q", test.principal, username, test.employee)
+		}
+	}
+	if employee := org.EmployeeForPrincipal("alice@example.com", ""); employee != nil {
+		t.Error("Email matched without a mail domain")
+	}
+}
+
+func TestSetManager(t *testing.T) {
+	org, err := InitOrganization([]byte(`{
+		"managers": [{"username": "mallory"}],
+		"employees": [
+			{"username": "mallory", "aws_accounts": [], "gcp_projects": []},
+			{"username": "trent", "aws_accounts": [], "gcp_projects": []},
+			{"username": "alice", "manager": "mallory", "aws_accounts": [], "gcp_projects": []},
+			{"username": "bob", "manager": "mallory", "aws_accounts": [], "gcp_projects": []}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping := org.UsernameToEmployeeMapping()
+	mallory, trent := mapping["mallory"], mapping["trent"]
+	if err := org.SetManager("alice", "trent"); err != nil {
+		t.Fatal(err)
+	}
+	if err := org.SetManager("bob", "mallory"); err != nil {
+		t.Fatal(err)
+	}
+	if alice := mapping["alice"]; alice.Manager != trent || alice.ManagerID != "trent" {
+		t.Errorf("alice has manager %s, expected trent", alice.ManagerID)
+	}
+	if len(org.Managers) != 2 || org.Managers[1] != trent {
+		t.Errorf("trent did not become a manager: %v", org.ManagerIDs)
+	}
+	employees, err := org.EmployeesForManager(trent)
+	if err != nil || len(employees) != 1 || employees[0].Username != "alice" {
+		t.Errorf("trent has employees %v (%v), expected alice", employees, err)
+	}
+	employees, err = org.EmployeesForManager(mallory)
+	if err != nil || len(employees) != 1 || employees[0].Username != "bob" {
+		t.Errorf("mallory has employees %v (%v), expected bob", employees, err)
+	}
+	if err := org.SetManager("alice", "dave"); err == nil {
+		t.Error("Set a manager that isn't an employee")
+	}
+	if err := org.SetManager("dave", "trent"); err == nil {
+		t.Error("Set the manager of someone who isn't an employee")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package plan describes what a run of Cloudsweeper would do, similar to
+// terraform plan, so that it can be reviewed before the real run. A plan
+// can be checked against limits on its blast radius, e.g. to stop a
+// policy change that would mark far more resources than expected.
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/notify"
+)
+
+// Plan is what a run of Cloudsweeper in a certain mode would do
+type Plan struct {
+	// Mode is the command that was planned, e.g. "mark-for-cleanup"
+	Mode string
+	// Marked are the resources that would be marked
+	Marked []*cleanup.PlannedResource
+	// CleanedUp are the resources that would be cleaned up or stopped
+	CleanedUp []*cleanup.PlannedResource
+	// Mails are the mails that would be sent
+	Mails []notify.PlannedMail
+}
+
+// Limits is the maximum blast radius of a plan. A limit of 0 means
+// that there is no limit.
+type Limits struct {
+	MaxMarked           int
+	MaxMarkedPerAccount int
+	MaxCleanedUp        int
+	MaxMails            int
+}
+
+// Exceeded returns a description of every limit that the plan exceeds
+func (p *Plan) Exceeded(limits Limits) []string {
+	exceeded := []string{}
+	check := func(what string, count, limit int) {
+		if limit > 0 && count > limit {
+			exceeded = append(exceeded, fmt.Sprintf("%d %s, the limit is %d", count, what, limit))
+		}
+	}
+	check("resources would be marked", len(p.Marked), limits.MaxMarked)
+	perAccount := countBy(p.Marked, func(res *cleanup.PlannedResource) string { return res.Owner })
+	for _, account := range sortedKeys(perAccount) {
+		check("resources would be marked in "+account, perAccount[account], limits.MaxMarkedPerAccount)
+	}
+	check("resources would be cleaned up", len(p.CleanedUp), limits.MaxCleanedUp)
+	check("mails would be sent", len(p.Mails), limits.MaxMails)
+	return exceeded
+}
+
+// Format returns a human readable description of the plan. Resources are
+// counted per account, type, action and reason, and mails per recipient.
+func (p *Plan) Format() string {
+	b := new(bytes.Buffer)
+	fmt.Fprintf(b, "\nPlan for %s\n", p.Mode)
+	formatResources(b, "to be marked", p.Marked)
+	formatResources(b, "to be cleaned up", p.CleanedUp)
+
+	fmt.Fprintf(b, "\n%d mails to be sent\n", len(p.Mails))
+	perRecipient := make(map[string]int)
+	for _, mail := range p.Mails {
+		perRecipient[strings.Join(mail.Recipients, ", ")]++
+	}
+	for _, recipient := range sortedKeys(perRecipient) {
+		fmt.Fprintf(b, "  %-40s %d\n", recipient, perRecipient[recipient])
+	}
+	return b.String()
+}
+
+func formatResources(b *bytes.Buffer, what string, resources []*cleanup.PlannedResource) {
+	fmt.Fprintf(b, "\n%d resources %s\n", len(resources), what)
+	perAccount := make(map[string][]*cleanup.PlannedResource)
+	for _, res := range resources {
+		perAccount[res.Owner] = append(perAccount[res.Owner], res)
+	}
+	for _, account := range sortedKeys(countBy(resources, func(res *cleanup.PlannedResource) string { return res.Owner })) {
+		fmt.Fprintf(b, "  %s:\n", account)
+		groups := countBy(perAccount[account], func(res *cleanup.PlannedResource) string {
+			return fmt.Sprintf("%-14s %-7s %s", cleanup.ResourceKind(res.Resource), res.Action, res.Reason)
+		})
+		for _, group := range sortedKeys(groups) {
+			fmt.Fprintf(b, "    %5d  %s\n", groups[group], group)
+		}
+	}
+}
+
+func countBy(resources []*cleanup.PlannedResource, key func(*cleanup.PlannedResource) string) map[string]int {
+	result := make(map[string]int)
+	for _, res := range resources {
+		result[key(res)]++
+	}
+	return result
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,403 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package query exposes the resources found by Cloudsweeper through a
+// small read-only REST API. This lets other tools use Cloudsweeper's
+// view of the clouds, without having to scan the clouds themselves.
+//
+// The inventory is collected when the server starts, and is then
+// refreshed periodically in the background.
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/metrics"
+)
+
+// Server serves the inventory of a resource manager over HTTP
+type Server struct {
+	mngr            cloud.ResourceManager
+	accountToUser   map[string]string
+	refreshInterval time.Duration
+
+	mu        sync.RWMutex
+	inventory []accountResource
+	refreshed time.Time
+}
+
+type accountResource struct {
+	account  string
+	resource cloud.Resource
+}
+
+// Resource is the representation of a resource returned by the API
+type Resource struct {
+	Type         string            `json:"type"`
+	CSP          cloud.CSP         `json:"csp"`
+	Account      string            `json:"account"`
+	AccountAlias string            `json:"account_alias,omitempty"`
+	Owner        string            `json:"owner"`
+	ID           string            `json:"id"`
+	Location     string            `json:"location"`
+	Public       bool              `json:"public"`
+	CreationTime time.Time         `json:"creation_time"`
+	AgeDays      int               `json:"age_days"`
+	Tags         map[string]string `json:"tags"`
+	Whitelisted  bool              `json:"whitelisted"`
+	Marked       bool              `json:"marked"`
+	DeleteAt     string            `json:"delete_at,omitempty"`
+	Note         string            `json:"note,omitempty"`
+	CostPerDay   float64           `json:"cost_per_day"`
+	CostUnknown  bool              `json:"cost_unknown,omitempty"`
+}
+
+type resourcesResponse struct {
+	Refreshed time.Time  `json:"refreshed"`
+	Count     int        `json:"count"`
+	Resources []Resource `json:"resources"`
+}
+
+// NewServer will create a new query server for the resources in the
+// specified manager. The inventory is refreshed every refreshInterval.
+func NewServer(mngr cloud.ResourceManager, accountToUser map[string]string, refreshInterval time.Duration) *Server {
+	return &Server{
+		mngr:            mngr,
+		accountToUser:   accountToUser,
+		refreshInterval: refreshInterval,
+	}
+}
+
+// ListenAndServe collects the inventory and then serves it on the
+// specified address until the server fails or ctx is done. The following endpoints
+// are available:
+//   - GET /resources, optionally filtered by the query parameters
+//     account, type, tag (key or key=value), older-than-days and marked
+//   - GET /health
+//   - GET /metrics, in the Prometheus text format, see package metrics
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	s.refresh(ctx)
+	go s.refreshPeriodically(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resources", s.handleResources)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Printf("Serving resource queries on %s\n", addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (s *Server) refreshPeriodically(ctx context.Context) {
+	if s.refreshInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.refresh(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh replaces the inventory with the resources in the manager, unless
+// ctx is done before they are all listed
+func (s *Server) refresh(ctx context.Context) {
+	log.Println("Refreshing resource inventory")
+	inventory := []accountResource{}
+	for account, resources := range s.mngr.AllResourcesPerAccount(ctx) {
+		for _, res := range resources.Instances {
+			inventory = append(inventory, accountResource{account, res})
+		}
+		for _, res := range resources.Images {
+			inventory = append(inventory, accountResource{account, res})
+		}
+		for _, res := range resources.Volumes {
+			inventory = append(inventory, accountResource{account, res})
+		}
+		for _, res := range resources.Snapshots {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, buckets := range s.mngr.BucketsPerAccount(ctx) {
+		for _, res := range buckets {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, tables := range s.mngr.TablesPerAccount(ctx) {
+		for _, res := range tables {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, clusters := range s.mngr.CacheClustersPerAccount(ctx) {
+		for _, res := range clusters {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, addresses := range s.mngr.AddressesPerAccount(ctx) {
+		for _, res := range addresses {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, gateways := range s.mngr.NetworkGatewaysPerAccount(ctx) {
+		for _, res := range gateways {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, capacities := range s.mngr.CapacitiesPerAccount(ctx) {
+		for _, res := range capacities {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, instances := range s.mngr.DBInstancesPerAccount(ctx) {
+		for _, res := range instances {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	for account, snapshots := range s.mngr.DBSnapshotsPerAccount(ctx) {
+		for _, res := range snapshots {
+			inventory = append(inventory, accountResource{account, res})
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		log.Println("Not refreshing resource inventory:", err)
+		return
+	}
+	metrics.ObserveScanStatus(s.mngr)
+	s.mu.Lock()
+	s.inventory = inventory
+	s.refreshed = time.Now()
+	s.mu.Unlock()
+	log.Printf("Resource inventory contains %d resources\n", len(inventory))
+}
+
+func (s *Server) handleResources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	fil, err := filterFromQuery(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	accounts := params["account"]
+	resourceType := strings.ToLower(params.Get("type"))
+
+	s.mu.RLock()
+	response := resourcesResponse{Refreshed: s.refreshed, Resources: []Resource{}}
+	for _, item := range s.inventory {
+		if len(accounts) > 0 && !contains(accounts, item.account) {
+			continue
+		}
+		if resourceType != "" && resourceType != typeName(item.resource) {
+			continue
+		}
+		if !matches(item.resource, fil) {
+			continue
+		}
+		response.Resources = append(response.Resources, s.toResource(item))
+	}
+	s.mu.RUnlock()
+	response.Count = len(response.Resources)
+	writeJSON(w, response)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	writeJSON(w, map[string]interface{}{
+		"refreshed": s.refreshed,
+		"resources": len(s.inventory),
+	})
+}
+
+// filterFromQuery builds a filter from the tag, older-than-days and
+// marked query parameters
+func filterFromQuery(params url.Values) (*filter.ResourceFilter, error) {
+	fil := filter.New()
+	fil.OverrideWhitelist = true
+	fil.OverrideSnooze = true
+	for _, tag := range params["tag"] {
+		fil.AddGeneralRule(hasTagValue(tag))
+	}
+	if rawDays := params.Get("older-than-days"); rawDays != "" {
+		days, err := strconv.Atoi(rawDays)
+		if err != nil {
+			return nil, fmt.Errorf("older-than-days must be an integer, got %q", rawDays)
+		}
+		fil.AddGeneralRule(filter.OlderThanXDays(days))
+	}
+	if rawMarked := params.Get("marked"); rawMarked != "" {
+		marked, err := strconv.ParseBool(rawMarked)
+		if err != nil {
+			return nil, fmt.Errorf("marked must be true or false, got %q", rawMarked)
+		}
+		if marked {
+			fil.AddGeneralRule(filter.TaggedForCleanup())
+		} else {
+			fil.AddGeneralRule(filter.Negate(filter.TaggedForCleanup()))
+		}
+	}
+	return fil, nil
+}
+
+// hasTagValue checks if a resource has a tag, when given only a key, or
+// a tag with a specific value when given "key=value"
+func hasTagValue(tag string) func(cloud.Resource) bool {
+	parts := strings.SplitN(tag, "=", 2)
+	if len(parts) == 1 {
+		return filter.HasTag(tag)
+	}
+	return func(r cloud.Resource) bool {
+		for key, val := range r.Tags() {
+			if strings.ToLower(key) == strings.ToLower(parts[0]) && val == parts[1] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matches(res cloud.Resource, fil *filter.ResourceFilter) bool {
+	switch r := res.(type) {
+	case cloud.Instance:
+		return len(filter.Instances([]cloud.Instance{r}, fil)) == 1
+	case cloud.Image:
+		return len(filter.Images([]cloud.Image{r}, fil)) == 1
+	case cloud.Volume:
+		return len(filter.Volumes([]cloud.Volume{r}, fil)) == 1
+	case cloud.Snapshot:
+		return len(filter.Snapshots([]cloud.Snapshot{r}, fil)) == 1
+	case cloud.Bucket:
+		return len(filter.Buckets([]cloud.Bucket{r}, fil)) == 1
+	case cloud.Table:
+		return len(filter.Tables([]cloud.Table{r}, fil)) == 1
+	case cloud.CacheCluster:
+		return len(filter.CacheClusters([]cloud.CacheCluster{r}, fil)) == 1
+	case cloud.Address:
+		return len(filter.Addresses([]cloud.Address{r}, fil)) == 1
+	case cloud.NetworkGateway:
+		return len(filter.NetworkGateways([]cloud.NetworkGateway{r}, fil)) == 1
+	case cloud.Capacity:
+		return len(filter.Capacities([]cloud.Capacity{r}, fil)) == 1
+	case cloud.DBInstance:
+		return len(filter.DBInstances([]cloud.DBInstance{r}, fil)) == 1
+	case cloud.DBSnapshot:
+		return len(filter.DBSnapshots([]cloud.DBSnapshot{r}, fil)) == 1
+	default:
+		return false
+	}
+}
+
+func (s *Server) toResource(item accountResource) Resource {
+	res := item.resource
+	owner, exist := s.accountToUser[item.account]
+	if !exist {
+		owner = item.account
+	}
+	alias, _ := cloud.AccountAlias(item.account)
+	return Resource{
+		Type:         typeName(res),
+		CSP:          res.CSP(),
+		Account:      item.account,
+		AccountAlias: alias,
+		Owner:        owner,
+		ID:           res.ID(),
+		Location:     res.Location(),
+		Public:       res.Public(),
+		CreationTime: res.CreationTime(),
+		AgeDays:      int(clock.Now().Sub(res.CreationTime()).Hours() / 24.0),
+		Tags:         res.Tags(),
+		Whitelisted:  filter.IsWhitelisted(res),
+		Marked:       filter.TaggedForCleanup()(res),
+		DeleteAt:     res.Tags()[filter.DeleteTagKey],
+		Note:         res.Tags()[filter.NoteTagKey],
+		CostPerDay:   costPerDay(res),
+		CostUnknown:  costUnknown(res),
+	}
+}
+
+func costPerDay(res cloud.Resource) float64 {
+	if bucket, ok := res.(cloud.Bucket); ok {
+		return billing.BucketPricePerMonth(bucket) / 30.0
+	}
+	return billing.ResourceCostPerDay(res)
+}
+
+func costUnknown(res cloud.Resource) bool {
+	bucket, ok := res.(cloud.Bucket)
+	return ok && !bucket.SizeKnown()
+}
+
+func typeName(res cloud.Resource) string {
+	switch r := res.(type) {
+	case cloud.Instance:
+		return "instance"
+	case cloud.Image:
+		return "image"
+	case cloud.Volume:
+		return "volume"
+	case cloud.Snapshot:
+		return "snapshot"
+	case cloud.Bucket:
+		return "bucket"
+	case cloud.Table:
+		return "table"
+	case cloud.CacheCluster:
+		return "cache-cluster"
+	case cloud.Address:
+		return "address"
+	case cloud.NetworkGateway:
+		return r.GatewayType()
+	case cloud.Capacity:
+		return r.CapacityType()
+	case cloud.DBInstance:
+		return "db-instance"
+	case cloud.DBSnapshot:
+		return "db-snapshot"
+	default:
+		return "resource"
+	}
+}
+
+func contains(list []string, val string) bool {
+	for i := range list {
+		if list[i] == val {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Could not write response: %s\n", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package cloudsweeper
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+)
+
+// Kinds of AccountChange
+const (
+	AccountAdded   = "add"
+	AccountRemoved = "remove"
+	OwnerChanged   = "change-owner"
+)
+
+// AccountChange is a change of the accounts in the organization, which
+// is suggested to make it match the accounts in the CSP
+type AccountChange struct {
+	Kind    string
+	Account string
+	// Name is the name of the account in the CSP, if it was found there
+	Name string
+	// From and To are the usernames of the current and the suggested
+	// owner. To is empty if no owner could be suggested, in which case
+	// the change is only reported.
+	From   string
+	To     string
+	Reason string
+}
+
+// PatchOperation is an operation of a JSON Patch (RFC 6902) of the
+// organization file
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ReconcileAccounts compares the accounts of the organization with those
+// discovered in the CSP, see cloud.DiscoverAccounts, and suggests changes:
+//   - active accounts that are missing are added to the employee in their
+//     owner tag, or to defaultOwner if it's set
+//   - accounts that are closed, being deleted or not found are removed
+//   - accounts whose owner tag is another employee are moved to that
+//     employee, and accounts of disabled employees without an owner tag
+//     are moved to defaultOwner if it's set
+//
+// Owner tags are matched to employees by username, optionally followed by
+// a mail domain. Disabled employees are never suggested as owners.
+func (org *Organization) ReconcileAccounts(csp cloud.CSP, discovered []*cloud.DiscoveredAccount, defaultOwner string) []*AccountChange {
+	owners := org.AccountToUserMapping(csp)
+	found := make(map[string]bool)
+	changes := []*AccountChange{}
+	for _, account := range discovered {
+		found[account.ID] = true
+		owner := org.ownerFromTag(account.Owner)
+		current, known := owners[account.ID]
+		switch {
+		case !known && account.Active():
+			suggested := owner
+			if suggested == "" {
+				suggested = defaultOwner
+			}
+			changes = append(changes, &AccountChange{Kind: AccountAdded, Account: account.ID, Name: account.Name, To: suggested, Reason: "not in the organization"})
+		case !known:
+			continue
+		case !account.Active():
+			changes = append(changes, &AccountChange{Kind: AccountRemoved, Account: account.ID, Name: account.Name, From: current, Reason: fmt.Sprintf("status is %s", account.Status)})
+		case owner != "" && owner != current:
+			changes = append(changes, &AccountChange{Kind: OwnerChanged, Account: account.ID, Name: account.Name, From: current, To: owner, Reason: fmt.Sprintf("owner tag is %s", account.Owner)})
+		case owner == "" && org.employeeMapping[current] != nil && org.employeeMapping[current].Disabled && defaultOwner != current:
+			changes = append(changes, &AccountChange{Kind: OwnerChanged, Account: account.ID, Name: account.Name, From: current, To: defaultOwner, Reason: fmt.Sprintf("%s is disabled", current)})
+		}
+	}
+	for account, current := range owners {
+		if !found[account] {
+			changes = append(changes, &AccountChange{Kind: AccountRemoved, Account: account, From: current, Reason: "not found in the CSP"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Account < changes[j].Account
+	})
+	return changes
+}
+
+// ownerFromTag returns the username of the enabled employee an owner tag
+// refers to, or an empty string if there is none
+func (org *Organization) ownerFromTag(value string) string {
+	username := strings.ToLower(strings.TrimSpace(value))
+	if i := strings.Index(username, "@"); i >= 0 {
+		username = username[:i]
+	}
+	if employee, exist := org.employeeMapping[username]; exist && !employee.Disabled {
+		return employee.Username
+	}
+	return ""
+}
+
+// AccountPatch returns a JSON Patch of the organization file making the
+// changes that have a suggested owner. Accounts that change owner keep
+// their settings, and added accounts don't have Cloudsweeper enabled.
+func (org *Organization) AccountPatch(csp cloud.CSP, changes []*AccountChange) []*PatchOperation {
+	field := "aws_accounts"
+	if csp == cloud.GCP {
+		field = "gcp_projects"
+	}
+	type location struct {
+		employee, account int
+	}
+	locations := make(map[string]location)
+	accounts := make(map[string]interface{})
+	employeeIndex := make(map[string]int)
+	for i, employee := range org.Employees {
+		employeeIndex[employee.Username] = i
+		switch csp {
+		case cloud.AWS:
+			for j, account := range employee.AWSAccounts {
+				locations[account.ID] = location{i, j}
+				accounts[account.ID] = account
+			}
+		case cloud.GCP:
+			for j, project := range employee.GCPProjects {
+				locations[project.ID] = location{i, j}
+				accounts[project.ID] = project
+			}
+		}
+	}
+
+	removals := []location{}
+	additions := make(map[int][]interface{})
+	for _, change := range changes {
+		switch change.Kind {
+		case AccountRemoved:
+			removals = append(removals, locations[change.Account])
+		case OwnerChanged:
+			if change.To == "" {
+				continue
+			}
+			removals = append(removals, locations[change.Account])
+			additions[employeeIndex[change.To]] = append(additions[employeeIndex[change.To]], accounts[change.Account])
+		case AccountAdded:
+			if change.To == "" {
+				continue
+			}
+			var account interface{} = &AWSAccount{ID: change.Account}
+			if csp == cloud.GCP {
+				account = &GCPProject{ID: change.Account}
+			}
+			additions[employeeIndex[change.To]] = append(additions[employeeIndex[change.To]], account)
+		}
+	}
+
+	// Accounts are removed from the last one, so that the indices of the
+	// remaining ones don't change, and then added to the end of the lists
+	sort.Slice(removals, func(i, j int) bool {
+		if removals[i].employee != removals[j].employee {
+			return removals[i].employee > removals[j].employee
+		}
+		return removals[i].account > removals[j].account
+	})
+	ops := []*PatchOperation{}
+	for _, removal := range removals {
+		ops = append(ops, &PatchOperation{Op: "remove", Path: fmt.Sprintf("/employees/%d/%s/%d", removal.employee, field, removal.account)})
+	}
+	indices := []int{}
+	for i := range additions {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	for _, i := range indices {
+		if len(org.Employees[i].Accounts(csp)) == 0 {
+			// The list may be missing or null in the file
+			ops = append(ops, &PatchOperation{Op: "add", Path: fmt.Sprintf("/employees/%d/%s", i, field), Value: additions[i]})
+			continue
+		}
+		for _, account := range additions[i] {
+			ops = append(ops, &PatchOperation{Op: "add", Path: fmt.Sprintf("/employees/%d/%s/-", i, field), Value: account})
+		}
+	}
+	return ops
+}
+
+// FormatAccountChanges lists the suggested changes, one per line
+func FormatAccountChanges(changes []*AccountChange) string {
+	b := new(bytes.Buffer)
+	for _, change := range changes {
+		name := ""
+		if change.Name != "" {
+			name = fmt.Sprintf(" (%s)", change.Name)
+		}
+		switch change.Kind {
+		case AccountAdded:
+			fmt.Fprintf(b, "+ %s%s to %s: %s\n", change.Account, name, ownerOrUnknown(change.To), change.Reason)
+		case AccountRemoved:
+			fmt.Fprintf(b, "- %s%s from %s: %s\n", change.Account, name, change.From, change.Reason)
+		case OwnerChanged:
+			fmt.Fprintf(b, "~ %s%s from %s to %s: %s\n", change.Account, name, change.From, ownerOrUnknown(change.To), change.Reason)
+		}
+	}
+	fmt.Fprintf(b, "\nFound %d differences between the organization and the CSP\n", len(changes))
+	return b.String()
+}
+
+// ownerOrUnknown is shown for changes without a suggested owner, which
+// are left out of the patch
+func ownerOrUnknown(username string) string {
+	if username == "" {
+		return "unknown owner (not in patch)"
+	}
+	return username
+}
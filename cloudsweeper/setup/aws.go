@@ -1,6 +1,9 @@
 // Copyright (c) 2018 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: BSD-2-Clause
 
+//go:build !noaws
+// +build !noaws
+
 package setup
 
 import (
@@ -14,8 +17,8 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/cloudtools/cloudsweeper/cloud"
 )
 
 const awsInfo = `
@@ -54,11 +57,13 @@ const (
 )
 
 var (
-	monitorEC2 = []string{"ec2:DescribeInstances", "ec2:DescribeInstanceAttribute", "ec2:DescribeSnapshots", "ec2:DescribeVolumeStatus", "ec2:DescribeVolumes", "ec2:DescribeInstanceStatus", "ec2:DescribeTags", "ec2:DescribeVolumeAttribute", "ec2:DescribeImages", "ec2:DescribeSnapshotAttribute"}
+	monitorEC2 = []string{"ec2:DescribeInstances", "ec2:DescribeInstanceAttribute", "ec2:DescribeSnapshots", "ec2:DescribeVolumeStatus", "ec2:DescribeVolumes", "ec2:DescribeInstanceStatus", "ec2:DescribeTags", "ec2:DescribeVolumeAttribute", "ec2:DescribeImages", "ec2:DescribeSnapshotAttribute", "ec2:DescribeLaunchTemplates", "ec2:DescribeLaunchTemplateVersions", "ec2:DescribeNatGateways", "ec2:DescribeVpcEndpoints", "ec2:DescribeHosts", "ec2:DescribeCapacityReservations", "ssm:GetParameter", "ssm:GetParametersByPath", "cloudtrail:LookupEvents", "iam:ListAccountAliases"}
 	monitorS3  = []string{"s3:GetBucketTagging", "s3:ListBucket", "s3:GetObject", "s3:ListAllMyBuckets", "s3:GetBucketLocation", "cloudwatch:GetMetricStatistics"}
+	monitorDB  = []string{"dynamodb:ListTables", "dynamodb:DescribeTable", "dynamodb:ListTagsOfResource", "elasticache:DescribeCacheClusters", "elasticache:ListTagsForResource", "rds:DescribeDBInstances", "rds:DescribeDBSnapshots", "cloudwatch:GetMetricStatistics"}
 
-	cleanupEC2 = []string{"ec2:DeregisterImage", "ec2:DeleteSnapshot", "ec2:DeleteTags", "ec2:ModifyImageAttribute", "ec2:DeleteVolume", "ec2:TerminateInstances", "ec2:CreateTags", "ec2:StopInstances"}
+	cleanupEC2 = []string{"ec2:DeregisterImage", "ec2:DeleteSnapshot", "ec2:DeleteTags", "ec2:ModifyImageAttribute", "ec2:DeleteVolume", "ec2:TerminateInstances", "ec2:CreateTags", "ec2:StopInstances", "ec2:DeleteNatGateway", "ec2:DeleteVpcEndpoints", "ec2:ReleaseHosts", "ec2:CancelCapacityReservation"}
 	cleanupS3  = []string{"s3:PutBucketTagging", "s3:DeleteObject", "s3:DeleteBucket"}
+	cleanupDB  = []string{"dynamodb:DeleteTable", "dynamodb:TagResource", "dynamodb:UntagResource", "elasticache:DeleteCacheCluster", "elasticache:AddTagsToResource", "elasticache:RemoveTagsFromResource", "rds:DeleteDBInstance", "rds:CreateDBSnapshot", "rds:DeleteDBSnapshot", "rds:AddTagsToResource", "rds:RemoveTagsFromResource"}
 
 	errPolicyExist = errors.New("A policy with the same name already exist")
 	errRoleExist   = errors.New("A role with the same name already exist")
@@ -82,7 +87,7 @@ func awsSetup(masterARN string) error {
 		return nil
 	}
 
-	sess := session.Must(session.NewSession())
+	sess := cloud.NewAWSSession()
 	iamClient := iam.New(sess, &aws.Config{})
 
 	// First create a policy based on what the user configured
@@ -136,8 +141,10 @@ func getAWSConf() *config {
 	// Don't let the user choose what to allow, per request
 	conf.monitorEC2 = true
 	conf.monitorS3 = true
+	conf.monitorDB = true
 	conf.cleanupEC2 = true
 	conf.cleanupS3 = true
+	conf.cleanupDB = true
 	conf.monitor = true
 	conf.cleanup = true
 	/*
@@ -223,8 +230,8 @@ func createAWSPolicy(name string, conf *config, iamClient *iam.IAM) (*iam.Policy
 }
 
 type config struct {
-	monitor, monitorEC2, monitorS3 bool
-	cleanup, cleanupEC2, cleanupS3 bool
+	monitor, monitorEC2, monitorS3, monitorDB bool
+	cleanup, cleanupEC2, cleanupS3, cleanupDB bool
 }
 
 func (c config) String() string {
@@ -235,13 +242,15 @@ func (c config) String() string {
 Allow monitoring of resources: %t
 	EC2:	%t
 	S3: 	%t
+	DynamoDB & ElastiCache:	%t
 
 Allow cleanup of resource: %t
 	EC2:	%t
 	S3: 	%t
+	DynamoDB & ElastiCache:	%t
 
 `
-	return fmt.Sprintf(template, c.monitor, c.monitorEC2, c.monitorS3, c.cleanup, c.cleanupEC2, c.cleanupS3)
+	return fmt.Sprintf(template, c.monitor, c.monitorEC2, c.monitorS3, c.monitorDB, c.cleanup, c.cleanupEC2, c.cleanupS3, c.cleanupDB)
 }
 
 type policyStatement struct {
@@ -268,6 +277,11 @@ func (c config) Policy() policyDocument {
 			actionSet[monitorS3[i]] = struct{}{}
 		}
 	}
+	if c.monitorDB || c.cleanupDB {
+		for i := range monitorDB {
+			actionSet[monitorDB[i]] = struct{}{}
+		}
+	}
 	if c.cleanupEC2 {
 		for i := range cleanupEC2 {
 			actionSet[cleanupEC2[i]] = struct{}{}
@@ -278,6 +292,11 @@ func (c config) Policy() policyDocument {
 			actionSet[cleanupS3[i]] = struct{}{}
 		}
 	}
+	if c.cleanupDB {
+		for i := range cleanupDB {
+			actionSet[cleanupDB[i]] = struct{}{}
+		}
+	}
 
 	doc := policyDocument{}
 	statement := policyStatement{}
@@ -0,0 +1,13 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+//go:build noaws
+// +build noaws
+
+package setup
+
+import "errors"
+
+func awsSetup(masterARN string) error {
+	return errors.New("Cloudsweeper is built without support for AWS")
+}
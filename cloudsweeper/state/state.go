@@ -0,0 +1,143 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+// Package state is used to persist information between runs of
+// Cloudsweeper, such as which emails have already been sent. The
+// state is kept in a single JSON file on local disk, where values
+// are grouped into namespaces.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store is a simple key/value store backed by a JSON file. Every
+// modification is written to disk directly, so that a crashing run
+// does not lose any state. It is safe for concurrent use.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	data map[string]map[string]json.RawMessage
+}
+
+// Open will open the store located at the specified path. If no
+// file exists at the path, an empty store is returned and the file
+// is created on the first write.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		data: make(map[string]map[string]json.RawMessage),
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read state file: %s", err)
+	}
+	if len(raw) == 0 {
+		return s, nil
+	}
+	if err = json.Unmarshal(raw, &s.data); err != nil {
+		return nil, fmt.Errorf("Could not parse state file %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// Get will decode the value stored under key in the specified namespace
+// into v. It returns false if no such value exist.
+func (s *Store) Get(namespace, key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, exist := s.data[namespace][key]
+	if !exist {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Put will store v under key in the specified namespace, and persist
+// the store to disk.
+func (s *Store) Put(namespace, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exist := s.data[namespace]; !exist {
+		s.data[namespace] = make(map[string]json.RawMessage)
+	}
+	s.data[namespace][key] = raw
+	return s.save()
+}
+
+// Delete will remove key from the specified namespace, and persist
+// the store to disk.
+func (s *Store) Delete(namespace, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exist := s.data[namespace][key]; !exist {
+		return nil
+	}
+	delete(s.data[namespace], key)
+	return s.save()
+}
+
+// DeleteKeys will remove all the keys from the specified namespace, and
+// persist the store to disk once.
+func (s *Store) DeleteKeys(namespace string, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := false
+	for _, key := range keys {
+		if _, exist := s.data[namespace][key]; exist {
+			delete(s.data[namespace], key)
+			deleted = true
+		}
+	}
+	if !deleted {
+		return nil
+	}
+	return s.save()
+}
+
+// Keys returns a sorted list of all keys in the specified namespace
+func (s *Store) Keys(namespace string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.data[namespace]))
+	for key := range s.data[namespace] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// save writes the store to a temporary file which is then moved
+// in place, so the state file is never left half written.
+func (s *Store) save() error {
+	raw, err := json.MarshalIndent(s.data, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return fmt.Errorf("Could not write state file: %s", err)
+	}
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Could not write state file: %s", err)
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
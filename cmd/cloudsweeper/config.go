@@ -5,9 +5,10 @@ package main
 
 import (
 	"flag"
-	"log"
 	"strconv"
+	"strings"
 
+	"github.com/cloudtools/cloudsweeper/cloud"
 	"github.com/joho/godotenv"
 )
 
@@ -20,15 +21,122 @@ type lookup struct {
 
 var configMapping = map[string]lookup{
 	// General variables
-	"csp":      lookup{"CS_CSP", "aws"},
-	"org-file": lookup{"CS_ORG_FILE", "organization.json"},
+	"csp":        lookup{"CS_CSP", "aws"},
+	"org-file":   lookup{"CS_ORG_FILE", "organization.json"},
+	"state-file": lookup{"CS_STATE_FILE", optionalDefault},
+	"ordered":    lookup{"CS_ORDERED", "true"},
+
+	// Account alias related
+	"fetch-account-aliases": lookup{"CS_FETCH_ACCOUNT_ALIASES", "true"},
+
+	// Resource cache related
+	"resource-cache-file":      lookup{"CS_RESOURCE_CACHE_FILE", optionalDefault},
+	"resource-cache-ttl-hours": lookup{"CS_RESOURCE_CACHE_TTL_HOURS", "12"},
+
+	// Account error related
+	"fail-on-account-errors": lookup{"CS_FAIL_ON_ACCOUNT_ERRORS", "false"},
+
+	// Cancellation related
+	"run-timeout-minutes": lookup{"CS_RUN_TIMEOUT_MINUTES", "0"},
+
+	// Audit related
+	"audit-file":          lookup{"CS_AUDIT_FILE", optionalDefault},
+	"audit-bucket":        lookup{"CS_AUDIT_BUCKET", optionalDefault},
+	"audit-bucket-region": lookup{"CS_AUDIT_BUCKET_REGION", "us-east-1"},
+	"audit-prefix":        lookup{"CS_AUDIT_PREFIX", "audit/"},
+
+	// Account access related
+	"assume-role-chain": lookup{"CS_ASSUME_ROLE_CHAIN", optionalDefault},
+
+	// Network related
+	"aws-sts-region": lookup{"CS_AWS_STS_REGION", optionalDefault},
+	"aws-endpoints":  lookup{"CS_AWS_ENDPOINTS", optionalDefault},
+	"proxy-url":      lookup{"CS_PROXY_URL", optionalDefault},
+
+	// AWS request throttling related
+	"max-concurrent-requests": lookup{"CS_MAX_CONCURRENT_REQUESTS", "0"},
+	"max-requests-per-second": lookup{"CS_MAX_REQUESTS_PER_SECOND", "0"},
+
+	// GCP bucket listing related
+	"gcp-bucket-list-timeout-seconds":     lookup{"CS_GCP_BUCKET_LIST_TIMEOUT_SECONDS", "300"},
+	"gcp-object-list-requests-per-second": lookup{"CS_GCP_OBJECT_LIST_REQUESTS_PER_SECOND", "10"},
+	"gcp-bucket-list-prefixes":            lookup{"CS_GCP_BUCKET_LIST_PREFIXES", optionalDefault},
+
+	// Tagging related
+	"system-tag-prefixes": lookup{"CS_SYSTEM_TAG_PREFIXES", "aws:,kubernetes.io/,k8s.io/"},
+
+	// Ignore related
+	"ignore-patterns": lookup{"CS_IGNORE_PATTERNS", optionalDefault},
+
+	// Policy file related
+	"policy-file": lookup{"CS_POLICY_FILE", optionalDefault},
+
+	// Database protection related
+	"database-patterns": lookup{"CS_DATABASE_PATTERNS", `(?i)-db$,(?i)mysql,(?i)postgres,(?i)mariadb,(?i)mongo,\b(3306|5432|1433|1521|27017)\b`},
+
+	// Image protection related
+	"image-ssm-parameter-paths":      lookup{"CS_IMAGE_SSM_PARAMETER_PATHS", optionalDefault},
+	"protect-launch-template-images": lookup{"CS_PROTECT_LAUNCH_TEMPLATE_IMAGES", "false"},
+
+	// Release image related
+	"release-tag":                          lookup{"CS_RELEASE_TAG", "Release"},
+	"release-images-private-after-days":    lookup{"CS_RELEASE_IMAGES_PRIVATE_AFTER_DAYS", "0"},
+	"release-images-deregister-after-days": lookup{"CS_RELEASE_IMAGES_DEREGISTER_AFTER_DAYS", "0"},
+	"release-images-csps":                  lookup{"CS_RELEASE_IMAGES_CSPS", "aws"},
+
+	// Aggressiveness related
+	"aggressiveness-multipliers": lookup{"CS_AGGRESSIVENESS_MULTIPLIERS", "conservative=2,aggressive=0.5"},
+
+	// Retention related
+	"retention-tag-key": lookup{"CS_RETENTION_TAG_KEY", optionalDefault},
+
+	// Whitelist approval related
+	"whitelist-approvers":               lookup{"CS_WHITELIST_APPROVERS", optionalDefault},
+	"whitelist-approval-cost-per-month": lookup{"CS_WHITELIST_APPROVAL_COST_PER_MONTH", "0"},
+
+	// Maximum lifetime related
+	"max-lifetime-days":       lookup{"CS_MAX_LIFETIME_DAYS", "0"},
+	"max-lifetime-grace-days": lookup{"CS_MAX_LIFETIME_GRACE_DAYS", "14"},
+	"max-lifetime-accounts":   lookup{"CS_MAX_LIFETIME_ACCOUNTS", optionalDefault},
+
+	// Whitelist report related
+	"whitelist-report-addressee": lookup{"CS_WHITELIST_REPORT_ADDRESSEE", optionalDefault},
+
+	// Cleanup delegation related
+	"cleanup-delegate":                 lookup{"CS_CLEANUP_DELEGATE", optionalDefault},
+	"cleanup-delegate-region":          lookup{"CS_CLEANUP_DELEGATE_REGION", optionalDefault},
+	"cleanup-delegate-timeout-minutes": lookup{"CS_CLEANUP_DELEGATE_TIMEOUT_MINUTES", "60"},
+
+	// Snapshot cleanup related
+	"snapshot-cleanup-concurrency": lookup{"CS_SNAPSHOT_CLEANUP_CONCURRENCY", "10"},
+
+	// Marking related
+	"marking-concurrency": lookup{"CS_MARKING_CONCURRENCY", "5"},
+
+	// Volume archival related
+	"archive-volume-days": lookup{"CS_ARCHIVE_VOLUME_DAYS", "0"},
+
+	// Freeze window related
+	"freeze-windows": lookup{"CS_FREEZE_WINDOWS", optionalDefault},
 
 	// Billing related
-	"billing-account":       lookup{"CS_BILLING_ACCOUNT", ""},
-	"billing-bucket-region": lookup{"CS_BILLING_BUCKET_REGION", ""},
-	"billing-csv-prefix":    lookup{"CS_BILLING_CSV_PREFIX", ""},
-	"billing-bucket":        lookup{"CS_BILLING_BUCKET_NAME", ""},
-	"billing-sort-tag":      lookup{"CS_BILLING_SORT_TAG", optionalDefault},
+	"billing-account":        lookup{"CS_BILLING_ACCOUNT", ""},
+	"billing-bucket-region":  lookup{"CS_BILLING_BUCKET_REGION", ""},
+	"billing-csv-prefix":     lookup{"CS_BILLING_CSV_PREFIX", ""},
+	"billing-bucket":         lookup{"CS_BILLING_BUCKET_NAME", ""},
+	"billing-sort-tag":       lookup{"CS_BILLING_SORT_TAG", optionalDefault},
+	"billing-source":         lookup{"CS_BILLING_SOURCE", "cur"},
+	"cost-amortization-days": lookup{"CS_COST_AMORTIZATION_DAYS", "0"},
+
+	// BigQuery billing export related, used in GCP instead of the
+	// billing CSVs if a project is set
+	"billing-bigquery-project": lookup{"CS_BILLING_BIGQUERY_PROJECT", optionalDefault},
+	"billing-bigquery-dataset": lookup{"CS_BILLING_BIGQUERY_DATASET", ""},
+	"billing-bigquery-table":   lookup{"CS_BILLING_BIGQUERY_TABLE", ""},
+
+	// Cost anomaly related
+	"cost-anomaly-min-increase-percent": lookup{"CS_COST_ANOMALY_MIN_INCREASE_PERCENT", "50"},
+	"cost-anomaly-min-increase":         lookup{"CS_COST_ANOMALY_MIN_INCREASE", "100"},
 
 	// Email variables
 	"smtp-username": lookup{"CS_SMTP_USER", ""},
@@ -40,39 +148,151 @@ var configMapping = map[string]lookup{
 	"warning-hours":            lookup{"CS_WARNING_HOURS", "48"},
 	"display-name":             lookup{"CS_DISPLAY_NAME", "Cloudsweeper"},
 	"mail-from":                lookup{"CS_MAIL_FROM", ""},
-	"billing-report-addressee": lookup{"CS_BILLING_REPORT_ADDRESSEE", ""},
-	"total-sum-addressee":      lookup{"CS_TOTAL_SUM_ADDRESSEE", ""},
+	"billing-report-addressee": lookup{"CS_BILLING_REPORT_ADDRESSEE", optionalDefault},
+	"total-sum-addressee":      lookup{"CS_TOTAL_SUM_ADDRESSEE", optionalDefault},
 	"mail-domain":              lookup{"CS_EMAIL_DOMAIN", ""},
+	"mail-dedupe-hours":        lookup{"CS_MAIL_DEDUPE_HOURS", "20"},
+	"mail-max-per-recipient":   lookup{"CS_MAIL_MAX_PER_RECIPIENT", "0"},
+	"automation-principals":    lookup{"CS_AUTOMATION_PRINCIPALS", optionalDefault},
+	"automation-addressee":     lookup{"CS_AUTOMATION_ADDRESSEE", optionalDefault},
+	"review-manager-rollup":    lookup{"CS_REVIEW_MANAGER_ROLLUP", "full"},
+	"review-org-rollup":        lookup{"CS_REVIEW_ORG_ROLLUP", "full"},
+	"review-rollup-top-n":      lookup{"CS_REVIEW_ROLLUP_TOP_N", "25"},
+	"review-rollup-depth":      lookup{"CS_REVIEW_ROLLUP_DEPTH", "1"},
+	"creator-lookup":           lookup{"CS_CREATOR_LOOKUP", "false"},
+	"mail-sort-by":             lookup{"CS_MAIL_SORT_BY", "cost"},
+
+	// Mail subject templates, the default subjects are used if empty
+	"subject-review":               lookup{"CS_SUBJECT_REVIEW", optionalDefault},
+	"subject-manager-review":       lookup{"CS_SUBJECT_MANAGER_REVIEW", optionalDefault},
+	"subject-org-review":           lookup{"CS_SUBJECT_ORG_REVIEW", optionalDefault},
+	"subject-merged-review":        lookup{"CS_SUBJECT_MERGED_REVIEW", optionalDefault},
+	"subject-untagged":             lookup{"CS_SUBJECT_UNTAGGED", optionalDefault},
+	"subject-deletion-warning":     lookup{"CS_SUBJECT_DELETION_WARNING", optionalDefault},
+	"subject-automation-warning":   lookup{"CS_SUBJECT_AUTOMATION_WARNING", optionalDefault},
+	"subject-month-to-date":        lookup{"CS_SUBJECT_MONTH_TO_DATE", optionalDefault},
+	"subject-marking-dry-run":      lookup{"CS_SUBJECT_MARKING_DRY_RUN", optionalDefault},
+	"subject-retention-lapsed":     lookup{"CS_SUBJECT_RETENTION_LAPSED", optionalDefault},
+	"subject-account-summary":      lookup{"CS_SUBJECT_ACCOUNT_SUMMARY", optionalDefault},
+	"subject-stop-warning":         lookup{"CS_SUBJECT_STOP_WARNING", optionalDefault},
+	"subject-credential-hygiene":   lookup{"CS_SUBJECT_CREDENTIAL_HYGIENE", optionalDefault},
+	"subject-whitelist-report":     lookup{"CS_SUBJECT_WHITELIST_REPORT", optionalDefault},
+	"subject-cost-anomaly":         lookup{"CS_SUBJECT_COST_ANOMALY", optionalDefault},
+	"subject-orphan":               lookup{"CS_SUBJECT_ORPHAN", optionalDefault},
+	"subject-stack-report":         lookup{"CS_SUBJECT_STACK_REPORT", optionalDefault},
+	"subject-whitelist-expiry":     lookup{"CS_SUBJECT_WHITELIST_EXPIRY", optionalDefault},
+	"subject-whitelist-reapproval": lookup{"CS_SUBJECT_WHITELIST_REAPPROVAL", optionalDefault},
+	"subject-badge":                lookup{"CS_SUBJECT_BADGE", optionalDefault},
+
+	// Directory variables
+	"directory-scim-url":   lookup{"CS_DIRECTORY_SCIM_URL", optionalDefault},
+	"directory-scim-token": lookup{"CS_DIRECTORY_SCIM_TOKEN", optionalDefault},
+
+	// Plan variables
+	"plan-mode":                   lookup{"CS_PLAN_MODE", "mark-for-cleanup"},
+	"plan-max-marked":             lookup{"CS_PLAN_MAX_MARKED", "0"},
+	"plan-max-marked-per-account": lookup{"CS_PLAN_MAX_MARKED_PER_ACCOUNT", "0"},
+	"plan-max-cleaned-up":         lookup{"CS_PLAN_MAX_CLEANED_UP", "0"},
+	"plan-max-mails":              lookup{"CS_PLAN_MAX_MAILS", "0"},
+
+	// Serve variables
+	"serve-address":         lookup{"CS_SERVE_ADDRESS", ":8080"},
+	"serve-refresh-minutes": lookup{"CS_SERVE_REFRESH_MINUTES", "60"},
+
+	// Metrics variables
+	"metrics-pushgateway-url": lookup{"CS_METRICS_PUSHGATEWAY_URL", optionalDefault},
+	"metrics-pushgateway-job": lookup{"CS_METRICS_PUSHGATEWAY_JOB", "cloudsweeper"},
+
+	// Backfill variables
+	"backfill-tag-keys": lookup{"CS_BACKFILL_TAG_KEYS", "product,role"},
+
+	// Dashboard variables
+	"dashboard-bucket":        lookup{"CS_DASHBOARD_BUCKET_NAME", optionalDefault},
+	"dashboard-bucket-region": lookup{"CS_DASHBOARD_BUCKET_REGION", "us-east-1"},
+	"dashboard-dir":           lookup{"CS_DASHBOARD_DIR", "dashboard"},
+	"dashboard-url":           lookup{"CS_DASHBOARD_URL", optionalDefault},
+
+	// Doctor variables
+	"doctor-addressee": lookup{"CS_DOCTOR_ADDRESSEE", optionalDefault},
+
+	// Reconcile variables
+	"reconcile-management-account": lookup{"CS_RECONCILE_MANAGEMENT_ACCOUNT", optionalDefault},
+	"reconcile-owner-tag":          lookup{"CS_RECONCILE_OWNER_TAG", "owner"},
+	"reconcile-default-owner":      lookup{"CS_RECONCILE_DEFAULT_OWNER", optionalDefault},
+	"reconcile-patch-file":         lookup{"CS_RECONCILE_PATCH_FILE", "organization.patch.json"},
+
+	// Held mail variables
+	"hold-notifications":      lookup{"CS_HOLD_NOTIFICATIONS", "false"},
+	"held-mail-dir":           lookup{"CS_HELD_MAIL_DIR", "held-mail"},
+	"held-mail-bucket":        lookup{"CS_HELD_MAIL_BUCKET_NAME", optionalDefault},
+	"held-mail-bucket-region": lookup{"CS_HELD_MAIL_BUCKET_REGION", "us-east-1"},
+
+	// Output variables
+	"output-format": lookup{"CS_OUTPUT_FORMAT", optionalDefault},
+	"output-file":   lookup{"CS_OUTPUT_FILE", "-"},
+	"output-only":   lookup{"CS_OUTPUT_ONLY", "true"},
 
 	// Setup variables
 	"aws-master-arn": lookup{"CS_MASTER_ARN", ""},
 
 	// Clean thresholds
-	"clean-untagged-older-than-days":    lookup{"CLEAN_UNTAGGED_OLDER_THAN_DAYS", "30"},
-	"clean-instances-older-than-days":   lookup{"CLEAN_INSTANCES_OLDER_THAN_DAYS", "182"},
-	"clean-images-older-than-days":      lookup{"CLEAN_IMAGES_OLDER_THAN_DAYS", "182"},
-	"clean-snapshots-older-than-days":   lookup{"CLEAN_SNAPSHOTS_OLDER_THAN_DAYS", "182"},
-	"clean-unattatched-older-than-days": lookup{"CLEAN_UNATTATCHED_OLDER_THAN_DAYS", "30"},
-	"clean-bucket-not-modified-days":    lookup{"CLEAN_BUCKET_NOT_MODIFIED_DAYS", "182"},
-	"clean-bucket-older-than-days":      lookup{"CLEAN_BUCKET_OLDER_THAN_DAYS", "7"},
-	"clean-keep-n-component-images":     lookup{"CLEAN_KEEP_N_COMPONENT_IMAGES", "2"},
+	"clean-untagged-older-than-days":                     lookup{"CLEAN_UNTAGGED_OLDER_THAN_DAYS", "30"},
+	"clean-instances-older-than-days":                    lookup{"CLEAN_INSTANCES_OLDER_THAN_DAYS", "182"},
+	"clean-images-older-than-days":                       lookup{"CLEAN_IMAGES_OLDER_THAN_DAYS", "182"},
+	"clean-snapshots-older-than-days":                    lookup{"CLEAN_SNAPSHOTS_OLDER_THAN_DAYS", "182"},
+	"clean-unattatched-older-than-days":                  lookup{"CLEAN_UNATTATCHED_OLDER_THAN_DAYS", "30"},
+	"clean-bucket-not-modified-days":                     lookup{"CLEAN_BUCKET_NOT_MODIFIED_DAYS", "182"},
+	"clean-bucket-older-than-days":                       lookup{"CLEAN_BUCKET_OLDER_THAN_DAYS", "7"},
+	"clean-keep-n-component-images":                      lookup{"CLEAN_KEEP_N_COMPONENT_IMAGES", "2"},
+	"clean-max-marked-per-account":                       lookup{"CLEAN_MAX_MARKED_PER_ACCOUNT", "0"},
+	"clean-tables-idle-days":                             lookup{"CLEAN_TABLES_IDLE_DAYS", "0"},
+	"clean-cache-clusters-idle-days":                     lookup{"CLEAN_CACHE_CLUSTERS_IDLE_DAYS", "0"},
+	"clean-unused-addresses-older-than-days":             lookup{"CLEAN_UNUSED_ADDRESSES_OLDER_THAN_DAYS", "0"},
+	"clean-network-gateways-idle-days":                   lookup{"CLEAN_NETWORK_GATEWAYS_IDLE_DAYS", "0"},
+	"clean-unused-capacity-reservations-older-than-days": lookup{"CLEAN_UNUSED_CAPACITY_RESERVATIONS_OLDER_THAN_DAYS", "0"},
+	"clean-db-instances-idle-days":                       lookup{"CLEAN_DB_INSTANCES_IDLE_DAYS", "0"},
+	"clean-db-snapshots-older-than-days":                 lookup{"CLEAN_DB_SNAPSHOTS_OLDER_THAN_DAYS", "0"},
+	"clean-keep-n-family-images":                         lookup{"CLEAN_KEEP_N_FAMILY_IMAGES", "0"},
+	"clean-image-copies-older-than-days":                 lookup{"CLEAN_IMAGE_COPIES_OLDER_THAN_DAYS", "0"},
+	"clean-stop-instances":                               lookup{"CLEAN_STOP_INSTANCES", "0"},
+	"clean-databases":                                    lookup{"CLEAN_DATABASES", "0"},
+	"clean-volumes-min-size-gb":                          lookup{"CLEAN_VOLUMES_MIN_SIZE_GB", "0"},
+	"clean-snapshots-min-size-gb":                        lookup{"CLEAN_SNAPSHOTS_MIN_SIZE_GB", "0"},
+	"clean-images-min-size-gb":                           lookup{"CLEAN_IMAGES_MIN_SIZE_GB", "0"},
+	"clean-buckets-min-size-gb":                          lookup{"CLEAN_BUCKETS_MIN_SIZE_GB", "0"},
 
 	//  Notify thresholds
-	"notify-untagged-older-than-days":   lookup{"NOTIFY_UNTAGGED_OLDER_THAN_DAYS", "14"},
-	"notify-instances-older-than-days":  lookup{"NOTIFY_INSTANCES_OLDER_THAN_DAYS", "30"},
-	"notify-images-older-than-days":     lookup{"NOTIFY_IMAGES_OLDER_THAN_DAYS", "30"},
-	"notify-unattached-older-than-days": lookup{"NOTIFY_UNATTATCHED_OLDER_THAN_DAYS", "30"},
-	"notify-snapshots-older-than-days":  lookup{"NOTIFY_SNAPSHOTS_OLDER_THAN_DAYS", "30"},
-	"notify-buckets-older-than-days":    lookup{"NOTIFY_BUCKETS_OLDER_THAN_DAYS", "30"},
-	"notify-whitelist-older-than-days":  lookup{"NOTIFY_WHITELIST_OLDER_THAN_DAYS", "182"},
-	"notify-dnd-older-than-days":        lookup{"NOTIFY_DND_OLDER_THAN_DAYS", "7"},
+	"notify-untagged-older-than-days":         lookup{"NOTIFY_UNTAGGED_OLDER_THAN_DAYS", "14"},
+	"notify-instances-older-than-days":        lookup{"NOTIFY_INSTANCES_OLDER_THAN_DAYS", "30"},
+	"notify-images-older-than-days":           lookup{"NOTIFY_IMAGES_OLDER_THAN_DAYS", "30"},
+	"notify-unattached-older-than-days":       lookup{"NOTIFY_UNATTATCHED_OLDER_THAN_DAYS", "30"},
+	"notify-snapshots-older-than-days":        lookup{"NOTIFY_SNAPSHOTS_OLDER_THAN_DAYS", "30"},
+	"notify-buckets-older-than-days":          lookup{"NOTIFY_BUCKETS_OLDER_THAN_DAYS", "30"},
+	"notify-whitelist-older-than-days":        lookup{"NOTIFY_WHITELIST_OLDER_THAN_DAYS", "182"},
+	"notify-whitelist-expiry-days":            lookup{"NOTIFY_WHITELIST_EXPIRY_DAYS", "14"},
+	"notify-whitelist-reapproval-days":        lookup{"NOTIFY_WHITELIST_REAPPROVAL_DAYS", "365"},
+	"notify-dnd-older-than-days":              lookup{"NOTIFY_DND_OLDER_THAN_DAYS", "7"},
+	"notify-tables-idle-days":                 lookup{"NOTIFY_TABLES_IDLE_DAYS", "30"},
+	"notify-cache-clusters-idle-days":         lookup{"NOTIFY_CACHE_CLUSTERS_IDLE_DAYS", "30"},
+	"notify-unused-addresses-older-than-days": lookup{"NOTIFY_UNUSED_ADDRESSES_OLDER_THAN_DAYS", "7"},
+	"notify-network-gateways-idle-days":       lookup{"NOTIFY_NETWORK_GATEWAYS_IDLE_DAYS", "30"},
+	"notify-capacities-older-than-days":       lookup{"NOTIFY_CAPACITIES_OLDER_THAN_DAYS", "7"},
+	"notify-db-instances-idle-days":           lookup{"NOTIFY_DB_INSTANCES_IDLE_DAYS", "14"},
+	"notify-db-snapshots-older-than-days":     lookup{"NOTIFY_DB_SNAPSHOTS_OLDER_THAN_DAYS", "30"},
+	"notify-in-use-storage-older-than-days":   lookup{"NOTIFY_IN_USE_STORAGE_OLDER_THAN_DAYS", "0"},
+	"notify-public-instances-idle-days":       lookup{"NOTIFY_PUBLIC_INSTANCES_IDLE_DAYS", "14"},
+	"notify-access-keys-older-than-days":      lookup{"NOTIFY_ACCESS_KEYS_OLDER_THAN_DAYS", "90"},
+	"notify-access-keys-unused-days":          lookup{"NOTIFY_ACCESS_KEYS_UNUSED_DAYS", "90"},
+	"notify-min-resources-per-email":          lookup{"NOTIFY_MIN_RESOURCES_PER_EMAIL", "1"},
+	"notify-min-resources-per-type":           lookup{"NOTIFY_MIN_RESOURCES_PER_TYPE", optionalDefault},
+	"notify-runbook-dir":                      lookup{"NOTIFY_RUNBOOK_DIR", optionalDefault},
 }
 
 func loadConfig() {
 	var err error
 	config, err = godotenv.Read(configFileName)
 	if err != nil {
-		log.Fatalf("Could not load config file '%s': %s", configFileName, err)
+		configFatalf("Could not load config file '%s': %s", configFileName, err)
 	}
 }
 
@@ -82,29 +302,65 @@ func loadThresholds() {
 	}
 }
 
+// loadPolicy reads thresholds from a file on the same format as the config
+// file. Thresholds missing in the file get their configured value.
+func loadPolicy(fileName string) map[string]int {
+	policyConfig, err := godotenv.Read(fileName)
+	if err != nil {
+		configFatalf("Could not load policy file '%s': %s", fileName, err)
+	}
+	policy := make(map[string]int, len(thresholds))
+	for _, name := range thnames {
+		policy[name] = thresholds[name]
+		if val, ok := policyConfig[configMapping[name].confKey]; ok && val != "" {
+			i, err := strconv.Atoi(val)
+			if err != nil {
+				configFatalf("Value specified for %s in '%s' is not an integer", name, fileName)
+			}
+			policy[name] = i
+		}
+	}
+	return policy
+}
+
+// findConfig returns the value of a config option, from its flag, the
+// config file or its default, in that order. Values referring to a secret
+// in a secret manager are resolved.
 func findConfig(name string) string {
+	val := rawConfig(name)
+	if cloud.IsSecretReference(val) {
+		return resolveSecretConfig(name, val)
+	}
+	return val
+}
+
+func rawConfig(name string) string {
 	if _, exist := configMapping[name]; !exist {
-		log.Fatalf("Unknown config option: %s", name)
+		configFatalf("Unknown config option: %s", name)
+	}
+	val := configValue(name)
+	if configMapping[name].defaultValue != optionalDefault {
+		maybeNoValExit(val, name)
 	}
-	flagVal := flag.Lookup(name).Value.String()
-	if flagVal != "" {
+	return val
+}
+
+// configValue returns the value of a config option as specified, without
+// resolving secret references. An empty string is returned if it's unset.
+func configValue(name string) string {
+	if flagVal := flag.Lookup(name).Value.String(); flagVal != "" {
 		return flagVal
-	} else if confVal, ok := config[configMapping[name].confKey]; ok && confVal != "" {
-		maybeNoValExit(confVal, name)
+	} else if confVal := config[configMapping[name].confKey]; confVal != "" {
 		return confVal
-	} else {
-		defaultVal := configMapping[name].defaultValue
-		if defaultVal == optionalDefault {
-			return ""
-		}
-		maybeNoValExit(defaultVal, name)
+	} else if defaultVal := configMapping[name].defaultValue; defaultVal != optionalDefault {
 		return defaultVal
 	}
+	return ""
 }
 
 func maybeNoValExit(val, name string) {
 	if val == "" {
-		log.Fatalf("No value specified for --%s", name)
+		configFatalf("No value specified for --%s", name)
 	}
 }
 
@@ -112,7 +368,35 @@ func findConfigInt(name string) int {
 	val := findConfig(name)
 	i, err := strconv.Atoi(val)
 	if err != nil {
-		log.Fatalf("Value specified for %s is not an integer", name)
+		configFatalf("Value specified for %s is not an integer", name)
 	}
 	return i
 }
+
+func findConfigFloat(name string) float64 {
+	val := findConfig(name)
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || f < 0 {
+		configFatalf("Value specified for %s is not a positive number", name)
+	}
+	return f
+}
+
+func findConfigBool(name string) bool {
+	val := findConfig(name)
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		configFatalf("Value specified for %s is not a boolean", name)
+	}
+	return b
+}
+
+func findConfigList(name string) []string {
+	result := []string{}
+	for _, val := range strings.Split(findConfig(name), ",") {
+		if val = strings.TrimSpace(val); val != "" {
+			result = append(result, val)
+		}
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/doctor"
+)
+
+const doctorNamespace = "doctor"
+
+// doctorChecks returns the checks of every integration used with the CSP.
+// Config is read with configValue, so that missing config fails a check
+// instead of exiting.
+func doctorChecks(csp cloud.CSP, org *cs.Organization) []doctor.Check {
+	checks := []doctor.Check{}
+	for _, account := range org.EnabledAccounts(csp) {
+		account := account
+		checks = append(checks, doctor.Check{
+			Name: fmt.Sprintf("Access to %s", account),
+			Run:  func() error { return cloud.CheckAccess(csp, account) },
+		})
+	}
+	checks = append(checks,
+		doctor.Check{Name: "SMTP login", Run: func() error { return checkSMTP(org) }},
+		doctor.Check{Name: "Billing data", Run: func() error { return checkBillingData(csp) }},
+		doctor.Check{Name: "State store", Run: checkStateStore},
+		doctor.Check{Name: "Pricing API", Run: func() error { return checkPricingAPI(csp, org) }},
+	)
+	return checks
+}
+
+// checkSMTP sends a test mail to the doctor addressee, which fails if the
+// SMTP login fails
+func checkSMTP(org *cs.Organization) error {
+	for _, name := range []string{"smtp-username", "smtp-password", "smtp-server", "mail-from", "mail-domain"} {
+		if configValue(name) == "" {
+			return fmt.Errorf("No value specified for --%s", name)
+		}
+	}
+	addressee := configValue("doctor-addressee")
+	if addressee == "" {
+		addressee = configValue("total-sum-addressee")
+	}
+	if addressee == "" {
+		return errors.New("No value specified for --doctor-addressee or --total-sum-addressee")
+	}
+	if err := initNotifyClient(org).SendTestMail(addressee); err != nil {
+		return fmt.Errorf("Could not send test mail to %s: %s", addressee, err)
+	}
+	return nil
+}
+
+func checkBillingData(csp cloud.CSP) error {
+	var reporter billing.Reporter
+	if csp == cloud.GCP && configValue("billing-bigquery-project") != "" {
+		if configValue("billing-bigquery-dataset") == "" || configValue("billing-bigquery-table") == "" {
+			return errors.New("No value specified for --billing-bigquery-dataset or --billing-bigquery-table")
+		}
+		reporter = billing.NewReporterBigQuery(configValue("billing-bigquery-project"), configValue("billing-bigquery-dataset"), configValue("billing-bigquery-table"))
+	} else if csp == cloud.AWS && configValue("billing-source") == billingSourceCostExplorer {
+		if configValue("billing-account") == "" {
+			return errors.New("No value specified for --billing-account")
+		}
+		reporter = billing.NewReporterCostExplorer(configValue("billing-account"), "")
+	} else if configValue("billing-bucket") == "" {
+		return doctor.Skip("No billing bucket configured")
+	} else if csp == cloud.AWS {
+		if configValue("billing-account") == "" || configValue("billing-bucket-region") == "" {
+			return errors.New("No value specified for --billing-account or --billing-bucket-region")
+		}
+		reporter = billing.NewReporterAWS(configValue("billing-account"), configValue("billing-bucket"), configValue("billing-bucket-region"), "")
+	} else {
+		if configValue("billing-csv-prefix") == "" {
+			return errors.New("No value specified for --billing-csv-prefix")
+		}
+		reporter = billing.NewReporterGCP(configValue("billing-bucket"), configValue("billing-csv-prefix"))
+	}
+	checker, ok := reporter.(billing.AccessChecker)
+	if !ok {
+		return doctor.Skip("Billing data can't be checked")
+	}
+	return checker.CheckAccess()
+}
+
+// checkStateStore writes the time of the check to the state store
+func checkStateStore() error {
+	store := initStateStore()
+	if store == nil {
+		return doctor.Skip("No state file configured")
+	}
+	return store.Put(doctorNamespace, "last-check", clock.Now().Format(time.RFC3339))
+}
+
+func checkPricingAPI(csp cloud.CSP, org *cs.Organization) error {
+	if csp != cloud.AWS {
+		return doctor.Skip("Prices of GCP resources are built in")
+	}
+	accounts := org.EnabledAccounts(csp)
+	if len(accounts) == 0 {
+		return errors.New("No enabled accounts to use the pricing API with")
+	}
+	return billing.CheckPricingAPI(accounts[0])
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/cleanup"
+)
+
+// Exit codes, so that wrappers can act on the outcome of a command
+// without parsing its logs
+const (
+	exitOK = 0
+	// exitFailure is used for unexpected errors, such as failing to
+	// list resources, and is what log.Fatal exits with
+	exitFailure = 1
+	// exitConfigError is used for missing or invalid config, it's also
+	// what the flag package exits with on invalid flags
+	exitConfigError = 2
+	// exitPartialFailure is used when the command failed in some accounts
+	exitPartialFailure = 3
+	// exitNothingToDo is used when there were no resources to act on
+	exitNothingToDo = 4
+	// exitDeletionsPerformed is used when resources were cleaned up
+	exitDeletionsPerformed = 5
+	// exitApprovalRequired is used when a plan exceeds its limits, and
+	// must be approved before it's carried out
+	exitApprovalRequired = 6
+	// exitCancelled is used when the command was interrupted, or ran
+	// longer than run-timeout-minutes, before it finished
+	exitCancelled = 7
+)
+
+// accountErrors are the errors of the accounts that failed during the
+// command, see recordAccountErrors
+var accountErrors cloud.AccountErrors
+
+// recordAccountErrors records the failed accounts if err is
+// cloud.AccountErrors, so that the command can carry on with the other
+// accounts. It returns false if err is any other error.
+func recordAccountErrors(err error) bool {
+	errs, ok := err.(cloud.AccountErrors)
+	if ok {
+		accountErrors = append(accountErrors, errs...)
+	}
+	return ok
+}
+
+// accountErrorsExitCode logs a summary of the accounts that failed during
+// the command, in any of the managers. The command exits with
+// exitPartialFailure instead of exitCode if fail-on-account-errors is set
+// and some account failed, unless exitCode is already a failure.
+func accountErrorsExitCode(exitCode int, managers []cloud.ResourceManager) int {
+	errs := accountErrors
+	for _, mngr := range managers {
+		if err := mngr.ScanStatus().Err(); err != nil {
+			errs = append(errs, err.(cloud.AccountErrors)...)
+		}
+	}
+	if len(errs) == 0 {
+		return exitCode
+	}
+	log.Printf("%d accounts failed, their data is partial:\n", len(errs.Accounts()))
+	for _, err := range errs {
+		log.Printf("\t%s (%s): %s\n", cloud.AccountName(err.Account), err.Region, err.Err)
+	}
+	if !findConfigBool("fail-on-account-errors") {
+		return exitCode
+	}
+	switch exitCode {
+	case exitOK, exitNothingToDo, exitDeletionsPerformed:
+		return exitPartialFailure
+	default:
+		return exitCode
+	}
+}
+
+// configFatalf logs an error in the config and exits with exitConfigError
+func configFatalf(format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	os.Exit(exitConfigError)
+}
+
+// markingExitCode logs which accounts resources were marked for cleanup
+// in, and returns the exit code of the mark-for-cleanup command. The
+// command exits with exitPartialFailure if the marking failed in some
+// account, since it must be run again to complete the marking there.
+func markingExitCode(report *cleanup.MarkingReport, marked int) int {
+	total := len(report.Completed) + len(report.Failed) + len(report.Skipped)
+	log.Printf("Marking completed in %d of %d accounts: %s\n", len(report.Completed), total, strings.Join(accountNames(report.Completed), ", "))
+	for _, err := range report.Failed {
+		log.Printf("\tFailed in %s: %s\n", cloud.AccountName(err.Account), err.Err)
+	}
+	if len(report.Skipped) > 0 {
+		log.Printf("\tSkipped %s, since the command did not finish\n", strings.Join(accountNames(report.Skipped), ", "))
+	}
+	switch {
+	case len(report.Failed) > 0:
+		return exitPartialFailure
+	case marked == 0:
+		log.Println("No resources to mark for cleanup")
+		return exitNothingToDo
+	default:
+		return exitOK
+	}
+}
+
+// accountNames returns the accounts as they're shown in logs, see
+// cloud.AccountName
+func accountNames(accounts []string) []string {
+	names := make([]string, len(accounts))
+	for i, account := range accounts {
+		names[i] = cloud.AccountName(account)
+	}
+	return names
+}
+
+// cleanupExitCode returns the exit code of the cleanup command
+func cleanupExitCode(result *cleanup.Result) int {
+	if result.Throttling.Throttled > 0 {
+		log.Printf("%d requests were throttled, %d of them failed after retrying\n", result.Throttling.Throttled, result.Throttling.Exhausted)
+	}
+	if result.ArchivedVolumes > 0 {
+		log.Printf("Archived %d volumes before cleaning them up, costing an estimated $%.2f per month\n", result.ArchivedVolumes, result.ArchiveCostPerMonth)
+	}
+	switch {
+	case len(result.FailedAccounts) > 0:
+		log.Printf("Cleaned up %d resources (%.1f GB of data), cleanup failed in %s\n", result.CleanedUp, result.TotalDestroyedGB(), strings.Join(result.FailedAccounts, ", "))
+		return exitPartialFailure
+	case result.CleanedUp > 0:
+		log.Printf("Cleaned up %d resources (%.1f GB of data)\n", result.CleanedUp, result.TotalDestroyedGB())
+		return exitDeletionsPerformed
+	default:
+		log.Println("No resources to clean up")
+		return exitNothingToDo
+	}
+}
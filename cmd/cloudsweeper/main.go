@@ -4,58 +4,240 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"html/template"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"os/user"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/cloudtools/cloudsweeper/cloud"
 	"github.com/cloudtools/cloudsweeper/cloud/billing"
+	"github.com/cloudtools/cloudsweeper/cloud/clock"
+	"github.com/cloudtools/cloudsweeper/cloud/filter"
 	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
 	"github.com/cloudtools/cloudsweeper/cloudsweeper/cleanup"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/dashboard"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/directory"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/doctor"
 	"github.com/cloudtools/cloudsweeper/cloudsweeper/find"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/metrics"
 	"github.com/cloudtools/cloudsweeper/cloudsweeper/notify"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/plan"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/query"
 	"github.com/cloudtools/cloudsweeper/cloudsweeper/setup"
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/state"
 )
 
 const (
 	configFileName = "config.conf"
 	cspFlagAWS     = "aws"
 	cspFlagGCP     = "gcp"
+
+	billingSourceCUR          = "cur"
+	billingSourceCostExplorer = "cost-explorer"
 )
 
 var (
 	config map[string]string
 
-	cspToUse = flag.String("csp", "", "Which CSP to run against")
-	orgFile  = flag.String("org-file", "", "Specify where to find the JSON with organization information")
+	cspToUse  = flag.String("csp", "", "Which CSP to run against, or a comma separated list of CSPs to review together")
+	orgFile   = flag.String("org-file", "", "Specify where to find the JSON with organization information")
+	stateFile = flag.String("state-file", "", "Specify where to keep state between runs, such as which mails have been sent")
+	ordered   = flag.String("ordered", "", "Process accounts and list resources in a deterministic order, so that mails are identical between runs (true/false)")
+
+	fetchAccountAliases = flag.String("fetch-account-aliases", "", "Look up the IAM aliases of AWS accounts without an alias in the organization file, to show them with the account IDs (true/false)")
+
+	resourceCacheFile     = flag.String("resource-cache-file", "", "Specify where to cache the resources of all accounts, which the scan command lists and review, warn and mark-for-cleanup read")
+	resourceCacheTTLHours = flag.String("resource-cache-ttl-hours", "", "List the resources of accounts again if their data in the resource cache is older than X hours")
+
+	failOnAccountErrors = flag.String("fail-on-account-errors", "", "Exit with code 3 if some accounts could not be scanned or processed, instead of only logging them (true/false)")
+
+	runTimeoutMinutes = flag.String("run-timeout-minutes", "", "Cancel the command if it runs longer than this many minutes, 0 means no limit")
+
+	auditFile         = flag.String("audit-file", "", "Append every tag set, tag removed and resource stopped or deleted, as JSON lines, to this file")
+	auditBucket       = flag.String("audit-bucket", "", "Write every tag set, tag removed and resource stopped or deleted, as JSON lines, to an object per run in this S3 or GCS bucket")
+	auditBucketRegion = flag.String("audit-bucket-region", "", "The region of the S3 audit bucket")
+	auditPrefix       = flag.String("audit-prefix", "", "Prefix of the names of the audit objects in the audit bucket")
+
+	assumeRoleChain = flag.String("assume-role-chain", "", "Comma separated list of AWS roles assumed in order to access an account, on the form <ARN>[|<external ID>]")
+
+	awsSTSRegion = flag.String("aws-sts-region", "", "Use the regional STS endpoints, and this region for STS calls not made in a specific region, instead of the global STS endpoint")
+	awsEndpoints = flag.String("aws-endpoints", "", "Comma separated list of custom AWS endpoints, such as VPC endpoints, on the form <service>=<URL>, {region} in a URL is replaced by the region")
+	proxyURL     = flag.String("proxy-url", "", "URL of a proxy all requests to AWS, GCP and other services are sent through")
+
+	maxConcurrentRequests = flag.String("max-concurrent-requests", "", "Maximum number of AWS regions, of all accounts, listed at the same time, 0 means no limit")
+	maxRequestsPerSecond  = flag.String("max-requests-per-second", "", "Maximum rate of all requests to AWS, shared by all accounts and regions, 0 means no limit")
+
+	gcpBucketListTimeoutSeconds    = flag.String("gcp-bucket-list-timeout-seconds", "", "Maximum time in seconds spent listing the objects of a GCP bucket, 0 means no limit")
+	gcpObjectListRequestsPerSecond = flag.String("gcp-object-list-requests-per-second", "", "Maximum rate of requests listing objects in a GCP bucket, 0 means no limit")
+	gcpBucketListPrefixes          = flag.String("gcp-bucket-list-prefixes", "", "Comma separated list of prefixes, if set only objects under these are listed in GCP buckets")
+
+	systemTagPrefixes = flag.String("system-tag-prefixes", "", "Comma separated list of tag key prefixes that are ignored when detecting untagged resources")
+
+	ignorePatterns = flag.String("ignore-patterns", "", "Comma separated list of regular expressions, resources whose ID, ARN or name matches any of them are never listed")
+
+	policyFile = flag.String("policy-file", "", "Specify a YAML policy file with rule chains that replace the built-in rules for marking instances, images, volumes, snapshots and buckets")
+
+	databasePatterns = flag.String("database-patterns", "", "Comma separated list of regular expressions, instances whose tag values or security groups match any of them are treated as databases")
+
+	imageSSMParameterPaths      = flag.String("image-ssm-parameter-paths", "", "Comma separated list of SSM parameter paths holding IDs of images that must never be cleaned up")
+	protectLaunchTemplateImages = flag.String("protect-launch-template-images", "", "Never clean up images used by launch templates (true/false)")
+
+	releaseTagKey                    = flag.String("release-tag", "", "Tag key of released resources, which are never marked for cleanup")
+	releaseImagesPrivateAfterDays    = flag.String("release-images-private-after-days", "", "Make release images private once older than X days, 0 means never")
+	releaseImagesDeregisterAfterDays = flag.String("release-images-deregister-after-days", "", "Clean up release images X days after they were made private, 0 means never")
+	releaseImagesCSPs                = flag.String("release-images-csps", "", "Comma separated list of CSPs (aws, gcp) the release image lifecycle applies to")
+
+	aggressivenessMultipliers = flag.String("aggressiveness-multipliers", "", "Comma separated list of <level>=<multiplier>, scaling the age and idle thresholds in accounts of employees with that aggressiveness")
+
+	retentionTagKey = flag.String("retention-tag-key", "", "Tag key holding the retention of images and snapshots, e.g. backup with values like retain-1y")
+
+	whitelistApprovers            = flag.String("whitelist-approvers", "", "Comma separated list of usernames allowed to approve whitelisting expensive resources")
+	whitelistApprovalCostPerMonth = flag.String("whitelist-approval-cost-per-month", "", "Estimated monthly cost in USD above which whitelisting a resource must be approved, 0 means never")
+
+	maxLifetimeDays      = flag.String("max-lifetime-days", "", "Mark resources older than X days even if whitelisted, unless they were whitelisted again within X days, 0 means never")
+	maxLifetimeGraceDays = flag.String("max-lifetime-grace-days", "", "Only report resources past their maximum lifetime for X days before marking them")
+	maxLifetimeAccounts  = flag.String("max-lifetime-accounts", "", "Comma separated list of accounts the maximum lifetime applies to, all accounts if empty")
+
+	cleanupDelegate               = flag.String("cleanup-delegate", "", "SSM Automation document (AWS) or workflow (GCP) that cleans up resources, instead of deleting them directly")
+	cleanupDelegateRegion         = flag.String("cleanup-delegate-region", "", "AWS region or GCP location the --cleanup-delegate is run in")
+	cleanupDelegateTimeoutMinutes = flag.String("cleanup-delegate-timeout-minutes", "", "Maximum time in minutes spent waiting for the --cleanup-delegate to finish")
+	snapshotCleanupConcurrency    = flag.String("snapshot-cleanup-concurrency", "", "Maximum number of snapshots deleted at the same time in each region")
+	markingConcurrency            = flag.String("marking-concurrency", "", "Maximum number of accounts resources are marked for cleanup in at the same time")
+	archiveVolumeDays             = flag.String("archive-volume-days", "", "Snapshot volumes before cleaning them up, and keep the snapshot for X days, 0 means never")
+
+	freezeWindowList = flag.String("freeze-windows", "", "Comma separated list of <start>/<end> dates (YYYY-MM-DD, both inclusive) during which nothing is marked or cleaned up")
 
 	awsBillingAccount      = flag.String("billing-account", "", "Specify AWS billing account id (e.g. 1234661312)")
 	awsBillingBucketRegion = flag.String("billing-bucket-region", "", "Specify AWS region where --billing-bucket is location")
 	gcpBillingCSVPrefix    = flag.String("billing-csv-prefix", "", "Specify name prefix of GCP billing CSV files")
 	billingBucket          = flag.String("billing-bucket", "", "Specify bucket with billing CSVs")
 	awsBillingSortTag      = flag.String("billing-sort-tag", "", "Specify a tag to sort on when creating report")
+	awsBillingSource       = flag.String("billing-source", "", "Specify where AWS costs are read from, either cur (the billing CSVs in --billing-bucket) or cost-explorer")
+	gcpBillingBQProject    = flag.String("billing-bigquery-project", "", "Specify GCP project of the BigQuery billing export, used instead of --billing-csv-prefix if set")
+	gcpBillingBQDataset    = flag.String("billing-bigquery-dataset", "", "Specify BigQuery dataset of the GCP billing export")
+	gcpBillingBQTable      = flag.String("billing-bigquery-table", "", "Specify BigQuery table of the GCP billing export")
+	costAmortizationDays   = flag.String("cost-amortization-days", "", "Maximum number of days counted in the estimated total cost of a resource, 0 for its whole life")
+
+	costAnomalyMinIncreasePercent = flag.String("cost-anomaly-min-increase-percent", "", "Minimum day-over-day increase in percent of the cost of an account for cost-anomalies to alert about it, 0 means any")
+	costAnomalyMinIncrease        = flag.String("cost-anomaly-min-increase", "", "Minimum day-over-day increase in USD of the cost of an account for cost-anomalies to alert about it, 0 means any")
 
 	mailUser     = flag.String("smtp-username", "", "SMTP username used to send email")
-	mailPassword = flag.String("smtp-password", "", "SMTP password used to send email")
+	mailPassword = flag.String("smtp-password", "", "SMTP password used to send email, or a reference to a secret in AWS Secrets Manager or GCP Secret Manager")
 	mailServer   = flag.String("smtp-server", "", "SMTP server used to send mail")
 	mailPort     = flag.String("smtp-port", "", "SMTP port used to send mail")
 
-	warningHours          = flag.String("warning-hours", "", "The number of hours in advance to warn about resource deletion")
+	warningHours          = flag.String("warning-hours", "", "Comma separated list of the number of hours in advance to remind about resource deletion, e.g. 168,48,4")
 	displayName           = flag.String("display-name", "", "Name displayed on emails sent by Cloudsweeper")
 	mailFrom              = flag.String("mail-from", "", "'From Email' displayed on emails sent by Cloudsweeper")
 	billingReportReceiver = flag.String("billing-report-addressee", "", "Receiver of month to date billing report")
 	summaryManager        = flag.String("total-sum-addressee", "", "Receiver of total cost sums")
+	whitelistReceiver     = flag.String("whitelist-report-addressee", "", "Receiver of the report of all whitelisted resources and their cost")
 	mailDomain            = flag.String("mail-domain", "", "The mail domain appended to usernames specified in the organization")
+	mailDedupeHours       = flag.String("mail-dedupe-hours", "", "Don't send identical mails to the same recipient within X hours (requires --state-file)")
+	mailMaxPerRecipient   = flag.String("mail-max-per-recipient", "", "Maximum number of mails sent to a single recipient within --mail-dedupe-hours, 0 means no limit")
+	automationPrincipals  = flag.String("automation-principals", "", "Comma separated list of principals (or tag key=value pairs) whose resources are reported to --automation-addressee")
+	automationAddressee   = flag.String("automation-addressee", "", "Receiver of warnings about resources created by --automation-principals")
+	reviewManagerRollup   = flag.String("review-manager-rollup", "", "How resources are listed in reviews sent to managers: full, counts, top or none")
+	reviewOrgRollup       = flag.String("review-org-rollup", "", "How resources are listed in the review sent to --total-sum-addressee: full, counts, top or none")
+	reviewRollupTopN      = flag.String("review-rollup-top-n", "", "Number of resources listed in reviews using the top rollup")
+	reviewRollupDepth     = flag.String("review-rollup-depth", "", "Number of manager levels the resources of an owner are rolled up to, e.g. 2 also sends them to skip-level managers")
+	creatorLookup         = flag.String("creator-lookup", "", "Report resources in shared accounts to their creator, looked up in CloudTrail")
+	mailSortBy            = flag.String("mail-sort-by", "", "How resources are ordered in mails: cost, or size to list the largest volumes, snapshots, images, buckets and tables first")
+
+	subjectReview              = flag.String("subject-review", "", "Subject template of old resource reviews sent to owners")
+	subjectManagerReview       = flag.String("subject-manager-review", "", "Subject template of old resource reviews sent to managers")
+	subjectOrgReview           = flag.String("subject-org-review", "", "Subject template of the old resource review sent to --total-sum-addressee")
+	subjectMergedReview        = flag.String("subject-merged-review", "", "Subject template of old resource reviews across several CSPs sent to owners")
+	subjectUntagged            = flag.String("subject-untagged", "", "Subject template of untagged resource reviews")
+	subjectDeletionWarning     = flag.String("subject-deletion-warning", "", "Subject template of deletion warnings")
+	subjectAutomationWarning   = flag.String("subject-automation-warning", "", "Subject template of deletion warnings sent to --automation-addressee")
+	subjectMonthToDate         = flag.String("subject-month-to-date", "", "Subject template of the month-to-date billing report")
+	subjectMarkingDryRun       = flag.String("subject-marking-dry-run", "", "Subject template of marking dry run reports")
+	subjectRetentionLapsed     = flag.String("subject-retention-lapsed", "", "Subject template of lapsed retention reports")
+	subjectAccountSummary      = flag.String("subject-account-summary", "", "Subject template of account summaries")
+	subjectStopWarning         = flag.String("subject-stop-warning", "", "Subject template of stop warnings")
+	subjectCredentialHygiene   = flag.String("subject-credential-hygiene", "", "Subject template of credential hygiene reports")
+	subjectWhitelistReport     = flag.String("subject-whitelist-report", "", "Subject template of the whitelist report sent to --whitelist-report-addressee")
+	subjectCostAnomaly         = flag.String("subject-cost-anomaly", "", "Subject template of cost anomaly alerts")
+	subjectOrphan              = flag.String("subject-orphan", "", "Subject template of reports of storage left behind by terminated instances")
+	subjectStackReport         = flag.String("subject-stack-report", "", "Subject template of reports of the old resources of IaC stacks")
+	subjectWhitelistExpiry     = flag.String("subject-whitelist-expiry", "", "Subject template of warnings about whitelistings that expire soon")
+	subjectWhitelistReapproval = flag.String("subject-whitelist-reapproval", "", "Subject template of reports of whitelisted resources to approve again")
+	subjectBadge               = flag.String("subject-badge", "", "Template prefixed to the subject of every mail, e.g. [CS][{{ lower .CSP }}][marked:{{ .Marked }}]")
+
+	directorySCIMURL   = flag.String("directory-scim-url", "", "URL of a SCIM API used to look up employee emails and managers")
+	directorySCIMToken = flag.String("directory-scim-token", "", "Bearer token used with --directory-scim-url, or a reference to a secret in AWS Secrets Manager or GCP Secret Manager")
 
 	setupARN = flag.String("aws-master-arn", "", "AWS ARN of role in account used by Cloudsweeper to assume roles")
 
-	findResourceID = flag.String("resource-id", "", "ID of resource to find with find-resource command")
+	findResourceID = flag.String("resource-id", "", "ID of resource to find with find-resource command, to look up with the tombstone command, to snooze with the snooze command, or to act on with the owner commands")
+	stackID        = flag.String("stack-id", "", "ID of the stack, in the cloudsweeper-managed-by tag of its resources, to mark with the mark-stack command")
+	snoozeDays     = flag.Int("days", 0, "Number of days to snooze a resource with the snooze command, or to postpone its cleanup with the owner extend command")
+
+	policyA = flag.String("policy-a", "", "File with the current thresholds, compared by the policy-diff command")
+	policyB = flag.String("policy-b", "", "File with the proposed thresholds, compared by the policy-diff command")
+
+	doctorAddressee = flag.String("doctor-addressee", "", "Receiver of the test mail sent by the doctor command, --total-sum-addressee is used if empty")
+
+	reconcileManagementAccount = flag.String("reconcile-management-account", "", "AWS account the organization is listed from by the reconcile-org command, the current credentials are used if empty")
+	reconcileOwnerTag          = flag.String("reconcile-owner-tag", "", "Tag (AWS) or label (GCP) of accounts holding the username of their owner, used by the reconcile-org command")
+	reconcileDefaultOwner      = flag.String("reconcile-default-owner", "", "Employee suggested as the owner of accounts without an owner tag by the reconcile-org command")
+	reconcilePatchFile         = flag.String("reconcile-patch-file", "", "File the reconcile-org command writes a JSON Patch of the organization file to")
+
+	whitelistFile = flag.String("whitelist-file", "", "YAML file whitelisted resources are written to by the whitelist export command, and read from by the whitelist apply command")
+
+	planMode                = flag.String("plan-mode", "", "Command to plan with the plan command: mark-for-cleanup, cleanup, review, warn, find-untagged or retention-report")
+	planMaxMarked           = flag.String("plan-max-marked", "", "Fail the plan command if more than X resources would be marked, 0 means no limit")
+	planMaxMarkedPerAccount = flag.String("plan-max-marked-per-account", "", "Fail the plan command if more than X resources would be marked in an account, 0 means no limit")
+	planMaxCleanedUp        = flag.String("plan-max-cleaned-up", "", "Fail the plan command if more than X resources would be cleaned up today, 0 means no limit")
+	planMaxMails            = flag.String("plan-max-mails", "", "Fail the plan command if more than X mails would be sent, 0 means no limit")
+
+	backfillTagKeys = flag.String("backfill-tag-keys", "", "Comma separated list of tags the backfill-tags command suggests for untagged resources")
+	backfillApply   = flag.Bool("apply", false, "Set the tags suggested by the backfill-tags command, marked with the tag cloudsweeper-suggested=true")
+
+	hygieneRepair = flag.Bool("repair", false, "Resolve the tag conflicts found by the tag-hygiene command")
+
+	dashboardBucket       = flag.String("dashboard-bucket", "", "S3 bucket the dashboard command uploads the dashboards to, instead of writing them to --dashboard-dir")
+	dashboardBucketRegion = flag.String("dashboard-bucket-region", "", "AWS region of --dashboard-bucket")
+	dashboardDir          = flag.String("dashboard-dir", "", "Directory the dashboard command writes the dashboards to")
+	dashboardURL          = flag.String("dashboard-url", "", "URL where the dashboards are served, used to link to them from the reviews")
+
+	holdNotifications    = flag.String("hold-notifications", "", "Hold all mails in a queue for review instead of sending them, they are sent with the notifications release command (true/false)")
+	heldMailDir          = flag.String("held-mail-dir", "", "Directory mails are held in with --hold-notifications")
+	heldMailBucket       = flag.String("held-mail-bucket", "", "S3 bucket mails are held in with --hold-notifications, instead of --held-mail-dir")
+	heldMailBucketRegion = flag.String("held-mail-bucket-region", "", "AWS region of --held-mail-bucket")
+
+	outputFormat = flag.String("output-format", "", "Write reviews, dry runs, billing reports and other reports in a machine-readable format: json, csv or html")
+	outputFile   = flag.String("output-file", "", "File reports are written to with --output-format, - for stdout")
+	outputOnly   = flag.String("output-only", "", "Only write reports with --output-format, instead of also sending them as mails (true/false)")
+
+	serveAddress        = flag.String("serve-address", "", "Address the serve command listens on (e.g. :8080)")
+	serveRefreshMinutes = flag.String("serve-refresh-minutes", "", "How often, in minutes, the serve command refreshes its resource inventory")
+
+	metricsPushgatewayURL = flag.String("metrics-pushgateway-url", "", "URL of a Prometheus Pushgateway the metrics are pushed to when a command finishes")
+	metricsPushgatewayJob = flag.String("metrics-pushgateway-job", "", "Job the metrics are pushed to the Pushgateway as")
 
 	dryRun = flag.Bool("marking-dry-run", false, "Whether to perform a dry run for mark and delete (nothing will actually be marked)")
 
+	resetDryRun  = flag.Bool("reset-dry-run", false, "List all cleanup tags that would be removed by reset, without removing them")
+	confirmReset = flag.Bool("confirm-reset", false, "Must be set to actually remove all cleanup tags with the reset command")
+
+	// Hidden flags, these are not listed in the usage
+	hiddenFlags = map[string]bool{"fake-now": true}
+	fakeNow     = flag.String("fake-now", "", "Freeze the clock used for age and expiry checks at this time (RFC3339 or YYYY-MM-DD)")
+
 	// Thresholds
 	thresholds = make(map[string]int)
 	thnames    = []string{
@@ -67,6 +249,22 @@ var (
 		"clean-bucket-not-modified-days",
 		"clean-bucket-older-than-days",
 		"clean-keep-n-component-images",
+		"clean-max-marked-per-account",
+		"clean-tables-idle-days",
+		"clean-cache-clusters-idle-days",
+		"clean-unused-addresses-older-than-days",
+		"clean-network-gateways-idle-days",
+		"clean-unused-capacity-reservations-older-than-days",
+		"clean-db-instances-idle-days",
+		"clean-db-snapshots-older-than-days",
+		"clean-keep-n-family-images",
+		"clean-image-copies-older-than-days",
+		"clean-stop-instances",
+		"clean-databases",
+		"clean-volumes-min-size-gb",
+		"clean-snapshots-min-size-gb",
+		"clean-images-min-size-gb",
+		"clean-buckets-min-size-gb",
 		"notify-untagged-older-than-days",
 		"notify-instances-older-than-days",
 		"notify-images-older-than-days",
@@ -74,28 +272,74 @@ var (
 		"notify-snapshots-older-than-days",
 		"notify-buckets-older-than-days",
 		"notify-whitelist-older-than-days",
+		"notify-whitelist-expiry-days",
+		"notify-whitelist-reapproval-days",
 		"notify-dnd-older-than-days",
+		"notify-tables-idle-days",
+		"notify-cache-clusters-idle-days",
+		"notify-unused-addresses-older-than-days",
+		"notify-network-gateways-idle-days",
+		"notify-capacities-older-than-days",
+		"notify-db-instances-idle-days",
+		"notify-db-snapshots-older-than-days",
+		"notify-in-use-storage-older-than-days",
+		"notify-public-instances-idle-days",
+		"notify-access-keys-older-than-days",
+		"notify-access-keys-unused-days",
+		"notify-min-resources-per-email",
 	}
 
 	// Clean thresholds
-	cleanUntaggedOlderThanDays    = flag.String("clean-untagged-older-than-days", "", "Clean untagged resources if older than X days (default: 30)")
-	cleanInstancesOlderThanDays   = flag.String("clean-instances-older-than-days", "", "Clean if instance is older than X days (default: 182)")
-	cleanImagesOlderThanDays      = flag.String("clean-images-older-than-days", "", "Clean if image is older than X days (default: 182)")
-	cleanSnapshotsOlderThanDays   = flag.String("clean-snapshots-older-than-days", "", "Clean if snapshot is older than X days (default: 182)")
-	cleanUnattatchedOlderThanDays = flag.String("clean-unattatched-older-than-days", "", "Clean unattached volumes older than X days (default: 30)")
-	cleanBucketNotModifiedDays    = flag.String("clean-bucket-not-modified-days", "", "Clean s3 bucket if not modified for more than X days (default: 182)")
-	cleanBucketOlderThanDays      = flag.String("clean-bucket-older-than-days", "", "Clean s3 bucket if older than X days (default: 7)")
-	cleanKeepNComponentImages     = flag.String("clean-keep-n-component-images", "", "Clean images with component-date naming that are older than the N most recent ones (default: 2)")
+	cleanUntaggedOlderThanDays                   = flag.String("clean-untagged-older-than-days", "", "Clean untagged resources if older than X days (default: 30)")
+	cleanInstancesOlderThanDays                  = flag.String("clean-instances-older-than-days", "", "Clean if instance is older than X days (default: 182)")
+	cleanImagesOlderThanDays                     = flag.String("clean-images-older-than-days", "", "Clean if image is older than X days (default: 182)")
+	cleanSnapshotsOlderThanDays                  = flag.String("clean-snapshots-older-than-days", "", "Clean if snapshot is older than X days (default: 182)")
+	cleanUnattatchedOlderThanDays                = flag.String("clean-unattatched-older-than-days", "", "Clean unattached volumes older than X days (default: 30)")
+	cleanBucketNotModifiedDays                   = flag.String("clean-bucket-not-modified-days", "", "Clean s3 bucket if not modified for more than X days (default: 182)")
+	cleanBucketOlderThanDays                     = flag.String("clean-bucket-older-than-days", "", "Clean s3 bucket if older than X days (default: 7)")
+	cleanKeepNComponentImages                    = flag.String("clean-keep-n-component-images", "", "Clean images with component-date naming that are older than the N most recent ones (default: 2)")
+	cleanMaxMarkedPerAccount                     = flag.String("clean-max-marked-per-account", "", "Only mark the X most expensive resources per account in a single run, 0 means no limit (default: 0)")
+	cleanTablesIdleDays                          = flag.String("clean-tables-idle-days", "", "Clean tables not used for X days, 0 means tables are never cleaned (default: 0)")
+	cleanCacheClustersIdleDays                   = flag.String("clean-cache-clusters-idle-days", "", "Clean cache clusters not used for X days, 0 means cache clusters are never cleaned (default: 0)")
+	cleanUnusedAddressesOlderThanDays            = flag.String("clean-unused-addresses-older-than-days", "", "Clean reserved addresses, such as Elastic IPs, not in use if older than X days, 0 means addresses are never cleaned (default: 0)")
+	cleanNetworkGatewaysIdleDays                 = flag.String("clean-network-gateways-idle-days", "", "Clean AWS NAT gateways and interface VPC endpoints without traffic for X days, 0 means they are never cleaned (default: 0)")
+	cleanUnusedCapacityReservationsOlderThanDays = flag.String("clean-unused-capacity-reservations-older-than-days", "", "Clean AWS capacity reservations without running instances if older than X days, 0 means they are never cleaned (default: 0)")
+	cleanDBInstancesIdleDays                     = flag.String("clean-db-instances-idle-days", "", "Clean AWS RDS instances no client has connected to for X days, after taking a final snapshot, 0 means they are never cleaned (default: 0)")
+	cleanDBSnapshotsOlderThanDays                = flag.String("clean-db-snapshots-older-than-days", "", "Clean manual AWS RDS snapshots older than X days, 0 means they are never cleaned (default: 0)")
+	cleanKeepNFamilyImages                       = flag.String("clean-keep-n-family-images", "", "Clean images in an image family that are older than the N most recent ones, 0 means family images are never cleaned (default: 0)")
+	cleanImageCopiesOlderThanDays                = flag.String("clean-image-copies-older-than-days", "", "Clean images copied from another region if older than X days, 0 means copies are cleaned like other images (default: 0)")
+	cleanStopInstances                           = flag.String("clean-stop-instances", "", "Mark instances to be stopped instead of deleted if 1 (default: 0)")
+	cleanDatabases                               = flag.String("clean-databases", "", "Mark instances detected as databases, see database-patterns, for cleanup like other instances if 1 (default: 0)")
+	cleanVolumesMinSizeGB                        = flag.String("clean-volumes-min-size-gb", "", "Only clean volumes larger than X GB, 0 means no minimum (default: 0)")
+	cleanSnapshotsMinSizeGB                      = flag.String("clean-snapshots-min-size-gb", "", "Only clean snapshots larger than X GB, 0 means no minimum (default: 0)")
+	cleanImagesMinSizeGB                         = flag.String("clean-images-min-size-gb", "", "Only clean images larger than X GB, 0 means no minimum (default: 0)")
+	cleanBucketsMinSizeGB                        = flag.String("clean-buckets-min-size-gb", "", "Only clean buckets larger than X GB, 0 means no minimum (default: 0)")
 
 	//  Notify thresholds
-	notifyUntaggedOlderThanDays  = flag.String("notify-untagged-older-than-days", "", "Notify if untagged resource is older than X days (default: 14)")
-	notifyInstancesOlderThanDays = flag.String("notify-instances-older-than-days", "", "Notify if instances is older than X days (default: 30)")
-	notifyImagesOlderThanDays    = flag.String("notify-images-older-than-days", "", "Notify if image is older than X days (default: 30)")
-	notifyVolumesOlderThanDays   = flag.String("notify-unattached-older-than-days", "", "Notify if volume is older than X days (default: 30)")
-	notifySnapshotsOlderThanDays = flag.String("notify-snapshots-older-than-days", "", "Notify if snapshot is older than X days (default: 30)")
-	notifyBucketsOlderThanDays   = flag.String("notify-buckets-older-than-days", "", "Notify if bucket is older than X days (default: 30)")
-	notifyWhitelistOlderThanDays = flag.String("notify-whitelist-older-than-days", "", "Notify if whitelisted is older than X days (default: 182)")
-	notifyDndOlderThanDays       = flag.String("notify-dnd-older-than-days", "", "Do not delete older than X days (default: 7)")
+	notifyUntaggedOlderThanDays        = flag.String("notify-untagged-older-than-days", "", "Notify if untagged resource is older than X days (default: 14)")
+	notifyInstancesOlderThanDays       = flag.String("notify-instances-older-than-days", "", "Notify if instances is older than X days (default: 30)")
+	notifyImagesOlderThanDays          = flag.String("notify-images-older-than-days", "", "Notify if image is older than X days (default: 30)")
+	notifyVolumesOlderThanDays         = flag.String("notify-unattached-older-than-days", "", "Notify if volume is older than X days (default: 30)")
+	notifySnapshotsOlderThanDays       = flag.String("notify-snapshots-older-than-days", "", "Notify if snapshot is older than X days (default: 30)")
+	notifyBucketsOlderThanDays         = flag.String("notify-buckets-older-than-days", "", "Notify if bucket is older than X days (default: 30)")
+	notifyWhitelistOlderThanDays       = flag.String("notify-whitelist-older-than-days", "", "Notify if whitelisted is older than X days (default: 182)")
+	notifyWhitelistExpiryDays          = flag.String("notify-whitelist-expiry-days", "", "Warn owners about whitelistings expiring within X days (default: 14)")
+	notifyWhitelistReapprovalDays      = flag.String("notify-whitelist-reapproval-days", "", "Report resources whitelisted more than X days ago to managers for re-approval (default: 365)")
+	notifyDndOlderThanDays             = flag.String("notify-dnd-older-than-days", "", "Do not delete older than X days (default: 7)")
+	notifyTablesIdleDays               = flag.String("notify-tables-idle-days", "", "Notify if table has not been used for X days (default: 30)")
+	notifyCacheClustersIdleDays        = flag.String("notify-cache-clusters-idle-days", "", "Notify if cache cluster has not been used for X days (default: 30)")
+	notifyUnusedAddressesOlderThanDays = flag.String("notify-unused-addresses-older-than-days", "", "Notify if reserved address, such as an Elastic IP, is not in use and older than X days (default: 7)")
+	notifyNetworkGatewaysIdleDays      = flag.String("notify-network-gateways-idle-days", "", "Notify if NAT gateway or VPC endpoint has had no traffic for X days (default: 30)")
+	notifyCapacitiesOlderThanDays      = flag.String("notify-capacities-older-than-days", "", "Notify if AWS dedicated host or capacity reservation is older than X days (default: 7)")
+	notifyDBInstancesIdleDays          = flag.String("notify-db-instances-idle-days", "", "Notify if AWS RDS instance has had no connections for X days, stopped instances are always listed (default: 14)")
+	notifyDBSnapshotsOlderThanDays     = flag.String("notify-db-snapshots-older-than-days", "", "Notify if manual AWS RDS snapshot is older than X days (default: 30)")
+	notifyInUseStorageOlderThanDays    = flag.String("notify-in-use-storage-older-than-days", "", "List attached volumes and snapshots used by images older than X days in reviews, for information only, 0 means never (default: 0)")
+	notifyPublicInstancesIdleDays      = flag.String("notify-public-instances-idle-days", "", "Notify if AWS instance with a public IPv4 address has had no inbound traffic for X days, 0 means never (default: 14)")
+	notifyAccessKeysOlderThanDays      = flag.String("notify-access-keys-older-than-days", "", "Notify if GCP service account key is older than X days, 0 means never (default: 90)")
+	notifyAccessKeysUnusedDays         = flag.String("notify-access-keys-unused-days", "", "Notify if GCP service account key has not been used for X days, 0 means never (default: 90)")
+	notifyMinResourcesPerEmail         = flag.String("notify-min-resources-per-email", "", "Only send reviews to owners with at least X resources, others are only included in manager and org reviews (default: 1)")
+	notifyMinResourcesPerType          = flag.String("notify-min-resources-per-type", "", "Comma separated list of <type>=<count>, e.g. snapshot=3, resources of a type are only included in reviews sent to owners with at least count of them")
+	notifyRunbookDir                   = flag.String("notify-runbook-dir", "", "Directory of remediation guidance shown in reviews and warnings, with one <type>.html or <type>.md file per resource type, and general for all mails")
 )
 
 const banner = `
@@ -108,30 +352,95 @@ const banner = `
 `
 
 func main() {
-	fmt.Println(banner)
+	fmt.Fprint(os.Stderr, banner)
 	loadConfig()
+	flag.Usage = usage
 	flag.Parse()
+	loadSecretRedaction()
+	loadNetwork()
 	loadThresholds()
-	csp := cspFromConfig(findConfig("csp"))
-	log.Printf("Running against %s...\n", csp)
-	switch getPositionalCmd() {
+	loadOrdering()
+	loadRoleChain()
+	loadGCPBucketListing()
+	loadBucketRegionCache()
+	loadAddressFirstSeen()
+	loadTombstones()
+	loadSystemTagPrefixes()
+	loadIgnorePatterns()
+	loadDatabasePatterns()
+	loadPolicyFile()
+	loadImageReferences()
+	loadRetention()
+	loadWhitelistApproval()
+	loadMaxLifetime()
+	loadCostAmortization()
+	loadFakeNow()
+	loadFreezeWindows()
+	csps := cspsFromConfig(findConfig("csp"))
+	csp := csps[0]
+	loadReleaseImages(csp)
+	ctx, stop := runContext()
+	cleanup.RunID = fmt.Sprintf("%s-%s", cspRunName(csps), clock.Now().UTC().Format("20060102T150405Z"))
+	loadAudit(csp)
+	log.Printf("Running %s against %s with policy %s...\n", cleanup.RunID, findConfig("csp"), notify.PolicyHash(thresholds))
+	exitCode := exitOK
+	cmd := getPositionalCmd()
+	if flag.NArg() == 2 && (flag.Arg(0) == "notifications" || flag.Arg(0) == "whitelist" || flag.Arg(0) == "owner") {
+		cmd = flag.Arg(0) + " " + cmd
+	}
+	if len(csps) > 1 && cmd != "review" {
+		configFatalf("Only review can run against several CSPs, run %s against one --csp at a time", cmd)
+	}
+	switch cmd {
 	case "cleanup":
+		if window, frozen := activeFreezeWindow(); frozen {
+			log.Printf("Not cleaning up any resources during the freeze window %s\n", window)
+			exitCode = exitNothingToDo
+			break
+		}
 		log.Println("Cleaning up old resources")
 		org := parseOrganization(findConfig("org-file"))
-		mngr := initManager(csp, org)
-		cleanup.PerformCleanup(mngr)
+		mngr := initCleanupDelegate(csp, initManager(csp, org))
+		cloud.SnapshotCleanupConcurrency = findConfigInt("snapshot-cleanup-concurrency")
+		cleanup.ArchiveVolumeDays = findConfigInt("archive-volume-days")
+		if cleanup.ArchiveVolumeDays < 0 {
+			configFatalf("The archive-volume-days must not be negative")
+		}
+		exitCode = cleanupExitCode(cleanup.PerformCleanup(ctx, mngr))
 	case "reset":
-		log.Println("Resetting all tags")
+		if !*resetDryRun && !*confirmReset {
+			configFatalf("Resetting removes all cleanup tags, run with --reset-dry-run to list them or --confirm-reset to remove them (CONFIRM=true with make)")
+		}
+		if *resetDryRun {
+			log.Println("Listing all tags that would be reset")
+		} else {
+			log.Println("Resetting all tags")
+		}
 		org := parseOrganization(findConfig("org-file"))
 		mngr := initManager(csp, org)
-		cleanup.ResetCloudsweeper(mngr)
+		cleanup.ResetCloudsweeper(ctx, mngr, *resetDryRun)
+	case "scan":
+		if findConfig("resource-cache-file") == "" {
+			configFatalf("Scanning requires a resource cache, set CS_RESOURCE_CACHE_FILE")
+		}
+		log.Println("Scanning all resources into the resource cache")
+		org := parseOrganization(findConfig("org-file"))
+		initCachedManager(ctx, csp, org, 0)
 	case "mark-for-cleanup":
+		if window, frozen := activeFreezeWindow(); frozen {
+			log.Printf("Not marking any resources during the freeze window %s\n", window)
+			exitCode = exitNothingToDo
+			break
+		}
 		log.Println("Marking old resources for cleanup")
 		org := parseOrganization(findConfig("org-file"))
-		mngr := initManager(csp, org)
-		taggedResources := cleanup.MarkForCleanup(mngr, thresholds, *dryRun)
+		loadAggressiveness(csp, org)
+		mngr := initCachedManager(ctx, csp, org, resourceCacheTTL())
+		cleanup.MarkingConcurrency = findConfigInt("marking-concurrency")
+		taggedResources, report := cleanup.MarkForCleanup(ctx, mngr, thresholds, *dryRun)
+		exitCode = markingExitCode(report, cleanup.CountResources(taggedResources))
 		if *dryRun {
-			client := initNotifyClient()
+			client := initNotifyClient(org)
 			client.MarkingDryRunReport(taggedResources, org.AccountToUserMapping(csp))
 		} else {
 			log.Println("Not sending marking report since this was not a dry run")
@@ -139,50 +448,129 @@ func main() {
 	case "review":
 		log.Println("Sending out old resource review")
 		org := parseOrganization(findConfig("org-file"))
-		mngr := initManager(csp, org)
-		client := initNotifyClient()
-		client.OldResourceReview(mngr, org, csp, thresholds)
+		managers := make(map[cloud.CSP]cloud.ResourceManager)
+		for _, csp := range csps {
+			managers[csp] = initCachedManager(ctx, csp, org, resourceCacheTTL())
+		}
+		client := initNotifyClient(org)
+		client.OldResourceReview(ctx, managers, org, thresholds)
 	case "warn":
 		log.Println("Sending out cleanup warning")
 		org := parseOrganization(findConfig("org-file"))
-		mngr := initManager(csp, org)
-		client := initNotifyClient()
-		client.DeletionWarning(findConfigInt("warning-hours"), mngr, org.AccountToUserMapping(csp))
+		mngr := initCachedManager(ctx, csp, org, resourceCacheTTL())
+		client := initNotifyClient(org)
+		client.DeletionWarning(ctx, findReminders("warning-hours"), mngr, org.AccountToUserMapping(csp))
+		client.StopWarning(ctx, findReminders("warning-hours"), mngr, org.AccountToUserMapping(csp))
 	case "billing-report":
 		log.Println("Generating month-to-date billing report for", csp)
-		var reporter billing.Reporter
-		if csp == cloud.AWS {
-			billingAccount := findConfig("billing-account")
-			bucket := findConfig("billing-bucket")
-			region := findConfig("billing-bucket-region")
-			sortTag := findConfig("billing-sort-tag")
-			reporter = billing.NewReporterAWS(billingAccount, bucket, region, sortTag)
-		} else if csp == cloud.GCP {
-			bucket := findConfig("billing-bucket")
-			prefix := findConfig("billing-csv-prefix")
-			reporter = billing.NewReporterGCP(bucket, prefix)
-		} else {
-			log.Fatalf("Invalid CSP specified")
-			return
-		}
+		reporter := initReporter(csp, findConfig("billing-sort-tag"))
 		report := billing.GenerateReport(reporter)
 		org := parseOrganization(findConfig("org-file"))
 		mapping := org.AccountToUserMapping(csp)
 		sortTagKey := findConfig("billing-sort-tag")
 		log.Println(report.FormatReport(mapping, sortTagKey != ""))
-		client := initNotifyClient()
-		client.MonthToDateReport(report, mapping, sortTagKey != "")
+		client := initNotifyClient(org)
+		client.MonthToDateReport(report, org, sortTagKey != "")
+	case "cost-anomalies":
+		log.Println("Detecting day-over-day cost anomalies for", csp)
+		reporter := initReporter(csp, "")
+		anomalies := billing.DetectCostAnomalies(reporter, findConfigFloat("cost-anomaly-min-increase-percent"), findConfigFloat("cost-anomaly-min-increase"))
+		if len(anomalies) == 0 {
+			log.Println("No cost anomalies detected")
+			exitCode = exitNothingToDo
+			break
+		}
+		for _, anomaly := range anomalies {
+			log.Printf("%s: Cost on %s increased from $%.2f to $%.2f\n", cloud.AccountName(anomaly.Owner), anomaly.Day, anomaly.PreviousCost, anomaly.Cost)
+		}
+		org := parseOrganization(findConfig("org-file"))
+		client := initNotifyClient(org)
+		client.CostAnomalyAlert(anomalies, csp, org.AccountToUserMapping(csp))
 	case "find-untagged":
 		log.Println("Finding untagged resources")
 		org := parseOrganization(findConfig("org-file"))
 		mngr := initManager(csp, org)
 		mapping := org.AccountToUserMapping(csp)
-		client := initNotifyClient()
-		client.UntaggedResourcesReview(mngr, mapping)
+		client := initNotifyClient(org)
+		client.UntaggedResourcesReview(ctx, mngr, mapping)
+	case "retention-report":
+		log.Println("Finding backups with lapsed retention")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		mapping := org.AccountToUserMapping(csp)
+		client := initNotifyClient(org)
+		client.RetentionLapsedReport(ctx, mngr, mapping)
+	case "orphan-report":
+		log.Println("Finding storage left behind by terminated instances")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		client := initNotifyClient(org)
+		client.OrphanReport(ctx, mngr, org.AccountToUserMapping(csp))
+	case "stack-report":
+		log.Println("Reporting old resources managed by stacks")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initCachedManager(ctx, csp, org, resourceCacheTTL())
+		stacks, reasons := cleanup.PlanStacks(ctx, mngr, thresholds)
+		if len(stacks) == 0 {
+			log.Println("No stacks with old resources")
+			exitCode = exitNothingToDo
+		}
+		client := initNotifyClient(org)
+		client.StackReport(csp, stacks, reasons, org.AccountToUserMapping(csp))
+	case "mark-stack":
+		if *stackID == "" {
+			configFatalf("Must specify a stack to mark, using --stack-id=<ID>")
+		}
+		if window, frozen := activeFreezeWindow(); frozen {
+			log.Printf("Not marking any resources during the freeze window %s\n", window)
+			exitCode = exitNothingToDo
+			break
+		}
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		resources, failed, err := cleanup.MarkStack(ctx, mngr, *stackID, *dryRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *dryRun {
+			log.Printf("Would mark the %d resources of the stack %s, since this is a dry run\n", len(resources), *stackID)
+		} else if failed > 0 {
+			log.Printf("Failed to mark %d of the %d resources of the stack %s\n", failed, len(resources), *stackID)
+			exitCode = exitPartialFailure
+		} else {
+			log.Printf("Marked the %d resources of the stack %s\n", len(resources), *stackID)
+		}
+	case "credential-hygiene":
+		log.Println("Finding stale access keys")
+		org := parseOrganization(findConfig("org-file"))
+		keys, err := cloud.AccessKeysPerAccount(ctx, csp, org.EnabledAccounts(csp))
+		if err != nil && !recordAccountErrors(err) {
+			log.Fatal(err)
+		}
+		client := initNotifyClient(org)
+		client.CredentialHygieneReport(csp, keys, org.AccountToUserMapping(csp), thresholds["notify-access-keys-older-than-days"], thresholds["notify-access-keys-unused-days"])
+	case "whitelist-report":
+		log.Println("Reporting the cost of whitelisted resources")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		client := initNotifyClient(org)
+		client.WhitelistReport(ctx, mngr, csp, org.AccountToUserMapping(csp))
+	case "whitelist-expiry-warning":
+		log.Println("Warning about expiring whitelistings")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		client := initNotifyClient(org)
+		client.WhitelistExpiryWarning(ctx, mngr, csp, thresholds["notify-whitelist-expiry-days"], org.AccountToUserMapping(csp))
+	case "whitelist-reapproval-report":
+		log.Println("Reporting whitelisted resources to approve again")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		client := initNotifyClient(org)
+		client.WhitelistReapprovalReport(ctx, mngr, org, csp, thresholds["notify-whitelist-reapproval-days"])
 	case "find-resource":
 		id := *findResourceID
 		if id == "" {
-			log.Fatalln("Must specify a resource ID to find, using --resource-id=<ID>")
+			configFatalf("Must specify a resource ID to find, using --resource-id=<ID>")
 		}
 		log.Printf("Finding resource with ID %s", id)
 		org := parseOrganization(findConfig("org-file"))
@@ -191,28 +579,455 @@ func main() {
 		if err != nil {
 			log.Fatalf("Could not initalize find client: %s", err)
 		}
-		err = client.FindResource(id)
+		err = client.FindResource(ctx, id)
 		if err != nil {
+			// The resource might have been cleaned up
+			log.Printf("%s, looking for a tombstone", err)
+			if err := find.FindTombstone(id); err != nil {
+				log.Fatal(err)
+			}
+		}
+	case "tombstone":
+		id := *findResourceID
+		if id == "" {
+			configFatalf("Must specify a resource ID to look up, using --resource-id=<ID>")
+		}
+		if err := find.FindTombstone(id); err != nil {
 			log.Fatal(err)
 		}
+	case "snooze":
+		id := *findResourceID
+		if id == "" || *snoozeDays <= 0 {
+			configFatalf("Must specify a resource ID and days to snooze, using --resource-id=<ID> --days=<days>")
+		}
+		log.Printf("Snoozing resource with ID %s for %d days", id, *snoozeDays)
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		if err := cleanup.SnoozeResource(ctx, mngr, id, *snoozeDays); err != nil {
+			log.Fatal(err)
+		}
+	case "backfill-tags":
+		log.Println("Suggesting tags for untagged resources")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		keys := findConfigList("backfill-tag-keys")
+		suggestions := cleanup.SuggestTags(ctx, mngr, billingResourceTags(csp, keys), keys)
+		fmt.Print(cleanup.FormatTagSuggestions(suggestions))
+		if len(suggestions) == 0 {
+			exitCode = exitNothingToDo
+		} else if !*backfillApply {
+			log.Println("Not setting the suggested tags, run with --apply to set them")
+		} else if failed := cleanup.ApplyTagSuggestions(suggestions); failed > 0 {
+			log.Printf("Failed to tag %d of %d resources\n", failed, len(suggestions))
+			exitCode = exitPartialFailure
+		}
+	case "tag-hygiene":
+		log.Println("Looking for conflicting or duplicate Cloudsweeper tags")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		conflicts := cleanup.FindTagConflicts(ctx, mngr)
+		fmt.Print(cleanup.FormatTagConflicts(conflicts))
+		if len(conflicts) == 0 {
+			exitCode = exitNothingToDo
+		} else if !*hygieneRepair {
+			log.Println("Not repairing the tag conflicts, run with --repair to repair them")
+		} else if failed := cleanup.RepairTagConflicts(conflicts); failed > 0 {
+			log.Printf("Failed to repair %d of %d tag conflicts\n", failed, len(conflicts))
+			exitCode = exitPartialFailure
+		}
+	case "dashboard":
+		log.Println("Generating dashboards")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		pages, err := dashboard.Generate(ctx, mngr, org, csp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if bucket := findConfig("dashboard-bucket"); bucket != "" {
+			err = dashboard.Upload(pages, bucket, findConfig("dashboard-bucket-region"))
+		} else {
+			err = dashboard.WriteDir(pages, findConfig("dashboard-dir"))
+		}
+		if err != nil {
+			log.Fatalf("Could not publish dashboards: %s\n", err)
+		}
+	case "policy-diff":
+		if *policyA == "" || *policyB == "" {
+			configFatalf("Must specify the policies to compare, using --policy-a=<file> and --policy-b=<file>")
+		}
+		log.Printf("Comparing marking policy %s with %s\n", *policyA, *policyB)
+		org := parseOrganization(findConfig("org-file"))
+		loadAggressiveness(csp, org)
+		mngr := cloud.NewCachedManager(initManager(csp, org))
+		diffs := cleanup.DiffPolicies(ctx, mngr, loadPolicy(*policyA), loadPolicy(*policyB))
+		fmt.Print(cleanup.FormatPolicyDiffs(diffs))
+	case "whitelist export":
+		if *whitelistFile == "" {
+			configFatalf("Must specify the file to export the whitelist to, using --whitelist-file=<file>")
+		}
+		log.Printf("Exporting whitelisted resources to %s\n", *whitelistFile)
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		entries := cleanup.ExportWhitelist(ctx, mngr, org.AccountToUserMapping(csp))
+		if err := cleanup.WriteWhitelist(*whitelistFile, entries); err != nil {
+			log.Fatalf("Could not write whitelist: %s\n", err)
+		}
+		log.Printf("Exported %d whitelisted resources\n", len(entries))
+		if len(entries) == 0 {
+			exitCode = exitNothingToDo
+		}
+	case "whitelist apply":
+		if *whitelistFile == "" {
+			configFatalf("Must specify the file to apply, using --whitelist-file=<file>")
+		}
+		entries, err := cleanup.ReadWhitelist(*whitelistFile)
+		if err != nil {
+			configFatalf("%s", err)
+		}
+		log.Printf("Whitelisting %d resources from %s\n", len(entries), *whitelistFile)
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		if len(entries) == 0 {
+			exitCode = exitNothingToDo
+		} else if failed := cleanup.ApplyWhitelist(ctx, mngr, entries); failed > 0 {
+			log.Printf("Failed to whitelist %d of %d resources\n", failed, len(entries))
+			exitCode = exitPartialFailure
+		}
+	case "owner list":
+		org := parseOrganization(findConfig("org-file"))
+		_, mngr := initOwnerManager(csp, org)
+		resources := cleanup.FlaggedResources(ctx, mngr)
+		fmt.Print(cleanup.FormatFlaggedResources(resources))
+		if len(resources) == 0 {
+			exitCode = exitNothingToDo
+		}
+	case "owner whitelist":
+		id := *findResourceID
+		if id == "" {
+			configFatalf("Must specify a resource ID to whitelist, using --resource-id=<ID>")
+		}
+		org := parseOrganization(findConfig("org-file"))
+		employee, mngr := initOwnerManager(csp, org)
+		if err := cleanup.WhitelistResource(ctx, mngr, id, employee.Username); err != nil {
+			log.Fatal(err)
+		}
+	case "owner extend":
+		id := *findResourceID
+		if id == "" || *snoozeDays <= 0 {
+			configFatalf("Must specify a resource ID and days to extend, using --resource-id=<ID> --days=<days>")
+		}
+		org := parseOrganization(findConfig("org-file"))
+		_, mngr := initOwnerManager(csp, org)
+		if err := cleanup.ExtendResource(ctx, mngr, id, *snoozeDays); err != nil {
+			log.Fatal(err)
+		}
+	case "owner delete-now":
+		id := *findResourceID
+		if id == "" {
+			configFatalf("Must specify a resource ID to delete, using --resource-id=<ID>")
+		}
+		if window, frozen := activeFreezeWindow(); frozen {
+			log.Printf("Not deleting %s during the freeze window %s\n", id, window)
+			exitCode = exitNothingToDo
+			break
+		}
+		org := parseOrganization(findConfig("org-file"))
+		_, mngr := initOwnerManager(csp, org)
+		mngr = initCleanupDelegate(csp, mngr)
+		if err := cleanup.DeleteResourceNow(ctx, mngr, id); err != nil {
+			log.Fatal(err)
+		}
+	case "owner include-orphans":
+		org := parseOrganization(findConfig("org-file"))
+		_, mngr := initOwnerManager(csp, org)
+		included, failed := cleanup.IncludeOrphans(ctx, mngr)
+		log.Printf("Included %d orphans in the next marking run\n", included)
+		if included+failed == 0 {
+			exitCode = exitNothingToDo
+		} else if failed > 0 {
+			log.Printf("Failed to include %d of %d orphans\n", failed, included+failed)
+			exitCode = exitPartialFailure
+		}
+	case "plan":
+		mode := findConfig("plan-mode")
+		log.Printf("Planning %s\n", mode)
+		org := parseOrganization(findConfig("org-file"))
+		loadAggressiveness(csp, org)
+		mngr := cloud.NewCachedManager(initManager(csp, org))
+		p := makePlan(ctx, mode, csp, org, mngr)
+		fmt.Print(p.Format())
+		if exceeded := p.Exceeded(planLimits()); len(exceeded) > 0 {
+			for _, limit := range exceeded {
+				log.Println("Plan exceeds limit:", limit)
+			}
+			exitCode = exitApprovalRequired
+		}
+	case "serve":
+		log.Println("Serving read-only resource queries")
+		org := parseOrganization(findConfig("org-file"))
+		mngr := initManager(csp, org)
+		refresh := time.Duration(findConfigInt("serve-refresh-minutes")) * time.Minute
+		server := query.NewServer(mngr, org.AccountToUserMapping(csp), refresh)
+		if err := server.ListenAndServe(ctx, findConfig("serve-address")); ctx.Err() == nil {
+			log.Fatal(err)
+		}
+	case "notifications list":
+		mails, err := initHeldMailQueue().List()
+		if err != nil {
+			log.Fatalf("Could not list held mails: %s\n", err)
+		}
+		fmt.Print(notify.FormatHeldMails(mails))
+		if len(mails) == 0 {
+			exitCode = exitNothingToDo
+		}
+	case "notifications release":
+		log.Println("Releasing held mails")
+		org := parseOrganization(findConfig("org-file"))
+		client := initNotifyClient(org)
+		failed, err := client.ReleaseHeldMails(initHeldMailQueue())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if failed > 0 {
+			exitCode = exitPartialFailure
+		}
+	case "reconcile-org":
+		log.Printf("Reconciling the accounts in %s with %s\n", findConfig("org-file"), csp)
+		org := parseOrganization(findConfig("org-file"))
+		defaultOwner := findConfig("reconcile-default-owner")
+		if employee, exist := org.UsernameToEmployeeMapping()[defaultOwner]; defaultOwner != "" && (!exist || employee.Disabled) {
+			configFatalf("The --reconcile-default-owner %s is not an enabled employee in the organization", defaultOwner)
+		}
+		discovered, err := cloud.DiscoverAccounts(ctx, csp, findConfig("reconcile-management-account"), findConfig("reconcile-owner-tag"))
+		if err != nil {
+			log.Fatalf("Could not discover accounts: %s\n", err)
+		}
+		changes := org.ReconcileAccounts(csp, discovered, defaultOwner)
+		fmt.Print(cs.FormatAccountChanges(changes))
+		if len(changes) == 0 {
+			exitCode = exitNothingToDo
+		} else if err := writeAccountPatch(findConfig("reconcile-patch-file"), org.AccountPatch(csp, changes)); err != nil {
+			log.Fatalf("Could not write patch: %s\n", err)
+		} else {
+			log.Printf("Wrote the suggested changes to %s\n", findConfig("reconcile-patch-file"))
+		}
+	case "print-config":
+		fmt.Print(effectiveConfig())
+	case "doctor":
+		log.Println("Checking all integrations")
+		org := parseOrganization(findConfig("org-file"))
+		results := doctor.Run(doctorChecks(csp, org))
+		fmt.Print(doctor.FormatResults(results))
+		if doctor.Failures(results) > 0 {
+			exitCode = exitFailure
+		}
 	case "setup":
 		log.Println("Running cloudsweeper setup")
 		setup.PerformSetup(findConfig("aws-master-arn"))
 	default:
-		log.Fatalln("Please supply a command")
+		configFatalf("Please supply a command")
+	}
+	flushReportOutput()
+	closeAudit()
+	saveResourceCache()
+	exitCode = accountErrorsExitCode(exitCode, managers)
+	if err := ctx.Err(); err != nil {
+		log.Println("The command did not finish:", err)
+		exitCode = exitCancelled
+	}
+	if summary := metrics.RunSummary(); summary != "" {
+		log.Print(summary)
+	}
+	pushMetrics(cmd, csp, exitCode)
+	stop()
+	os.Exit(exitCode)
+}
+
+// pushMetrics records that the command finished, and pushes the metrics
+// to the Prometheus Pushgateway, if one is configured
+func pushMetrics(cmd string, csp cloud.CSP, exitCode int) {
+	gatewayURL := findConfig("metrics-pushgateway-url")
+	if gatewayURL == "" {
+		return
+	}
+	for _, mngr := range managers {
+		metrics.ObserveScanStatus(mngr)
+	}
+	metrics.ObserveAPICalls()
+	metrics.LastRun.Set(float64(time.Now().Unix()), cmd)
+	metrics.LastExitCode.Set(float64(exitCode), cmd)
+	grouping := map[string]string{"command": cmd, "csp": strings.ToLower(string(csp))}
+	if err := metrics.Push(context.Background(), gatewayURL, findConfig("metrics-pushgateway-job"), grouping); err != nil {
+		log.Printf("Could not push metrics to %s: %s\n", gatewayURL, err)
+	}
+}
+
+// runContext returns the context of the command, which is cancelled on
+// SIGINT or SIGTERM, or once run-timeout-minutes have passed. In-flight
+// requests are then aborted, and the command stops before acting on
+// the remaining accounts. A second signal kills the process right away.
+func runContext() (context.Context, context.CancelFunc) {
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	cancel := context.CancelFunc(func() {})
+	if minutes := findConfigInt("run-timeout-minutes"); minutes > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(minutes)*time.Minute)
+	}
+	go func() {
+		<-ctx.Done()
+		stopSignals()
+	}()
+	return ctx, func() {
+		cancel()
+		stopSignals()
 	}
 }
 
+// managers are the managers created by initManager, whose failed
+// accounts are summarized at the end of the command
+var managers []cloud.ResourceManager
+
 func initManager(csp cloud.CSP, org *cs.Organization) cloud.ResourceManager {
 	manager, err := cloud.NewManager(csp, org.EnabledAccounts(csp)...)
 	if err != nil {
 		log.Fatal(err)
 		return nil
 	}
-	return manager
+	managers = append(managers, manager)
+	return cloud.NewIgnoringManager(metrics.NewInstrumentedManager(manager), resourceIgnorePatterns)
+}
+
+// resourceCache is the resource cache opened by initCachedManager, which
+// is saved at the end of the command with the changes made to resources
+var resourceCache *cloud.ResourceCache
+
+// initCachedManager returns a manager that lists resources from the
+// resource cache, after listing the accounts whose data is older than ttl
+// again. A ttl of 0 lists all accounts again. Without a resource cache,
+// the manager of initManager is returned.
+func initCachedManager(ctx context.Context, csp cloud.CSP, org *cs.Organization, ttl time.Duration) cloud.ResourceManager {
+	path := findConfig("resource-cache-file")
+	if path == "" {
+		return initManager(csp, org)
+	}
+	// The cache is shared by the managers of a review of several CSPs
+	cache := resourceCache
+	if cache == nil {
+		var err error
+		cache, err = cloud.OpenResourceCache(ctx, path)
+		if err != nil {
+			configFatalf("%s\n", err)
+		}
+		resourceCache = cache
+	}
+	accounts := org.EnabledAccounts(csp)
+	refreshed, err := cache.Refresh(ctx, csp, accounts, ttl)
+	if refreshed == nil && err != nil {
+		log.Fatal(err)
+	} else if err != nil {
+		log.Printf("Could not save the resource cache: %s\n", err)
+	}
+	log.Printf("Listed %d accounts again, read %d from the resource cache\n", len(refreshed), len(accounts)-len(refreshed))
+	manager, err := cloud.NewManager(csp, accounts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cached := cloud.NewResourceCacheManager(manager, csp, cache)
+	managers = append(managers, cached)
+	return cloud.NewIgnoringManager(metrics.NewInstrumentedManager(cached), resourceIgnorePatterns)
 }
 
-func initNotifyClient() *notify.Client {
+// resourceCacheTTL is how old the data of an account in the resource
+// cache may be before it's listed again
+func resourceCacheTTL() time.Duration {
+	return time.Duration(findConfigInt("resource-cache-ttl-hours")) * time.Hour
+}
+
+// saveResourceCache saves the changes made to the resources in the
+// resource cache, such as tags added by mark-for-cleanup
+func saveResourceCache() {
+	if resourceCache == nil {
+		return
+	}
+	if err := resourceCache.Save(); err != nil {
+		log.Printf("Could not save the resource cache: %s\n", err)
+	}
+}
+
+// initOwnerManager returns the employee running Cloudsweeper, identified
+// by the principal of their own credentials, such as an SSO session, and
+// a manager of only their Cloudsweeper enabled accounts. The employee is
+// recorded as the actor in the audit log.
+func initOwnerManager(csp cloud.CSP, org *cs.Organization) (*cs.Employee, cloud.ResourceManager) {
+	principal, err := cloud.CallerIdentity(csp)
+	if err != nil {
+		log.Fatalf("Could not identify who is running Cloudsweeper: %s\n", err)
+	}
+	employee := org.EmployeeForPrincipal(principal, findConfig("mail-domain"))
+	if employee == nil {
+		log.Fatalf("%s is not an employee in the organization\n", principal)
+	}
+	accounts := employee.EnabledAccounts(csp)
+	if len(accounts) == 0 {
+		log.Fatalf("%s has no Cloudsweeper enabled accounts in %s\n", employee.Username, csp)
+	}
+	log.Printf("Acting on behalf of %s (%s) in %s\n", employee.Username, principal, strings.Join(accounts, ", "))
+	cleanup.Actor = principal
+	manager, err := cloud.NewManager(csp, accounts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	managers = append(managers, manager)
+	return employee, cloud.NewIgnoringManager(metrics.NewInstrumentedManager(manager), resourceIgnorePatterns)
+}
+
+// initCleanupDelegate hands all cleanups of the manager to the configured
+// cleanup delegate, if there is one
+func initCleanupDelegate(csp cloud.CSP, mngr cloud.ResourceManager) cloud.ResourceManager {
+	name := findConfig("cleanup-delegate")
+	if name == "" {
+		return mngr
+	}
+	region := findConfig("cleanup-delegate-region")
+	if region == "" {
+		configFatalf("No value specified for --cleanup-delegate-region")
+	}
+	cloud.DelegateTimeout = time.Duration(findConfigInt("cleanup-delegate-timeout-minutes")) * time.Minute
+	var delegate cloud.CleanupDelegate
+	var err error
+	if csp == cloud.AWS {
+		delegate, err = cloud.NewSSMAutomationDelegate(name, region)
+	} else {
+		delegate, err = cloud.NewWorkflowsDelegate(name, region)
+	}
+	if err != nil {
+		log.Fatalf("Could not initialize cleanup delegate: %s\n", err)
+	}
+	log.Printf("Delegating cleanups to %s in %s\n", name, region)
+	return cloud.NewDelegatingManager(mngr, delegate)
+}
+
+func initNotifyClient(org *cs.Organization) *notify.Client {
+	return notify.Init(notifyConfig(org))
+}
+
+// initHeldMailQueue returns the queue mails are held in for review, in
+// the configured bucket or directory
+func initHeldMailQueue() notify.MailQueue {
+	var queue notify.MailQueue
+	var err error
+	if bucket := findConfig("held-mail-bucket"); bucket != "" {
+		queue, err = notify.NewS3Queue(bucket, findConfig("held-mail-bucket-region"))
+	} else {
+		queue, err = notify.NewDirQueue(findConfig("held-mail-dir"))
+	}
+	if err != nil {
+		log.Fatalf("Could not initialize held mail queue: %s\n", err)
+	}
+	return queue
+}
+
+func notifyConfig(org *cs.Organization) *notify.Config {
+	resolveMailSecrets(org)
 	config := &notify.Config{
 		SMTPUsername:           findConfig("smtp-username"),
 		SMTPPassword:           findConfig("smtp-password"),
@@ -223,22 +1038,635 @@ func initNotifyClient() *notify.Client {
 		EmailDomain:            findConfig("mail-domain"),
 		BillingReportAddressee: findConfig("billing-report-addressee"),
 		TotalSumAddresse:       findConfig("total-sum-addressee"),
+		WhitelistAddressee:     findConfig("whitelist-report-addressee"),
+		State:                  initStateStore(),
+		MailDedupeWindow:       time.Duration(findConfigInt("mail-dedupe-hours")) * time.Hour,
+		MailMaxPerRecipient:    findConfigInt("mail-max-per-recipient"),
+		UserEmails:             resolveUserEmails(org),
+		AutomationPrincipals:   findConfigList("automation-principals"),
+		AutomationAddressee:    findConfig("automation-addressee"),
+		ManagerRollup:          findRollupStyle("review-manager-rollup"),
+		OrgRollup:              findRollupStyle("review-org-rollup"),
+		RollupTopN:             findConfigInt("review-rollup-top-n"),
+		RollupDepth:            findConfigInt("review-rollup-depth"),
+		Subjects:               findSubjects(),
+		SubjectBadge:           findSubjectBadge(),
+		CreatorLookup:          findConfigBool("creator-lookup"),
+		MinResourcesPerType:    findMinResourcesPerType(),
+		Runbooks:               findRunbooks(),
+		DashboardURL:           findConfig("dashboard-url"),
+		Order:                  findMailOrder("mail-sort-by"),
+		Organization:           org,
+		Policy:                 thresholds,
+	}
+	if len(config.AutomationPrincipals) > 0 && config.AutomationAddressee == "" {
+		configFatalf("Must specify --automation-addressee when using --automation-principals")
+	}
+	if findConfigBool("hold-notifications") {
+		config.HoldQueue = initHeldMailQueue()
+	}
+	if output := initReportOutput(); output != nil {
+		config.Output = output
+		config.OutputOnly = findConfigBool("output-only")
+	}
+	return config
+}
+
+// makePlan plans what the specified command would do, without doing it.
+// Mails are planned by running the command with a notify client that
+// only collects them.
+func makePlan(ctx context.Context, mode string, csp cloud.CSP, org *cs.Organization, mngr cloud.ResourceManager) *plan.Plan {
+	p := &plan.Plan{Mode: mode}
+	if window, frozen := activeFreezeWindow(); frozen && (mode == "mark-for-cleanup" || mode == "cleanup") {
+		log.Printf("Nothing would be done during the freeze window %s\n", window)
+		return p
+	}
+	config := notifyConfig(org)
+	config.Plan = true
+	config.Output = nil
+	client := notify.Init(config)
+	mapping := org.AccountToUserMapping(csp)
+	switch mode {
+	case "mark-for-cleanup":
+		p.Marked = cleanup.PlanMarking(ctx, mngr, thresholds)
+	case "cleanup":
+		now := clock.Now()
+		endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		p.CleanedUp = cleanup.PlanCleanup(ctx, mngr, endOfDay)
+	case "review":
+		client.OldResourceReview(ctx, map[cloud.CSP]cloud.ResourceManager{csp: mngr}, org, thresholds)
+	case "warn":
+		client.DeletionWarning(ctx, findReminders("warning-hours"), mngr, mapping)
+		client.StopWarning(ctx, findReminders("warning-hours"), mngr, mapping)
+	case "find-untagged":
+		client.UntaggedResourcesReview(ctx, mngr, mapping)
+	case "retention-report":
+		client.RetentionLapsedReport(ctx, mngr, mapping)
+	default:
+		configFatalf("Cannot plan %q, --plan-mode must be one of mark-for-cleanup, cleanup, review, warn, find-untagged or retention-report", mode)
+	}
+	p.Mails = client.PlannedMails()
+	return p
+}
+
+func planLimits() plan.Limits {
+	return plan.Limits{
+		MaxMarked:           findConfigInt("plan-max-marked"),
+		MaxMarkedPerAccount: findConfigInt("plan-max-marked-per-account"),
+		MaxCleanedUp:        findConfigInt("plan-max-cleaned-up"),
+		MaxMails:            findConfigInt("plan-max-mails"),
+	}
+}
+
+// initReporter returns the billing reporter of the CSP, sorting costs
+// on the specified tag if it's not empty
+func initReporter(csp cloud.CSP, sortTag string) billing.Reporter {
+	switch csp {
+	case cloud.AWS:
+		switch source := findConfig("billing-source"); source {
+		case billingSourceCUR:
+			return billing.NewReporterAWS(findConfig("billing-account"), findConfig("billing-bucket"), findConfig("billing-bucket-region"), sortTag)
+		case billingSourceCostExplorer:
+			return billing.NewReporterCostExplorer(findConfig("billing-account"), sortTag)
+		default:
+			configFatalf("Invalid --billing-source %s, must be %s or %s", source, billingSourceCUR, billingSourceCostExplorer)
+			return nil
+		}
+	case cloud.GCP:
+		if configValue("billing-bigquery-project") != "" {
+			return billing.NewReporterBigQuery(findConfig("billing-bigquery-project"), findConfig("billing-bigquery-dataset"), findConfig("billing-bigquery-table"))
+		}
+		return billing.NewReporterGCP(findConfig("billing-bucket"), findConfig("billing-csv-prefix"))
+	default:
+		configFatalf("Invalid CSP specified")
+		return nil
 	}
-	return notify.Init(config)
+}
+
+// billingResourceTags returns the tags of the resources in the billing
+// data of this and the previous month, by resource ID. It's empty unless
+// billing is configured and its data has resource IDs, as in AWS.
+func billingResourceTags(csp cloud.CSP, keys []string) map[string]map[string]string {
+	result := make(map[string]map[string]string)
+	if csp != cloud.AWS || configValue("billing-bucket") == "" {
+		log.Println("Not using billing data to suggest tags, since there is no AWS billing bucket configured")
+		return result
+	}
+	reporter := billing.NewReporterAWS(findConfig("billing-account"), findConfig("billing-bucket"), findConfig("billing-bucket-region"), "")
+	source, ok := reporter.(billing.TagSource)
+	if !ok {
+		return result
+	}
+	now := clock.Now()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	// Tags of this month override those of the previous month
+	for _, start := range []time.Time{thisMonth.AddDate(0, -1, 0), thisMonth} {
+		tags, err := source.ResourceTags(start, keys...)
+		if err != nil {
+			log.Printf("Could not get resource tags from billing data of %s: %s\n", start.Format("2006-01"), err)
+			continue
+		}
+		for id, resourceTags := range tags {
+			if _, ok := result[id]; !ok {
+				result[id] = make(map[string]string)
+			}
+			for key, val := range resourceTags {
+				result[id][key] = val
+			}
+		}
+	}
+	return result
+}
+
+// findSubjects returns the configured subject templates, by the name
+// of the mail they override the subject of
+func findSubjects() map[string]string {
+	subjects := make(map[string]string)
+	for _, name := range notify.SubjectNames() {
+		if subject := findConfig("subject-" + name); subject != "" {
+			subjects[name] = subject
+		}
+	}
+	if err := notify.ValidateSubjects(subjects); err != nil {
+		configFatalf("Invalid mail subject: %s", err)
+	}
+	return subjects
+}
+
+// findSubjectBadge returns the configured subject badge template
+func findSubjectBadge() string {
+	badge := findConfig("subject-badge")
+	if err := notify.ValidateSubjectBadge(badge); err != nil {
+		configFatalf("Invalid --subject-badge: %s", err)
+	}
+	return badge
+}
+
+// findMinResourcesPerType parses the minimum amount of resources of each
+// type in reviews, on the form <type>=<count>
+func findMinResourcesPerType() map[string]int {
+	types := make(map[string]bool)
+	for _, resourceType := range notify.ReviewResourceTypes {
+		types[resourceType] = true
+	}
+	result := make(map[string]int)
+	for _, val := range findConfigList("notify-min-resources-per-type") {
+		parts := strings.SplitN(val, "=", 2)
+		if len(parts) != 2 || !types[parts[0]] {
+			configFatalf("Invalid --notify-min-resources-per-type %q, must be <type>=<count> where type is one of %s", val, strings.Join(notify.ReviewResourceTypes, ", "))
+		}
+		count, err := strconv.Atoi(parts[1])
+		if err != nil {
+			configFatalf("Value specified for %s in --notify-min-resources-per-type is not an integer", parts[0])
+		}
+		result[parts[0]] = count
+	}
+	return result
+}
+
+// findRunbooks loads the remediation guidance shown in reviews and
+// warnings, if a runbook directory is configured
+func findRunbooks() map[string]template.HTML {
+	dir := findConfig("notify-runbook-dir")
+	if dir == "" {
+		return nil
+	}
+	runbooks, err := notify.LoadRunbooks(dir)
+	if err != nil {
+		configFatalf("%s", err)
+	}
+	return runbooks
+}
+
+// findReminders parses the lead times of the reminders sent before
+// resources are cleaned up or stopped
+func findReminders(name string) notify.Reminders {
+	reminders, err := notify.ParseReminders(findConfigList(name))
+	if err != nil {
+		configFatalf("Invalid value for --%s: %s", name, err)
+	}
+	return reminders
+}
+
+func findRollupStyle(name string) notify.RollupStyle {
+	style, err := notify.ParseRollupStyle(findConfig(name))
+	if err != nil {
+		configFatalf("Invalid value for --%s: %s", name, err)
+	}
+	return style
+}
+
+func findMailOrder(name string) notify.MailOrder {
+	order, err := notify.ParseMailOrder(findConfig(name))
+	if err != nil {
+		configFatalf("Invalid value for --%s: %s", name, err)
+	}
+	return order
+}
+
+// resolveUserEmails will look up the email addresses of all employees in
+// the directory, if one is configured. The managers found in the directory
+// replace the ones in the organization.
+func resolveUserEmails(org *cs.Organization) map[string]string {
+	scimURL := findConfig("directory-scim-url")
+	if scimURL == "" {
+		return nil
+	}
+	log.Println("Resolving employees using directory at", scimURL)
+	dir := directory.NewSCIM(scimURL, findConfig("directory-scim-token"))
+	resolution, err := directory.Resolve(org, dir)
+	if err != nil {
+		log.Fatalf("Could not resolve organization using directory: %s\n", err)
+	}
+	resolution.LogMismatches()
+	usernames := make([]string, 0, len(resolution.Managers))
+	for username := range resolution.Managers {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		if err := org.SetManager(username, resolution.Managers[username]); err != nil {
+			log.Printf("Keeping the manager of %s from the organization: %s\n", username, err)
+		}
+	}
+	return resolution.Emails
+}
+
+// stateStore is opened once, since all users of the state file must share
+// the same store to not overwrite each other's changes
+var stateStore *state.Store
+
+func initStateStore() *state.Store {
+	path := findConfig("state-file")
+	if path == "" || stateStore != nil {
+		return stateStore
+	}
+	if *fakeNow != "" {
+		// Times of the frozen clock must never end up in the state
+		log.Println("Not using the state file, since the clock is frozen")
+		return nil
+	}
+	store, err := state.Open(path)
+	if err != nil {
+		log.Fatalf("Could not open state store: %s\n", err)
+	}
+	stateStore = store
+	return store
+}
+
+// writeAccountPatch writes the JSON Patch of the organization file made
+// by the reconcile-org command
+func writeAccountPatch(fileName string, ops []*cs.PatchOperation) error {
+	raw, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(raw, '\n'), 0644)
 }
 
 func parseOrganization(inputFile string) *cs.Organization {
 	raw, err := ioutil.ReadFile(inputFile)
 	if err != nil {
-		log.Fatalf("Could not read organization file: %s\n", err)
+		configFatalf("Could not read organization file: %s\n", err)
 	}
 	org, err := cs.InitOrganization(raw)
 	if err != nil {
-		log.Fatalf("Failed to initalize organization: %s\n", err)
+		configFatalf("Failed to initalize organization: %s\n", err)
 	}
+	loadAccountAliases(org)
 	return org
 }
 
+// loadAccountAliases sets the aliases of the accounts/projects in the
+// organization, and looks up the aliases of the enabled AWS accounts
+// without one, so that they're shown as "alias (ID)"
+func loadAccountAliases(org *cs.Organization) {
+	for _, csp := range cspsFromConfig(findConfig("csp")) {
+		for account, alias := range org.AccountAliases(csp) {
+			cloud.SetAccountAlias(account, alias)
+		}
+		if findConfigBool("fetch-account-aliases") {
+			cloud.FetchAccountAliases(csp, org.EnabledAccounts(csp))
+		}
+	}
+}
+
+func loadOrdering() {
+	cloud.Ordered = findConfigBool("ordered")
+}
+
+func loadRoleChain() {
+	hops := findConfigList("assume-role-chain")
+	if len(hops) == 0 {
+		return
+	}
+	chain, err := cloud.ParseRoleChain(hops)
+	if err != nil {
+		configFatalf("Invalid assume-role-chain: %s", err)
+	}
+	cloud.RoleChain = chain
+}
+
+// loadNetwork configures how AWS and GCP are reached, it must be loaded
+// before any client is created, including those resolving secrets
+func loadNetwork() {
+	if proxy := findConfig("proxy-url"); proxy != "" {
+		if err := cloud.SetProxy(proxy); err != nil {
+			configFatalf("Invalid proxy-url: %s", err)
+		}
+	}
+	cloud.AWSSTSRegion = findConfig("aws-sts-region")
+	endpoints, err := cloud.ParseAWSEndpoints(findConfigList("aws-endpoints"))
+	if err != nil {
+		configFatalf("Invalid aws-endpoints: %s", err)
+	}
+	cloud.AWSEndpoints = endpoints
+	cloud.AWSMaxConcurrentRequests = findConfigInt("max-concurrent-requests")
+	cloud.AWSRequestsPerSecond = findConfigInt("max-requests-per-second")
+}
+
+// loadBucketRegionCache caches the regions of AWS buckets in the state
+// file, if there is one
+func loadBucketRegionCache() {
+	if store := initStateStore(); store != nil {
+		cloud.AWSBucketRegionCache = store
+	}
+}
+
+// loadAddressFirstSeen keeps when AWS Elastic IP addresses were first seen
+// in the state file, if there is one, so that their age can be told
+func loadAddressFirstSeen() {
+	if store := initStateStore(); store != nil {
+		cloud.AWSAddressFirstSeen = store
+	}
+}
+
+// loadTombstones keeps a tombstone of every resource cleaned up in the
+// state file, if there is one
+func loadTombstones() {
+	if store := initStateStore(); store != nil {
+		cleanup.Tombstones = store
+	}
+}
+
+// loadAudit records every change made to a resource in the audit file
+// and/or the audit bucket, if any of them are configured
+func loadAudit(csp cloud.CSP) {
+	logs := []cleanup.AuditLog{}
+	if path := findConfig("audit-file"); path != "" {
+		auditLog, err := cleanup.NewFileAuditLog(path)
+		if err != nil {
+			configFatalf("Could not open audit file: %s\n", err)
+		}
+		logs = append(logs, auditLog)
+	}
+	if bucket := findConfig("audit-bucket"); bucket != "" {
+		logs = append(logs, cleanup.NewBucketAuditLog(csp, bucket, findConfig("audit-bucket-region"), findConfig("audit-prefix")))
+	}
+	switch len(logs) {
+	case 0:
+		return
+	case 1:
+		cleanup.Audit = logs[0]
+	default:
+		cleanup.Audit = cleanup.MultiAuditLog(logs...)
+	}
+	cleanup.Actor = auditActor()
+}
+
+// auditActor returns who is running Cloudsweeper, on the form
+// <user>@<host>
+func auditActor() string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
+
+// closeAudit writes any buffered audit events. The audit log is required
+// for compliance, so failing to write it fails the run.
+func closeAudit() {
+	if cleanup.Audit == nil {
+		return
+	}
+	if err := cleanup.Audit.Close(); err != nil {
+		log.Fatalf("Could not write the audit log: %s\n", err)
+	}
+}
+
+func loadGCPBucketListing() {
+	cloud.GCPBucketListTimeout = time.Duration(findConfigInt("gcp-bucket-list-timeout-seconds")) * time.Second
+	cloud.GCPObjectListRequestsPerSecond = findConfigInt("gcp-object-list-requests-per-second")
+	cloud.GCPBucketListPrefixes = findConfigList("gcp-bucket-list-prefixes")
+}
+
+func loadSystemTagPrefixes() {
+	filter.SystemTagPrefixes = findConfigList("system-tag-prefixes")
+}
+
+var resourceIgnorePatterns []*regexp.Regexp
+
+func loadIgnorePatterns() {
+	var err error
+	resourceIgnorePatterns, err = cloud.ParseIgnorePatterns(findConfigList("ignore-patterns"))
+	if err != nil {
+		configFatalf("%s", err)
+	}
+}
+
+func loadPolicyFile() {
+	fileName := findConfig("policy-file")
+	if fileName == "" {
+		return
+	}
+	policy, err := filter.LoadPolicy(fileName)
+	if err != nil {
+		configFatalf("Could not load policy file: %s", err)
+	}
+	cleanup.Policy = policy
+}
+
+func loadDatabasePatterns() {
+	for _, expr := range findConfigList("database-patterns") {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			configFatalf("Invalid database pattern '%s': %s", expr, err)
+		}
+		filter.DatabasePatterns = append(filter.DatabasePatterns, pattern)
+	}
+}
+
+func loadImageReferences() {
+	cleanup.ImageParameterPaths = findConfigList("image-ssm-parameter-paths")
+	cleanup.ProtectLaunchTemplateImages = findConfigBool("protect-launch-template-images")
+}
+
+// loadReleaseImages sets up the lifecycle of release images, if it
+// applies to the CSP
+func loadReleaseImages(csp cloud.CSP) {
+	cleanup.ReleaseTagKey = findConfig("release-tag")
+	if cleanup.ReleaseTagKey == "" {
+		configFatalf("The --release-tag must not be empty")
+	}
+	lifecycle := &cleanup.ReleaseImageLifecycle{
+		MakePrivateDays: findConfigInt("release-images-private-after-days"),
+		DeregisterDays:  findConfigInt("release-images-deregister-after-days"),
+	}
+	if lifecycle.MakePrivateDays < 0 || lifecycle.DeregisterDays < 0 {
+		configFatalf("The release image lifecycle days must not be negative")
+	}
+	for _, name := range findConfigList("release-images-csps") {
+		if cspFromConfig(name) == csp {
+			cleanup.ReleaseImages = lifecycle
+		}
+	}
+}
+
+// loadAggressiveness scales the marking thresholds in the accounts of
+// employees who opted in to another aggressiveness
+func loadAggressiveness(csp cloud.CSP, org *cs.Organization) {
+	multipliers := make(map[cs.Aggressiveness]float64)
+	for _, val := range findConfigList("aggressiveness-multipliers") {
+		parts := strings.SplitN(val, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || !cs.Aggressiveness(parts[0]).Valid() {
+			configFatalf("Invalid --aggressiveness-multipliers %q, must be <level>=<multiplier> where level is one of %s", val, aggressivenessNames())
+		}
+		multiplier, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || multiplier <= 0 {
+			configFatalf("Multiplier specified for %s in --aggressiveness-multipliers is not a positive number", parts[0])
+		}
+		multipliers[cs.Aggressiveness(parts[0])] = multiplier
+	}
+	cleanup.AccountThresholdMultipliers = make(map[string]float64)
+	for account, level := range org.AccountAggressiveness(csp) {
+		if multiplier, ok := multipliers[level]; ok {
+			cleanup.AccountThresholdMultipliers[account] = multiplier
+		}
+	}
+}
+
+func aggressivenessNames() string {
+	names := []string{}
+	for _, level := range cs.AggressivenessLevels {
+		names = append(names, string(level))
+	}
+	return strings.Join(names, ", ")
+}
+
+func loadRetention() {
+	filter.RetentionTagKey = findConfig("retention-tag-key")
+}
+
+func loadMaxLifetime() {
+	filter.MaxLifetimeDays = findConfigInt("max-lifetime-days")
+	filter.MaxLifetimeGraceDays = findConfigInt("max-lifetime-grace-days")
+	if filter.MaxLifetimeDays < 0 || filter.MaxLifetimeGraceDays < 0 {
+		configFatalf("The max-lifetime-days and max-lifetime-grace-days must not be negative")
+	}
+	filter.MaxLifetimeAccounts = findConfigList("max-lifetime-accounts")
+}
+
+func loadWhitelistApproval() {
+	filter.WhitelistApprovers = findConfigList("whitelist-approvers")
+	cost, err := strconv.ParseFloat(findConfig("whitelist-approval-cost-per-month"), 64)
+	if err != nil || cost < 0 {
+		configFatalf("Value specified for whitelist-approval-cost-per-month is not a positive number")
+	}
+	filter.WhitelistApprovalCostPerMonth = cost
+	filter.ResourceCostPerMonth = func(res cloud.Resource) float64 {
+		if bucket, ok := res.(cloud.Bucket); ok {
+			return billing.BucketPricePerMonth(bucket)
+		}
+		return billing.ResourceCostPerDay(res) * 30.0
+	}
+}
+
+func loadCostAmortization() {
+	billing.AmortizationWindowDays = findConfigInt("cost-amortization-days")
+}
+
+// loadFakeNow freezes the clock at --fake-now. It's only allowed when
+// nothing is changed, in a marking dry run or a plan, since a frozen clock
+// in the future would make real resources look due for cleanup.
+func loadFakeNow() {
+	if *fakeNow == "" {
+		return
+	}
+	if cmd := getPositionalCmd(); cmd != "plan" && !(cmd == "mark-for-cleanup" && *dryRun) {
+		configFatalf("--fake-now can only be used with plan, or mark-for-cleanup with --marking-dry-run")
+	}
+	now, err := time.Parse(time.RFC3339, *fakeNow)
+	if err != nil {
+		now, err = time.Parse("2006-01-02", *fakeNow)
+		if err != nil {
+			configFatalf("Invalid --fake-now %q, must be RFC3339 or YYYY-MM-DD", *fakeNow)
+		}
+	}
+	log.Printf("Freezing clock at %s\n", now.Format(time.RFC3339))
+	clock.Set(clock.Frozen(now))
+}
+
+// freezeWindow is a period, such as the end of a quarter, during which
+// nothing is marked or cleaned up
+type freezeWindow struct {
+	start, end time.Time
+}
+
+func (w freezeWindow) String() string {
+	return w.start.Format("2006-01-02") + "/" + w.end.Format("2006-01-02")
+}
+
+var freezeWindows []freezeWindow
+
+func loadFreezeWindows() {
+	for _, spec := range findConfigList("freeze-windows") {
+		parts := strings.SplitN(spec, "/", 2)
+		if len(parts) != 2 {
+			configFatalf("Invalid freeze window %q, must be <start>/<end>", spec)
+		}
+		start, err := time.Parse("2006-01-02", strings.TrimSpace(parts[0]))
+		if err != nil {
+			configFatalf("Invalid start of freeze window %q, must be YYYY-MM-DD", spec)
+		}
+		end, err := time.Parse("2006-01-02", strings.TrimSpace(parts[1]))
+		if err != nil {
+			configFatalf("Invalid end of freeze window %q, must be YYYY-MM-DD", spec)
+		}
+		if end.Before(start) {
+			configFatalf("Invalid freeze window %q, it ends before it starts", spec)
+		}
+		freezeWindows = append(freezeWindows, freezeWindow{start: start, end: end})
+	}
+}
+
+// activeFreezeWindow returns the freeze window that today is in, if any.
+// Windows are in UTC, and include the whole end date.
+func activeFreezeWindow() (freezeWindow, bool) {
+	now := clock.Now().UTC()
+	for _, w := range freezeWindows {
+		if !now.Before(w.start) && now.Before(w.end.AddDate(0, 0, 1)) {
+			return w, true
+		}
+	}
+	return freezeWindow{}, false
+}
+
+// usage prints the usage of all flags, except for the hidden ones
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	flag.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "  -%s\n    \t%s\n", f.Name, f.Usage)
+	})
+}
+
 func getPositionalCmd() string {
 	n := len(os.Args)
 	if n <= 1 {
@@ -256,7 +1684,31 @@ func cspFromConfig(rawFlag string) cloud.CSP {
 		return cloud.GCP
 	default:
 		fmt.Fprintf(os.Stderr, "Invalid CSP flag \"%s\" specified\n", rawFlag)
-		os.Exit(1)
+		os.Exit(exitConfigError)
 		return cloud.AWS
 	}
 }
+
+// cspsFromConfig returns the CSPs of a comma separated --csp, such as
+// "aws,gcp". Only review runs against several CSPs at once.
+func cspsFromConfig(rawFlag string) []cloud.CSP {
+	csps := []cloud.CSP{}
+	seen := make(map[cloud.CSP]bool)
+	for _, name := range strings.Split(rawFlag, ",") {
+		csp := cspFromConfig(strings.TrimSpace(name))
+		if !seen[csp] {
+			seen[csp] = true
+			csps = append(csps, csp)
+		}
+	}
+	return csps
+}
+
+// cspRunName names the CSPs of a run in its RunID, such as "aws-gcp"
+func cspRunName(csps []cloud.CSP) string {
+	names := []string{}
+	for _, csp := range csps {
+		names = append(names, strings.ToLower(string(csp)))
+	}
+	return strings.Join(names, "-")
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/cloudtools/cloudsweeper/cloudsweeper/notify"
+)
+
+// reportOutput is where reports are written with --output-format. It's
+// opened when the first notify client is initialized.
+var reportOutput *notify.ReportOutput
+
+// initReportOutput returns the output reports are written to, or nil if
+// no --output-format is specified
+func initReportOutput() *notify.ReportOutput {
+	if reportOutput != nil || findConfig("output-format") == "" {
+		return reportOutput
+	}
+	format, err := notify.ParseOutputFormat(findConfig("output-format"))
+	if err != nil {
+		configFatalf("Invalid value for --output-format: %s", err)
+	}
+	var w io.Writer = os.Stdout
+	if name := findConfig("output-file"); name != "-" {
+		file, err := os.Create(name)
+		if err != nil {
+			log.Fatalf("Could not create output file: %s\n", err)
+		}
+		w = file
+	}
+	reportOutput = notify.NewReportOutput(format, w)
+	return reportOutput
+}
+
+// flushReportOutput writes any reports still buffered in the output
+func flushReportOutput() {
+	if reportOutput == nil {
+		return
+	}
+	if err := reportOutput.Flush(); err != nil {
+		log.Printf("Could not write reports: %s\n", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2018 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/cloudtools/cloudsweeper/cloud"
+	cs "github.com/cloudtools/cloudsweeper/cloudsweeper"
+)
+
+const redacted = "****"
+
+// secretConfigs are config options whose values are never logged or shown
+var secretConfigs = map[string]bool{
+	"smtp-password":        true,
+	"directory-scim-token": true,
+}
+
+// secretURLConfigs are config options that are URLs, whose password is
+// never logged or shown
+var secretURLConfigs = map[string]bool{
+	"proxy-url": true,
+}
+
+var (
+	resolvedSecretsMu sync.Mutex
+	resolvedSecrets   = make(map[string]string)
+
+	logRedactor = &redactingWriter{out: os.Stderr}
+)
+
+// resolveSecretConfig resolves a config option referring to a secret in a
+// secret manager. Secrets are only resolved once, and their values are
+// masked in all logs from then on.
+func resolveSecretConfig(name, reference string) string {
+	resolvedSecretsMu.Lock()
+	defer resolvedSecretsMu.Unlock()
+	if value, ok := resolvedSecrets[reference]; ok {
+		return value
+	}
+	value, err := cloud.ResolveSecret(reference)
+	if err != nil {
+		configFatalf("Could not resolve secret for --%s: %s", name, err)
+	}
+	if value == "" {
+		configFatalf("Secret for --%s is empty", name)
+	}
+	logRedactor.addSecret(value)
+	resolvedSecrets[reference] = value
+	return value
+}
+
+// resolveMailSecrets resolves the SMTP passwords of the mail settings in
+// the organization that refer to a secret in a secret manager, and masks
+// the other passwords in all logs
+func resolveMailSecrets(org *cs.Organization) {
+	for _, settings := range org.AllMailSettings() {
+		if cloud.IsSecretReference(settings.SMTPPassword) {
+			settings.SMTPPassword = resolveSecretConfig("smtp-password", settings.SMTPPassword)
+		} else if settings.SMTPPassword != "" {
+			logRedactor.addSecret(settings.SMTPPassword)
+		}
+	}
+}
+
+// loadSecretRedaction masks the values of secret config options in all
+// logs, in case they end up in an error message or similar. Secrets that
+// are resolved from a secret manager are added when they are resolved.
+func loadSecretRedaction() {
+	log.SetOutput(logRedactor)
+	for name := range secretConfigs {
+		if val := configValue(name); val != "" && !cloud.IsSecretReference(val) {
+			logRedactor.addSecret(val)
+		}
+	}
+	for name := range secretURLConfigs {
+		if u, err := url.Parse(configValue(name)); err == nil && u.User != nil {
+			if password, set := u.User.Password(); set && password != "" {
+				logRedactor.addSecret(password)
+			}
+		}
+	}
+}
+
+// effectiveConfig returns the value of every config option, as it's
+// specified, with the values of secret options and the passwords of secret
+// URLs masked. Secret references are shown as is, since they don't contain
+// the secret.
+func effectiveConfig() string {
+	names := make([]string, 0, len(configMapping))
+	for name := range configMapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b := new(bytes.Buffer)
+	for _, name := range names {
+		val := configValue(name)
+		if val != "" && secretConfigs[name] && !cloud.IsSecretReference(val) {
+			val = redacted
+		}
+		if val != "" && secretURLConfigs[name] {
+			val = redactURLPassword(val)
+		}
+		fmt.Fprintf(b, "%-40s %s\n", name, val)
+	}
+	return b.String()
+}
+
+// redactURLPassword masks the password of a URL. Values that can't be
+// parsed are masked entirely, since it's unknown where the password is.
+func redactURLPassword(val string) string {
+	u, err := url.Parse(val)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
+
+// redactingWriter replaces secrets in everything written to it
+type redactingWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	secrets [][]byte
+}
+
+func (w *redactingWriter) addSecret(secret string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.secrets = append(w.secrets, []byte(secret))
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	masked := p
+	for _, secret := range w.secrets {
+		masked = bytes.Replace(masked, secret, []byte(redacted), -1)
+	}
+	if _, err := w.out.Write(masked); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}